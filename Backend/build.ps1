@@ -1,5 +1,7 @@
 ﻿param(
-    [switch]$SkipChecks
+    [switch]$SkipChecks,
+    # Builds an offline edition that installs FFmpeg from this archive when missing
+    [string]$FFmpegArchive
 )
 
 Write-Host "`n================================" -ForegroundColor Cyan
@@ -104,9 +106,47 @@ $env:CGO_ENABLED = "1"
 $env:GOOS = "windows"
 $env:GOARCH = "amd64"
 
-go build -ldflags="-s -w -H windowsgui" -o "dist/recorder-windows-amd64.exe"
+$versionInfo = Get-Content versioninfo.json -Raw | ConvertFrom-Json
+$productVersion = $versionInfo.FixedFileInfo.ProductVersion
+$version = "$($productVersion.Major).$($productVersion.Minor).$($productVersion.Patch)"
+$commit = "unknown"
+if (Test-Command "git") {
+    $commit = (git rev-parse --short HEAD 2>$null)
+    if (-not $commit) { $commit = "unknown" }
+}
+$buildTime = (Get-Date).ToUniversalTime().ToString("yyyy-MM-ddTHH:mm:ssZ")
+Write-Host "Version: $version (commit $commit, built $buildTime)" -ForegroundColor White
+
+$ldflags = "-s -w -H windowsgui " +
+    "-X recorder/services.Version=$version " +
+    "-X recorder/services.Commit=$commit " +
+    "-X recorder/services.BuildTime=$buildTime"
+if ($env:UPDATE_PUBLIC_KEY) {
+    $ldflags += " -X recorder/services.UpdatePublicKey=$env:UPDATE_PUBLIC_KEY"
+}
+
+$output = "dist/recorder-windows-amd64.exe"
+$buildArgs = @()
+$bundled = $null
+if ($FFmpegArchive) {
+    if (-not (Test-Path $FFmpegArchive)) {
+        Write-Host "ERROR: FFmpeg archive not found: $FFmpegArchive" -ForegroundColor Red
+        exit 1
+    }
+    $bundled = Join-Path "services/ffmpegbundle" (Split-Path $FFmpegArchive -Leaf)
+    Copy-Item $FFmpegArchive $bundled
+    $buildArgs += "-tags", "offline"
+    $output = "dist/recorder-windows-amd64-offline.exe"
+    Write-Host "Bundling FFmpeg: $FFmpegArchive" -ForegroundColor White
+}
+
+go build @buildArgs -ldflags="$ldflags" -o $output
+$buildExitCode = $LASTEXITCODE
+if ($bundled) {
+    Remove-Item -Force $bundled
+}
 
-if ($LASTEXITCODE -eq 0) {
+if ($buildExitCode -eq 0) {
     Write-Host "✓ Windows build successful with custom icon!" -ForegroundColor Green
     if (Test-Path "resource.syso") {
         Remove-Item -Force resource.syso
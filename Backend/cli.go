@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"recorder/models"
+	"recorder/services"
+)
+
+// Global flags. They may appear before the command, or after "serve".
+// Flags take precedence over environment variables, which take precedence
+// over the config file.
+var (
+	configFlag    = flag.String("config", "", "config file (default config/recorder.toml, or CONFIG_FILE)")
+	portFlag      = flag.String("port", "", "port to listen on (default 8080, or SERVER_PORT)")
+	dirFlag       = flag.String("dir", "", "recordings directory (default ./recordings, or RECORDINGS_DIR)")
+	headlessFlag  = flag.Bool("headless", false, "serve without opening the desktop window")
+	minimizedFlag = flag.Bool("minimized", false, "open the desktop window minimized (Windows only)")
+	bindFlag      = flag.String("bind", "", "interface to listen on (default 127.0.0.1, or BIND_ADDRESS)")
+	socketFlag    = flag.String("socket", "", "serve the API on this Unix socket instead of TCP (or LISTEN_SOCKET)")
+	portableFlag  = flag.Bool("portable", false, "keep recordings, logs and config next to the executable (or create a file named \"portable\" there)")
+	containerFlag = flag.Bool("container", false, "run in a container: headless, data under /data, logs on stdout (or CONTAINER_MODE)")
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order "help" prints them.
+var commands = []command{
+	{"serve", "run the recording server (default)", runServe},
+	{"convert", "fix duration metadata of recordings with FFmpeg", runConvert},
+	{"repair", "recompute stats.json from the recordings on disk", runRepairStats},
+	{"list", "list the recordings in the recordings directory", runList},
+	{"service", "install, uninstall, start, stop or query the background service", runService},
+	{"issue-token", "issue a scoped API token", runIssueToken},
+	{"issue-client-cert", "issue a client certificate for mutual TLS", runIssueClientCert},
+	{"set-password", "set the UI login password (read from stdin)", runSetPassword},
+	{"healthcheck", "check that the local server is healthy, for container health checks", runHealthcheck},
+	{"player", "play a recording URL in a window of its own, for the desktop app", runPlayer},
+	{"simulate", "send synthetic recordings to a server and report throughput and latency", runSimulate},
+}
+
+// commandAliases keeps old command names working.
+var commandAliases = map[string]string{
+	"repair-stats": "repair",
+}
+
+// parseCommandLine parses the global flags and returns the command to run with
+// its remaining arguments. Without a command it returns "serve", so starting
+// the binary by double-clicking still opens the app.
+func parseCommandLine() (command, []string) {
+	flag.Usage = printUsage
+	flag.Parse()
+
+	args := flag.Args()
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if alias, ok := commandAliases[name]; ok {
+		name = alias
+	}
+	if name == "help" {
+		printUsage()
+		os.Exit(0)
+	}
+	if name == "serve" {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, args
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
+	return command{}, nil
+}
+
+// applyFlagOverrides exports the global flags as the environment variables
+// they override, before the config file is applied.
+func applyFlagOverrides() {
+	if *configFlag != "" {
+		os.Setenv("CONFIG_FILE", *configFlag)
+	}
+	if *portFlag != "" {
+		os.Setenv("SERVER_PORT", *portFlag)
+	}
+	if *containerFlag {
+		os.Setenv("CONTAINER_MODE", "true")
+	}
+	if *dirFlag != "" {
+		if dir, err := filepath.Abs(*dirFlag); err == nil {
+			*dirFlag = dir
+		}
+		os.Setenv("RECORDINGS_DIR", *dirFlag)
+	}
+}
+
+// forwardedFlags returns the --config, --port, --dir and --portable flags this process was
+// started with, for processes it registers to start later (the background
+// service and the login item).
+func forwardedFlags() ([]string, error) {
+	var args []string
+	if *configFlag != "" {
+		path, err := filepath.Abs(*configFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config path: %w", err)
+		}
+		args = append(args, "--config", path)
+	}
+	if *portFlag != "" {
+		args = append(args, "--port", *portFlag)
+	}
+	if *dirFlag != "" {
+		args = append(args, "--dir", *dirFlag)
+	}
+	if *portableFlag {
+		args = append(args, "--portable")
+	}
+	return args, nil
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [command flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun \"%s <command> -h\" for command flags.\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprint(out, `
+Settings are taken from, highest precedence first:
+  1. the flags above
+  2. RECORDER_<SECTION>_<KEY> variables for any config file key (e.g.
+     RECORDER_LIMITS_IP_RPS), or the short RECORDER_PORT, RECORDER_BIND,
+     RECORDER_DOWNLOAD_DIR, RECORDER_LOG_DIR, RECORDER_CONFIG_DIR,
+     RECORDER_LOG_LEVEL, RECORDER_MAX_CHUNK_MB, RECORDER_CONTAINER and
+     RECORDER_CONFIG_FILE
+  3. the older variable names (SERVER_PORT, RECORDINGS_DIR, ...)
+  4. settings changed from the UI (config/settings.json)
+  5. the config file (see recorder.example.toml)
+  6. built-in defaults
+`)
+}
+
+// runConvert implements the "convert" command, which runs the same FFmpeg
+// post-processing the server applies after a recording ends, for files that
+// were recorded while FFmpeg was unavailable.
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	ffmpeg := fs.String("ffmpeg", getFFmpegPath(), "path to the ffmpeg binary (or FFMPEG_PATH)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s convert [-ffmpeg path] file...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	postProcessor, err := services.NewPostProcessor(*ffmpeg)
+	if err != nil {
+		services.LogError("FFmpeg not available: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		if err := postProcessor.Fix(path); err != nil {
+			services.LogError("Failed to convert %s: %v", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Converted %s\n", path)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runList implements the "list" command, which prints the recordings in the
+// recordings directory, newest first.
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the list as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	recordings, err := services.ListRecordings(downloadDir)
+	if err != nil {
+		services.LogError("Failed to list recordings: %v", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(recordings); err != nil {
+			return 1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RECORDED\tSIZE\tNAME")
+	for _, rec := range recordings {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", rec.Recorded.Format("2006-01-02 15:04:05"), rec.SizeBytes, rec.Name)
+	}
+	w.Flush()
+	return 0
+}
+
+// runHealthcheck implements the "healthcheck" command, for a container's
+// HEALTHCHECK: it asks the server started with the same settings for
+// /api/healthz and exits 0 when it is ok or degraded, 1 otherwise. The
+// server's certificate is not verified, as it is usually self-signed.
+func runHealthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "how long to wait for the server")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	transport, baseURL := localServer()
+	client := &http.Client{Transport: transport, Timeout: *timeout}
+	resp, err := client.Get(baseURL + "/api/healthz")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var health models.HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		fmt.Fprintf(os.Stderr, "unhealthy: %s\n", resp.Status)
+		return 1
+	}
+	fmt.Println(health.Status)
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
+
+// localServer returns the base URL of the server started with the same
+// settings, e.g. "http://127.0.0.1:8080", and a transport that reaches it,
+// over its Unix socket when it has one. The server's certificate is not
+// verified, as it is usually self-signed.
+func localServer() (*http.Transport, string) {
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	scheme := "http"
+	if services.TLSEnabled() {
+		scheme = "https"
+	}
+	if socket := getSocketPath(*socketFlag); socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+		return transport, scheme + "://localhost"
+	}
+	port := getServerPort()
+	if last := services.LoadLastPort(configDir); last > 0 {
+		port = strconv.Itoa(last)
+	}
+	return transport, scheme + "://" + net.JoinHostPort(localHost(getBindAddress(*bindFlag)), port)
+}
+
+// runService implements the "service" command, which registers the recorder
+// with the OS service manager so it runs headless from boot (or login, for a
+// non-root launchd agent). The service gets the --config, --port and --dir
+// flags given to this command and runs in the current directory.
+func runService(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] service install|uninstall|start|stop|status\n", os.Args[0])
+	}
+	if len(args) != 1 {
+		usage()
+		return 2
+	}
+
+	forwarded, err := forwardedFlags()
+	if err != nil {
+		services.LogError("%v", err)
+		return 1
+	}
+	svc, err := services.NewSystemService(append([]string{"serve", "--headless"}, forwarded...))
+	if err != nil {
+		services.LogError("%v", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "install":
+		err = svc.Install()
+		if err == nil {
+			err = svc.Start()
+		}
+	case "uninstall":
+		err = svc.Uninstall()
+	case "start":
+		err = svc.Start()
+	case "stop":
+		err = svc.Stop()
+	case "status":
+		var status string
+		status, err = svc.Status()
+		if err == nil {
+			fmt.Println(status)
+		}
+	default:
+		usage()
+		return 2
+	}
+	if err != nil {
+		services.LogError("Service %s failed: %v", args[0], err)
+		return 1
+	}
+	return 0
+}
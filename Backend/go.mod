@@ -5,6 +5,7 @@ go 1.25.3
 require (
 	github.com/sqweek/dialog v0.0.0-20240226140203-065105509627
 	github.com/webview/webview_go v0.0.0-20240831120633-6173450d4dd6
+	golang.org/x/crypto v0.45.0
 )
 
 require github.com/TheTitanrain/w32 v0.0.0-20180517000239-4f5cfb03fabf // indirect
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+)
+
+type AlertsHandler struct {
+	alerts *services.AlertService
+}
+
+// NewAlertsHandler creates a new AlertsHandler with the specified AlertService.
+func NewAlertsHandler(alerts *services.AlertService) *AlertsHandler {
+	return &AlertsHandler{alerts: alerts}
+}
+
+// Handle responds to GET requests with the configured alert rules and the alerts
+// currently firing. POST replaces the rules with the JSON body and re-evaluates them.
+func (h *AlertsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var rules services.AlertRules
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			services.LogErrorCtx(r.Context(), "[ALERTS] Failed to decode rules: %v", err)
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if rules.MinFreeDiskGB < 0 || rules.MaxWriteFailures < 0 || rules.MaxSessionHours < 0 {
+			http.Error(w, "Thresholds must not be negative", http.StatusBadRequest)
+			return
+		}
+		h.alerts.SetRules(rules)
+		services.LogInfoCtx(r.Context(), "[ALERTS] Rules updated: %+v", rules)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules":  h.alerts.GetRules(),
+		"active": h.alerts.GetActiveAlerts(),
+	})
+}
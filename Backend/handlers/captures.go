@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"recorder/services"
+	"strconv"
+	"time"
+)
+
+type CapturesHandler struct {
+	captures *services.CaptureAgent
+}
+
+// NewCapturesHandler creates a new CapturesHandler for the captures of
+// captures.
+func NewCapturesHandler(captures *services.CaptureAgent) *CapturesHandler {
+	return &CapturesHandler{captures: captures}
+}
+
+// Handle lists the captures running on GET. POST starts one from {"url",
+// "name", "durationSeconds"}: the server opens url in a headless browser and
+// records it until it is stopped, or for durationSeconds when given. It
+// responds with 202 and the capture, whose tabId is its recording session.
+func (h *CapturesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.captures.Captures())
+	case http.MethodPost:
+		var req struct {
+			URL             string `json:"url"`
+			Name            string `json:"name"`
+			DurationSeconds int    `json:"durationSeconds"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil || req.DurationSeconds < 0 {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if !services.IsPageURL(req.URL) {
+			http.Error(w, "url must be an http or https address", http.StatusBadRequest)
+			return
+		}
+		capture, err := h.captures.Start(r.Context(), req.Name, req.URL, time.Duration(req.DurationSeconds)*time.Second)
+		if errors.Is(err, services.ErrCaptureUnavailable) {
+			http.Error(w, "Capturing pages needs capture.browser and FFmpeg", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to start capture", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(capture)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleStop processes POST requests to /api/captures/{session}/stop, which
+// stop the capture recorded as session once its file is finished.
+func (h *CapturesHandler) HandleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	if err := h.captures.Stop(tabID); errors.Is(err, services.ErrCaptureNotFound) {
+		http.Error(w, fmt.Sprintf("Capture %d is not running", tabID), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"recorder/services"
+)
+
+type CastHandler struct {
+	caster     *services.Caster
+	recorder   *services.RecorderService
+	fileWriter *services.FileWriterService
+	profiles   *services.ProfileStore
+}
+
+func NewCastHandler(caster *services.Caster, recorder *services.RecorderService, fileWriter *services.FileWriterService, profiles *services.ProfileStore) *CastHandler {
+	return &CastHandler{caster: caster, recorder: recorder, fileWriter: fileWriter, profiles: profiles}
+}
+
+// Handle lists the latest casts on GET. POST casts {"device", "file"}, a
+// finished recording, or {"device", "tabId"}, the live stream of a recording
+// in progress, to a device from /api/cast/devices, and answers with the cast.
+func (h *CastHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.caster.Jobs())
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Device string `json:"device"`
+		File   string `json:"file"`
+		TabID  int    `json:"tabId"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil || req.Device == "" || (req.File == "") == (req.TabID == 0) {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	var job services.CastJob
+	var err error
+	if req.File != "" {
+		path, locateErr := services.LocateRecording(req.File, h.fileWriter, h.profiles)
+		switch {
+		case errors.Is(locateErr, services.ErrRecordingNotFound):
+			http.Error(w, locateErr.Error(), http.StatusNotFound)
+			return
+		case locateErr != nil:
+			http.Error(w, locateErr.Error(), http.StatusBadRequest)
+			return
+		}
+		job, err = h.caster.CastRecording(req.Device, req.File, path)
+	} else {
+		info := h.recorder.GetSessionInfo(req.TabID)
+		if info == nil || !h.recorder.IsLive(req.TabID) {
+			http.Error(w, fmt.Sprintf("No live stream of tab %d is available", req.TabID), http.StatusNotFound)
+			return
+		}
+		job, err = h.caster.CastLive(req.Device, req.TabID, info.Name)
+	}
+	switch {
+	case errors.Is(err, services.ErrCastDeviceNotFound):
+		http.Error(w, "Cast device not found", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrCastUnreachable):
+		http.Error(w, "Devices on the network cannot reach the server; bind it to a network address to cast", http.StatusConflict)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[CAST] Failed to cast: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleDevices lists the Chromecasts and DLNA renderers on the LAN. The LAN
+// is searched again when ?refresh=1 is given or the last search is old.
+func (h *CastHandler) HandleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	devices, err := h.caster.Devices(r.URL.Query().Get("refresh") == "1")
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[CAST] Device search failed: %v", err)
+		http.Error(w, "Failed to search for devices", http.StatusInternalServerError)
+		return
+	}
+	if devices == nil {
+		devices = []services.CastDevice{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(devices)
+}
+
+// HandleMedia serves a recording converted for casting, to the devices
+// given a signed link to it.
+func (h *CastHandler) HandleMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path, ok := h.caster.ConvertedFile(r.PathValue("file"))
+	if !ok {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", services.RecordingContentType(path))
+	http.ServeFile(w, r, path)
+}
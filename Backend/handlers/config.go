@@ -2,74 +2,489 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	"recorder/services"
 )
 
 type ConfigHandler struct {
 	fileWriter *services.FileWriterService
+	autoStart  *services.AutoStart
+	watcher    *services.ConfigWatcher
+	settings   *services.SettingsStore
+	profiles   *services.ProfileStore
+	limits     ConfigLimits
+	server     ServerInfo
+}
+
+// ConfigLimits are the runtime limits reported and changed through /api/config.
+// Notifier is nil when desktop notifications are not available.
+type ConfigLimits struct {
+	IP       *services.RateLimiter
+	Session  *services.RateLimiter
+	Guard    *services.AuthGuard
+	Alerts   *services.AlertService
+	Notifier *services.DesktopNotifier
+	Recorder *services.RecorderService
+}
+
+// ServerInfo describes where the server is listening. Either Port or Socket is set.
+type ServerInfo struct {
+	Port   int    `json:"port,omitempty"`
+	Bind   string `json:"bind,omitempty"`
+	Socket string `json:"socket,omitempty"`
+	TLS    bool   `json:"tls"`
+}
+
+// configDocument is the effective configuration returned by GET /api/config.
+type configDocument struct {
+	Server             ServerInfo          `json:"server"`
+	DownloadDir        string              `json:"downloadDir"`
+	Profile            string              `json:"profile"`
+	AutoStart          bool                `json:"autoStart"`
+	AutoStartAvailable bool                `json:"autoStartAvailable"`
+	Theme              string              `json:"theme,omitempty"`
+	LogLevel           string              `json:"logLevel"`
+	Time               services.Clock      `json:"time"`
+	ConfigFile         string              `json:"configFile,omitempty"`
+	Limits             limitSettings       `json:"limits"`
+	Alerts             services.AlertRules `json:"alerts"`
+	// Notifications are the events that show a desktop notification.
+	Notifications          services.NotificationEvents `json:"notifications"`
+	NotificationsAvailable bool                        `json:"notificationsAvailable"`
+}
+
+type limitSettings struct {
+	IPRPS           float64 `json:"ipRps"`
+	IPBurst         float64 `json:"ipBurst"`
+	SessionRPS      float64 `json:"sessionRps"`
+	SessionBurst    float64 `json:"sessionBurst"`
+	LockoutAttempts int     `json:"lockoutAttempts"`
+	// SessionIdleMinutes is how long a recording may go without data before
+	// it is finished as timed out; 0 waits forever.
+	SessionIdleMinutes float64 `json:"sessionIdleMinutes"`
+	// MaxSessions is how many recordings may run at a time; 0 means no limit.
+	MaxSessions int `json:"maxSessions"`
+	// PostProcessingJobs is how many recordings may be post-processed at a
+	// time; 0 means one per CPU.
+	PostProcessingJobs int `json:"postProcessingJobs"`
+}
+
+// configPatch holds the settings PATCH /api/config may change; absent fields
+// are left alone. The server section cannot change without a restart.
+type configPatch struct {
+	DownloadDir *string `json:"downloadDir"`
+	AutoStart   *bool   `json:"autoStart"`
+	Theme       *string `json:"theme"`
+	LogLevel    *string `json:"logLevel"`
+	Limits      *struct {
+		IPRPS              *float64 `json:"ipRps"`
+		IPBurst            *float64 `json:"ipBurst"`
+		SessionRPS         *float64 `json:"sessionRps"`
+		SessionBurst       *float64 `json:"sessionBurst"`
+		LockoutAttempts    *int     `json:"lockoutAttempts"`
+		SessionIdleMinutes *float64 `json:"sessionIdleMinutes"`
+		MaxSessions        *int     `json:"maxSessions"`
+		PostProcessingJobs *int     `json:"postProcessingJobs"`
+	} `json:"limits"`
+	Alerts *struct {
+		MinFreeDiskGB    *float64 `json:"minFreeDiskGB"`
+		MaxWriteFailures *int64   `json:"maxWriteFailures"`
+		MaxSessionHours  *float64 `json:"maxSessionHours"`
+	} `json:"alerts"`
+	Notifications *struct {
+		RecordingStarted *bool `json:"recordingStarted"`
+		RecordingStopped *bool `json:"recordingStopped"`
+		PostProcessing   *bool `json:"postProcessing"`
+		LowDisk          *bool `json:"lowDisk"`
+		WriteFailures    *bool `json:"writeFailures"`
+	} `json:"notifications"`
 }
 
 // NewConfigHandler creates a new ConfigHandler with the specified FileWriterService.
-func NewConfigHandler(fileWriter *services.FileWriterService) *ConfigHandler {
-	return &ConfigHandler{fileWriter: fileWriter}
+// autoStart may be nil when start at login cannot be configured. Changes are
+// saved to settings so they survive a restart; the download directory belongs
+// to the active profile.
+func NewConfigHandler(fileWriter *services.FileWriterService, autoStart *services.AutoStart, watcher *services.ConfigWatcher, settings *services.SettingsStore, profiles *services.ProfileStore, limits ConfigLimits) *ConfigHandler {
+	return &ConfigHandler{fileWriter: fileWriter, autoStart: autoStart, watcher: watcher, settings: settings, profiles: profiles, limits: limits}
+}
+
+// SetServer records where the server is listening. It must be called before
+// the server starts handling requests.
+func (h *ConfigHandler) SetServer(server ServerInfo) {
+	h.server = server
 }
 
-// Handle processes POST requests to configure the download directory path.
-// Validates the path for security (no directory traversal) and existence before applying.
-// Responds with 200 OK on success or appropriate error status on failure.
+// Handle serves the configuration. GET returns the effective configuration,
+// PATCH changes individual settings and returns the result, and POST
+// configures the download directory path ("path") and whether the app starts
+// at login ("autoStart").
+// Paths are validated for security (no directory traversal) and existence before applying.
 func (h *ConfigHandler) Handle(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "POST" {
-		var config struct {
-			Path string `json:"path"`
+	switch r.Method {
+	case http.MethodGet:
+		h.writeConfig(w)
+	case http.MethodPatch:
+		h.handlePatch(w, r)
+	case http.MethodPost:
+		h.handlePost(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ConfigHandler) handlePost(w http.ResponseWriter, r *http.Request) {
+	var config struct {
+		Path      string `json:"path"`
+		AutoStart *bool  `json:"autoStart"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		log.Printf("ERROR: Failed to decode config request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if config.Path != "" {
+		absPath, err := validateDirectory(config.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-			log.Printf("ERROR: Failed to decode config request: %v", err)
-			http.Error(w, "Invalid request format", http.StatusBadRequest)
+		isDefault, err := h.profiles.SetRecordingsDir(absPath)
+		if err == nil && isDefault {
+			err = h.settings.Save(map[string]string{"paths.recordings": absPath})
+		}
+		if err != nil {
+			services.LogErrorCtx(r.Context(), "[CONFIG] Failed to save settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
 			return
 		}
+		log.Printf("Download directory updated to: %s", absPath)
+	}
 
-		if config.Path != "" {
-			cleanPath := filepath.Clean(config.Path)
-			absPath, err := filepath.Abs(cleanPath)
-			if err != nil {
-				log.Printf("ERROR: Invalid path: %v", err)
-				http.Error(w, "Invalid path", http.StatusBadRequest)
-				return
-			}
-
-			if strings.Contains(filepath.ToSlash(absPath), "..") {
-				log.Printf("ERROR: Path traversal attempt detected: %s", config.Path)
-				http.Error(w, "Path traversal not allowed", http.StatusBadRequest)
-				return
-			}
-
-			info, err := os.Stat(absPath)
-			if err != nil {
-				log.Printf("ERROR: Directory does not exist: %v", err)
-				http.Error(w, "Directory does not exist", http.StatusBadRequest)
-				return
-			}
-
-			if !info.IsDir() {
-				log.Printf("ERROR: Path is not a directory: %s", absPath)
-				http.Error(w, "Path must be a directory", http.StatusBadRequest)
-				return
-			}
-
-			h.fileWriter.SetDownloadDir(absPath)
-			log.Printf("Download directory updated to: %s", absPath)
-		}
-
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	if config.AutoStart != nil {
+		if err := h.autoStart.Set(*config.AutoStart); err != nil {
+			services.LogErrorCtx(r.Context(), "[AUTOSTART] Failed to update start at login: %v", err)
+			http.Error(w, "Failed to update start at login", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "updated",
+		"autoStart": h.autoStart.Enabled(),
+	})
+}
+
+// handlePatch validates every setting in the request before applying any of
+// them, so a bad value leaves the configuration unchanged.
+func (h *ConfigHandler) handlePatch(w http.ResponseWriter, r *http.Request) {
+	var patch configPatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		services.LogErrorCtx(r.Context(), "[CONFIG] Failed to decode config patch: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-}
\ No newline at end of file
+	var downloadDir string
+	if patch.DownloadDir != nil {
+		dir, err := validateDirectory(*patch.DownloadDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		downloadDir = dir
+	}
+
+	if patch.Theme != nil {
+		switch *patch.Theme {
+		case "", "light", "dark":
+		default:
+			http.Error(w, "theme must be light, dark or empty", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var logLevel services.LogLevel
+	if patch.LogLevel != nil {
+		switch *patch.LogLevel {
+		case "debug", "info", "error":
+			logLevel = services.ParseLogLevel(*patch.LogLevel)
+		default:
+			http.Error(w, "logLevel must be debug, info or error", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ipRate, ipBurst := h.limits.IP.Limits()
+	sessionRate, sessionBurst := h.limits.Session.Limits()
+	attempts := h.limits.Guard.Attempts()
+	idleMinutes := h.limits.Recorder.IdleTimeout().Minutes()
+	maxSessions := h.limits.Recorder.MaxSessions()
+	postProcessingJobs := h.fileWriter.PostProcessingJobs()
+	rules := h.limits.Alerts.GetRules()
+	if l := patch.Limits; l != nil {
+		setIfPresent(&ipRate, l.IPRPS)
+		setIfPresent(&ipBurst, l.IPBurst)
+		setIfPresent(&sessionRate, l.SessionRPS)
+		setIfPresent(&sessionBurst, l.SessionBurst)
+		setIfPresent(&attempts, l.LockoutAttempts)
+		setIfPresent(&idleMinutes, l.SessionIdleMinutes)
+		setIfPresent(&maxSessions, l.MaxSessions)
+		setIfPresent(&postProcessingJobs, l.PostProcessingJobs)
+	}
+	if a := patch.Alerts; a != nil {
+		setIfPresent(&rules.MinFreeDiskGB, a.MinFreeDiskGB)
+		setIfPresent(&rules.MaxWriteFailures, a.MaxWriteFailures)
+		setIfPresent(&rules.MaxSessionHours, a.MaxSessionHours)
+	}
+	if ipRate < 0 || ipBurst < 0 || sessionRate < 0 || sessionBurst < 0 || attempts < 0 || idleMinutes < 0 || maxSessions < 0 || postProcessingJobs < 0 ||
+		rules.MinFreeDiskGB < 0 || rules.MaxWriteFailures < 0 || rules.MaxSessionHours < 0 {
+		http.Error(w, "Limits must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if patch.AutoStart != nil {
+		if err := h.autoStart.Set(*patch.AutoStart); err != nil {
+			services.LogErrorCtx(r.Context(), "[AUTOSTART] Failed to update start at login: %v", err)
+			http.Error(w, "Failed to update start at login", http.StatusInternalServerError)
+			return
+		}
+	}
+	saved := make(map[string]string)
+	if downloadDir != "" {
+		isDefault, err := h.profiles.SetRecordingsDir(downloadDir)
+		if err != nil {
+			services.LogErrorCtx(r.Context(), "[CONFIG] Failed to save profile: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+		if isDefault {
+			saved["paths.recordings"] = downloadDir
+		}
+	}
+	if patch.LogLevel != nil {
+		services.SetLogLevel(logLevel)
+		saved["logging.level"] = logLevel.String()
+	}
+	if patch.Limits != nil {
+		h.limits.IP.SetLimits(ipRate, ipBurst)
+		h.limits.Session.SetLimits(sessionRate, sessionBurst)
+		h.limits.Guard.SetAttempts(attempts)
+		h.limits.Recorder.SetIdleTimeout(time.Duration(idleMinutes * float64(time.Minute)))
+		h.limits.Recorder.SetMaxSessions(maxSessions)
+		h.fileWriter.SetPostProcessingJobs(postProcessingJobs)
+		saveFloat(saved, "limits.ip_rps", patch.Limits.IPRPS)
+		saveFloat(saved, "limits.ip_burst", patch.Limits.IPBurst)
+		saveFloat(saved, "limits.session_rps", patch.Limits.SessionRPS)
+		saveFloat(saved, "limits.session_burst", patch.Limits.SessionBurst)
+		saveFloat(saved, "limits.session_idle_minutes", patch.Limits.SessionIdleMinutes)
+		if patch.Limits.LockoutAttempts != nil {
+			saved["limits.lockout_attempts"] = strconv.Itoa(attempts)
+		}
+		if patch.Limits.MaxSessions != nil {
+			saved["limits.max_sessions"] = strconv.Itoa(maxSessions)
+		}
+		if patch.Limits.PostProcessingJobs != nil {
+			saved["limits.post_processing_jobs"] = strconv.Itoa(postProcessingJobs)
+		}
+	}
+	if n := patch.Notifications; n != nil {
+		events := h.limits.Notifier.Events()
+		if h.limits.Notifier == nil {
+			events = services.LoadNotificationEventsFromEnv()
+		}
+		saveBool(saved, "notifications.recording_started", &events.RecordingStarted, n.RecordingStarted)
+		saveBool(saved, "notifications.recording_stopped", &events.RecordingStopped, n.RecordingStopped)
+		saveBool(saved, "notifications.post_processing", &events.PostProcessing, n.PostProcessing)
+		saveBool(saved, "notifications.low_disk", &events.LowDisk, n.LowDisk)
+		saveBool(saved, "notifications.write_failures", &events.WriteFailures, n.WriteFailures)
+		h.limits.Notifier.SetEvents(events)
+	}
+	if patch.Alerts != nil {
+		h.limits.Alerts.SetRules(rules)
+		saveFloat(saved, "limits.min_free_disk_gb", patch.Alerts.MinFreeDiskGB)
+		saveFloat(saved, "limits.max_session_hours", patch.Alerts.MaxSessionHours)
+		if patch.Alerts.MaxWriteFailures != nil {
+			saved["limits.max_write_failures"] = strconv.FormatInt(rules.MaxWriteFailures, 10)
+		}
+	}
+
+	if err := h.settings.Save(saved); err != nil {
+		services.LogErrorCtx(r.Context(), "[CONFIG] Failed to save settings: %v", err)
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+		return
+	}
+	if patch.Theme != nil {
+		if err := h.settings.SetTheme(*patch.Theme); err != nil {
+			services.LogErrorCtx(r.Context(), "[CONFIG] Failed to save settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	services.LogInfoCtx(r.Context(), "[CONFIG] Settings updated through the API")
+	h.writeConfig(w)
+}
+
+func saveFloat(saved map[string]string, key string, value *float64) {
+	if value != nil {
+		saved[key] = strconv.FormatFloat(*value, 'g', -1, 64)
+	}
+}
+
+// saveBool sets *dst to value, if present, and records it as key.
+func saveBool(saved map[string]string, key string, dst *bool, value *bool) {
+	if value != nil {
+		*dst = *value
+		saved[key] = strconv.FormatBool(*value)
+	}
+}
+
+func (h *ConfigHandler) writeConfig(w http.ResponseWriter) {
+	doc := configDocument{
+		Server:             h.server,
+		DownloadDir:        h.fileWriter.GetDownloadDir(),
+		Profile:            h.profiles.Active().Name,
+		AutoStart:          h.autoStart.Enabled(),
+		AutoStartAvailable: h.autoStart != nil,
+		Theme:              h.settings.Theme(),
+		LogLevel:           services.GetLogLevel().String(),
+		Time:               h.fileWriter.Clock(),
+		ConfigFile:         h.watcher.Path(),
+		Alerts:             h.limits.Alerts.GetRules(),
+
+		Notifications:          h.limits.Notifier.Events(),
+		NotificationsAvailable: h.limits.Notifier != nil,
+	}
+	doc.Limits.IPRPS, doc.Limits.IPBurst = h.limits.IP.Limits()
+	doc.Limits.SessionRPS, doc.Limits.SessionBurst = h.limits.Session.Limits()
+	doc.Limits.LockoutAttempts = h.limits.Guard.Attempts()
+	doc.Limits.SessionIdleMinutes = h.limits.Recorder.IdleTimeout().Minutes()
+	doc.Limits.MaxSessions = h.limits.Recorder.MaxSessions()
+	doc.Limits.PostProcessingJobs = h.fileWriter.PostProcessingJobs()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// validateDirectory resolves path to an absolute path and checks that it is an
+// existing directory. The error is suitable for the client.
+func validateDirectory(path string) (string, error) {
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		log.Printf("ERROR: Invalid path: %v", err)
+		return "", errors.New("Invalid path")
+	}
+
+	if strings.Contains(filepath.ToSlash(absPath), "..") {
+		log.Printf("ERROR: Path traversal attempt detected: %s", path)
+		return "", errors.New("Path traversal not allowed")
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		log.Printf("ERROR: Directory does not exist: %v", err)
+		return "", errors.New("Directory does not exist")
+	}
+
+	if !info.IsDir() {
+		log.Printf("ERROR: Path is not a directory: %s", absPath)
+		return "", errors.New("Path must be a directory")
+	}
+	return absPath, nil
+}
+
+func setIfPresent[T any](dst *T, value *T) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+// HandleReload processes POST requests to re-read the config file and apply
+// the settings that can change without a restart. It responds with the keys
+// that changed, or 404 when no config file is in use.
+func (h *ConfigHandler) HandleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.watcher.Path() == "" {
+		http.Error(w, "No config file in use", http.StatusNotFound)
+		return
+	}
+
+	changed, err := h.watcher.Reload()
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[CONFIG] Failed to reload config: %v", err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    h.watcher.Path(),
+		"changed": changed,
+	})
+}
+
+// HandleValidate processes POST requests with proposed settings, keyed like
+// the config file ("server.port", "paths.recordings", ...), and reports the
+// problems found without applying anything.
+func (h *ConfigHandler) HandleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var proposed map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&proposed); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	values := make(map[string]string, len(proposed))
+	for key, value := range proposed {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+			values[key] = ""
+		default:
+			http.Error(w, fmt.Sprintf("Invalid request: %s must be a string, number or boolean", key), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Validate(values))
+}
+
+// Validate checks proposed settings against the running server, as
+// HandleValidate does.
+func (h *ConfigHandler) Validate(values map[string]string) services.ConfigValidation {
+	return services.ValidateConfig(values, services.RunningConfig{
+		Bind:          h.server.Bind,
+		Port:          h.server.Port,
+		RecordingsDir: h.fileWriter.GetDownloadDir(),
+		MinFreeDiskGB: h.limits.Alerts.GetRules().MinFreeDiskGB,
+	})
+}
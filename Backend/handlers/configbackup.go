@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"recorder/services"
+	"time"
+)
+
+// minBackupPassphrase is the shortest passphrase credentials are sealed with.
+const minBackupPassphrase = 8
+
+type ConfigBackupHandler struct {
+	transfer *services.ConfigTransfer
+	validate func(values map[string]string) services.ConfigValidation
+	audit    *services.AuditLog
+}
+
+// NewConfigBackupHandler creates a new ConfigBackupHandler. validate checks
+// imported settings against this machine before anything is changed.
+func NewConfigBackupHandler(transfer *services.ConfigTransfer, validate func(values map[string]string) services.ConfigValidation, audit *services.AuditLog) *ConfigBackupHandler {
+	return &ConfigBackupHandler{transfer: transfer, validate: validate, audit: audit}
+}
+
+// HandleExport returns the configuration as a JSON download. GET leaves the
+// credentials out; POST {"passphrase": "..."} includes the API tokens and the
+// UI password, encrypted with the passphrase.
+func (h *ConfigBackupHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	var passphrase string
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Passphrase string `json:"passphrase"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Passphrase) < minBackupPassphrase {
+			http.Error(w, fmt.Sprintf("The passphrase must be at least %d characters", minBackupPassphrase), http.StatusBadRequest)
+			return
+		}
+		passphrase = req.Passphrase
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	backup, err := h.transfer.Export(passphrase)
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[CONFIG] Failed to export config: %v", err)
+		http.Error(w, "Failed to export config; see the server log", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r.Context(), "config_export", clientIP(r), fmt.Sprintf("credentials=%t", backup.Secrets != nil))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="recorder-config-%s.json"`, time.Now().Format("20060102")))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(backup)
+}
+
+// HandleImport processes POST requests of the form
+// {"backup": {...}, "passphrase": "..."} with a backup from HandleExport.
+// Settings that fail validation are answered with 422 and the problems found,
+// and nothing is imported. The passphrase is only needed for the credentials.
+func (h *ConfigBackupHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Backup     services.ConfigBackup `json:"backup"`
+		Passphrase string                `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.transfer.Import(req.Backup, req.Passphrase, h.validate)
+	var invalid *services.ConfigInvalidError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(invalid.Validation)
+		return
+	case errors.Is(err, services.ErrWrongPassphrase):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[CONFIG] Failed to import config: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.audit.Record(r.Context(), "config_import", clientIP(r), fmt.Sprintf("tokens=%d apiToken=%t uiPassword=%t", report.Tokens, report.APIToken, report.UIPassword))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+)
+
+// CrashesHandler lists crash reports written by previous runs, serves their contents
+// and lets the UI mark them as reviewed.
+//
+// GET  /api/crashes            -> list of reports
+// GET  /api/crashes?name=NAME  -> plain-text report
+// POST /api/crashes {"name"}   -> mark report reviewed
+func CrashesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if name := r.URL.Query().Get("name"); name != "" {
+			path, err := services.CrashReportPath(name)
+			if err != nil {
+				http.Error(w, "Crash report not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=\""+name+"\"")
+			http.ServeFile(w, r, path)
+			return
+		}
+
+		reports, err := services.ListCrashReports()
+		if err != nil {
+			services.LogErrorCtx(r.Context(), "[CRASH] Failed to list crash reports: %v", err)
+			http.Error(w, "Failed to list crash reports", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"reports": reports})
+
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if err := services.MarkCrashReportReviewed(req.Name); err != nil {
+			services.LogErrorCtx(r.Context(), "[CRASH] Failed to mark %s reviewed: %v", req.Name, err)
+			http.Error(w, "Crash report not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "reviewed"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
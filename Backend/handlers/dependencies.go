@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+	"strings"
+)
+
+type DependenciesHandler struct {
+	dependencies *services.DependencyRegistry
+	install      func(name string) services.Job
+	upgrade      func() services.Job
+	configure    func(path string) error
+	redetect     func() []services.Dependency
+	desktop      bool
+}
+
+// NewDependenciesHandler creates a new DependenciesHandler that reports the
+// programs detected in dependencies, installs FFmpeg and ffprobe with install
+// and upgrades the static build of FFmpeg with upgrade, which start a job.
+// configure changes the path of ffmpeg and redetect looks for both again.
+// desktop is whether the server shows its window, which needs the webview
+// runtime.
+func NewDependenciesHandler(dependencies *services.DependencyRegistry, install func(name string) services.Job, upgrade func() services.Job, configure func(path string) error, redetect func() []services.Dependency, desktop bool) *DependenciesHandler {
+	return &DependenciesHandler{dependencies: dependencies, install: install, upgrade: upgrade, configure: configure, redetect: redetect, desktop: desktop}
+}
+
+// Handle processes GET requests to /api/dependencies, which return a report
+// to attach to support requests: the platform and version of the server, the
+// presence, path and version of ffmpeg and ffprobe, the hardware encoders
+// FFmpeg can use and the webview runtime the desktop window needs.
+func (h *DependenciesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.dependencies.Report(h.desktop))
+}
+
+// HandleDependency serves /api/dependencies/{name}. GET returns the path and
+// version ffmpeg or ffprobe was last detected with, and whether it is
+// outdated or the static build the server installed. PATCH on ffmpeg with
+// {"path": "..."} makes the server use the ffmpeg binary at path, or the one
+// on the PATH when it is empty, without a restart, and keeps it in the
+// settings; it responds with the ffmpeg detected there, or 400 when there is
+// none.
+func (h *DependenciesHandler) HandleDependency(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != services.DependencyFFmpeg && name != services.DependencyFFprobe {
+		http.Error(w, "Dependency not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		if name != services.DependencyFFmpeg {
+			http.Error(w, "Only the path of ffmpeg can be changed", http.StatusBadRequest)
+			return
+		}
+		var request struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if err := h.configure(strings.TrimSpace(request.Path)); err != nil {
+			services.LogErrorCtx(r.Context(), "[DEPENDENCIES] Failed to change the FFmpeg path: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		services.LogInfoCtx(r.Context(), "[DEPENDENCIES] FFmpeg path changed to %s", h.dependencies.FFmpegPath())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.dependencies.Get(name))
+}
+
+// HandleRedetect processes POST requests to /api/dependencies/redetect, which
+// look for ffmpeg and ffprobe again after they were installed while the
+// server runs: the folders of the PATH a new login would get, e.g. after an
+// installer changed it, and common install locations are added to the PATH
+// of the server first. It responds with the dependencies detected.
+func (h *DependenciesHandler) HandleRedetect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dependencies := h.redetect()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dependencies)
+}
+
+// HandleInstall processes POST requests to /api/dependencies/{name}/install,
+// which install ffmpeg or ffprobe in the background. It responds with 202 and
+// the install job, to follow at /api/jobs/{id}/events; an install already
+// running is returned instead of starting another.
+func (h *DependenciesHandler) HandleInstall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	if name != services.DependencyFFmpeg && name != services.DependencyFFprobe {
+		http.Error(w, "Only ffmpeg and ffprobe can be installed", http.StatusNotFound)
+		return
+	}
+	job := h.install(name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleUpgrade processes POST requests to /api/dependencies/ffmpeg/upgrade,
+// which replace the static build of FFmpeg and ffprobe the server installed
+// with the latest one, in the background, and respond like HandleInstall. An
+// FFmpeg from a package manager is upgraded with that instead, so it is a 409
+// Conflict.
+func (h *DependenciesHandler) HandleUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.PathValue("name") != services.DependencyFFmpeg {
+		http.Error(w, "Only ffmpeg can be upgraded", http.StatusNotFound)
+		return
+	}
+	if !h.dependencies.Get(services.DependencyFFmpeg).Managed {
+		http.Error(w, "FFmpeg was not installed by the server - upgrade it with the package manager of the system", http.StatusConflict)
+		return
+	}
+	job := h.upgrade()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+)
+
+type DiscoveryHandler struct {
+	info services.DiscoveryInfo
+}
+
+// NewDiscoveryHandler creates a handler that reports info to clients probing
+// for the server, such as the extension after a port change.
+func NewDiscoveryHandler(info services.DiscoveryInfo) *DiscoveryHandler {
+	return &DiscoveryHandler{info: info}
+}
+
+// Handle returns the discovery info on GET. It needs no credentials, as the
+// info contains none.
+func (h *DiscoveryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.info)
+}
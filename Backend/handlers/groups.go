@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"recorder/services"
+)
+
+type GroupsHandler struct {
+	recorder *services.RecorderService
+}
+
+// NewGroupsHandler creates a new GroupsHandler for the recording groups of
+// recorder.
+func NewGroupsHandler(recorder *services.RecorderService) *GroupsHandler {
+	return &GroupsHandler{recorder: recorder}
+}
+
+// Handle lists the recording groups on GET, the most recently started first,
+// with how many recordings of each are in progress and finished, the bytes
+// they hold and how long the group has been recording.
+func (h *GroupsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.recorder.Groups())
+}
+
+// HandleGroup returns the recording group whose ID is group on GET
+// /api/groups/{group}, with its recordings in progress and finished.
+func (h *GroupsHandler) HandleGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("group")
+	group, ok := h.recorder.Group(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Group %s has no recordings", id), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// HandleStop processes POST requests to /api/groups/{group}/stop, which stop
+// every recording of the group from the server. It responds with
+// {"stopped": n}.
+func (h *GroupsHandler) HandleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stopped := h.recorder.StopGroup(r.Context(), r.PathValue("group"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"stopped": stopped})
+}
+
+// HandleCombine processes POST requests to /api/groups/{group}/combine with
+// {"mode": "mux"} or {"mode": "concat"}, which combine the recordings of the
+// group into one file with FFmpeg: right away when none is in progress, or
+// else when the last one finishes. It responds with 202 and the group, whose
+// combined or combineError tell how it went.
+func (h *GroupsHandler) HandleCombine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if !services.IsCombineMode(req.Mode) {
+		http.Error(w, "mode must be mux or concat", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("group")
+	group, err := h.recorder.CombineGroup(r.Context(), id, req.Mode)
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound):
+		http.Error(w, fmt.Sprintf("Group %s has no recordings", id), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrCombineUnavailable):
+		http.Error(w, "Combining recordings needs FFmpeg", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[GROUPS] Failed to combine group %s: %v", id, err)
+		http.Error(w, "Failed to combine group", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(group)
+}
@@ -2,20 +2,147 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"os/exec"
 	"recorder/models"
+	"recorder/services"
 	"time"
 )
 
-// HealthHandler responds with the server health status and current timestamp.
-// Always returns a 200 OK response with JSON containing status and time.
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+const (
+	healthMinFreeBytes   = 512 * 1024 * 1024
+	healthMaxPostProcess = 30 * time.Minute
+)
+
+type HealthHandler struct {
+	fileWriter   *services.FileWriterService
+	dependencies *services.DependencyRegistry
+}
+
+// NewHealthHandler creates a new HealthHandler with the specified FileWriterService,
+// which reports FFmpeg releases that dependencies found outdated.
+func NewHealthHandler(fileWriter *services.FileWriterService, dependencies *services.DependencyRegistry) *HealthHandler {
+	return &HealthHandler{fileWriter: fileWriter, dependencies: dependencies}
+}
+
+// Handle responds with the server health status, current timestamp and the result of
+// each individual check. Checks that only affect post-processing report "warn" and
+// mark the server "degraded"; checks that prevent recording report "fail" and mark
+// it "unhealthy" with a 503 Service Unavailable status.
+func (h *HealthHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, h.check())
+}
+
+// HandleProbe is the unauthenticated health check for container orchestrators
+// and load balancers, served at /api/healthz. Its contract:
+//
+//   - GET or HEAD only.
+//   - 200 OK with {"status":"ok"} or {"status":"degraded"} while recordings can
+//     be written (degraded means post-processing is unavailable or slow).
+//   - 503 Service Unavailable with {"status":"unhealthy"} when they cannot,
+//     e.g. the recordings directory is not writable or the disk is full.
+//   - The body also has "time" (RFC 3339) but never the individual checks,
+//     which name paths; GET /api/health returns those to authenticated clients.
+func (h *HealthHandler) HandleProbe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	response := h.check()
+	response.Checks = nil
+	writeHealth(w, response)
+}
+
+func (h *HealthHandler) check() models.HealthResponse {
+	checks := map[string]models.HealthCheck{
+		"recordingsDir":  h.checkRecordingsDir(),
+		"diskSpace":      h.checkDiskSpace(),
+		"ffmpeg":         h.checkFFmpeg(),
+		"postProcessing": h.checkPostProcessing(),
+	}
 
 	response := models.HealthResponse{
 		Status: "ok",
 		Time:   time.Now().Format(time.RFC3339),
+		Checks: checks,
+	}
+
+	for _, check := range checks {
+		switch check.Status {
+		case "fail":
+			response.Status = "unhealthy"
+		case "warn":
+			if response.Status == "ok" {
+				response.Status = "degraded"
+			}
+		}
 	}
+	return response
+}
 
+func writeHealth(w http.ResponseWriter, response models.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status == "unhealthy" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+func (h *HealthHandler) checkRecordingsDir() models.HealthCheck {
+	dir := h.fileWriter.GetDownloadDir()
+	probe, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return models.HealthCheck{Status: "fail", Message: fmt.Sprintf("%s is not writable: %v", dir, err)}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return models.HealthCheck{Status: "ok", Message: dir}
+}
+
+func (h *HealthHandler) checkDiskSpace() models.HealthCheck {
+	free, err := services.FreeDiskSpace(h.fileWriter.GetDownloadDir())
+	if err != nil {
+		return models.HealthCheck{Status: "fail", Message: err.Error()}
+	}
+	message := fmt.Sprintf("%.2f GB free", float64(free)/(1024*1024*1024))
+	if free < healthMinFreeBytes {
+		return models.HealthCheck{Status: "fail", Message: message}
+	}
+	return models.HealthCheck{Status: "ok", Message: message}
+}
+
+func (h *HealthHandler) checkFFmpeg() models.HealthCheck {
+	pp := h.fileWriter.GetPostProcessor()
+	if pp == nil {
+		return models.HealthCheck{Status: "warn", Message: "post-processing disabled: ffmpeg not available"}
+	}
+	path, err := exec.LookPath(pp.FFmpegPath())
+	if err != nil {
+		return models.HealthCheck{Status: "warn", Message: err.Error()}
+	}
+	if ffmpeg := h.dependencies.Get(services.DependencyFFmpeg); ffmpeg.Outdated {
+		return models.HealthCheck{
+			Status:  "warn",
+			Message: fmt.Sprintf("ffmpeg %s is older than %s, some filters may fail", ffmpeg.Version, services.MinFFmpegVersion),
+		}
+	}
+	return models.HealthCheck{Status: "ok", Message: path}
+}
+
+func (h *HealthHandler) checkPostProcessing() models.HealthCheck {
+	pp := h.fileWriter.GetPostProcessor()
+	if pp == nil {
+		return models.HealthCheck{Status: "ok", Message: "post-processing disabled"}
+	}
+	oldest, count := pp.OldestJobAge()
+	message := fmt.Sprintf("%d job(s) in progress", count)
+	if oldest > healthMaxPostProcess {
+		return models.HealthCheck{
+			Status:  "warn",
+			Message: fmt.Sprintf("%s, oldest running for %s", message, oldest.Round(time.Second)),
+		}
+	}
+	return models.HealthCheck{Status: "ok", Message: message}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+)
+
+type HomeAssistantHandler struct {
+	recorder *services.RecorderService
+}
+
+// NewHomeAssistantHandler creates a new HomeAssistantHandler, which serves the
+// state of recorder to Home Assistant and lets it stop the recordings.
+func NewHomeAssistantHandler(recorder *services.RecorderService) *HomeAssistantHandler {
+	return &HomeAssistantHandler{recorder: recorder}
+}
+
+// Handle returns the state of the recorder on GET /api/homeassistant: whether
+// it is recording, the recordings in progress, the free disk space and the
+// last finished recording (see services.HomeAssistantState).
+func (h *HomeAssistantHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.recorder.HomeAssistantState())
+}
+
+// HandleStopAll processes POST requests to /api/homeassistant/stop, the
+// service Home Assistant calls to stop every recording from the server. It
+// responds with {"stopped": n}.
+func (h *HomeAssistantHandler) HandleStopAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stopped := h.recorder.StopAll(r.Context())
+	services.LogInfoCtx(r.Context(), "[RECORDINGS] Home Assistant stopped %d recording(s)", stopped)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"stopped": stopped})
+}
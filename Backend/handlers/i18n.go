@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"recorder/services"
+	"strings"
+)
+
+// requestLanguage returns the language to answer r in: the language chosen in
+// the preferences, or else the one its Accept-Language header prefers.
+func requestLanguage(r *http.Request, preferred func() string) string {
+	if language := preferred(); language != "" {
+		return language
+	}
+	return services.NegotiateLanguage(r.Header.Get("Accept-Language"))
+}
+
+// LocalizeMiddleware translates the plain-text error messages handlers send
+// with http.Error into the request's language. preferred returns the language
+// chosen in the preferences, or "" to follow Accept-Language.
+func LocalizeMiddleware(preferred func() string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		language := requestLanguage(r, preferred)
+		if language == services.DefaultLanguage {
+			next(w, r)
+			return
+		}
+		next(&localizedWriter{ResponseWriter: w, language: language}, r)
+	}
+}
+
+// localizedWriter translates the body of text/plain error responses, which
+// http.Error writes in one piece.
+type localizedWriter struct {
+	http.ResponseWriter
+	language    string
+	wroteHeader bool
+	translate   bool
+}
+
+func (lw *localizedWriter) WriteHeader(code int) {
+	if !lw.wroteHeader {
+		lw.wroteHeader = true
+		lw.translate = code >= http.StatusBadRequest && strings.HasPrefix(lw.Header().Get("Content-Type"), "text/plain")
+		if lw.translate {
+			lw.Header().Set("Content-Language", lw.language)
+			lw.Header().Add("Vary", "Accept-Language")
+		}
+	}
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *localizedWriter) Write(p []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	if !lw.translate {
+		return lw.ResponseWriter.Write(p)
+	}
+	message := strings.TrimSuffix(string(p), "\n")
+	if _, err := io.WriteString(lw.ResponseWriter, services.Translate(lw.language, message)+"\n"); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush keeps event streams working through the wrapper.
+func (lw *localizedWriter) Flush() {
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (lw *localizedWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+type I18nHandler struct {
+	preferred func() string
+}
+
+// NewI18nHandler creates a new I18nHandler. preferred returns the language
+// chosen in the preferences, or "" to follow Accept-Language.
+func NewI18nHandler(preferred func() string) *I18nHandler {
+	return &I18nHandler{preferred: preferred}
+}
+
+// Handle responds to GET requests with the translations of the UI for the
+// request's language, keyed by English text, and the languages available.
+func (h *I18nHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	language := requestLanguage(r, h.preferred)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", language)
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"language":  language,
+		"languages": services.Languages(),
+		"messages":  services.Messages(language),
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"recorder/services"
+	"time"
+)
+
+type JobsHandler struct {
+	jobs *services.JobStore
+}
+
+// NewJobsHandler creates a new JobsHandler for the background jobs of jobs.
+func NewJobsHandler(jobs *services.JobStore) *JobsHandler {
+	return &JobsHandler{jobs: jobs}
+}
+
+// Handle lists the background jobs on GET, such as FFmpeg installs, the most
+// recently started first, without their output.
+func (h *JobsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.jobs.List())
+}
+
+// HandleJob returns the job whose ID is job on GET /api/jobs/{job}, with its
+// status, progress and latest output.
+func (h *JobsHandler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("job")
+	job, ok := h.jobs.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleEvents streams the job whose ID is job on GET
+// /api/jobs/{job}/events as Server-Sent Events: a "job" event with the job
+// now and on each change of it, until it has finished.
+func (h *JobsHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	id := r.PathValue("job")
+	job, changes, stop, ok := h.jobs.Watch(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	}
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if err := writeJobEvent(w, job); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(statsStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case job, ok := <-changes:
+			if !ok {
+				return
+			}
+			if err := writeJobEvent(w, job); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeJobEvent(w http.ResponseWriter, job services.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+	return err
+}
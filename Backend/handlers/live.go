@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"recorder/services"
+	"strconv"
+	"strings"
+)
+
+type LiveHandler struct {
+	live   *services.LiveStreams
+	signer *services.URLSigner
+}
+
+func NewLiveHandler(live *services.LiveStreams, signer *services.URLSigner) *LiveHandler {
+	return &LiveHandler{live: live, signer: signer}
+}
+
+// Handle serves GET requests for the HLS playlist and segments of the live
+// stream of a recording. The segments in the playlist are signed links, so
+// that players given a signed link to the playlist can load them too.
+func (h *LiveHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("file")
+	file, ok := h.live.File(tabID, name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No live stream of tab %d is available", tabID), http.StatusNotFound)
+		return
+	}
+	if name != services.LivePlaylist {
+		w.Header().Set("Content-Type", "video/mp2t")
+		http.ServeFile(w, r, file)
+		return
+	}
+
+	playlist, err := os.ReadFile(file)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("No live stream of tab %d is available", tabID), http.StatusNotFound)
+		return
+	}
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && !strings.HasPrefix(line, "#") {
+			segment := path.Join(path.Dir(r.URL.Path), path.Base(line))
+			if line, _, err = h.signer.Sign(segment, services.DefaultSignedURLTTL); err != nil {
+				http.Error(w, "Failed to sign URL", http.StatusInternalServerError)
+				return
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(out.Bytes())
+}
@@ -1,29 +1,261 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"recorder/services"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-func getAllowedOrigin() string {
-	if origin := os.Getenv("ALLOWED_ORIGIN"); origin != "" {
-		return origin
+const corsMaxAge = "600"
+
+// allowedOrigins is resolved once so invalid entries are only logged once.
+var allowedOrigins = sync.OnceValue(getAllowedOrigins)
+
+// getAllowedOrigins returns the origins listed in ALLOWED_ORIGINS (comma-separated),
+// falling back to the legacy single ALLOWED_ORIGIN, or "*" when neither is set.
+// Entries that are not "*" or a scheme://host[:port] origin are logged and dropped.
+func getAllowedOrigins() []string {
+	raw := os.Getenv("ALLOWED_ORIGINS")
+	if raw == "" {
+		raw = os.Getenv("ALLOWED_ORIGIN")
+	}
+	if raw == "" {
+		return []string{"*"}
+	}
+
+	var origins []string
+	for _, entry := range strings.Split(raw, ",") {
+		origin := strings.TrimRight(strings.TrimSpace(entry), "/")
+		if origin == "" {
+			continue
+		}
+		if origin != "*" && !validOrigin(origin) {
+			services.LogError("[CORS] Ignoring invalid allowed origin %q", entry)
+			continue
+		}
+		origins = append(origins, origin)
 	}
-	return "*"
+	return origins
+}
+
+func validOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.Fragment == ""
+}
+
+// matchOrigin returns the value for Access-Control-Allow-Origin, or "" when
+// the request origin is not allowed.
+func matchOrigin(allowed []string, origin string) string {
+	for _, candidate := range allowed {
+		if candidate == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(candidate, origin) {
+			return origin
+		}
+	}
+	return ""
 }
 
 func CORSMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	allowedOrigin := getAllowedOrigin()
+	allowed := allowedOrigins()
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		
+		w.Header().Add("Vary", "Origin")
+		if origin := matchOrigin(allowed, r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Recording-Signature, X-CSRF-Token, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+		}
+
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		
+
+		next(w, r)
+	}
+}
+
+// Authenticator holds the credentials accepted on /api routes.
+type Authenticator struct {
+	token  *services.MasterToken
+	tokens *services.TokenStore
+	uiAuth *services.UIAuth
+	signer *services.URLSigner
+	guard  *services.AuthGuard
+}
+
+// NewAuthenticator creates an Authenticator for the primary API token, which has
+// every scope. tokens, uiAuth and signer may be nil to disable scoped tokens,
+// login sessions and signed URLs respectively. guard locks out clients that
+// present too many wrong tokens; nil disables lockouts.
+func NewAuthenticator(token *services.MasterToken, tokens *services.TokenStore, uiAuth *services.UIAuth, signer *services.URLSigner, guard *services.AuthGuard) *Authenticator {
+	return &Authenticator{token: token, tokens: tokens, uiAuth: uiAuth, signer: signer, guard: guard}
+}
+
+// authorize accepts the API token, a scoped token, a UI login session, or a
+// signed URL (GET only, read scope) and returns the HTTP status and message to
+// reject the request with, or 0 to let it through. Session-authenticated requests
+// that change state must also carry the session's CSRF token, since a browser
+// attaches the cookie to cross-site requests too.
+func (a *Authenticator) authorize(r *http.Request, required services.TokenScope) (int, string) {
+	token := requestToken(r)
+	if tokenMatches(token, a.token.Value()) {
+		return 0, ""
+	}
+	if scopes, ok := a.tokens.Lookup(token); ok {
+		if services.HasScope(scopes, required) {
+			return 0, ""
+		}
+		return http.StatusForbidden, "Token lacks the " + string(required) + " scope"
+	}
+	if id := sessionID(r); a.uiAuth.ValidSession(id) {
+		if isSafeMethod(r.Method) || a.uiAuth.ValidCSRF(id, r.Header.Get(csrfHeaderName)) {
+			return 0, ""
+		}
+		return http.StatusForbidden, "Invalid CSRF token"
+	}
+	if r.Method == http.MethodGet && a.signer.Valid(r.URL) && services.HasScope([]services.TokenScope{services.ScopeRead}, required) {
+		return 0, ""
+	}
+	return http.StatusUnauthorized, "Unauthorized"
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// AuthMiddleware rejects requests that do not carry the API token, either as an
+// "Authorization: Bearer <token>" header or, for clients that cannot set headers
+// (EventSource), as a "token" query parameter. Scoped tokens must hold readScope
+// for GET requests and writeScope otherwise; an empty scope admits any token.
+// When a UI password is configured, a valid login session cookie is accepted
+// instead, and downloads may use a signed URL issued by SignHandler.
+// Clients locked out after repeated wrong tokens get 429 until the lockout ends.
+func AuthMiddleware(a *Authenticator, readScope, writeScope services.TokenScope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		required := writeScope
+		if isSafeMethod(r.Method) {
+			required = readScope
+		}
+		ip := clientIP(r)
+		if wait := a.guard.Locked(ip); wait > 0 {
+			rejectLockedOut(w, r, wait)
+			return
+		}
+
+		presented := requestToken(r) != ""
+		switch status, message := a.authorize(r, required); status {
+		case 0:
+			if presented {
+				a.guard.Reset(ip)
+			}
+			next(w, r)
+		case http.StatusUnauthorized:
+			if presented {
+				a.guard.Fail(r.Context(), ip, "api token")
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="recorder"`)
+			http.Error(w, message, status)
+		default:
+			services.LogErrorCtx(r.Context(), "[AUTH] Rejected %s %s: %s", r.Method, r.URL.Path, message)
+			http.Error(w, message, status)
+		}
+	}
+}
+
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, value, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(value)
+		}
+		return ""
+	}
+	return r.URL.Query().Get("token")
+}
+
+func tokenMatches(got, want string) bool {
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// RateLimitMiddleware rejects requests with 429 once the client IP has exhausted
+// its bucket in limiter, counting each rejection in stats.
+func RateLimitMiddleware(limiter *services.RateLimiter, stats *services.Stats, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !limiter.Allow(ip) {
+			rejectRateLimited(w, r, stats, fmt.Errorf("rate limit exceeded for %s on %s", ip, r.URL.Path))
+			return
+		}
 		next(w, r)
 	}
-}
\ No newline at end of file
+}
+
+func rejectRateLimited(w http.ResponseWriter, r *http.Request, stats *services.Stats, err error) {
+	services.LogErrorCtx(r.Context(), "[RATELIMIT] %v", err)
+	stats.RecordError(services.ErrorKindRateLimit, err)
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// rejectLockedOut answers a client locked out by an AuthGuard with 429 and the
+// number of seconds until it may try again.
+func rejectLockedOut(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	services.LogErrorCtx(r.Context(), "[AUTH] Rejected %s %s from locked out %s", r.Method, r.URL.Path, clientIP(r))
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware tags each request with an ID, reusing a well-formed
+// X-Request-ID from the client so its logs can be matched with ours. The ID is
+// echoed in the response header and available to handlers via the request context.
+func RequestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next(w, r.WithContext(services.WithRequestID(r.Context(), id)))
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
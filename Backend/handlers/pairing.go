@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+	"strings"
+	"time"
+)
+
+type PairingHandler struct {
+	pairing *services.PairingService
+	baseURL string
+	guard   *services.AuthGuard
+}
+
+// NewPairingHandler creates a new PairingHandler. baseURL is the address other
+// devices on the network use to reach this server, or "" when it is not reachable
+// from the LAN (loopback-only bind or Unix socket). guard locks out clients
+// that guess codes.
+func NewPairingHandler(pairing *services.PairingService, baseURL string, guard *services.AuthGuard) *PairingHandler {
+	return &PairingHandler{pairing: pairing, baseURL: baseURL, guard: guard}
+}
+
+// HandleStart creates a one-time pairing code from {"scopes": ["read"], "ttlSeconds": n}
+// and returns it together with a pairing URL and a QR code of that URL as SVG.
+func (h *PairingHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Scopes     []string `json:"scopes"`
+		TTLSeconds int      `json:"ttlSeconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{string(services.ScopeRead)}
+	}
+	scopes, err := services.ParseScopes(strings.Join(req.Scopes, ","))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl := services.DefaultPairingTTL
+	if req.TTLSeconds > 0 {
+		ttl = min(time.Duration(req.TTLSeconds)*time.Second, services.MaxPairingTTL)
+	}
+
+	pairing, err := h.pairing.Start(scopes, ttl)
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[PAIRING] Failed to start pairing: %v", err)
+		http.Error(w, "Failed to start pairing", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"code":         pairing.Code,
+		"scopes":       pairing.Scopes,
+		"expires":      pairing.Expires,
+		"lanReachable": h.baseURL != "",
+	}
+	if h.baseURL != "" {
+		pairURL := h.baseURL + "/ui/pair.html#code=" + pairing.Code
+		resp["url"] = pairURL
+		if svg, err := services.QRCodeSVG(pairURL); err != nil {
+			services.LogErrorCtx(r.Context(), "[PAIRING] Failed to render QR code: %v", err)
+		} else {
+			resp["qrSvg"] = svg
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleRedeem exchanges {"code": "...", "name": "..."} for a scoped API token.
+// It needs no credentials; the one-time code is the credential.
+func (h *PairingHandler) HandleRedeem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := clientIP(r)
+	if wait := h.guard.Locked(ip); wait > 0 {
+		rejectLockedOut(w, r, wait)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	value, token, err := h.pairing.Redeem(req.Code, strings.TrimSpace(req.Name))
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[PAIRING] Redeem from %s failed: %v", ip, err)
+		h.guard.Fail(r.Context(), ip, "pairing")
+		http.Error(w, "Invalid or expired pairing code", http.StatusUnauthorized)
+		return
+	}
+	services.LogInfoCtx(r.Context(), "[PAIRING] Paired %q from %s", token.Name, ip)
+	h.guard.Succeed(r.Context(), ip, "pairing as "+token.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":  value,
+		"scopes": token.Scopes,
+	})
+}
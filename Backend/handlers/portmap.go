@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"recorder/services"
+	"strconv"
+)
+
+type PortMapHandler struct {
+	mapper     *services.PortMapper
+	tlsEnabled bool
+}
+
+// NewPortMapHandler creates a handler reporting the router port mapping.
+func NewPortMapHandler(mapper *services.PortMapper, tlsEnabled bool) *PortMapHandler {
+	return &PortMapHandler{mapper: mapper, tlsEnabled: tlsEnabled}
+}
+
+// Handle returns the mapping on GET, with the URL to reach the server at from
+// outside the network once it is active.
+func (h *PortMapHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := h.mapper.Status()
+	resp := struct {
+		services.PortMapping
+		URL string `json:"url,omitempty"`
+	}{PortMapping: status}
+	if status.Active && status.ExternalIP != "" {
+		scheme := "http"
+		if h.tlsEnabled {
+			scheme = "https"
+		}
+		resp.URL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(status.ExternalIP, strconv.Itoa(status.ExternalPort)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"recorder/services"
+)
+
+type PreferencesHandler struct {
+	settings *services.SettingsStore
+}
+
+// NewPreferencesHandler creates a new PreferencesHandler for the UI
+// preferences saved in settings.
+func NewPreferencesHandler(settings *services.SettingsStore) *PreferencesHandler {
+	return &PreferencesHandler{settings: settings}
+}
+
+// Handle returns the UI preferences on GET. PATCH changes the fields given
+// in {"theme", "defaultView", "units", "zoom", "language"} and returns the
+// result.
+func (h *PreferencesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var patch struct {
+			Theme       *string `json:"theme"`
+			DefaultView *string `json:"defaultView"`
+			Units       *string `json:"units"`
+			Zoom        *int    `json:"zoom"`
+			Language    *string `json:"language"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&patch); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		prefs := h.settings.Preferences()
+		setIfPresent(&prefs.Theme, patch.Theme)
+		setIfPresent(&prefs.DefaultView, patch.DefaultView)
+		setIfPresent(&prefs.Units, patch.Units)
+		setIfPresent(&prefs.Zoom, patch.Zoom)
+		setIfPresent(&prefs.Language, patch.Language)
+		if err := prefs.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.settings.SetPreferences(prefs); err != nil {
+			services.LogErrorCtx(r.Context(), "[CONFIG] Failed to save preferences: %v", err)
+			http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.settings.Preferences())
+}
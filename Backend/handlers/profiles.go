@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+)
+
+type ProfilesHandler struct {
+	profiles *services.ProfileStore
+}
+
+// NewProfilesHandler creates a new ProfilesHandler for the profiles in profiles.
+func NewProfilesHandler(profiles *services.ProfileStore) *ProfilesHandler {
+	return &ProfilesHandler{profiles: profiles}
+}
+
+// Handle lists the profiles and the active one on GET. POST creates or
+// replaces a profile from {"name", "recordingsDir", "retentionDays",
+// "namingTemplate", "hosts"}, and DELETE ?name=<name> removes one. Each returns the
+// resulting list.
+func (h *ProfilesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var profile services.Profile
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&profile); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if err := h.profiles.Put(profile); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "Profile name is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.profiles.Delete(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.writeProfiles(w)
+}
+
+// HandleActivate processes POST requests to switch profiles with {"name": "..."}.
+func (h *ProfilesHandler) HandleActivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := h.profiles.Activate(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeProfiles(w)
+}
+
+func (h *ProfilesHandler) writeProfiles(w http.ResponseWriter) {
+	profiles, active := h.profiles.List()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":   active,
+		"profiles": profiles,
+	})
+}
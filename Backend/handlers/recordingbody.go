@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"recorder/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInvalidEncoding wraps the errors of the base64 data of a recording
+// request, which are answered differently from malformed JSON.
+var errInvalidEncoding = errors.New("invalid data encoding")
+
+// decodeRecordingRequest reads the JSON recording request in body into data.
+// The base64 "data" field is decoded into chunk as it is read instead of
+// being held as a string first, so that a chunk takes about its own size in
+// memory rather than that of the request, the string and the decoded bytes
+// together. data.Data is left empty. sizeHint is the size of the request, if
+// known, to size chunk with. When only the data is invalid, the rest of the
+// request is still read into data and an error wrapping errInvalidEncoding
+// is returned. Requests are answered as encoding/json and
+// base64.StdEncoding would: the data may hold JSON escapes and line breaks,
+// and what follows the object is not read.
+func decodeRecordingRequest(body io.Reader, sizeHint int64, data *models.RecordingData, chunk *bytes.Buffer) error {
+	r := bufio.NewReader(body)
+	// fields collects the other fields, which are small, as a JSON object
+	// to unmarshal into data at the end
+	var fields bytes.Buffer
+	fields.WriteByte('{')
+	var encodingErr error
+
+	if err := expectByte(r, '{'); err != nil {
+		return err
+	}
+	for first := true; ; first = false {
+		c, err := nextByte(r)
+		if err != nil {
+			return err
+		}
+		if c == '}' && first {
+			break
+		}
+		if !first {
+			if c == '}' {
+				break
+			}
+			if c != ',' {
+				return fmt.Errorf("expected , or } after a field, got %q", c)
+			}
+			if c, err = nextByte(r); err != nil {
+				return err
+			}
+		}
+		if c != '"' {
+			return fmt.Errorf("expected a field name, got %q", c)
+		}
+		r.UnreadByte()
+		var quotedKey bytes.Buffer
+		if err := readValue(r, &quotedKey); err != nil {
+			return err
+		}
+		var key string
+		if err := json.Unmarshal(quotedKey.Bytes(), &key); err != nil {
+			return err
+		}
+		if err := expectByte(r, ':'); err != nil {
+			return err
+		}
+
+		if c, err = nextByte(r); err != nil {
+			return err
+		}
+		r.UnreadByte()
+		// Matched like json.Unmarshal matches field names
+		if strings.EqualFold(key, "data") && c == '"' {
+			r.ReadByte()
+			// The last "data" counts, as with json.Unmarshal
+			chunk.Reset()
+			encodingErr = nil
+			if sizeHint > 0 {
+				chunk.Grow(int(sizeHint / 4 * 3))
+			}
+			content := &jsonStringReader{r: r}
+			if _, err := chunk.ReadFrom(base64.NewDecoder(base64.StdEncoding, content)); err != nil {
+				// Errors of the request itself are those of the string;
+				// the others, including data cut short, of the base64
+				if content.err != nil {
+					return content.err
+				}
+				encodingErr = fmt.Errorf("%w: %v", errInvalidEncoding, err)
+				if err := content.skip(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if fields.Len() > 1 {
+			fields.WriteByte(',')
+		}
+		fields.Write(quotedKey.Bytes())
+		fields.WriteByte(':')
+		if err := readValue(r, &fields); err != nil {
+			return err
+		}
+	}
+	fields.WriteByte('}')
+	if err := json.Unmarshal(fields.Bytes(), data); err != nil {
+		return err
+	}
+	return encodingErr
+}
+
+// nextByte returns the next byte of r that is not white space.
+func nextByte(r *bufio.Reader) (byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c, nil
+		}
+	}
+}
+
+func expectByte(r *bufio.Reader, want byte) error {
+	c, err := nextByte(r)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if c != want {
+		return fmt.Errorf("expected %q, got %q", want, c)
+	}
+	return nil
+}
+
+// readValue copies the JSON value r is at to out, without checking more of
+// it than where it ends; json.Unmarshal checks the rest.
+func readValue(r *bufio.Reader, out *bytes.Buffer) error {
+	depth := 0
+	inString, escaped := false, false
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if depth == 0 {
+					return nil
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return r.UnreadByte()
+			}
+			depth--
+			if depth == 0 {
+				out.WriteByte(c)
+				return nil
+			}
+		case ',':
+			if depth == 0 {
+				return r.UnreadByte()
+			}
+		case ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return nil
+			}
+			continue
+		}
+		out.WriteByte(c)
+	}
+}
+
+// jsonStringReader reads the content of the JSON string r is in, with its
+// escape sequences decoded, up to its closing quote, which it consumes.
+type jsonStringReader struct {
+	r    *bufio.Reader
+	done bool
+	// err is why the string could not be read: the request ended in it, or
+	// it is not valid JSON.
+	err error
+	// pending is what is left of a character an escape sequence decoded to.
+	pending []byte
+}
+
+func (s *jsonStringReader) Read(p []byte) (int, error) {
+	if len(s.pending) > 0 {
+		n := copy(p, s.pending)
+		s.pending = s.pending[n:]
+		return n, nil
+	}
+	if s.done {
+		return 0, io.EOF
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.r.Buffered() == 0 {
+		if _, err := s.r.Peek(1); err != nil {
+			return 0, s.fail(err)
+		}
+	}
+	buf, _ := s.r.Peek(min(len(p), s.r.Buffered()))
+	n := 0
+	for n < len(buf) && buf[n] != '"' && buf[n] != '\\' && buf[n] >= 0x20 {
+		n++
+	}
+	if n > 0 {
+		copy(p, buf[:n])
+		s.r.Discard(n)
+		return n, nil
+	}
+	switch c := buf[0]; {
+	case c == '"':
+		s.r.Discard(1)
+		s.done = true
+		return 0, io.EOF
+	case c == '\\':
+		decoded, err := s.unescape()
+		if err != nil {
+			return 0, s.fail(err)
+		}
+		s.pending = decoded
+		return s.Read(p)
+	default:
+		return 0, s.fail(fmt.Errorf("invalid character %q in string", c))
+	}
+}
+
+// unescape reads the escape sequence r is at and returns what it stands for.
+func (s *jsonStringReader) unescape() ([]byte, error) {
+	sequence, err := s.r.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	var decoded []byte
+	switch sequence[1] {
+	case '"', '\\', '/':
+		decoded = []byte{sequence[1]}
+	case 'b':
+		decoded = []byte{'\b'}
+	case 'f':
+		decoded = []byte{'\f'}
+	case 'n':
+		decoded = []byte{'\n'}
+	case 'r':
+		decoded = []byte{'\r'}
+	case 't':
+		decoded = []byte{'\t'}
+	case 'u':
+		if sequence, err = s.r.Peek(6); err != nil {
+			return nil, err
+		}
+		code, err := strconv.ParseUint(string(sequence[2:6]), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid escape sequence %q in string", sequence)
+		}
+		s.r.Discard(6)
+		// A surrogate is not valid base64 either way, alone or in a pair
+		return utf8.AppendRune(nil, rune(code)), nil
+	default:
+		return nil, fmt.Errorf("invalid escape sequence %q in string", sequence)
+	}
+	s.r.Discard(2)
+	return decoded, nil
+}
+
+// fail records err as why the string could not be read and returns it.
+func (s *jsonStringReader) fail(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	s.err = err
+	return err
+}
+
+// skip reads the rest of the string, after its content could not be decoded.
+func (s *jsonStringReader) skip() error {
+	var scratch [512]byte
+	for {
+		if _, err := s.Read(scratch[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"recorder/models"
+)
+
+// Outcomes of decoding a recording request, as the handler answers them.
+const (
+	decodedOK       = "ok"
+	decodedFormat   = "invalid request format"
+	decodedEncoding = "invalid data encoding"
+)
+
+// decodeWithEncodingJSON decodes body as the handler did before the data was
+// streamed: with encoding/json, then base64.StdEncoding.
+func decodeWithEncodingJSON(body string) (models.RecordingData, []byte, string) {
+	var data models.RecordingData
+	if err := json.NewDecoder(strings.NewReader(body)).Decode(&data); err != nil {
+		return data, nil, decodedFormat
+	}
+	chunk, err := base64.StdEncoding.DecodeString(data.Data)
+	data.Data = ""
+	if err != nil {
+		return data, nil, decodedEncoding
+	}
+	return data, chunk, decodedOK
+}
+
+func TestDecodeRecordingRequestMatchesEncodingJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"chunk", `{"name":"tab","tabId":7,"timestamp":1700000000000,"data":"QUJDREVG","status":"stream","sequence":3}`},
+		{"data first", `{"data":"QUJDREVG","tabId":7,"status":"stream"}`},
+		{"white space", " {\n\t\"tabId\" : 7 ,\r\n \"data\" : \"QUJD\" }\n"},
+		{"empty data", `{"tabId":7,"data":"","status":"stopped"}`},
+		{"no data", `{"tabId":7,"status":"stopped","chunksSent":4,"bytesSent":100}`},
+		{"empty object", `{}`},
+		{"null data", `{"tabId":7,"data":null}`},
+		{"upper case key", `{"tabId":7,"DATA":"QUJD"}`},
+		{"last data counts", `{"data":"QU*D","data":"QUJD"}`},
+		{"nested fields", `{"tabId":7,"title":"a \"b\" {c}","data":"QUJD","width":[1],"height":{"x":[2]}}`},
+		{"escaped line breaks", `{"data":"QUJD\nREVG\r\n"}`},
+		{"escaped slash", `{"data":"\/\/\/\/"}`},
+		{"unicode escape", `{"data":"\u0051UJD"}`},
+		{"non-ASCII escape", `{"data":"QUJ\u00e9"}`},
+		{"surrogate pair", `{"data":"QU\ud83d\ude00"}`},
+		{"escaped quote", `{"data":"QU\"D"}`},
+		{"escaped backslash", `{"data":"QU\\D"}`},
+		{"escaped tab", `{"data":"QUJD\t"}`},
+		{"truncated base64", `{"data":"QUJDR"}`},
+		{"unpadded base64", `{"data":"QUI"}`},
+		{"short base64", `{"data":"QQ"}`},
+		{"corrupt base64", `{"data":"QU*D"}`},
+		{"padding in the middle", `{"data":"QQ==QUJD"}`},
+		{"invalid escape", `{"data":"QU\xD"}`},
+		{"short unicode escape", `{"data":"QU\u00"}`},
+		{"raw line break", "{\"data\":\"QUJD\nREVG\"}"},
+		{"unterminated data", `{"tabId":7,"data":"QUJD`},
+		{"unterminated escape", `{"tabId":7,"data":"QUJD\`},
+		{"unterminated object", `{"tabId":7,"data":"QUJD"`},
+		{"trailing data", `{"tabId":7,"data":"QUJD"} trailing`},
+		{"trailing object", `{"tabId":7,"data":"QUJD"}{"tabId":8}`},
+		{"number data", `{"data":12}`},
+		{"wrong type", `{"tabId":"seven","data":"QUJD"}`},
+		{"missing comma", `{"tabId":7 "data":"QUJD"}`},
+		{"double comma", `{"tabId":7,,"data":"QUJD"}`},
+		{"array", `[]`},
+		{"empty", ``},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wantData, wantChunk, want := decodeWithEncodingJSON(test.body)
+
+			var data models.RecordingData
+			var chunk bytes.Buffer
+			err := decodeRecordingRequest(strings.NewReader(test.body), int64(len(test.body)), &data, &chunk)
+			got := decodedOK
+			switch {
+			case errors.Is(err, errInvalidEncoding):
+				got = decodedEncoding
+			case err != nil:
+				got = decodedFormat
+			}
+
+			if got != want {
+				t.Fatalf("got %s (%v), encoding/json got %s", got, err, want)
+			}
+			if want == decodedFormat {
+				return
+			}
+			if !reflect.DeepEqual(data, wantData) {
+				t.Errorf("fields %+v, encoding/json got %+v", data, wantData)
+			}
+			if want == decodedOK && !bytes.Equal(chunk.Bytes(), wantChunk) {
+				t.Errorf("chunk %q, encoding/json got %q", chunk.Bytes(), wantChunk)
+			}
+		})
+	}
+}
+
+// A chunk larger than the buffer of the reader is decoded whole.
+func TestDecodeRecordingRequestLargeChunk(t *testing.T) {
+	want := bytes.Repeat([]byte("0123456789abcdef"), 64<<10)
+	body := `{"tabId":7,"status":"stream","data":"` + base64.StdEncoding.EncodeToString(want) + `"}`
+
+	var data models.RecordingData
+	var chunk bytes.Buffer
+	if err := decodeRecordingRequest(strings.NewReader(body), int64(len(body)), &data, &chunk); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chunk.Bytes(), want) {
+		t.Errorf("decoded %d bytes, want %d", chunk.Len(), len(want))
+	}
+	if data.TabID != 7 || data.Status != "stream" {
+		t.Errorf("fields %+v", data)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"recorder/services"
+	"strconv"
+	"strings"
+)
+
+type RecordingFilesHandler struct {
+	fileWriter *services.FileWriterService
+	profiles   *services.ProfileStore
+}
+
+// NewRecordingFilesHandler creates a new RecordingFilesHandler, which shows
+// finished recordings in the file manager of the machine the server runs on.
+func NewRecordingFilesHandler(fileWriter *services.FileWriterService, profiles *services.ProfileStore) *RecordingFilesHandler {
+	return &RecordingFilesHandler{fileWriter: fileWriter, profiles: profiles}
+}
+
+// HandleRecent lists the most recently finished recordings, newest first.
+func (h *RecordingFilesHandler) HandleRecent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.fileWriter.Finished())
+}
+
+// HandleSessions lists the last finished recording sessions, newest first,
+// with their file, duration, post-processing outcome and source.
+// ?status=completed, failed, timeout or interrupted lists only those, ?q
+// those whose name or page title or URL contain it, and ?limit the last limit
+// of them instead of 10.
+func (h *RecordingFilesHandler) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && !services.ValidSessionOutcome(status) {
+		http.Error(w, "Invalid status, expected completed, failed, timeout or interrupted", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.fileWriter.Sessions(status, strings.TrimSpace(query.Get("q")), limit))
+}
+
+// HandleOpenFolder processes POST requests that open the recordings
+// directory of the active profile, or of {"profile": "..."} if given.
+func (h *RecordingFilesHandler) HandleOpenFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Profile string `json:"profile"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dir := h.fileWriter.GetDownloadDir()
+	if req.Profile != "" {
+		list, _ := h.profiles.List()
+		dir = ""
+		for _, profile := range list {
+			if profile.Name == req.Profile {
+				dir = profile.RecordingsDir
+			}
+		}
+		if dir == "" {
+			http.Error(w, fmt.Sprintf("No profile named %q", req.Profile), http.StatusNotFound)
+			return
+		}
+	}
+	h.writeResult(w, r, services.OpenFolder(dir))
+}
+
+// HandleReveal processes POST requests of the form {"file": "<name>"}, which
+// show a recording selected in its folder. file is a name as listed by
+// HandleRecent, or any file in a profile's recordings directory.
+func (h *RecordingFilesHandler) HandleReveal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		File string `json:"file"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	path, err := services.LocateRecording(req.File, h.fileWriter, h.profiles)
+	switch {
+	case errors.Is(err, services.ErrRecordingNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeResult(w, r, services.RevealFile(path))
+}
+
+// HandleMedia serves a recording for playback, with range requests so that
+// players can seek. file is a name as accepted by HandleReveal. Players
+// reach it through a signed URL.
+func (h *RecordingFilesHandler) HandleMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, err := services.LocateRecording(r.URL.Query().Get("file"), h.fileWriter, h.profiles)
+	switch {
+	case errors.Is(err, services.ErrRecordingNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", services.RecordingContentType(info.Name()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// HandleImport processes POST requests whose body is a video file to add to
+// the recordings, such as one dropped onto the window. The name query
+// parameter is the original file name. It answers with the imported recording.
+func (h *RecordingFilesHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+	recording, err := h.fileWriter.Import(name, http.MaxBytesReader(w, r.Body, services.MaxImportSize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("File too large; at most %d GB can be imported", services.MaxImportSize>>30), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, services.ErrUnsupportedImport):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[FILES] Failed to import %s: %v", name, err)
+		http.Error(w, "Failed to import the file; see the server log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recording)
+}
+
+func (h *RecordingFilesHandler) writeResult(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoFileManager):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[FILES] Failed to open file manager: %v", err)
+		http.Error(w, "Failed to open the file manager; see the server log", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1,51 +1,536 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"recorder/models"
 	"recorder/services"
+	"strconv"
+	"time"
 )
 
+// defaultMaxChunkMB caps the size of a single recording request.
+const defaultMaxChunkMB = 64
+
 type RecordingsHandler struct {
-	recorder *services.RecorderService
+	recorder       *services.RecorderService
+	signingSecret  []byte
+	sessionLimiter *services.RateLimiter
+	maxBodyBytes   int64
 }
 
 // NewRecordingsHandler creates a new RecordingsHandler with the specified RecorderService.
-func NewRecordingsHandler(recorder *services.RecorderService) *RecordingsHandler {
-	return &RecordingsHandler{recorder: recorder}
+// When signingSecret is non-nil every request must carry a valid X-Recording-Signature.
+// sessionLimiter throttles requests per tab ID. Requests larger than
+// MAX_CHUNK_MB (default 64, 0 for no limit) are rejected.
+func NewRecordingsHandler(recorder *services.RecorderService, signingSecret []byte, sessionLimiter *services.RateLimiter) *RecordingsHandler {
+	maxChunkMB := float64(defaultMaxChunkMB)
+	if v, err := strconv.ParseFloat(os.Getenv("MAX_CHUNK_MB"), 64); err == nil && v >= 0 {
+		maxChunkMB = v
+	}
+	return &RecordingsHandler{
+		recorder:       recorder,
+		signingSecret:  signingSecret,
+		sessionLimiter: sessionLimiter,
+		maxBodyBytes:   int64(maxChunkMB * 1024 * 1024),
+	}
 }
 
 // Handle processes incoming recording data streams from the Chrome extension.
 // Accepts JSON with recording data (stream chunks or status updates), decodes base64 data,
 // and forwards to the RecorderService for processing and file writing.
 func (h *RecordingsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if h.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+	}
+	sizeHint := r.ContentLength
+	if h.maxBodyBytes > 0 && sizeHint > h.maxBodyBytes {
+		sizeHint = 0
+	}
+	// The chunk is decoded into a pooled buffer as the body is read; it is
+	// written before HandleRecording returns and not kept. The body itself
+	// is only kept to check its signature.
+	var body io.Reader = r.Body
+	var raw *bytes.Buffer
+	if h.signingSecret != nil {
+		raw = services.GetBuffer()
+		defer services.PutBuffer(raw)
+		body = io.TeeReader(r.Body, raw)
+	}
+	chunk := services.GetBuffer()
+	defer services.PutBuffer(chunk)
+
 	var data models.RecordingData
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		services.LogError("[RECORDINGS] Failed to decode request: %v", err)
+	err := decodeRecordingRequest(body, sizeHint, &data, chunk)
+	if h.signingSecret != nil && (err == nil || errors.Is(err, errInvalidEncoding)) {
+		// The signature covers whatever follows the object too
+		if _, readErr := io.Copy(io.Discard, body); readErr != nil {
+			err = readErr
+		}
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to read request: %v", err)
+		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil && !errors.Is(err, errInvalidEncoding):
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to decode request: %v", err)
+		h.recorder.GetStats().RecordError(services.ErrorKindDecode, err)
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
+	// A chunk that is not valid base64 is answered once the request was
+	// checked like any other
+	decodeErr := err
+
+	if h.signingSecret != nil {
+		signature := r.Header.Get(services.RecordingSignatureHeader)
+		if !services.VerifyRecordingSignature(h.signingSecret, data.TabID, data.Timestamp, raw.Bytes(), signature) {
+			services.LogErrorCtx(r.Context(), "[RECORDINGS] Rejected request for tab %d: missing or invalid signature", data.TabID)
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if !h.sessionLimiter.Allow(fmt.Sprint(data.TabID)) {
+		rejectRateLimited(w, r, h.recorder.GetStats(), fmt.Errorf("rate limit exceeded for tab %d", data.TabID))
+		return
+	}
+
+	if !services.IsRecordingContainer(data.Container) {
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Rejected request for tab %d: unsupported container %q", data.TabID, data.Container)
+		http.Error(w, "Unsupported container", http.StatusBadRequest)
+		return
+	}
+	if data.Container == "" {
+		data.Container = services.ContainerWebM
+	}
+	if !services.IsSessionPriority(data.Priority) {
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Rejected request for tab %d: unsupported priority %q", data.TabID, data.Priority)
+		http.Error(w, "Unsupported priority", http.StatusBadRequest)
+		return
+	}
+	if data.Priority == "" {
+		data.Priority = services.PriorityNormal
+	}
+	if !services.IsGroupID(data.Group) {
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Rejected request for tab %d: invalid group %q", data.TabID, data.Group)
+		http.Error(w, "Invalid group", http.StatusBadRequest)
+		return
+	}
 
 	var decodedData []byte
-	var err error
 
 	if data.Status == "stream" {
-		decodedData, err = base64.StdEncoding.DecodeString(data.Data)
-		if err != nil {
-			services.LogError("[RECORDINGS] Base64 decode failed for tab %d: %v", data.TabID, err)
+		decodedData = chunk.Bytes()
+		if decodeErr != nil {
+			services.LogErrorCtx(r.Context(), "[RECORDINGS] Base64 decode failed for tab %d: %v", data.TabID, decodeErr)
+			h.recorder.GetStats().RecordError(services.ErrorKindDecode, decodeErr)
 			http.Error(w, "Invalid data encoding", http.StatusBadRequest)
 			return
 		}
 	}
 
-	if err := h.recorder.HandleRecording(data.TabID, data.Name, data.Timestamp, decodedData, data.Status); err != nil {
-		services.LogError("[RECORDINGS] Recording failed for tab %d: %v", data.TabID, err)
+	source := services.RecordingSource{
+		URL:        data.URL,
+		Title:      data.Title,
+		FavIconURL: data.FavIconURL,
+		Width:      data.Width,
+		Height:     data.Height,
+		MIMEType:   data.MimeType,
+	}.Clean()
+
+	// The extension ends a file with what it sent of it, to check the file
+	// against when it is finished
+	if (data.Status == "split" || data.Status == "stopped") && data.ChunksSent > 0 {
+		h.recorder.ReportClientTotals(data.TabID, data.Timestamp, services.ClientTotals{
+			Chunks:          data.ChunksSent,
+			Bytes:           data.BytesSent,
+			DurationSeconds: float64(data.DurationMs) / 1000,
+		})
+	}
+
+	var limitErr *services.SessionLimitError
+	if err := h.recorder.HandleRecording(r.Context(), data.TabID, data.Name, data.Timestamp, data.Sequence, decodedData, data.Status, services.RecordingFormat{Container: data.Container, AudioOnly: data.AudioOnly}, data.Priority, source, data.Group, data.Profile); errors.Is(err, services.ErrRecordingStopped) {
+		http.Error(w, "Recording was stopped from the server", http.StatusGone)
+		return
+	} else if errors.As(err, &limitErr) {
+		h.recorder.GetStats().RecordError(services.ErrorKindSessionLimit, err)
+		rejectSessionLimit(w, limitErr.Limit)
+		return
+	} else if err != nil {
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Recording failed for tab %d: %v", data.TabID, err)
 		http.Error(w, "Recording failed", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "received"})
-}
\ No newline at end of file
+}
+
+// rejectSessionLimit answers the first chunk of a recording beyond the limit of
+// simultaneous recordings with 429 and a JSON body the extension shows, e.g.
+// {"error": "session_limit", "message": "...", "limit": 3}.
+func rejectSessionLimit(w http.ResponseWriter, limit int) {
+	message := fmt.Sprintf("The server is already recording the most sessions it allows (%d). Stop one to start another.", limit)
+	// LocalizeMiddleware only translates plain-text errors.
+	if lw, ok := w.(*localizedWriter); ok {
+		message = services.Translate(lw.language, message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "session_limit",
+		"message": message,
+		"limit":   limit,
+	})
+}
+
+// HandleStop processes POST requests to stop every active recording from the
+// server. It responds with {"stopped": n}.
+func (h *RecordingsHandler) HandleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stopped := h.recorder.StopAll(r.Context())
+	services.LogInfoCtx(r.Context(), "[RECORDINGS] Stopped %d recording(s) from the server", stopped)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"stopped": stopped})
+}
+
+// HandleStopSession processes POST requests to /api/recordings/{session}/stop,
+// which stop the recording of the tab whose ID is session from the server.
+func (h *RecordingsHandler) HandleStopSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	err = h.recorder.Stop(r.Context(), tabID)
+	if errors.Is(err, services.ErrNotRecording) {
+		http.Error(w, fmt.Sprintf("Tab %d is not being recorded", tabID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to stop recording for tab %d: %v", tabID, err)
+		http.Error(w, "Failed to stop recording", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSplitSession processes POST requests to /api/recordings/{session}/split,
+// which ask the extension to finish the current file of the recording of the
+// tab whose ID is session and go on in a new one. It responds with 202 as the
+// extension splits the recording.
+func (h *RecordingsHandler) HandleSplitSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	err = h.recorder.Split(r.Context(), tabID)
+	switch {
+	case errors.Is(err, services.ErrNotRecording):
+		http.Error(w, fmt.Sprintf("Tab %d is not being recorded", tabID), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrNoExtension):
+		http.Error(w, "No extension is connected to split the recording", http.StatusConflict)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to split recording for tab %d: %v", tabID, err)
+		http.Error(w, "Failed to split recording", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleRecover processes POST requests to /api/recordings/{session}/recover,
+// from an extension that recovered from a crash while recording the tab whose
+// ID is session. It responds with what the extension should do, e.g.
+// {"action": "resume", "name": "...", "continuesFrom": "meeting.webm"}: record
+// the tab again as name, unless action is "stop".
+func (h *RecordingsHandler) HandleRecover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	decision, err := h.recorder.Recover(r.Context(), tabID)
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to recover recording for tab %d: %v", tabID, err)
+		http.Error(w, "Failed to recover recording", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
+
+// HandleMarkers processes POST requests to /api/recordings/{session}/markers,
+// which mark a moment of the recording of the tab whose ID is session, e.g. a
+// highlight, from {"label": "...", "at": "..."}. at is an RFC 3339 time and
+// defaults to now; an empty label is numbered. It responds with the marker.
+func (h *RecordingsHandler) HandleMarkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Label string `json:"label"`
+		At    string `json:"at"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len([]rune(req.Label)) > services.MaxMarkerLabel {
+		http.Error(w, fmt.Sprintf("label must be at most %d characters", services.MaxMarkerLabel), http.StatusBadRequest)
+		return
+	}
+	at := time.Now()
+	if req.At != "" {
+		if err := at.UnmarshalText([]byte(req.At)); err != nil {
+			http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	marker, err := h.recorder.AddMarker(r.Context(), tabID, req.Label, at)
+	switch {
+	case errors.Is(err, services.ErrNotRecording):
+		http.Error(w, fmt.Sprintf("Tab %d is not being recorded", tabID), http.StatusNotFound)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to add marker for tab %d: %v", tabID, err)
+		http.Error(w, "Failed to add marker", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(marker)
+}
+
+// HandleScreenshot processes POST requests to
+// /api/recordings/{session}/screenshot, which take a full-resolution
+// screenshot of the tab whose ID is session and save it next to the
+// recording. A page captured on the server is shot right away, responding
+// with 201 and the screenshot; the extension is asked to send one of a tab it
+// records, responding with 202.
+func (h *RecordingsHandler) HandleScreenshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	screenshot, err := h.recorder.RequestScreenshot(r.Context(), tabID)
+	switch {
+	case errors.Is(err, services.ErrNotRecording), errors.Is(err, services.ErrCaptureNotFound):
+		http.Error(w, fmt.Sprintf("Tab %d is not being recorded", tabID), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrNoExtension):
+		http.Error(w, "No extension is connected to take the screenshot", http.StatusConflict)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to take screenshot of tab %d: %v", tabID, err)
+		http.Error(w, "Failed to take screenshot", http.StatusInternalServerError)
+		return
+	}
+	if screenshot == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(screenshot)
+}
+
+// HandleScreenshots processes POST requests to
+// /api/recordings/{session}/screenshots from the extension, whose body is a
+// PNG or JPEG screenshot of the tab whose ID is session, taken at the RFC 3339
+// time of the at query parameter or else now. It responds with 201 and the
+// screenshot.
+func (h *RecordingsHandler) HandleScreenshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		if err := at.UnmarshalText([]byte(v)); err != nil {
+			http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	image, err := io.ReadAll(http.MaxBytesReader(w, r.Body, services.MaxScreenshotSize))
+	if err != nil {
+		http.Error(w, "Screenshot too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	screenshot, err := h.recorder.AddScreenshot(r.Context(), tabID, image, at)
+	switch {
+	case errors.Is(err, services.ErrNotRecording):
+		http.Error(w, fmt.Sprintf("Tab %d is not being recorded", tabID), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrInvalidScreenshot):
+		http.Error(w, "Screenshot must be a PNG or JPEG image", http.StatusBadRequest)
+		return
+	case err != nil:
+		services.LogErrorCtx(r.Context(), "[RECORDINGS] Failed to save screenshot of tab %d: %v", tabID, err)
+		http.Error(w, "Failed to save screenshot", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(screenshot)
+}
+
+// HandlePreview processes GET requests to /api/recordings/{session}/preview,
+// which stream a live preview of the recording of the tab whose ID is session
+// for Media Source Extensions: the start of the recording file and its latest
+// clusters or fragments, then the chunks that follow as they arrive. The
+// Content-Type names the SourceBuffer type. The stream ends with the file,
+// e.g. when the recording is split or stopped.
+func (h *RecordingsHandler) HandlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tabID, err := strconv.Atoi(r.PathValue("session"))
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	preview := h.recorder.Preview(tabID)
+	if preview == nil {
+		http.Error(w, fmt.Sprintf("No live preview of tab %d is available", tabID), http.StatusNotFound)
+		return
+	}
+	viewer, err := preview.Join()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("No live preview of tab %d is available", tabID), http.StatusNotFound)
+		return
+	}
+	defer viewer.Leave()
+
+	w.Header().Set("Content-Type", viewer.MIMEType)
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(viewer.Start); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case chunk, ok := <-viewer.Chunks:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// HandleEvents pushes commands for the extension as Server-Sent Events, e.g.
+// "stop" with {"type": "stop", "tabId": 123} when a recording is stopped
+// from the server, "split" with the same data when it is split into a new
+// file, "screenshot" when a screenshot of the tab is wanted, or "start" with the scheduleId, name and url of a scheduled
+// recording.
+func (h *RecordingsHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	commands, unsubscribe := h.recorder.Subscribe()
+	defer unsubscribe()
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(statsStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case cmd := <-commands:
+			data, err := json.Marshal(cmd)
+			if err != nil {
+				services.LogError("[RECORDINGS] Failed to encode %s command: %v", cmd.Type, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", cmd.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"recorder/services"
+	"time"
+)
+
+// resetRestartDelay gives the response time to reach the client before the
+// server restarts.
+const resetRestartDelay = 500 * time.Millisecond
+
+type ResetHandler struct {
+	reset   func(keepRecordings bool) (services.FactoryResetReport, error)
+	restart func()
+	audit   *services.AuditLog
+}
+
+// NewResetHandler creates a new ResetHandler. reset wipes the stored state
+// and restart is called once the response has been sent, so the server comes
+// back up without what it had in memory.
+func NewResetHandler(reset func(keepRecordings bool) (services.FactoryResetReport, error), restart func(), audit *services.AuditLog) *ResetHandler {
+	return &ResetHandler{reset: reset, restart: restart, audit: audit}
+}
+
+// Handle processes POST requests of the form
+// {"confirm": "RESET", "keepRecordings": true}, which erase the settings,
+// tokens, stats and profiles, and the recordings unless keepRecordings is
+// set, then restart the server. Every API token stops working, including the
+// one that made the request.
+func (h *ResetHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Confirm        string `json:"confirm"`
+		KeepRecordings bool   `json:"keepRecordings"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Confirm != services.FactoryResetConfirmation {
+		http.Error(w, fmt.Sprintf("Set \"confirm\" to %q to erase all settings and tokens", services.FactoryResetConfirmation), http.StatusBadRequest)
+		return
+	}
+
+	h.audit.Record(r.Context(), "factory_reset", clientIP(r), fmt.Sprintf("keepRecordings=%t", req.KeepRecordings))
+	report, err := h.reset(req.KeepRecordings)
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[RESET] Factory reset failed: %v", err)
+		http.Error(w, "Factory reset failed; see the server log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(report)
+	time.AfterFunc(resetRestartDelay, h.restart)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"recorder/services"
+)
+
+type SchedulesHandler struct {
+	schedules *services.ScheduleStore
+}
+
+// NewSchedulesHandler creates a new SchedulesHandler for the schedules in schedules.
+func NewSchedulesHandler(schedules *services.ScheduleStore) *SchedulesHandler {
+	return &SchedulesHandler{schedules: schedules}
+}
+
+// Handle lists the schedules on GET. POST adds one from {"name", "url",
+// "startAt", "stopAt", "headless"}, with RFC 3339 times, and DELETE ?id=<id>
+// removes one, stopping its recording. Each returns the resulting list.
+func (h *SchedulesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Name    string `json:"name"`
+			URL     string `json:"url"`
+			StartAt string `json:"startAt"`
+			StopAt  string `json:"stopAt"`
+			// Headless schedules are recorded in a headless browser on the
+			// server rather than by the extension.
+			Headless bool `json:"headless"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		schedule := services.Schedule{Name: req.Name, URL: req.URL, Headless: req.Headless}
+		if err := schedule.StartAt.UnmarshalText([]byte(req.StartAt)); err != nil {
+			http.Error(w, "startAt must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		if err := schedule.StopAt.UnmarshalText([]byte(req.StopAt)); err != nil {
+			http.Error(w, "stopAt must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.schedules.Add(schedule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Schedule ID is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.schedules.Delete(r.Context(), id); errors.Is(err, services.ErrScheduleNotFound) {
+			http.Error(w, "Schedule not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			services.LogErrorCtx(r.Context(), "[SCHEDULE] Failed to delete schedule: %v", err)
+			http.Error(w, "Failed to delete schedule", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.schedules.List())
+}
+
+// HandleSession processes POST requests from the extension answering a
+// "start" command, with {"tabId": 123} for the tab it records or
+// {"error": "..."} when it could not record the schedule.
+func (h *SchedulesHandler) HandleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		TabID int    `json:"tabId"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.TabID <= 0 && req.Error == "") {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	err := h.schedules.Report(r.Context(), r.PathValue("id"), req.TabID, req.Error)
+	if errors.Is(err, services.ErrScheduleNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/services"
+	"strings"
+)
+
+const (
+	sessionCookieName = "recorder_session"
+	csrfCookieName    = "recorder_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+	loginPagePath     = "/ui/login.html"
+)
+
+// publicUIAssets are served without a session so the login and pairing pages can render.
+var publicUIAssets = map[string]bool{
+	loginPagePath:       true,
+	"/ui/login.js":      true,
+	"/ui/pair.html":     true,
+	"/ui/pair.js":       true,
+	"/ui/styles.css":    true,
+	"/ui/favicon.ico":   true,
+	"/ui/lucide.min.js": true,
+}
+
+type SessionHandler struct {
+	auth  *services.UIAuth
+	guard *services.AuthGuard
+}
+
+// NewSessionHandler creates a handler for UI login and logout. auth may be nil
+// when no UI password is configured; guard locks out repeated wrong passwords.
+func NewSessionHandler(auth *services.UIAuth, guard *services.AuthGuard) *SessionHandler {
+	return &SessionHandler{auth: auth, guard: guard}
+}
+
+// HandleLogin reports whether a login is required and the caller is signed in
+// on GET, and exchanges {"password": "..."} for a session cookie on POST.
+func (h *SessionHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{
+			"enabled":       h.auth != nil,
+			"authenticated": h.auth == nil || h.auth.ValidSession(sessionID(r)),
+		})
+	case http.MethodPost:
+		if h.auth == nil {
+			http.Error(w, "UI password is not configured", http.StatusNotFound)
+			return
+		}
+		ip := clientIP(r)
+		if wait := h.guard.Locked(ip); wait > 0 {
+			rejectLockedOut(w, r, wait)
+			return
+		}
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		id, csrf, ok := h.auth.Login(req.Password)
+		if !ok {
+			services.LogErrorCtx(r.Context(), "[AUTH] Failed UI login from %s", ip)
+			h.guard.Fail(r.Context(), ip, "login")
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+		services.LogInfoCtx(r.Context(), "[AUTH] UI login from %s", ip)
+		h.guard.Succeed(r.Context(), ip, "login")
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookieName,
+			Value:    id,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		// Readable by the UI's scripts, which echo it in the X-CSRF-Token header.
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    csrf,
+			Path:     "/",
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleLogout ends the caller's session and clears the cookie.
+func (h *SessionHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.auth != nil {
+		if !h.auth.ValidCSRF(sessionID(r), r.Header.Get(csrfHeaderName)) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		h.auth.Logout(sessionID(r))
+	}
+	for _, name := range []string{sessionCookieName, csrfCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == sessionCookieName,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// UIMiddleware redirects UI requests without a valid session to the login page.
+// It is a no-op when auth is nil.
+func UIMiddleware(auth *services.UIAuth, next http.Handler) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicUIAssets[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/ui/icons/") || auth.ValidSession(sessionID(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Redirect(w, r, loginPagePath, http.StatusSeeOther)
+	})
+}
+
+func sessionID(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
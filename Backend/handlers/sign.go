@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"recorder/services"
+	"time"
+)
+
+// signablePaths lists the GET endpoints that may be reached through a signed URL.
+var signablePaths = map[string]bool{
+	"/api/stats/export":     true,
+	"/api/crashes":          true,
+	"/api/recordings/media": true,
+}
+
+// signable reports whether p is in signablePaths or is the playlist of a live
+// stream, whose segments are signed as the playlist is served.
+func signable(p string) bool {
+	live, _ := path.Match("/api/recordings/*/live/"+services.LivePlaylist, p)
+	return signablePaths[p] || live
+}
+
+type SignHandler struct {
+	signer *services.URLSigner
+}
+
+func NewSignHandler(signer *services.URLSigner) *SignHandler {
+	return &SignHandler{signer: signer}
+}
+
+// Handle exchanges {"path": "/api/...?...", "ttlSeconds": n} for a signed URL
+// that can be used as a plain link until it expires.
+func (h *SignHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Path       string `json:"path"`
+		TTLSeconds int    `json:"ttlSeconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(req.Path)
+	if err != nil || u.IsAbs() || !signable(u.Path) {
+		http.Error(w, "Path cannot be signed", http.StatusBadRequest)
+		return
+	}
+
+	ttl := services.DefaultSignedURLTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > services.MaxSignedURLTTL {
+		ttl = services.MaxSignedURLTTL
+	}
+
+	signed, expires, err := h.signer.Sign(u.String(), ttl)
+	if err != nil {
+		http.Error(w, "Failed to sign URL", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":     signed,
+		"expires": expires,
+	})
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"recorder/services"
+	"sort"
+	"strconv"
 	"time"
 )
 
+const (
+	statsStreamInterval  = 1 * time.Second
+	statsStreamKeepAlive = 15 * time.Second
+)
+
 type StatsHandler struct {
 	recorder   *services.RecorderService
 	fileWriter *services.FileWriterService
@@ -28,15 +37,206 @@ func (sh *StatsHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sh.snapshot())
+}
+
+// HandleStream pushes statistics to the client as Server-Sent Events.
+// The first event is a full "snapshot"; subsequent "delta" events only carry
+// the top-level keys whose values changed since the previous push.
+func (sh *StatsHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	last := encodeStatsFields(sh.snapshot())
+	if err := writeStatsEvent(w, "snapshot", last); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(statsStreamInterval)
+	defer ticker.Stop()
+	lastSent := time.Now()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			current := encodeStatsFields(sh.snapshot())
+			delta := make(map[string]json.RawMessage)
+			for key, value := range current {
+				if prev, ok := last[key]; !ok || string(prev) != string(value) {
+					delta[key] = value
+				}
+			}
+			last = current
+
+			if len(delta) == 0 {
+				if time.Since(lastSent) < statsStreamKeepAlive {
+					continue
+				}
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			} else if err := writeStatsEvent(w, "delta", delta); err != nil {
+				return
+			}
+
+			flusher.Flush()
+			lastSent = time.Now()
+		}
+	}
+}
+
+// HandleExport responds to GET requests with the per-day stats history as a
+// downloadable file. The format query parameter selects "json" (default) or "csv".
+func (sh *StatsHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history := sh.fileWriter.GetStats().GetDailyHistory()
+	filename := "stats_" + time.Now().Format("2006-01-02")
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"exportedAt": time.Now().Format(time.RFC3339),
+			"days":       history,
+		})
+
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"date", "sessions", "size_bytes"})
+		for _, day := range history {
+			writer.Write([]string{
+				day.Date,
+				strconv.Itoa(day.Sessions),
+				strconv.FormatInt(day.SizeBytes, 10),
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			services.LogErrorCtx(r.Context(), "[STATS] CSV export failed: %v", err)
+		}
+
+	default:
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+	}
+}
+
+// HandleTimeSeries responds to GET requests with ingest throughput samples.
+// Query parameters: resolution ("second" or "minute"), since (unix seconds) and
+// tabId to restrict per-session series to a single tab.
+func (sh *StatsHandler) HandleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	resolution := query.Get("resolution")
+	if resolution == "" {
+		resolution = "second"
+	}
+	if resolution != "second" && resolution != "minute" {
+		http.Error(w, "Unsupported resolution", http.StatusBadRequest)
+		return
+	}
+
+	var since int64
+	if v := query.Get("since"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	timeSeries := sh.recorder.GetTimeSeries()
+	sessions := make(map[string][]services.ThroughputSample)
+	if resolution == "second" {
+		for tabID, samples := range timeSeries.Sessions(since) {
+			if v := query.Get("tabId"); v != "" && v != strconv.Itoa(tabID) {
+				continue
+			}
+			sessions[strconv.Itoa(tabID)] = samples
+		}
+	}
+
+	interval := 1
+	if resolution == "minute" {
+		interval = 60
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resolution":  resolution,
+		"intervalSec": interval,
+		"global":      timeSeries.Global(resolution, since),
+		"sessions":    sessions,
+	})
+}
+
+// HandleRepair responds to POST requests by recomputing the persistent totals from
+// the recordings on disk. Pass {"dryRun": true} to preview the result without saving.
+func (sh *StatsHandler) HandleRepair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		DryRun bool `json:"dryRun"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := sh.fileWriter.GetStats().Repair(sh.fileWriter.GetDownloadDir(), req.DryRun)
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[STATS] Repair failed: %v", err)
+		http.Error(w, "Stats repair failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (sh *StatsHandler) snapshot() map[string]interface{} {
 	activeRecordings := sh.recorder.GetActiveRecordings()
 	persistentStats := sh.fileWriter.GetStats()
-	sessionInfos := sh.recorder.GetAllSessionInfo()
-	
+	sessionInfos := sh.recorder.SessionInfoCopies()
+	// The maps they come from have no order; sorted, an unchanged list
+	// encodes the same and the stream leaves it out of the next delta.
+	sort.Ints(activeRecordings)
+	sort.Slice(sessionInfos, func(i, j int) bool { return sessionInfos[i].TabID < sessionInfos[j].TabID })
+
 	sessions := make([]map[string]interface{}, 0, len(sessionInfos))
 	for _, info := range sessionInfos {
-		if info == nil {
-			continue
-		}
 		duration := int64(time.Since(info.StartTime).Seconds())
 		sessions = append(sessions, map[string]interface{}{
 			"tabId":        info.TabID,
@@ -45,17 +245,49 @@ func (sh *StatsHandler) Handle(w http.ResponseWriter, r *http.Request) {
 			"durationSec":  duration,
 			"bytesWritten": info.BytesWritten,
 			"sizeMB":       float64(info.BytesWritten) / (1024 * 1024),
+			"audioOnly":    info.Format.AudioOnly,
+			"container":    info.Format.Container,
+			"priority":     info.Priority,
+			"group":        info.Group,
+			"segment":      info.Segment,
+			"markers":      info.Markers,
+			"source":       info.Source,
+			"live":         sh.recorder.IsLive(info.TabID),
 		})
 	}
-	
-	stats := map[string]interface{}{
+
+	return map[string]interface{}{
 		"activeRecordings": len(activeRecordings),
 		"activeTabs":       activeRecordings,
 		"totalSizeMB":      float64(persistentStats.GetTotalSize()) / (1024 * 1024),
 		"totalSessions":    persistentStats.GetTotalSessions(),
 		"sessions":         sessions,
+		"errors":           persistentStats.GetErrors(),
+		"maxSessions":      sh.recorder.MaxSessions(),
+		// postProcessingQueue is how many finished recordings wait for FFmpeg
+		"postProcessingQueue": sh.fileWriter.PostProcessingQueue(),
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
-}
\ No newline at end of file
+func encodeStatsFields(stats map[string]interface{}) map[string]json.RawMessage {
+	encoded := make(map[string]json.RawMessage, len(stats))
+	for key, value := range stats {
+		data, err := json.Marshal(value)
+		if err != nil {
+			services.LogError("[STATS] Failed to encode field %s: %v", key, err)
+			continue
+		}
+		encoded[key] = data
+	}
+	return encoded
+}
+
+func writeStatsEvent(w http.ResponseWriter, event string, payload map[string]json.RawMessage) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		services.LogError("[STATS] Failed to encode %s event: %v", event, err)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"recorder/services"
+	"strings"
+)
+
+type TokensHandler struct {
+	tokens *services.TokenStore
+	master *services.MasterToken
+	signer *services.URLSigner
+}
+
+// NewTokensHandler creates a new TokensHandler for the scoped tokens in tokens,
+// the primary API token and the URL signer whose links rotation invalidates.
+func NewTokensHandler(tokens *services.TokenStore, master *services.MasterToken, signer *services.URLSigner) *TokensHandler {
+	return &TokensHandler{tokens: tokens, master: master, signer: signer}
+}
+
+// Handle lists the issued scoped tokens on GET. POST issues a new token from
+// {"name": "...", "scopes": ["read"]} and returns its value, which is shown only once.
+// DELETE ?id=<id> revokes a token, including ones issued through device pairing.
+func (h *TokensHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.tokens.List())
+	case http.MethodPost:
+		var req struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		scopes, err := services.ParseScopes(strings.Join(req.Scopes, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			http.Error(w, "Token name is required", http.StatusBadRequest)
+			return
+		}
+
+		value, token, err := h.tokens.Issue(strings.TrimSpace(req.Name), scopes)
+		if err != nil {
+			services.LogErrorCtx(r.Context(), "[AUTH] Failed to issue token: %v", err)
+			http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token": value,
+			"info":  token,
+		})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Token id is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.tokens.Revoke(id); err != nil {
+			if errors.Is(err, services.ErrTokenNotFound) {
+				http.Error(w, "Token not found", http.StatusNotFound)
+				return
+			}
+			services.LogErrorCtx(r.Context(), "[AUTH] Failed to revoke token %s: %v", id, err)
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRotate replaces the primary API token and the URL signing key, so the
+// old token and every signed link stop working at once. The new token is
+// returned; clients such as the extension must be updated with it.
+func (h *TokensHandler) HandleRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	value, err := h.master.Rotate()
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[AUTH] Failed to rotate API token: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err := h.signer.Rotate(); err != nil {
+		services.LogErrorCtx(r.Context(), "[AUTH] Failed to rotate URL signing key: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": value})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"recorder/services"
+	"strconv"
+	"time"
+)
+
+type UpdateHandler struct {
+	updater  *services.Updater
+	settings *services.SettingsStore
+	active   func() int
+	restart  func()
+}
+
+// NewUpdateHandler creates a new UpdateHandler. The auto-update choice is
+// saved to settings. active counts the recordings in progress, which a restart
+// would cut off, and restart restarts the server so that a staged update is
+// installed.
+func NewUpdateHandler(updater *services.Updater, settings *services.SettingsStore, active func() int, restart func()) *UpdateHandler {
+	return &UpdateHandler{updater: updater, settings: settings, active: active, restart: restart}
+}
+
+// Handle responds to GET requests with the update status. POST turns automatic
+// updates on or off with {"auto": bool}.
+func (h *UpdateHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Auto *bool `json:"auto"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Auto == nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		h.updater.SetAuto(*req.Auto)
+		if err := h.settings.Save(map[string]string{"update.auto": strconv.FormatBool(*req.Auto)}); err != nil {
+			services.LogErrorCtx(r.Context(), "[UPDATE] Failed to save settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+		services.LogInfoCtx(r.Context(), "[UPDATE] Automatic updates set to %v", *req.Auto)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeUpdateStatus(w, h.updater.Status(), nil)
+}
+
+// HandleCheck processes POST requests to check the release feed now.
+func (h *UpdateHandler) HandleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := h.updater.Check(r.Context())
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[UPDATE] Update check failed: %v", err)
+	}
+	writeUpdateStatus(w, status, err)
+}
+
+// HandleInstall processes POST requests to download and verify the latest
+// release, which is installed on the next restart.
+func (h *UpdateHandler) HandleInstall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := h.updater.Install(r.Context())
+	if err != nil {
+		services.LogErrorCtx(r.Context(), "[UPDATE] Update failed: %v", err)
+	}
+	writeUpdateStatus(w, status, err)
+}
+
+// HandleRestart processes POST requests to restart the server now and install
+// the staged update, instead of waiting for the next start. It is refused
+// while recordings are in progress.
+func (h *UpdateHandler) HandleRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := h.updater.Status()
+	if status.Staged == "" {
+		http.Error(w, "No update is waiting to be installed", http.StatusConflict)
+		return
+	}
+	if active := h.active(); active > 0 {
+		http.Error(w, fmt.Sprintf("%d recording(s) in progress; stop them before restarting", active), http.StatusConflict)
+		return
+	}
+
+	services.LogInfoCtx(r.Context(), "[UPDATE] Restarting to install version %s", status.Staged)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+	time.AfterFunc(resetRestartDelay, h.restart)
+}
+
+// writeUpdateStatus writes status, with 502 Bad Gateway if err is set; the
+// status then carries the error message.
+func writeUpdateStatus(w http.ResponseWriter, status services.UpdateStatus, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recorder/models"
+	"recorder/services"
+	"runtime"
+	"time"
+)
+
+// VersionHandler responds with the build version, commit, build time, Go runtime,
+// platform and process uptime.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := models.VersionResponse{
+		Version:   services.Version,
+		Commit:    services.BuildCommit(),
+		BuildTime: services.BuildTime,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		StartTime: services.StartTime().Format(time.RFC3339),
+		UptimeSec: int64(services.Uptime().Seconds()),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"recorder/services"
+)
+
+const webviewCookieName = "recorder_webview"
+
+// WebviewPath is where the desktop window is sent first on the listener of a
+// WebviewGate, with its key in the key query parameter. The key is answered
+// with a cookie, and the window is sent on to the UI.
+const WebviewPath = "/ui/webview"
+
+// WebviewGate guards the plain-HTTP loopback listener the desktop window uses
+// when the server has TLS, whose self-signed certificate the webview cannot
+// accept. Any local process can connect to that listener, so next only gets
+// the requests of the window, which alone is given key, and signed links,
+// e.g. those of player windows. Others get 403, so that the listener is no
+// way around client-certificate authentication.
+func WebviewGate(key string, signer *services.URLSigner, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == WebviewPath {
+			if !tokenMatches(r.URL.Query().Get("key"), key) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: webviewCookieName, Value: key, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+			http.Redirect(w, r, "/ui/index.html", http.StatusSeeOther)
+			return
+		}
+		if cookie, err := r.Cookie(webviewCookieName); err == nil && tokenMatches(cookie.Value, key) {
+			next(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && signer.Valid(r.URL) {
+			next(w, r)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}
+}
@@ -0,0 +1,116 @@
+package harness
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// fixtures are golden recordings: WebM files laid out as MediaRecorder writes
+// them, with clusters of unknown size. Their frames are not real video, the
+// stub FFmpeg never decodes them.
+//
+//go:embed fixtures/*.webm
+var fixtures embed.FS
+
+// Fixtures returns the names of the golden recordings, e.g. "vp8-5s.webm".
+func Fixtures() []string {
+	entries, _ := fs.ReadDir(fixtures, "fixtures")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// FixtureFile returns the golden recording name whole, as the file of a
+// recording made of all of its chunks should be.
+func FixtureFile(name string) ([]byte, error) {
+	return fixtures.ReadFile(path.Join("fixtures", name))
+}
+
+// Fixture returns the golden recording name in chunks as the extension sends
+// them: the first with the header and the first cluster, then a cluster
+// each.
+func Fixture(name string) ([][]byte, error) {
+	data, err := FixtureFile(name)
+	if err != nil {
+		return nil, err
+	}
+	clusters, err := clusterOffsets(data)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", name, err)
+	}
+	var chunks [][]byte
+	start := 0
+	// The header goes with the first cluster
+	for i := 1; i < len(clusters); i++ {
+		chunks = append(chunks, data[start:clusters[i]])
+		start = clusters[i]
+	}
+	return append(chunks, data[start:]), nil
+}
+
+// IDs of the WebM elements clusterOffsets looks at.
+const (
+	segmentID = 0x18538067
+	clusterID = 0x1F43B675
+)
+
+// clusterOffsets returns where each cluster of the WebM file data starts.
+func clusterOffsets(data []byte) ([]int, error) {
+	var offsets []int
+	for pos := 0; pos < len(data); {
+		id, idLen, err := readVint(data[pos:], false)
+		if err != nil {
+			return nil, err
+		}
+		size, sizeLen, err := readVint(data[pos+idLen:], true)
+		if err != nil {
+			return nil, err
+		}
+		if id == clusterID {
+			offsets = append(offsets, pos)
+		}
+		// The segment and clusters of unknown size are read into, the other
+		// elements skipped
+		if id == segmentID || id == clusterID || size < 0 {
+			pos += idLen + sizeLen
+			continue
+		}
+		pos += idLen + sizeLen + int(size)
+	}
+	return offsets, nil
+}
+
+// readVint reads an EBML variable size integer at the start of buf: an
+// element ID, with its length marker, or a size, without it and -1 when it
+// is unknown.
+func readVint(buf []byte, isSize bool) (value int64, n int, err error) {
+	if len(buf) == 0 {
+		return 0, 0, fmt.Errorf("truncated WebM element")
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && buf[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(buf) < length {
+		return 0, 0, fmt.Errorf("invalid WebM element")
+	}
+	unknown := isSize
+	for i := 0; i < length; i++ {
+		b := buf[i]
+		if i == 0 && isSize {
+			b &= 0xFF >> length
+			unknown = b == 0xFF>>length
+		} else if isSize {
+			unknown = unknown && b == 0xFF
+		}
+		value = value<<8 | int64(b)
+	}
+	if unknown {
+		return -1, length, nil
+	}
+	return value, length, nil
+}
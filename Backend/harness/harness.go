@@ -0,0 +1,288 @@
+// Package harness runs the recording pipeline of the server end to end, from
+// the recordings handler through the recorder and the file writer to
+// post-processing, with a stub FFmpeg, for tests of how chunks are ordered
+// into files, how recordings are finished and how they are resumed after a
+// crash. Recordings are sent as the extension sends them, over HTTP, and can
+// be made of the golden WebM files in fixtures (see Fixture).
+package harness
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"recorder/handlers"
+	"recorder/models"
+	"recorder/services"
+)
+
+// Harness is a recording server over a folder of its own. Its services are
+// exported for the checks a test makes beyond what the HTTP API tells.
+type Harness struct {
+	// Dir holds the recordings in Dir/recordings, the session journal and
+	// history in Dir/config and the stub FFmpeg in Dir/bin.
+	Dir        string
+	Server     *httptest.Server
+	Recorder   *services.RecorderService
+	FileWriter *services.FileWriterService
+	ffmpeg     string
+	stats      *services.Stats
+	timeSeries *services.TimeSeriesStore
+	// running is false after Close or Crash, until Restart.
+	running bool
+	// sequences is the number of the last chunk Stream sent of each file,
+	// by tab and timestamp, which like the extension's survive a restart.
+	sequences map[string]int64
+	mu        sync.Mutex
+}
+
+// New starts a Harness over dir, which should be empty, e.g. the TempDir of
+// a test.
+func New(dir string) (*Harness, error) {
+	bin := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		return nil, err
+	}
+	h := &Harness{Dir: dir, ffmpeg: filepath.Join(bin, "ffmpeg"), sequences: make(map[string]int64)}
+	script := stubFFmpegUnix
+	if runtime.GOOS == "windows" {
+		h.ffmpeg += ".cmd"
+		script = stubFFmpegWindows
+	}
+	if err := os.WriteFile(h.ffmpeg, []byte(script), 0755); err != nil {
+		return nil, fmt.Errorf("failed to write the stub FFmpeg: %w", err)
+	}
+	if err := h.start(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// start creates the services over h.Dir, resuming the recordings in its
+// session journal, and serves them.
+func (h *Harness) start() error {
+	downloads := filepath.Join(h.Dir, "recordings")
+	config := filepath.Join(h.Dir, "config")
+	if err := os.MkdirAll(config, 0755); err != nil {
+		return err
+	}
+	postProcessor, err := services.NewPostProcessor(h.ffmpeg)
+	if err != nil {
+		return err
+	}
+	h.Server = nil
+	h.stats = services.NewStats(downloads)
+	h.timeSeries = services.NewTimeSeriesStore()
+	h.FileWriter = services.NewFileWriterService(downloads, h.stats, postProcessor)
+	h.Recorder = services.NewRecorderService(h.FileWriter, h.stats, h.timeSeries)
+	h.running = true
+	if err := h.FileWriter.LoadSessionJournal(filepath.Join(config, "sessions.json")); err != nil {
+		h.Close()
+		return err
+	}
+	if err := h.FileWriter.LoadSessionHistory(filepath.Join(config, "history.json")); err != nil {
+		h.Close()
+		return err
+	}
+
+	// Requests are not rate limited, a test sends them as fast as it can
+	recordings := handlers.NewRecordingsHandler(h.Recorder, nil, services.NewRateLimiter(1e6, 1e6))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/recordings", recordings.Handle)
+	mux.HandleFunc("/api/recordings/stop", recordings.HandleStop)
+	mux.HandleFunc("/api/recordings/{session}/stop", recordings.HandleStopSession)
+	mux.HandleFunc("/api/recordings/{session}/split", recordings.HandleSplitSession)
+	mux.HandleFunc("/api/recordings/{session}/markers", recordings.HandleMarkers)
+	mux.HandleFunc("/api/recordings/{session}/recover", recordings.HandleRecover)
+	h.Server = httptest.NewServer(handlers.RequestIDMiddleware(mux.ServeHTTP))
+	return nil
+}
+
+// Close finishes the recordings still being written, as the server does when
+// it shuts down, and stops serving. It does nothing after Crash.
+func (h *Harness) Close() {
+	if !h.running {
+		return
+	}
+	h.running = false
+	if h.Server != nil {
+		h.Server.Close()
+	}
+	h.FileWriter.CloseAll()
+	h.stop()
+}
+
+// Crash stops the server as a crash would: the recordings being written are
+// left unfinished, with what was not flushed to their files lost, and their
+// journal is left behind. Restart starts it again.
+func (h *Harness) Crash() {
+	if !h.running {
+		return
+	}
+	h.running = false
+	h.Server.CloseClientConnections()
+	h.Server.Close()
+	h.FileWriter.Abandon()
+	h.stop()
+}
+
+// stop ends the background work of the services.
+func (h *Harness) stop() {
+	h.stats.Stop()
+	h.timeSeries.Stop()
+}
+
+// Restart starts the server again over the same folder after Crash or Close,
+// with new services that resume the recordings in the session journal.
+func (h *Harness) Restart() error {
+	if h.running {
+		return fmt.Errorf("the server is running, Crash or Close it first")
+	}
+	return h.start()
+}
+
+// Send posts data to /api/recordings as the extension does, with chunk as
+// its data, and returns the status of the answer with its body.
+func (h *Harness) Send(data models.RecordingData, chunk []byte) (int, string, error) {
+	if chunk != nil {
+		data.Data = base64.StdEncoding.EncodeToString(chunk)
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return 0, "", err
+	}
+	return h.post("/api/recordings", body)
+}
+
+// Stream sends chunks as the recording tabID started at timestamp, named
+// name, one after another, and fails on the first one not accepted. Like the
+// extension, it numbers the chunks of the recording from 1 on, carrying on
+// from those it sent earlier.
+func (h *Harness) Stream(tabID int, timestamp int64, name string, chunks [][]byte) error {
+	for i, chunk := range chunks {
+		data := models.RecordingData{Name: name, TabID: tabID, Timestamp: timestamp, Status: "stream", Sequence: h.nextSequence(tabID, timestamp)}
+		status, body, err := h.Send(data, chunk)
+		if err != nil {
+			return fmt.Errorf("chunk %d of tab %d: %w", i, tabID, err)
+		}
+		if status != http.StatusAccepted {
+			return fmt.Errorf("chunk %d of tab %d: %d %s", i, tabID, status, strings.TrimSpace(body))
+		}
+	}
+	return nil
+}
+
+// nextSequence returns the number of the next chunk of the recording tabID
+// started at timestamp.
+func (h *Harness) nextSequence(tabID int, timestamp int64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := fmt.Sprintf("%d:%d", tabID, timestamp)
+	h.sequences[key]++
+	return h.sequences[key]
+}
+
+// Stop ends the recording tabID started at timestamp, as the extension does
+// once it sent chunks chunks of size bytes in all, and returns once the file
+// was post-processed and added to the history.
+func (h *Harness) Stop(tabID int, timestamp int64, chunks int, size int64) error {
+	data := models.RecordingData{TabID: tabID, Timestamp: timestamp, Status: "stopped", ChunksSent: chunks, BytesSent: size}
+	status, body, err := h.Send(data, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusAccepted {
+		return fmt.Errorf("stopping tab %d: %d %s", tabID, status, strings.TrimSpace(body))
+	}
+	return nil
+}
+
+// Finished returns the history of the recordings finished, newest first.
+func (h *Harness) Finished() []services.FinishedRecording {
+	return h.FileWriter.Finished()
+}
+
+// StopAll stops every recording from the server, as the UI does.
+func (h *Harness) StopAll() int {
+	return h.Recorder.StopAll(context.Background())
+}
+
+// FFmpegCalls returns the arguments of each run of the stub FFmpeg by
+// post-processing, oldest first.
+func (h *Harness) FFmpegCalls() ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(h.ffmpeg), "ffmpeg.log"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n"), nil
+}
+
+// FailFFmpeg makes the stub FFmpeg fail post-processing while fail is set.
+func (h *Harness) FailFFmpeg(fail bool) error {
+	marker := filepath.Join(filepath.Dir(h.ffmpeg), "ffmpeg.fail")
+	if !fail {
+		if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(marker, nil, 0644)
+}
+
+func (h *Harness) post(path string, body []byte) (int, string, error) {
+	resp, err := http.Post(h.Server.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	answer, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(answer), err
+}
+
+// stubFFmpegUnix stands in for FFmpeg: it reports a version and copies the
+// first input of a post-processing run to its output, which is the last
+// argument, logging the arguments to ffmpeg.log next to it. It fails while
+// ffmpeg.fail is there.
+const stubFFmpegUnix = `#!/bin/sh
+if [ "$1" = "-version" ]; then
+	echo "ffmpeg version 6.1-harness"
+	exit 0
+fi
+dir=$(dirname "$0")
+echo "$*" >> "$dir/ffmpeg.log"
+[ -e "$dir/ffmpeg.fail" ] && exit 1
+in=""; prev=""; out=""
+for arg in "$@"; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in=$arg; fi
+	prev=$arg; out=$arg
+done
+exec cp "$in" "$out"
+`
+
+// stubFFmpegWindows is stubFFmpegUnix as a batch file.
+const stubFFmpegWindows = "@echo off\r\n" +
+	"if \"%~1\"==\"-version\" (echo ffmpeg version 6.1-harness& exit /b 0)\r\n" +
+	"echo %*>> \"%~dp0ffmpeg.log\"\r\n" +
+	"if exist \"%~dp0ffmpeg.fail\" exit /b 1\r\n" +
+	"set \"in=\"\r\n" +
+	":next\r\n" +
+	"if \"%~1\"==\"\" goto copy\r\n" +
+	"if \"%~1\"==\"-i\" if not defined in set \"in=%~2\"\r\n" +
+	"set \"out=%~1\"\r\n" +
+	"shift\r\n" +
+	"goto next\r\n" +
+	":copy\r\n" +
+	"copy /y \"%in%\" \"%out%\" >nul\r\n"
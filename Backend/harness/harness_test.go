@@ -0,0 +1,234 @@
+package harness_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"recorder/harness"
+	"recorder/models"
+	"recorder/services"
+)
+
+const fixture = "vp8-5s.webm"
+
+func newHarness(t *testing.T) *harness.Harness {
+	t.Helper()
+	h, err := harness.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+func loadFixture(t *testing.T) (chunks [][]byte, whole []byte) {
+	t.Helper()
+	chunks, err := harness.Fixture(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err = harness.FixtureFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("fixture %s has %d chunks, want at least 3", fixture, len(chunks))
+	}
+	return chunks, whole
+}
+
+// finished returns the only recording in the history and its file.
+func finished(t *testing.T, h *harness.Harness) (services.FinishedRecording, []byte) {
+	t.Helper()
+	recordings := h.Finished()
+	if len(recordings) != 1 {
+		t.Fatalf("%d recordings finished, want 1", len(recordings))
+	}
+	data, err := os.ReadFile(recordings[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recordings[0], data
+}
+
+func TestChunksInOrder(t *testing.T) {
+	h := newHarness(t)
+	chunks, whole := loadFixture(t)
+	timestamp := time.Now().UnixMilli()
+
+	if err := h.Stream(1, timestamp, "tab", chunks); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Stop(1, timestamp, len(chunks), int64(len(whole))); err != nil {
+		t.Fatal(err)
+	}
+
+	recording, data := finished(t, h)
+	if !bytes.Equal(data, whole) {
+		t.Errorf("file has %d bytes that differ from the %d of %s", len(data), len(whole), fixture)
+	}
+	if recording.PostProcessing != services.PostProcessingDone || recording.Outcome != services.SessionCompleted {
+		t.Errorf("post-processing %s, outcome %s, want %s and %s", recording.PostProcessing, recording.Outcome, services.PostProcessingDone, services.SessionCompleted)
+	}
+	if recording.Verification.Verdict != services.VerificationPassed {
+		t.Errorf("verdict %s, want %s: %v", recording.Verification.Verdict, services.VerificationPassed, recording.Verification.Problems)
+	}
+	calls, err := h.FFmpegCalls()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("FFmpeg ran %d times, want once: %q", len(calls), calls)
+	}
+}
+
+// Chunks sent at the same time, in any order, are written in the order of
+// their sequence numbers.
+func TestParallelChunks(t *testing.T) {
+	h := newHarness(t)
+	chunks, whole := loadFixture(t)
+
+	for run := 1; run <= 5; run++ {
+		tabID, timestamp := run, time.Now().UnixMilli()
+		var wg sync.WaitGroup
+		errs := make(chan error, len(chunks))
+		// Last first, so that every chunk but the first arrives early
+		for i := len(chunks) - 1; i >= 0; i-- {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				data := models.RecordingData{Name: fmt.Sprintf("run-%d", run), TabID: tabID, Timestamp: timestamp, Status: "stream", Sequence: int64(i + 1)}
+				status, body, err := h.Send(data, chunks[i])
+				if err == nil && status != http.StatusAccepted {
+					err = fmt.Errorf("chunk %d: %d %s", i+1, status, body)
+				}
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.Stop(tabID, timestamp, len(chunks), int64(len(whole))); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(h.Finished()[0].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, whole) {
+			t.Errorf("run %d: file differs from %s", run, fixture)
+		}
+	}
+}
+
+// Many more chunks than the write queue holds, sent at once to one
+// recording, are all written.
+func TestManyConcurrentChunks(t *testing.T) {
+	h := newHarness(t)
+	const count = 200
+	chunk := bytes.Repeat([]byte{0x42}, 4096)
+	timestamp := time.Now().UnixMilli()
+
+	done := make(chan error, count)
+	for i := 0; i < count; i++ {
+		go func() {
+			data := models.RecordingData{Name: "busy", TabID: 1, Timestamp: timestamp, Status: "stream"}
+			status, body, err := h.Send(data, chunk)
+			if err == nil && status != http.StatusAccepted {
+				err = fmt.Errorf("%d %s", status, body)
+			}
+			done <- err
+		}()
+	}
+	timeout := time.After(30 * time.Second)
+	for i := 0; i < count; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatalf("%d of %d chunks were written before the timeout", i, count)
+		}
+	}
+	if err := h.Stop(1, timestamp, count, count*int64(len(chunk))); err != nil {
+		t.Fatal(err)
+	}
+	if _, data := finished(t, h); len(data) != count*len(chunk) {
+		t.Errorf("file has %d bytes, want %d", len(data), count*len(chunk))
+	}
+}
+
+func TestPostProcessingFailure(t *testing.T) {
+	h := newHarness(t)
+	chunks, whole := loadFixture(t)
+	timestamp := time.Now().UnixMilli()
+	if err := h.FailFFmpeg(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Stream(1, timestamp, "tab", chunks); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Stop(1, timestamp, len(chunks), int64(len(whole))); err != nil {
+		t.Fatal(err)
+	}
+
+	recording, data := finished(t, h)
+	if recording.PostProcessing != services.PostProcessingFailed || recording.Outcome != services.SessionFailed {
+		t.Errorf("post-processing %s, outcome %s, want %s and %s", recording.PostProcessing, recording.Outcome, services.PostProcessingFailed, services.SessionFailed)
+	}
+	if recording.Error == "" {
+		t.Error("the recording has no error")
+	}
+	// The recording is kept as it was received
+	if !bytes.Equal(data, whole) {
+		t.Errorf("file differs from %s", fixture)
+	}
+}
+
+func TestResumeAfterCrash(t *testing.T) {
+	h := newHarness(t)
+	chunks, whole := loadFixture(t)
+	timestamp := time.Now().UnixMilli()
+	before, after := chunks[:2], chunks[2:]
+
+	if err := h.Stream(1, timestamp, "tab", before); err != nil {
+		t.Fatal(err)
+	}
+	h.Crash()
+	files, err := filepath.Glob(filepath.Join(h.Dir, "recordings", "*.webm"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("%d files after the crash, want 1 (%v)", len(files), err)
+	}
+	if err := h.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Stream(1, timestamp, "tab", after); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Stop(1, timestamp, len(chunks), int64(len(whole))); err != nil {
+		t.Fatal(err)
+	}
+
+	recording, data := finished(t, h)
+	if want, _ := filepath.Abs(files[0]); recording.Path != want {
+		t.Errorf("recording finished in %s, want it resumed into %s", recording.Path, want)
+	}
+	// What was not flushed before the crash is lost; the rest of the
+	// recording follows what was
+	rest := bytes.Join(after, nil)
+	if !bytes.HasSuffix(data, rest) || !bytes.HasPrefix(whole, data[:len(data)-len(rest)]) {
+		t.Errorf("file of %d bytes is not the start of %s followed by the chunks sent after the crash", len(data), fixture)
+	}
+}
@@ -1,5 +1,5 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !headless
+// +build !windows,!headless
 
 package main
 
@@ -1,28 +1,104 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"recorder/handlers"
 	"recorder/services"
-
-	"github.com/sqweek/dialog"
-	webview "github.com/webview/webview_go"
 )
 
 //go:embed ui/*
 var uiFiles embed.FS
 
-const (
+// Directories default to the working directory and can be changed with
+// RECORDINGS_DIR, LOG_DIR and CONFIG_DIR or the [paths] section of the config file.
+// In portable mode relative paths are relative to the executable instead, and
+// in container mode the defaults are under /data.
+var (
 	downloadDir = "./recordings"
 	logDir      = "./logs"
+	configDir   = "./config"
+	portableDir string
+)
+
+var (
+	// configFile is the config file in use, or nil when there is none.
+	configFile *services.ConfigFile
+	// settings holds the changes made from the UI, kept in config/settings.json.
+	settings *services.SettingsStore
+	// secrets keeps the API token and the saved settings that hold
+	// credentials, in the OS credential store unless the app is portable.
+	secrets services.SecretStore
 )
 
+// loadConfig applies the config file, if any, and then the saved settings to
+// the environment and resolves the directories. It runs before the logger
+// exists, so it only returns what to log.
+func loadConfig() (fromFile, fromSettings []string, err error) {
+	portableDir, err = services.PortableDir(*portableFlag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("portable mode: %w", err)
+	}
+
+	if path := services.FindConfigFile(portableDir); path != "" {
+		file, err := services.LoadConfigFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		fromFile = file.Apply()
+		configFile = file
+	}
+	if services.ContainerMode() {
+		downloadDir = filepath.Join(services.ContainerDataDir, "recordings")
+		logDir = filepath.Join(services.ContainerDataDir, "logs")
+		configDir = filepath.Join(services.ContainerDataDir, "config")
+	}
+
+	if dir := os.Getenv("CONFIG_DIR"); dir != "" {
+		configDir = dir
+	}
+	configDir = resolvePath(configDir)
+	settings, err = services.LoadSettingsStore(filepath.Join(configDir, "settings.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	fromSettings = settings.Apply(configFile)
+
+	if dir := os.Getenv("RECORDINGS_DIR"); dir != "" {
+		downloadDir = dir
+	}
+	if dir := os.Getenv("LOG_DIR"); dir != "" {
+		logDir = dir
+	}
+	downloadDir, logDir = resolvePath(downloadDir), resolvePath(logDir)
+	return fromFile, fromSettings, nil
+}
+
+// resolvePath makes a relative path relative to the executable in portable mode.
+func resolvePath(path string) string {
+	if portableDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(portableDir, path)
+}
+
 func getFFmpegPath() string {
 	if path := os.Getenv("FFMPEG_PATH"); path != "" {
 		return path
@@ -30,6 +106,46 @@ func getFFmpegPath() string {
 	return "ffmpeg"
 }
 
+// getFFprobePath returns FFPROBE_PATH, or else the ffprobe that goes with the
+// ffmpeg of postProcessor, or "" when there is none.
+func getFFprobePath(postProcessor *services.PostProcessor) string {
+	if path := os.Getenv("FFPROBE_PATH"); path != "" {
+		return path
+	}
+	return postProcessor.FFprobePath()
+}
+
+// useFFmpeg detects the FFmpeg dependencies is configured with and the
+// ffprobe that goes with it, e.g. once they are installed or when the path
+// changed, and post-processes the recordings finished from now on with them.
+func useFFmpeg(dependencies *services.DependencyRegistry) error {
+	ffmpegPath := dependencies.FFmpegPath()
+	ffmpeg := dependencies.Detect(services.DependencyFFmpeg, ffmpegPath)
+	if !ffmpeg.Installed {
+		return fmt.Errorf("FFmpeg is still not available (%s) - set its path or re-detect it once it is installed", ffmpeg.Error)
+	}
+	postProcessor := fileWriter.GetPostProcessor()
+	if postProcessor == nil || postProcessor.FFmpegPath() != ffmpegPath {
+		enabled := postProcessor == nil
+		var err error
+		if postProcessor, err = services.NewPostProcessor(ffmpegPath); err != nil {
+			return err
+		}
+		fileWriter.SetPostProcessor(postProcessor)
+		if enabled {
+			services.LogInfo("Post-processing enabled - videos will have proper duration metadata")
+		}
+		services.LogInfo("Restart the application to stream recordings live and convert them for casting")
+	}
+	ffprobe := dependencies.Detect(services.DependencyFFprobe, getFFprobePath(postProcessor))
+	if ffprobe.Installed {
+		postProcessor.SetFFprobePath(ffprobe.Path)
+	} else {
+		services.LogInfo("Recordings will be verified without reading their duration - install ffprobe to enable it")
+	}
+	return nil
+}
+
 func getServerPort() string {
 	if port := os.Getenv("SERVER_PORT"); port != "" {
 		return port
@@ -37,119 +153,1055 @@ func getServerPort() string {
 	return "8080"
 }
 
+// getBindAddress returns the interface to listen on: the -bind flag, then
+// BIND_ADDRESS, then loopback only. Use 0.0.0.0 to accept LAN connections.
+// In container mode the default is 0.0.0.0, as loopback inside a container
+// cannot be reached through a published port.
+func getBindAddress(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if addr := os.Getenv("BIND_ADDRESS"); addr != "" {
+		return addr
+	}
+	if services.ContainerMode() {
+		return "0.0.0.0"
+	}
+	return "127.0.0.1"
+}
+
+// getSocketPath returns the Unix domain socket to serve the API on instead of TCP:
+// the -socket flag, then LISTEN_SOCKET. Empty means TCP.
+func getSocketPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("LISTEN_SOCKET")
+}
+
+// localHost returns a host name that reaches a server bound to bind from this machine.
+func localHost(bind string) string {
+	if ip := net.ParseIP(bind); ip != nil && ip.IsUnspecified() {
+		return "localhost"
+	}
+	return bind
+}
+
+// lanBaseURL returns the URL other devices on the network can use to reach the
+// server, or "" when it only listens on loopback or a Unix socket.
+func lanBaseURL(bind, port string, tlsEnabled bool) string {
+	scheme := "http"
+	if tlsEnabled {
+		scheme = "https"
+	}
+
+	ip := net.ParseIP(bind)
+	if ip == nil || ip.IsLoopback() {
+		return ""
+	}
+	if !ip.IsUnspecified() {
+		return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(bind, port))
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+			return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ipNet.IP.String(), port))
+		}
+	}
+	return ""
+}
+
+// shutdownTimeout bounds how long a headless server waits for requests in
+// flight when asked to stop; Docker kills the process after 10 seconds.
+const shutdownTimeout = 8 * time.Second
+
+// Clients that are slow to send their headers, or leave a connection idle, are
+// cut off after these. There is no write timeout, as the event streams stay
+// open for as long as the client listens.
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
 var (
 	serverStarted = make(chan bool, 1)
 	fileWriter    *services.FileWriterService
+	profiles      *services.ProfileStore
+	// notifier shows desktop notifications; nil when there is no desktop.
+	notifier *services.DesktopNotifier
+	// webhooks posts recording events to the URLs in [webhooks].
+	webhooks *services.WebhookDispatcher
+	// hooks runs the commands in [hooks] at points of a recording.
+	hooks *services.HookRunner
+	// liveStreams streams recordings over HLS; nil without FFmpeg.
+	liveStreams *services.LiveStreams
+	// urlSigner signs download links; shareBaseURL is where the links that
+	// the desktop window copies for others point.
+	urlSigner    *services.URLSigner
+	shareBaseURL string
 )
 
 func main() {
+	command, args := parseCommandLine()
+	envApplied, envUnknown := services.ApplyRecorderEnv()
+	applyFlagOverrides()
+
+	configApplied, settingsApplied, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 	if err := services.InitLogger(logDir); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
-	defer services.CloseLogger()
+	services.SetLogLevelFromEnv()
+	if portableDir != "" {
+		services.LogInfo("Portable mode: keeping data in %s", portableDir)
+	}
+	if len(envApplied) > 0 {
+		services.LogInfo("Environment overrides: %s", strings.Join(envApplied, ", "))
+	}
+	if len(envUnknown) > 0 {
+		services.LogError("Ignoring unknown environment variables: %s", strings.Join(envUnknown, ", "))
+	}
+	if configFile != nil {
+		services.LogInfo("Loaded config file %s (settings: %s)", configFile.Path, strings.Join(configApplied, ", "))
+	}
+	secrets = services.NewSecretStore(configDir)
+	if portableDir != "" {
+		// The OS credential store stays behind when the app moves to another machine.
+		secrets = services.NewFileSecretStore(configDir)
+	}
+	fromSecrets, err := settings.UseSecretStore(secrets, configFile)
+	if err != nil {
+		log.Fatalf("Failed to load saved credentials: %v", err)
+	}
+	settingsApplied = append(settingsApplied, fromSecrets...)
+	if len(settingsApplied) > 0 {
+		services.LogInfo("Applied saved settings: %s", strings.Join(settingsApplied, ", "))
+	}
+
+	code := command.run(args)
+	services.CloseLogger()
+	os.Exit(code)
+}
+
+// runServe implements the "serve" command, the default: it runs the recording
+// server and, unless --headless is given, the desktop window. Headless, it
+// shuts down gracefully on SIGINT or SIGTERM.
+func runServe(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "serve: unexpected arguments %v\n", args)
+		return 2
+	}
+
+	if updated, err := services.ApplyStagedUpdate(); err != nil {
+		services.LogError("[UPDATE] %v", err)
+	} else if updated {
+		services.LogInfo("[UPDATE] Installed update, restarting")
+		if err := services.RestartExecutable(); err != nil {
+			services.LogError("[UPDATE] %v", err)
+		} else {
+			return 0
+		}
+	}
 
+	instance, err := services.AcquireInstanceLock(configDir)
+	if errors.Is(err, services.ErrInstanceRunning) {
+		focused, err := services.FocusRunningInstance(configDir)
+		switch {
+		case err != nil:
+			services.LogError("Another instance is running but did not respond: %v", err)
+			return 1
+		case focused:
+			services.LogInfo("Already running; switched to the existing window")
+		default:
+			services.LogInfo("Already running in the background")
+		}
+		return 0
+	} else if err != nil {
+		services.LogError("Failed to check for other instances: %v", err)
+	}
+	defer instance.Release()
+
+	bindAddress := getBindAddress(*bindFlag)
 	serverPort := getServerPort()
+	serverAddr := net.JoinHostPort(bindAddress, serverPort)
+	socketPath := getSocketPath(*socketFlag)
+	if socketPath != "" {
+		serverAddr = socketPath
+	}
 	ffmpegPath := getFFmpegPath()
+	services.UseManagedFFmpeg()
 	
-	services.LogInfo("Application starting...")
-	services.LogInfo("Server port: %s", serverPort)
+	services.LogInfo("Application starting... (version %s, commit %s)", services.Version, services.BuildCommit())
+	services.LogInfo("Server address: %s", serverAddr)
 	services.LogInfo("Log directory: %s", logDir)
 	services.LogInfo("Recordings directory: %s", downloadDir)
 	services.LogInfo("FFmpeg path: %s", ffmpegPath)
 
 	postProcessor, err := services.NewPostProcessor(ffmpegPath)
-	if err != nil {
+	installFFmpeg := false
+	if err != nil && services.ContainerMode() {
 		services.LogInfo("FFmpeg not available: %v", err)
-		
-		installer := services.NewFFmpegInstaller()
-		services.LogInfo("Attempting automatic FFmpeg installation...")
-		
-		if installErr := installer.AttemptInstall(); installErr != nil {
-			services.LogError("Automatic installation failed: %v", installErr)
-			services.LogInfo("Post-processing disabled - videos will not have proper duration metadata")
-			services.LogInfo("Please install FFmpeg manually from: https://ffmpeg.org/download.html")
-			postProcessor = nil
-		} else {
-			services.LogInfo("FFmpeg installed successfully!")
-			services.LogInfo("Attempting to initialize post-processor again...")
-			
-			postProcessor, err = services.NewPostProcessor(ffmpegPath)
-			if err != nil {
-				services.LogInfo("Post-processor initialization still failed: %v", err)
-				services.LogInfo("You may need to restart the application for PATH changes to take effect")
-				postProcessor = nil
-			} else {
-				services.LogInfo("Post-processing enabled - videos will have proper duration metadata")
-			}
-		}
+		services.LogInfo("Post-processing disabled - add ffmpeg to the image to enable it")
+	} else if err != nil {
+		services.LogInfo("FFmpeg not available: %v", err)
+		services.LogInfo("Installing FFmpeg in the background - post-processing starts once it is installed")
+		installFFmpeg = true
 	} else {
 		services.LogInfo("Post-processing enabled - videos will have proper duration metadata")
 	}
 
 	stats := services.NewStats(downloadDir)
 	fileWriter = services.NewFileWriterService(downloadDir, stats, postProcessor)
-	recorder := services.NewRecorderService(fileWriter, stats)
+	jobs := services.NewJobStore()
+	dependencies := services.NewDependencyRegistry(ffmpegPath)
+	installer := services.NewFFmpegInstaller()
+	// installDependency installs FFmpeg or ffprobe as a job, and uses it for
+	// the recordings finished once it is installed.
+	installDependency := func(name string) services.Job {
+		return installer.StartInstall(jobs, name, func() (string, error) {
+			if err := useFFmpeg(dependencies); err != nil {
+				return "", err
+			}
+			if dependency := dependencies.Get(name); !dependency.Installed {
+				return "", fmt.Errorf("%s is still not available: %s", name, dependency.Error)
+			}
+			return dependencies.Get(services.DependencyFFmpeg).Path, nil
+		})
+	}
+	// upgradeFFmpeg replaces the static build of FFmpeg the server installed
+	// with the latest one, as a job.
+	upgradeFFmpeg := func() services.Job {
+		return installer.StartUpgrade(jobs, func() (string, error) {
+			if err := useFFmpeg(dependencies); err != nil {
+				return "", err
+			}
+			ffmpeg := dependencies.Get(services.DependencyFFmpeg)
+			if ffmpeg.Outdated {
+				return "", fmt.Errorf("ffmpeg %s is still older than %s", ffmpeg.Version, services.MinFFmpegVersion)
+			}
+			return ffmpeg.Path, nil
+		})
+	}
+	// configureFFmpeg uses the ffmpeg at path, or the one on the PATH when
+	// it is empty, from now on and saves it to the settings.
+	configureFFmpeg := func(path string) error {
+		if path == "" {
+			path = "ffmpeg"
+		}
+		previous := dependencies.FFmpegPath()
+		dependencies.SetFFmpegPath(path)
+		if err := useFFmpeg(dependencies); err != nil {
+			dependencies.SetFFmpegPath(previous)
+			useFFmpeg(dependencies)
+			return err
+		}
+		os.Setenv("FFMPEG_PATH", path)
+		return settings.Save(map[string]string{"ffmpeg.path": path})
+	}
+	// redetectFFmpeg looks for FFmpeg and ffprobe again, on a PATH brought up
+	// to date, once they were installed while the server runs.
+	redetectFFmpeg := func() []services.Dependency {
+		services.RescanPath()
+		useFFmpeg(dependencies)
+		return dependencies.List()
+	}
+	if installFFmpeg {
+		dependencies.Detect(services.DependencyFFmpeg, ffmpegPath)
+		installDependency(services.DependencyFFmpeg)
+	} else if postProcessor != nil {
+		useFFmpeg(dependencies)
+		if !dependencies.Get(services.DependencyFFprobe).Installed && !services.ContainerMode() {
+			installDependency(services.DependencyFFprobe)
+		}
+	} else {
+		dependencies.Detect(services.DependencyFFmpeg, ffmpegPath)
+	}
+	clock, err := services.LoadClockFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure time settings: %v", err)
+	}
+	fileWriter.SetClock(clock)
+	if postProcessor != nil {
+		liveStreams = services.NewLiveStreams(postProcessor.FFmpegPath(), services.HLSOutputEnabled())
+		fileWriter.SetLiveStreams(liveStreams)
+	} else if services.HLSOutputEnabled() {
+		services.LogInfo("Live HLS output disabled - it needs FFmpeg")
+	}
+	if err := fileWriter.LoadSessionJournal(filepath.Join(configDir, "sessions.json")); err != nil {
+		services.LogError("Failed to load the session journal, interrupted recordings will not be resumed: %v", err)
+	}
+	if err := fileWriter.LoadSessionHistory(filepath.Join(configDir, "history.json")); err != nil {
+		services.LogError("Failed to load the session history: %v", err)
+	}
+	profiles, err = services.LoadProfileStore(filepath.Join(configDir, "profiles.json"), fileWriter)
+	if err != nil {
+		log.Fatalf("Failed to load profiles: %v", err)
+	}
+	profiles.Start()
+	defer profiles.Stop()
+	recorder := services.NewRecorderService(fileWriter, stats, services.NewTimeSeriesStore())
+	services.InitCrashReporter(logDir, recorder)
+	defer services.CapturePanic()
+	alerts := services.NewAlertService(recorder, fileWriter, services.LoadAlertRulesFromEnv())
+	if !services.ContainerMode() {
+		notifier = services.NewDesktopNotifier(services.LoadNotificationEventsFromEnv())
+	}
+	if notifier != nil {
+		recorder.SetNotifier(notifier)
+		fileWriter.SetNotifier(notifier)
+		alerts.AddNotifier(notifier)
+	}
+	webhooks = services.NewWebhookDispatcher(services.LoadWebhookConfigFromEnv())
+	recorder.SetWebhooks(webhooks)
+	fileWriter.SetWebhooks(webhooks)
+	hooks = services.NewHookRunner(services.LoadHookConfigFromEnv())
+	recorder.SetHooks(hooks)
+	fileWriter.SetHooks(hooks)
+	alerts.Start()
+	recorder.SetIdleTimeout(services.LoadIdleTimeoutFromEnv())
+	recorder.SetMaxSessions(services.LoadMaxSessionsFromEnv())
+	recorder.SetRecoveryPolicy(services.LoadRecoveryPolicyFromEnv())
+	fileWriter.SetPostProcessingJobs(services.LoadPostProcessingJobsFromEnv())
+	fileWriter.SetMaxFileSize(services.LoadMaxFileSizeFromEnv())
+	recorder.StartIdleCheck()
+	defer recorder.StopIdleCheck()
+	schedules, err := services.LoadScheduleStore(filepath.Join(configDir, "schedules.json"), recorder)
+	if err != nil {
+		log.Fatalf("Failed to load schedules: %v", err)
+	}
+	captures := services.NewCaptureAgent(recorder, services.LoadCaptureBrowserFromEnv())
+	if services.LoadCaptureBrowserFromEnv() != "" && !captures.Available() {
+		services.LogInfo("[CAPTURE] Headless capture disabled - it needs FFmpeg")
+	}
+	schedules.SetCaptureAgent(captures)
+	recorder.SetCaptureAgent(captures)
+	schedules.Start()
+	defer schedules.Stop()
+
+	var updater *services.Updater
+	if services.ContainerMode() {
+		services.LogInfo("[UPDATE] Updates disabled in container mode; pull a new image instead")
+	} else if updater, err = services.NewUpdater(); err != nil {
+		services.LogError("[UPDATE] Updates disabled: %v", err)
+	} else {
+		updater.Start()
+		defer updater.Stop()
+	}
+
+	ipLimiter := services.NewRateLimiterFromEnv("RATE_LIMIT_IP", 50, 100)
+	sessionLimiter := services.NewRateLimiterFromEnv("RATE_LIMIT_SESSION", 10, 30)
 
-	recordingsHandler := handlers.NewRecordingsHandler(recorder)
-	configHandler := handlers.NewConfigHandler(fileWriter)
+	recordingsHandler := handlers.NewRecordingsHandler(recorder, services.LoadRecordingSigningSecret(), sessionLimiter)
+	autoStart := newAutoStart()
+	configWatcher := services.NewConfigWatcher(configFile)
 	statsHandler := handlers.NewStatsHandler(recorder, fileWriter)
+	alertsHandler := handlers.NewAlertsHandler(alerts)
+	healthHandler := handlers.NewHealthHandler(fileWriter, dependencies)
+
+	apiToken, err := services.LoadMasterToken(secrets)
+	if err != nil {
+		log.Fatalf("Failed to load API token: %v", err)
+	}
+	uiAuth, err := services.LoadUIAuth(filepath.Join(configDir, "ui_password"))
+	if err != nil {
+		log.Fatalf("Failed to load UI password: %v", err)
+	}
+	auditLog, err := services.OpenAuditLog(filepath.Join(logDir, "audit.log"))
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	authGuard := services.NewAuthGuard(auditLog)
+	sessionHandler := handlers.NewSessionHandler(uiAuth, authGuard)
+	configHandler := handlers.NewConfigHandler(fileWriter, autoStart, configWatcher, settings, profiles, handlers.ConfigLimits{
+		IP:       ipLimiter,
+		Session:  sessionLimiter,
+		Guard:    authGuard,
+		Alerts:   alerts,
+		Notifier: notifier,
+		Recorder: recorder,
+	})
+
+	configWatcher.OnReload(func(changed []string) {
+		applyReloadedConfig(changed, ipLimiter, sessionLimiter, authGuard, alerts, recorder)
+	})
+	configWatcher.Start()
+	defer configWatcher.Stop()
+
+	urlSigner, err = services.NewURLSigner()
+	if err != nil {
+		log.Fatalf("Failed to initialize URL signing: %v", err)
+	}
+	signHandler := handlers.NewSignHandler(urlSigner)
+
+	tokenStore, err := services.LoadTokenStore(filepath.Join(configDir, "tokens.json"))
+	if err != nil {
+		log.Fatalf("Failed to load API tokens: %v", err)
+	}
+	tokensHandler := handlers.NewTokensHandler(tokenStore, apiToken, urlSigner)
+	configTransfer := services.NewConfigTransfer(settings, configFile, profiles, tokenStore, apiToken, filepath.Join(configDir, "ui_password"))
+	configTransfer.OnImport(func(changed []string) {
+		applyReloadedConfig(changed, ipLimiter, sessionLimiter, authGuard, alerts, recorder)
+	})
+	configBackupHandler := handlers.NewConfigBackupHandler(configTransfer, configHandler.Validate, auditLog)
+
+	authenticator := handlers.NewAuthenticator(apiToken, tokenStore, uiAuth, urlSigner, authGuard)
+	secured := func(readScope, writeScope services.TokenScope) func(http.HandlerFunc) http.HandlerFunc {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return handlers.RequestIDMiddleware(handlers.CORSMiddleware(handlers.AuthMiddleware(authenticator, readScope, writeScope, next)))
+		}
+	}
+	anyToken := secured("", "")
+	api := secured(services.ScopeRead, services.ScopeAdmin)
+	ingest := secured(services.ScopeIngest, services.ScopeIngest)
+	admin := secured(services.ScopeAdmin, services.ScopeAdmin)
+	limited := func(next http.HandlerFunc) http.HandlerFunc {
+		return handlers.RateLimitMiddleware(ipLimiter, stats, next)
+	}
+
+	http.Handle("/ui/", handlers.UIMiddleware(uiAuth, http.FileServer(http.FS(uiFiles))))
+	http.HandleFunc("/api/login", handlers.RequestIDMiddleware(handlers.CORSMiddleware(handlers.RateLimitMiddleware(ipLimiter, stats, sessionHandler.HandleLogin))))
+	http.HandleFunc("/api/logout", handlers.RequestIDMiddleware(handlers.CORSMiddleware(sessionHandler.HandleLogout)))
+	http.HandleFunc("/api/health", anyToken(healthHandler.Handle))
+	http.HandleFunc("/api/healthz", handlers.RequestIDMiddleware(limited(healthHandler.HandleProbe)))
+	http.HandleFunc("/api/version", anyToken(handlers.VersionHandler))
+	http.HandleFunc("/api/recordings", ingest(limited(recordingsHandler.Handle)))
+	http.HandleFunc("/api/recordings/events", ingest(recordingsHandler.HandleEvents))
+	http.HandleFunc("/api/recordings/stop", admin(recordingsHandler.HandleStop))
+	http.HandleFunc("/api/recordings/{session}/stop", admin(recordingsHandler.HandleStopSession))
+	http.HandleFunc("/api/recordings/{session}/split", admin(recordingsHandler.HandleSplitSession))
+	http.HandleFunc("/api/recordings/{session}/markers", ingest(recordingsHandler.HandleMarkers))
+	http.HandleFunc("/api/recordings/{session}/screenshot", admin(recordingsHandler.HandleScreenshot))
+	http.HandleFunc("/api/recordings/{session}/screenshots", ingest(recordingsHandler.HandleScreenshots))
+	http.HandleFunc("/api/recordings/{session}/recover", ingest(recordingsHandler.HandleRecover))
+	http.HandleFunc("/api/recordings/{session}/preview", api(recordingsHandler.HandlePreview))
+	http.HandleFunc("/api/recordings/{session}/live/{file}", api(handlers.NewLiveHandler(liveStreams, urlSigner).Handle))
+	groupsHandler := handlers.NewGroupsHandler(recorder)
+	http.HandleFunc("/api/groups", api(groupsHandler.Handle))
+	http.HandleFunc("/api/groups/{group}", api(groupsHandler.HandleGroup))
+	http.HandleFunc("/api/groups/{group}/stop", admin(groupsHandler.HandleStop))
+	http.HandleFunc("/api/groups/{group}/combine", admin(groupsHandler.HandleCombine))
+	homeAssistantHandler := handlers.NewHomeAssistantHandler(recorder)
+	http.HandleFunc("/api/homeassistant", api(homeAssistantHandler.Handle))
+	http.HandleFunc("/api/homeassistant/stop", admin(homeAssistantHandler.HandleStopAll))
+	schedulesHandler := handlers.NewSchedulesHandler(schedules)
+	http.HandleFunc("/api/schedules", api(schedulesHandler.Handle))
+	http.HandleFunc("/api/schedules/{id}/session", ingest(schedulesHandler.HandleSession))
+	capturesHandler := handlers.NewCapturesHandler(captures)
+	http.HandleFunc("/api/captures", api(capturesHandler.Handle))
+	http.HandleFunc("/api/captures/{session}/stop", admin(capturesHandler.HandleStop))
+	jobsHandler := handlers.NewJobsHandler(jobs)
+	http.HandleFunc("/api/jobs", api(jobsHandler.Handle))
+	http.HandleFunc("/api/jobs/{job}", api(jobsHandler.HandleJob))
+	http.HandleFunc("/api/jobs/{job}/events", api(jobsHandler.HandleEvents))
+	dependenciesHandler := handlers.NewDependenciesHandler(dependencies, installDependency, upgradeFFmpeg, configureFFmpeg, redetectFFmpeg, desktopUI && !*headlessFlag && !services.ContainerMode())
+	http.HandleFunc("/api/dependencies", api(dependenciesHandler.Handle))
+	http.HandleFunc("/api/dependencies/redetect", admin(dependenciesHandler.HandleRedetect))
+	http.HandleFunc("/api/dependencies/{name}", api(dependenciesHandler.HandleDependency))
+	http.HandleFunc("/api/dependencies/{name}/install", admin(dependenciesHandler.HandleInstall))
+	http.HandleFunc("/api/dependencies/{name}/upgrade", admin(dependenciesHandler.HandleUpgrade))
+	recordingFilesHandler := handlers.NewRecordingFilesHandler(fileWriter, profiles)
+	http.HandleFunc("/api/recordings/recent", api(recordingFilesHandler.HandleRecent))
+	http.HandleFunc("/api/sessions", api(recordingFilesHandler.HandleSessions))
+	http.HandleFunc("/api/recordings/open-folder", admin(recordingFilesHandler.HandleOpenFolder))
+	http.HandleFunc("/api/recordings/reveal", admin(recordingFilesHandler.HandleReveal))
+	http.HandleFunc("/api/recordings/media", api(recordingFilesHandler.HandleMedia))
+	http.HandleFunc("/api/recordings/import", admin(recordingFilesHandler.HandleImport))
+	http.HandleFunc("/api/config", api(configHandler.Handle))
+	http.HandleFunc("/api/config/reload", admin(configHandler.HandleReload))
+	http.HandleFunc("/api/config/validate", admin(configHandler.HandleValidate))
+	http.HandleFunc("/api/config/export", admin(configBackupHandler.HandleExport))
+	http.HandleFunc("/api/config/import", admin(configBackupHandler.HandleImport))
+	http.HandleFunc("/api/preferences", api(handlers.NewPreferencesHandler(settings).Handle))
+	profilesHandler := handlers.NewProfilesHandler(profiles)
+	http.HandleFunc("/api/profiles", api(profilesHandler.Handle))
+	http.HandleFunc("/api/profiles/activate", api(profilesHandler.HandleActivate))
+	http.HandleFunc("/api/stats", api(statsHandler.Handle))
+	http.HandleFunc("/api/stats/stream", api(statsHandler.HandleStream))
+	http.HandleFunc("/api/stats/export", api(limited(statsHandler.HandleExport)))
+	http.HandleFunc("/api/stats/timeseries", api(statsHandler.HandleTimeSeries))
+	http.HandleFunc("/api/stats/repair", api(statsHandler.HandleRepair))
+	http.HandleFunc("/api/alerts", api(alertsHandler.Handle))
+	if updater != nil {
+		updateHandler := handlers.NewUpdateHandler(updater, settings, func() int {
+			return len(recorder.GetActiveRecordings())
+		}, func() {
+			if err := stats.Save(); err != nil {
+				services.LogError("Failed to save stats: %v", err)
+			}
+			restartForUpdate(instance)
+		})
+		http.HandleFunc("/api/update", api(updateHandler.Handle))
+		http.HandleFunc("/api/update/check", admin(updateHandler.HandleCheck))
+		http.HandleFunc("/api/update/install", admin(updateHandler.HandleInstall))
+		http.HandleFunc("/api/update/restart", admin(updateHandler.HandleRestart))
+	}
+	http.HandleFunc("/api/crashes", api(limited(handlers.CrashesHandler)))
+	http.HandleFunc("/api/tokens", admin(tokensHandler.Handle))
+	http.HandleFunc("/api/tokens/rotate", admin(tokensHandler.HandleRotate))
+	http.HandleFunc("/api/sign", secured(services.ScopeRead, services.ScopeRead)(signHandler.Handle))
+	resetHandler := handlers.NewResetHandler(func(keepRecordings bool) (services.FactoryResetReport, error) {
+		fileWriter.CloseAll()
+		if autoStart.Enabled() {
+			if err := autoStart.Set(false); err != nil {
+				services.LogError("[RESET] Failed to turn off start at login: %v", err)
+			}
+		}
+		return services.FactoryReset(configDir, secrets, stats, profiles, keepRecordings)
+	}, func() {
+		restartAfterReset(instance)
+	}, auditLog)
+	http.HandleFunc("/api/reset", admin(resetHandler.Handle))
 
-	http.Handle("/ui/", http.FileServer(http.FS(uiFiles)))
-	http.HandleFunc("/api/health", handlers.CORSMiddleware(handlers.HealthHandler))
-	http.HandleFunc("/api/recordings", handlers.CORSMiddleware(recordingsHandler.Handle))
-	http.HandleFunc("/api/config", handlers.CORSMiddleware(configHandler.Handle))
-	http.HandleFunc("/api/stats", handlers.CORSMiddleware(statsHandler.Handle))
+	tlsConfig, err := services.LoadTLSConfig(configDir)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
 
-	go startServer(serverPort)
+	var listener net.Listener
+	if socketPath != "" {
+		listener, err = listen(serverAddr, true)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", serverAddr, err)
+		}
+		defer os.Remove(socketPath)
+		configHandler.SetServer(handlers.ServerInfo{Socket: socketPath, TLS: tlsConfig != nil})
+	} else {
+		ports, err := services.ServerPortCandidates(serverPort, configDir)
+		if err != nil {
+			log.Fatalf("Failed to configure port: %v", err)
+		}
+		listener, err = listenTCP(bindAddress, ports)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", bindAddress, err)
+		}
+		serverAddr = listener.Addr().String()
+		_, serverPort, _ = net.SplitHostPort(serverAddr)
+		port := listener.Addr().(*net.TCPAddr).Port
+		if err := services.SaveLastPort(configDir, port); err != nil {
+			services.LogError("Failed to save port: %v", err)
+		}
+		configHandler.SetServer(handlers.ServerInfo{Port: port, Bind: bindAddress, TLS: tlsConfig != nil})
+
+		scheme := "http"
+		if tlsConfig != nil {
+			scheme = "https"
+		}
+		info := services.NewDiscoveryInfo(fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(localHost(bindAddress), serverPort)), port, tlsConfig != nil)
+		// In a container nothing outside can read the discovery file.
+		if !services.ContainerMode() {
+			if path, err := services.WriteDiscoveryFile(info); err != nil {
+				services.LogError("Failed to write discovery file: %v", err)
+			} else {
+				services.LogInfo("Discovery file: %s", path)
+				defer services.RemoveDiscoveryFile()
+			}
+		}
+		http.HandleFunc("/api/discovery", handlers.RequestIDMiddleware(handlers.CORSMiddleware(limited(handlers.NewDiscoveryHandler(info).Handle))))
+
+		if services.MDNSEnabled() {
+			if advertiser, err := services.NewMDNSAdvertiser(bindAddress, port, tlsConfig != nil); err != nil {
+				services.LogInfo("[MDNS] Not advertising on the network: %v", err)
+			} else if err := advertiser.Start(); err != nil {
+				services.LogError("[MDNS] %v", err)
+			} else {
+				defer advertiser.Stop()
+			}
+		}
+
+		if services.PortMappingEnabled() {
+			if lanBaseURL(bindAddress, serverPort, tlsConfig != nil) == "" {
+				services.LogError("[NAT] Port mapping needs the server bound to a LAN address (--bind 0.0.0.0)")
+			} else if portMapper, err := services.NewPortMapper(port); err != nil {
+				services.LogError("[NAT] %v", err)
+			} else {
+				if tlsConfig == nil {
+					services.LogInfo("[NAT] Warning: the server is reachable from the internet without TLS; consider TLS_ENABLED=true")
+				}
+				portMapper.Start()
+				defer portMapper.Stop()
+				http.HandleFunc("/api/portmap", api(handlers.NewPortMapHandler(portMapper, tlsConfig != nil).Handle))
+			}
+		}
+	}
+
+	pairingBaseURL := ""
+	if socketPath == "" {
+		pairingBaseURL = lanBaseURL(bindAddress, serverPort, tlsConfig != nil)
+	}
+	castFFmpeg := ""
+	if postProcessor != nil {
+		castFFmpeg = postProcessor.FFmpegPath()
+	}
+	caster := services.NewCaster(castFFmpeg, pairingBaseURL, urlSigner)
+	defer caster.Close()
+	castHandler := handlers.NewCastHandler(caster, recorder, fileWriter, profiles)
+	http.HandleFunc("/api/cast", api(castHandler.Handle))
+	http.HandleFunc("/api/cast/devices", api(castHandler.HandleDevices))
+	http.HandleFunc("/api/cast/media/{file}", api(castHandler.HandleMedia))
+	pairing := services.NewPairingService(tokenStore)
+	pairingHandler := handlers.NewPairingHandler(pairing, pairingBaseURL, authGuard)
+	http.HandleFunc("/api/pairing", admin(pairingHandler.HandleStart))
+	http.HandleFunc("/api/pairing/redeem", handlers.RequestIDMiddleware(handlers.CORSMiddleware(handlers.RateLimitMiddleware(ipLimiter, stats, pairingHandler.HandleRedeem))))
+
+	// Error messages are translated into the language chosen in the
+	// preferences, or else the client's.
+	language := func() string { return settings.Preferences().Language }
+	http.HandleFunc("/api/i18n", handlers.RequestIDMiddleware(handlers.CORSMiddleware(limited(handlers.NewI18nHandler(language).Handle))))
+	handler := handlers.LocalizeMiddleware(language, http.DefaultServeMux.ServeHTTP)
+	server := &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	go startServer(server, listener)
+
+	// With a Unix socket nothing listens on TCP, which the desktop window
+	// and the browser would need.
+	if *headlessFlag || !desktopUI || services.ContainerMode() || socketPath != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if socketPath != "" && desktopUI && !*headlessFlag && !services.ContainerMode() {
+			services.LogInfo("Serving only on %s, so the UI is not shown", socketPath)
+		}
+		services.LogInfo("Running headless; press Ctrl+C to stop")
+		<-ctx.Done()
+		services.LogInfo("Shutting down")
+
+		// Let uploads in flight finish, then close the recordings they wrote to.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			services.LogError("Failed to finish open requests: %v", err)
+		}
+		captures.Close()
+		fileWriter.CloseAll()
+		if err := stats.Save(); err != nil {
+			services.LogError("Failed to save stats: %v", err)
+		}
+		return 0
+	}
 
-	launchUI(serverPort)
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	localBaseURL := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(localHost(bindAddress), serverPort))
+	uiURL := localBaseURL + "/ui/index.html"
+	webviewURL := uiURL
+	var uiServer *http.Server
+	if tlsConfig != nil {
+		// The embedded webview cannot accept the self-signed certificate, so
+		// it gets its own plain-HTTP listener that is only reachable over
+		// loopback, and that only the window and signed links get through.
+		uiListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatalf("Failed to start UI listener: %v", err)
+		}
+		key := rand.Text()
+		uiServer = &http.Server{
+			Handler:           handlers.WebviewGate(key, urlSigner, handler),
+			ReadHeaderTimeout: readHeaderTimeout,
+			IdleTimeout:       idleTimeout,
+		}
+		go func() {
+			defer services.CapturePanic()
+			if err := uiServer.Serve(uiListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				services.LogError("[UI] UI listener stopped: %v", err)
+			}
+		}()
+		localBaseURL = fmt.Sprintf("http://%s", uiListener.Addr())
+		webviewURL = fmt.Sprintf("%s%s?key=%s", localBaseURL, handlers.WebviewPath, key)
+	}
+
+	shareBaseURL = pairingBaseURL
+	if shareBaseURL == "" {
+		shareBaseURL = localBaseURL
+	}
+	keepRecording, err := launchUI(serverAddr, webviewURL, apiToken, updater, instance, recorder, tlsConfig != nil)
+	if err != nil {
+		services.LogError("[UI] Cannot open the desktop window: %v; opening the UI in the default browser instead", err)
+		serveInBrowser(uiURL, pairing, instance)
+	} else if keepRecording {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		services.LogInfo("Window closed; %d recording(s) continue in the background", len(recorder.GetActiveRecordings()))
+		for len(recorder.GetActiveRecordings()) > 0 && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	services.LogInfo("Shutting down")
+
+	// Stop taking chunks, then finish the recordings still open so that they
+	// are post-processed like any other.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		services.LogError("Failed to finish open requests: %v", err)
+	}
+	if uiServer != nil {
+		uiServer.Close()
+	}
+	captures.Close()
+	if stopped := recorder.StopAll(context.Background()); stopped > 0 {
+		services.LogInfo("Stopped and saved %d active recording(s)", stopped)
+	}
+	if err := stats.Save(); err != nil {
+		services.LogError("Failed to save stats: %v", err)
+	}
+	return 0
 }
 
-func startServer(port string) {
-	log.Printf("Server starting on http://localhost:%s", port)
-	serverStarted <- true
+// serveInBrowser stands in for the desktop window when it cannot be shown:
+// the UI opens in the default browser, which signs in with a one-time pairing
+// code, and the server runs until it is stopped. Starting the app again opens
+// another browser tab.
+func serveInBrowser(uiURL string, pairing *services.PairingService, instance *services.InstanceLock) {
+	open := func() bool {
+		code, err := pairing.Start([]services.TokenScope{services.ScopeAdmin}, services.DefaultPairingTTL)
+		if err != nil {
+			services.LogError("[UI] Failed to create a pairing code: %v", err)
+			return false
+		}
+		pairURL := strings.TrimSuffix(uiURL, "index.html") + "pair.html#code=" + code.Code
+		if err := services.OpenBrowser(pairURL); err != nil {
+			// The URL is not logged: its code signs in as an admin.
+			services.LogError("[UI] Failed to open the browser: %v; start the app again to retry", err)
+			return false
+		}
+		return true
+	}
+	open()
+	instance.OnFocus(open)
+	defer instance.OnFocus(nil)
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	services.LogInfo("Serving the UI in the browser; press Ctrl+C to stop")
+	<-ctx.Done()
+}
+
+// restartAfterReset starts the server again after a factory reset, so that it
+// comes up with a new API token and without the old state in memory.
+func restartAfterReset(instance *services.InstanceLock) {
+	services.LogInfo("[RESET] Restarting")
+	instance.Release()
+	if err := services.RestartExecutable(); err != nil {
+		services.LogError("[RESET] %v; restart the app to finish the reset", err)
+		return
 	}
+	// On Windows the new process has started and this one must exit.
+	os.Exit(0)
 }
 
-func launchUI(port string) {
-	<-serverStarted
-	time.Sleep(100 * time.Millisecond)
+// restartForUpdate restarts the server so that the staged update is installed
+// on the way up.
+func restartForUpdate(instance *services.InstanceLock) {
+	services.LogInfo("[UPDATE] Restarting")
+	instance.Release()
+	if err := services.RestartExecutable(); err != nil {
+		services.LogError("[UPDATE] %v; restart the app to install the update", err)
+		return
+	}
+	// On Windows the new process has started and this one must exit.
+	os.Exit(0)
+}
 
-	w := webview.New(false)
-	if w == nil {
-		log.Fatal("Failed to create webview instance")
+// newAutoStart returns the login item that starts the app minimized, or nil if
+// it cannot be set up.
+func newAutoStart() *services.AutoStart {
+	if services.ContainerMode() {
+		return nil
 	}
-	defer w.Destroy()
+	forwarded, err := forwardedFlags()
+	if err != nil {
+		services.LogError("[AUTOSTART] %v", err)
+		return nil
+	}
+	autoStart, err := services.NewAutoStart(append(forwarded, "--minimized"))
+	if err != nil {
+		services.LogError("[AUTOSTART] Start at login unavailable: %v", err)
+		return nil
+	}
+	return autoStart
+}
 
-	w.SetTitle("Recording Server")
-	w.SetSize(1200, 800, webview.HintNone)
+// runRepairStats implements the "repair" command (also "repair-stats"), which
+// recomputes stats.json from the recordings on disk without starting the server or UI.
+func runRepairStats(args []string) int {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	dir := fs.String("dir", downloadDir, "recordings directory to scan")
+	dryRun := fs.Bool("dry-run", false, "report the recomputed totals without saving them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
 
-	setWindowIcon(w)
+	stats := services.NewStats(*dir)
+	defer stats.Stop()
 
-	w.Bind("selectDirectory", func() string {
-		dir, err := dialog.Directory().Title("Select Download Directory").Browse()
-		if err != nil {
-			log.Printf("Directory selection error: %v", err)
-			return ""
+	result, err := stats.Repair(*dir, *dryRun)
+	if err != nil {
+		services.LogError("Stats repair failed: %v", err)
+		return 1
+	}
+
+	fmt.Printf("Scanned %d recordings in %s\n", result.FilesScanned, result.Directory)
+	fmt.Printf("Sessions: %d -> %d\n", result.BeforeSessions, result.AfterSessions)
+	fmt.Printf("Size:     %d -> %d bytes\n", result.BeforeBytes, result.AfterBytes)
+	if result.DryRun {
+		fmt.Println("Dry run: stats.json was not modified")
+	}
+	return 0
+}
+
+// runIssueClientCert implements the "issue-client-cert" command, which issues a
+// client certificate for an extension or agent when mutual TLS is enabled.
+func runIssueClientCert(args []string) int {
+	fs := flag.NewFlagSet("issue-client-cert", flag.ContinueOnError)
+	name := fs.String("name", "extension", "common name for the client certificate")
+	out := fs.String("out", ".", "directory to write <name>.crt and <name>.key into")
+	days := fs.Int("days", 365, "validity in days")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	certPEM, keyPEM, err := services.IssueClientCertificate(configDir, *name, time.Duration(*days)*24*time.Hour)
+	if err != nil {
+		services.LogError("Failed to issue client certificate: %v", err)
+		return 1
+	}
+
+	certPath := filepath.Join(*out, *name+".crt")
+	keyPath := filepath.Join(*out, *name+".key")
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		services.LogError("Failed to write %s: %v", certPath, err)
+		return 1
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		services.LogError("Failed to write %s: %v", keyPath, err)
+		return 1
+	}
+
+	fmt.Printf("Client certificate: %s\n", certPath)
+	fmt.Printf("Client key:         %s\n", keyPath)
+	fmt.Printf("Start the server with TLS_CLIENT_AUTH=true to require it.\n")
+	fmt.Printf("Import both into the browser's certificate store (e.g. as PKCS#12 via\n")
+	fmt.Printf("  openssl pkcs12 -export -in %s -inkey %s -out %s.p12)\n", certPath, keyPath, *name)
+	return 0
+}
+
+// applyReloadedConfig applies the settings that can change while the server
+// runs. Recordings in progress keep writing to their current files; a new
+// recordings directory is used for files created from now on.
+// Settings changed through the API are only replaced when the file changes them.
+func applyReloadedConfig(changed []string, ipLimiter, sessionLimiter *services.RateLimiter, guard *services.AuthGuard, alerts *services.AlertService, recorder *services.RecorderService) {
+	alertsChanged, clockChanged, notificationsChanged, webhooksChanged, hooksChanged := false, false, false, false, false
+	for _, key := range changed {
+		if strings.HasPrefix(key, "notifications.") {
+			notificationsChanged = true
 		}
-		if dir != "" {
-			fileWriter.SetDownloadDir(dir)
-			log.Printf("Download directory changed to: %s", dir)
+		if strings.HasPrefix(key, "webhooks.") {
+			webhooksChanged = true
 		}
-		return dir
-	})
+		if strings.HasPrefix(key, "hooks.") {
+			hooksChanged = true
+		}
+		switch key {
+		case "time.zone", "time.format", "time.file_timestamp", "time.clock":
+			clockChanged = true
+		case "limits.ip_rps", "limits.ip_burst":
+			ipLimiter.ReloadFromEnv()
+		case "limits.session_rps", "limits.session_burst":
+			sessionLimiter.ReloadFromEnv()
+		case "limits.lockout_attempts":
+			guard.ReloadFromEnv()
+		case "logging.level":
+			services.SetLogLevelFromEnv()
+		case "limits.min_free_disk_gb", "limits.max_write_failures", "limits.max_session_hours":
+			alertsChanged = true
+		case "limits.session_idle_minutes":
+			recorder.SetIdleTimeout(services.LoadIdleTimeoutFromEnv())
+		case "limits.max_sessions":
+			recorder.SetMaxSessions(services.LoadMaxSessionsFromEnv())
+		case "limits.recovery":
+			recorder.SetRecoveryPolicy(services.LoadRecoveryPolicyFromEnv())
+		case "limits.post_processing_jobs":
+			fileWriter.SetPostProcessingJobs(services.LoadPostProcessingJobsFromEnv())
+		case "limits.max_file_mb":
+			fileWriter.SetMaxFileSize(services.LoadMaxFileSizeFromEnv())
+		case "ffmpeg.hls":
+			liveStreams.SetEnabled(services.HLSOutputEnabled())
+		case "paths.recordings":
+			dir := os.Getenv("RECORDINGS_DIR")
+			if dir == "" {
+				dir = "./recordings"
+			}
+			profiles.SetDefaultDir(dir)
+			services.LogInfo("[CONFIG] Recordings directory changed to %s", dir)
+		}
+	}
+	if alertsChanged {
+		alerts.SetRules(services.LoadAlertRulesFromEnv())
+	}
+	if notificationsChanged {
+		notifier.SetEvents(services.LoadNotificationEventsFromEnv())
+	}
+	if webhooksChanged {
+		webhooks.SetConfig(services.LoadWebhookConfigFromEnv())
+	}
+	if hooksChanged {
+		hooks.SetConfig(services.LoadHookConfigFromEnv())
+	}
+	if clockChanged {
+		if clock, err := services.LoadClockFromEnv(); err != nil {
+			services.LogError("[CONFIG] Keeping the previous time settings: %v", err)
+		} else {
+			fileWriter.SetClock(clock)
+		}
+	}
+}
+
+// listen opens the API listener. A Unix socket replaces the TCP listener entirely;
+// a stale socket file from a previous run is removed first and the new one is
+// restricted to the current user. Windows 10 1803+ supports Unix sockets natively.
+func listen(addr string, unixSocket bool) (net.Listener, error) {
+	if !unixSocket {
+		return net.Listen("tcp", addr)
+	}
 
-	w.Bind("getServerStatus", func() map[string]interface{} {
-		return map[string]interface{}{
-			"port":        port,
-			"downloadDir": downloadDir,
-			"running":     true,
+	if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(addr, 0600); err != nil {
+		services.LogError("Failed to restrict socket permissions on %s: %v", addr, err)
+	}
+	return listener, nil
+}
+
+// listenTCP listens on bind at the first of ports that is free, so a busy
+// port does not stop the server from starting.
+func listenTCP(bind string, ports []int) (net.Listener, error) {
+	var lastErr error
+	for i, port := range ports {
+		listener, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(port)))
+		if err == nil {
+			if i > 0 {
+				services.LogInfo("Port %d was unavailable, using %d", ports[0], port)
+			}
+			return listener, nil
 		}
-	})
+		services.LogInfo("Cannot listen on port %d: %v", port, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no free port among %v: %w", ports, lastErr)
+}
+
+// runSetPassword implements the "set-password" command, which reads a password
+// from stdin and stores its hash so the UI requires a login. An empty password
+// removes the requirement.
+func runSetPassword(args []string) int {
+	fs := flag.NewFlagSet("set-password", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := filepath.Join(configDir, "ui_password")
+	fmt.Print("New UI password (empty to disable): ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		services.LogError("Failed to read password: %v", err)
+		return 1
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	if password == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			services.LogError("Failed to remove %s: %v", path, err)
+			return 1
+		}
+		fmt.Println("UI password removed; the UI no longer requires a login.")
+		return 0
+	}
+
+	if err := services.SetUIPassword(path, password); err != nil {
+		services.LogError("Failed to set UI password: %v", err)
+		return 1
+	}
+	fmt.Printf("UI password saved to %s. Restart the server to apply it.\n", path)
+	return 0
+}
+
+// runIssueToken implements the "issue-token" command, which issues a scoped API
+// token, e.g. a read-only token for a dashboard or an ingest-only one for an extension.
+func runIssueToken(args []string) int {
+	fs := flag.NewFlagSet("issue-token", flag.ContinueOnError)
+	name := fs.String("name", "", "label for the token")
+	scope := fs.String("scope", "read", "comma-separated scopes: read, ingest, admin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "-name is required")
+		return 2
+	}
+	scopes, err := services.ParseScopes(*scope)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	tokens, err := services.LoadTokenStore(filepath.Join(configDir, "tokens.json"))
+	if err != nil {
+		services.LogError("Failed to load API tokens: %v", err)
+		return 1
+	}
+	value, token, err := tokens.Issue(*name, scopes)
+	if err != nil {
+		services.LogError("Failed to issue token: %v", err)
+		return 1
+	}
+
+	fmt.Printf("Token %s (%s), scopes %v:\n%s\n", token.ID, token.Name, token.Scopes, value)
+	fmt.Println("Store it now; it cannot be shown again. Restart the server to pick it up.")
+	return 0
+}
+
+func startServer(server *http.Server, listener net.Listener) {
+	defer services.CapturePanic()
+
+	scheme := "http"
+	if listener.Addr().Network() == "unix" {
+		scheme = "unix"
+	}
 
-	w.Navigate(fmt.Sprintf("http://localhost:%s/ui/index.html", port))
-	w.Run()
-}
\ No newline at end of file
+	if server.TLSConfig == nil {
+		log.Printf("Server starting on %s://%s", scheme, listener.Addr())
+		serverStarted <- true
+
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.Printf("Server starting on %s://%s (TLS)", scheme, listener.Addr())
+	serverStarted <- true
+
+	if err := server.ServeTLS(listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
@@ -6,6 +6,39 @@ type RecordingData struct {
 	Timestamp int64  `json:"timestamp"`
 	Data      string `json:"data"`
 	Status    string `json:"status"`
+	// Sequence numbers the chunks of a file from 1, in the order they were
+	// recorded, so that the server writes them in that order however they
+	// arrive. It is 0 from extensions that do not number them.
+	Sequence int64 `json:"sequence,omitempty"`
+	// AudioOnly recordings hold only the tab's sound and are saved as .weba.
+	AudioOnly bool `json:"audioOnly,omitempty"`
+	// Container is what the extension records into: webm (the default), mkv
+	// or mp4.
+	Container string `json:"container,omitempty"`
+	// Priority is normal (the default) or high, for recordings whose writes
+	// and post-processing go first when the server is busy.
+	Priority string `json:"priority,omitempty"`
+	// URL, Title and FavIconURL are those of the tab, Width and Height the
+	// size of its video and MimeType what MediaRecorder records, when the
+	// recording started.
+	URL        string `json:"url,omitempty"`
+	Title      string `json:"title,omitempty"`
+	FavIconURL string `json:"favIconUrl,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	MimeType   string `json:"mimeType,omitempty"`
+	// Group tags recordings made together, e.g. the camera tabs of one
+	// event, so that they can be followed, stopped and combined as one.
+	Group string `json:"group,omitempty"`
+	// Profile saves a new recording to the directory and with the naming of
+	// that profile rather than the one its page or the active profile give.
+	Profile string `json:"profile,omitempty"`
+	// ChunksSent, BytesSent and DurationMs come with the "split" and
+	// "stopped" statuses: the chunks and bytes of the file the server
+	// accepted and how long the extension recorded it, to verify the file.
+	ChunksSent int   `json:"chunksSent,omitempty"`
+	BytesSent  int64 `json:"bytesSent,omitempty"`
+	DurationMs int64 `json:"durationMs,omitempty"`
 }
 
 type ServerConfig struct {
@@ -14,6 +47,23 @@ type ServerConfig struct {
 }
 
 type HealthResponse struct {
-	Status string `json:"status"`
-	Time   string `json:"time"`
+	Status string                 `json:"status"`
+	Time   string                 `json:"time"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	StartTime string `json:"startTime"`
+	UptimeSec int64  `json:"uptimeSec"`
 }
\ No newline at end of file
@@ -0,0 +1,91 @@
+//go:build !headless
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"os/exec"
+
+	webview "github.com/webview/webview_go"
+)
+
+const playerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+html, body { margin: 0; height: 100%%; background: #000; }
+video { display: block; width: 100%%; height: 100%%; object-fit: contain; }
+</style>
+</head>
+<body><video src="%s" controls autoplay></video></body>
+</html>`
+
+// runPlayer implements the "player" command, which the desktop window starts
+// to play a recording in a window of its own. It runs as a separate process
+// because webview ends its event loop when any of its windows closes.
+func runPlayer(args []string) int {
+	fs := flag.NewFlagSet("player", flag.ContinueOnError)
+	title := fs.String("title", "Recording", "window title")
+	onTop := fs.Bool("on-top", false, "keep the window above other windows (Windows only)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s player [-title title] [-on-top] url\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	media, err := url.Parse(fs.Arg(0))
+	if err != nil || (media.Scheme != "http" && media.Scheme != "https") {
+		fmt.Fprintf(os.Stderr, "invalid media URL %q\n", fs.Arg(0))
+		return 2
+	}
+
+	if err := webviewAvailable(); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot open the player window: %v\n", err)
+		return 1
+	}
+	w := webview.New(false)
+	if !webviewCreated(w) {
+		fmt.Fprintln(os.Stderr, "failed to create the player window")
+		return 1
+	}
+	defer w.Destroy()
+
+	w.SetTitle(*title)
+	w.SetSize(960, 600, webview.HintNone)
+	setWindowIcon(w)
+	if *onTop {
+		setAlwaysOnTop(w, true)
+	}
+	w.SetHtml(fmt.Sprintf(playerPage, html.EscapeString(*title), html.EscapeString(media.String())))
+	w.Run()
+	return 0
+}
+
+// startPlayer opens mediaURL in a player window, leaving this one running.
+func startPlayer(title, mediaURL string, onTop bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the executable: %w", err)
+	}
+	args := []string{"player", "-title", title}
+	if onTop {
+		args = append(args, "-on-top")
+	}
+	cmd := exec.Command(exe, append(args, mediaURL)...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the player: %w", err)
+	}
+	go cmd.Wait()
+	return nil
+}
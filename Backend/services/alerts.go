@@ -0,0 +1,234 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	alertCheckInterval = 30 * time.Second
+
+	AlertRuleLowDisk       = "low_disk"
+	AlertRuleWriteFailures = "write_failures"
+	AlertRuleStuckSession  = "stuck_session"
+)
+
+// AlertRules holds the thresholds evaluated by AlertService.
+// A zero value disables the corresponding rule.
+type AlertRules struct {
+	MinFreeDiskGB    float64 `json:"minFreeDiskGB"`
+	MaxWriteFailures int64   `json:"maxWriteFailures"`
+	MaxSessionHours  float64 `json:"maxSessionHours"`
+}
+
+// Alert describes a rule that is currently firing.
+type Alert struct {
+	ID      string    `json:"id"`
+	Rule    string    `json:"rule"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// Notifier is a channel that alerts are delivered through.
+// Notify is called once when an alert starts firing and once when it resolves.
+type Notifier interface {
+	Notify(alert Alert, resolved bool)
+}
+
+// LogNotifier writes alert transitions to the application log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(alert Alert, resolved bool) {
+	if resolved {
+		LogInfo("[ALERTS] Resolved: %s", alert.Message)
+		return
+	}
+	LogError("[ALERTS] Firing: %s", alert.Message)
+}
+
+// AlertService periodically evaluates AlertRules against the recorder state
+// and dispatches transitions to the registered notifiers.
+type AlertService struct {
+	recorder   *RecorderService
+	fileWriter *FileWriterService
+	rules      AlertRules
+	active     map[string]*Alert
+	notifiers  []Notifier
+	baseline   int64
+	mu         sync.Mutex
+	stopChan   chan struct{}
+}
+
+// NewAlertService creates an alert service with the given rules and a log notifier.
+func NewAlertService(recorder *RecorderService, fileWriter *FileWriterService, rules AlertRules) *AlertService {
+	return &AlertService{
+		recorder:   recorder,
+		fileWriter: fileWriter,
+		rules:      rules,
+		active:     make(map[string]*Alert),
+		notifiers:  []Notifier{LogNotifier{}},
+		baseline:   fileWriter.GetStats().GetErrors()[ErrorKindWrite].Count,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// LoadAlertRulesFromEnv returns the default rules overridden by
+// ALERT_MIN_FREE_DISK_GB, ALERT_MAX_WRITE_FAILURES and ALERT_MAX_SESSION_HOURS.
+func LoadAlertRulesFromEnv() AlertRules {
+	rules := AlertRules{
+		MinFreeDiskGB:    2,
+		MaxWriteFailures: 10,
+		MaxSessionHours:  12,
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ALERT_MIN_FREE_DISK_GB"), 64); err == nil {
+		rules.MinFreeDiskGB = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("ALERT_MAX_WRITE_FAILURES"), 10, 64); err == nil {
+		rules.MaxWriteFailures = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ALERT_MAX_SESSION_HOURS"), 64); err == nil {
+		rules.MaxSessionHours = v
+	}
+	return rules
+}
+
+// AddNotifier registers an additional channel for alert notifications.
+func (as *AlertService) AddNotifier(n Notifier) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.notifiers = append(as.notifiers, n)
+}
+
+// Start begins periodic rule evaluation in the background.
+func (as *AlertService) Start() {
+	go func() {
+		defer CapturePanic()
+		as.Evaluate()
+
+		ticker := time.NewTicker(alertCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				as.Evaluate()
+			case <-as.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (as *AlertService) Stop() {
+	close(as.stopChan)
+}
+
+func (as *AlertService) GetRules() AlertRules {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.rules
+}
+
+// SetRules replaces the thresholds and re-evaluates immediately.
+func (as *AlertService) SetRules(rules AlertRules) {
+	as.mu.Lock()
+	as.rules = rules
+	as.mu.Unlock()
+	as.Evaluate()
+}
+
+// GetActiveAlerts returns the currently firing alerts ordered by start time.
+func (as *AlertService) GetActiveAlerts() []Alert {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(as.active))
+	for _, alert := range as.active {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Since.Before(alerts[j].Since)
+	})
+	return alerts
+}
+
+// Evaluate checks every rule once and notifies on any state transitions.
+func (as *AlertService) Evaluate() {
+	rules := as.GetRules()
+	firing := make(map[string]Alert)
+
+	if rules.MinFreeDiskGB > 0 {
+		dir := as.fileWriter.GetDownloadDir()
+		if free, err := FreeDiskSpace(dir); err != nil {
+			LogError("[ALERTS] Failed to read free disk space for %s: %v", dir, err)
+		} else if freeGB := float64(free) / (1024 * 1024 * 1024); freeGB < rules.MinFreeDiskGB {
+			firing[AlertRuleLowDisk] = Alert{
+				ID:      AlertRuleLowDisk,
+				Rule:    AlertRuleLowDisk,
+				Message: fmt.Sprintf("Low disk space: %.2f GB free in %s (threshold %.2f GB)", freeGB, dir, rules.MinFreeDiskGB),
+			}
+		}
+	}
+
+	if rules.MaxWriteFailures > 0 {
+		failures := as.fileWriter.GetStats().GetErrors()[ErrorKindWrite].Count - as.baseline
+		if failures > rules.MaxWriteFailures {
+			firing[AlertRuleWriteFailures] = Alert{
+				ID:      AlertRuleWriteFailures,
+				Rule:    AlertRuleWriteFailures,
+				Message: fmt.Sprintf("%d write failures since startup (threshold %d)", failures, rules.MaxWriteFailures),
+			}
+		}
+	}
+
+	if rules.MaxSessionHours > 0 {
+		limit := time.Duration(rules.MaxSessionHours * float64(time.Hour))
+		for _, info := range as.recorder.GetAllSessionInfo() {
+			if elapsed := time.Since(info.StartTime); elapsed > limit {
+				id := fmt.Sprintf("%s:%d", AlertRuleStuckSession, info.TabID)
+				firing[id] = Alert{
+					ID:      id,
+					Rule:    AlertRuleStuckSession,
+					Message: fmt.Sprintf("Session for tab %d (%s) has been recording for %.1f hours", info.TabID, info.Name, elapsed.Hours()),
+				}
+			}
+		}
+	}
+
+	as.apply(firing)
+}
+
+func (as *AlertService) apply(firing map[string]Alert) {
+	as.mu.Lock()
+	var started, resolved []Alert
+	for id, alert := range firing {
+		if existing, ok := as.active[id]; ok {
+			existing.Message = alert.Message
+			continue
+		}
+		alert.Since = time.Now()
+		as.active[id] = &alert
+		started = append(started, alert)
+	}
+	for id, alert := range as.active {
+		if _, ok := firing[id]; !ok {
+			delete(as.active, id)
+			resolved = append(resolved, *alert)
+		}
+	}
+	notifiers := append([]Notifier(nil), as.notifiers...)
+	as.mu.Unlock()
+
+	for _, n := range notifiers {
+		for _, alert := range started {
+			n.Notify(alert, false)
+		}
+		for _, alert := range resolved {
+			n.Notify(alert, true)
+		}
+	}
+}
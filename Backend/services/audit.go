@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEvent is one line of the audit log.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	IP        string    `json:"ip,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+// AuditLog appends security-relevant events as JSON lines to a file kept
+// separate from the application log, so it is not rotated away with it.
+type AuditLog struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// OpenAuditLog opens (or creates) the audit log at path for appending.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Record writes an event. A nil AuditLog discards it.
+func (a *AuditLog) Record(ctx context.Context, event, ip, detail string) {
+	if a == nil {
+		return
+	}
+	data, err := json.Marshal(AuditEvent{
+		Time:      time.Now(),
+		Event:     event,
+		IP:        ip,
+		Detail:    detail,
+		RequestID: RequestID(ctx),
+	})
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		LogError("[AUDIT] Failed to write audit event %s: %v", event, err)
+	}
+}
+
+// Close closes the underlying file.
+func (a *AuditLog) Close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.file.Close()
+}
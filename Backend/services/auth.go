@@ -0,0 +1,104 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// apiTokenSecret is the SecretStore name of the API token.
+const apiTokenSecret = "api_token"
+
+// LoadOrCreateAPIToken returns the bearer token required by the API.
+// API_TOKEN takes precedence; otherwise the token kept in secrets is used, and
+// a new random token is generated and stored there on first run.
+func LoadOrCreateAPIToken(secrets SecretStore) (string, error) {
+	if token := strings.TrimSpace(os.Getenv("API_TOKEN")); token != "" {
+		LogInfo("[AUTH] Using API token from API_TOKEN environment variable")
+		return token, nil
+	}
+
+	token, err := secrets.Get(apiTokenSecret)
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, ErrSecretNotFound) {
+		return "", fmt.Errorf("failed to read API token: %w", err)
+	}
+
+	token, err = generateToken()
+	if err != nil {
+		return "", err
+	}
+	if err := secrets.Set(apiTokenSecret, token); err != nil {
+		return "", fmt.Errorf("failed to store API token: %w", err)
+	}
+	LogInfo("[AUTH] Generated new API token")
+	return token, nil
+}
+
+// MasterToken holds the primary API token so it can be rotated while the
+// server is running.
+type MasterToken struct {
+	secrets SecretStore
+	value   string
+	mu      sync.RWMutex
+}
+
+// LoadMasterToken loads the API token as LoadOrCreateAPIToken does.
+func LoadMasterToken(secrets SecretStore) (*MasterToken, error) {
+	value, err := LoadOrCreateAPIToken(secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &MasterToken{secrets: secrets, value: value}, nil
+}
+
+// Value returns the current API token.
+func (m *MasterToken) Value() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.value
+}
+
+// Rotate generates and stores a new API token, which replaces the old one
+// immediately. A token pinned by API_TOKEN cannot be rotated.
+func (m *MasterToken) Rotate() (string, error) {
+	value, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	if err := m.Set(value); err != nil {
+		return "", err
+	}
+	LogInfo("[AUTH] Rotated API token")
+	return value, nil
+}
+
+// Set stores value as the API token, such as one restored from a backup. A
+// token pinned by API_TOKEN cannot be replaced.
+func (m *MasterToken) Set(value string) error {
+	if os.Getenv("API_TOKEN") != "" {
+		return fmt.Errorf("API token is set by the API_TOKEN environment variable")
+	}
+	if err := m.secrets.Set(apiTokenSecret, value); err != nil {
+		return fmt.Errorf("failed to store API token: %w", err)
+	}
+
+	m.mu.Lock()
+	m.value = value
+	m.mu.Unlock()
+	return nil
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
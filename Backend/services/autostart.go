@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// autoStartName names the login item so it does not clash with the
+// background service registered by SystemService.
+const autoStartName = "tab-recorder-app"
+
+// AutoStart registers the desktop app to start at user login (XDG autostart
+// on Linux, a LaunchAgent on macOS, the Run registry key on Windows).
+type AutoStart struct {
+	Executable string
+	Args       []string
+	WorkDir    string
+}
+
+// NewAutoStart describes a login item that runs this executable with args in
+// the current working directory.
+func NewAutoStart(args []string) (*AutoStart, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return &AutoStart{Executable: exe, Args: args, WorkDir: wd}, nil
+}
+
+// Set enables or disables starting at login.
+func (a *AutoStart) Set(enabled bool) error {
+	if a == nil {
+		return fmt.Errorf("auto-start is not available")
+	}
+	if enabled {
+		if err := a.enable(); err != nil {
+			return err
+		}
+		LogInfo("[AUTOSTART] Enabled start at login")
+		return nil
+	}
+	if err := a.disable(); err != nil {
+		return err
+	}
+	LogInfo("[AUTOSTART] Disabled start at login")
+	return nil
+}
+
+// Enabled reports whether the app is registered to start at login.
+func (a *AutoStart) Enabled() bool {
+	return a != nil && a.enabled()
+}
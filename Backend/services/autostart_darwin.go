@@ -0,0 +1,85 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const autoStartLabel = "com.tabrecorder.app"
+
+func (a *AutoStart) plistPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", autoStartLabel+".plist"), nil
+}
+
+// enable writes a LaunchAgent with RunAtLoad; launchd picks it up at the next login.
+func (a *AutoStart) enable() error {
+	path, err := a.plistPath()
+	if err != nil {
+		return err
+	}
+	var args strings.Builder
+	for _, arg := range append([]string{a.Executable}, a.Args...) {
+		args.WriteString("\t\t<string>")
+		xml.EscapeText(&args, []byte(arg))
+		args.WriteString("</string>\n")
+	}
+	var workDir strings.Builder
+	xml.EscapeText(&workDir, []byte(a.WorkDir))
+
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>LimitLoadToSessionType</key>
+	<string>Aqua</string>
+</dict>
+</plist>
+`, autoStartLabel, args.String(), workDir.String())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create LaunchAgents directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(plist), 0644); err != nil {
+		return fmt.Errorf("failed to write login item: %w", err)
+	}
+	return nil
+}
+
+func (a *AutoStart) disable() error {
+	path, err := a.plistPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove login item: %w", err)
+	}
+	return nil
+}
+
+func (a *AutoStart) enabled() bool {
+	path, err := a.plistPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,74 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (a *AutoStart) desktopFile() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(config, "autostart", autoStartName+".desktop"), nil
+}
+
+// desktopExecArg quotes arg for the Exec key of a desktop entry.
+func desktopExecArg(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"'\\$`") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(arg) + `"`
+}
+
+func (a *AutoStart) enable() error {
+	path, err := a.desktopFile()
+	if err != nil {
+		return err
+	}
+	exec := []string{desktopExecArg(a.Executable)}
+	for _, arg := range a.Args {
+		exec = append(exec, desktopExecArg(arg))
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=Recording Server
+Exec=%s
+Path=%s
+X-GNOME-Autostart-enabled=true
+`, strings.Join(exec, " "), a.WorkDir)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create autostart directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(entry), 0644); err != nil {
+		return fmt.Errorf("failed to write autostart entry: %w", err)
+	}
+	return nil
+}
+
+func (a *AutoStart) disable() error {
+	path, err := a.desktopFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove autostart entry: %w", err)
+	}
+	return nil
+}
+
+func (a *AutoStart) enabled() bool {
+	path, err := a.desktopFile()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"strings"
+	"syscall"
+)
+
+const autoStartRunKey = `HKCU\Software\Microsoft\Windows\CurrentVersion\Run`
+
+func (a *AutoStart) command() string {
+	parts := []string{syscall.EscapeArg(a.Executable)}
+	for _, arg := range a.Args {
+		parts = append(parts, syscall.EscapeArg(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// enable adds a value under the current user's Run key. Run entries start in
+// the user's profile directory, so the working directory is passed explicitly
+// through a cmd wrapper.
+func (a *AutoStart) enable() error {
+	value := `cmd /c cd /d ` + syscall.EscapeArg(a.WorkDir) + ` && start "" ` + a.command()
+	_, err := runServiceCommand("reg", "add", autoStartRunKey, "/v", autoStartName, "/t", "REG_SZ", "/d", value, "/f")
+	return err
+}
+
+func (a *AutoStart) disable() error {
+	if !a.enabled() {
+		return nil
+	}
+	_, err := runServiceCommand("reg", "delete", autoStartRunKey, "/v", autoStartName, "/f")
+	return err
+}
+
+func (a *AutoStart) enabled() bool {
+	_, err := runServiceCommand("reg", "query", autoStartRunKey, "/v", autoStartName)
+	return err == nil
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer kept for reuse. Chunks of a few
+// seconds are well under it; the rare larger one is left to the garbage
+// collector instead of being held on to for good.
+const maxPooledBuffer = 8 << 20
+
+// chunkBuffers holds the buffers recording requests are read and decoded
+// into, so that a chunk a second from each of several tabs does not allocate
+// two new buffers every time.
+var chunkBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// GetBuffer returns an empty buffer from the pool. Give it back with
+// PutBuffer once nothing refers to its bytes anymore.
+func GetBuffer() *bytes.Buffer {
+	buf := chunkBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// PutBuffer returns buf to the pool.
+func PutBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	chunkBuffers.Put(buf)
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Size of the page a capture records.
+const (
+	captureWidth  = 1280
+	captureHeight = 720
+)
+
+const (
+	// captureLaunchTimeout is how long the browser may take to start and
+	// open the page.
+	captureLaunchTimeout = 30 * time.Second
+	// captureCheckInterval is how often a capture checks that its recording
+	// was not stopped from the server.
+	captureCheckInterval = 2 * time.Second
+	// captureChunkSize is the most that is read from FFmpeg per chunk.
+	captureChunkSize = 256 << 10
+)
+
+var (
+	// ErrCaptureUnavailable is returned when no browser is configured for
+	// captures or FFmpeg is missing.
+	ErrCaptureUnavailable = errors.New("headless capture is not available")
+	// ErrCaptureNotFound is returned for a capture that is not running.
+	ErrCaptureNotFound = errors.New("capture not found")
+)
+
+// LoadCaptureBrowserFromEnv returns CAPTURE_BROWSER, the Chromium or Chrome
+// binary captures run in, or "" to turn captures off.
+func LoadCaptureBrowserFromEnv() string {
+	return strings.TrimSpace(os.Getenv("CAPTURE_BROWSER"))
+}
+
+// Capture is a page the server records by itself in a headless browser,
+// without the extension.
+type Capture struct {
+	// TabID identifies the recording session; captures count down from -1 so
+	// they never collide with the browser's tabs.
+	TabID     int       `json:"tabId"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	StartedAt time.Time `json:"startedAt"`
+	// StopAt is when the capture stops by itself, if ever.
+	StopAt *time.Time `json:"stopAt,omitempty"`
+
+	stop    chan struct{}
+	done    chan struct{}
+	session *captureSession
+}
+
+// CaptureAgent records pages in a headless Chromium driven over the Chrome
+// DevTools protocol: it opens the page, takes its screencast, encodes it to
+// WebM with FFmpeg and feeds the chunks to the recorder like the extension
+// would, so that scheduled recordings work with no browser open. The
+// screencast has no sound.
+type CaptureAgent struct {
+	recorder *RecorderService
+	browser  string
+	captures map[int]*Capture
+	lastID   int
+	mu       sync.Mutex
+}
+
+// NewCaptureAgent creates a CaptureAgent that records into recorder with the
+// browser binary, which may be "" to leave captures off.
+func NewCaptureAgent(recorder *RecorderService, browser string) *CaptureAgent {
+	return &CaptureAgent{recorder: recorder, browser: browser, captures: make(map[int]*Capture)}
+}
+
+// Available reports whether captures can run: a browser is configured and
+// FFmpeg is there to encode them.
+func (ca *CaptureAgent) Available() bool {
+	return ca != nil && ca.browser != "" && ca.recorder.fileWriter.GetPostProcessor() != nil
+}
+
+// Captures returns the captures running, the most recently started first.
+func (ca *CaptureAgent) Captures() []Capture {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	captures := make([]Capture, 0, len(ca.captures))
+	for _, c := range ca.captures {
+		captures = append(captures, *c)
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].StartedAt.After(captures[j].StartedAt) })
+	return captures
+}
+
+// Start opens url in a new headless browser and records it as name until
+// Stop, or for duration when it is positive. It returns once the page is
+// loading, with the session the capture is recorded as.
+func (ca *CaptureAgent) Start(ctx context.Context, name, url string, duration time.Duration) (Capture, error) {
+	if !ca.Available() {
+		return Capture{}, ErrCaptureUnavailable
+	}
+	if name == "" {
+		name = "capture"
+	}
+
+	ca.mu.Lock()
+	ca.lastID--
+	capture := &Capture{
+		TabID:     ca.lastID,
+		Name:      name,
+		URL:       url,
+		StartedAt: time.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if duration > 0 {
+		stopAt := capture.StartedAt.Add(duration)
+		capture.StopAt = &stopAt
+	}
+	ca.mu.Unlock()
+
+	session, err := ca.launch(ctx, capture)
+	if err != nil {
+		LogErrorCtx(ctx, "[CAPTURE] Failed to open %s: %v", url, err)
+		return Capture{}, err
+	}
+	ca.mu.Lock()
+	capture.session = session
+	ca.captures[capture.TabID] = capture
+	ca.mu.Unlock()
+	LogInfoCtx(ctx, "[CAPTURE] Recording %s as %q (session %d)", url, name, capture.TabID)
+
+	go func() {
+		defer CapturePanic()
+		session.run(capture)
+		ca.mu.Lock()
+		delete(ca.captures, capture.TabID)
+		ca.mu.Unlock()
+		close(capture.done)
+	}()
+	return *capture, nil
+}
+
+// Stop ends the capture recorded as tabID and waits until its file is
+// finished.
+func (ca *CaptureAgent) Stop(tabID int) error {
+	ca.mu.Lock()
+	capture, ok := ca.captures[tabID]
+	if ok {
+		select {
+		case <-capture.stop:
+		default:
+			close(capture.stop)
+		}
+	}
+	ca.mu.Unlock()
+	if !ok {
+		return ErrCaptureNotFound
+	}
+	<-capture.done
+	return nil
+}
+
+// Screenshot returns a PNG screenshot of the page captured as tabID, at the
+// size it is captured at.
+func (ca *CaptureAgent) Screenshot(ctx context.Context, tabID int) ([]byte, error) {
+	ca.mu.Lock()
+	capture, ok := ca.captures[tabID]
+	ca.mu.Unlock()
+	if !ok {
+		return nil, ErrCaptureNotFound
+	}
+	var result struct {
+		Data string `json:"data"`
+	}
+	session := capture.session
+	if err := session.cdp.call(ctx, session.target, "Page.captureScreenshot", map[string]string{"format": "png"}, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Data)
+}
+
+// Close stops every capture, e.g. when the server shuts down.
+func (ca *CaptureAgent) Close() {
+	for _, capture := range ca.Captures() {
+		ca.Stop(capture.TabID)
+	}
+}
+
+// captureSession is the browser, DevTools connection and encoder of a
+// running capture.
+type captureSession struct {
+	agent     *CaptureAgent
+	browser   *exec.Cmd
+	profile   string
+	cdp       *cdpClient
+	target    string
+	encoder   *exec.Cmd
+	frames    io.WriteCloser
+	output    io.ReadCloser
+	timestamp int64
+	// began is set once the recorder has taken a chunk of the capture.
+	began atomic.Bool
+	// framesMu keeps frames from being written after they were closed.
+	framesMu sync.Mutex
+	closed   bool
+}
+
+// launch starts the browser and the encoder of capture and opens its page.
+func (ca *CaptureAgent) launch(ctx context.Context, capture *Capture) (*captureSession, error) {
+	ctx, cancel := context.WithTimeout(ctx, captureLaunchTimeout)
+	defer cancel()
+
+	profile, err := os.MkdirTemp("", "recorder-capture-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser profile: %w", err)
+	}
+	s := &captureSession{agent: ca, profile: profile}
+	ok := false
+	defer func() {
+		if !ok {
+			s.close()
+		}
+	}()
+
+	s.browser = exec.Command(ca.browser,
+		"--headless=new",
+		"--remote-debugging-port=0",
+		"--user-data-dir="+profile,
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--autoplay-policy=no-user-gesture-required",
+		fmt.Sprintf("--window-size=%d,%d", captureWidth, captureHeight),
+		"about:blank")
+	stderr, err := s.browser.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.browser.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the browser: %w", err)
+	}
+	address, err := devToolsAddress(ctx, stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cdp, err = dialCDP(ctx, address, s.onEvent)
+	if err != nil {
+		return nil, err
+	}
+	var created struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := s.cdp.call(ctx, "", "Target.createTarget", map[string]any{
+		"url": "about:blank", "width": captureWidth, "height": captureHeight,
+	}, &created); err != nil {
+		return nil, err
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := s.cdp.call(ctx, "", "Target.attachToTarget", map[string]any{
+		"targetId": created.TargetID, "flatten": true,
+	}, &attached); err != nil {
+		return nil, err
+	}
+	s.target = attached.SessionID
+
+	s.encoder = exec.Command(ca.recorder.fileWriter.GetPostProcessor().FFmpegPath(),
+		"-hide_banner", "-loglevel", "error",
+		"-f", "image2pipe", "-c:v", "mjpeg", "-use_wallclock_as_timestamps", "1", "-i", "pipe:0",
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:v", "libvpx", "-deadline", "realtime", "-cpu-used", "8", "-b:v", "2M",
+		"-f", "webm", "-cluster_time_limit", "1000", "pipe:1")
+	if s.frames, err = s.encoder.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if s.output, err = s.encoder.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := s.encoder.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start FFmpeg: %w", err)
+	}
+
+	if err := s.cdp.call(ctx, s.target, "Page.enable", struct{}{}, nil); err != nil {
+		return nil, err
+	}
+	if err := s.cdp.call(ctx, s.target, "Page.startScreencast", map[string]any{
+		"format": "jpeg", "quality": 80, "maxWidth": captureWidth, "maxHeight": captureHeight,
+	}, nil); err != nil {
+		return nil, err
+	}
+	if err := s.cdp.call(ctx, s.target, "Page.navigate", map[string]any{"url": capture.URL}, nil); err != nil {
+		return nil, err
+	}
+	s.timestamp = time.Now().UnixMilli()
+	ok = true
+	return s, nil
+}
+
+// devToolsAddress reads the DevTools address the browser prints on start.
+func devToolsAddress(ctx context.Context, stderr io.Reader) (string, error) {
+	found := make(chan string, 1)
+	go func() {
+		defer CapturePanic()
+		scanner := bufio.NewScanner(stderr)
+		sent := false
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !sent {
+				if _, address, ok := strings.Cut(line, "DevTools listening on "); ok {
+					found <- strings.TrimSpace(address)
+					sent = true
+				}
+			}
+		}
+		if !sent {
+			close(found)
+		}
+	}()
+	select {
+	case address, ok := <-found:
+		if !ok {
+			return "", fmt.Errorf("the browser exited before it could be controlled")
+		}
+		return address, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("the browser did not start in time")
+	}
+}
+
+// onEvent passes the screencast frames of the page to the encoder.
+func (s *captureSession) onEvent(message cdpMessage) {
+	if message.Method != "Page.screencastFrame" || message.SessionID != s.target {
+		return
+	}
+	var frame struct {
+		Data      string `json:"data"`
+		SessionID int    `json:"sessionId"`
+	}
+	if err := json.Unmarshal(message.Params, &frame); err != nil {
+		return
+	}
+	s.cdp.send(s.target, "Page.screencastFrameAck", map[string]int{"sessionId": frame.SessionID})
+	data, err := base64.StdEncoding.DecodeString(frame.Data)
+	if err != nil {
+		return
+	}
+	s.framesMu.Lock()
+	defer s.framesMu.Unlock()
+	if !s.closed {
+		s.frames.Write(data)
+	}
+}
+
+// run records the encoded page until the capture is stopped, its time is up,
+// the browser or FFmpeg exits or the recording is stopped from the server.
+func (s *captureSession) run(capture *Capture) {
+	defer s.close()
+	ctx := context.Background()
+	rs := s.agent.recorder
+	source := RecordingSource{URL: capture.URL, Width: captureWidth, Height: captureHeight, MIMEType: "video/webm; codecs=vp8"}.Clean()
+	format := RecordingFormat{Container: ContainerWebM}
+
+	// Chunks go to the recorder as FFmpeg writes them; written receives why
+	// that ended, nil once FFmpeg is done.
+	written := make(chan error, 1)
+	go func() {
+		defer CapturePanic()
+		buf := make([]byte, captureChunkSize)
+		for {
+			n, err := s.output.Read(buf)
+			if n > 0 {
+				if err := rs.HandleRecording(ctx, capture.TabID, capture.Name, s.timestamp, 0, buf[:n], "stream", format, PriorityNormal, source, "", ""); err != nil {
+					written <- err
+					io.Copy(io.Discard, s.output)
+					return
+				}
+				s.began.Store(true)
+			}
+			if err != nil {
+				written <- nil
+				return
+			}
+		}
+	}()
+
+	var stopTimer <-chan time.Time
+	if capture.StopAt != nil {
+		stopTimer = time.After(time.Until(*capture.StopAt))
+	}
+	ticker := time.NewTicker(captureCheckInterval)
+	defer ticker.Stop()
+
+	var err error
+	finished := false
+	for !finished {
+		select {
+		case <-capture.stop:
+			finished = true
+		case <-stopTimer:
+			LogInfo("[CAPTURE] Stopping %q at its stop time", capture.Name)
+			finished = true
+		case <-s.cdp.Done():
+			LogError("[CAPTURE] The browser of %q exited", capture.Name)
+			finished = true
+		case err = <-written:
+			if err == nil {
+				err = fmt.Errorf("FFmpeg stopped encoding")
+			}
+			written = nil
+			finished = true
+		case <-ticker.C:
+			// A capture that started recording and is no longer was stopped
+			// from the server
+			if s.began.Load() && !rs.IsRecording(capture.TabID) {
+				LogInfo("[CAPTURE] The recording of %q was stopped from the server", capture.Name)
+				finished = true
+			}
+		}
+	}
+
+	// Closing the frames lets FFmpeg finish the file before it is stopped
+	s.framesMu.Lock()
+	s.closed = true
+	s.frames.Close()
+	s.framesMu.Unlock()
+	if written != nil {
+		err = <-written
+	}
+	s.encoder.Wait()
+	switch {
+	case errors.Is(err, ErrRecordingStopped):
+	case err != nil:
+		LogError("[CAPTURE] Recording %q failed: %v", capture.Name, err)
+	}
+	// The recording is finished, or the stop from the server confirmed, as
+	// the extension does when it stops
+	if s.began.Load() {
+		if err := rs.HandleRecording(ctx, capture.TabID, capture.Name, s.timestamp, 0, nil, "stopped", format, PriorityNormal, source, "", ""); err != nil {
+			LogError("[CAPTURE] Failed to finish %q: %v", capture.Name, err)
+		}
+	}
+	LogInfo("[CAPTURE] Finished capturing %q", capture.Name)
+}
+
+// close stops the encoder and the browser and removes the browser profile.
+func (s *captureSession) close() {
+	if s.cdp != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s.cdp.call(ctx, "", "Browser.close", struct{}{}, nil)
+		cancel()
+		s.cdp.close()
+	}
+	if s.encoder != nil && s.encoder.Process != nil && s.encoder.ProcessState == nil {
+		s.encoder.Process.Kill()
+		s.encoder.Wait()
+	}
+	if s.browser != nil && s.browser.Process != nil {
+		s.browser.Process.Kill()
+		s.browser.Wait()
+	}
+	os.RemoveAll(s.profile)
+}
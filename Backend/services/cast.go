@@ -0,0 +1,400 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of devices recordings can be cast to.
+const (
+	CastChromecast = "chromecast"
+	CastDLNA       = "dlna"
+)
+
+// States of a cast.
+const (
+	CastConverting = "converting"
+	CastLoading    = "loading"
+	CastPlaying    = "playing"
+	CastFailed     = "failed"
+)
+
+const (
+	castDiscoveryTimeout = 3 * time.Second
+	// castDevicesTTL is how long found devices are listed before the LAN is
+	// searched again.
+	castDevicesTTL = time.Minute
+	// castHistory is how many casts are listed.
+	castHistory = 20
+	// castLinkTTL is how long the links devices play recordings from work,
+	// long enough to pause and seek through a long recording.
+	castLinkTTL = MaxSignedURLTTL
+)
+
+var (
+	// ErrCastDeviceNotFound is returned for a device that was not found by
+	// the last search of the LAN.
+	ErrCastDeviceNotFound = errors.New("cast device not found")
+	// ErrCastUnreachable is returned when devices on the LAN cannot reach
+	// the server to play what is cast.
+	ErrCastUnreachable = errors.New("the server is not reachable from the network, so devices cannot play from it")
+)
+
+// castDirect lists the recording files each kind of device plays as they
+// are; others are converted to H.264 and AAC in MP4 first. Chromecasts play
+// WebM and MP4, DLNA renderers reliably only MP4.
+var castDirect = map[string]map[string]bool{
+	CastChromecast: {".webm": true, ".weba": true, ".mp4": true, ".m4a": true},
+	CastDLNA:       {".mp4": true, ".m4a": true},
+}
+
+// CastDevice is a Chromecast or DLNA renderer found on the LAN.
+type CastDevice struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Model string `json:"model,omitempty"`
+
+	// address is where a Chromecast is reached; controlURL and serviceType
+	// are the AVTransport service of a DLNA renderer.
+	address     string
+	controlURL  string
+	serviceType string
+}
+
+// CastJob is a recording, or the live stream of one, cast to a device.
+type CastJob struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	Title     string    `json:"title"`
+	Live      bool      `json:"live,omitempty"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// castMedia is what a device is asked to play.
+type castMedia struct {
+	url         string
+	contentType string
+	title       string
+	live        bool
+}
+
+// Caster finds Chromecasts and DLNA renderers on the LAN and has them play
+// finished recordings, or the HLS live stream of recordings in progress,
+// from signed links to the server. Recordings in formats a device cannot
+// play are converted with FFmpeg first; the converted files are kept in a
+// temporary directory until the server stops.
+type Caster struct {
+	ffmpegPath string
+	baseURL    string
+	signer     *URLSigner
+	client     *http.Client // never proxied: the devices are on the LAN
+	cacheDir   string
+	devices    []CastDevice
+	searchedAt time.Time
+	jobs       []*CastJob
+	// converting lets one recording be converted at a time.
+	converting sync.Mutex
+	searching  sync.Mutex
+	mu         sync.Mutex
+}
+
+// NewCaster returns a caster whose links point at baseURL, the server's LAN
+// address, which is empty when the server cannot be reached from the LAN.
+// Recordings are converted with the FFmpeg at ffmpegPath; none are when it
+// is empty.
+func NewCaster(ffmpegPath, baseURL string, signer *URLSigner) *Caster {
+	return &Caster{
+		ffmpegPath: ffmpegPath,
+		baseURL:    baseURL,
+		signer:     signer,
+		client:     &http.Client{Transport: &http.Transport{}, Timeout: 10 * time.Second},
+	}
+}
+
+// Devices returns the devices on the LAN, searching for them when the last
+// search is older than castDevicesTTL or refresh is set.
+func (c *Caster) Devices(refresh bool) ([]CastDevice, error) {
+	c.searching.Lock()
+	defer c.searching.Unlock()
+	c.mu.Lock()
+	if !refresh && !c.searchedAt.IsZero() && time.Since(c.searchedAt) < castDevicesTTL {
+		defer c.mu.Unlock()
+		return append([]CastDevice(nil), c.devices...), nil
+	}
+	c.mu.Unlock()
+
+	var (
+		chromecasts, renderers []CastDevice
+		chromecastErr, dlnaErr error
+		wg                     sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer CapturePanic()
+		defer wg.Done()
+		chromecasts, chromecastErr = discoverChromecasts(castDiscoveryTimeout)
+	}()
+	go func() {
+		defer CapturePanic()
+		defer wg.Done()
+		renderers, dlnaErr = discoverRenderers(c.client, castDiscoveryTimeout)
+	}()
+	wg.Wait()
+	if chromecastErr != nil && dlnaErr != nil {
+		return nil, fmt.Errorf("%v; %v", chromecastErr, dlnaErr)
+	}
+	for _, err := range []error{chromecastErr, dlnaErr} {
+		if err != nil {
+			LogError("[CAST] %v", err)
+		}
+	}
+
+	devices := append(chromecasts, renderers...)
+	sort.Slice(devices, func(i, j int) bool { return strings.ToLower(devices[i].Name) < strings.ToLower(devices[j].Name) })
+	LogInfo("[CAST] Found %d device(s) to cast to", len(devices))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devices, c.searchedAt = devices, time.Now()
+	return append([]CastDevice(nil), devices...), nil
+}
+
+// Jobs returns the latest casts, newest first.
+func (c *Caster) Jobs() []CastJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobs := make([]CastJob, 0, len(c.jobs))
+	for i := len(c.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *c.jobs[i])
+	}
+	return jobs
+}
+
+// CastRecording casts the finished recording called name, at path, to the
+// device with deviceID, converting it first when the device cannot play it.
+// It returns as soon as the cast has started; Jobs follows it.
+func (c *Caster) CastRecording(deviceID, name, path string) (CastJob, error) {
+	device, err := c.device(deviceID)
+	if err != nil {
+		return CastJob{}, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if !castDirect[device.Kind][ext] && c.ffmpegPath == "" {
+		return CastJob{}, fmt.Errorf("%s cannot play %s recordings, and converting them needs FFmpeg", device.Name, ext)
+	}
+	job, err := c.newJob(device, name, false)
+	if err != nil {
+		return CastJob{}, err
+	}
+	go func() {
+		defer CapturePanic()
+		media := castMedia{title: name, contentType: RecordingContentType(name)}
+		var err error
+		if castDirect[device.Kind][ext] {
+			media.url, err = c.link("/api/recordings/media?file=" + url.QueryEscape(name))
+		} else {
+			c.setState(job, CastConverting, nil)
+			var converted string
+			if converted, err = c.convert(path); err == nil {
+				media.contentType = RecordingContentType(converted)
+				media.url, err = c.link("/api/cast/media/" + converted)
+			}
+		}
+		if err == nil {
+			err = c.play(device, job, media)
+		}
+		c.finish(job, err)
+	}()
+	return c.snapshot(job), nil
+}
+
+// CastLive casts the HLS live stream of the recording of tabID, titled name,
+// to the device with deviceID. It returns as soon as the cast has started.
+func (c *Caster) CastLive(deviceID string, tabID int, name string) (CastJob, error) {
+	device, err := c.device(deviceID)
+	if err != nil {
+		return CastJob{}, err
+	}
+	job, err := c.newJob(device, name, true)
+	if err != nil {
+		return CastJob{}, err
+	}
+	go func() {
+		defer CapturePanic()
+		media := castMedia{title: name, contentType: "application/x-mpegURL", live: true}
+		var err error
+		media.url, err = c.link(fmt.Sprintf("/api/recordings/%d/live/%s", tabID, LivePlaylist))
+		if err == nil {
+			err = c.play(device, job, media)
+		}
+		c.finish(job, err)
+	}()
+	return c.snapshot(job), nil
+}
+
+// ConvertedFile returns the path of the converted recording called name.
+func (c *Caster) ConvertedFile(name string) (string, bool) {
+	c.mu.Lock()
+	dir := c.cacheDir
+	c.mu.Unlock()
+	if dir == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Close removes the converted recordings, when the server shuts down.
+func (c *Caster) Close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cacheDir != "" {
+		os.RemoveAll(c.cacheDir)
+		c.cacheDir = ""
+	}
+}
+
+func (c *Caster) device(id string) (CastDevice, error) {
+	if c.baseURL == "" {
+		return CastDevice{}, ErrCastUnreachable
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, device := range c.devices {
+		if device.ID == id {
+			return device, nil
+		}
+	}
+	return CastDevice{}, ErrCastDeviceNotFound
+}
+
+func (c *Caster) newJob(device CastDevice, title string, live bool) (*CastJob, error) {
+	id, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	job := &CastJob{ID: id[:12], Device: device.Name, Title: title, Live: live, State: CastLoading, StartedAt: time.Now()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jobs = append(c.jobs, job)
+	if len(c.jobs) > castHistory {
+		c.jobs = append([]*CastJob(nil), c.jobs[len(c.jobs)-castHistory:]...)
+	}
+	LogInfo("[CAST] Casting %s to %s", title, device.Name)
+	return job, nil
+}
+
+func (c *Caster) snapshot(job *CastJob) CastJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *job
+}
+
+func (c *Caster) setState(job *CastJob, state string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job.State = state
+	if err != nil {
+		job.Error = err.Error()
+	}
+}
+
+func (c *Caster) finish(job *CastJob, err error) {
+	if err != nil {
+		LogError("[CAST] Failed to cast %s to %s: %v", job.Title, job.Device, err)
+		c.setState(job, CastFailed, err)
+		return
+	}
+	LogInfo("[CAST] %s is playing on %s", job.Title, job.Device)
+	c.setState(job, CastPlaying, nil)
+}
+
+func (c *Caster) play(device CastDevice, job *CastJob, media castMedia) error {
+	c.setState(job, CastLoading, nil)
+	if device.Kind == CastChromecast {
+		return castToChromecast(device.address, media)
+	}
+	return castToRenderer(c.client, device.controlURL, device.serviceType, media)
+}
+
+// link returns a signed link to the server's path that devices on the LAN
+// can play from.
+func (c *Caster) link(path string) (string, error) {
+	signed, _, err := c.signer.Sign(path, castLinkTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the link: %w", err)
+	}
+	return c.baseURL + signed, nil
+}
+
+// convert converts the recording at path to H.264 and AAC in MP4, or AAC in
+// M4A for audio-only recordings, and returns the name of the converted file.
+// A recording that has not changed since it was last converted is not
+// converted again.
+func (c *Caster) convert(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the recording: %w", err)
+	}
+	c.mu.Lock()
+	if c.cacheDir == "" {
+		if c.cacheDir, err = os.MkdirTemp("", "tab-recorder-cast-"); err != nil {
+			c.mu.Unlock()
+			return "", fmt.Errorf("failed to create the directory for converted recordings: %w", err)
+		}
+	}
+	dir := c.cacheDir
+	c.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano())))
+	args := []string{"-i", path}
+	name := hex.EncodeToString(sum[:8])
+	if IsAudioRecording(path) {
+		name += ".m4a"
+		args = append(args, "-vn")
+	} else {
+		name += ".mp4"
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p", "-profile:v", "high", "-level", "4.1")
+	}
+	args = append(args, "-c:a", "aac", "-b:a", "192k", "-movflags", "+faststart", "-f", "mp4")
+
+	c.converting.Lock()
+	defer c.converting.Unlock()
+	output := filepath.Join(dir, name)
+	if _, err := os.Stat(output); err == nil {
+		return name, nil
+	}
+	temp := filepath.Join(dir, ".temp_"+name)
+	startTime := time.Now()
+	LogInfo("[CAST] Converting %s for casting", path)
+	if out, err := exec.Command(c.ffmpegPath, append(args, "-y", temp)...).CombinedOutput(); err != nil {
+		LogError("[CAST] FFmpeg failed: %v\nOutput: %s", err, string(out))
+		os.Remove(temp)
+		return "", fmt.Errorf("failed to convert the recording: %w", err)
+	}
+	if err := os.Rename(temp, output); err != nil {
+		os.Remove(temp)
+		return "", fmt.Errorf("failed to convert the recording: %w", err)
+	}
+	LogInfo("[CAST] Converted %s in %.2fs", path, time.Since(startTime).Seconds())
+	return name, nil
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// websocketGUID is appended to the key of a WebSocket handshake to compute
+// the accept header (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebsocketMessage is the largest message read from the browser;
+// screencast frames of a large page are a few megabytes.
+const maxWebsocketMessage = 64 << 20
+
+// WebSocket opcodes used by the DevTools protocol.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// websocketConn is the client side of a WebSocket connection, enough for the
+// text messages of the Chrome DevTools protocol.
+type websocketConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// dialWebsocket opens the ws:// address rawURL.
+func dialWebsocket(ctx context.Context, rawURL string) (*websocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "ws" {
+		return nil, fmt.Errorf("invalid DevTools address %q", rawURL)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the browser: %w", err)
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	if _, err := io.WriteString(conn, request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to the browser: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to the browser: %w", err)
+	}
+	response.Body.Close()
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+		conn.Close()
+		return nil, fmt.Errorf("the browser refused the DevTools connection: %s", response.Status)
+	}
+	return &websocketConn{conn: conn, reader: reader}, nil
+}
+
+// writeFrame sends one masked frame, as clients must.
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode, 0}
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	header[1] |= 0x80
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	header = append(header, mask...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	_, err := ws.conn.Write(append(header, masked...))
+	return err
+}
+
+// readMessage returns the next text message, answering pings on the way.
+func (ws *websocketConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+			return nil, err
+		}
+		fin, opcode := head[0]&0x80 != 0, head[0]&0x0F
+		length := uint64(head[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		var mask [4]byte
+		if head[1]&0x80 != 0 {
+			if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+				return nil, err
+			}
+		}
+		if length > maxWebsocketMessage || uint64(len(message))+length > maxWebsocketMessage {
+			return nil, fmt.Errorf("DevTools message too large")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(ws.reader, payload); err != nil {
+			return nil, err
+		}
+		if head[1]&0x80 != 0 {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+		case wsPong:
+		case wsClose:
+			return nil, io.EOF
+		case wsText, wsContinuation:
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		}
+	}
+}
+
+func (ws *websocketConn) close() error {
+	ws.writeFrame(wsClose, nil)
+	return ws.conn.Close()
+}
+
+// cdpMessage is a command, response or event of the Chrome DevTools protocol.
+type cdpMessage struct {
+	ID        int             `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// cdpClient sends DevTools commands to a browser and hands its events to
+// onEvent, which is called from one goroutine in the order they arrive.
+type cdpClient struct {
+	ws      *websocketConn
+	onEvent func(cdpMessage)
+	nextID  int
+	pending map[int]chan cdpMessage
+	done    chan struct{}
+	err     error
+	mu      sync.Mutex
+}
+
+// errBrowserClosed is returned for commands sent after the connection to the
+// browser ended.
+var errBrowserClosed = errors.New("the browser closed the DevTools connection")
+
+// dialCDP connects to the DevTools address of a browser.
+func dialCDP(ctx context.Context, address string, onEvent func(cdpMessage)) (*cdpClient, error) {
+	ws, err := dialWebsocket(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	client := &cdpClient{ws: ws, onEvent: onEvent, pending: make(map[int]chan cdpMessage), done: make(chan struct{})}
+	go client.read()
+	return client, nil
+}
+
+func (c *cdpClient) read() {
+	defer CapturePanic()
+	defer close(c.done)
+	for {
+		data, err := c.ws.readMessage()
+		if err != nil {
+			c.mu.Lock()
+			c.err = errBrowserClosed
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+		var message cdpMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			continue
+		}
+		if message.ID == 0 {
+			c.onEvent(message)
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[message.ID]
+		delete(c.pending, message.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- message
+		}
+	}
+}
+
+// call sends method with params to the target attached as sessionID, or to
+// the browser when it is empty, and decodes the result into result, if not
+// nil.
+func (c *cdpClient) call(ctx context.Context, sessionID, method string, params, result any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan cdpMessage, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	data, _ := json.Marshal(cdpMessage{ID: id, SessionID: sessionID, Method: method, Params: raw})
+	if err := c.ws.writeFrame(wsText, data); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+	select {
+	case response, ok := <-ch:
+		if !ok {
+			return errBrowserClosed
+		}
+		if response.Error != nil {
+			return fmt.Errorf("%s failed: %s", method, response.Error.Message)
+		}
+		if result != nil {
+			return json.Unmarshal(response.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// send sends method with params like call, without waiting for the answer,
+// e.g. from onEvent, which must not wait for one.
+func (c *cdpClient) send(sessionID, method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+	data, _ := json.Marshal(cdpMessage{ID: id, SessionID: sessionID, Method: method, Params: raw})
+	return c.ws.writeFrame(wsText, data)
+}
+
+// Done is closed once the connection to the browser has ended.
+func (c *cdpClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *cdpClient) close() {
+	c.ws.close()
+	<-c.done
+}
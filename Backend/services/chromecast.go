@@ -0,0 +1,325 @@
+package services
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chromecastService = "_googlecast._tcp.local."
+	// chromecastMediaReceiver is the app ID of Google's Default Media
+	// Receiver, which plays a URL it is given.
+	chromecastMediaReceiver = "CC1AD845"
+	chromecastTimeout       = 20 * time.Second
+	chromecastMaxMessage    = 64 << 10
+
+	castNamespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+	castNamespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	castNamespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
+	castNamespaceMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+// discoverChromecasts browses the LAN with multicast DNS for Chromecasts and
+// TVs with Chromecast built in, for timeout.
+func discoverChromecasts(timeout time.Duration) ([]CastDevice, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	group, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// A query from a port other than 5353 is answered directly (RFC 6762
+	// section 6.7).
+	var b dnsBuilder
+	b.uint16(0)
+	b.uint16(0)
+	b.uint16(1)
+	b.uint16(0)
+	b.uint16(0)
+	b.uint16(0)
+	b.name(chromecastService)
+	b.uint16(dnsTypePTR)
+	b.uint16(dnsClassIN | dnsUnicast)
+	if _, err := conn.WriteToUDP(b.buf, group); err != nil {
+		return nil, fmt.Errorf("failed to search for Chromecasts: %w", err)
+	}
+
+	type instance struct {
+		host, name, model, id string
+		port                  int
+		ip                    net.IP
+	}
+	instances := make(map[string]*instance)
+	hosts := make(map[string]net.IP)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		records, err := parseDNSResponse(buf[:n])
+		if err != nil {
+			continue
+		}
+		get := func(name string) *instance {
+			key := strings.ToLower(name)
+			if instances[key] == nil {
+				instances[key] = &instance{ip: from.IP}
+			}
+			return instances[key]
+		}
+		for _, r := range records {
+			switch {
+			case r.rtype == dnsTypePTR && strings.EqualFold(r.name, chromecastService):
+				get(r.target)
+			case r.rtype == dnsTypeSRV && strings.HasSuffix(strings.ToLower(r.name), chromecastService):
+				inst := get(r.name)
+				inst.host, inst.port = strings.ToLower(r.target), r.port
+			case r.rtype == dnsTypeTXT && strings.HasSuffix(strings.ToLower(r.name), chromecastService):
+				inst := get(r.name)
+				for _, kv := range r.txt {
+					key, value, _ := strings.Cut(kv, "=")
+					switch key {
+					case "fn":
+						inst.name = value
+					case "md":
+						inst.model = value
+					case "id":
+						inst.id = value
+					}
+				}
+			case r.rtype == dnsTypeA && r.ip != nil:
+				hosts[strings.ToLower(r.name)] = r.ip
+			}
+		}
+	}
+
+	var devices []CastDevice
+	for key, inst := range instances {
+		if inst.port == 0 {
+			continue
+		}
+		ip := inst.ip
+		if hostIP, ok := hosts[inst.host]; ok {
+			ip = hostIP
+		}
+		id := inst.id
+		if id == "" {
+			id = key
+		}
+		name := inst.name
+		if name == "" {
+			name, _, _ = strings.Cut(key, ".")
+		}
+		devices = append(devices, CastDevice{
+			ID:      CastChromecast + ":" + id,
+			Name:    name,
+			Kind:    CastChromecast,
+			Model:   inst.model,
+			address: net.JoinHostPort(ip.String(), strconv.Itoa(inst.port)),
+		})
+	}
+	return devices, nil
+}
+
+// castToChromecast plays media on the Chromecast at address with the Default
+// Media Receiver, using the Cast protocol: JSON messages in protocol buffer
+// frames over TLS. The receiver keeps playing once the connection is closed.
+func castToChromecast(address string, media castMedia) error {
+	// Chromecasts present a certificate signed by Google's device CA rather
+	// than one for their address, and the protocol authenticates the device
+	// separately; casting a link needs neither.
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: chromecastTimeout}, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the Chromecast: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(chromecastTimeout))
+	c := &castChannel{conn: conn}
+
+	if err := c.send("receiver-0", castNamespaceConnection, map[string]any{"type": "CONNECT"}); err != nil {
+		return err
+	}
+	if err := c.send("receiver-0", castNamespaceReceiver, map[string]any{"type": "LAUNCH", "appId": chromecastMediaReceiver, "requestId": 1}); err != nil {
+		return err
+	}
+	var transportID string
+	for transportID == "" {
+		msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case "LAUNCH_ERROR", "INVALID_REQUEST":
+			return fmt.Errorf("the Chromecast could not start its media player: %s", msg.Reason)
+		case "RECEIVER_STATUS":
+			for _, app := range msg.Status.Applications {
+				if app.AppID == chromecastMediaReceiver && app.TransportID != "" {
+					transportID = app.TransportID
+				}
+			}
+		}
+	}
+
+	streamType := "BUFFERED"
+	if media.live {
+		streamType = "LIVE"
+	}
+	if err := c.send(transportID, castNamespaceConnection, map[string]any{"type": "CONNECT"}); err != nil {
+		return err
+	}
+	err = c.send(transportID, castNamespaceMedia, map[string]any{
+		"type":      "LOAD",
+		"requestId": 2,
+		"autoplay":  true,
+		"media": map[string]any{
+			"contentId":   media.url,
+			"contentType": media.contentType,
+			"streamType":  streamType,
+			"metadata":    map[string]any{"metadataType": 0, "title": media.title},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+			return fmt.Errorf("the Chromecast could not play the recording (%s)", strings.ToLower(msg.Type))
+		case "MEDIA_STATUS":
+			if msg.RequestID == 2 {
+				c.send(transportID, castNamespaceConnection, map[string]any{"type": "CLOSE"})
+				return nil
+			}
+		}
+	}
+}
+
+// castChannel sends and receives the messages of a Cast protocol connection.
+type castChannel struct {
+	conn net.Conn
+}
+
+// castMessage is the part of the replies of a Chromecast casting reads.
+type castMessage struct {
+	Type      string `json:"type"`
+	RequestID int    `json:"requestId"`
+	Reason    string `json:"reason"`
+	Status    struct {
+		Applications []struct {
+			AppID       string `json:"appId"`
+			TransportID string `json:"transportId"`
+		} `json:"applications"`
+	} `json:"status"`
+}
+
+// send writes payload as a JSON message in namespace to destination. The
+// frame is a CastMessage protocol buffer: protocol version, source,
+// destination, namespace, payload type (string) and payload.
+func (c *castChannel) send(destination, namespace string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var msg []byte
+	msg = append(msg, 0x08, 0)
+	msg = appendProtoString(msg, 2, "sender-0")
+	msg = appendProtoString(msg, 3, destination)
+	msg = appendProtoString(msg, 4, namespace)
+	msg = append(msg, 0x28, 0)
+	msg = appendProtoString(msg, 6, string(data))
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	if _, err := c.conn.Write(append(frame, msg...)); err != nil {
+		return fmt.Errorf("failed to talk to the Chromecast: %w", err)
+	}
+	return nil
+}
+
+// receive reads messages until one that is not a heartbeat arrives, and
+// answers the heartbeats.
+func (c *castChannel) receive() (castMessage, error) {
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+			return castMessage{}, fmt.Errorf("failed to talk to the Chromecast: %w", err)
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > chromecastMaxMessage {
+			return castMessage{}, errors.New("the Chromecast sent a message that is too large")
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(c.conn, frame); err != nil {
+			return castMessage{}, fmt.Errorf("failed to talk to the Chromecast: %w", err)
+		}
+		fields, err := readProtoStrings(frame)
+		if err != nil {
+			return castMessage{}, err
+		}
+		var msg castMessage
+		if err := json.Unmarshal([]byte(fields[6]), &msg); err != nil {
+			continue
+		}
+		if fields[4] == castNamespaceHeartbeat && msg.Type == "PING" {
+			if err := c.send(fields[2], castNamespaceHeartbeat, map[string]any{"type": "PONG"}); err != nil {
+				return castMessage{}, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// appendProtoString appends the length-delimited protocol buffer field with
+// number field and value s.
+func appendProtoString(buf []byte, field int, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// readProtoStrings returns the length-delimited fields of a protocol buffer
+// message by number, skipping the others.
+func readProtoStrings(msg []byte) (map[int]string, error) {
+	fields := make(map[int]string)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("invalid message from the Chromecast")
+		}
+		msg = msg[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(msg); n <= 0 {
+				return nil, errors.New("invalid message from the Chromecast")
+			}
+			msg = msg[n:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return nil, errors.New("invalid message from the Chromecast")
+			}
+			fields[int(key>>3)] = string(msg[n : n+int(size)])
+			msg = msg[n+int(size):]
+		default:
+			return nil, errors.New("invalid message from the Chromecast")
+		}
+	}
+	return fields, nil
+}
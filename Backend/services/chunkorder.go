@@ -0,0 +1,132 @@
+package services
+
+import (
+	"sort"
+	"time"
+)
+
+// Chunks of a recording can arrive out of order when they are sent in
+// parallel, or when one is retried. The extension numbers the chunks of each
+// file from 1, and a file's handle holds the chunks that arrive ahead of the
+// next one until it comes, to write them in the order they were recorded.
+// Waiting is bounded: when too many chunks are held, or the missing one has
+// not come within reorderTimeout, it is given up on and writing goes on from
+// the first chunk held.
+const (
+	reorderLimit   = chunkQueueSize
+	reorderTimeout = 5 * time.Second
+)
+
+// chunkOrder is what a fileHandle needs to put its chunks in order. It is
+// guarded by the queueMu of the handle.
+type chunkOrder struct {
+	// next is the sequence number of the chunk to write next; 0 until the
+	// first chunk of a resumed recording, which carries on from wherever the
+	// extension was, tells it.
+	next    int64
+	pending map[int64]chunkWrite
+	// timer gives up on the missing chunk while chunks are held.
+	timer *time.Timer
+}
+
+// enqueueInOrder queues chunk, whose sequence number is sequence (0 when it is
+// not known), once the chunks before it are queued. h.queueMu must be held.
+func (h *fileHandle) enqueueInOrder(sequence int64, chunk chunkWrite) {
+	order := &h.order
+	switch {
+	case sequence <= 0:
+		h.enqueue(chunk)
+		return
+	case order.next == 0 || sequence == order.next:
+		order.next = sequence + 1
+		h.enqueue(chunk)
+	case sequence < order.next:
+		// Its turn was given up on, or it was sent again
+		LogError("[FILEWRITER] Chunk %d of %s arrived after chunk %d, writing it out of order", sequence, h.name, order.next-1)
+		h.enqueue(chunk)
+		return
+	default:
+		if order.pending == nil {
+			order.pending = make(map[int64]chunkWrite)
+		}
+		order.pending[sequence] = chunk
+		if len(order.pending) < reorderLimit {
+			if order.timer == nil {
+				order.timer = time.AfterFunc(reorderTimeout, h.reorderTimedOut)
+			}
+			return
+		}
+		h.skipMissing()
+	}
+	h.enqueueHeld()
+}
+
+// enqueueHeld queues the held chunks that are next in order.
+func (h *fileHandle) enqueueHeld() {
+	order := &h.order
+	for {
+		chunk, ok := order.pending[order.next]
+		if !ok {
+			break
+		}
+		delete(order.pending, order.next)
+		order.next++
+		h.enqueue(chunk)
+	}
+	if len(order.pending) == 0 && order.timer != nil {
+		order.timer.Stop()
+		order.timer = nil
+	}
+}
+
+// skipMissing gives up on the chunks missing before the first one held.
+func (h *fileHandle) skipMissing() {
+	order := &h.order
+	first := int64(0)
+	for sequence := range order.pending {
+		if first == 0 || sequence < first {
+			first = sequence
+		}
+	}
+	if first-1 == order.next {
+		LogError("[FILEWRITER] Chunk %d of %s did not arrive, writing on from chunk %d", order.next, h.name, first)
+	} else {
+		LogError("[FILEWRITER] Chunks %d to %d of %s did not arrive, writing on from chunk %d", order.next, first-1, h.name, first)
+	}
+	order.next = first
+}
+
+// reorderTimedOut gives up on the missing chunk once the held ones waited
+// reorderTimeout for it.
+func (h *fileHandle) reorderTimedOut() {
+	h.queueMu.Lock()
+	defer h.queueMu.Unlock()
+	h.order.timer = nil
+	if len(h.order.pending) == 0 {
+		return
+	}
+	h.skipMissing()
+	h.enqueueHeld()
+	if len(h.order.pending) > 0 {
+		h.order.timer = time.AfterFunc(reorderTimeout, h.reorderTimedOut)
+	}
+}
+
+// flushHeld queues every held chunk in order, when the file is closed.
+// h.queueMu must be held.
+func (h *fileHandle) flushHeld() {
+	order := &h.order
+	if order.timer != nil {
+		order.timer.Stop()
+		order.timer = nil
+	}
+	sequences := make([]int64, 0, len(order.pending))
+	for sequence := range order.pending {
+		sequences = append(sequences, sequence)
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+	for _, sequence := range sequences {
+		h.enqueue(order.pending[sequence])
+	}
+	order.pending = nil
+}
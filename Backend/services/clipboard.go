@@ -0,0 +1,12 @@
+package services
+
+import "errors"
+
+// ErrNoClipboard is returned by CopyToClipboard when this system has no
+// clipboard to copy to, e.g. in a container.
+var ErrNoClipboard = errors.New("no clipboard available on this system")
+
+// CopyToClipboard puts text on the system clipboard.
+func CopyToClipboard(text string) error {
+	return copyToClipboard(text)
+}
@@ -0,0 +1,15 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"os/exec"
+	"strings"
+)
+
+func copyToClipboard(text string) error {
+	cmd := exec.Command("pbcopy")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
@@ -0,0 +1,36 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// clipboardCommands are tried in order. Each keeps running in the background
+// to serve the clipboard, so their output is not waited for.
+var clipboardCommands = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+func copyToClipboard(text string) error {
+	if !hasDesktopSession() {
+		return ErrNoClipboard
+	}
+	for _, args := range clipboardCommands {
+		if args[0] == "wl-copy" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return ErrNoClipboard
+}
@@ -0,0 +1,60 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	openClipboard    = syscall.NewLazyDLL("user32.dll").NewProc("OpenClipboard")
+	closeClipboard   = syscall.NewLazyDLL("user32.dll").NewProc("CloseClipboard")
+	emptyClipboard   = syscall.NewLazyDLL("user32.dll").NewProc("EmptyClipboard")
+	setClipboardData = syscall.NewLazyDLL("user32.dll").NewProc("SetClipboardData")
+	globalAlloc      = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalAlloc")
+	globalFree       = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalFree")
+	globalLock       = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalLock")
+	globalUnlock     = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalUnlock")
+	moveMemory       = syscall.NewLazyDLL("kernel32.dll").NewProc("RtlMoveMemory")
+)
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+// copyToClipboard copies the text as UTF-16. The clipboard owns the memory
+// once SetClipboardData succeeds; until then it is ours to free.
+func copyToClipboard(text string) error {
+	data, err := syscall.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	if r, _, err := openClipboard.Call(0); r == 0 {
+		return fmt.Errorf("failed to open the clipboard: %w", err)
+	}
+	defer closeClipboard.Call()
+	emptyClipboard.Call()
+
+	size := uintptr(len(data) * 2)
+	mem, _, err := globalAlloc.Call(gmemMoveable, size)
+	if mem == 0 {
+		return fmt.Errorf("failed to allocate clipboard memory: %w", err)
+	}
+	ptr, _, err := globalLock.Call(mem)
+	if ptr == 0 {
+		globalFree.Call(mem)
+		return fmt.Errorf("failed to lock clipboard memory: %w", err)
+	}
+	moveMemory.Call(ptr, uintptr(unsafe.Pointer(&data[0])), size)
+	globalUnlock.Call(mem)
+
+	if r, _, err := setClipboardData.Call(cfUnicodeText, mem); r == 0 {
+		globalFree.Call(mem)
+		return fmt.Errorf("failed to set the clipboard: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	// Windows has no time zone database of its own, and slim container
+	// images often lack one, so the zones are built in.
+	_ "time/tzdata"
+)
+
+const (
+	// DefaultTimeFormat writes start times as e.g. 2024-03-09_14-05-30.
+	DefaultTimeFormat = "YYYY-MM-DD_HH-mm-ss"
+	localZone         = "local"
+)
+
+// timeFormatTokens are the fields a time format may use, longest first so
+// that "SSS" is not read as three seconds fields.
+var timeFormatTokens = []struct {
+	token  string
+	layout string
+}{
+	{"YYYY", "2006"}, {"SSS", ".000"}, {"MM", "01"}, {"DD", "02"},
+	{"HH", "15"}, {"hh", "03"}, {"mm", "04"}, {"ss", "05"}, {"A", "PM"},
+}
+
+// Clock says which time zone and format recording start times are shown in,
+// in file names and in the UI.
+type Clock struct {
+	// Zone is "local", the server's time zone, or an IANA name such as
+	// "Europe/Berlin" or "UTC".
+	Zone string `json:"zone"`
+	// Format writes wall-clock start times with the tokens YYYY, MM, DD, HH
+	// (24-hour), hh (12-hour), mm, ss, SSS (milliseconds) and A (AM/PM).
+	Format string `json:"format"`
+	// WallClockNames makes {timestamp} in naming templates the start time in
+	// Zone and Format instead of milliseconds since the epoch.
+	WallClockNames bool `json:"wallClockNames"`
+	// Hour12 shows times in the UI with a 12-hour clock.
+	Hour12 bool `json:"hour12"`
+
+	location *time.Location
+}
+
+// LoadClockFromEnv reads TIME_ZONE, TIME_FORMAT, TIME_FILE_TIMESTAMP ("epoch"
+// or "local") and TIME_CLOCK ("24h" or "12h").
+func LoadClockFromEnv() (Clock, error) {
+	clock := Clock{
+		Zone:   strings.TrimSpace(os.Getenv("TIME_ZONE")),
+		Format: strings.TrimSpace(os.Getenv("TIME_FORMAT")),
+	}
+	if clock.Zone == "" {
+		clock.Zone = localZone
+	}
+	if clock.Format == "" {
+		clock.Format = DefaultTimeFormat
+	}
+
+	location, err := parseTimeZone(clock.Zone)
+	if err != nil {
+		return Clock{}, err
+	}
+	clock.location = location
+	if err := validateTimeFormat(clock.Format); err != nil {
+		return Clock{}, err
+	}
+
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("TIME_FILE_TIMESTAMP"))); v {
+	case "", "epoch":
+	case "local":
+		clock.WallClockNames = true
+	default:
+		return Clock{}, fmt.Errorf("invalid TIME_FILE_TIMESTAMP %q (expected epoch or local)", v)
+	}
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("TIME_CLOCK"))); v {
+	case "", "24h":
+	case "12h":
+		clock.Hour12 = true
+	default:
+		return Clock{}, fmt.Errorf("invalid TIME_CLOCK %q (expected 24h or 12h)", v)
+	}
+	return clock, nil
+}
+
+func parseTimeZone(zone string) (*time.Location, error) {
+	if strings.EqualFold(zone, localZone) {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q (expected local or a name such as Europe/Berlin)", zone)
+	}
+	return location, nil
+}
+
+// validateTimeFormat rejects formats that could not be part of a file name.
+func validateTimeFormat(format string) error {
+	if strings.ContainsAny(format, `/\:`) {
+		return fmt.Errorf("time format %q must not contain '/', '\\' or ':'", format)
+	}
+	return nil
+}
+
+// In returns t in the clock's time zone. The zero Clock uses the server's.
+func (c Clock) In(t time.Time) time.Time {
+	if c.location == nil {
+		return t.Local()
+	}
+	return t.In(c.location)
+}
+
+// FormatTime writes t in the clock's time zone and format.
+func (c Clock) FormatTime(t time.Time) string {
+	format := c.Format
+	if format == "" {
+		format = DefaultTimeFormat
+	}
+	t = c.In(t)
+
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		matched := false
+		for _, f := range timeFormatTokens {
+			if strings.HasPrefix(format[i:], f.token) {
+				// Milliseconds only format after a dot, which is dropped.
+				b.WriteString(strings.TrimPrefix(t.Format(f.layout), "."))
+				i += len(f.token)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(format[i])
+			i++
+		}
+	}
+	return b.String()
+}
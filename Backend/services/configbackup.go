@@ -0,0 +1,393 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ConfigBackupVersion is the format of the backups Export writes.
+	ConfigBackupVersion = 1
+	backupKDF           = "pbkdf2-sha256"
+)
+
+// ErrWrongPassphrase is returned by ConfigTransfer.Import when the
+// passphrase does not open the backup's credentials.
+var ErrWrongPassphrase = errors.New("wrong passphrase for the backup's credentials")
+
+// secretConfigKeys are settings that hold credentials. They are only
+// exported encrypted, along with the tokens and the UI password, and saved in
+// the SecretStore rather than in settings.json.
+var secretConfigKeys = map[string]bool{
+	"auth.api_token":                true,
+	"auth.ui_password_hash":         true,
+	"auth.recording_signing_secret": true,
+	"webhooks.secret":               true,
+}
+
+// fileOnlyConfigKeys are settings only the config file and the environment
+// set. The hooks run commands on the server, so they are neither exported,
+// nor imported from a backup, nor saved in settings.json, which are all in
+// reach of the API.
+var fileOnlyConfigKeys = map[string]bool{
+	"hooks.on_start":            true,
+	"hooks.on_chunk_error":      true,
+	"hooks.on_finalize":         true,
+	"hooks.on_postprocess_done": true,
+	"hooks.timeout_seconds":     true,
+}
+
+// ConfigBackup is the configuration of one installation, to restore after a
+// reinstall or to set up another machine the same way.
+type ConfigBackup struct {
+	Version    int       `json:"version"`
+	AppVersion string    `json:"appVersion"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// Settings are the effective values of the config keys, including those
+	// from the config file and the environment.
+	Settings map[string]string `json:"settings"`
+	// Theme is only read from backups made before Preferences existed.
+	Theme         string         `json:"theme,omitempty"`
+	Preferences   *UIPreferences `json:"preferences,omitempty"`
+	Profiles      []Profile      `json:"profiles"`
+	ActiveProfile string         `json:"activeProfile"`
+	// Secrets holds the credentials, sealed with the export passphrase. It is
+	// absent when the backup was made without one.
+	Secrets *SealedSecrets `json:"secrets,omitempty"`
+}
+
+// SealedSecrets is backupSecrets encrypted with AES-256-GCM under a key
+// derived from the passphrase with PBKDF2-SHA256.
+type SealedSecrets struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// backupSecrets are the credentials a backup can carry.
+type backupSecrets struct {
+	Settings       map[string]string `json:"settings,omitempty"`
+	APIToken       string            `json:"apiToken,omitempty"`
+	UIPasswordHash string            `json:"uiPasswordHash,omitempty"`
+	Tokens         []APIToken        `json:"tokens,omitempty"`
+}
+
+// ConfigInvalidError is returned by ConfigTransfer.Import when the backup's
+// settings do not pass validation on this machine. Nothing is imported.
+type ConfigInvalidError struct {
+	Validation ConfigValidation
+}
+
+func (e *ConfigInvalidError) Error() string {
+	problems := make([]string, 0, len(e.Validation.Errors))
+	for _, p := range e.Validation.Errors {
+		problems = append(problems, p.Key+": "+p.Message)
+	}
+	return "invalid settings in backup: " + strings.Join(problems, "; ")
+}
+
+// ConfigImportReport says what ConfigTransfer.Import changed.
+type ConfigImportReport struct {
+	Settings []string `json:"settings"`
+	// RestartRequired are the imported settings that only take effect after
+	// a restart.
+	RestartRequired []string `json:"restartRequired"`
+	Profiles        []string `json:"profiles"`
+	Tokens          int      `json:"tokens"`
+	APIToken        bool     `json:"apiToken"`
+	UIPassword      bool     `json:"uiPassword"`
+	// Skipped explains what in the backup was left out.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// ConfigTransfer exports the settings, profiles and credentials into a
+// ConfigBackup and imports them again.
+type ConfigTransfer struct {
+	settings       *SettingsStore
+	file           *ConfigFile
+	profiles       *ProfileStore
+	tokens         *TokenStore
+	master         *MasterToken
+	uiPasswordPath string
+	onImport       []func(changed []string)
+	mu             sync.Mutex
+}
+
+// NewConfigTransfer creates a ConfigTransfer. file is the config file in use,
+// or nil, and uiPasswordPath is where the UI password hash is stored.
+func NewConfigTransfer(settings *SettingsStore, file *ConfigFile, profiles *ProfileStore, tokens *TokenStore, master *MasterToken, uiPasswordPath string) *ConfigTransfer {
+	return &ConfigTransfer{
+		settings:       settings,
+		file:           file,
+		profiles:       profiles,
+		tokens:         tokens,
+		master:         master,
+		uiPasswordPath: uiPasswordPath,
+	}
+}
+
+// OnImport registers fn to be called with the keys of the imported settings
+// that were applied, so that those that can change while running take effect.
+func (ct *ConfigTransfer) OnImport(fn func(changed []string)) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.onImport = append(ct.onImport, fn)
+}
+
+// Export returns the current configuration. The credentials are included,
+// sealed with passphrase, only when passphrase is not empty.
+func (ct *ConfigTransfer) Export(passphrase string) (ConfigBackup, error) {
+	profiles, active := ct.profiles.List()
+	prefs := ct.settings.Preferences()
+	backup := ConfigBackup{
+		Version:       ConfigBackupVersion,
+		AppVersion:    Version,
+		ExportedAt:    time.Now().UTC(),
+		Settings:      make(map[string]string),
+		Preferences:   &prefs,
+		Profiles:      profiles,
+		ActiveProfile: active,
+	}
+
+	secrets := backupSecrets{Settings: make(map[string]string)}
+	for key, env := range configKeys {
+		value := os.Getenv(env)
+		switch {
+		case value == "" || key == "paths.config":
+			// The config directory is where this backup would be restored to.
+		case fileOnlyConfigKeys[key]:
+		case secretConfigKeys[key]:
+			secrets.Settings[key] = value
+		default:
+			backup.Settings[key] = value
+		}
+	}
+	if passphrase == "" {
+		return backup, nil
+	}
+
+	// Both are exported in their own right below.
+	delete(secrets.Settings, "auth.api_token")
+	delete(secrets.Settings, "auth.ui_password_hash")
+	hash, err := ReadUIPasswordHash(ct.uiPasswordPath)
+	if err != nil {
+		return ConfigBackup{}, err
+	}
+	secrets.APIToken = ct.master.Value()
+	secrets.UIPasswordHash = hash
+	secrets.Tokens = ct.tokens.Export()
+
+	sealed, err := sealSecrets(secrets, passphrase)
+	if err != nil {
+		return ConfigBackup{}, err
+	}
+	backup.Secrets = sealed
+	return backup, nil
+}
+
+// Import applies backup on top of the current configuration. Its settings
+// are checked with validate first and nothing changes if they fail. Profiles
+// and tokens are added to the existing ones, replacing profiles of the same
+// name. The credentials are only imported when passphrase is given.
+func (ct *ConfigTransfer) Import(backup ConfigBackup, passphrase string, validate func(values map[string]string) ConfigValidation) (ConfigImportReport, error) {
+	report := ConfigImportReport{Settings: []string{}, RestartRequired: []string{}, Profiles: []string{}}
+	if backup.Version == 0 {
+		return report, fmt.Errorf("not a configuration backup")
+	}
+	if backup.Version > ConfigBackupVersion {
+		return report, fmt.Errorf("backup format %d is newer than this version supports (%d)", backup.Version, ConfigBackupVersion)
+	}
+
+	var secrets backupSecrets
+	switch {
+	case backup.Secrets == nil:
+	case passphrase == "":
+		report.Skipped = append(report.Skipped, "credentials: no passphrase given")
+	default:
+		opened, err := openSecrets(backup.Secrets, passphrase)
+		if err != nil {
+			return report, err
+		}
+		secrets = opened
+	}
+
+	values := make(map[string]string, len(backup.Settings)+len(secrets.Settings))
+	for key, value := range backup.Settings {
+		// Backups made before webhooks.secret counted as a credential carry
+		// it in the clear.
+		if secretConfigKeys[key] && key != "webhooks.secret" {
+			return report, fmt.Errorf("%s must only be in the encrypted part of a backup", key)
+		}
+		values[key] = value
+	}
+	for key, value := range secrets.Settings {
+		values[key] = value
+	}
+	for key := range values {
+		if fileOnlyConfigKeys[key] {
+			return report, fmt.Errorf("%s can only be set in the config file or the environment", key)
+		}
+	}
+	delete(values, "paths.config")
+	if result := validate(values); !result.Valid {
+		return report, &ConfigInvalidError{Validation: result}
+	}
+	for _, p := range backup.Profiles {
+		if err := validateProfile(p); err != nil {
+			return report, fmt.Errorf("invalid profile %q: %w", p.Name, err)
+		}
+	}
+	if backup.Preferences != nil {
+		if err := backup.Preferences.Validate(); err != nil {
+			return report, fmt.Errorf("invalid preferences: %w", err)
+		}
+	}
+
+	if err := ct.settings.Save(values); err != nil {
+		return report, err
+	}
+	applied := make(map[string]bool)
+	for _, key := range ct.settings.Apply(ct.file) {
+		applied[key] = true
+	}
+	for key := range values {
+		if applied[key] {
+			report.Settings = append(report.Settings, key)
+		} else {
+			report.Skipped = append(report.Skipped, key+": set in the environment, which takes precedence")
+		}
+	}
+	sort.Strings(report.Settings)
+	report.RestartRequired = append(report.RestartRequired, restartOnly(report.Settings)...)
+	switch {
+	case backup.Preferences != nil:
+		if err := ct.settings.SetPreferences(*backup.Preferences); err != nil {
+			return report, err
+		}
+	case backup.Theme != "":
+		if err := ct.settings.SetTheme(backup.Theme); err != nil {
+			return report, err
+		}
+	}
+
+	for _, p := range backup.Profiles {
+		if err := ct.profiles.Put(p); err != nil {
+			return report, fmt.Errorf("failed to import profile %q: %w", p.Name, err)
+		}
+		report.Profiles = append(report.Profiles, p.Name)
+	}
+	if backup.ActiveProfile != "" {
+		if err := ct.profiles.Activate(backup.ActiveProfile); err != nil {
+			report.Skipped = append(report.Skipped, "active profile: "+err.Error())
+		}
+	}
+
+	if len(secrets.Tokens) > 0 {
+		added, err := ct.tokens.Import(secrets.Tokens)
+		if err != nil {
+			return report, fmt.Errorf("failed to import tokens: %w", err)
+		}
+		report.Tokens = added
+	}
+	if secrets.APIToken != "" && secrets.APIToken != ct.master.Value() {
+		if err := ct.master.Set(secrets.APIToken); err != nil {
+			report.Skipped = append(report.Skipped, "API token: "+err.Error())
+		} else {
+			report.APIToken = true
+		}
+	}
+	if secrets.UIPasswordHash != "" {
+		if err := SetUIPasswordHash(ct.uiPasswordPath, secrets.UIPasswordHash); err != nil {
+			return report, fmt.Errorf("failed to import UI password: %w", err)
+		}
+		report.UIPassword = true
+		report.RestartRequired = append(report.RestartRequired, "auth.ui_password_hash")
+	}
+
+	sort.Strings(report.Skipped)
+	LogInfo("[CONFIG] Imported backup from version %s (settings: %s)", backup.AppVersion, strings.Join(report.Settings, ", "))
+	if len(report.RestartRequired) > 0 {
+		LogInfo("[CONFIG] Restart required to apply: %s", strings.Join(report.RestartRequired, ", "))
+	}
+
+	ct.mu.Lock()
+	callbacks := append([]func(changed []string){}, ct.onImport...)
+	ct.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(report.Settings)
+	}
+	return report, nil
+}
+
+func backupKey(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealSecrets(secrets backupSecrets, passphrase string) (*SealedSecrets, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	sealed := &SealedSecrets{KDF: backupKDF, Iterations: passwordIterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(sealed.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := backupKey(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(sealed.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed.Ciphertext = aead.Seal(nil, sealed.Nonce, plaintext, nil)
+	return sealed, nil
+}
+
+func openSecrets(sealed *SealedSecrets, passphrase string) (backupSecrets, error) {
+	if sealed.KDF != backupKDF || sealed.Iterations <= 0 {
+		return backupSecrets{}, fmt.Errorf("unsupported backup encryption %q", sealed.KDF)
+	}
+	aead, err := backupKey(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return backupSecrets{}, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return backupSecrets{}, fmt.Errorf("invalid backup nonce")
+	}
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, nil)
+	if err != nil {
+		return backupSecrets{}, ErrWrongPassphrase
+	}
+	var secrets backupSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return backupSecrets{}, fmt.Errorf("failed to parse backup credentials: %w", err)
+	}
+	for key := range secrets.Settings {
+		if !secretConfigKeys[key] {
+			return backupSecrets{}, fmt.Errorf("unexpected setting %q in backup credentials", key)
+		}
+	}
+	return secrets, nil
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configKeys maps each config file key ("section.key") to the environment
+// variable it sets. Settings are read from the environment everywhere, so the
+// file only supplies values for variables that are not already set; the
+// environment always wins. Each key can also be set as RECORDER_<SECTION>_<KEY>
+// (see ApplyRecorderEnv).
+var configKeys = map[string]string{
+	"server.port":       "SERVER_PORT",
+	"server.port_range": "SERVER_PORT_RANGE",
+	"server.bind":       "BIND_ADDRESS",
+	"server.socket":     "LISTEN_SOCKET",
+	"server.mdns":       "MDNS_ENABLED",
+	"server.container":  "CONTAINER_MODE",
+
+	"nat.enabled":       "NAT_MAPPING",
+	"nat.external_port": "NAT_EXTERNAL_PORT",
+	"nat.gateway":       "NAT_GATEWAY",
+
+	"paths.recordings": "RECORDINGS_DIR",
+	"paths.logs":       "LOG_DIR",
+	"paths.config":     "CONFIG_DIR",
+
+	"ffmpeg.path":            "FFMPEG_PATH",
+	"ffmpeg.ffprobe":         "FFPROBE_PATH",
+	"ffmpeg.proxy":           "FFMPEG_PROXY",
+	"ffmpeg.download_url":    "FFMPEG_DOWNLOAD_URL",
+	"ffmpeg.download_sha256": "FFMPEG_DOWNLOAD_SHA256",
+	"ffmpeg.archive":         "FFMPEG_ARCHIVE",
+	"ffmpeg.hls":             "HLS_OUTPUT",
+
+	"capture.browser": "CAPTURE_BROWSER",
+
+	"proxy.http":     "HTTP_PROXY",
+	"proxy.https":    "HTTPS_PROXY",
+	"proxy.no_proxy": "NO_PROXY",
+
+	"time.zone":           "TIME_ZONE",
+	"time.format":         "TIME_FORMAT",
+	"time.file_timestamp": "TIME_FILE_TIMESTAMP",
+	"time.clock":          "TIME_CLOCK",
+
+	"notifications.recording_started": "NOTIFY_RECORDING_STARTED",
+	"notifications.recording_stopped": "NOTIFY_RECORDING_STOPPED",
+	"notifications.post_processing":   "NOTIFY_POST_PROCESSING",
+	"notifications.low_disk":          "NOTIFY_LOW_DISK",
+	"notifications.write_failures":    "NOTIFY_WRITE_FAILURES",
+
+	"webhooks.urls":   "WEBHOOK_URLS",
+	"webhooks.secret": "WEBHOOK_SECRET",
+	"webhooks.events": "WEBHOOK_EVENTS",
+
+	"hooks.on_start":            "HOOK_ON_START",
+	"hooks.on_chunk_error":      "HOOK_ON_CHUNK_ERROR",
+	"hooks.on_finalize":         "HOOK_ON_FINALIZE",
+	"hooks.on_postprocess_done": "HOOK_ON_POSTPROCESS_DONE",
+	"hooks.timeout_seconds":     "HOOK_TIMEOUT_SECONDS",
+
+	"logging.level":  "LOG_LEVEL",
+	"logging.output": "LOG_OUTPUT",
+
+	"limits.ip_rps":               "RATE_LIMIT_IP_RPS",
+	"limits.ip_burst":             "RATE_LIMIT_IP_BURST",
+	"limits.session_rps":          "RATE_LIMIT_SESSION_RPS",
+	"limits.session_burst":        "RATE_LIMIT_SESSION_BURST",
+	"limits.lockout_attempts":     "AUTH_LOCKOUT_ATTEMPTS",
+	"limits.min_free_disk_gb":     "ALERT_MIN_FREE_DISK_GB",
+	"limits.max_write_failures":   "ALERT_MAX_WRITE_FAILURES",
+	"limits.max_session_hours":    "ALERT_MAX_SESSION_HOURS",
+	"limits.max_chunk_mb":         "MAX_CHUNK_MB",
+	"limits.session_idle_minutes": "SESSION_IDLE_MINUTES",
+	"limits.max_sessions":         "MAX_SESSIONS",
+	"limits.post_processing_jobs": "POST_PROCESSING_JOBS",
+	"limits.max_file_mb":          "MAX_FILE_MB",
+	"limits.recovery":             "RECOVERY_POLICY",
+
+	"auth.api_token":                "API_TOKEN",
+	"auth.ui_password_hash":         "UI_PASSWORD_HASH",
+	"auth.allowed_origins":          "ALLOWED_ORIGINS",
+	"auth.recording_signing_secret": "RECORDING_SIGNING_SECRET",
+
+	"update.feed_url": "UPDATE_FEED_URL",
+	"update.auto":     "UPDATE_AUTO",
+	"update.proxy":    "UPDATE_PROXY",
+
+	"tls.enabled":        "TLS_ENABLED",
+	"tls.cert_file":      "TLS_CERT_FILE",
+	"tls.key_file":       "TLS_KEY_FILE",
+	"tls.client_ca_file": "TLS_CLIENT_CA_FILE",
+	"tls.client_auth":    "TLS_CLIENT_AUTH",
+}
+
+// defaultConfigFiles are tried in order when CONFIG_FILE is not set.
+var defaultConfigFiles = []string{
+	"config/recorder.toml",
+	"config/recorder.yaml",
+	"config/recorder.yml",
+}
+
+// ConfigFile is a parsed configuration file, flattened to "section.key" values.
+type ConfigFile struct {
+	Path   string
+	Values map[string]string
+	// owned are the environment variables Apply or Reload set from the file,
+	// which later reloads may change or unset.
+	owned map[string]bool
+}
+
+// FindConfigFile returns CONFIG_FILE, or the first default config file under
+// dir that exists, or "" when there is none.
+func FindConfigFile(dir string) string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	for _, path := range defaultConfigFiles {
+		path = filepath.Join(dir, path)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadConfigFile parses the TOML (.toml) or YAML (.yaml, .yml) file at path.
+// Only the subset needed for flat settings is supported: one level of
+// sections, scalar values and lists of scalars. Unknown keys are an error so
+// that typos are not silently ignored.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		values, err = parseTOML(string(data))
+	case ".yaml", ".yml":
+		values, err = parseYAML(string(data))
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q (use .toml, .yaml or .yml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for key := range values {
+		if _, ok := configKeys[key]; !ok {
+			return nil, fmt.Errorf("unknown setting %q in %s", key, path)
+		}
+	}
+	return &ConfigFile{Path: path, Values: values, owned: make(map[string]bool)}, nil
+}
+
+// Apply sets the environment variable of every setting in the file that is
+// not already set in the environment, and returns the keys it applied.
+func (c *ConfigFile) Apply() []string {
+	var applied []string
+	for key, value := range c.Values {
+		env := configKeys[key]
+		if _, set := os.LookupEnv(env); set {
+			continue
+		}
+		os.Setenv(env, value)
+		c.owned[env] = true
+		applied = append(applied, key)
+	}
+	sort.Strings(applied)
+	return applied
+}
+
+// Reload parses the file again and updates the environment variables it set,
+// unsetting those whose setting was removed. Variables set outside the file
+// still win. It returns the keys whose value changed.
+func (c *ConfigFile) Reload() ([]string, error) {
+	fresh, err := LoadConfigFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for key, env := range configKeys {
+		value, inFile := fresh.Values[key]
+		current, set := os.LookupEnv(env)
+		switch {
+		case set && !c.owned[env]:
+			continue
+		case !inFile:
+			if !set {
+				continue
+			}
+			os.Unsetenv(env)
+			delete(c.owned, env)
+		case set && current == value:
+			continue
+		default:
+			os.Setenv(env, value)
+			c.owned[env] = true
+		}
+		changed = append(changed, key)
+	}
+	c.Values = fresh.Values
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func parseTOML(text string) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid section header", n+1)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n+1)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		values[joinConfigKey(section, strings.TrimSpace(key))] = value
+	}
+	return values, nil
+}
+
+func parseYAML(text string) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	listKey := ""
+	var list []string
+	flushList := func() {
+		if listKey != "" {
+			values[listKey] = strings.Join(list, ",")
+		}
+		listKey, list = "", nil
+	}
+
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n+1)
+		}
+		indented := line != trimmed
+
+		if strings.HasPrefix(trimmed, "- ") {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item outside a list", n+1)
+			}
+			item, err := parseConfigValue(strings.TrimSpace(trimmed[2:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			list = append(list, item)
+			continue
+		}
+		flushList()
+
+		key, raw, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n+1)
+		}
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !indented {
+			section = ""
+		}
+		if raw == "" {
+			if !indented {
+				section = key
+			} else {
+				listKey = joinConfigKey(section, key)
+			}
+			continue
+		}
+
+		value, err := parseConfigValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		values[joinConfigKey(section, key)] = value
+	}
+	flushList()
+	return values, nil
+}
+
+// parseConfigValue turns a scalar or a [a, b] list into the string form the
+// environment variable expects; lists become comma-separated.
+func parseConfigValue(raw string) (string, error) {
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return "", fmt.Errorf("unterminated list")
+		}
+		var items []string
+		for _, item := range strings.Split(raw[1:len(raw)-1], ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			value, err := parseConfigScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, value)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return parseConfigScalar(raw)
+}
+
+func parseConfigScalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid quoted string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	}
+	return raw, nil
+}
+
+// stripComment removes a trailing # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func joinConfigKey(section, key string) string {
+	key = strings.ToLower(strings.Trim(key, `"'`))
+	if section == "" {
+		return key
+	}
+	return strings.ToLower(section) + "." + key
+}
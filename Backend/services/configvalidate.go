@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ffmpegCheckTimeout = 5 * time.Second
+
+// ConfigProblem is a setting ValidateConfig found a problem with.
+type ConfigProblem struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// ConfigValidation is the result of ValidateConfig. Errors are settings that
+// would not work; warnings would work but probably not as intended.
+type ConfigValidation struct {
+	Valid    bool            `json:"valid"`
+	Errors   []ConfigProblem `json:"errors"`
+	Warnings []ConfigProblem `json:"warnings"`
+}
+
+// RunningConfig is what the server currently uses, for proposed settings that
+// depend on settings left out of the proposal.
+type RunningConfig struct {
+	Bind          string
+	Port          int
+	RecordingsDir string
+	MinFreeDiskGB float64
+}
+
+// ValidateConfig checks proposed settings, given as config file keys
+// ("section.key"), without applying any of them: directories must be
+// writable, ports free, FFmpeg runnable and limits sane. The port the server
+// is listening on counts as free, as it is released on restart.
+func ValidateConfig(values map[string]string, running RunningConfig) ConfigValidation {
+	result := ConfigValidation{Errors: []ConfigProblem{}, Warnings: []ConfigProblem{}}
+	fail := func(key, format string, args ...interface{}) {
+		result.Errors = append(result.Errors, ConfigProblem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(key, format string, args ...interface{}) {
+		result.Warnings = append(result.Warnings, ConfigProblem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bind := running.Bind
+	if v, ok := values["server.bind"]; ok && v != "" {
+		bind = v
+	}
+
+	for _, key := range keys {
+		value := strings.TrimSpace(values[key])
+		if _, ok := configKeys[key]; !ok {
+			fail(key, "unknown setting")
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		switch key {
+		case "server.port":
+			port, err := parsePort(value)
+			if err != nil {
+				fail(key, "%v", err)
+			} else if port != running.Port && !hasProblem(result.Errors, "server.bind") {
+				if err := checkPortFree(bind, port); err != nil {
+					fail(key, "port %d is not available: %v", port, err)
+				}
+			}
+		case "server.port_range":
+			if _, _, err := parsePortRange(value); err != nil {
+				fail(key, "expected a range such as 8080-8090")
+			}
+		case "server.bind":
+			if err := checkPortFree(value, 0); err != nil {
+				fail(key, "cannot listen on %s: %v", value, err)
+			}
+		case "server.socket":
+			if err := checkWritableDir(filepath.Dir(value)); err != nil {
+				fail(key, "%v", err)
+			}
+		case "server.mdns", "server.container", "nat.enabled", "update.auto", "tls.enabled", "tls.client_auth",
+			"notifications.recording_started", "notifications.recording_stopped", "notifications.post_processing",
+			"notifications.low_disk", "notifications.write_failures", "ffmpeg.hls":
+			if !isConfigBool(value) {
+				fail(key, "must be true or false")
+			}
+		case "nat.external_port":
+			if _, err := parsePort(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "nat.gateway":
+			if net.ParseIP(value) == nil {
+				fail(key, "must be an IP address")
+			}
+		case "paths.recordings", "paths.logs", "paths.config":
+			if err := checkWritableDir(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "ffmpeg.path":
+			if err := checkFFmpeg(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "ffmpeg.ffprobe":
+			if _, _, err := detectBinary(DependencyFFprobe, value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "capture.browser":
+			if _, err := exec.LookPath(value); err != nil {
+				fail(key, "browser not found at %s", value)
+			}
+		case "time.zone":
+			if _, err := parseTimeZone(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "time.format":
+			if err := validateTimeFormat(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "time.file_timestamp":
+			switch strings.ToLower(value) {
+			case "epoch", "local":
+			default:
+				fail(key, "must be epoch or local")
+			}
+		case "time.clock":
+			switch strings.ToLower(value) {
+			case "24h", "12h":
+			default:
+				fail(key, "must be 24h or 12h")
+			}
+		case "logging.level":
+			switch strings.ToLower(value) {
+			case "debug", "info", "error":
+			default:
+				fail(key, "must be debug, info or error")
+			}
+		case "logging.output":
+			switch strings.ToLower(value) {
+			case "file", "stdout", "both":
+			default:
+				fail(key, "must be file, stdout or both")
+			}
+		case "limits.ip_rps", "limits.ip_burst", "limits.session_rps", "limits.session_burst",
+			"limits.min_free_disk_gb", "limits.max_session_hours", "limits.max_chunk_mb", "limits.session_idle_minutes":
+			if v, err := strconv.ParseFloat(value, 64); err != nil || v < 0 {
+				fail(key, "must be a number that is not negative")
+			}
+		case "limits.max_file_mb":
+			if v, err := strconv.ParseFloat(value, 64); err != nil || v < 0 || (v > 0 && v < MinMaxFileMB) {
+				fail(key, "must be 0 or at least %d", MinMaxFileMB)
+			}
+		case "limits.recovery":
+			if !IsRecoveryPolicy(strings.ToLower(value)) {
+				fail(key, "must be one of %s", strings.Join(RecoveryPolicies, ", "))
+			}
+		case "limits.lockout_attempts", "limits.max_write_failures", "limits.max_sessions", "limits.post_processing_jobs":
+			if v, err := strconv.ParseInt(value, 10, 64); err != nil || v < 0 {
+				fail(key, "must be a whole number that is not negative")
+			}
+		case "auth.ui_password_hash":
+			if err := checkPasswordHash(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "auth.allowed_origins":
+			for _, origin := range strings.Split(value, ",") {
+				origin = strings.TrimSpace(origin)
+				if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+					fail(key, "%q is not an origin such as https://example.com", origin)
+				}
+			}
+		case "webhooks.urls":
+			for _, webhook := range strings.Split(value, ",") {
+				webhook = strings.TrimSpace(webhook)
+				if u, err := url.Parse(webhook); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+					fail(key, "%q is not an http or https URL", webhook)
+				} else if u.Scheme == "http" {
+					warn(key, "%s receives recording events without TLS", webhook)
+				}
+			}
+		case "webhooks.events":
+			for _, event := range strings.Split(value, ",") {
+				if event = strings.TrimSpace(event); !isWebhookEvent(event) {
+					fail(key, "%q is not one of %s", event, strings.Join(WebhookEvents, ", "))
+				}
+			}
+		case "hooks.on_start", "hooks.on_chunk_error", "hooks.on_finalize", "hooks.on_postprocess_done":
+			if _, err := exec.LookPath(value); err != nil {
+				fail(key, "cannot run %s: %v", value, errors.Unwrap(err))
+			} else if !filepath.IsAbs(value) {
+				warn(key, "%s is looked up from the working directory and the PATH of the server; an absolute path is safer", value)
+			}
+		case "hooks.timeout_seconds":
+			if v, err := strconv.ParseFloat(value, 64); err != nil || v <= 0 {
+				fail(key, "must be a positive number")
+			}
+		case "update.feed_url":
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				fail(key, "must be an http or https URL")
+			} else if u.Scheme == "http" {
+				warn(key, "updates are downloaded without TLS")
+			}
+		case "ffmpeg.download_url":
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				fail(key, "must be an http or https URL")
+			} else if u.Scheme == "http" {
+				warn(key, "FFmpeg is downloaded without TLS")
+			}
+		case "ffmpeg.download_sha256":
+			if digest, err := hex.DecodeString(value); err != nil || len(digest) != sha256.Size {
+				fail(key, "must be a SHA-256 digest of 64 hexadecimal digits")
+			}
+		case "ffmpeg.archive":
+			if _, err := os.Stat(value); err != nil {
+				fail(key, "cannot read %s: %v", value, errors.Unwrap(err))
+			} else if archiveFormat(value) == "" {
+				fail(key, "must be a .zip, .tar, .tar.gz or .tar.xz archive")
+			}
+		case "proxy.http", "proxy.https":
+			if err := validateProxyURL(value); err != nil {
+				fail(key, "%v", err)
+			}
+		case "update.proxy", "ffmpeg.proxy":
+			if !strings.EqualFold(value, ProxyDirect) {
+				if err := validateProxyURL(value); err != nil {
+					fail(key, "%v (or %q to bypass the proxy)", err, ProxyDirect)
+				}
+			}
+		case "tls.cert_file", "tls.key_file", "tls.client_ca_file":
+			if _, err := os.Stat(value); err != nil {
+				fail(key, "cannot read %s: %v", value, errors.Unwrap(err))
+			}
+		}
+	}
+
+	cert, key := strings.TrimSpace(values["tls.cert_file"]), strings.TrimSpace(values["tls.key_file"])
+	if (cert == "") != (key == "") {
+		fail("tls.cert_file", "tls.cert_file and tls.key_file must be set together")
+	} else if cert != "" {
+		if _, err := tls.LoadX509KeyPair(cert, key); err != nil && !hasProblem(result.Errors, "tls.cert_file", "tls.key_file") {
+			fail("tls.cert_file", "certificate and key do not load: %v", err)
+		}
+	}
+
+	if !hasProblem(result.Errors, "paths.recordings") {
+		checkDiskQuota(values, running, warn)
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// checkDiskQuota warns when the recordings disk already has less free space
+// than the low disk space alert asks for, so the alert would fire at once.
+func checkDiskQuota(values map[string]string, running RunningConfig, warn func(key, format string, args ...interface{})) {
+	dir, minFree := running.RecordingsDir, running.MinFreeDiskGB
+	if v := strings.TrimSpace(values["paths.recordings"]); v != "" {
+		dir = v
+	}
+	if v, err := strconv.ParseFloat(strings.TrimSpace(values["limits.min_free_disk_gb"]), 64); err == nil {
+		minFree = v
+	}
+	if dir == "" || minFree <= 0 {
+		return
+	}
+	free, err := FreeDiskSpace(existingParent(dir))
+	if err != nil {
+		return
+	}
+	if freeGB := float64(free) / (1 << 30); freeGB < minFree {
+		warn("limits.min_free_disk_gb", "only %.1f GB is free on the recordings disk, below the %.1f GB alert threshold", freeGB, minFree)
+	}
+}
+
+func hasProblem(problems []ConfigProblem, keys ...string) bool {
+	for _, p := range problems {
+		for _, key := range keys {
+			if p.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("must be a port between 1 and 65535")
+	}
+	return port, nil
+}
+
+func isConfigBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on", "0", "false", "no", "off":
+		return true
+	}
+	return false
+}
+
+// checkPortFree listens on bind:port and closes the listener again. Port 0
+// only checks that bind is an address of this machine.
+func checkPortFree(bind string, port int) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(port)))
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Err != nil {
+			return opErr.Err
+		}
+		return err
+	}
+	return listener.Close()
+}
+
+// checkWritableDir checks that dir, or the directory it would be created in,
+// is a directory this process can create files in. Nothing is left behind.
+func checkWritableDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid path: %v", err)
+	}
+	parent := existingParent(abs)
+	info, err := os.Stat(parent)
+	if err != nil {
+		return fmt.Errorf("cannot access %s: %v", parent, errors.Unwrap(err))
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", parent)
+	}
+	file, err := os.CreateTemp(parent, ".recorder-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", parent)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
+
+// existingParent returns path, or its nearest ancestor that exists.
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// checkFFmpeg runs "<path> -version" to make sure FFmpeg can be started.
+func checkFFmpeg(path string) error {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return fmt.Errorf("ffmpeg not found at %s", path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegCheckTimeout)
+	defer cancel()
+	if err := exec.CommandContext(ctx, resolved, "-version").Run(); err != nil {
+		return fmt.Errorf("ffmpeg does not run: %v", err)
+	}
+	return nil
+}
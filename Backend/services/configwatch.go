@@ -0,0 +1,138 @@
+package services
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const configWatchInterval = 2 * time.Second
+
+// restartOnlyPrefixes are settings that are read once at startup; changing
+// them in the file only takes effect after a restart.
+var restartOnlyPrefixes = []string{"server.", "tls.", "auth.", "paths.logs", "paths.config", "logging.output", "limits.max_chunk_mb", "update.", "nat.", "proxy.", "ffmpeg.proxy"}
+
+// ConfigWatcher reloads a ConfigFile when it changes on disk or the process
+// receives SIGHUP, and hands the changed keys to the registered callbacks.
+type ConfigWatcher struct {
+	file     *ConfigFile
+	modTime  time.Time
+	onReload []func(changed []string)
+	mu       sync.Mutex
+	stopChan chan struct{}
+}
+
+// NewConfigWatcher creates a watcher for file. file may be nil when no config
+// file is in use, in which case the watcher does nothing.
+func NewConfigWatcher(file *ConfigFile) *ConfigWatcher {
+	cw := &ConfigWatcher{file: file, stopChan: make(chan struct{})}
+	if file != nil {
+		cw.modTime = configModTime(file.Path)
+	}
+	return cw
+}
+
+// OnReload registers fn to be called with the keys that changed after each
+// successful reload. It must be called before Start.
+func (cw *ConfigWatcher) OnReload(fn func(changed []string)) {
+	cw.onReload = append(cw.onReload, fn)
+}
+
+// Path returns the watched file, or "" when there is none.
+func (cw *ConfigWatcher) Path() string {
+	if cw == nil || cw.file == nil {
+		return ""
+	}
+	return cw.file.Path
+}
+
+func (cw *ConfigWatcher) Start() {
+	if cw.file == nil {
+		return
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer CapturePanic()
+		defer signal.Stop(hangup)
+
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cw.mu.Lock()
+				modified := !configModTime(cw.file.Path).Equal(cw.modTime)
+				cw.mu.Unlock()
+				if modified {
+					cw.reloadAndLog("file changed")
+				}
+			case <-hangup:
+				cw.reloadAndLog("SIGHUP")
+			case <-cw.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (cw *ConfigWatcher) Stop() {
+	close(cw.stopChan)
+}
+
+// Reload re-reads the config file now and returns the keys that changed.
+// If the file no longer parses, the current settings are kept.
+func (cw *ConfigWatcher) Reload() ([]string, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.modTime = configModTime(cw.file.Path)
+	changed, err := cw.file.Reload()
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	LogInfo("[CONFIG] Reloaded %s (changed: %s)", cw.file.Path, strings.Join(changed, ", "))
+	if pending := restartOnly(changed); len(pending) > 0 {
+		LogInfo("[CONFIG] Restart required to apply: %s", strings.Join(pending, ", "))
+	}
+	for _, fn := range cw.onReload {
+		fn(changed)
+	}
+	return changed, nil
+}
+
+func (cw *ConfigWatcher) reloadAndLog(reason string) {
+	if _, err := cw.Reload(); err != nil {
+		LogError("[CONFIG] Failed to reload config (%s), keeping current settings: %v", reason, err)
+	}
+}
+
+func restartOnly(keys []string) []string {
+	var pending []string
+	for _, key := range keys {
+		for _, prefix := range restartOnlyPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				pending = append(pending, key)
+				break
+			}
+		}
+	}
+	return pending
+}
+
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,16 @@
+package services
+
+import "os"
+
+// ContainerDataDir holds the recordings, logs and config in container mode,
+// so the image itself can be mounted read-only with a volume here.
+const ContainerDataDir = "/data"
+
+// ContainerMode reports whether CONTAINER_MODE (or --container) asks for
+// container-friendly defaults: no desktop window, data under ContainerDataDir,
+// logs on stdout, listening on all interfaces, and none of the features that
+// assume a desktop (self-update, start at login, FFmpeg download, discovery
+// file, mDNS).
+func ContainerMode() bool {
+	return isTruthy(os.Getenv("CONTAINER_MODE"))
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	crashReportPrefix   = "crash_"
+	crashReportSuffix   = ".log"
+	crashReviewedSuffix = ".reviewed.log"
+)
+
+// CrashReport describes a crash report file in the logs directory.
+type CrashReport struct {
+	Name     string    `json:"name"`
+	Time     time.Time `json:"time"`
+	Size     int64     `json:"size"`
+	Reviewed bool      `json:"reviewed"`
+}
+
+type crashReporter struct {
+	logDir   string
+	recorder *RecorderService
+	mu       sync.Mutex
+}
+
+var globalCrashReporter *crashReporter
+
+// InitCrashReporter sets where crash reports are written and which recorder's
+// sessions they describe. Must be called before CapturePanic is deferred.
+func InitCrashReporter(logDir string, recorder *RecorderService) {
+	globalCrashReporter = &crashReporter{logDir: logDir, recorder: recorder}
+}
+
+// CapturePanic must be deferred directly. If the goroutine is panicking it writes a
+// crash report containing the panic value, every goroutine's stack, the active
+// sessions and the last log lines, then re-panics so the process still terminates.
+func CapturePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if path, err := writeCrashReport(r, debug.Stack()); err != nil {
+		LogError("[CRASH] Failed to write crash report: %v", err)
+	} else {
+		LogError("[CRASH] Panic captured, report written to %s", path)
+	}
+	CloseLogger()
+	panic(r)
+}
+
+func writeCrashReport(value interface{}, stack []byte) (string, error) {
+	cr := globalCrashReporter
+	if cr == nil {
+		return "", fmt.Errorf("crash reporter not initialized")
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	now := time.Now()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Crash report\n")
+	fmt.Fprintf(&b, "Time:      %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Version:   %s (commit %s)\n", Version, BuildCommit())
+	fmt.Fprintf(&b, "Platform:  %s/%s %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	fmt.Fprintf(&b, "Uptime:    %s\n", Uptime().Round(time.Second))
+	fmt.Fprintf(&b, "Panic:     %v\n", value)
+
+	fmt.Fprintf(&b, "\n=== Panicking goroutine ===\n%s\n", stack)
+
+	all := make([]byte, 1<<20)
+	all = all[:runtime.Stack(all, true)]
+	fmt.Fprintf(&b, "\n=== All goroutines ===\n%s\n", all)
+
+	fmt.Fprintf(&b, "\n=== Active sessions ===\n")
+	if cr.recorder != nil {
+		sessions := cr.recorder.GetAllSessionInfo()
+		if len(sessions) == 0 {
+			fmt.Fprintf(&b, "(none)\n")
+		}
+		for _, info := range sessions {
+			fmt.Fprintf(&b, "tab %d  name=%q  started=%s  bytes=%d\n",
+				info.TabID, info.Name, info.StartTime.Format(time.RFC3339), info.BytesWritten)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n=== Last log lines ===\n")
+	for _, line := range RecentLogLines() {
+		b.WriteString(line)
+	}
+
+	if err := os.MkdirAll(cr.logDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+	name := crashReportPrefix + now.Format("2006-01-02_15-04-05") + crashReportSuffix
+	path := filepath.Join(cr.logDir, name)
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	return path, nil
+}
+
+// ListCrashReports returns every crash report in the logs directory, newest first.
+func ListCrashReports() ([]CrashReport, error) {
+	cr := globalCrashReporter
+	if cr == nil {
+		return nil, fmt.Errorf("crash reporter not initialized")
+	}
+
+	entries, err := os.ReadDir(cr.logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []CrashReport{}, nil
+		}
+		return nil, err
+	}
+
+	reports := make([]CrashReport, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, crashReportPrefix) || !strings.HasSuffix(name, crashReportSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		reports = append(reports, CrashReport{
+			Name:     name,
+			Time:     info.ModTime(),
+			Size:     info.Size(),
+			Reviewed: strings.HasSuffix(name, crashReviewedSuffix),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Time.After(reports[j].Time)
+	})
+	return reports, nil
+}
+
+// CrashReportPath resolves name to a crash report inside the logs directory,
+// rejecting anything that is not a plain crash report file name.
+func CrashReportPath(name string) (string, error) {
+	cr := globalCrashReporter
+	if cr == nil {
+		return "", fmt.Errorf("crash reporter not initialized")
+	}
+	if name != filepath.Base(name) || !strings.HasPrefix(name, crashReportPrefix) || !strings.HasSuffix(name, crashReportSuffix) {
+		return "", fmt.Errorf("invalid crash report name: %s", name)
+	}
+	path := filepath.Join(cr.logDir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// MarkCrashReportReviewed renames a crash report so it is no longer offered on startup.
+func MarkCrashReportReviewed(name string) error {
+	path, err := CrashReportPath(name)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, crashReviewedSuffix) {
+		return nil
+	}
+	reviewed := strings.TrimSuffix(path, crashReportSuffix) + crashReviewedSuffix
+	return os.Rename(path, reviewed)
+}
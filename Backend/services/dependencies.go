@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Programs the server depends on, as named in the DependencyRegistry.
+const (
+	DependencyFFmpeg = "ffmpeg"
+	// DependencyFFprobe reads the duration and streams of recordings; it is
+	// not always shipped with FFmpeg, e.g. with a static ffmpeg binary.
+	DependencyFFprobe = "ffprobe"
+)
+
+// MinFFmpegVersion is the oldest FFmpeg release whose filters and muxer
+// options the server uses, e.g. temp_file for HLS; older ones are reported as
+// outdated.
+const MinFFmpegVersion = "4.4"
+
+// Dependency is a program the server runs, as it was last detected.
+type Dependency struct {
+	Name string `json:"name"`
+	// Path is where the binary was found, empty when it was not.
+	Path string `json:"path,omitempty"`
+	// Version is what the binary reports with -version, e.g. "6.1.1".
+	Version   string `json:"version,omitempty"`
+	Installed bool   `json:"installed"`
+	// Outdated is set for releases older than MinFFmpegVersion; builds from
+	// git, which have no release number, never are.
+	Outdated bool `json:"outdated,omitempty"`
+	// Managed is set for the static build the server installed itself (see
+	// ManagedFFmpegDir), which it can upgrade.
+	Managed bool `json:"managed,omitempty"`
+	// Error says why the binary is missing or does not run.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// DependencyRegistry keeps the path and version of each program the server
+// depends on, as detected at startup and after installs.
+type DependencyRegistry struct {
+	dependencies map[string]Dependency
+	ffmpegPath   string
+	// encoders are the hardware encoders of the FFmpeg detected at
+	// encodersCheckedAt, tested by Encoders.
+	encoders          []HardwareEncoder
+	encodersCheckedAt time.Time
+	mu                sync.Mutex
+}
+
+// NewDependencyRegistry creates an empty DependencyRegistry for the FFmpeg
+// configured at ffmpegPath.
+func NewDependencyRegistry(ffmpegPath string) *DependencyRegistry {
+	return &DependencyRegistry{dependencies: make(map[string]Dependency), ffmpegPath: ffmpegPath}
+}
+
+// FFmpegPath returns the ffmpeg binary the server is configured to use, a
+// file or a name to find on the PATH.
+func (dr *DependencyRegistry) FFmpegPath() string {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	return dr.ffmpegPath
+}
+
+// SetFFmpegPath changes the ffmpeg binary the server is configured to use;
+// Detect it to find out whether it is there.
+func (dr *DependencyRegistry) SetFFmpegPath(path string) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.ffmpegPath = path
+}
+
+// Detect looks for the program name at path, a file or a name to find on the
+// PATH, or by its name when path is empty, runs it with -version and records
+// what it found.
+func (dr *DependencyRegistry) Detect(name, path string) Dependency {
+	if path == "" {
+		path = name
+	}
+	dependency := Dependency{Name: name, CheckedAt: time.Now()}
+	resolved, version, err := detectBinary(name, path)
+	if err != nil {
+		dependency.Error = err.Error()
+		LogInfo("[DEPENDENCIES] %s: %v", name, err)
+	} else {
+		dependency.Path, dependency.Version, dependency.Installed = resolved, version, true
+		if release, ok := releaseVersion(version); ok && compareVersions(release, MinFFmpegVersion) < 0 {
+			dependency.Outdated = true
+		}
+		if dir, err := ManagedFFmpegDir(); err == nil && filepath.Dir(resolved) == dir {
+			dependency.Managed = true
+		}
+		LogInfo("[DEPENDENCIES] %s %s at %s", name, version, resolved)
+		if dependency.Outdated {
+			LogError("[DEPENDENCIES] %s %s is older than %s, the oldest release the server supports - please upgrade it", name, version, MinFFmpegVersion)
+		}
+	}
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.dependencies[name] = dependency
+	return dependency
+}
+
+// Get returns what was last detected of the program name; Installed is false
+// when it was never detected.
+func (dr *DependencyRegistry) Get(name string) Dependency {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if dependency, ok := dr.dependencies[name]; ok {
+		return dependency
+	}
+	return Dependency{Name: name}
+}
+
+// List returns every program detected, sorted by name.
+func (dr *DependencyRegistry) List() []Dependency {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	list := make([]Dependency, 0, len(dr.dependencies))
+	for _, dependency := range dr.dependencies {
+		list = append(list, dependency)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// releaseVersion returns the release number at the start of version, e.g.
+// "6.1.1" for "6.1.1-0ubuntu1" or "n6.1.1", and false for builds from git such
+// as "N-112345-g1234567" or "2024-01-01-git-1234567".
+func releaseVersion(version string) (string, bool) {
+	version = strings.TrimPrefix(version, "n")
+	end := strings.IndexFunc(version, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end == -1 {
+		end = len(version)
+	}
+	release := strings.Trim(version[:end], ".")
+	if release == "" || !strings.Contains(release, ".") {
+		return "", false
+	}
+	return release, true
+}
+
+// detectBinary resolves path and returns the version the program reports on
+// the first line of its -version output, "<name> version <version> ...".
+func detectBinary(name, path string) (string, string, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return "", "", fmt.Errorf("not found at %s", path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegCheckTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, resolved, "-version").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("%s does not run: %v", resolved, err)
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[0] != name || fields[1] != "version" {
+		return "", "", fmt.Errorf("%s is not %s", resolved, name)
+	}
+	return resolved, fields[2], nil
+}
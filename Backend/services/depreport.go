@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// encoderTestTimeout bounds the test encode of one hardware encoder; a driver
+// that is missing fails at once, one that hangs is reported as unavailable.
+const encoderTestTimeout = 10 * time.Second
+
+// hardwareEncoderSuffixes mark the FFmpeg encoders that use a GPU or a media
+// engine, e.g. h264_nvenc.
+var hardwareEncoderSuffixes = []string{"_nvenc", "_qsv", "_amf", "_vaapi", "_videotoolbox", "_v4l2m2m", "_mf"}
+
+// DependencyReport is the environment the server runs in, for support
+// requests: the programs it runs, the hardware encoders of FFmpeg and the
+// runtime of the desktop window.
+type DependencyReport struct {
+	// Platform is GOOS/GOARCH, e.g. "windows/amd64".
+	Platform     string            `json:"platform"`
+	Version      string            `json:"version"`
+	Dependencies []Dependency      `json:"dependencies"`
+	Encoders     []HardwareEncoder `json:"encoders"`
+	Webview      WebviewRuntime    `json:"webview"`
+}
+
+// HardwareEncoder is an encoder of FFmpeg that uses the GPU or a media
+// engine. FFmpeg builds include encoders for hardware the machine may not
+// have, so each is tested with a short encode.
+type HardwareEncoder struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	// Error is why the test encode failed.
+	Error string `json:"error,omitempty"`
+}
+
+// WebviewRuntime is the browser engine the desktop window is drawn with:
+// WebView2 on Windows, WKWebView on macOS and WebKitGTK on Linux.
+type WebviewRuntime struct {
+	Name string `json:"name"`
+	// Required is set when the server shows its window, which needs the
+	// runtime; headless servers do not.
+	Required  bool   `json:"required"`
+	Installed bool   `json:"installed"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report returns the DependencyReport of the server, which shows its window
+// when desktop is set. The hardware encoders are tested the first time and
+// again once FFmpeg was detected anew.
+func (dr *DependencyRegistry) Report(desktop bool) DependencyReport {
+	webview := detectWebview()
+	webview.Required = desktop
+	return DependencyReport{
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		Version:      Version,
+		Dependencies: dr.List(),
+		Encoders:     dr.Encoders(),
+		Webview:      webview,
+	}
+}
+
+// Encoders returns the hardware encoders of the FFmpeg last detected, tested
+// once per detection; none when FFmpeg is missing.
+func (dr *DependencyRegistry) Encoders() []HardwareEncoder {
+	ffmpeg := dr.Get(DependencyFFmpeg)
+	if !ffmpeg.Installed {
+		return []HardwareEncoder{}
+	}
+	dr.mu.Lock()
+	if dr.encoders != nil && dr.encodersCheckedAt.Equal(ffmpeg.CheckedAt) {
+		defer dr.mu.Unlock()
+		return append([]HardwareEncoder(nil), dr.encoders...)
+	}
+	dr.mu.Unlock()
+
+	encoders := detectHardwareEncoders(ffmpeg.Path)
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.encoders, dr.encodersCheckedAt = encoders, ffmpeg.CheckedAt
+	return append([]HardwareEncoder(nil), encoders...)
+}
+
+// detectHardwareEncoders lists the hardware encoders ffmpeg was built with
+// and tests each with a short encode of a blank video.
+func detectHardwareEncoders(ffmpeg string) []HardwareEncoder {
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegCheckTimeout)
+	output, err := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-encoders").Output()
+	cancel()
+	encoders := []HardwareEncoder{}
+	if err != nil {
+		LogError("[DEPENDENCIES] Failed to list the encoders of %s: %v", ffmpeg, err)
+		return encoders
+	}
+
+	// Lines look like " V....D h264_nvenc    NVIDIA NVENC H.264 encoder"
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "V") {
+			continue
+		}
+		name := fields[1]
+		for _, suffix := range hardwareEncoderSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				encoder := HardwareEncoder{Name: name}
+				if err := testHardwareEncoder(ffmpeg, name); err != nil {
+					encoder.Error = err.Error()
+				} else {
+					encoder.Available = true
+				}
+				encoders = append(encoders, encoder)
+				break
+			}
+		}
+	}
+	return encoders
+}
+
+// testHardwareEncoder encodes a few frames of a blank video with encoder,
+// and returns the last line FFmpeg logged when it fails.
+func testHardwareEncoder(ffmpeg, encoder string) error {
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", "lavfi", "-i", "color=black:s=256x256:r=30:d=1"}
+	if strings.HasSuffix(encoder, "_vaapi") {
+		// VA-API encodes frames uploaded to the GPU
+		args = append(args, "-vaapi_device", "/dev/dri/renderD128", "-vf", "format=nv12,hwupload")
+	}
+	args = append(args, "-frames:v", "5", "-c:v", encoder, "-f", "null", "-")
+
+	ctx, cancel := context.WithTimeout(context.Background(), encoderTestTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return errors.New(last)
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPortRangeSize is how many ports after the configured one are tried
+	// when SERVER_PORT_RANGE is not set.
+	defaultPortRangeSize = 10
+	lastPortFile         = "last_port"
+	discoveryFileName    = "server.json"
+)
+
+// ServerPortCandidates returns the ports to try, in order: the port chosen on
+// the previous run (so clients configured then keep working), the configured
+// port, then the rest of SERVER_PORT_RANGE ("8080-8090"). Without a range the
+// configured port and the next ten are tried.
+func ServerPortCandidates(configured, configDir string) ([]int, error) {
+	port, err := strconv.Atoi(configured)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", configured)
+	}
+
+	low, high := port, min(port+defaultPortRangeSize, 65535)
+	if spec := strings.TrimSpace(os.Getenv("SERVER_PORT_RANGE")); spec != "" {
+		if low, high, err = parsePortRange(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	var ports []int
+	seen := make(map[int]bool)
+	add := func(p int) {
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	if last := LoadLastPort(configDir); last >= low && last <= high {
+		add(last)
+	}
+	add(port)
+	for p := low; p <= high; p++ {
+		add(p)
+	}
+	return ports, nil
+}
+
+func parsePortRange(spec string) (int, int, error) {
+	lowStr, highStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		highStr = lowStr
+	}
+	low, err1 := strconv.Atoi(strings.TrimSpace(lowStr))
+	high, err2 := strconv.Atoi(strings.TrimSpace(highStr))
+	if err1 != nil || err2 != nil || low <= 0 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid SERVER_PORT_RANGE %q (expected e.g. 8080-8090)", spec)
+	}
+	return low, high, nil
+}
+
+// LoadLastPort returns the port the server was last started on, or 0.
+func LoadLastPort(configDir string) int {
+	data, err := os.ReadFile(filepath.Join(configDir, lastPortFile))
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return port
+}
+
+// SaveLastPort remembers the port the server ended up on for the next start.
+func SaveLastPort(configDir string, port int) error {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(configDir, lastPortFile), []byte(strconv.Itoa(port)+"\n"), 0644)
+}
+
+// DiscoveryInfo tells local clients where the running server is. It carries
+// no credentials.
+type DiscoveryInfo struct {
+	Service string    `json:"service"`
+	Version string    `json:"version"`
+	URL     string    `json:"url"`
+	Port    int       `json:"port"`
+	TLS     bool      `json:"tls"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// NewDiscoveryInfo describes this process serving at url on port.
+func NewDiscoveryInfo(url string, port int, tlsEnabled bool) DiscoveryInfo {
+	return DiscoveryInfo{
+		Service: "tab-recorder",
+		Version: Version,
+		URL:     url,
+		Port:    port,
+		TLS:     tlsEnabled,
+		PID:     os.Getpid(),
+		Started: time.Now(),
+	}
+}
+
+// DiscoveryFilePath returns the well-known location of the discovery file,
+// e.g. ~/.config/tab-recorder/server.json on Linux or
+// %AppData%\tab-recorder\server.json on Windows.
+func DiscoveryFilePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "tab-recorder", discoveryFileName), nil
+}
+
+// WriteDiscoveryFile writes info to the discovery file and returns its path.
+func WriteDiscoveryFile(info DiscoveryInfo) (string, error) {
+	path, err := DiscoveryFilePath()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create discovery directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write discovery file: %w", err)
+	}
+	return path, nil
+}
+
+// RemoveDiscoveryFile deletes the discovery file if this process wrote it.
+func RemoveDiscoveryFile() {
+	path, err := DiscoveryFilePath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var info DiscoveryInfo
+	if json.Unmarshal(data, &info) == nil && info.PID == os.Getpid() {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// FreeDiskSpace returns the number of bytes available to the current user on
+// the volume containing path.
+func FreeDiskSpace(path string) (uint64, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable uint64
+	ret, _, callErr := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		0,
+		0,
+	)
+	if ret == 0 {
+		return 0, fmt.Errorf("GetDiskFreeSpaceExW failed: %w", callErr)
+	}
+	return freeBytesAvailable, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dlnaRendererDevice = "urn:schemas-upnp-org:device:MediaRenderer:1"
+
+// dlnaDevice is the part of a UPnP device description casting reads.
+type dlnaDevice struct {
+	FriendlyName string `xml:"friendlyName"`
+	ModelName    string `xml:"modelName"`
+	UDN          string `xml:"UDN"`
+	Services     []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []dlnaDevice `xml:"deviceList>device"`
+}
+
+// discoverRenderers searches the LAN for DLNA media renderers, such as smart
+// TVs, for timeout and reads their device descriptions.
+func discoverRenderers(client *http.Client, timeout time.Duration) ([]CastDevice, error) {
+	var locations []string
+	seen := make(map[string]bool)
+	err := ssdpSearch(dlnaRendererDevice, timeout, func(location string) bool {
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for DLNA renderers: %w", err)
+	}
+
+	var (
+		devices []CastDevice
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+	)
+	for _, location := range locations {
+		wg.Add(1)
+		go func() {
+			defer CapturePanic()
+			defer wg.Done()
+			device, err := readRendererDescription(client, location)
+			if err != nil {
+				LogDebug("[CAST] Ignoring DLNA device at %s: %v", location, err)
+				return
+			}
+			mu.Lock()
+			devices = append(devices, device)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return devices, nil
+}
+
+func readRendererDescription(client *http.Client, location string) (CastDevice, error) {
+	base, err := url.Parse(location)
+	if err != nil {
+		return CastDevice{}, err
+	}
+	resp, err := client.Get(location)
+	if err != nil {
+		return CastDevice{}, err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  dlnaDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return CastDevice{}, fmt.Errorf("invalid device description: %w", err)
+	}
+	if root.URLBase != "" {
+		if u, err := url.Parse(root.URLBase); err == nil {
+			base = u
+		}
+	}
+
+	device, serviceType, controlURL := findAVTransport(root.Device)
+	if controlURL == "" {
+		return CastDevice{}, fmt.Errorf("no AVTransport service")
+	}
+	control, err := base.Parse(controlURL)
+	if err != nil {
+		return CastDevice{}, err
+	}
+	name := device.FriendlyName
+	if name == "" {
+		name = base.Hostname()
+	}
+	return CastDevice{
+		ID:          CastDLNA + ":" + strings.TrimPrefix(device.UDN, "uuid:"),
+		Name:        name,
+		Kind:        CastDLNA,
+		Model:       device.ModelName,
+		controlURL:  control.String(),
+		serviceType: serviceType,
+	}, nil
+}
+
+// findAVTransport returns the device with the AVTransport service that plays
+// media, and the service.
+func findAVTransport(device dlnaDevice) (dlnaDevice, string, string) {
+	for _, service := range device.Services {
+		if strings.Contains(service.ServiceType, ":AVTransport:") {
+			return device, service.ServiceType, service.ControlURL
+		}
+	}
+	for _, child := range device.Devices {
+		if found, serviceType, controlURL := findAVTransport(child); controlURL != "" {
+			return found, serviceType, controlURL
+		}
+	}
+	return dlnaDevice{}, "", ""
+}
+
+// castToRenderer has the DLNA renderer with the AVTransport service at
+// controlURL play media. Whatever it was playing is stopped first; renderers
+// that are idle answer that with an error, which is ignored.
+func castToRenderer(client *http.Client, controlURL, serviceType string, media castMedia) error {
+	instance := upnpArgument{"InstanceID", "0"}
+	upnpSOAP(client, controlURL, serviceType, "Stop", []upnpArgument{instance})
+	_, err := upnpSOAP(client, controlURL, serviceType, "SetAVTransportURI", []upnpArgument{
+		instance,
+		{"CurrentURI", media.url},
+		{"CurrentURIMetaData", didlMetadata(media)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = upnpSOAP(client, controlURL, serviceType, "Play", []upnpArgument{instance, {"Speed", "1"}})
+	return err
+}
+
+// didlMetadata describes media to a renderer, which shows the title and
+// picks a player by the content type.
+func didlMetadata(media castMedia) string {
+	class := "object.item.videoItem"
+	if strings.HasPrefix(media.contentType, "audio/") {
+		class = "object.item.audioItem"
+	}
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	b.WriteString(`<item id="0" parentID="-1" restricted="1"><dc:title>`)
+	xml.EscapeText(&b, []byte(media.title))
+	fmt.Fprintf(&b, `</dc:title><upnp:class>%s</upnp:class><res protocolInfo="http-get:*:%s:*">`, class, media.contentType)
+	xml.EscapeText(&b, []byte(media.url))
+	b.WriteString(`</res></item></DIDL-Lite>`)
+	return b.String()
+}
@@ -0,0 +1,35 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// privilegedScript runs the shell command passed as argument as root, after
+// macOS asks for an administrator password in a dialog.
+const privilegedScript = `on run argv
+	do shell script (item 1 of argv) with administrator privileges
+end run`
+
+// privileged prepares a command like command that runs as root: with sudo
+// when the server runs in a terminal, where sudo asks for the password, and
+// through osascript otherwise, e.g. when it was started from the Dock.
+// Homebrew refuses to run as root, so it is not run this way.
+func (fi *FFmpegInstaller) privileged(name string, args ...string) *exec.Cmd {
+	if os.Geteuid() == 0 {
+		return fi.command(name, args...)
+	}
+	if hasTerminal() {
+		return exec.Command("sudo", fi.rootArgs(name, args...)...)
+	}
+	quoted := fi.rootArgs(name, args...)
+	for i, arg := range quoted {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	LogInfo("[INSTALLER] Asking for the administrator password to run %s", name)
+	return exec.Command("osascript", "-e", privilegedScript, strings.Join(quoted, " "))
+}
@@ -0,0 +1,31 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"os"
+	"os/exec"
+)
+
+// privileged prepares a command like command that runs as root, asking the
+// user for the password the way they can answer: in the terminal with sudo
+// when the server runs in one, else in a dialog with pkexec in a desktop
+// session. sudo cannot ask without a terminal and would fail or wait forever,
+// so without either it runs with -n, which fails right away unless no
+// password is needed.
+func (fi *FFmpegInstaller) privileged(name string, args ...string) *exec.Cmd {
+	if os.Geteuid() == 0 {
+		return fi.command(name, args...)
+	}
+	switch {
+	case hasTerminal():
+		return exec.Command("sudo", fi.rootArgs(name, args...)...)
+	case hasDesktopSession() && fi.hasCommand("pkexec"):
+		LogInfo("[INSTALLER] Asking for the administrator password to run %s", name)
+		return exec.Command("pkexec", fi.rootArgs(name, args...)...)
+	default:
+		LogInfo("[INSTALLER] No terminal or desktop session to ask for the administrator password, trying sudo without one")
+		return exec.Command("sudo", append([]string{"-n"}, fi.rootArgs(name, args...)...)...)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// privileged prepares a command like command that runs with administrator
+// rights, through a UAC prompt unless the server already has them. The
+// elevated program gets a console of its own, so its output is not seen, and
+// not the environment of the server either.
+func (fi *FFmpegInstaller) privileged(name string, args ...string) *exec.Cmd {
+	// net session only works for administrators
+	if exec.Command("net", "session").Run() == nil {
+		return fi.command(name, args...)
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+	}
+	LogInfo("[INSTALLER] Asking for administrator rights to run %s", name)
+	script := fmt.Sprintf("$p = Start-Process -FilePath '%s' -ArgumentList %s -Verb RunAs -Wait -PassThru; exit $p.ExitCode",
+		name, strings.Join(quoted, ","))
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+}
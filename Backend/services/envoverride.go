@@ -0,0 +1,71 @@
+package services
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// recorderEnvPrefix marks the environment overrides. Every config file key has
+// one named RECORDER_<SECTION>_<KEY> (e.g. RECORDER_LIMITS_IP_RPS), and the
+// common ones also have the short names in recorderEnvAliases.
+const recorderEnvPrefix = "RECORDER_"
+
+var recorderEnvAliases = map[string]string{
+	"RECORDER_PORT":         "server.port",
+	"RECORDER_BIND":         "server.bind",
+	"RECORDER_DOWNLOAD_DIR": "paths.recordings",
+	"RECORDER_LOG_DIR":      "paths.logs",
+	"RECORDER_CONFIG_DIR":   "paths.config",
+	"RECORDER_LOG_LEVEL":    "logging.level",
+	"RECORDER_MAX_CHUNK_MB": "limits.max_chunk_mb",
+	"RECORDER_CONTAINER":    "server.container",
+}
+
+// ApplyRecorderEnv copies the RECORDER_* overrides onto the variables the
+// settings are read from, so they win over the older variable names, saved
+// settings and the config file. RECORDER_CONFIG_FILE selects the config file.
+// Where both are set, the long name wins over its alias. It returns the
+// overrides it applied and the RECORDER_* variables it did not recognise.
+func ApplyRecorderEnv() (applied, unknown []string) {
+	targets := map[string]string{recorderEnvPrefix + "CONFIG_FILE": "CONFIG_FILE"}
+	for alias, key := range recorderEnvAliases {
+		targets[alias] = configKeys[key]
+	}
+	for key, env := range configKeys {
+		targets[recorderEnvName(key)] = env
+	}
+
+	var names []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, recorderEnvPrefix) {
+			names = append(names, name)
+		}
+	}
+	// Apply the aliases first so that the long names win.
+	sort.Slice(names, func(i, j int) bool {
+		_, ai := recorderEnvAliases[names[i]]
+		_, aj := recorderEnvAliases[names[j]]
+		if ai != aj {
+			return ai
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		env, ok := targets[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		os.Setenv(env, os.Getenv(name))
+		applied = append(applied, name)
+	}
+	return applied, unknown
+}
+
+// recorderEnvName returns the RECORDER_* override for a config file key.
+func recorderEnvName(key string) string {
+	return recorderEnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
@@ -0,0 +1,13 @@
+//go:build offline
+// +build offline
+
+package services
+
+import "embed"
+
+//go:embed ffmpegbundle
+var ffmpegBundle embed.FS
+
+func init() {
+	bundledFFmpeg = ffmpegBundle
+}
@@ -5,21 +5,286 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// maxFinishedRecordings is how many finished recordings Finished returns.
+const maxFinishedRecordings = 20
+
+// RecordingTimedOut is the status of a recording that was finished because no
+// data arrived for it within the idle timeout.
+const RecordingTimedOut = "timed out"
+
+// RecordingInterrupted is the status of a recording that was finished because
+// the extension crashed while recording it (see recovery.go).
+const RecordingInterrupted = "interrupted"
+
+// FinishedRecording is a recording whose file has been closed.
+type FinishedRecording struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Status is RecordingTimedOut or RecordingInterrupted, or empty for a
+	// recording that ended normally.
+	Status string `json:"status,omitempty"`
+	// TabID and Title are those of the recording session; imported files
+	// have neither.
+	TabID           int       `json:"tabId,omitempty"`
+	Title           string    `json:"title,omitempty"`
+	StartedAt       time.Time `json:"startedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// PostProcessing is PostProcessingDone, PostProcessingFailed or
+	// PostProcessingSkipped when FFmpeg is not available.
+	PostProcessing string `json:"postProcessing"`
+	// Outcome is SessionCompleted, SessionFailed or SessionTimedOut (see
+	// history.go).
+	Outcome string `json:"outcome"`
+	// Error is why the recording failed.
+	Error string `json:"error,omitempty"`
+	// Source is what the recording was made of.
+	Source RecordingSource `json:"source,omitzero"`
+	// Parts are the files of a recording continued in new files at the size
+	// limit, in order; Name and Path are those of the first and Size is that
+	// of all of them.
+	Parts []string `json:"parts,omitempty"`
+	// ContinuesFrom is the file of the recording this one carries on after
+	// the extension recovered from a crash.
+	ContinuesFrom string `json:"continuesFrom,omitempty"`
+	// Group is the group the recording was made in, if any.
+	Group string `json:"group,omitempty"`
+	// Profile is the profile the recording was saved with; imported files
+	// have none.
+	Profile string `json:"profile,omitempty"`
+	// Poster is the file name of the first screenshot taken of the tab while
+	// recording, in the folder of the recording, if any.
+	Poster string `json:"poster,omitempty"`
+	// Verification tells whether all that was sent of the recording made it
+	// into its files (see verify.go); imported files have none.
+	Verification *RecordingVerification `json:"verification,omitempty"`
+}
+
+// chunkQueueSize is how many chunks of a recording may wait to be written
+// before WriteChunk blocks.
+const chunkQueueSize = 32
+
+// chunkWrite is a chunk waiting in a recording's queue; done receives the
+// result of writing it.
+type chunkWrite struct {
+	data []byte
+	done chan error
+}
+
+// fileHandle is an open recording file. Its chunks go through queue, in the
+// order they were recorded, to a goroutine that writes them one at a time, so
+// that parallel requests for the same recording cannot interleave or reorder
+// their writes.
 type fileHandle struct {
 	file   *os.File
 	writer *bufio.Writer
-	mu     sync.Mutex
+	// name, timestamp and source are those of the recording written to the
+	// file.
+	name      string
+	timestamp int64
+	source    RecordingSource
+	// continuesFrom is the file name of the recording this one carries on,
+	// if any.
+	continuesFrom string
+	// group is the group of the recording, if any.
+	group string
+	// profile is the profile the file was created with.
+	profile string
+	// partStart is when the file began (Unix milliseconds): the timestamp,
+	// or when the current part of a recording in parts began. Markers are
+	// offset from it.
+	partStart int64
+	// high is set for recordings of PriorityHigh.
+	high  bool
+	queue chan chunkWrite
+	// drained is closed once every queued chunk has been written after the
+	// queue was closed.
+	drained chan struct{}
+	// queueMu guards closed, order and sending to queue, so that the queue
+	// is not closed under a sender. The goroutine writing the queued chunks
+	// never takes it, nor waits on a sender holding mu.
+	queueMu sync.Mutex
+	closed  bool
+	// order holds the chunks that arrived ahead of their turn (see
+	// chunkorder.go).
+	order chunkOrder
+	// stopped is set under mu once stop has closed the queue, so that no
+	// marker or screenshot is added to a file whose sidecar is being saved.
+	// closed cannot be read under mu: the goroutine writing the queued chunks
+	// takes mu, and may be waited on by a sender holding queueMu.
+	stopped bool
+	// markers are saved in the sidecar of the file when it is closed.
+	markers []Marker
+	// screenshots are those taken of the tab for the file (see
+	// screenshots.go).
+	screenshots []Screenshot
+	// poster is the first screenshot of the recording, of any of its parts.
+	poster string
+	// preview is nil for a resumed recording, whose start is not received
+	// again.
+	preview *LivePreview
+	// live is nil when the recording is not streamed (see hls.go).
+	live *liveEncoder
+	// writeErr is the first chunk that could not be written. It, chunks,
+	// received and lastChunk are guarded by progressMu.
+	writeErr error
+	// rollover is nil when the file has no size limit (see rollover.go).
+	rollover *fileRollover
+	// chunks and received are what was written of the recording, lastChunk
+	// when (Unix milliseconds), and client what the extension reports having
+	// sent, to verify the file with (see verify.go). chunks is not known for
+	// a resumed recording.
+	chunks    int
+	received  int64
+	lastChunk int64
+	client    *ClientTotals
+	resumed   bool
+	// progressMu guards what was written of the recording, which the
+	// goroutine writing the queued chunks updates.
+	progressMu sync.Mutex
+	mu         sync.Mutex
+}
+
+// newFileHandle wraps file, which the recording name with timestamp is
+// written to, and starts writing the chunks queued for it, ahead of other
+// recordings' chunks when high.
+func (fws *FileWriterService) newFileHandle(tabID int, file *os.File, name string, timestamp int64, high bool) *fileHandle {
+	handle := &fileHandle{
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		name:      name,
+		timestamp: timestamp,
+		partStart: timestamp,
+		high:      high,
+		queue:     make(chan chunkWrite, chunkQueueSize),
+		drained:   make(chan struct{}),
+		order:     chunkOrder{next: 1},
+	}
+	go func() {
+		defer CapturePanic()
+		defer close(handle.drained)
+		for chunk := range handle.queue {
+			fws.writes.acquire(high)
+			bytesWritten, err := fws.writeChunk(tabID, handle, chunk.data)
+			fws.writes.release()
+			if err != nil {
+				LogError("[FILEWRITER] Write failed for tab %d: %v", tabID, err)
+				fws.stats.RecordError(ErrorKindWrite, err)
+				err = fmt.Errorf("disk write failed: %w", err)
+				handle.progressMu.Lock()
+				if handle.writeErr == nil {
+					handle.writeErr = err
+				}
+				handle.progressMu.Unlock()
+				chunk.done <- err
+				continue
+			}
+			fws.stats.AddSize(int64(bytesWritten))
+			handle.progressMu.Lock()
+			handle.chunks++
+			handle.received += int64(len(chunk.data))
+			handle.lastChunk = time.Now().UnixMilli()
+			handle.progressMu.Unlock()
+			handle.preview.write(chunk.data)
+			handle.live.write(chunk.data)
+			chunk.done <- nil
+		}
+	}()
+	return handle
+}
+
+// write queues data, the chunk numbered sequence (0 when it is not known),
+// after the chunks before it and waits until it has been written.
+func (h *fileHandle) write(sequence int64, data []byte) error {
+	chunk := chunkWrite{data: data, done: make(chan error, 1)}
+	h.queueMu.Lock()
+	if h.closed {
+		h.queueMu.Unlock()
+		return fmt.Errorf("file is already closed")
+	}
+	h.enqueueInOrder(sequence, chunk)
+	h.queueMu.Unlock()
+	return <-chunk.done
+}
+
+// enqueue sends chunk to the queue. h.queueMu must be held.
+func (h *fileHandle) enqueue(chunk chunkWrite) {
+	h.queue <- chunk
+}
+
+// close stops accepting chunks, waits for the queued ones to be written, and
+// flushes and closes the file.
+func (h *fileHandle) close() (flushErr, closeErr error) {
+	h.stop()
+	flushErr = h.writer.Flush()
+	closeErr = h.file.Close()
+	return flushErr, closeErr
+}
+
+// stop stops accepting chunks, waits for the queued ones to be written to
+// the buffer of the file, and ends its live preview and stream.
+func (h *fileHandle) stop() {
+	h.queueMu.Lock()
+	if !h.closed {
+		h.flushHeld()
+		h.closed = true
+		close(h.queue)
+	}
+	h.queueMu.Unlock()
+	<-h.drained
+
+	h.mu.Lock()
+	h.stopped = true
+	h.mu.Unlock()
+
+	h.preview.close()
+	h.live.close()
 }
 
 type FileWriterService struct {
 	activeFiles   sync.Map
 	filenameMap   sync.Map
 	downloadDir   string
+	profile       string
+	template      string
+	clock         Clock
 	stats         *Stats
 	postProcessor *PostProcessor
+	notifier      *DesktopNotifier
+	webhooks      *WebhookDispatcher
+	hooks         *HookRunner
+	live          *LiveStreams
+	// maxFileSize is the size at which recordings are continued in a new
+	// file, or 0 (see rollover.go).
+	maxFileSize int64
+	// route picks the profile of new recordings (see SetProfileRouter).
+	route func(requested string, source RecordingSource) (Profile, bool)
+	// finished is the session history, newest first, saved at historyPath
+	// (see history.go).
+	finished    []FinishedRecording
+	historyPath string
+	// journal holds the recordings being written, by tab, saved at
+	// journalPath so that they can be resumed after a restart (see resume.go).
+	journal     map[int]ResumableRecording
+	journalPath string
+	// continuations maps the tabs whose next file carries on a recording
+	// interrupted by a crash of the extension to the path of its last file
+	// (see recovery.go).
+	continuations sync.Map
+	// writes and jobs let chunks and post-processing of high priority
+	// recordings go first when the server is busy (see priority.go).
+	writes    *priorityGate
+	jobs      *priorityGate
+	jobsLimit int
+	createMu  sync.Mutex
+	mu        sync.Mutex
 }
 
 func NewFileWriterService(downloadDir string, stats *Stats, postProcessor *PostProcessor) *FileWriterService {
@@ -29,6 +294,8 @@ func NewFileWriterService(downloadDir string, stats *Stats, postProcessor *PostP
 		downloadDir:   downloadDir,
 		stats:         stats,
 		postProcessor: postProcessor,
+		writes:        newPriorityGate(parallelWrites),
+		jobs:          newPriorityGate(0),
 	}
 	if err := fws.ensureDirectory(downloadDir); err != nil {
 		LogError("Failed to create download directory: %v", err)
@@ -43,110 +310,512 @@ func (fws *FileWriterService) ensureDirectory(directory string) error {
 	return nil
 }
 
-func (fws *FileWriterService) WriteChunk(tabID int, name string, timestamp int64, data []byte) error {
-	handle, err := fws.getOrCreateHandle(tabID, name, timestamp)
+// WriteChunk appends data to the recording of tabID, creating its file with
+// the first chunk with the extension of format, named after source too, in
+// group, with the settings of profile when it is not empty. Chunks of high
+// recordings are written first when the disk is busy. Chunks numbered with
+// sequence, from 1 for each file, are written in that order whatever order
+// they arrive in; 0 writes data as it arrives. data is not kept once
+// WriteChunk returns, so callers may reuse it.
+func (fws *FileWriterService) WriteChunk(tabID int, name string, timestamp, sequence int64, data []byte, format RecordingFormat, high bool, source RecordingSource, group, profile string) error {
+	handle, err := fws.getOrCreateHandle(tabID, name, timestamp, format, high, source, group, profile)
 	if err != nil {
 		LogError("[FILEWRITER] Failed to get file handle: %v", err)
+		fws.stats.RecordError(ErrorKindWrite, err)
 		return fmt.Errorf("failed to get file handle: %w", err)
 	}
+	return handle.write(sequence, data)
+}
+
+// CloseFile finishes the file of tabID and adds it to the history with status,
+// which is empty for a recording that ended normally.
+func (fws *FileWriterService) CloseFile(tabID int, status string) error {
+	fws.forgetOpen(tabID)
+	val, ok := fws.activeFiles.LoadAndDelete(tabID)
+	if !ok {
+		return nil
+	}
 
+	handle := val.(*fileHandle)
+	flushErr, closeErr := handle.close()
+	if flushErr != nil {
+		LogError("[FILEWRITER] Final flush failed for tab %d: %v", tabID, flushErr)
+		fws.stats.RecordError(ErrorKindWrite, flushErr)
+	}
+
+	if closeErr != nil {
+		LogError("[FILEWRITER] File close failed for tab %d: %v", tabID, closeErr)
+		fws.stats.RecordError(ErrorKindWrite, closeErr)
+		return fmt.Errorf("failed to close file: %w", closeErr)
+	}
+
+	LogInfo("[FILEWRITER] Recording stopped for tab %d", tabID)
+	
+	filenameVal, ok := fws.filenameMap.LoadAndDelete(tabID)
+	if !ok {
+		return nil
+	}
+	filename := filenameVal.(string)
+	parts, partErr := handle.rollover.finished()
 	handle.mu.Lock()
-	defer handle.mu.Unlock()
+	sidecar := RecordingSidecar{
+		Name:            handle.name,
+		StartedAt:       time.UnixMilli(handle.partStart),
+		DurationSeconds: time.Since(time.UnixMilli(handle.partStart)).Seconds(),
+		Markers:         handle.markers,
+		Screenshots:     handle.screenshots,
+		Source:          handle.source,
+		ContinuesFrom:   handle.continuesFrom,
+		Group:           handle.group,
+	}
+	poster := handle.poster
+	handle.progressMu.Lock()
+	writeErr := handle.writeErr
+	verification := RecordingVerification{
+		Client:       handle.client,
+		ServerChunks: handle.chunks,
+		ServerBytes:  handle.received,
+	}
+	if handle.lastChunk > 0 {
+		verification.ExpectedDurationSeconds = float64(handle.lastChunk-handle.timestamp) / 1000
+	}
+	handle.progressMu.Unlock()
+	if handle.resumed {
+		verification.ServerChunks = 0
+	}
+	if handle.client != nil && handle.client.DurationSeconds > 0 {
+		verification.ExpectedDurationSeconds = handle.client.DurationSeconds
+	}
+	handle.mu.Unlock()
+	if len(parts) > 0 {
+		sidecar.Recording, sidecar.Part = filepath.Base(parts[0]), len(parts)+1
+	}
+	fws.saveMarkers(filename, sidecar)
+	files := append(append([]string{}, parts...), filename)
+	diskBytes := filesSize(files)
+	startedAt := time.UnixMilli(handle.timestamp)
+	finalized := WebhookRecording{
+		TabID:           tabID,
+		Name:            filepath.Base(filename),
+		StartedAt:       &startedAt,
+		DurationSeconds: time.Since(startedAt).Seconds(),
+		Bytes:           diskBytes,
+		Status:          status,
+	}
+	finalized.Path, _ = filepath.Abs(filename)
+	fws.hooks.Run(HookOnFinalize, finalized)
+	err := fws.postProcess(filename, handle.high)
+	if err == nil {
+		err = partErr
+	}
+	session := FinishedRecording{
+		Status:          status,
+		TabID:           tabID,
+		Title:           handle.name,
+		StartedAt:       startedAt,
+		DurationSeconds: time.Since(startedAt).Seconds(),
+		PostProcessing:  fws.postProcessingOutcome(err),
+		Source:          handle.source,
+		ContinuesFrom:   handle.continuesFrom,
+		Group:           handle.group,
+		Profile:         handle.profile,
+		Poster:          poster,
+		Verification:    fws.verify(files, diskBytes, verification),
+	}
+	if len(parts) > 0 {
+		session.Parts = append(parts, filename)
+		filename = parts[0]
+	}
+	switch {
+	case err != nil:
+		session.Error = err.Error()
+	case writeErr != nil:
+		session.Error = writeErr.Error()
+	case flushErr != nil:
+		session.Error = fmt.Sprintf("disk write failed: %v", flushErr)
+	}
+	recording := fws.addFinished(filename, session)
 
-	bytesWritten, err := handle.writer.Write(data)
+	webhook := WebhookRecording{TabID: tabID, Name: recording.Name, Path: recording.Path, Bytes: recording.Size, Status: status, Verification: recording.Verification.Verdict}
 	if err != nil {
-		LogError("[FILEWRITER] Write failed for tab %d: %v", tabID, err)
-		return fmt.Errorf("disk write failed: %w", err)
+		webhook.Error = err.Error()
+		fws.webhooks.Send(WebhookRecordingFailed, webhook)
+	} else {
+		webhook.PostProcessed = fws.GetPostProcessor() != nil
+		fws.webhooks.Send(WebhookRecordingProcessed, webhook)
 	}
-	
-	fws.stats.AddSize(int64(bytesWritten))
+	webhook.StartedAt, webhook.DurationSeconds = &startedAt, recording.DurationSeconds
+	fws.hooks.Run(HookOnPostprocessDone, webhook)
 	return nil
 }
 
-func (fws *FileWriterService) CloseFile(tabID int) error {
-	val, ok := fws.activeFiles.LoadAndDelete(tabID)
+// AddMarker marks the moment at in the file the recording of tabID is being
+// written to, with label, and returns the marker. It returns ErrNotRecording
+// when no file of tabID is open.
+func (fws *FileWriterService) AddMarker(tabID int, label string, at time.Time) (Marker, error) {
+	val, ok := fws.activeFiles.Load(tabID)
 	if !ok {
-		return nil
+		return Marker{}, ErrNotRecording
 	}
-
 	handle := val.(*fileHandle)
 	handle.mu.Lock()
-	defer handle.mu.Unlock()
+	if handle.stopped {
+		handle.mu.Unlock()
+		return Marker{}, ErrNotRecording
+	}
+	marker := newMarker(label, at, handle.partStart, len(handle.markers)+1)
+	handle.markers = append(handle.markers, marker)
+	markers := append([]Marker(nil), handle.markers...)
+	handle.mu.Unlock()
 
-	if err := handle.writer.Flush(); err != nil {
-		LogError("[FILEWRITER] Final flush failed for tab %d: %v", tabID, err)
+	fws.rememberMarkers(tabID, markers)
+	LogInfo("[FILEWRITER] Marked %q at %.1fs for tab %d", marker.Label, marker.OffsetSeconds, tabID)
+	return marker, nil
+}
+
+// EndLive removes the live stream of the recording of tabID once the
+// recording has ended; split files go on in the same stream.
+func (fws *FileWriterService) EndLive(tabID int) {
+	fws.live.end(tabID)
+}
+
+// Preview returns the live preview of the file the recording of tabID is
+// being written to, or nil when there is none.
+func (fws *FileWriterService) Preview(tabID int) *LivePreview {
+	val, ok := fws.activeFiles.Load(tabID)
+	if !ok {
+		return nil
 	}
+	return val.(*fileHandle).preview
+}
 
-	if err := handle.file.Close(); err != nil {
-		LogError("[FILEWRITER] File close failed for tab %d: %v", tabID, err)
-		return fmt.Errorf("failed to close file: %w", err)
+// saveMarkers writes sidecar to the sidecar of filename, a finished file,
+// when the recording has markers or screenshots, is in parts, has a known
+// source, carries on another one or belongs to a group.
+func (fws *FileWriterService) saveMarkers(filename string, sidecar RecordingSidecar) {
+	if len(sidecar.Markers) == 0 && len(sidecar.Screenshots) == 0 && sidecar.Part == 0 && sidecar.Source == (RecordingSource{}) && sidecar.ContinuesFrom == "" && sidecar.Group == "" {
+		return
 	}
+	markers := append([]Marker{}, sidecar.Markers...)
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].OffsetSeconds < markers[j].OffsetSeconds })
+	sidecar.Markers = markers
+	if err := saveSidecar(filename, sidecar); err != nil {
+		LogError("[FILEWRITER] Failed to save the markers of %s: %v", filename, err)
+		fws.stats.RecordError(ErrorKindWrite, err)
+	}
+}
 
-	LogInfo("[FILEWRITER] Recording stopped for tab %d", tabID)
-	
-	if fws.postProcessor != nil {
-		if filenameVal, ok := fws.filenameMap.LoadAndDelete(tabID); ok {
-			filename := filenameVal.(string)
-			LogInfo("[FILEWRITER] Starting post-processing: %s", filename)
-			if err := fws.postProcessor.FixWebMMetadata(filename); err != nil {
-				LogError("[FILEWRITER] Post-processing failed: %v", err)
-			} else {
-				LogInfo("[FILEWRITER] Post-processing completed successfully: %s", filename)
-			}
-		}
+// postProcess fixes the metadata of a finished recording with FFmpeg, when
+// FFmpeg is available, and returns why it failed. When all post-processing
+// jobs are taken it waits, ahead of the other recordings when high.
+func (fws *FileWriterService) postProcess(filename string, high bool) error {
+	postProcessor := fws.GetPostProcessor()
+	if postProcessor == nil {
+		return nil
+	}
+	fws.jobs.acquire(high)
+	defer fws.jobs.release()
+	LogInfo("[FILEWRITER] Starting post-processing: %s", filename)
+	err := postProcessor.Fix(filename)
+	if err != nil {
+		LogError("[FILEWRITER] Post-processing failed: %v", err)
+		fws.stats.RecordError(ErrorKindFFmpeg, err)
+		fws.notifier.Send(NotifyPostProcessing, "Post-processing failed", fmt.Sprintf("%s: %v", filepath.Base(filename), err))
 	} else {
-		fws.filenameMap.Delete(tabID)
+		LogInfo("[FILEWRITER] Post-processing completed successfully: %s", filename)
+		fws.notifier.Send(NotifyPostProcessing, "Recording ready", filepath.Base(filename))
 	}
-	
-	return nil
+	return err
+}
+
+// postProcessingOutcome is the PostProcessing of a recording whose
+// post-processing returned err.
+func (fws *FileWriterService) postProcessingOutcome(err error) string {
+	switch {
+	case fws.GetPostProcessor() == nil:
+		return PostProcessingSkipped
+	case err != nil:
+		return PostProcessingFailed
+	}
+	return PostProcessingDone
+}
+
+// addFinished remembers filename, the file of the session recording, as the
+// most recently finished recording, and adds it to the session history.
+func (fws *FileWriterService) addFinished(filename string, recording FinishedRecording) FinishedRecording {
+	recording.Name = filepath.Base(filename)
+	recording.FinishedAt = time.Now()
+	recording.Path, _ = filepath.Abs(filename)
+	files := recording.Parts
+	if len(files) == 0 {
+		files = []string{filename}
+	}
+	recording.Parts = nil
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			recording.Size += info.Size()
+		}
+		if len(files) > 1 {
+			recording.Parts = append(recording.Parts, filepath.Base(file))
+		}
+	}
+	if recording.StartedAt.IsZero() {
+		recording.StartedAt = recording.FinishedAt
+	}
+	recording.Outcome = sessionOutcome(recording)
+
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.finished = append([]FinishedRecording{recording}, fws.finished...)
+	if len(fws.finished) > maxSessionHistory {
+		fws.finished = fws.finished[:maxSessionHistory]
+	}
+	if fws.historyPath != "" {
+		if err := fws.saveHistoryLocked(); err != nil {
+			LogError("[FILEWRITER] Failed to save session history: %v", err)
+		}
+	}
+	return recording
+}
+
+// Finished returns the most recently finished recordings, newest first.
+func (fws *FileWriterService) Finished() []FinishedRecording {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	return append([]FinishedRecording{}, fws.finished[:min(len(fws.finished), maxFinishedRecordings)]...)
+}
+
+// CloseAll flushes and closes every recording still being written, when the
+// server shuts down. Post-processing is skipped so that shutdown is quick; the
+// "convert" command can fix the files later.
+func (fws *FileWriterService) CloseAll() {
+	fws.activeFiles.Range(func(key, val any) bool {
+		fws.activeFiles.Delete(key)
+		flushErr, closeErr := val.(*fileHandle).close()
+		if flushErr != nil {
+			LogError("[FILEWRITER] Final flush failed for tab %d: %v", key, flushErr)
+		}
+		if closeErr != nil {
+			LogError("[FILEWRITER] File close failed for tab %d: %v", key, closeErr)
+		}
+		if filename, ok := fws.filenameMap.LoadAndDelete(key); ok {
+			LogInfo("[FILEWRITER] Closed unfinished recording: %s", filename)
+		}
+		return true
+	})
+	fws.live.Close()
+}
+
+// Abandon closes every recording still being written as a crash of the
+// server leaves it: what is buffered is not written to its file, and it stays
+// in the session journal, to be resumed. It is for tests of crash recovery
+// (see the harness package).
+func (fws *FileWriterService) Abandon() {
+	fws.activeFiles.Range(func(key, val any) bool {
+		fws.activeFiles.Delete(key)
+		fws.filenameMap.Delete(key)
+		handle := val.(*fileHandle)
+		handle.stop()
+		handle.file.Close()
+		return true
+	})
+	fws.live.Close()
 }
 
 func (fws *FileWriterService) SetDownloadDir(dir string) {
+	fws.mu.Lock()
 	fws.downloadDir = dir
+	fws.mu.Unlock()
 	if err := fws.ensureDirectory(dir); err != nil {
 		LogError("Failed to create directory %s: %v", dir, err)
 	}
 }
 
-func (fws *FileWriterService) getOrCreateHandle(tabID int, name string, timestamp int64) (*fileHandle, error) {
+func (fws *FileWriterService) GetPostProcessor() *PostProcessor {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	return fws.postProcessor
+}
+
+// SetPostProcessor sets the post-processor of the recordings finished from
+// now on, e.g. once FFmpeg is installed while the server runs.
+func (fws *FileWriterService) SetPostProcessor(postProcessor *PostProcessor) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.postProcessor = postProcessor
+}
+
+func (fws *FileWriterService) GetDownloadDir() string {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	return fws.downloadDir
+}
+
+// SetClock sets the time zone and format of start times in new file names.
+func (fws *FileWriterService) SetClock(clock Clock) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.clock = clock
+}
+
+// Clock returns the clock set by SetClock.
+func (fws *FileWriterService) Clock() Clock {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	return fws.clock
+}
+
+// SetNotifier sets where post-processing notifications go. It must be called
+// before recordings are written.
+func (fws *FileWriterService) SetNotifier(notifier *DesktopNotifier) {
+	fws.notifier = notifier
+}
+
+// SetWebhooks sets where recording processed and post-processing failure
+// webhooks go. It must be called before recordings are written.
+func (fws *FileWriterService) SetWebhooks(webhooks *WebhookDispatcher) {
+	fws.webhooks = webhooks
+}
+
+// SetHooks sets the commands run when the file of a recording is closed and
+// once it is post-processed. It must be called before recordings are written.
+func (fws *FileWriterService) SetHooks(hooks *HookRunner) {
+	fws.hooks = hooks
+}
+
+// SetLiveStreams sets where recordings are streamed to as they are written.
+// It must be called before recordings are written.
+func (fws *FileWriterService) SetLiveStreams(live *LiveStreams) {
+	fws.live = live
+}
+
+// SetPostProcessingJobs sets how many recordings may be post-processed at a
+// time; 0 means one per CPU.
+func (fws *FileWriterService) SetPostProcessingJobs(limit int) {
+	fws.mu.Lock()
+	fws.jobsLimit = limit
+	fws.mu.Unlock()
+	fws.jobs.setLimit(limit)
+}
+
+// PostProcessingJobs returns the limit set by SetPostProcessingJobs.
+func (fws *FileWriterService) PostProcessingJobs() int {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	return fws.jobsLimit
+}
+
+// PostProcessingQueue returns how many finished recordings are waiting for a
+// post-processing job.
+func (fws *FileWriterService) PostProcessingQueue() int {
+	return fws.jobs.waiting()
+}
+
+// SetProfileRouter sets route, which picks the profile a new recording is
+// saved with from the profile it asked for, if any, and its source; it
+// reports false to leave it to the active profile.
+func (fws *FileWriterService) SetProfileRouter(route func(requested string, source RecordingSource) (Profile, bool)) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.route = route
+}
+
+// SetNaming sets the profile whose naming template new recordings get.
+func (fws *FileWriterService) SetNaming(profile, template string) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.profile = profile
+	fws.template = template
+}
+
+func (fws *FileWriterService) getOrCreateHandle(tabID int, name string, timestamp int64, format RecordingFormat, high bool, source RecordingSource, group, profile string) (*fileHandle, error) {
 	val, exists := fws.activeFiles.Load(tabID)
 	if exists {
 		return val.(*fileHandle), nil
 	}
 
-	handle, err := fws.createFile(tabID, name, timestamp)
-	if err != nil {
-		LogError("[FILEWRITER] Failed to create file: %v", err)
-		return nil, err
+	// The first chunks of a recording may arrive together; only one of them
+	// creates the file.
+	fws.createMu.Lock()
+	defer fws.createMu.Unlock()
+	if val, exists := fws.activeFiles.Load(tabID); exists {
+		return val.(*fileHandle), nil
+	}
+
+	handle, resumed := fws.resumeFile(tabID, timestamp, high)
+	if !resumed {
+		var err error
+		handle, err = fws.createFile(tabID, name, timestamp, format, high, source, group, profile)
+		if err != nil {
+			LogError("[FILEWRITER] Failed to create file: %v", err)
+			return nil, err
+		}
 	}
 
 	fws.activeFiles.Store(tabID, handle)
 	return handle, nil
 }
 
-func (fws *FileWriterService) createFile(tabID int, name string, timestamp int64) (*fileHandle, error) {
-	if err := fws.ensureDirectory(fws.downloadDir); err != nil {
+// createFile creates the file of a new recording in the directory of the
+// profile it is routed to, or else of the active one.
+func (fws *FileWriterService) createFile(tabID int, name string, timestamp int64, format RecordingFormat, high bool, source RecordingSource, group, requested string) (*fileHandle, error) {
+	fws.mu.Lock()
+	dir, profile, template, clock, maxFileSize, route := fws.downloadDir, fws.profile, fws.template, fws.clock, fws.maxFileSize, fws.route
+	fws.mu.Unlock()
+	if route != nil {
+		if routed, ok := route(requested, source); ok {
+			dir, profile, template = routed.RecordingsDir, routed.Name, routed.NamingTemplate
+		}
+	}
+
+	if err := fws.ensureDirectory(dir); err != nil {
 		LogError("[FILEWRITER] Failed to ensure directory: %v", err)
 		return nil, err
 	}
 
-	filename := filepath.Join(fws.downloadDir,
-		fmt.Sprintf("%s_%d_%d.webm", name, tabID, timestamp))
-
-	file, err := os.Create(filename)
+	base := RenderRecordingName(template, profile, name, tabID, timestamp, source, clock)
+	continuesFrom := ""
+	if previous, ok := fws.continuations.LoadAndDelete(tabID); ok {
+		continuesFrom = filepath.Base(previous.(string))
+		base = continuationName(continuesFrom)
+	}
+	file, err := createRecordingFile(dir, base, format.Extension())
 	if err != nil {
-		LogError("[FILEWRITER] Failed to create file %s: %v", filename, err)
-		return nil, fmt.Errorf("failed to create file: %w", err)
+		LogError("[FILEWRITER] Failed to create file %s: %v", base, err)
+		return nil, err
 	}
+	filename := file.Name()
 
 	fws.filenameMap.Store(tabID, filename)
+	fws.rememberOpen(tabID, name, timestamp, filename, source, continuesFrom, group, profile)
 	
 	LogInfo("[FILEWRITER] Started recording: %s", filename)
 
-	return &fileHandle{
-		file:   file,
-		writer: bufio.NewWriter(file),
-	}, nil
+	handle := fws.newFileHandle(tabID, file, name, timestamp, high)
+	handle.source = source
+	handle.continuesFrom = continuesFrom
+	handle.group = group
+	handle.profile = profile
+	handle.preview = newLivePreview(format.Container)
+	handle.live = fws.live.start(tabID, format)
+	handle.rollover = newFileRollover(maxFileSize, filename, format.Container)
+	return handle, nil
+}
+
+// createRecordingFile creates base+ext, such as base.webm, in dir. A template
+// without {timestamp} can repeat a name; never overwrite a recording, number
+// the new one instead.
+func createRecordingFile(dir, base, ext string) (*os.File, error) {
+	filename := filepath.Join(dir, base+ext)
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	for n := 2; os.IsExist(err) && n < 1000; n++ {
+		filename = filepath.Join(dir, base+"_"+strconv.Itoa(n)+ext)
+		file, err = os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	return file, nil
 }
 
 func (fws *FileWriterService) GetTotalRecordedSize() int64 {
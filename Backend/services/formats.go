@@ -0,0 +1,110 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Containers the extension can record a tab into.
+const (
+	ContainerWebM = "webm"
+	ContainerMKV  = "mkv"
+	// ContainerMP4 is fragmented MP4 as MediaRecorder writes it; post-processing
+	// turns it into a regular MP4.
+	ContainerMP4 = "mp4"
+)
+
+// RecordingContainers lists the containers a recording can be requested in.
+var RecordingContainers = []string{ContainerWebM, ContainerMKV, ContainerMP4}
+
+// RecordingFormat is what the extension records a tab as, chosen when the
+// recording starts.
+type RecordingFormat struct {
+	// Container is one of RecordingContainers; empty means WebM.
+	Container string
+	// AudioOnly recordings hold only the tab's sound.
+	AudioOnly bool
+}
+
+// IsRecordingContainer reports whether container can be requested for a
+// recording. Empty is allowed and means WebM.
+func IsRecordingContainer(container string) bool {
+	if container == "" {
+		return true
+	}
+	for _, c := range RecordingContainers {
+		if c == container {
+			return true
+		}
+	}
+	return false
+}
+
+// Extension returns the file extension recordings in f are saved with.
+func (f RecordingFormat) Extension() string {
+	container := f.Container
+	if container == "" {
+		container = ContainerWebM
+	}
+	for _, format := range recordingFileFormats {
+		if format.container == container && format.audio == f.AudioOnly {
+			return format.ext
+		}
+	}
+	return ".webm"
+}
+
+// recordingFileFormat describes the files of one kind of recording.
+type recordingFileFormat struct {
+	ext       string
+	container string
+	audio     bool
+	// contentType is the media type the file is served as.
+	contentType string
+	// muxer is the FFmpeg format that writes the file.
+	muxer string
+	// chapters is set for files that markers can be added to as chapters.
+	chapters bool
+}
+
+// recordingFileFormats lists the files the file writer produces, and Ogg audio,
+// which can only be imported.
+var recordingFileFormats = []recordingFileFormat{
+	{ext: ".webm", container: ContainerWebM, contentType: "video/webm", muxer: "webm"},
+	{ext: ".weba", container: ContainerWebM, audio: true, contentType: "audio/webm", muxer: "webm"},
+	{ext: ".mkv", container: ContainerMKV, contentType: "video/x-matroska", muxer: "matroska", chapters: true},
+	{ext: ".mka", container: ContainerMKV, audio: true, contentType: "audio/x-matroska", muxer: "matroska", chapters: true},
+	{ext: ".mp4", container: ContainerMP4, contentType: "video/mp4", muxer: "mp4", chapters: true},
+	{ext: ".m4a", container: ContainerMP4, audio: true, contentType: "audio/mp4", muxer: "mp4", chapters: true},
+	{ext: ".ogg", audio: true, contentType: "audio/ogg", muxer: "ogg"},
+}
+
+func fileFormatOf(name string) (recordingFileFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, format := range recordingFileFormats {
+		if format.ext == ext {
+			return format, true
+		}
+	}
+	return recordingFileFormat{}, false
+}
+
+func isRecordingFile(name string) bool {
+	_, ok := fileFormatOf(name)
+	return ok
+}
+
+// IsAudioRecording reports whether the recording file name holds only sound.
+func IsAudioRecording(name string) bool {
+	format, _ := fileFormatOf(name)
+	return format.audio
+}
+
+// RecordingContentType returns the media type the recording file name is
+// served as.
+func RecordingContentType(name string) string {
+	if format, ok := fileFormatOf(name); ok {
+		return format.contentType
+	}
+	return "video/webm"
+}
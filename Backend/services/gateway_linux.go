@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateway reads the IPv4 default route from /proc/net/route.
+func defaultGateway() (net.IP, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		// The kernel prints the address as a number in host byte order.
+		ip := make(net.IP, 4)
+		binary.NativeEndian.PutUint32(ip, binary.BigEndian.Uint32(raw))
+		return ip, nil
+	}
+	return nil, fmt.Errorf("no default route")
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package services
+
+import (
+	"fmt"
+	"net"
+)
+
+// defaultGateway is only implemented on Linux; elsewhere NAT_GATEWAY names the
+// router for NAT-PMP, and UPnP finds it by itself.
+func defaultGateway() (net.IP, error) {
+	return nil, fmt.Errorf("default gateway lookup is not supported on this platform")
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxGroupID is the longest a group ID may be.
+const maxGroupID = 64
+
+var groupIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Ways of combining the recordings of a group into one file.
+const (
+	// CombineMux puts the tracks of every recording side by side in one
+	// Matroska file, e.g. the camera angles of one event.
+	CombineMux = "mux"
+	// CombineConcat plays the recordings one after another, in the order
+	// they started. They must have the same format and size.
+	CombineConcat = "concat"
+)
+
+// ErrGroupNotFound is returned for a group that has no recording in progress
+// and none in the session history.
+var ErrGroupNotFound = errors.New("no recording of the group was found")
+
+// ErrCombineUnavailable is returned by CombineGroup when FFmpeg is not
+// available.
+var ErrCombineUnavailable = errors.New("combining recordings needs FFmpeg")
+
+// IsGroupID reports whether id can name a group: up to 64 letters, digits,
+// dots, dashes and underscores. Empty means no group.
+func IsGroupID(id string) bool {
+	return id == "" || (len(id) <= maxGroupID && groupIDPattern.MatchString(id))
+}
+
+// IsCombineMode reports whether mode is CombineMux or CombineConcat.
+func IsCombineMode(mode string) bool {
+	return mode == CombineMux || mode == CombineConcat
+}
+
+// RecordingGroup is a group of recordings made together, such as the camera
+// tabs of one event, tagged with the same group ID by the extension.
+type RecordingGroup struct {
+	ID string `json:"id"`
+	// Active and Finished are how many recordings of the group are in
+	// progress and in the session history.
+	Active   int `json:"active"`
+	Finished int `json:"finished"`
+	// Bytes is what the active recordings wrote so far and the finished ones
+	// hold.
+	Bytes     int64     `json:"bytes"`
+	StartedAt time.Time `json:"startedAt"`
+	// DurationSeconds is from the start of the first recording to now, or to
+	// the end of the last one once none is in progress.
+	DurationSeconds float64             `json:"durationSeconds"`
+	Sessions        []GroupSession      `json:"sessions"`
+	Recordings      []FinishedRecording `json:"recordings"`
+	// Combine is how the group is, or is to be, combined once its last
+	// recording finishes, and Combined the file it was combined into or
+	// CombineError why that failed.
+	Combine      string `json:"combine,omitempty"`
+	Combined     string `json:"combined,omitempty"`
+	CombineError string `json:"combineError,omitempty"`
+}
+
+// GroupSession is a recording of a group that is in progress.
+type GroupSession struct {
+	TabID        int       `json:"tabId"`
+	Name         string    `json:"name"`
+	StartedAt    time.Time `json:"startedAt"`
+	BytesWritten int64     `json:"bytesWritten"`
+	Segment      int       `json:"segment"`
+}
+
+// groupCombine is the combining of a group asked for with CombineGroup.
+type groupCombine struct {
+	mode     string
+	running  bool
+	combined string
+	err      error
+}
+
+// Groups returns the groups with a recording in progress or in the session
+// history, the most recently started first.
+func (rs *RecorderService) Groups() []RecordingGroup {
+	ids := map[string]bool{}
+	for _, info := range rs.GetAllSessionInfo() {
+		if info.Group != "" {
+			ids[info.Group] = true
+		}
+	}
+	for _, id := range rs.fileWriter.finishedGroups() {
+		ids[id] = true
+	}
+	groups := []RecordingGroup{}
+	for id := range ids {
+		if group, ok := rs.Group(id); ok {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].StartedAt.After(groups[j].StartedAt) })
+	return groups
+}
+
+// Group returns the group id, and false when none of its recordings is in
+// progress or in the session history.
+func (rs *RecorderService) Group(id string) (RecordingGroup, bool) {
+	group := RecordingGroup{ID: id, Sessions: []GroupSession{}, Recordings: rs.fileWriter.groupRecordings(id)}
+	var end time.Time
+	rs.mu.Lock()
+	for _, info := range rs.GetAllSessionInfo() {
+		if info.Group != id || !rs.IsRecording(info.TabID) {
+			continue
+		}
+		group.Sessions = append(group.Sessions, GroupSession{
+			TabID:        info.TabID,
+			Name:         info.Name,
+			StartedAt:    info.StartTime,
+			BytesWritten: info.BytesWritten,
+			Segment:      info.Segment,
+		})
+		group.Bytes += info.BytesWritten
+		if group.StartedAt.IsZero() || info.StartTime.Before(group.StartedAt) {
+			group.StartedAt = info.StartTime
+		}
+	}
+	rs.mu.Unlock()
+	for _, recording := range group.Recordings {
+		group.Bytes += recording.Size
+		if group.StartedAt.IsZero() || recording.StartedAt.Before(group.StartedAt) {
+			group.StartedAt = recording.StartedAt
+		}
+		if recording.FinishedAt.After(end) {
+			end = recording.FinishedAt
+		}
+	}
+	group.Active, group.Finished = len(group.Sessions), len(group.Recordings)
+	if group.Active == 0 && group.Finished == 0 {
+		return RecordingGroup{}, false
+	}
+	sort.Slice(group.Sessions, func(i, j int) bool { return group.Sessions[i].StartedAt.Before(group.Sessions[j].StartedAt) })
+	if group.Active > 0 {
+		end = time.Now()
+	}
+	group.DurationSeconds = end.Sub(group.StartedAt).Seconds()
+
+	rs.groupsMu.Lock()
+	if combine, ok := rs.groups[id]; ok {
+		group.Combine, group.Combined = combine.mode, combine.combined
+		if combine.err != nil {
+			group.CombineError = combine.err.Error()
+		}
+	}
+	rs.groupsMu.Unlock()
+	return group, true
+}
+
+// StopGroup stops every recording of the group id in progress with Stop and
+// returns how many it stopped.
+func (rs *RecorderService) StopGroup(ctx context.Context, id string) int {
+	stopped := 0
+	for _, info := range rs.GetAllSessionInfo() {
+		if info.Group != id {
+			continue
+		}
+		if err := rs.Stop(ctx, info.TabID); errors.Is(err, ErrNotRecording) {
+			continue
+		} else if err != nil {
+			LogErrorCtx(ctx, "[RECORDER] Failed to stop recording for tab %d: %v", info.TabID, err)
+			continue
+		}
+		stopped++
+	}
+	LogInfoCtx(ctx, "[RECORDER] Stopped %d recording(s) of group %s", stopped, id)
+	return stopped
+}
+
+// CombineGroup combines the recordings of the group id into one file with
+// mode, CombineMux or CombineConcat, with FFmpeg in the background: now when
+// none of them is in progress, or else once the last one finishes. It returns
+// the group.
+func (rs *RecorderService) CombineGroup(ctx context.Context, id, mode string) (RecordingGroup, error) {
+	if rs.fileWriter.GetPostProcessor() == nil {
+		return RecordingGroup{}, ErrCombineUnavailable
+	}
+	group, ok := rs.Group(id)
+	if !ok {
+		return RecordingGroup{}, ErrGroupNotFound
+	}
+	rs.groupsMu.Lock()
+	if combine, ok := rs.groups[id]; ok && combine.running {
+		rs.groupsMu.Unlock()
+		return group, nil
+	}
+	rs.groups[id] = &groupCombine{mode: mode}
+	rs.groupsMu.Unlock()
+
+	if group.Active > 0 {
+		LogInfoCtx(ctx, "[RECORDER] Group %s will be combined (%s) when its last recording finishes", id, mode)
+	} else {
+		rs.combineGroup(id)
+	}
+	group, _ = rs.Group(id)
+	return group, nil
+}
+
+// groupFinished combines the group id, when it is to be combined and none of
+// its recordings is in progress any more.
+func (rs *RecorderService) groupFinished(id string) {
+	if id == "" {
+		return
+	}
+	for _, info := range rs.GetAllSessionInfo() {
+		if info.Group == id && rs.IsRecording(info.TabID) {
+			return
+		}
+	}
+	rs.groupsMu.Lock()
+	combine, ok := rs.groups[id]
+	pending := ok && !combine.running && combine.combined == "" && combine.err == nil
+	rs.groupsMu.Unlock()
+	if pending {
+		rs.combineGroup(id)
+	}
+}
+
+// combineGroup combines the finished recordings of the group id in the
+// background.
+func (rs *RecorderService) combineGroup(id string) {
+	rs.groupsMu.Lock()
+	combine := rs.groups[id]
+	combine.running = true
+	mode := combine.mode
+	rs.groupsMu.Unlock()
+
+	go func() {
+		defer CapturePanic()
+		combined, err := rs.fileWriter.combineRecordings(id, mode, rs.fileWriter.groupRecordings(id))
+		if err != nil {
+			LogError("[RECORDER] Failed to combine group %s: %v", id, err)
+			rs.fileWriter.stats.RecordError(ErrorKindFFmpeg, err)
+		} else {
+			LogInfo("[RECORDER] Combined group %s into %s", id, combined)
+		}
+		rs.groupsMu.Lock()
+		combine.running = false
+		combine.combined, combine.err = combined, err
+		rs.groupsMu.Unlock()
+	}()
+}
+
+// finishedGroups returns the groups of the recordings in the session history.
+func (fws *FileWriterService) finishedGroups() []string {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	var ids []string
+	for _, recording := range fws.finished {
+		if recording.Group != "" && !slices.Contains(ids, recording.Group) {
+			ids = append(ids, recording.Group)
+		}
+	}
+	return ids
+}
+
+// groupRecordings returns the recordings of the group id in the session
+// history, in the order they started.
+func (fws *FileWriterService) groupRecordings(id string) []FinishedRecording {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	recordings := []FinishedRecording{}
+	for _, recording := range fws.finished {
+		if recording.Group == id {
+			recordings = append(recordings, recording)
+		}
+	}
+	sort.SliceStable(recordings, func(i, j int) bool { return recordings[i].StartedAt.Before(recordings[j].StartedAt) })
+	return recordings
+}
+
+// combineRecordings combines the files of recordings, those of the group id,
+// into one file next to the first with mode and returns its path: id-mux.mkv
+// (.mka when they are all audio-only) or id-concat with the format of the
+// first.
+func (fws *FileWriterService) combineRecordings(id, mode string, recordings []FinishedRecording) (string, error) {
+	var files []string
+	for _, recording := range recordings {
+		if _, err := os.Stat(recording.Path); err != nil {
+			return "", fmt.Errorf("%s is missing: %w", recording.Name, err)
+		}
+		if len(recording.Parts) == 0 {
+			files = append(files, recording.Path)
+			continue
+		}
+		if mode == CombineMux {
+			return "", fmt.Errorf("%s is in parts and cannot be muxed", recording.Name)
+		}
+		for _, part := range recording.Parts {
+			files = append(files, filepath.Join(filepath.Dir(recording.Path), part))
+		}
+	}
+	if len(files) < 2 {
+		return "", errors.New("the group has fewer than two recordings to combine")
+	}
+
+	var args []string
+	ext := filepath.Ext(files[0])
+	muxer := ffmpegMuxer(files[0])
+	switch mode {
+	case CombineMux:
+		ext, muxer = ".mkv", "matroska"
+		audioOnly := true
+		for _, file := range files {
+			args = append(args, "-i", file)
+			audioOnly = audioOnly && IsAudioRecording(file)
+		}
+		if audioOnly {
+			ext = ".mka"
+		}
+		for i := range files {
+			args = append(args, "-map", fmt.Sprint(i))
+		}
+	case CombineConcat:
+		list := filepath.Join(filepath.Dir(files[0]), ".concat_"+id+".txt")
+		var b strings.Builder
+		for _, file := range files {
+			fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(file, "'", `'\''`))
+		}
+		if err := os.WriteFile(list, []byte(b.String()), 0644); err != nil {
+			return "", fmt.Errorf("failed to write the list of recordings: %w", err)
+		}
+		defer os.Remove(list)
+		args = append(args, "-f", "concat", "-safe", "0", "-i", list)
+	default:
+		return "", fmt.Errorf("unknown combine mode %q", mode)
+	}
+
+	file, err := createRecordingFile(filepath.Dir(files[0]), id+"-"+mode, ext)
+	if err != nil {
+		return "", err
+	}
+	output := file.Name()
+	file.Close()
+	temp := filepath.Join(filepath.Dir(output), ".temp_"+filepath.Base(output))
+	args = append(args, "-c", "copy", "-f", muxer, "-y", temp)
+
+	fws.jobs.acquire(false)
+	defer fws.jobs.release()
+	LogInfo("[FILEWRITER] Combining %d recording(s) of group %s (%s)", len(files), id, mode)
+	if out, err := exec.Command(fws.GetPostProcessor().FFmpegPath(), args...).CombinedOutput(); err != nil {
+		LogError("[FILEWRITER] FFmpeg failed: %v\nOutput: %s", err, string(out))
+		os.Remove(temp)
+		os.Remove(output)
+		return "", fmt.Errorf("FFmpeg failed to combine the recordings: %w", err)
+	}
+	if err := os.Rename(temp, output); err != nil {
+		os.Remove(temp)
+		os.Remove(output)
+		return "", fmt.Errorf("failed to save the combined recording: %w", err)
+	}
+	return output, nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSessionHistory is how many finished recordings the session history
+// keeps.
+const maxSessionHistory = 100
+
+// Outcomes of a finished recording session.
+const (
+	SessionCompleted = "completed"
+	SessionFailed    = "failed"
+	SessionTimedOut  = "timeout"
+	// SessionInterrupted is a recording finished because the extension
+	// crashed while recording it.
+	SessionInterrupted = "interrupted"
+)
+
+// Outcomes of the post-processing of a finished recording.
+const (
+	PostProcessingDone    = "done"
+	PostProcessingFailed  = "failed"
+	PostProcessingSkipped = "skipped"
+)
+
+// sessionOutcome is the Outcome of recording: failed when writing or
+// post-processing it failed, timeout when it was finished because no data
+// arrived, interrupted when the extension crashed, and completed otherwise.
+func sessionOutcome(recording FinishedRecording) string {
+	switch {
+	case recording.Error != "":
+		return SessionFailed
+	case recording.Status == RecordingTimedOut:
+		return SessionTimedOut
+	case recording.Status == RecordingInterrupted:
+		return SessionInterrupted
+	}
+	return SessionCompleted
+}
+
+// ValidSessionOutcome reports whether outcome is one of the outcomes of a
+// finished recording session.
+func ValidSessionOutcome(outcome string) bool {
+	return outcome == SessionCompleted || outcome == SessionFailed || outcome == SessionTimedOut || outcome == SessionInterrupted
+}
+
+// LoadSessionHistory reads the recordings finished before the server started
+// from path, and keeps the history there from now on.
+func (fws *FileWriterService) LoadSessionHistory(path string) error {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.historyPath = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read session history: %w", err)
+	}
+	var recordings []FinishedRecording
+	if err := json.Unmarshal(data, &recordings); err != nil {
+		return fmt.Errorf("failed to parse session history: %w", err)
+	}
+	fws.finished = append(fws.finished, recordings...)
+	if len(fws.finished) > maxSessionHistory {
+		fws.finished = fws.finished[:maxSessionHistory]
+	}
+	return nil
+}
+
+// Sessions returns up to limit finished recordings with outcome, or of any
+// outcome when it is empty, newest first. A query keeps those whose file
+// name, title, or page title or URL contain it, ignoring case.
+func (fws *FileWriterService) Sessions(outcome, query string, limit int) []FinishedRecording {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	sessions := []FinishedRecording{}
+	for _, recording := range fws.finished {
+		if len(sessions) == limit {
+			break
+		}
+		if outcome != "" && recording.Outcome != outcome {
+			continue
+		}
+		if query != "" && !recording.matches(query) {
+			continue
+		}
+		sessions = append(sessions, recording)
+	}
+	return sessions
+}
+
+// matches reports whether the file name, title or source of recording
+// contain query, ignoring case.
+func (r FinishedRecording) matches(query string) bool {
+	lower := strings.ToLower(query)
+	return strings.Contains(strings.ToLower(r.Name), lower) ||
+		strings.Contains(strings.ToLower(r.Title), lower) ||
+		r.Source.Matches(query)
+}
+
+func (fws *FileWriterService) saveHistoryLocked() error {
+	data, err := json.MarshalIndent(fws.finished, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fws.historyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := fws.historyPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session history: %w", err)
+	}
+	if err := os.Rename(tmp, fws.historyPath); err != nil {
+		return fmt.Errorf("failed to save session history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LivePlaylist is the HLS playlist of a live stream; its segments are .ts
+// files next to it.
+const LivePlaylist = "index.m3u8"
+
+// liveSegmentSeconds and liveSegments are the length of the segments of a
+// live stream and how many of them the playlist lists, which keeps the
+// stream a few seconds behind the tab.
+const (
+	liveSegmentSeconds = 2
+	liveSegments       = 6
+)
+
+// liveBuffer is how many chunks FFmpeg may fall behind by before the live
+// stream ends; the recording file never waits for it.
+const liveBuffer = 32
+
+// liveStopTimeout is how long FFmpeg gets to finish a live stream before it
+// is killed.
+const liveStopTimeout = 5 * time.Second
+
+// HLSOutputEnabled reports whether HLS_OUTPUT asks for live streams of the
+// recordings.
+func HLSOutputEnabled() bool {
+	return isTruthy(os.Getenv("HLS_OUTPUT"))
+}
+
+// LiveStreams tees the recordings being written through FFmpeg into HLS
+// playlists, so that other devices on the LAN can watch them as they are
+// recorded. The playlist of a recording lives in a temporary directory until
+// the recording ends; each file of a split recording continues it after a
+// discontinuity.
+type LiveStreams struct {
+	ffmpegPath string
+	enabled    bool
+	dir        string
+	streams    map[int]*liveStream
+	removals   sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// liveStream is the live stream of the recording of a tab.
+type liveStream struct {
+	dir string
+	// parts is how many files of the recording have been streamed.
+	parts   int
+	encoder *liveEncoder
+}
+
+// NewLiveStreams returns live streams encoded with the FFmpeg at ffmpegPath,
+// on when enabled.
+func NewLiveStreams(ffmpegPath string, enabled bool) *LiveStreams {
+	return &LiveStreams{ffmpegPath: ffmpegPath, enabled: enabled, streams: make(map[int]*liveStream)}
+}
+
+// SetEnabled turns live streams of new recording files on or off.
+func (ls *LiveStreams) SetEnabled(enabled bool) {
+	if ls == nil {
+		return
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.enabled = enabled
+}
+
+// Active reports whether the recording of tabID is being streamed.
+func (ls *LiveStreams) Active(tabID int) bool {
+	if ls == nil {
+		return false
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	stream, ok := ls.streams[tabID]
+	return ok && stream.encoder != nil && !stream.encoder.stopped()
+}
+
+// File returns the path of name, the playlist or a segment, in the live
+// stream of tabID.
+func (ls *LiveStreams) File(tabID int, name string) (string, bool) {
+	if ls == nil || name != filepath.Base(name) || (name != LivePlaylist && filepath.Ext(name) != ".ts") {
+		return "", false
+	}
+	ls.mu.Lock()
+	stream, ok := ls.streams[tabID]
+	ls.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	path := filepath.Join(stream.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// start begins streaming a new file of the recording of tabID, recorded as
+// format. It returns nil when live streams are off or FFmpeg cannot start.
+func (ls *LiveStreams) start(tabID int, format RecordingFormat) *liveEncoder {
+	if ls == nil {
+		return nil
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if !ls.enabled {
+		return nil
+	}
+	if ls.dir == "" {
+		dir, err := os.MkdirTemp("", "tab-recorder-live-")
+		if err != nil {
+			LogError("[LIVE] Failed to create the live stream directory: %v", err)
+			return nil
+		}
+		ls.dir = dir
+	}
+	stream, ok := ls.streams[tabID]
+	if !ok {
+		stream = &liveStream{dir: filepath.Join(ls.dir, "tab-"+strconv.Itoa(tabID))}
+		if err := os.MkdirAll(stream.dir, 0700); err != nil {
+			LogError("[LIVE] Failed to create the live stream directory of tab %d: %v", tabID, err)
+			return nil
+		}
+		ls.streams[tabID] = stream
+	}
+	stream.parts++
+	encoder, err := startLiveEncoder(ls.ffmpegPath, tabID, stream.dir, stream.parts, format)
+	if err != nil {
+		LogError("[LIVE] Failed to start the live stream of tab %d: %v", tabID, err)
+		return nil
+	}
+	stream.encoder = encoder
+	LogInfo("[LIVE] Streaming the recording of tab %d to %s", tabID, filepath.Join(stream.dir, LivePlaylist))
+	return encoder
+}
+
+// end removes the live stream of tabID once its recording has ended.
+func (ls *LiveStreams) end(tabID int) {
+	if ls == nil {
+		return
+	}
+	ls.mu.Lock()
+	stream, ok := ls.streams[tabID]
+	delete(ls.streams, tabID)
+	ls.mu.Unlock()
+	if !ok {
+		return
+	}
+	ls.removals.Add(1)
+	go func() {
+		defer CapturePanic()
+		defer ls.removals.Done()
+		stream.encoder.stop()
+		if err := os.RemoveAll(stream.dir); err != nil {
+			LogError("[LIVE] Failed to remove the live stream of tab %d: %v", tabID, err)
+		}
+	}()
+}
+
+// Close ends every live stream and removes their directory, when the server
+// shuts down.
+func (ls *LiveStreams) Close() {
+	if ls == nil {
+		return
+	}
+	ls.mu.Lock()
+	tabs := make([]int, 0, len(ls.streams))
+	for tabID := range ls.streams {
+		tabs = append(tabs, tabID)
+	}
+	ls.mu.Unlock()
+	for _, tabID := range tabs {
+		ls.end(tabID)
+	}
+	ls.removals.Wait()
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.dir != "" {
+		os.RemoveAll(ls.dir)
+		ls.dir = ""
+	}
+}
+
+// liveEncoder is the FFmpeg process that encodes one recording file into the
+// live stream. Chunks are queued, so that a slow FFmpeg never holds up the
+// recording; when it falls too far behind, the live stream ends.
+type liveEncoder struct {
+	tabID  int
+	cmd    *exec.Cmd
+	chunks chan []byte
+	// exited is closed once FFmpeg has exited.
+	exited chan struct{}
+	closed bool
+	// killed is set when FFmpeg is killed rather than left to finish.
+	killed bool
+	mu     sync.Mutex
+}
+
+// liveArgs returns the FFmpeg arguments that encode a recording of format,
+// read from standard input, into the playlist in dir. Browsers record codecs
+// HLS players cannot play, so the stream is encoded as H.264 and AAC.
+func liveArgs(dir string, part int, format RecordingFormat) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	if format.AudioOnly {
+		args = append(args, "-vn")
+	} else {
+		args = append(args,
+			"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency",
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", liveSegmentSeconds),
+		)
+	}
+	return append(args,
+		"-c:a", "aac",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(liveSegmentSeconds),
+		"-hls_list_size", strconv.Itoa(liveSegments),
+		"-hls_flags", "delete_segments+append_list+discont_start+omit_endlist+temp_file",
+		"-hls_segment_filename", filepath.Join(dir, fmt.Sprintf("part%d_%%05d.ts", part)),
+		filepath.Join(dir, LivePlaylist),
+	)
+}
+
+func startLiveEncoder(ffmpegPath string, tabID int, dir string, part int, format RecordingFormat) (*liveEncoder, error) {
+	cmd := exec.Command(ffmpegPath, liveArgs(dir, part, format)...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	e := &liveEncoder{tabID: tabID, cmd: cmd, chunks: make(chan []byte, liveBuffer), exited: make(chan struct{})}
+	go func() {
+		defer CapturePanic()
+		defer close(e.exited)
+		e.feed(stdin)
+		if err := cmd.Wait(); err != nil && !e.wasKilled() {
+			LogError("[LIVE] FFmpeg failed for the live stream of tab %d: %v\n%s", tabID, err, strings.TrimSpace(stderr.String()))
+		}
+	}()
+	return e, nil
+}
+
+// feed writes the queued chunks to FFmpeg until the file is closed. Chunks
+// FFmpeg no longer reads are dropped.
+func (e *liveEncoder) feed(stdin io.WriteCloser) {
+	failed := false
+	for chunk := range e.chunks {
+		if failed {
+			continue
+		}
+		if _, err := stdin.Write(chunk); err != nil {
+			LogError("[LIVE] Live stream of tab %d ended: %v", e.tabID, err)
+			failed = true
+		}
+	}
+	stdin.Close()
+}
+
+// write queues a chunk of the recording, in the order the file gets them.
+func (e *liveEncoder) write(data []byte) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	// FFmpeg reads the chunk after it was written, by when the buffer it is
+	// in is reused
+	select {
+	case e.chunks <- append([]byte(nil), data...):
+	default:
+		LogError("[LIVE] FFmpeg fell behind, live stream of tab %d ended", e.tabID)
+		e.closeLocked()
+		e.killLocked()
+	}
+}
+
+// close ends the input of FFmpeg when the file is closed, so that it
+// finishes the stream.
+func (e *liveEncoder) close() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closeLocked()
+}
+
+func (e *liveEncoder) closeLocked() {
+	if !e.closed {
+		e.closed = true
+		close(e.chunks)
+	}
+}
+
+func (e *liveEncoder) killLocked() {
+	e.killed = true
+	e.cmd.Process.Kill()
+}
+
+func (e *liveEncoder) wasKilled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.killed
+}
+
+// stopped reports whether the input of FFmpeg has ended.
+func (e *liveEncoder) stopped() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
+
+// stop ends the input of FFmpeg and waits for it to exit, killing it after
+// liveStopTimeout.
+func (e *liveEncoder) stop() {
+	if e == nil {
+		return
+	}
+	e.close()
+	select {
+	case <-e.exited:
+	case <-time.After(liveStopTimeout):
+		e.mu.Lock()
+		e.killLocked()
+		e.mu.Unlock()
+		<-e.exited
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// HomeAssistantState is the state of the recorder served at
+// /api/homeassistant, flat enough for the value templates of Home
+// Assistant's RESTful sensors. Fields are added to it but never renamed or
+// removed, as users' sensor configurations depend on them.
+type HomeAssistantState struct {
+	// State is "recording" while any recording is in progress, else "idle".
+	State          string         `json:"state"`
+	Recording      bool           `json:"recording"`
+	ActiveSessions int            `json:"activeSessions"`
+	Sessions       []GroupSession `json:"sessions"`
+	// DiskFreeGB is the free space on the drive of the recordings
+	// directory, or null when it cannot be read.
+	DiskFreeGB *float64 `json:"diskFreeGB"`
+	// LastRecording is the most recently finished recording, or null.
+	LastRecording *FinishedRecording `json:"lastRecording"`
+	Time          time.Time          `json:"time"`
+}
+
+// HomeAssistantState returns the recordings in progress, the oldest first,
+// the free disk space and the last finished recording.
+func (rs *RecorderService) HomeAssistantState() HomeAssistantState {
+	state := HomeAssistantState{State: "idle", Sessions: []GroupSession{}, Time: time.Now()}
+	rs.mu.Lock()
+	for _, info := range rs.GetAllSessionInfo() {
+		if !rs.IsRecording(info.TabID) {
+			continue
+		}
+		state.Sessions = append(state.Sessions, GroupSession{
+			TabID:        info.TabID,
+			Name:         info.Name,
+			StartedAt:    info.StartTime,
+			BytesWritten: info.BytesWritten,
+			Segment:      info.Segment,
+		})
+	}
+	rs.mu.Unlock()
+	sort.Slice(state.Sessions, func(i, j int) bool { return state.Sessions[i].StartedAt.Before(state.Sessions[j].StartedAt) })
+	state.ActiveSessions = len(state.Sessions)
+	if state.ActiveSessions > 0 {
+		state.State, state.Recording = "recording", true
+	}
+
+	if free, err := FreeDiskSpace(rs.fileWriter.GetDownloadDir()); err == nil {
+		gb := math.Round(float64(free)/(1024*1024*1024)*100) / 100
+		state.DiskFreeGB = &gb
+	}
+	if finished := rs.fileWriter.Finished(); len(finished) > 0 {
+		state.LastRecording = &finished[0]
+	}
+	return state
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hook points, each run with its own command.
+const (
+	// HookOnStart runs when a new recording starts.
+	HookOnStart = "on_start"
+	// HookOnChunkError runs when a chunk of a recording cannot be written.
+	HookOnChunkError = "on_chunk_error"
+	// HookOnFinalize runs when the file of a recording is closed, before
+	// FFmpeg fixes it.
+	HookOnFinalize = "on_finalize"
+	// HookOnPostprocessDone runs once the file is post-processed, or fixing
+	// it failed, and it is in the history.
+	HookOnPostprocessDone = "on_postprocess_done"
+)
+
+// HookEventEnv names the hook point a command is run for in its environment.
+const HookEventEnv = "RECORDER_HOOK"
+
+const defaultHookTimeout = 60 * time.Second
+
+// HookEvents lists every hook point, with the environment variable that sets
+// its command.
+var HookEvents = map[string]string{
+	HookOnStart:           "HOOK_ON_START",
+	HookOnChunkError:      "HOOK_ON_CHUNK_ERROR",
+	HookOnFinalize:        "HOOK_ON_FINALIZE",
+	HookOnPostprocessDone: "HOOK_ON_POSTPROCESS_DONE",
+}
+
+// HookConfig says which command runs at each hook point.
+type HookConfig struct {
+	// Commands maps a hook point to the path of the script or program run
+	// for it; hook points without one run nothing.
+	Commands map[string]string
+	// Timeout is how long a command may run before it is killed.
+	Timeout time.Duration
+}
+
+// LoadHookConfigFromEnv returns the commands set by HOOK_ON_START,
+// HOOK_ON_CHUNK_ERROR, HOOK_ON_FINALIZE and HOOK_ON_POSTPROCESS_DONE, killed
+// after HOOK_TIMEOUT_SECONDS (60 by default).
+func LoadHookConfigFromEnv() HookConfig {
+	config := HookConfig{Commands: make(map[string]string), Timeout: defaultHookTimeout}
+	for event, env := range HookEvents {
+		if command := strings.TrimSpace(os.Getenv(env)); command != "" {
+			config.Commands[event] = command
+		}
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("HOOK_TIMEOUT_SECONDS"), 64); err == nil && v > 0 {
+		config.Timeout = time.Duration(v * float64(time.Second))
+	}
+	return config
+}
+
+// HookPayload is the JSON a hook command gets on its standard input.
+type HookPayload struct {
+	Event     string           `json:"event"`
+	Time      time.Time        `json:"time"`
+	Recording WebhookRecording `json:"recording"`
+}
+
+// HookRunner runs the commands set for the hook points, so that users can
+// automate what happens to recordings with their own scripts, e.g. upload a
+// finished file. A nil *HookRunner runs nothing.
+type HookRunner struct {
+	config HookConfig
+	// chunkErrors holds the tabs whose on_chunk_error command is running;
+	// chunk errors of the tab meanwhile, e.g. one for every chunk on a
+	// failing disk, are skipped rather than piling up commands. The other
+	// hook points are reached once per file, and always run.
+	chunkErrors map[int]bool
+	mu          sync.Mutex
+}
+
+// NewHookRunner returns a runner for config.
+func NewHookRunner(config HookConfig) *HookRunner {
+	if len(config.Commands) > 0 {
+		LogInfo("[HOOK] Running commands for %d hook point(s)", len(config.Commands))
+	}
+	return &HookRunner{config: config, chunkErrors: make(map[int]bool)}
+}
+
+// Config returns the commands being run.
+func (hr *HookRunner) Config() HookConfig {
+	if hr == nil {
+		return HookConfig{}
+	}
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	return hr.config
+}
+
+// SetConfig changes the commands run at the hook points. Commands already
+// running are left to finish.
+func (hr *HookRunner) SetConfig(config HookConfig) {
+	if hr == nil {
+		return
+	}
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.config = config
+	LogInfo("[HOOK] Running commands for %d hook point(s)", len(config.Commands))
+}
+
+// Run starts the command of event, if it has one, with a HookPayload for
+// recording on its standard input and event in RECORDER_HOOK. It does not
+// wait for the command, whose output is logged, and skips on_chunk_error
+// while the previous one for the same tab still runs.
+func (hr *HookRunner) Run(event string, recording WebhookRecording) {
+	if hr == nil {
+		return
+	}
+	hr.mu.Lock()
+	command, timeout := hr.config.Commands[event], hr.config.Timeout
+	if command == "" {
+		hr.mu.Unlock()
+		return
+	}
+	if event == HookOnChunkError {
+		if hr.chunkErrors[recording.TabID] {
+			LogDebug("[HOOK] Skipped %s for tab %d, its command is still running", event, recording.TabID)
+			hr.mu.Unlock()
+			return
+		}
+		hr.chunkErrors[recording.TabID] = true
+	}
+	hr.mu.Unlock()
+
+	body, err := json.Marshal(HookPayload{Event: event, Time: time.Now().UTC(), Recording: recording})
+	if err != nil {
+		LogError("[HOOK] Failed to encode %s: %v", event, err)
+		hr.done(event, recording.TabID)
+		return
+	}
+	go func() {
+		defer CapturePanic()
+		defer hr.done(event, recording.TabID)
+		hr.exec(event, command, timeout, body)
+	}()
+}
+
+// exec runs command for event with body on its standard input.
+func (hr *HookRunner) exec(event, command string, timeout time.Duration, body []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), HookEventEnv+"="+event)
+	started := time.Now()
+	output, err := cmd.CombinedOutput()
+	if out := strings.TrimSpace(string(output)); out != "" {
+		LogInfo("[HOOK] %s: %s", event, out)
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		LogError("[HOOK] %s command %s was killed after %s", event, command, timeout)
+	case err != nil:
+		LogError("[HOOK] %s command %s failed: %v", event, command, err)
+	default:
+		LogInfo("[HOOK] Ran %s command %s in %s", event, command, time.Since(started).Round(time.Millisecond))
+	}
+}
+
+func (hr *HookRunner) done(event string, tabID int) {
+	if event != HookOnChunkError {
+		return
+	}
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	delete(hr.chunkErrors, tabID)
+}
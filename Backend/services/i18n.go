@@ -0,0 +1,194 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the language messages are written in, and what requests
+// get when none of their languages has a bundle.
+const DefaultLanguage = "en"
+
+// localeFiles are the translation bundles, one per language, named after its
+// code (e.g. "es.json"). A bundle maps English messages to their translation;
+// a message may contain fmt verbs such as %d or %v, which match the values
+// formatted into it and may be reordered in the translation with %[n]v.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Language is a language with a translation bundle.
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type localeBundle struct {
+	Name     string            `json:"name"`
+	Messages map[string]string `json:"messages"`
+	patterns []messagePattern
+}
+
+// messagePattern matches messages formatted from a bundle key with verbs.
+type messagePattern struct {
+	match       *regexp.Regexp
+	translation string
+}
+
+// formatVerb matches the fmt verbs a message key may contain, and %%.
+var formatVerb = regexp.MustCompile(`%%|%(\[(\d+)\])?[dsvq]`)
+
+// locales are the bundles keyed by language code, loaded once.
+var locales = sync.OnceValue(loadLocales)
+
+func loadLocales() map[string]*localeBundle {
+	bundles := make(map[string]*localeBundle)
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		LogError("[I18N] Failed to read translation bundles: %v", err)
+		return bundles
+	}
+	for _, entry := range entries {
+		code := strings.TrimSuffix(entry.Name(), ".json")
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			LogError("[I18N] Failed to read %s: %v", entry.Name(), err)
+			continue
+		}
+		var bundle localeBundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			LogError("[I18N] Invalid translation bundle %s: %v", entry.Name(), err)
+			continue
+		}
+		for key, translation := range bundle.Messages {
+			if !formatVerb.MatchString(key) {
+				continue
+			}
+			pattern, err := compileMessagePattern(key)
+			if err != nil {
+				LogError("[I18N] Invalid message %q in %s: %v", key, entry.Name(), err)
+				continue
+			}
+			bundle.patterns = append(bundle.patterns, messagePattern{match: pattern, translation: translation})
+		}
+		bundles[code] = &bundle
+	}
+	return bundles
+}
+
+// compileMessagePattern turns a message with fmt verbs into a regular
+// expression that captures the formatted values.
+func compileMessagePattern(key string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range formatVerb.FindAllStringIndex(key, -1) {
+		expr.WriteString(regexp.QuoteMeta(key[last:loc[0]]))
+		if key[loc[0]:loc[1]] == "%%" {
+			expr.WriteString("%")
+		} else {
+			expr.WriteString("(.*?)")
+		}
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(key[last:]))
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// Languages returns the languages with a translation bundle, by code.
+func Languages() []Language {
+	var languages []Language
+	for code, bundle := range locales() {
+		languages = append(languages, Language{Code: code, Name: bundle.Name})
+	}
+	sort.Slice(languages, func(i, j int) bool { return languages[i].Code < languages[j].Code })
+	return languages
+}
+
+// SupportedLanguage reports whether code has a translation bundle.
+func SupportedLanguage(code string) bool {
+	_, ok := locales()[code]
+	return ok
+}
+
+// Messages returns the translations for language, keyed by English message.
+func Messages(language string) map[string]string {
+	bundle, ok := locales()[language]
+	if !ok {
+		return map[string]string{}
+	}
+	return bundle.Messages
+}
+
+// Translate returns message in language, or message itself when the bundle
+// has no translation for it.
+func Translate(language, message string) string {
+	bundle, ok := locales()[language]
+	if !ok || language == DefaultLanguage {
+		return message
+	}
+	if translation, ok := bundle.Messages[message]; ok {
+		return translation
+	}
+	for _, pattern := range bundle.patterns {
+		if values := pattern.match.FindStringSubmatch(message); values != nil {
+			return formatTranslation(pattern.translation, values[1:])
+		}
+	}
+	return message
+}
+
+// formatTranslation puts values, in the order their verbs appear in the
+// English message, in place of the verbs of translation.
+func formatTranslation(translation string, values []string) string {
+	next := 0
+	return formatVerb.ReplaceAllStringFunc(translation, func(verb string) string {
+		if verb == "%%" {
+			return "%"
+		}
+		i := next
+		if m := formatVerb.FindStringSubmatch(verb); m[2] != "" {
+			n, _ := strconv.Atoi(m[2])
+			i = n - 1
+		} else {
+			next++
+		}
+		if i < 0 || i >= len(values) {
+			return fmt.Sprintf("%%!(MISSING %s)", verb)
+		}
+		return values[i]
+	})
+}
+
+// NegotiateLanguage picks the supported language the client prefers most from
+// an Accept-Language header, or DefaultLanguage.
+func NegotiateLanguage(acceptLanguage string) string {
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		code := strings.ToLower(tag)
+		if !SupportedLanguage(code) {
+			code, _, _ = strings.Cut(code, "-")
+		}
+		if q > bestQ && SupportedLanguage(code) {
+			best, bestQ = code, q
+		}
+	}
+	return best
+}
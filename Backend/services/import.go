@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedImport is returned by Import for files that are not
+// recordings this server produces.
+var ErrUnsupportedImport = errors.New("only WebM, MKV and MP4 recordings and Ogg audio can be imported")
+
+// MaxImportSize is the largest file Import is given, in bytes: several hours
+// of a tab recorded at a high bitrate.
+const MaxImportSize = 16 << 30
+
+// Import copies a video from outside, such as a file dropped onto the window,
+// into the recordings directory. It goes through the same steps as a finished
+// recording: the FFmpeg metadata fix, the stats and the recent recordings.
+// name is the original file name; the copy is never written over an existing
+// recording.
+func (fws *FileWriterService) Import(name string, r io.Reader) (FinishedRecording, error) {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if !isRecordingFile(name) {
+		return FinishedRecording{}, ErrUnsupportedImport
+	}
+
+	fws.mu.Lock()
+	dir, clock := fws.downloadDir, fws.clock
+	fws.mu.Unlock()
+	if err := fws.ensureDirectory(dir); err != nil {
+		return FinishedRecording{}, err
+	}
+
+	base := RenderRecordingName("{name}", "", strings.TrimSuffix(name, filepath.Ext(name)), 0, 0, RecordingSource{}, clock)
+	file, err := createRecordingFile(dir, base, strings.ToLower(filepath.Ext(name)))
+	if err != nil {
+		return FinishedRecording{}, err
+	}
+	filename := file.Name()
+	size, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return FinishedRecording{}, fmt.Errorf("failed to import %s: %w", name, err)
+	}
+	LogInfo("[FILEWRITER] Imported %s as %s", name, filename)
+
+	fws.stats.IncrementSession()
+	fws.stats.AddSize(size)
+	err = fws.postProcess(filename, false)
+	return fws.addFinished(filename, FinishedRecording{PostProcessing: fws.postProcessingOutcome(err)}), nil
+}
@@ -1,19 +1,33 @@
 package services
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
 
 type FFmpegInstaller struct {
 	os string
+	// proxyEnv is given to the package manager when a proxy is configured.
+	proxyEnv []string
+	proxyErr error
+	// output receives the output of the package manager line by line, when
+	// the install runs as a job (see StartInstall).
+	output func(line string)
 }
 
 func NewFFmpegInstaller() *FFmpegInstaller {
+	env, err := proxyEnv("ffmpeg")
 	return &FFmpegInstaller{
-		os: runtime.GOOS,
+		os:       runtime.GOOS,
+		proxyEnv: env,
+		proxyErr: err,
 	}
 }
 
@@ -27,6 +41,83 @@ func (fi *FFmpegInstaller) IsFFmpegInstalled(ffmpegPath string) bool {
 
 func (fi *FFmpegInstaller) AttemptInstall() error {
 	LogInfo("[INSTALLER] FFmpeg not found, attempting automatic installation...")
+	return fi.install()
+}
+
+// IsFFprobeInstalled reports whether ffprobe runs at ffprobePath.
+func (fi *FFmpegInstaller) IsFFprobeInstalled(ffprobePath string) bool {
+	return exec.Command(ffprobePath, "-version").Run() == nil
+}
+
+// AttemptInstallFFprobe installs ffprobe for an FFmpeg that came without it,
+// e.g. a static ffmpeg binary. Every package manager ships ffprobe in its
+// FFmpeg package, so that is what is installed.
+func (fi *FFmpegInstaller) AttemptInstallFFprobe() error {
+	LogInfo("[INSTALLER] ffprobe not found, installing the FFmpeg package that includes it...")
+	return fi.install()
+}
+
+// AttemptUpgrade replaces the static build of FFmpeg and ffprobe the server
+// installed (see ManagedFFmpegDir) with the latest one, or with the one in
+// the offline archive.
+func (fi *FFmpegInstaller) AttemptUpgrade() error {
+	LogInfo("[INSTALLER] Upgrading the static build of FFmpeg...")
+	if offlineFFmpeg() {
+		return fi.installOffline()
+	}
+	return fi.installStatic()
+}
+
+// StartInstall runs install, AttemptInstall or AttemptInstallFFprobe of a
+// copy of fi, as a job of jobs that reports the output of the package manager
+// and the progress in it, then done, which checks what was installed and
+// returns the path of the ffmpeg to use, and SelfTestFFmpeg on it. An install
+// already running is returned instead of starting another.
+func (fi *FFmpegInstaller) StartInstall(jobs *JobStore, name string, done func() (string, error)) Job {
+	attempt := (*FFmpegInstaller).AttemptInstall
+	if name == DependencyFFprobe {
+		attempt = (*FFmpegInstaller).AttemptInstallFFprobe
+	}
+	return fi.start(jobs, fmt.Sprintf("Installing %s", name), name, attempt, done)
+}
+
+// StartUpgrade runs AttemptUpgrade as a job like StartInstall, of the same
+// kind, so that it does not run while FFmpeg is being installed.
+func (fi *FFmpegInstaller) StartUpgrade(jobs *JobStore, done func() (string, error)) Job {
+	return fi.start(jobs, "Upgrading ffmpeg", DependencyFFmpeg, (*FFmpegInstaller).AttemptUpgrade, done)
+}
+
+func (fi *FFmpegInstaller) start(jobs *JobStore, message, name string, attempt func(*FFmpegInstaller) error, done func() (string, error)) Job {
+	job, _ := jobs.Start(JobInstall, message, func(report *JobReport) error {
+		worker := *fi
+		worker.output = report.Output
+		err := attempt(&worker)
+		if err == nil {
+			report.Step(fmt.Sprintf("Checking %s", name))
+			var ffmpeg string
+			if ffmpeg, err = done(); err == nil {
+				report.Step("Testing FFmpeg")
+				err = SelfTestFFmpeg(ffmpeg, report.Output)
+			}
+		}
+		if err != nil {
+			LogError("[INSTALLER] %s failed: %v", message, err)
+			LogInfo("[INSTALLER] Please install FFmpeg manually from: https://ffmpeg.org/download.html")
+			return err
+		}
+		LogInfo("[INSTALLER] %s succeeded", message)
+		return nil
+	})
+	return job
+}
+
+func (fi *FFmpegInstaller) install() error {
+	if offlineFFmpeg() {
+		return fi.installOffline()
+	}
+	if fi.proxyErr != nil {
+		return fi.proxyErr
+	}
 	LogInfo("[INSTALLER] Detected OS: %s", fi.os)
 	
 	switch fi.os {
@@ -41,26 +132,95 @@ func (fi *FFmpegInstaller) AttemptInstall() error {
 	}
 }
 
+// installWindows installs FFmpeg with winget, Scoop or Chocolatey, the first
+// of them that is there and succeeds, and puts where it went on the PATH of
+// the server.
 func (fi *FFmpegInstaller) installWindows() error {
-	LogInfo("[INSTALLER] Attempting to install FFmpeg using winget...")
-	
-	cmd := exec.Command("winget", "--version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("winget not available - please install FFmpeg manually from https://ffmpeg.org/download.html")
+	choco := []string{"install", "ffmpeg", "-y"}
+	if proxy := fi.proxyURL(); proxy != "" {
+		// The elevated process does not get the environment of the server
+		choco = append(choco, "--proxy="+proxy)
 	}
-	
-	LogInfo("[INSTALLER] Winget found, installing FFmpeg...")
-	installCmd := exec.Command("winget", "install", "--id=Gyan.FFmpeg", "--silent", "--accept-package-agreements", "--accept-source-agreements")
-	output, err := installCmd.CombinedOutput()
-	
-	if err != nil {
-		LogError("[INSTALLER] Winget installation failed: %v\nOutput: %s", err, string(output))
-		return fmt.Errorf("winget installation failed: %w", err)
+	managers := []struct {
+		name     string
+		command  string
+		args     []string
+		elevated bool
+	}{
+		{"winget", "winget", []string{"install", "--id=Gyan.FFmpeg", "--silent", "--accept-package-agreements", "--accept-source-agreements"}, false},
+		// Scoop installs for the user, without elevation
+		{"Scoop", "scoop", []string{"install", "ffmpeg"}, false},
+		// Chocolatey needs administrator rights
+		{"Chocolatey", "choco", choco, true},
 	}
-	
-	LogInfo("[INSTALLER] FFmpeg installed successfully via winget")
-	LogInfo("[INSTALLER] You may need to restart the application for PATH changes to take effect")
-	return nil
+
+	var failures []string
+	for _, manager := range managers {
+		if !fi.hasCommand(manager.command) {
+			continue
+		}
+		LogInfo("[INSTALLER] %s found, installing FFmpeg...", manager.name)
+		cmd := fi.command(manager.command, manager.args...)
+		if manager.elevated {
+			cmd = fi.privileged(manager.command, manager.args...)
+		}
+		output, err := fi.run(cmd)
+		if err != nil {
+			LogError("[INSTALLER] %s installation failed: %v\nOutput: %s", manager.name, err, string(output))
+			failures = append(failures, fmt.Sprintf("%s: %v", manager.name, err))
+			continue
+		}
+		LogInfo("[INSTALLER] FFmpeg installed successfully via %s", manager.name)
+		fi.findInstalledWindows()
+		return nil
+	}
+	if len(failures) == 0 {
+		return fmt.Errorf("winget, Scoop and Chocolatey not available - please install FFmpeg manually from https://ffmpeg.org/download.html")
+	}
+	return fmt.Errorf("installation failed with %s", strings.Join(failures, "; "))
+}
+
+// windowsFFmpegDirs are where winget, Scoop and Chocolatey put ffmpeg.exe or
+// a shim of it.
+func windowsFFmpegDirs() []string {
+	var dirs []string
+	if local := os.Getenv("LOCALAPPDATA"); local != "" {
+		dirs = append(dirs, filepath.Join(local, "Microsoft", "WinGet", "Links"))
+		packages, _ := filepath.Glob(filepath.Join(local, "Microsoft", "WinGet", "Packages", "Gyan.FFmpeg*", "*", "bin"))
+		dirs = append(dirs, packages...)
+	}
+	scoop := os.Getenv("SCOOP")
+	if home, err := os.UserHomeDir(); scoop == "" && err == nil {
+		scoop = filepath.Join(home, "scoop")
+	}
+	if scoop != "" {
+		dirs = append(dirs, filepath.Join(scoop, "shims"))
+	}
+	choco := os.Getenv("ChocolateyInstall")
+	if programData := os.Getenv("ProgramData"); choco == "" && programData != "" {
+		choco = filepath.Join(programData, "chocolatey")
+	}
+	if choco != "" {
+		dirs = append(dirs, filepath.Join(choco, "bin"))
+	}
+	return dirs
+}
+
+// findInstalledWindows adds the folder a package manager installed
+// ffmpeg.exe to to the PATH of the server: the PATH of a running process is
+// not refreshed, so ffmpeg would otherwise only be found after a restart.
+func (fi *FFmpegInstaller) findInstalledWindows() {
+	if _, err := exec.LookPath("ffmpeg"); err == nil {
+		return
+	}
+	for _, dir := range windowsFFmpegDirs() {
+		if _, err := os.Stat(filepath.Join(dir, "ffmpeg.exe")); err == nil {
+			os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+			LogInfo("[INSTALLER] Found FFmpeg in %s", dir)
+			return
+		}
+	}
+	LogInfo("[INSTALLER] FFmpeg is not on the PATH yet, you may need to restart the application")
 }
 
 func (fi *FFmpegInstaller) installMacOS() error {
@@ -72,8 +232,8 @@ func (fi *FFmpegInstaller) installMacOS() error {
 	}
 	
 	LogInfo("[INSTALLER] Homebrew found, installing FFmpeg...")
-	installCmd := exec.Command("brew", "install", "ffmpeg")
-	output, err := installCmd.CombinedOutput()
+	installCmd := fi.command("brew", "install", "ffmpeg")
+	output, err := fi.run(installCmd)
 	
 	if err != nil {
 		LogError("[INSTALLER] Homebrew installation failed: %v\nOutput: %s", err, string(output))
@@ -87,6 +247,13 @@ func (fi *FFmpegInstaller) installMacOS() error {
 func (fi *FFmpegInstaller) installLinux() error {
 	LogInfo("[INSTALLER] Attempting to install FFmpeg on Linux...")
 	
+	// The package manager of the host is out of reach from a sandbox, or
+	// cannot change a read-only system
+	if sandbox := linuxSandbox(); sandbox != "" {
+		LogInfo("[INSTALLER] Running in %s, downloading a static build of FFmpeg instead of using the package manager", sandbox)
+		return fi.installStatic()
+	}
+	
 	if fi.hasCommand("apt-get") {
 		return fi.installLinuxAPT()
 	} else if fi.hasCommand("yum") {
@@ -95,21 +262,26 @@ func (fi *FFmpegInstaller) installLinux() error {
 		return fi.installLinuxDNF()
 	} else if fi.hasCommand("pacman") {
 		return fi.installLinuxPacman()
+	} else if fi.hasCommand("zypper") {
+		return fi.installLinuxZypper()
+	} else if fi.hasCommand("apk") {
+		return fi.installLinuxAPK()
 	}
 	
-	return fmt.Errorf("no supported package manager found - please install FFmpeg manually")
+	LogInfo("[INSTALLER] No supported package manager found, downloading a static build of FFmpeg...")
+	return fi.installStatic()
 }
 
 func (fi *FFmpegInstaller) installLinuxAPT() error {
 	LogInfo("[INSTALLER] Using apt-get to install FFmpeg...")
 	
-	updateCmd := exec.Command("sudo", "apt-get", "update")
-	if err := updateCmd.Run(); err != nil {
+	updateCmd := fi.privileged("apt-get", "update")
+	if _, err := fi.run(updateCmd); err != nil {
 		LogInfo("[INSTALLER] apt-get update failed, continuing anyway...")
 	}
 	
-	installCmd := exec.Command("sudo", "apt-get", "install", "-y", "ffmpeg")
-	output, err := installCmd.CombinedOutput()
+	installCmd := fi.privileged("apt-get", "install", "-y", "ffmpeg")
+	output, err := fi.run(installCmd)
 	
 	if err != nil {
 		LogError("[INSTALLER] apt-get installation failed: %v\nOutput: %s", err, string(output))
@@ -123,17 +295,17 @@ func (fi *FFmpegInstaller) installLinuxAPT() error {
 func (fi *FFmpegInstaller) installLinuxYUM() error {
 	LogInfo("[INSTALLER] Using yum to install FFmpeg...")
 	
-	installCmd := exec.Command("sudo", "yum", "install", "-y", "ffmpeg")
-	output, err := installCmd.CombinedOutput()
+	installCmd := fi.privileged("yum", "install", "-y", "ffmpeg")
+	output, err := fi.run(installCmd)
 	
 	if err != nil {
 		if strings.Contains(string(output), "No package ffmpeg available") {
 			LogInfo("[INSTALLER] Attempting to enable EPEL repository...")
-			epelCmd := exec.Command("sudo", "yum", "install", "-y", "epel-release")
-			epelCmd.Run()
+			epelCmd := fi.privileged("yum", "install", "-y", "epel-release")
+			fi.run(epelCmd)
 			
-			installCmd = exec.Command("sudo", "yum", "install", "-y", "ffmpeg")
-			output, err = installCmd.CombinedOutput()
+			installCmd = fi.privileged("yum", "install", "-y", "ffmpeg")
+			output, err = fi.run(installCmd)
 		}
 		
 		if err != nil {
@@ -149,8 +321,8 @@ func (fi *FFmpegInstaller) installLinuxYUM() error {
 func (fi *FFmpegInstaller) installLinuxDNF() error {
 	LogInfo("[INSTALLER] Using dnf to install FFmpeg...")
 	
-	installCmd := exec.Command("sudo", "dnf", "install", "-y", "ffmpeg")
-	output, err := installCmd.CombinedOutput()
+	installCmd := fi.privileged("dnf", "install", "-y", "ffmpeg")
+	output, err := fi.run(installCmd)
 	
 	if err != nil {
 		LogError("[INSTALLER] dnf installation failed: %v\nOutput: %s", err, string(output))
@@ -164,8 +336,8 @@ func (fi *FFmpegInstaller) installLinuxDNF() error {
 func (fi *FFmpegInstaller) installLinuxPacman() error {
 	LogInfo("[INSTALLER] Using pacman to install FFmpeg...")
 	
-	installCmd := exec.Command("sudo", "pacman", "-S", "--noconfirm", "ffmpeg")
-	output, err := installCmd.CombinedOutput()
+	installCmd := fi.privileged("pacman", "-S", "--noconfirm", "ffmpeg")
+	output, err := fi.run(installCmd)
 	
 	if err != nil {
 		LogError("[INSTALLER] pacman installation failed: %v\nOutput: %s", err, string(output))
@@ -176,10 +348,120 @@ func (fi *FFmpegInstaller) installLinuxPacman() error {
 	return nil
 }
 
+func (fi *FFmpegInstaller) installLinuxZypper() error {
+	LogInfo("[INSTALLER] Using zypper to install FFmpeg...")
+	
+	installCmd := fi.privileged("zypper", "--non-interactive", "install", "ffmpeg")
+	output, err := fi.run(installCmd)
+	
+	if err != nil {
+		LogError("[INSTALLER] zypper installation failed: %v\nOutput: %s", err, string(output))
+		return fmt.Errorf("zypper installation failed: %w", err)
+	}
+	
+	LogInfo("[INSTALLER] FFmpeg installed successfully via zypper")
+	return nil
+}
+
+func (fi *FFmpegInstaller) installLinuxAPK() error {
+	LogInfo("[INSTALLER] Using apk to install FFmpeg...")
+	
+	installCmd := fi.privileged("apk", "add", "ffmpeg")
+	output, err := fi.run(installCmd)
+	
+	if err != nil {
+		LogError("[INSTALLER] apk installation failed: %v\nOutput: %s", err, string(output))
+		return fmt.Errorf("apk installation failed: %w", err)
+	}
+	
+	LogInfo("[INSTALLER] FFmpeg installed successfully via apk")
+	return nil
+}
+
+// command prepares a package manager command that downloads through the
+// FFmpeg proxy.
+func (fi *FFmpegInstaller) command(name string, args ...string) *exec.Cmd {
+	if fi.proxyEnv == nil {
+		return exec.Command(name, args...)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), fi.proxyEnv...)
+	return cmd
+}
+
+// run runs cmd and returns its combined output, passing each line of it to
+// fi.output as it comes, if set. Progress bars redraw their line with \r, so
+// that ends a line too.
+func (fi *FFmpegInstaller) run(cmd *exec.Cmd) ([]byte, error) {
+	if fi.output == nil {
+		return cmd.CombinedOutput()
+	}
+	reader, writer := io.Pipe()
+	var output bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&output, writer)
+	cmd.Stderr = cmd.Stdout
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(scanLinesOrReturns)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				fi.output(line)
+			}
+		}
+		io.Copy(io.Discard, reader)
+	}()
+	err := cmd.Run()
+	writer.Close()
+	<-scanned
+	return output.Bytes(), err
+}
+
+// scanLinesOrReturns is a bufio.SplitFunc for lines ended by \n or \r.
+func scanLinesOrReturns(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
 func (fi *FFmpegInstaller) hasCommand(command string) bool {
 	cmd := exec.Command("which", command)
 	if runtime.GOOS == "windows" {
 		cmd = exec.Command("where", command)
 	}
 	return cmd.Run() == nil
-}
\ No newline at end of file
+}
+
+// proxyURL returns the proxy the FFmpeg downloads go through, or "" for none.
+func (fi *FFmpegInstaller) proxyURL() string {
+	for _, name := range []string{"HTTPS_PROXY=", "HTTP_PROXY="} {
+		for _, env := range fi.proxyEnv {
+			if proxy, ok := strings.CutPrefix(env, name); ok && proxy != "" {
+				return proxy
+			}
+		}
+	}
+	return ""
+}
+
+// hasTerminal reports whether the server's input is a terminal sudo can ask
+// for a password on.
+func hasTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// rootArgs returns name and args as the arguments of sudo, pkexec or
+// osascript, which drop the environment, with the proxy passed on through env.
+func (fi *FFmpegInstaller) rootArgs(name string, args ...string) []string {
+	args = append([]string{name}, args...)
+	if fi.proxyEnv != nil {
+		args = append(append([]string{"env"}, fi.proxyEnv...), args...)
+	}
+	return args
+}
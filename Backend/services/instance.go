@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const instanceLockFile = "instance.lock"
+
+// ErrInstanceRunning is returned by AcquireInstanceLock when another instance
+// using the same config directory is running.
+var ErrInstanceRunning = errors.New("another instance is already running")
+
+// instanceInfo is the content of the lock file: how to reach the instance
+// that holds it.
+type instanceInfo struct {
+	PID  int    `json:"pid"`
+	Addr string `json:"addr"`
+	Key  string `json:"key"`
+}
+
+// InstanceLock makes sure a single instance runs per config directory. The
+// holder listens on a loopback port recorded in the lock file, so a second
+// instance can ask it to bring its window to the front instead of starting
+// another server. A lock whose holder no longer answers is stale and taken
+// over.
+type InstanceLock struct {
+	path     string
+	key      string
+	listener net.Listener
+	onFocus  func() bool
+	mu       sync.Mutex
+}
+
+// AcquireInstanceLock takes the lock in dir, or returns ErrInstanceRunning.
+func AcquireInstanceLock(dir string) (*InstanceLock, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	key, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for other instances: %w", err)
+	}
+	lock := &InstanceLock{path: filepath.Join(dir, instanceLockFile), key: key, listener: listener}
+	data, _ := json.Marshal(instanceInfo{PID: os.Getpid(), Addr: listener.Addr().String(), Key: key})
+
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(lock.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				listener.Close()
+				os.Remove(lock.path)
+				return nil, fmt.Errorf("failed to write instance lock: %w", err)
+			}
+			break
+		}
+		if !os.IsExist(err) || attempt > 0 {
+			listener.Close()
+			return nil, fmt.Errorf("failed to create instance lock: %w", err)
+		}
+		if _, err := sendInstanceCommand(dir, "ping"); err == nil {
+			listener.Close()
+			return nil, ErrInstanceRunning
+		}
+		LogInfo("[INSTANCE] Removing stale lock %s", lock.path)
+		os.Remove(lock.path)
+	}
+
+	go lock.serve()
+	return lock, nil
+}
+
+// OnFocus sets the function that brings the window to the front when another
+// instance starts. It reports whether there was a window to show.
+func (l *InstanceLock) OnFocus(fn func() bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onFocus = fn
+}
+
+// Release stops answering other instances and removes the lock file.
+func (l *InstanceLock) Release() {
+	if l == nil {
+		return
+	}
+	l.listener.Close()
+	os.Remove(l.path)
+}
+
+func (l *InstanceLock) serve() {
+	defer CapturePanic()
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		go l.handle(conn)
+	}
+}
+
+// handle answers one request of the form "<key> <command>\n".
+func (l *InstanceLock) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	key, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if key != l.key {
+		return
+	}
+
+	reply := "ok"
+	if command == "focus" {
+		l.mu.Lock()
+		onFocus := l.onFocus
+		l.mu.Unlock()
+		if onFocus == nil || !onFocus() {
+			reply = "headless"
+		}
+		LogInfo("[INSTANCE] Another instance was started; handing over to this one")
+	}
+	fmt.Fprintln(conn, reply)
+}
+
+// FocusRunningInstance asks the instance holding the lock in dir to bring its
+// window to the front, and reports whether it has a window.
+func FocusRunningInstance(dir string) (bool, error) {
+	reply, err := sendInstanceCommand(dir, "focus")
+	if err != nil {
+		return false, err
+	}
+	return reply == "ok", nil
+}
+
+func sendInstanceCommand(dir, command string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, instanceLockFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance lock: %w", err)
+	}
+	var info instanceInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("failed to parse instance lock: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", info.Addr, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("running instance does not answer: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "%s %s\n", info.Key, command)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("running instance did not reply: %w", err)
+	}
+	return strings.TrimSpace(reply), nil
+}
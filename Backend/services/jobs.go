@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Statuses of a Job.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobInstall is the kind of the jobs that install FFmpeg or ffprobe; one runs
+// at a time.
+const JobInstall = "install"
+
+const (
+	// maxJobs is how many finished jobs are kept.
+	maxJobs = 20
+	// maxJobLog is how many lines of output a job keeps, the latest ones.
+	maxJobLog = 200
+)
+
+// progressPattern finds the percentages in the progress bars of package
+// managers and downloads, e.g. "Progress: [ 45%]" or "██████ 45.2%".
+var progressPattern = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)\s?%`)
+
+// Job is a task that runs in the background, such as installing FFmpeg, so
+// that clients can follow it instead of waiting on a request.
+type Job struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+	// Progress is how far along the job is, from 0 to 100, or -1 when it
+	// cannot tell.
+	Progress float64 `json:"progress"`
+	// Message is the step the job is at, e.g. "Installing FFmpeg with
+	// winget".
+	Message string `json:"message,omitempty"`
+	// Log is the latest output of the job.
+	Log        []string   `json:"log,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobStore runs jobs and keeps the latest ones, and tells watchers about
+// each change of them.
+type JobStore struct {
+	jobs     map[string]*Job
+	watchers map[string]map[chan Job]struct{}
+	mu       sync.Mutex
+}
+
+// NewJobStore creates an empty JobStore.
+func NewJobStore() *JobStore {
+	return &JobStore{jobs: make(map[string]*Job), watchers: make(map[string]map[chan Job]struct{})}
+}
+
+// Start runs run in the background as a job of kind, and returns the job.
+// When a job of kind is already running, that one is returned instead and
+// started is false.
+func (js *JobStore) Start(kind, message string, run func(report *JobReport) error) (job Job, started bool) {
+	js.mu.Lock()
+	for _, j := range js.jobs {
+		if j.Kind == kind && j.Status == JobRunning {
+			defer js.mu.Unlock()
+			return js.copyLocked(j), false
+		}
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	j := &Job{ID: hex.EncodeToString(id), Kind: kind, Status: JobRunning, Progress: -1, Message: message, StartedAt: time.Now()}
+	js.jobs[j.ID] = j
+	js.pruneLocked()
+	job = js.copyLocked(j)
+	js.mu.Unlock()
+
+	go func() {
+		defer CapturePanic()
+		err := run(&JobReport{store: js, id: j.ID})
+		js.update(j.ID, func(j *Job) {
+			now := time.Now()
+			j.FinishedAt = &now
+			if err != nil {
+				j.Status, j.Error = JobFailed, err.Error()
+				return
+			}
+			j.Status, j.Progress = JobSucceeded, 100
+		})
+	}()
+	return job, true
+}
+
+// Get returns the job id.
+func (js *JobStore) Get(id string) (Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return js.copyLocked(j), true
+}
+
+// List returns the jobs kept, the most recently started first, without their
+// output.
+func (js *JobStore) List() []Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	list := make([]Job, 0, len(js.jobs))
+	for _, j := range js.jobs {
+		job := *j
+		job.Log = nil
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// Watch returns the job id and a channel that receives it again each time it
+// changes, and is closed once it has finished or stop is called. Changes that
+// come faster than they are received are dropped, except the last one.
+func (js *JobStore) Watch(id string) (job Job, changes <-chan Job, stop func(), ok bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+	ch := make(chan Job, 1)
+	if j.Status != JobRunning {
+		close(ch)
+		return js.copyLocked(j), ch, func() {}, true
+	}
+	if js.watchers[id] == nil {
+		js.watchers[id] = make(map[chan Job]struct{})
+	}
+	js.watchers[id][ch] = struct{}{}
+	stop = func() {
+		js.mu.Lock()
+		defer js.mu.Unlock()
+		if _, ok := js.watchers[id][ch]; ok {
+			delete(js.watchers[id], ch)
+			close(ch)
+		}
+	}
+	return js.copyLocked(j), ch, stop, true
+}
+
+// update changes the job id with change and tells its watchers.
+func (js *JobStore) update(id string, change func(*Job)) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	if !ok {
+		return
+	}
+	change(j)
+	job := js.copyLocked(j)
+	for ch := range js.watchers[id] {
+		// Only the latest state matters
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- job
+		if job.Status != JobRunning {
+			close(ch)
+		}
+	}
+	if job.Status != JobRunning {
+		delete(js.watchers, id)
+	}
+}
+
+func (js *JobStore) copyLocked(j *Job) Job {
+	job := *j
+	job.Log = append([]string(nil), j.Log...)
+	return job
+}
+
+// pruneLocked forgets the oldest finished jobs beyond maxJobs.
+func (js *JobStore) pruneLocked() {
+	var finished []*Job
+	for _, j := range js.jobs {
+		if j.Status != JobRunning {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	for _, j := range finished[:len(finished)-maxJobs] {
+		delete(js.jobs, j.ID)
+	}
+}
+
+// JobReport is how a running job reports its progress.
+type JobReport struct {
+	store *JobStore
+	id    string
+}
+
+// Step sets the step the job is at, with the progress unknown until output
+// tells it.
+func (r *JobReport) Step(message string) {
+	r.store.update(r.id, func(j *Job) {
+		j.Message, j.Progress = message, -1
+	})
+}
+
+// Progress sets how far along the job is, from 0 to 100.
+func (r *JobReport) Progress(percent float64) {
+	r.store.update(r.id, func(j *Job) {
+		j.Progress = min(max(percent, 0), 100)
+	})
+}
+
+// Output adds a line of output to the job, taking the progress from the
+// percentage in it, if any.
+func (r *JobReport) Output(line string) {
+	r.store.update(r.id, func(j *Job) {
+		j.Log = append(j.Log, line)
+		if len(j.Log) > maxJobLog {
+			j.Log = j.Log[len(j.Log)-maxJobLog:]
+		}
+		if m := progressPattern.FindAllStringSubmatch(line, -1); m != nil {
+			if percent, err := strconv.ParseFloat(m[len(m)-1][1], 64); err == nil && percent <= 100 {
+				j.Progress = percent
+			}
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLockoutAttempts = 5
+	lockoutBaseDelay       = 30 * time.Second
+	lockoutMaxDelay        = time.Hour
+	// lockoutForgetAfter is how long an IP must go without failures before
+	// its count starts over.
+	lockoutForgetAfter = 24 * time.Hour
+)
+
+type authFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// AuthGuard tracks failed authentication attempts per client IP. After
+// attempts free failures an IP is locked out for 30s, doubling with each
+// further failure up to an hour. Failures, lockouts and successful logins are
+// written to the audit log.
+type AuthGuard struct {
+	attempts int
+	failures map[string]*authFailures
+	audit    *AuditLog
+	mu       sync.Mutex
+}
+
+// NewAuthGuard creates a guard that allows AUTH_LOCKOUT_ATTEMPTS failures
+// (default 5) before locking an IP out. Setting it to 0 disables lockouts;
+// failures are still audited.
+func NewAuthGuard(audit *AuditLog) *AuthGuard {
+	return &AuthGuard{attempts: lockoutAttemptsFromEnv(), failures: make(map[string]*authFailures), audit: audit}
+}
+
+func lockoutAttemptsFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("AUTH_LOCKOUT_ATTEMPTS")); err == nil && v >= 0 {
+		return v
+	}
+	return defaultLockoutAttempts
+}
+
+// ReloadFromEnv re-reads AUTH_LOCKOUT_ATTEMPTS. Current lockouts stay in place.
+func (g *AuthGuard) ReloadFromEnv() {
+	if g == nil {
+		return
+	}
+	g.SetAttempts(lockoutAttemptsFromEnv())
+}
+
+// Attempts returns how many failures are allowed before a lockout.
+func (g *AuthGuard) Attempts() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.attempts
+}
+
+// SetAttempts changes how many failures are allowed before a lockout; 0
+// disables lockouts.
+func (g *AuthGuard) SetAttempts(attempts int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.attempts = attempts
+}
+
+// Locked returns how much longer ip is locked out, or 0.
+func (g *AuthGuard) Locked(ip string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.failures[ip]; ok {
+		if wait := time.Until(f.lockedUntil); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Fail records a failed attempt by ip against what (e.g. "login") and returns
+// the lockout it triggered, or 0.
+func (g *AuthGuard) Fail(ctx context.Context, ip, what string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	now := time.Now()
+	g.pruneLocked(now)
+	f, ok := g.failures[ip]
+	if !ok {
+		f = &authFailures{}
+		g.failures[ip] = f
+	}
+	f.count++
+	f.last = now
+
+	var lockout time.Duration
+	if g.attempts > 0 && f.count >= g.attempts {
+		lockout = lockoutDelay(f.count - g.attempts)
+		f.lockedUntil = now.Add(lockout)
+	}
+	count := f.count
+	g.mu.Unlock()
+
+	g.audit.Record(ctx, "auth_failure", ip, fmt.Sprintf("%s (attempt %d)", what, count))
+	if lockout > 0 {
+		LogErrorCtx(ctx, "[AUTH] Locked out %s for %s after %d failed attempts", ip, lockout, count)
+		g.audit.Record(ctx, "lockout", ip, fmt.Sprintf("%s for %s", what, lockout))
+	}
+	return lockout
+}
+
+// Succeed clears the failures recorded for ip and audits the success.
+func (g *AuthGuard) Succeed(ctx context.Context, ip, what string) {
+	if g == nil {
+		return
+	}
+	g.Reset(ip)
+	g.audit.Record(ctx, "auth_success", ip, what)
+}
+
+// Reset clears the failures recorded for ip without auditing, for routine
+// successes such as API requests.
+func (g *AuthGuard) Reset(ip string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, ip)
+}
+
+func (g *AuthGuard) pruneLocked(now time.Time) {
+	for ip, f := range g.failures {
+		if now.Sub(f.last) > lockoutForgetAfter && now.After(f.lockedUntil) {
+			delete(g.failures, ip)
+		}
+	}
+}
+
+// lockoutDelay returns the lockout for the n-th failure past the free attempts.
+func lockoutDelay(n int) time.Duration {
+	delay := lockoutBaseDelay
+	for i := 0; i < n && delay < lockoutMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, lockoutMaxDelay)
+}
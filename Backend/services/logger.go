@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,12 +18,18 @@ const (
 	ERROR
 )
 
+const recentLogLines = 200
+
 type Logger struct {
 	file       *os.File
+	console    bool
+	level      LogLevel
 	mu         sync.Mutex
 	logDir     string
 	maxSize    int64
 	currentSize int64
+	recent     []string
+	recentNext int
 }
 
 var globalLogger *Logger
@@ -39,7 +47,25 @@ func InitLogger(logDir string) error {
 	return err
 }
 
+// initialize opens the log file and/or logs to stdout, as LOG_OUTPUT says:
+// "file" (the default), "stdout" (the default in container mode) or "both".
 func (l *Logger) initialize() error {
+	output := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_OUTPUT")))
+	if output == "" && ContainerMode() {
+		output = "stdout"
+	}
+	switch output {
+	case "", "file":
+	case "stdout":
+		l.console = true
+		l.log(INFO, "Logger initialized successfully")
+		return nil
+	case "both":
+		l.console = true
+	default:
+		return fmt.Errorf("invalid LOG_OUTPUT %q (expected file, stdout or both)", output)
+	}
+
 	if err := os.MkdirAll(l.logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %v", err)
 	}
@@ -67,7 +93,7 @@ func (l *Logger) log(level LogLevel, message string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.file == nil {
+	if (l.file == nil && !l.console) || level < l.level {
 		return
 	}
 
@@ -83,6 +109,13 @@ func (l *Logger) log(level LogLevel, message string) {
 	}
 
 	logLine := fmt.Sprintf("[%s] [%s] %s\n", timestamp, levelStr, message)
+	l.remember(logLine)
+	if l.console {
+		os.Stdout.WriteString(logLine)
+	}
+	if l.file == nil {
+		return
+	}
 	
 	n, err := l.file.WriteString(logLine)
 	if err != nil {
@@ -97,6 +130,27 @@ func (l *Logger) log(level LogLevel, message string) {
 	}
 }
 
+// remember keeps logLine in a fixed-size ring of recent lines. Callers must hold l.mu.
+func (l *Logger) remember(logLine string) {
+	if len(l.recent) < recentLogLines {
+		l.recent = append(l.recent, logLine)
+		return
+	}
+	l.recent[l.recentNext] = logLine
+	l.recentNext = (l.recentNext + 1) % recentLogLines
+}
+
+// Recent returns the most recently logged lines, oldest first.
+func (l *Logger) Recent() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines := make([]string, 0, len(l.recent))
+	lines = append(lines, l.recent[l.recentNext:]...)
+	lines = append(lines, l.recent[:l.recentNext]...)
+	return lines
+}
+
 func (l *Logger) rotate() {
 	if l.file != nil {
 		l.file.Close()
@@ -128,6 +182,54 @@ func (l *Logger) Close() {
 	}
 }
 
+// ParseLogLevel parses "info" or "error"; anything else is DEBUG, which logs
+// everything.
+func ParseLogLevel(value string) LogLevel {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "info":
+		return INFO
+	case "error":
+		return ERROR
+	}
+	return DEBUG
+}
+
+func (level LogLevel) String() string {
+	switch level {
+	case INFO:
+		return "info"
+	case ERROR:
+		return "error"
+	}
+	return "debug"
+}
+
+// SetLogLevelFromEnv sets the lowest level written to the log file from
+// LOG_LEVEL (debug, info or error; default debug).
+func SetLogLevelFromEnv() {
+	SetLogLevel(ParseLogLevel(os.Getenv("LOG_LEVEL")))
+}
+
+// SetLogLevel sets the lowest level written to the log file.
+func SetLogLevel(level LogLevel) {
+	if globalLogger == nil {
+		return
+	}
+	globalLogger.mu.Lock()
+	defer globalLogger.mu.Unlock()
+	globalLogger.level = level
+}
+
+// GetLogLevel returns the lowest level written to the log file.
+func GetLogLevel() LogLevel {
+	if globalLogger == nil {
+		return DEBUG
+	}
+	globalLogger.mu.Lock()
+	defer globalLogger.mu.Unlock()
+	return globalLogger.level
+}
+
 func LogDebug(format string, args ...interface{}) {
 	if globalLogger != nil {
 		message := fmt.Sprintf(format, args...)
@@ -140,7 +242,9 @@ func LogInfo(format string, args ...interface{}) {
 		message := fmt.Sprintf(format, args...)
 		globalLogger.log(INFO, message)
 	}
-	fmt.Printf(format+"\n", args...)
+	if !loggingToConsole() {
+		fmt.Printf(format+"\n", args...)
+	}
 }
 
 func LogError(format string, args ...interface{}) {
@@ -148,11 +252,56 @@ func LogError(format string, args ...interface{}) {
 		message := fmt.Sprintf(format, args...)
 		globalLogger.log(ERROR, message)
 	}
-	fmt.Printf("[ERROR] "+format+"\n", args...)
+	if !loggingToConsole() {
+		fmt.Printf("[ERROR] "+format+"\n", args...)
+	}
+}
+
+// loggingToConsole reports whether the logger already writes to stdout, in
+// which case LogInfo and LogError do not print the message again.
+func loggingToConsole() bool {
+	return globalLogger != nil && globalLogger.console
+}
+
+// RecentLogLines returns the last lines written by the global logger.
+func RecentLogLines() []string {
+	if globalLogger == nil {
+		return nil
+	}
+	return globalLogger.Recent()
 }
 
 func CloseLogger() {
 	if globalLogger != nil {
 		globalLogger.Close()
 	}
-}
\ No newline at end of file
+}
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the HTTP request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// LogInfoCtx is LogInfo prefixed with the request ID from ctx, if any.
+func LogInfoCtx(ctx context.Context, format string, args ...interface{}) {
+	LogInfo(withRequestPrefix(ctx, format), args...)
+}
+
+// LogErrorCtx is LogError prefixed with the request ID from ctx, if any.
+func LogErrorCtx(ctx context.Context, format string, args ...interface{}) {
+	LogError(withRequestPrefix(ctx, format), args...)
+}
+
+func withRequestPrefix(ctx context.Context, format string) string {
+	if id := RequestID(ctx); id != "" {
+		return "[req " + id + "] " + format
+	}
+	return format
+}
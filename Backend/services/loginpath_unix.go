@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// loginPathTimeout bounds how long the login shell may take to start.
+const loginPathTimeout = 5 * time.Second
+
+// loginPath returns the PATH of a login shell of the user, which picks up
+// what installers added to the shell profile since the server started.
+func loginPath() []string {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), loginPathTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, shell, "-l", "-c", `printf %s "$PATH"`)
+	output, err := cmd.Output()
+	if err != nil {
+		LogDebug("[DEPENDENCIES] Failed to read the PATH of a login shell: %v", err)
+		return nil
+	}
+	return filepath.SplitList(string(output))
+}
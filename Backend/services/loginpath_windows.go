@@ -0,0 +1,56 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// pathKeys are where Windows keeps the PATH of the system and of the user,
+// which installers change without telling running programs.
+var pathKeys = []string{
+	`HKLM\SYSTEM\CurrentControlSet\Control\Session Manager\Environment`,
+	`HKCU\Environment`,
+}
+
+var (
+	// regPathValue is the line of reg query output with the PATH, e.g.
+	// "    Path    REG_EXPAND_SZ    %USERPROFILE%\bin;C:\Tools".
+	regPathValue = regexp.MustCompile(`(?im)^\s*Path\s+REG_(?:EXPAND_)?SZ\s+(.*?)\s*$`)
+	envReference = regexp.MustCompile(`%([^%]+)%`)
+)
+
+// loginPath returns the PATH a program started now would get, read from the
+// registry, with the variables in it expanded.
+func loginPath() []string {
+	var dirs []string
+	for _, key := range pathKeys {
+		cmd := exec.Command("reg", "query", key, "/v", "Path")
+		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+		output, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		match := regPathValue.FindStringSubmatch(string(output))
+		if match == nil {
+			continue
+		}
+		value := envReference.ReplaceAllStringFunc(match[1], func(reference string) string {
+			if value, ok := os.LookupEnv(strings.Trim(reference, "%")); ok {
+				return value
+			}
+			return reference
+		})
+		for _, dir := range strings.Split(value, ";") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MaxMarkerLabel is the longest label a marker may have, in characters.
+const MaxMarkerLabel = 200
+
+// Marker is a moment the user marked while recording, e.g. a highlight at
+// 14:32. Markers are saved in the sidecar of the recording and become chapters
+// of MP4 and Matroska recordings when they are post-processed.
+type Marker struct {
+	Label string    `json:"label"`
+	At    time.Time `json:"at"`
+	// OffsetSeconds is how far into the recording file the marker is.
+	OffsetSeconds float64 `json:"offsetSeconds"`
+}
+
+// RecordingSidecar is the metadata saved next to a recording file that has
+// markers or screenshots, is a part of a recording, has a known source, carries on another
+// recording or belongs to a group, at SidecarPath of the file.
+type RecordingSidecar struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"startedAt"`
+	// DurationSeconds is how long the file was being recorded.
+	DurationSeconds float64  `json:"durationSeconds"`
+	Markers         []Marker `json:"markers"`
+	// Screenshots are the images taken of the tab while recording the file,
+	// the first of which is its poster.
+	Screenshots []Screenshot `json:"screenshots,omitempty"`
+	// Source is what the recording was made of.
+	Source RecordingSource `json:"source,omitzero"`
+	// Recording is the first file of a recording continued in new files at
+	// the size limit, and Part the number of this one.
+	Recording string `json:"recording,omitempty"`
+	Part      int    `json:"part,omitempty"`
+	// ContinuesFrom is the file of the recording this one carries on after
+	// the extension recovered from a crash.
+	ContinuesFrom string `json:"continuesFrom,omitempty"`
+	// Group is the group the recording was made in, if any.
+	Group string `json:"group,omitempty"`
+}
+
+// SidecarPath returns where the sidecar of the recording file path is saved,
+// e.g. meeting.mp4.json for meeting.mp4.
+func SidecarPath(path string) string {
+	return path + ".json"
+}
+
+// LoadSidecar reads the sidecar of the recording file path. ok is false when
+// the recording has none.
+func LoadSidecar(path string) (sidecar RecordingSidecar, ok bool, err error) {
+	data, err := os.ReadFile(SidecarPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return RecordingSidecar{}, false, nil
+	}
+	if err != nil {
+		return RecordingSidecar{}, false, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return RecordingSidecar{}, false, fmt.Errorf("failed to parse sidecar: %w", err)
+	}
+	return sidecar, true, nil
+}
+
+func saveSidecar(path string, sidecar RecordingSidecar) error {
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(SidecarPath(path), data, 0644); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
+
+// RemoveRecording deletes the recording file path and its sidecar.
+func RemoveRecording(path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := os.Remove(SidecarPath(path)); err != nil && !os.IsNotExist(err) {
+		LogError("[FILEWRITER] Failed to delete sidecar of %s: %v", path, err)
+	}
+	return nil
+}
+
+// newMarker returns the marker labelled label at at, in a file whose media
+// starts at the recording timestamp (Unix milliseconds). An empty label
+// becomes "Marker n".
+func newMarker(label string, at time.Time, timestamp int64, n int) Marker {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		label = fmt.Sprintf("Marker %d", n)
+	}
+	offset := at.Sub(time.UnixMilli(timestamp))
+	if offset < 0 {
+		offset = 0
+	}
+	return Marker{Label: label, At: at, OffsetSeconds: offset.Seconds()}
+}
+
+// ffmetadataChapters returns an FFmpeg metadata file with a chapter for each
+// marker of sidecar, ending at the next marker or at the end of the recording.
+func ffmetadataChapters(sidecar RecordingSidecar) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	end := int64(sidecar.DurationSeconds * 1000)
+	for i, marker := range sidecar.Markers {
+		start := int64(marker.OffsetSeconds * 1000)
+		stop := end
+		if i+1 < len(sidecar.Markers) {
+			stop = int64(sidecar.Markers[i+1].OffsetSeconds * 1000)
+		}
+		if stop < start {
+			stop = start
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", start, stop, escapeFFmetadata(marker.Label))
+	}
+	return b.String()
+}
+
+// escapeFFmetadata escapes the characters FFmpeg metadata files treat
+// specially.
+func escapeFFmetadata(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n").Replace(value)
+}
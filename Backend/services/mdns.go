@@ -0,0 +1,480 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// MDNSServiceType is the DNS-SD service type the recorder is advertised as.
+	MDNSServiceType = "_tabrecorder._tcp"
+
+	mdnsAddr         = "224.0.0.251:5353"
+	mdnsPort         = 5353
+	mdnsHostTTL      = 120  // A and SRV records, per RFC 6762
+	mdnsServiceTTL   = 4500 // PTR and TXT records
+	mdnsAnnouncement = time.Second
+	// mdnsServicesName lists the service types on the network (RFC 6763 section 9).
+	mdnsServicesName = "_services._dns-sd._udp.local."
+
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN    = 1
+	dnsCacheFlush = 0x8000
+	dnsUnicast    = 0x8000
+)
+
+// MDNSEnabled reports whether the server should be advertised on the LAN.
+// It is on unless MDNS_ENABLED is set to something false, or in container
+// mode, where multicast rarely reaches the LAN.
+func MDNSEnabled() bool {
+	value := strings.TrimSpace(os.Getenv("MDNS_ENABLED"))
+	if value == "" {
+		return !ContainerMode()
+	}
+	return isTruthy(value)
+}
+
+// MDNSAdvertiser answers multicast DNS queries for the recorder, so the
+// extension or a player on another device can find the server's address and
+// port without the user typing it. The TXT record carries hints (version,
+// TLS, where to pair) but never a token.
+//
+// It is a minimal responder: it does not probe for name conflicts, so two
+// recorders on hosts with the same name will shadow each other.
+type MDNSAdvertiser struct {
+	conn     *net.UDPConn
+	group    *net.UDPAddr
+	service  string // _tabrecorder._tcp.local.
+	instance string // Tab Recorder on host._tabrecorder._tcp.local.
+	host     string // host.local.
+	port     int
+	ips      []net.IP
+	txt      []string
+	stopChan chan struct{}
+}
+
+// NewMDNSAdvertiser prepares an advertisement for a server listening on bind
+// and port. It returns an error when bind is not reachable from the LAN.
+func NewMDNSAdvertiser(bind string, port int, tlsEnabled bool) (*MDNSAdvertiser, error) {
+	ips := lanAddresses(bind)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("server is not reachable from the network")
+	}
+	group, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	hostname, _, _ = strings.Cut(hostname, ".")
+	label := dnsLabel(hostname)
+	if label == "" {
+		label = "tab-recorder"
+		hostname = label
+	}
+
+	tlsHint := "0"
+	if tlsEnabled {
+		tlsHint = "1"
+	}
+	service := MDNSServiceType + ".local."
+	return &MDNSAdvertiser{
+		group:    group,
+		service:  service,
+		instance: instanceLabel("Tab Recorder on "+hostname) + "." + service,
+		host:     label + ".local.",
+		port:     port,
+		ips:      ips,
+		txt: []string{
+			"version=" + Version,
+			"tls=" + tlsHint,
+			"auth=token",
+			"discovery=/api/discovery",
+			"pairing=/api/pairing/redeem",
+		},
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+func (m *MDNSAdvertiser) Start() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, m.group)
+	if err != nil {
+		return fmt.Errorf("failed to join mDNS group: %w", err)
+	}
+	m.conn = conn
+	LogInfo("[MDNS] Advertising %s on port %d", strings.TrimSuffix(m.instance, "."), m.port)
+
+	go func() {
+		defer CapturePanic()
+		// RFC 6762 asks for at least two announcements, a second apart.
+		for i := 0; i < 2; i++ {
+			m.send(m.response(0, nil, mdnsHostTTL, mdnsServiceTTL), m.group)
+			select {
+			case <-time.After(mdnsAnnouncement):
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+	go m.serve()
+	return nil
+}
+
+// Stop sends a goodbye so that clients drop the service, then stops answering.
+func (m *MDNSAdvertiser) Stop() {
+	if m == nil || m.conn == nil {
+		return
+	}
+	close(m.stopChan)
+	m.send(m.response(0, nil, 0, 0), m.group)
+	m.conn.Close()
+}
+
+func (m *MDNSAdvertiser) serve() {
+	defer CapturePanic()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			LogError("[MDNS] Read failed: %v", err)
+			continue
+		}
+		id, questions, err := parseDNSQuery(buf[:n])
+		if err != nil || !m.matches(questions) {
+			continue
+		}
+
+		// Queries from a port other than 5353 come from simple resolvers that
+		// expect a conventional unicast reply echoing the question (RFC 6762
+		// section 6.7). Otherwise reply to the group, or directly when asked.
+		switch {
+		case from.Port != mdnsPort:
+			m.send(m.response(id, questions, 10, 10), from)
+		case unicastRequested(questions):
+			m.send(m.response(0, nil, mdnsHostTTL, mdnsServiceTTL), from)
+		default:
+			m.send(m.response(0, nil, mdnsHostTTL, mdnsServiceTTL), m.group)
+		}
+	}
+}
+
+func (m *MDNSAdvertiser) send(packet []byte, to *net.UDPAddr) {
+	if _, err := m.conn.WriteToUDP(packet, to); err != nil && !errors.Is(err, net.ErrClosed) {
+		LogError("[MDNS] Send failed: %v", err)
+	}
+}
+
+// matches reports whether any question is about the recorder's records.
+func (m *MDNSAdvertiser) matches(questions []dnsQuestion) bool {
+	for _, q := range questions {
+		name := strings.ToLower(q.name)
+		switch {
+		case name == mdnsServicesName && (q.qtype == dnsTypePTR || q.qtype == dnsTypeANY):
+			return true
+		case name == strings.ToLower(m.service) && (q.qtype == dnsTypePTR || q.qtype == dnsTypeANY):
+			return true
+		case name == strings.ToLower(m.instance) && (q.qtype == dnsTypeSRV || q.qtype == dnsTypeTXT || q.qtype == dnsTypeANY):
+			return true
+		case name == strings.ToLower(m.host) && (q.qtype == dnsTypeA || q.qtype == dnsTypeANY):
+			return true
+		}
+	}
+	return false
+}
+
+// response builds a reply carrying all of the recorder's records. A zero TTL
+// turns it into a goodbye. id and questions are echoed for unicast replies to
+// conventional resolvers.
+func (m *MDNSAdvertiser) response(id uint16, questions []dnsQuestion, hostTTL, serviceTTL uint32) []byte {
+	var b dnsBuilder
+	b.uint16(id)
+	b.uint16(0x8400) // response, authoritative
+	b.uint16(uint16(len(questions)))
+	b.uint16(uint16(4 + len(m.ips)))
+	b.uint16(0)
+	b.uint16(0)
+	for _, q := range questions {
+		b.name(q.name)
+		b.uint16(q.qtype)
+		b.uint16(dnsClassIN)
+	}
+
+	b.record(mdnsServicesName, dnsTypePTR, dnsClassIN, serviceTTL, func() { b.name(m.service) })
+	b.record(m.service, dnsTypePTR, dnsClassIN, serviceTTL, func() { b.name(m.instance) })
+	b.record(m.instance, dnsTypeSRV, dnsClassIN|dnsCacheFlush, hostTTL, func() {
+		b.uint16(0) // priority
+		b.uint16(0) // weight
+		b.uint16(uint16(m.port))
+		b.name(m.host)
+	})
+	b.record(m.instance, dnsTypeTXT, dnsClassIN|dnsCacheFlush, serviceTTL, func() {
+		for _, s := range m.txt {
+			b.buf = append(b.buf, byte(len(s)))
+			b.buf = append(b.buf, s...)
+		}
+	})
+	for _, ip := range m.ips {
+		b.record(m.host, dnsTypeA, dnsClassIN|dnsCacheFlush, hostTTL, func() { b.buf = append(b.buf, ip.To4()...) })
+	}
+	return b.buf
+}
+
+type dnsQuestion struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+func unicastRequested(questions []dnsQuestion) bool {
+	for _, q := range questions {
+		if q.qclass&dnsUnicast == 0 {
+			return false
+		}
+	}
+	return len(questions) > 0
+}
+
+// parseDNSQuery returns the ID and questions of a DNS query. Responses and
+// malformed packets are rejected.
+func parseDNSQuery(packet []byte) (uint16, []dnsQuestion, error) {
+	if len(packet) < 12 {
+		return 0, nil, fmt.Errorf("packet too short")
+	}
+	id := binary.BigEndian.Uint16(packet)
+	if binary.BigEndian.Uint16(packet[2:])&0x8000 != 0 {
+		return 0, nil, fmt.Errorf("not a query")
+	}
+	count := int(binary.BigEndian.Uint16(packet[4:]))
+
+	questions := make([]dnsQuestion, 0, count)
+	offset := 12
+	for i := 0; i < count; i++ {
+		name, next, err := readDNSName(packet, offset)
+		if err != nil {
+			return 0, nil, err
+		}
+		if next+4 > len(packet) {
+			return 0, nil, fmt.Errorf("truncated question")
+		}
+		questions = append(questions, dnsQuestion{
+			name:   name,
+			qtype:  binary.BigEndian.Uint16(packet[next:]),
+			qclass: binary.BigEndian.Uint16(packet[next+2:]),
+		})
+		offset = next + 4
+	}
+	return id, questions, nil
+}
+
+// dnsRecord is a resource record of a DNS response, with the data of the
+// record types mDNS browsing reads decoded.
+type dnsRecord struct {
+	name  string
+	rtype uint16
+	// target is the name a PTR or SRV record points at.
+	target string
+	port   int      // SRV
+	txt    []string // TXT
+	ip     net.IP   // A
+}
+
+// parseDNSResponse returns the answers and additional records of a DNS
+// response. Queries and malformed packets are rejected.
+func parseDNSResponse(packet []byte) ([]dnsRecord, error) {
+	if len(packet) < 12 {
+		return nil, fmt.Errorf("packet too short")
+	}
+	if binary.BigEndian.Uint16(packet[2:])&0x8000 == 0 {
+		return nil, fmt.Errorf("not a response")
+	}
+	questions := int(binary.BigEndian.Uint16(packet[4:]))
+	count := 0
+	for _, at := range []int{6, 8, 10} {
+		count += int(binary.BigEndian.Uint16(packet[at:]))
+	}
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(packet, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+	var records []dnsRecord
+	for i := 0; i < count; i++ {
+		name, next, err := readDNSName(packet, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(packet) {
+			return nil, fmt.Errorf("truncated record")
+		}
+		record := dnsRecord{name: name, rtype: binary.BigEndian.Uint16(packet[next:])}
+		start := next + 10
+		end := start + int(binary.BigEndian.Uint16(packet[next+8:]))
+		if end > len(packet) {
+			return nil, fmt.Errorf("truncated record")
+		}
+		data := packet[start:end]
+		switch record.rtype {
+		case dnsTypePTR:
+			record.target, _, err = readDNSName(packet, start)
+		case dnsTypeSRV:
+			if len(data) < 7 {
+				return nil, fmt.Errorf("truncated SRV record")
+			}
+			record.port = int(binary.BigEndian.Uint16(data[4:]))
+			record.target, _, err = readDNSName(packet, start+6)
+		case dnsTypeTXT:
+			for len(data) > 0 && int(data[0]) < len(data) {
+				record.txt = append(record.txt, string(data[1:1+data[0]]))
+				data = data[1+data[0]:]
+			}
+		case dnsTypeA:
+			if len(data) == 4 {
+				record.ip = net.IP(append([]byte(nil), data...))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+		offset = end
+	}
+	return records, nil
+}
+
+// readDNSName decodes the possibly compressed name at offset and returns it
+// with a trailing dot, along with the offset just past it.
+func readDNSName(packet []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(packet) {
+			return "", 0, fmt.Errorf("truncated name")
+		}
+		length := int(packet[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(packet) || jumps > 10 {
+				return "", 0, fmt.Errorf("invalid name pointer")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(packet[offset:]) & 0x3FFF)
+			jumps++
+		case length&0xC0 != 0:
+			return "", 0, fmt.Errorf("invalid label")
+		default:
+			if offset+1+length > len(packet) {
+				return "", 0, fmt.Errorf("truncated label")
+			}
+			labels = append(labels, string(packet[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+type dnsBuilder struct {
+	buf []byte
+}
+
+func (b *dnsBuilder) uint16(v uint16) {
+	b.buf = binary.BigEndian.AppendUint16(b.buf, v)
+}
+
+// name writes an uncompressed name.
+func (b *dnsBuilder) name(name string) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b.buf = append(b.buf, byte(len(label)))
+		b.buf = append(b.buf, label...)
+	}
+	b.buf = append(b.buf, 0)
+}
+
+// record writes a resource record whose data is written by rdata.
+func (b *dnsBuilder) record(name string, rtype, class uint16, ttl uint32, rdata func()) {
+	b.name(name)
+	b.uint16(rtype)
+	b.uint16(class)
+	b.buf = binary.BigEndian.AppendUint32(b.buf, ttl)
+	lengthAt := len(b.buf)
+	b.uint16(0)
+	rdata()
+	binary.BigEndian.PutUint16(b.buf[lengthAt:], uint16(len(b.buf)-lengthAt-2))
+}
+
+// lanAddresses returns the IPv4 addresses other devices can reach a server
+// bound to bind on: bind itself, or every LAN address when bound to all
+// interfaces.
+func lanAddresses(bind string) []net.IP {
+	ip := net.ParseIP(bind)
+	if ip == nil || ip.IsLoopback() {
+		return nil
+	}
+	if !ip.IsUnspecified() {
+		if ip.To4() == nil {
+			return nil
+		}
+		return []net.IP{ip.To4()}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	return ips
+}
+
+// instanceLabel makes a readable service instance name fit in one label.
+func instanceLabel(name string) string {
+	name = strings.ReplaceAll(name, ".", "-")
+	for len(name) > 63 {
+		name = name[:len(name)-1]
+	}
+	return strings.ToValidUTF8(name, "")
+}
+
+// dnsLabel turns a host name into a valid DNS label.
+func dnsLabel(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		case r == '_' || r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	label := strings.Trim(b.String(), "-")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// Desktop notification events, each of which can be turned off.
+const (
+	NotifyRecordingStarted = "recording_started"
+	NotifyRecordingStopped = "recording_stopped"
+	NotifyPostProcessing   = "post_processing"
+	NotifyLowDisk          = "low_disk"
+	NotifyWriteFailures    = "write_failures"
+)
+
+// notificationEventEnv names the variable that turns each event on or off
+// (config keys notifications.<event>).
+var notificationEventEnv = map[string]string{
+	NotifyRecordingStarted: "NOTIFY_RECORDING_STARTED",
+	NotifyRecordingStopped: "NOTIFY_RECORDING_STOPPED",
+	NotifyPostProcessing:   "NOTIFY_POST_PROCESSING",
+	NotifyLowDisk:          "NOTIFY_LOW_DISK",
+	NotifyWriteFailures:    "NOTIFY_WRITE_FAILURES",
+}
+
+// NotificationEvents says which events show a desktop notification.
+type NotificationEvents struct {
+	RecordingStarted bool `json:"recordingStarted"`
+	RecordingStopped bool `json:"recordingStopped"`
+	PostProcessing   bool `json:"postProcessing"`
+	LowDisk          bool `json:"lowDisk"`
+	WriteFailures    bool `json:"writeFailures"`
+}
+
+// LoadNotificationEventsFromEnv returns the events turned on by
+// NOTIFY_RECORDING_STARTED, NOTIFY_RECORDING_STOPPED, NOTIFY_POST_PROCESSING,
+// NOTIFY_LOW_DISK and NOTIFY_WRITE_FAILURES. Every event is on by default.
+func LoadNotificationEventsFromEnv() NotificationEvents {
+	on := func(event string) bool {
+		value := strings.TrimSpace(os.Getenv(notificationEventEnv[event]))
+		return value == "" || isTruthy(value)
+	}
+	return NotificationEvents{
+		RecordingStarted: on(NotifyRecordingStarted),
+		RecordingStopped: on(NotifyRecordingStopped),
+		PostProcessing:   on(NotifyPostProcessing),
+		LowDisk:          on(NotifyLowDisk),
+		WriteFailures:    on(NotifyWriteFailures),
+	}
+}
+
+// Enabled reports whether event is turned on.
+func (e NotificationEvents) Enabled(event string) bool {
+	switch event {
+	case NotifyRecordingStarted:
+		return e.RecordingStarted
+	case NotifyRecordingStopped:
+		return e.RecordingStopped
+	case NotifyPostProcessing:
+		return e.PostProcessing
+	case NotifyLowDisk:
+		return e.LowDisk
+	case NotifyWriteFailures:
+		return e.WriteFailures
+	}
+	return false
+}
+
+// DesktopNotifier shows recording events and alerts as notifications of the
+// operating system. A nil *DesktopNotifier shows nothing, for headless and
+// container use.
+type DesktopNotifier struct {
+	events NotificationEvents
+	mu     sync.Mutex
+}
+
+// NewDesktopNotifier returns a notifier for the given events, or nil when
+// this system cannot show notifications.
+func NewDesktopNotifier(events NotificationEvents) *DesktopNotifier {
+	if !notificationsSupported() {
+		LogInfo("[NOTIFY] Desktop notifications are not available on this system")
+		return nil
+	}
+	return &DesktopNotifier{events: events}
+}
+
+// Events returns the events that show a notification.
+func (dn *DesktopNotifier) Events() NotificationEvents {
+	if dn == nil {
+		return NotificationEvents{}
+	}
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+	return dn.events
+}
+
+// SetEvents changes which events show a notification.
+func (dn *DesktopNotifier) SetEvents(events NotificationEvents) {
+	if dn == nil {
+		return
+	}
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+	dn.events = events
+}
+
+// Send shows a notification for event, if it is turned on. It does not wait
+// for the notification to be shown.
+func (dn *DesktopNotifier) Send(event, title, message string) {
+	if dn == nil || !dn.Events().Enabled(event) {
+		return
+	}
+	go func() {
+		defer CapturePanic()
+		if err := showNotification(title, message); err != nil {
+			LogError("[NOTIFY] Failed to show notification %q: %v", title, err)
+		}
+	}()
+}
+
+// Notify implements Notifier for the low disk and write failure alerts.
+// Resolved alerts are not shown.
+func (dn *DesktopNotifier) Notify(alert Alert, resolved bool) {
+	if resolved {
+		return
+	}
+	switch alert.Rule {
+	case AlertRuleLowDisk:
+		dn.Send(NotifyLowDisk, "Low disk space", alert.Message)
+	case AlertRuleWriteFailures:
+		dn.Send(NotifyWriteFailures, "Recordings are failing to save", alert.Message)
+	}
+}
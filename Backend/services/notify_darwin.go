@@ -0,0 +1,29 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// notifyScript shows the notification passed as arguments, so that the text
+// is never interpreted as AppleScript.
+const notifyScript = `on run argv
+	display notification (item 2 of argv) with title (item 1 of argv)
+end run`
+
+func notificationsSupported() bool {
+	_, err := exec.LookPath("osascript")
+	return err == nil
+}
+
+func showNotification(title, message string) error {
+	cmd := exec.Command("osascript", "-e", notifyScript, title, message)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("osascript: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
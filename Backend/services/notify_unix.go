@@ -0,0 +1,35 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// notificationsSupported reports whether notify-send (libnotify) is installed
+// and there is a desktop session to show notifications in.
+func notificationsSupported() bool {
+	if !hasDesktopSession() {
+		return false
+	}
+	_, err := exec.LookPath("notify-send")
+	return err == nil
+}
+
+// hasDesktopSession reports whether the server runs inside a graphical
+// session, where windows and notifications can be shown.
+func hasDesktopSession() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+func showNotification(title, message string) error {
+	cmd := exec.Command("notify-send", "--app-name=Recording Server", title, message)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify-send: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
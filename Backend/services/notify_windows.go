@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// notifyScript shows a toast through the Windows Runtime. Notifications must
+// come from a registered app, so it borrows PowerShell's app ID. The text is
+// passed in the environment so that it is never interpreted as script.
+const notifyScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:RECORDER_NOTIFY_TITLE)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode($env:RECORDER_NOTIFY_MESSAGE)) | Out-Null
+$appID = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($appID).Show([Windows.UI.Notifications.ToastNotification]::new($template))
+`
+
+func notificationsSupported() bool {
+	_, err := exec.LookPath("powershell.exe")
+	return err == nil
+}
+
+func showNotification(title, message string) error {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", notifyScript)
+	cmd.Env = append(os.Environ(), "RECORDER_NOTIFY_TITLE="+title, "RECORDER_NOTIFY_MESSAGE="+message)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("powershell: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// bundledFFmpeg holds the ffmpegbundle folder, with the FFmpeg archive
+// embedded in offline builds (go build -tags offline); it is nil in other
+// builds.
+var bundledFFmpeg fs.FS
+
+// offlineFFmpeg reports whether FFmpeg is installed from an archive on the
+// machine: the one FFMPEG_ARCHIVE names, or the one embedded in an offline
+// build, for machines where neither package managers nor downloads work.
+func offlineFFmpeg() bool {
+	return os.Getenv("FFMPEG_ARCHIVE") != "" || bundledFFmpeg != nil
+}
+
+// installOffline installs FFmpeg and ffprobe into ManagedFFmpegDir from the
+// archive FFMPEG_ARCHIVE names, or else from the one embedded in the build.
+func (fi *FFmpegInstaller) installOffline() error {
+	if archive := os.Getenv("FFMPEG_ARCHIVE"); archive != "" {
+		LogInfo("[INSTALLER] Installing FFmpeg from %s...", archive)
+		return fi.installArchive(archive)
+	}
+
+	entries, err := fs.ReadDir(bundledFFmpeg, "ffmpegbundle")
+	if err != nil {
+		return fmt.Errorf("failed to read the bundled FFmpeg: %w", err)
+	}
+	for _, entry := range entries {
+		format := archiveFormat(entry.Name())
+		if entry.IsDir() || format == "" {
+			continue
+		}
+		dir, err := ManagedFFmpegDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		data, err := fs.ReadFile(bundledFFmpeg, path.Join("ffmpegbundle", entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read the bundled FFmpeg: %w", err)
+		}
+		archive := filepath.Join(dir, "bundled"+format)
+		if err := os.WriteFile(archive, data, 0644); err != nil {
+			return fmt.Errorf("failed to unpack the bundled FFmpeg: %w", err)
+		}
+		defer os.Remove(archive)
+		LogInfo("[INSTALLER] Installing the FFmpeg bundled with the server (%s)...", entry.Name())
+		return fi.installArchive(archive)
+	}
+	return fmt.Errorf("this offline build has no FFmpeg archive - rebuild it with one in services/ffmpegbundle")
+}
+
+// installArchive installs the ffmpeg and ffprobe binaries in archive, a .zip,
+// .tar, .tar.gz or .tar.xz file, into ManagedFFmpegDir and puts them on the
+// PATH. Archives of FFmpeg alone, without ffprobe, are accepted.
+func (fi *FFmpegInstaller) installArchive(archive string) error {
+	dir, err := ManagedFFmpegDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	extract, err := os.MkdirTemp(dir, "extract-")
+	if err != nil {
+		return fmt.Errorf("failed to extract FFmpeg: %w", err)
+	}
+	defer os.RemoveAll(extract)
+
+	switch format := archiveFormat(archive); format {
+	case ".zip":
+		err = extractZipBinaries(archive, extract)
+	case ".tar", ".tar.gz":
+		err = extractTarBinaries(archive, extract, format == ".tar.gz")
+	case ".tar.xz":
+		// The standard library has no xz, tar has
+		if output, tarErr := exec.Command("tar", "-xJf", archive, "-C", extract).CombinedOutput(); tarErr != nil {
+			err = fmt.Errorf("%v: %s", tarErr, strings.TrimSpace(string(output)))
+		}
+	default:
+		return fmt.Errorf("%s is not a .zip, .tar, .tar.gz or .tar.xz archive", archive)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract FFmpeg: %w", err)
+	}
+
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		found := findFile(extract, executableName(name))
+		if found == "" {
+			if name == DependencyFFprobe {
+				LogInfo("[INSTALLER] The FFmpeg archive has no ffprobe")
+				continue
+			}
+			return fmt.Errorf("the FFmpeg archive has no %s", executableName(name))
+		}
+		if err := os.Chmod(found, 0755); err != nil {
+			return fmt.Errorf("failed to install %s: %w", name, err)
+		}
+		if err := os.Rename(found, filepath.Join(dir, executableName(name))); err != nil {
+			return fmt.Errorf("failed to install %s: %w", name, err)
+		}
+	}
+
+	LogInfo("[INSTALLER] FFmpeg installed successfully to %s", dir)
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		os.Setenv("PATH", os.Getenv("PATH")+string(os.PathListSeparator)+dir)
+	}
+	return nil
+}
+
+// archiveFormat returns the extension of the archive name, e.g. ".tar.xz",
+// or "" when it is not an archive installArchive reads.
+func archiveFormat(name string) string {
+	name = strings.ToLower(name)
+	for _, format := range []string{".tar.xz", ".tar.gz", ".tar", ".zip"} {
+		if strings.HasSuffix(name, format) {
+			return format
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, ".txz"):
+		return ".tar.xz"
+	case strings.HasSuffix(name, ".tgz"):
+		return ".tar.gz"
+	}
+	return ""
+}
+
+// executableName returns the file name of the program name on this system,
+// e.g. ffmpeg.exe on Windows.
+func executableName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// isFFmpegBinary reports whether the archive entry name is ffmpeg or ffprobe.
+func isFFmpegBinary(name string) bool {
+	base := path.Base(name)
+	return base == executableName("ffmpeg") || base == executableName("ffprobe")
+}
+
+// extractZipBinaries writes the ffmpeg and ffprobe binaries in the zip file
+// archive to dir, by their base name, so that no entry lands outside of it.
+func extractZipBinaries(archive, dir string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() || !isFFmpegBinary(file.Name) {
+			continue
+		}
+		src, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeBinary(filepath.Join(dir, path.Base(file.Name)), src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTarBinaries is extractZipBinaries for tar files, gzipped or not.
+func extractTarBinaries(archive, dir string, gzipped bool) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var src io.Reader = file
+	if gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		src = gz
+	}
+	reader := tar.NewReader(src)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && isFFmpegBinary(header.Name) {
+			if err := writeBinary(filepath.Join(dir, path.Base(header.Name)), reader); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeBinary(path string, src io.Reader) error {
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// findFile returns the first file called name under dir, or "".
+func findFile(dir, name string) string {
+	var found string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && entry.Name() == name {
+			found = path
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
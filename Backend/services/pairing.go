@@ -0,0 +1,106 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPairingTTL = 5 * time.Minute
+	MaxPairingTTL     = time.Hour
+
+	// pairingAlphabet omits characters that are easy to confuse when typed.
+	pairingAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// PairingCode is a one-time code that a device exchanges for a scoped token.
+type PairingCode struct {
+	Code    string       `json:"code"`
+	Scopes  []TokenScope `json:"scopes"`
+	Expires time.Time    `json:"expires"`
+}
+
+// PairingService hands out one-time pairing codes and redeems them for scoped
+// API tokens issued through a TokenStore.
+type PairingService struct {
+	tokens *TokenStore
+	codes  map[string]PairingCode
+	mu     sync.Mutex
+}
+
+func NewPairingService(tokens *TokenStore) *PairingService {
+	return &PairingService{tokens: tokens, codes: make(map[string]PairingCode)}
+}
+
+// Start creates a pairing code valid for ttl that grants scopes when redeemed.
+func (ps *PairingService) Start(scopes []TokenScope, ttl time.Duration) (PairingCode, error) {
+	code, err := newPairingCode()
+	if err != nil {
+		return PairingCode{}, err
+	}
+	pairing := PairingCode{Code: code, Scopes: scopes, Expires: time.Now().Add(ttl)}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.pruneLocked()
+	ps.codes[code] = pairing
+	LogInfo("[PAIRING] Started pairing with scopes %v, expires %s", scopes, pairing.Expires.Format(time.RFC3339))
+	return pairing, nil
+}
+
+// Redeem exchanges a pairing code for a new token named after device.
+// Each code works once.
+func (ps *PairingService) Redeem(code, device string) (string, APIToken, error) {
+	code = normalizePairingCode(code)
+
+	ps.mu.Lock()
+	pairing, ok := ps.codes[code]
+	delete(ps.codes, code)
+	ps.mu.Unlock()
+
+	if !ok || time.Now().After(pairing.Expires) {
+		return "", APIToken{}, fmt.Errorf("invalid or expired pairing code")
+	}
+	if device == "" {
+		device = "paired device"
+	}
+	return ps.tokens.Issue(device, pairing.Scopes)
+}
+
+func (ps *PairingService) pruneLocked() {
+	now := time.Now()
+	for code, pairing := range ps.codes {
+		if now.After(pairing.Expires) {
+			delete(ps.codes, code)
+		}
+	}
+}
+
+// newPairingCode returns a random code formatted as XXXX-XXXX.
+func newPairingCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(pairingAlphabet)))
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate pairing code: %w", err)
+		}
+		b.WriteByte(pairingAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+func normalizePairingCode(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) == 8 {
+		return code[:4] + "-" + code[4:]
+	}
+	return code
+}
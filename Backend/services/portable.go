@@ -0,0 +1,32 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// portableMarker is the file that, placed next to the executable, turns on
+// portable mode without the --portable flag.
+const portableMarker = "portable"
+
+// PortableDir returns the executable's directory when portable mode is
+// requested, by the flag or by the marker file, and "" otherwise. In portable
+// mode recordings, logs and config are kept in that directory so the app can
+// run from removable storage regardless of how it is launched.
+func PortableDir(requested bool) (string, error) {
+	executable, err := currentExecutable()
+	if err != nil {
+		if requested {
+			return "", err
+		}
+		return "", nil
+	}
+	dir := filepath.Dir(executable)
+	if requested {
+		return dir, nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, portableMarker)); err == nil {
+		return dir, nil
+	}
+	return "", nil
+}
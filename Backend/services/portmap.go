@@ -0,0 +1,529 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	portMapLifetime    = time.Hour
+	natPMPPort         = 5351
+	natPMPTries        = 4
+	ssdpAddr           = "239.255.255.250:1900"
+	ssdpTimeout        = 3 * time.Second
+	upnpDescription    = "Tab Recorder"
+	upnpGatewayService = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+)
+
+// PortMappingEnabled reports whether NAT_MAPPING asks for a router port mapping.
+func PortMappingEnabled() bool {
+	return isTruthy(os.Getenv("NAT_MAPPING"))
+}
+
+// PortMapping is the state of the router port mapping.
+type PortMapping struct {
+	Method       string    `json:"method,omitempty"` // "nat-pmp" or "upnp"
+	ExternalIP   string    `json:"externalIp,omitempty"`
+	ExternalPort int       `json:"externalPort,omitempty"`
+	InternalPort int       `json:"internalPort"`
+	Active       bool      `json:"active"`
+	RenewedAt    time.Time `json:"renewedAt,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// PortMapper asks the router to forward an external port to the server, with
+// NAT-PMP when the gateway is known and UPnP IGD otherwise, and renews the
+// mapping until stopped. This exposes the server to the internet, so it is
+// only done when enabled.
+type PortMapper struct {
+	internalPort int
+	externalPort int
+	gateway      net.IP
+	client       *http.Client // never proxied: the gateway is on the LAN
+	upnp         *upnpGateway
+	status       PortMapping
+	mu           sync.Mutex
+	stopChan     chan struct{}
+	done         chan struct{}
+}
+
+// NewPortMapper creates a mapper for the server's port, using
+// NAT_EXTERNAL_PORT (default the same port) and NAT_GATEWAY (default the
+// system's default gateway, where it can be found).
+func NewPortMapper(internalPort int) (*PortMapper, error) {
+	externalPort := internalPort
+	if v := strings.TrimSpace(os.Getenv("NAT_EXTERNAL_PORT")); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid NAT_EXTERNAL_PORT %q", v)
+		}
+		externalPort = port
+	}
+
+	var gateway net.IP
+	if v := strings.TrimSpace(os.Getenv("NAT_GATEWAY")); v != "" {
+		if gateway = net.ParseIP(v).To4(); gateway == nil {
+			return nil, fmt.Errorf("invalid NAT_GATEWAY %q", v)
+		}
+	} else if ip, err := defaultGateway(); err == nil {
+		gateway = ip
+	}
+
+	return &PortMapper{
+		internalPort: internalPort,
+		externalPort: externalPort,
+		gateway:      gateway,
+		client:       &http.Client{Transport: &http.Transport{}, Timeout: 10 * time.Second},
+		status:       PortMapping{InternalPort: internalPort},
+		stopChan:     make(chan struct{}),
+		done:         make(chan struct{}),
+	}, nil
+}
+
+// Status returns the current mapping.
+func (p *PortMapper) Status() PortMapping {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *PortMapper) Start() {
+	go func() {
+		defer CapturePanic()
+		defer close(p.done)
+		p.renew()
+
+		ticker := time.NewTicker(portMapLifetime / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.renew()
+			case <-p.stopChan:
+				p.unmap()
+				return
+			}
+		}
+	}()
+}
+
+// Stop removes the mapping from the router.
+func (p *PortMapper) Stop() {
+	close(p.stopChan)
+	<-p.done
+}
+
+func (p *PortMapper) renew() {
+	mapping, err := p.mapPort()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.status.Active = false
+		p.status.Error = err.Error()
+		LogError("[NAT] Port mapping failed: %v", err)
+		return
+	}
+	first := !p.status.Active || p.status.ExternalIP != mapping.ExternalIP || p.status.ExternalPort != mapping.ExternalPort
+	p.status = mapping
+	if first {
+		LogInfo("[NAT] Mapped %s:%d to port %d via %s", mapping.ExternalIP, mapping.ExternalPort, mapping.InternalPort, mapping.Method)
+	}
+}
+
+func (p *PortMapper) mapPort() (PortMapping, error) {
+	var errs []string
+	if p.gateway != nil {
+		mapping, err := p.mapNATPMP(portMapLifetime)
+		if err == nil {
+			return mapping, nil
+		}
+		errs = append(errs, "NAT-PMP: "+err.Error())
+	}
+	mapping, err := p.mapUPnP()
+	if err == nil {
+		return mapping, nil
+	}
+	errs = append(errs, "UPnP: "+err.Error())
+	return PortMapping{}, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+func (p *PortMapper) unmap() {
+	status := p.Status()
+	if !status.Active {
+		return
+	}
+	var err error
+	switch status.Method {
+	case "nat-pmp":
+		_, err = p.mapNATPMP(0)
+	case "upnp":
+		err = p.upnp.deletePortMapping(p.client, status.ExternalPort)
+	}
+	if err != nil {
+		LogError("[NAT] Failed to remove port mapping: %v", err)
+		return
+	}
+	LogInfo("[NAT] Removed port mapping %d", status.ExternalPort)
+}
+
+// mapNATPMP requests (or, with a zero lifetime, removes) a TCP mapping with
+// NAT-PMP (RFC 6886).
+func (p *PortMapper) mapNATPMP(lifetime time.Duration) (PortMapping, error) {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: p.gateway, Port: natPMPPort})
+	if err != nil {
+		return PortMapping{}, err
+	}
+	defer conn.Close()
+
+	external := p.externalPort
+	if lifetime == 0 {
+		external = 0
+	}
+	request := []byte{0, 2, 0, 0}
+	request = binary.BigEndian.AppendUint16(request, uint16(p.internalPort))
+	request = binary.BigEndian.AppendUint16(request, uint16(external))
+	request = binary.BigEndian.AppendUint32(request, uint32(lifetime/time.Second))
+	reply, err := natPMPRequest(conn, request, 130, 16)
+	if err != nil {
+		return PortMapping{}, err
+	}
+	mapping := PortMapping{
+		Method:       "nat-pmp",
+		ExternalPort: int(binary.BigEndian.Uint16(reply[10:])),
+		InternalPort: p.internalPort,
+		Active:       true,
+		RenewedAt:    time.Now(),
+	}
+	if lifetime == 0 {
+		return mapping, nil
+	}
+
+	reply, err = natPMPRequest(conn, []byte{0, 0}, 128, 12)
+	if err != nil {
+		return PortMapping{}, fmt.Errorf("failed to get external address: %w", err)
+	}
+	mapping.ExternalIP = net.IP(reply[8:12]).String()
+	return mapping, nil
+}
+
+// natPMPRequest sends request, retrying with the back-off from RFC 6886, and
+// returns the reply to it once it succeeded.
+func natPMPRequest(conn *net.UDPConn, request []byte, op byte, size int) ([]byte, error) {
+	reply := make([]byte, 16)
+	timeout := 250 * time.Millisecond
+	for try := 0; try < natPMPTries; try++ {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		timeout *= 2
+
+		n, err := conn.Read(reply)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return nil, err
+		}
+		if n < size || reply[1] != op {
+			continue
+		}
+		if code := binary.BigEndian.Uint16(reply[2:]); code != 0 {
+			return nil, fmt.Errorf("gateway refused the request (result code %d)", code)
+		}
+		return reply[:n], nil
+	}
+	return nil, fmt.Errorf("no reply from gateway %s", conn.RemoteAddr())
+}
+
+func (p *PortMapper) mapUPnP() (PortMapping, error) {
+	if p.upnp == nil {
+		gateway, err := discoverUPnPGateway(p.client)
+		if err != nil {
+			return PortMapping{}, err
+		}
+		p.upnp = gateway
+	}
+	if err := p.upnp.addPortMapping(p.client, p.externalPort, p.internalPort, portMapLifetime); err != nil {
+		// The router may have restarted with a new address; discover it again next time.
+		p.upnp = nil
+		return PortMapping{}, err
+	}
+	externalIP, err := p.upnp.externalIP(p.client)
+	if err != nil {
+		return PortMapping{}, fmt.Errorf("failed to get external address: %w", err)
+	}
+	return PortMapping{
+		Method:       "upnp",
+		ExternalIP:   externalIP,
+		ExternalPort: p.externalPort,
+		InternalPort: p.internalPort,
+		Active:       true,
+		RenewedAt:    time.Now(),
+	}, nil
+}
+
+// upnpGateway is the WAN connection service of an Internet Gateway Device.
+type upnpGateway struct {
+	controlURL  string
+	serviceType string
+	localIP     string
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// discoverUPnPGateway finds the router with an SSDP search and reads its
+// device description for the WAN connection service.
+func discoverUPnPGateway(client *http.Client) (*upnpGateway, error) {
+	var gateway *upnpGateway
+	err := ssdpSearch(upnpGatewayService, ssdpTimeout, func(location string) bool {
+		var err error
+		if gateway, err = readUPnPDescription(client, location); err != nil {
+			LogDebug("[NAT] Ignoring UPnP device at %s: %v", location, err)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for a gateway: %w", err)
+	}
+	if gateway == nil {
+		return nil, fmt.Errorf("no UPnP gateway found")
+	}
+	return gateway, nil
+}
+
+// ssdpSearch searches the LAN for UPnP devices or services of type st and
+// calls found with the description location of each reply, until found
+// returns false or timeout passes. Devices may answer more than once.
+func ssdpSearch(st string, timeout time.Duration, found func(location string) bool) error {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	group, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return err
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + st + "\r\n\r\n"
+	if _, err := conn.WriteToUDP([]byte(search), group); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return nil
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" {
+			continue
+		}
+		if !found(location) {
+			return nil
+		}
+	}
+}
+
+func readUPnPDescription(client *http.Client, location string) (*upnpGateway, error) {
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid device description: %w", err)
+	}
+	if root.URLBase != "" {
+		if u, err := url.Parse(root.URLBase); err == nil {
+			base = u
+		}
+	}
+
+	serviceType, controlURL := findWANService(root.Device)
+	if controlURL == "" {
+		return nil, fmt.Errorf("no WAN connection service")
+	}
+	control, err := base.Parse(controlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The mapping must point at the address the router sees us on.
+	conn, err := net.Dial("udp4", base.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP.String()
+
+	return &upnpGateway{controlURL: control.String(), serviceType: serviceType, localIP: localIP}, nil
+}
+
+func findWANService(device upnpDevice) (string, string) {
+	for _, service := range device.Services {
+		if strings.Contains(service.ServiceType, ":WANIPConnection:") || strings.Contains(service.ServiceType, ":WANPPPConnection:") {
+			return service.ServiceType, service.ControlURL
+		}
+	}
+	for _, child := range device.Devices {
+		if serviceType, controlURL := findWANService(child); controlURL != "" {
+			return serviceType, controlURL
+		}
+	}
+	return "", ""
+}
+
+func (g *upnpGateway) addPortMapping(client *http.Client, externalPort, internalPort int, lease time.Duration) error {
+	_, err := g.soap(client, "AddPortMapping", map[string]string{
+		"NewRemoteHost":             "",
+		"NewExternalPort":           strconv.Itoa(externalPort),
+		"NewProtocol":               "TCP",
+		"NewInternalPort":           strconv.Itoa(internalPort),
+		"NewInternalClient":         g.localIP,
+		"NewEnabled":                "1",
+		"NewPortMappingDescription": upnpDescription,
+		"NewLeaseDuration":          strconv.Itoa(int(lease / time.Second)),
+	})
+	return err
+}
+
+func (g *upnpGateway) deletePortMapping(client *http.Client, externalPort int) error {
+	_, err := g.soap(client, "DeletePortMapping", map[string]string{
+		"NewRemoteHost":   "",
+		"NewExternalPort": strconv.Itoa(externalPort),
+		"NewProtocol":     "TCP",
+	})
+	return err
+}
+
+func (g *upnpGateway) externalIP(client *http.Client) (string, error) {
+	body, err := g.soap(client, "GetExternalIPAddress", nil)
+	if err != nil {
+		return "", err
+	}
+	var envelope struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.Unmarshal(body, &envelope); err != nil || envelope.IP == "" {
+		return "", fmt.Errorf("invalid reply from gateway")
+	}
+	return envelope.IP, nil
+}
+
+// soap calls action on the gateway's WAN connection service and returns the
+// response body. The arguments must be in the order the action declares, so
+// they are written in the order of upnpArgumentOrder.
+func (g *upnpGateway) soap(client *http.Client, action string, args map[string]string) ([]byte, error) {
+	var ordered []upnpArgument
+	for _, name := range upnpArgumentOrder {
+		if value, ok := args[name]; ok {
+			ordered = append(ordered, upnpArgument{name, value})
+		}
+	}
+	return upnpSOAP(client, g.controlURL, g.serviceType, action, ordered)
+}
+
+// upnpArgument is an argument of a UPnP action.
+type upnpArgument struct {
+	name  string
+	value string
+}
+
+// upnpSOAP calls action on the UPnP service of serviceType at controlURL with
+// args, in the order the action declares them, and returns the response body.
+func upnpSOAP(client *http.Client, controlURL, serviceType, action string, args []upnpArgument) ([]byte, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg.name)
+		xml.EscapeText(&body, []byte(arg.value))
+		fmt.Fprintf(&body, "</%s>", arg.name)
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, serviceType, action))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var fault struct {
+			Code        string `xml:"Body>Fault>detail>UPnPError>errorCode"`
+			Description string `xml:"Body>Fault>detail>UPnPError>errorDescription"`
+		}
+		if xml.Unmarshal(data, &fault) == nil && fault.Code != "" {
+			return nil, fmt.Errorf("%s failed: %s (error %s)", action, fault.Description, fault.Code)
+		}
+		return nil, fmt.Errorf("%s failed: %s", action, resp.Status)
+	}
+	return data, nil
+}
+
+var upnpArgumentOrder = []string{
+	"NewRemoteHost",
+	"NewExternalPort",
+	"NewProtocol",
+	"NewInternalPort",
+	"NewInternalClient",
+	"NewEnabled",
+	"NewPortMappingDescription",
+	"NewLeaseDuration",
+}
@@ -6,11 +6,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 type PostProcessor struct {
 	ffmpegPath string
+	// ffprobePath is the ffprobe binary set by SetFFprobePath, if any.
+	ffprobePath string
+	inFlight    sync.Map
+	mu          sync.Mutex
 }
 
 func NewPostProcessor(ffmpegPath string) (*PostProcessor, error) {
@@ -37,8 +42,90 @@ func (pp *PostProcessor) checkFFmpegAvailable() error {
 	return nil
 }
 
-func (pp *PostProcessor) FixWebMMetadata(inputPath string) error {
+// FFmpegPath returns the ffmpeg binary this post-processor invokes.
+func (pp *PostProcessor) FFmpegPath() string {
+	return pp.ffmpegPath
+}
+
+// OldestJobAge returns how long the longest-running post-processing job has
+// been running, and the number of jobs currently in flight.
+func (pp *PostProcessor) OldestJobAge() (time.Duration, int) {
+	var oldest time.Duration
+	count := 0
+	pp.inFlight.Range(func(key, value interface{}) bool {
+		count++
+		if age := time.Since(value.(time.Time)); age > oldest {
+			oldest = age
+		}
+		return true
+	})
+	return oldest, count
+}
+
+// Fix post-processes a finished recording: FixAudioMetadata for audio-only
+// recordings, FixVideoMetadata for videos.
+func (pp *PostProcessor) Fix(inputPath string) error {
+	if IsAudioRecording(inputPath) {
+		return pp.FixAudioMetadata(inputPath)
+	}
+	return pp.FixVideoMetadata(inputPath)
+}
+
+// FixVideoMetadata rewrites a video so that players know its duration and
+// can seek in it. Fragmented MP4, as MediaRecorder writes it, becomes a
+// regular MP4 with its index at the start.
+func (pp *PostProcessor) FixVideoMetadata(inputPath string) error {
+	return pp.remux(inputPath, "-c", "copy", "-movflags", "+faststart", "-f", ffmpegMuxer(inputPath))
+}
+
+// FixAudioMetadata rewrites an audio-only recording so that players can seek
+// in it, drops any video track and tags it with its name and date, so that
+// music and podcast players list it properly.
+func (pp *PostProcessor) FixAudioMetadata(inputPath string) error {
+	title := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	return pp.remux(inputPath,
+		"-vn", "-c:a", "copy",
+		"-metadata", "title="+title,
+		"-metadata", "date="+time.Now().Format("2006-01-02"),
+		"-f", ffmpegMuxer(inputPath),
+	)
+}
+
+// ffmpegMuxer returns the FFmpeg format that writes files like inputPath.
+// It is given explicitly since FFmpeg does not know extensions such as .weba.
+func ffmpegMuxer(inputPath string) string {
+	if format, ok := fileFormatOf(inputPath); ok {
+		return format.muxer
+	}
+	return "webm"
+}
+
+// writeChapters saves the markers in the sidecar of inputPath as an FFmpeg
+// metadata file of chapters next to it and returns its path, or "" when the
+// recording has no markers or its format has no chapters.
+func writeChapters(inputPath string) (string, error) {
+	format, ok := fileFormatOf(inputPath)
+	if !ok || !format.chapters {
+		return "", nil
+	}
+	sidecar, ok, err := LoadSidecar(inputPath)
+	if err != nil || !ok || len(sidecar.Markers) == 0 {
+		return "", err
+	}
+	path := filepath.Join(filepath.Dir(inputPath), ".chapters_"+filepath.Base(inputPath)+".txt")
+	if err := os.WriteFile(path, []byte(ffmetadataChapters(sidecar)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write chapters: %w", err)
+	}
+	return path, nil
+}
+
+// remux runs FFmpeg over inputPath with the output options args and replaces
+// the file with the result. The markers in the sidecar of inputPath are added
+// as chapters, where its format has them.
+func (pp *PostProcessor) remux(inputPath string, args ...string) error {
 	startTime := time.Now()
+	pp.inFlight.Store(inputPath, startTime)
+	defer pp.inFlight.Delete(inputPath)
 	
 	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
 		return fmt.Errorf("input file does not exist: %s", inputPath)
@@ -59,14 +146,15 @@ func (pp *PostProcessor) FixWebMMetadata(inputPath string) error {
 	
 	LogInfo("[POSTPROCESSOR] Starting post-processing: %s (size: %d bytes)", inputPath, fileInfo.Size())
 	
-	cmd := exec.Command(
-		pp.ffmpegPath,
-		"-i", inputPath,
-		"-c", "copy",
-		"-movflags", "+faststart",
-		"-y",
-		tempPath,
-	)
+	cmdArgs := []string{"-i", inputPath}
+	if chapters, err := writeChapters(inputPath); err != nil {
+		LogError("[POSTPROCESSOR] Leaving out the markers of %s: %v", inputPath, err)
+	} else if chapters != "" {
+		defer os.Remove(chapters)
+		cmdArgs = append(cmdArgs, "-i", chapters, "-map_chapters", "1")
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmd := exec.Command(pp.ffmpegPath, append(cmdArgs, "-y", tempPath)...)
 	
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// previewTail is how many complete clusters of a WebM or Matroska recording,
+// or fragments of an MP4 one, a live preview keeps besides the one being
+// received. Viewers start with them, a few seconds behind the tab.
+const previewTail = 3
+
+// maxPreviewSegment is the largest cluster or fragment a live preview keeps;
+// the preview of a recording with bigger ones ends.
+const maxPreviewSegment = 16 << 20
+
+// previewBuffer is how many chunks a viewer may fall behind by before it is
+// dropped, since a stream with chunks left out cannot be played.
+const previewBuffer = 64
+
+// ErrPreviewUnavailable is returned by Join before the start of the
+// recording has arrived, and once the preview has ended.
+var ErrPreviewUnavailable = errors.New("no live preview is available")
+
+// LivePreview keeps the start of a recording file being received and its
+// latest clusters or fragments in memory, so that the recording can be
+// watched while it is made. The start a viewer joins with, followed by the
+// chunks it is sent, can be appended to a Media Source Extensions
+// SourceBuffer of the preview's MIME type.
+type LivePreview struct {
+	container string
+	splitter  mediaSplitter
+	mimeType  string
+	init      []byte
+	tail      [][]byte
+	viewers   map[chan []byte]struct{}
+	ended     bool
+	mu        sync.Mutex
+}
+
+// PreviewViewer is a viewer of a live preview.
+type PreviewViewer struct {
+	// MIMEType is the type, with codecs, of the preview's SourceBuffer.
+	MIMEType string
+	// Start is the start of the recording file and its latest clusters or
+	// fragments.
+	Start []byte
+	// Chunks receives the chunks of the recording that follow Start. It is
+	// closed when the preview ends or the viewer falls too far behind.
+	Chunks <-chan []byte
+
+	leave func()
+}
+
+// Leave stops sending chunks to the viewer.
+func (v *PreviewViewer) Leave() {
+	v.leave()
+}
+
+// newLivePreview returns the preview of a new recording file of container.
+func newLivePreview(container string) *LivePreview {
+	next := nextEBMLElement
+	if container == ContainerMP4 {
+		next = nextMP4Box
+	}
+	return &LivePreview{
+		container: container,
+		splitter:  mediaSplitter{next: next},
+		viewers:   make(map[chan []byte]struct{}),
+	}
+}
+
+// write adds a chunk of the recording, in the order the file gets them.
+func (p *LivePreview) write(data []byte) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ended {
+		return
+	}
+	init, segments, err := p.splitter.write(data)
+	if err != nil {
+		LogError("[PREVIEW] Live preview ended: %v", err)
+		p.endLocked()
+		return
+	}
+	if init != nil {
+		p.init = init
+		p.mimeType = previewMIMEType(p.container, init)
+	}
+	p.tail = append(p.tail, segments...)
+	if len(p.tail) > previewTail {
+		p.tail = append([][]byte(nil), p.tail[len(p.tail)-previewTail:]...)
+	}
+	// Viewers get the chunk after it was written, by when the buffer it is
+	// in is reused
+	if len(p.viewers) > 0 {
+		data = append([]byte(nil), data...)
+	}
+	for viewer := range p.viewers {
+		select {
+		case viewer <- data:
+		default:
+			close(viewer)
+			delete(p.viewers, viewer)
+		}
+	}
+}
+
+// Join adds a viewer of the preview. It returns ErrPreviewUnavailable until
+// the start of the recording has arrived, and once the preview has ended.
+func (p *LivePreview) Join() (*PreviewViewer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ended || p.init == nil {
+		return nil, ErrPreviewUnavailable
+	}
+	start := append([]byte(nil), p.init...)
+	for _, segment := range p.tail {
+		start = append(start, segment...)
+	}
+	start = append(start, p.splitter.buf...)
+
+	chunks := make(chan []byte, previewBuffer)
+	p.viewers[chunks] = struct{}{}
+	return &PreviewViewer{
+		MIMEType: p.mimeType,
+		Start:    start,
+		Chunks:   chunks,
+		leave: func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if _, ok := p.viewers[chunks]; ok {
+				close(chunks)
+				delete(p.viewers, chunks)
+			}
+		},
+	}, nil
+}
+
+// close ends the preview when its file is closed.
+func (p *LivePreview) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLocked()
+}
+
+func (p *LivePreview) endLocked() {
+	p.ended = true
+	for viewer := range p.viewers {
+		close(viewer)
+	}
+	p.viewers = make(map[chan []byte]struct{})
+	p.splitter = mediaSplitter{}
+	p.init, p.tail = nil, nil
+}
+
+// elementScanner reads the EBML element or MP4 box at the start of buf, the
+// first of the file when first. It returns how far to go on from it: past
+// its header only, when its children are read too, or past all of it.
+// segment reports whether a cluster or fragment starts with it. n is 0 while
+// buf holds too little of it.
+type elementScanner func(buf []byte, first bool) (n int, segment bool, err error)
+
+// mediaSplitter splits a recording file, received in chunks, into its start
+// and its clusters or fragments.
+type mediaSplitter struct {
+	next elementScanner
+	// buf holds the bytes since the start of the current cluster or
+	// fragment, or of the file while its first one has not begun.
+	buf []byte
+	// pos is how much of buf has been read.
+	pos     int
+	started bool
+	scanned bool
+}
+
+// write adds data to the file. It returns the start of the file once its
+// first cluster or fragment begins, and those that data completes.
+func (s *mediaSplitter) write(data []byte) (init []byte, segments [][]byte, err error) {
+	s.buf = append(s.buf, data...)
+	for {
+		n, segment, err := s.next(s.buf[s.pos:], !s.scanned)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n == 0 {
+			break
+		}
+		s.scanned = true
+		if segment && s.pos > 0 {
+			if s.started {
+				segments = append(segments, s.buf[:s.pos:s.pos])
+			} else {
+				init = s.buf[:s.pos:s.pos]
+				s.started = true
+			}
+			s.buf = s.buf[s.pos:]
+			s.pos = 0
+		}
+		s.pos += n
+	}
+	if len(s.buf) > maxPreviewSegment {
+		return nil, nil, fmt.Errorf("a cluster or fragment is larger than %d bytes", maxPreviewSegment)
+	}
+	return init, segments, nil
+}
+
+// IDs of the EBML elements the WebM and Matroska splitter looks for.
+const (
+	ebmlHeaderID = 0x1A45DFA3
+	segmentID    = 0x18538067
+	clusterID    = 0x1F43B675
+)
+
+// nextEBMLElement is the elementScanner of WebM and Matroska files. The
+// children of the segment, and of clusters of unknown size as MediaRecorder
+// writes them, are read too.
+func nextEBMLElement(buf []byte, first bool) (int, bool, error) {
+	id, idLen, err := readEBMLVint(buf, false)
+	if err != nil || idLen == 0 {
+		return 0, false, err
+	}
+	size, sizeLen, err := readEBMLVint(buf[idLen:], true)
+	if err != nil || sizeLen == 0 {
+		return 0, false, err
+	}
+	if first && id != ebmlHeaderID {
+		return 0, false, errors.New("the recording does not start with a WebM header")
+	}
+	header := idLen + sizeLen
+	if id == segmentID || size < 0 {
+		return header, id == clusterID, nil
+	}
+	if size > maxPreviewSegment {
+		return 0, false, fmt.Errorf("an element is larger than %d bytes", maxPreviewSegment)
+	}
+	if len(buf) < header+int(size) {
+		return 0, false, nil
+	}
+	return header + int(size), id == clusterID, nil
+}
+
+// readEBMLVint reads the variable-length integer at the start of buf: an
+// element ID, with its length marker, or a size, without it, which is -1 when
+// unknown. n is 0 when buf holds too little of it.
+func readEBMLVint(buf []byte, isSize bool) (value int64, n int, err error) {
+	if len(buf) == 0 {
+		return 0, 0, nil
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && buf[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || (!isSize && length > 4) {
+		return 0, 0, errors.New("invalid WebM element")
+	}
+	if len(buf) < length {
+		return 0, 0, nil
+	}
+	unknown := true
+	for i := 0; i < length; i++ {
+		b := buf[i]
+		if i == 0 && isSize {
+			b &= 0xFF >> length
+			unknown = b == 0xFF>>length
+		} else if isSize {
+			unknown = unknown && b == 0xFF
+		}
+		value = value<<8 | int64(b)
+	}
+	if isSize && unknown {
+		return -1, length, nil
+	}
+	return value, length, nil
+}
+
+// nextMP4Box is the elementScanner of fragmented MP4 files, where each
+// fragment starts with a moof box.
+func nextMP4Box(buf []byte, first bool) (int, bool, error) {
+	if len(buf) < 8 {
+		return 0, false, nil
+	}
+	size, header := uint64(binary.BigEndian.Uint32(buf)), 8
+	boxType := string(buf[4:8])
+	if size == 1 {
+		if len(buf) < 16 {
+			return 0, false, nil
+		}
+		size, header = binary.BigEndian.Uint64(buf[8:]), 16
+	}
+	if first && boxType != "ftyp" {
+		return 0, false, errors.New("the recording does not start with an MP4 header")
+	}
+	if size < uint64(header) || size > maxPreviewSegment {
+		return 0, false, fmt.Errorf("invalid size of %s box", boxType)
+	}
+	if uint64(len(buf)) < size {
+		return 0, false, nil
+	}
+	return int(size), boxType == "moof", nil
+}
+
+// previewCodec is a codec as the start of a recording names it, and as MIME
+// types do.
+type previewCodec struct {
+	name  string
+	codec string
+	video bool
+}
+
+// webmCodecs and mp4Codecs list the codecs MediaRecorder records, video
+// first.
+var (
+	webmCodecs = []previewCodec{
+		{name: "V_VP8", codec: "vp8", video: true},
+		{name: "V_VP9", codec: "vp9", video: true},
+		{name: "V_AV1", codec: "av01.0.04M.08", video: true},
+		{name: "V_MPEG4/ISO/AVC", codec: "avc1.42E01E", video: true},
+		{name: "A_OPUS", codec: "opus"},
+		{name: "A_VORBIS", codec: "vorbis"},
+	}
+	mp4Codecs = []previewCodec{
+		{name: "avc1", codec: "avc1.42E01E", video: true},
+		{name: "vp09", codec: "vp09.00.10.08", video: true},
+		{name: "Opus", codec: "opus"},
+		{name: "mp4a", codec: "mp4a.40.2"},
+	}
+)
+
+// previewMIMEType returns the MIME type, with codecs, of a preview of a
+// recording of container that starts with init. Matroska previews are typed
+// as WebM, which Media Source Extensions take instead.
+func previewMIMEType(container string, init []byte) string {
+	kind, codecs := "webm", webmCodecs
+	if container == ContainerMP4 {
+		kind, codecs = "mp4", mp4Codecs
+	}
+	var found []string
+	video := false
+	for _, codec := range codecs {
+		if !bytes.Contains(init, []byte(codec.name)) {
+			continue
+		}
+		name := codec.codec
+		// The avcC box names the H.264 profile and level
+		if i := bytes.Index(init, []byte("avcC")); codec.name == "avc1" && i >= 0 && len(init) >= i+8 {
+			name = fmt.Sprintf("avc1.%02X%02X%02X", init[i+5], init[i+6], init[i+7])
+		}
+		found = append(found, name)
+		video = video || codec.video
+	}
+	media := "audio"
+	if video {
+		media = "video"
+	}
+	return fmt.Sprintf(`%s/%s; codecs="%s"`, media, kind, strings.Join(found, ","))
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Session priorities. Chunks of a high priority recording are written, and the
+// recording is post-processed, before those of normal ones when the server is
+// busy, e.g. for a live webinar that cannot be recorded again.
+const (
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// parallelWrites is how many chunks of different recordings are written to
+// disk at the same time.
+const parallelWrites = 4
+
+// IsSessionPriority reports whether priority can be requested for a
+// recording. Empty is allowed and means PriorityNormal.
+func IsSessionPriority(priority string) bool {
+	return priority == "" || priority == PriorityNormal || priority == PriorityHigh
+}
+
+// LoadPostProcessingJobsFromEnv returns how many recordings may be
+// post-processed at a time, POST_PROCESSING_JOBS (default 0, one per CPU).
+func LoadPostProcessingJobsFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("POST_PROCESSING_JOBS")); err == nil && v >= 0 {
+		return v
+	}
+	return 0
+}
+
+// priorityGate lets at most limit holders in at a time. When it is full,
+// waiting high priority holders are let in before normal ones, each in the
+// order they arrived.
+type priorityGate struct {
+	limit  int
+	held   int
+	high   []chan struct{}
+	normal []chan struct{}
+	mu     sync.Mutex
+}
+
+// newPriorityGate returns a gate for limit holders; 0 means one per CPU.
+func newPriorityGate(limit int) *priorityGate {
+	g := &priorityGate{}
+	g.setLimit(limit)
+	return g
+}
+
+// acquire waits for a place, ahead of normal waiters when high.
+func (g *priorityGate) acquire(high bool) {
+	g.mu.Lock()
+	if g.held < g.limit {
+		g.held++
+		g.mu.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	if high {
+		g.high = append(g.high, ready)
+	} else {
+		g.normal = append(g.normal, ready)
+	}
+	g.mu.Unlock()
+	<-ready
+}
+
+// release gives the place back, or hands it to the next waiter.
+func (g *priorityGate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.held--
+	g.admitLocked()
+}
+
+// setLimit changes how many holders are let in; 0 means one per CPU. Waiters
+// are let in at once when the limit grows.
+func (g *priorityGate) setLimit(limit int) {
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limit = limit
+	g.admitLocked()
+}
+
+// waiting returns how many holders are waiting for a place.
+func (g *priorityGate) waiting() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.high) + len(g.normal)
+}
+
+func (g *priorityGate) admitLocked() {
+	for g.held < g.limit {
+		var next chan struct{}
+		switch {
+		case len(g.high) > 0:
+			next, g.high = g.high[0], g.high[1:]
+		case len(g.normal) > 0:
+			next, g.normal = g.normal[0], g.normal[1:]
+		default:
+			return
+		}
+		g.held++
+		close(next)
+	}
+}
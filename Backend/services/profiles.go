@@ -0,0 +1,474 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProfile records to the configured recordings directory
+	// (paths.recordings). It always exists and cannot be deleted.
+	DefaultProfile = "default"
+	// DefaultNamingTemplate gives "{name}_{tabID}_{timestamp}.webm", the names
+	// recordings had before templates existed.
+	DefaultNamingTemplate = "{name}_{tab}_{timestamp}"
+
+	retentionSweepInterval = time.Hour
+
+	// maxNameTitle is how much of a page title {title} keeps, so that file
+	// names stay within what file systems allow.
+	maxNameTitle = 100
+)
+
+var (
+	profileNamePattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,31}$`)
+	templateFieldPattern = regexp.MustCompile(`\{[^{}]*\}`)
+	// namingFields are the placeholders a naming template may use.
+	namingFields = map[string]bool{"{name}": true, "{tab}": true, "{timestamp}": true, "{date}": true, "{time}": true, "{profile}": true,
+		"{title}": true, "{host}": true, "{resolution}": true}
+)
+
+// Profile is a named set of recording settings, so that different kinds of
+// captures stay separated: each has its own directory, how long recordings
+// are kept, and how they are named.
+type Profile struct {
+	Name string `json:"name"`
+	// RecordingsDir is empty for the default profile, which uses the
+	// configured recordings directory.
+	RecordingsDir string `json:"recordingsDir,omitempty"`
+	// RetentionDays deletes recordings older than this many days; 0 keeps them.
+	RetentionDays int `json:"retentionDays,omitempty"`
+	// NamingTemplate names new recordings from {name}, {tab}, {timestamp},
+	// {date}, {time}, {profile}, and the {title}, {host} and {resolution} of
+	// the recorded page; empty means DefaultNamingTemplate.
+	NamingTemplate string `json:"namingTemplate,omitempty"`
+	// Hosts routes the recordings of pages on these hosts to the profile
+	// whichever profile is active, e.g. "*.corp.example.com". Patterns are
+	// matched with path.Match.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+type profileFile struct {
+	Active   string     `json:"active"`
+	Profiles []*Profile `json:"profiles"`
+}
+
+// ProfileStore keeps the profiles in a JSON file and applies the active one
+// to the file writer. It also deletes recordings past each profile's
+// retention.
+type ProfileStore struct {
+	path       string
+	fileWriter *FileWriterService
+	defaultDir string
+	active     string
+	profiles   map[string]*Profile
+	mu         sync.Mutex
+	stopChan   chan struct{}
+}
+
+// LoadProfileStore reads the profiles from path, if it exists, and applies
+// the active profile to fileWriter. The default profile records to
+// fileWriter's current directory.
+func LoadProfileStore(path string, fileWriter *FileWriterService) (*ProfileStore, error) {
+	ps := &ProfileStore{
+		path:       path,
+		fileWriter: fileWriter,
+		defaultDir: fileWriter.GetDownloadDir(),
+		active:     DefaultProfile,
+		profiles:   map[string]*Profile{DefaultProfile: {Name: DefaultProfile}},
+		stopChan:   make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	if err == nil {
+		var file profileFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse profiles: %w", err)
+		}
+		for _, p := range file.Profiles {
+			if p == nil {
+				continue
+			}
+			if err := validateProfile(*p); err != nil {
+				return nil, fmt.Errorf("invalid profile in %s: %w", path, err)
+			}
+			if p.Name == DefaultProfile {
+				p.RecordingsDir = ""
+			}
+			ps.profiles[p.Name] = p
+		}
+		if _, ok := ps.profiles[file.Active]; ok {
+			ps.active = file.Active
+		}
+	}
+
+	ps.applyLocked()
+	fileWriter.SetProfileRouter(ps.Route)
+	return ps, nil
+}
+
+// List returns the profiles sorted by name, with the default profile's
+// directory filled in, and the name of the active one.
+func (ps *ProfileStore) List() ([]Profile, string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	profiles := make([]Profile, 0, len(ps.profiles))
+	for _, p := range ps.profiles {
+		profiles = append(profiles, ps.resolvedLocked(p))
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, ps.active
+}
+
+// Active returns the active profile.
+func (ps *ProfileStore) Active() Profile {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.resolvedLocked(ps.profiles[ps.active])
+}
+
+// Put creates or replaces a profile. Its directory is created if needed; the
+// default profile's directory is not changed here.
+func (ps *ProfileStore) Put(profile Profile) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	if profile.Name == DefaultProfile {
+		profile.RecordingsDir = ""
+	} else {
+		if profile.RecordingsDir == "" {
+			return fmt.Errorf("recordingsDir is required")
+		}
+		dir, err := filepath.Abs(profile.RecordingsDir)
+		if err != nil {
+			return fmt.Errorf("invalid recordingsDir: %w", err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create recordings directory: %w", err)
+		}
+		profile.RecordingsDir = dir
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	previous := ps.profiles[profile.Name]
+	ps.profiles[profile.Name] = &profile
+	if err := ps.saveLocked(); err != nil {
+		if previous != nil {
+			ps.profiles[profile.Name] = previous
+		} else {
+			delete(ps.profiles, profile.Name)
+		}
+		return err
+	}
+	if profile.Name == ps.active {
+		ps.applyLocked()
+	}
+	LogInfo("[PROFILE] Saved profile %q", profile.Name)
+	return nil
+}
+
+// Delete removes a profile. The default and the active profile cannot be
+// deleted; recordings already made are left on disk.
+func (ps *ProfileStore) Delete(name string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	profile, ok := ps.profiles[name]
+	switch {
+	case !ok:
+		return fmt.Errorf("no profile named %q", name)
+	case name == DefaultProfile:
+		return fmt.Errorf("the default profile cannot be deleted")
+	case name == ps.active:
+		return fmt.Errorf("switch to another profile before deleting %q", name)
+	}
+	delete(ps.profiles, name)
+	if err := ps.saveLocked(); err != nil {
+		ps.profiles[name] = profile
+		return err
+	}
+	LogInfo("[PROFILE] Deleted profile %q", name)
+	return nil
+}
+
+// Activate switches to the named profile. Recordings in progress finish in
+// the directory they started in; new ones use the profile's settings.
+func (ps *ProfileStore) Activate(name string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.profiles[name]; !ok {
+		return fmt.Errorf("no profile named %q", name)
+	}
+	previous := ps.active
+	ps.active = name
+	if err := ps.saveLocked(); err != nil {
+		ps.active = previous
+		return err
+	}
+	ps.applyLocked()
+	LogInfo("[PROFILE] Switched to profile %q", name)
+	return nil
+}
+
+// Route picks the profile a new recording of source is saved with: the
+// profile named requested, when there is one, or else the first, by name, of
+// the profiles whose hosts match the host of its page. It reports false when
+// neither applies, leaving the recording to the active profile.
+func (ps *ProfileStore) Route(requested string, source RecordingSource) (Profile, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if requested != "" {
+		if p, ok := ps.profiles[requested]; ok {
+			return ps.resolvedLocked(p), true
+		}
+		LogError("[PROFILE] No profile named %q, saving the recording of %s by the profile rules", requested, source.URL)
+	}
+	u, err := url.Parse(source.URL)
+	if err != nil || u.Hostname() == "" {
+		return Profile{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+	names := make([]string, 0, len(ps.profiles))
+	for name := range ps.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := ps.profiles[name]
+		for _, pattern := range p.Hosts {
+			if ok, _ := path.Match(pattern, host); ok {
+				return ps.resolvedLocked(p), true
+			}
+		}
+	}
+	return Profile{}, false
+}
+
+// SetRecordingsDir changes the directory of the active profile, as picked in
+// the UI. It reports whether that is the default profile, whose directory the
+// caller saves as paths.recordings.
+func (ps *ProfileStore) SetRecordingsDir(dir string) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.active == DefaultProfile {
+		ps.defaultDir = dir
+		ps.applyLocked()
+		return true, nil
+	}
+	profile := ps.profiles[ps.active]
+	previous := profile.RecordingsDir
+	profile.RecordingsDir = dir
+	if err := ps.saveLocked(); err != nil {
+		profile.RecordingsDir = previous
+		return false, err
+	}
+	ps.applyLocked()
+	return false, nil
+}
+
+// SetDefaultDir changes the default profile's directory after
+// paths.recordings was reloaded from the config file.
+func (ps *ProfileStore) SetDefaultDir(dir string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.defaultDir = dir
+	if ps.active == DefaultProfile {
+		ps.applyLocked()
+	}
+}
+
+// Start runs the retention sweep now and then every hour.
+func (ps *ProfileStore) Start() {
+	go func() {
+		defer CapturePanic()
+		ps.sweep()
+
+		ticker := time.NewTicker(retentionSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ps.sweep()
+			case <-ps.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the retention sweep.
+func (ps *ProfileStore) Stop() {
+	close(ps.stopChan)
+}
+
+// sweep deletes recordings older than their profile's retention.
+func (ps *ProfileStore) sweep() {
+	profiles, _ := ps.List()
+	for _, profile := range profiles {
+		if profile.RetentionDays <= 0 {
+			continue
+		}
+		recordings, err := ListRecordings(profile.RecordingsDir)
+		if err != nil {
+			LogError("[PROFILE] Retention check failed for %q: %v", profile.Name, err)
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -profile.RetentionDays)
+		for _, rec := range recordings {
+			if !rec.Recorded.Before(cutoff) {
+				continue
+			}
+			if err := RemoveRecording(rec.Path); err != nil {
+				LogError("[PROFILE] Failed to delete expired recording %s: %v", rec.Path, err)
+				continue
+			}
+			LogInfo("[PROFILE] Deleted %s (older than %d days, profile %q)", rec.Name, profile.RetentionDays, profile.Name)
+		}
+	}
+}
+
+func (ps *ProfileStore) resolvedLocked(p *Profile) Profile {
+	resolved := *p
+	if resolved.Name == DefaultProfile {
+		resolved.RecordingsDir = ps.defaultDir
+	}
+	if resolved.NamingTemplate == "" {
+		resolved.NamingTemplate = DefaultNamingTemplate
+	}
+	return resolved
+}
+
+func (ps *ProfileStore) applyLocked() {
+	profile := ps.resolvedLocked(ps.profiles[ps.active])
+	ps.fileWriter.SetDownloadDir(profile.RecordingsDir)
+	ps.fileWriter.SetNaming(profile.Name, profile.NamingTemplate)
+}
+
+func (ps *ProfileStore) saveLocked() error {
+	file := profileFile{Active: ps.active}
+	for _, p := range ps.profiles {
+		file.Profiles = append(file.Profiles, p)
+	}
+	sort.Slice(file.Profiles, func(i, j int) bool { return file.Profiles[i].Name < file.Profiles[j].Name })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ps.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := ps.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+	if err := os.Rename(tmp, ps.path); err != nil {
+		return fmt.Errorf("failed to save profiles: %w", err)
+	}
+	return nil
+}
+
+func validateProfile(p Profile) error {
+	if !profileNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("profile name must be 1-32 letters, digits, '-' or '_'")
+	}
+	if p.RetentionDays < 0 {
+		return fmt.Errorf("retentionDays must not be negative")
+	}
+	for _, pattern := range p.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || pattern != strings.ToLower(pattern) || strings.Contains(pattern, "/") {
+			return fmt.Errorf("invalid host pattern %q: hosts are lowercase names such as *.example.com", pattern)
+		}
+	}
+	return ValidateNamingTemplate(p.NamingTemplate)
+}
+
+// ValidateNamingTemplate checks that template only uses known placeholders
+// and cannot name a file outside the recordings directory. Empty is valid and
+// means DefaultNamingTemplate.
+func ValidateNamingTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	if strings.ContainsAny(template, `/\`) || strings.Contains(template, "..") {
+		return fmt.Errorf("naming template must not contain path separators or '..'")
+	}
+	for _, field := range templateFieldPattern.FindAllString(template, -1) {
+		if !namingFields[field] {
+			return fmt.Errorf("unknown placeholder %s in naming template", field)
+		}
+	}
+	return nil
+}
+
+// RenderRecordingName fills in a naming template for a new recording of
+// source, with dates and times in clock's time zone. A page title that is
+// not known is replaced by the name. The name and source come from the
+// client, so anything that could leave the recordings directory, or that
+// Windows does not allow in file names, such as the | of many page titles,
+// is replaced.
+func RenderRecordingName(template, profile, name string, tabID int, timestamp int64, source RecordingSource, clock Clock) string {
+	if template == "" {
+		template = DefaultNamingTemplate
+	}
+	started := time.UnixMilli(timestamp)
+	if timestamp <= 0 {
+		started = time.Now()
+	}
+	stamp := strconv.FormatInt(timestamp, 10)
+	if clock.WallClockNames {
+		stamp = clock.FormatTime(started)
+	}
+	local := clock.In(started)
+	title := truncateRunes(source.Title, maxNameTitle)
+	if title == "" {
+		title = name
+	}
+	rendered := strings.NewReplacer(
+		"{name}", name,
+		"{tab}", strconv.Itoa(tabID),
+		"{timestamp}", stamp,
+		"{date}", local.Format("2006-01-02"),
+		"{time}", local.Format("15-04-05"),
+		"{profile}", profile,
+		"{title}", title,
+		"{host}", source.Host(),
+		"{resolution}", source.Resolution(),
+	).Replace(template)
+
+	rendered = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '<', '>', '"', '|', '?', '*':
+			return '_'
+		}
+		if r < ' ' {
+			return '_'
+		}
+		return r
+	}, rendered)
+	rendered = strings.TrimLeft(rendered, ".")
+	if rendered == "" {
+		rendered = "recording"
+	}
+	return rendered
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ProxyDirect as a per-feature proxy setting bypasses the proxy for that
+// feature.
+const ProxyDirect = "direct"
+
+// proxyFeatureEnv names the per-feature proxy settings. Each takes a proxy
+// URL or "direct"; when unset the feature uses HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY (config keys proxy.http, proxy.https and proxy.no_proxy).
+var proxyFeatureEnv = map[string]string{
+	"update": "UPDATE_PROXY",
+	"ffmpeg": "FFMPEG_PROXY",
+}
+
+// proxyEnvNames are the variables other programs read their proxy from. Both
+// spellings are set, as tools disagree about which one they look at.
+var proxyEnvNames = []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"}
+
+// featureProxy returns the proxy configured for feature: a URL, ProxyDirect,
+// or "" to use the environment.
+func featureProxy(feature string) (string, error) {
+	value := strings.TrimSpace(os.Getenv(proxyFeatureEnv[feature]))
+	if value == "" || strings.EqualFold(value, ProxyDirect) {
+		return strings.ToLower(value), nil
+	}
+	if err := validateProxyURL(value); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", proxyFeatureEnv[feature], err)
+	}
+	return value, nil
+}
+
+func validateProxyURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%q is not a proxy URL such as http://proxy:3128", value)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	}
+	return fmt.Errorf("unsupported proxy scheme %q (expected http, https or socks5)", u.Scheme)
+}
+
+// NewProxyTransport returns an HTTP transport for feature's outbound requests
+// that goes through the proxy configured for it.
+func NewProxyTransport(feature string) (*http.Transport, error) {
+	proxy, err := featureProxy(feature)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch proxy {
+	case "":
+		transport.Proxy = http.ProxyFromEnvironment
+	case ProxyDirect:
+		transport.Proxy = nil
+	default:
+		u, _ := url.Parse(proxy)
+		transport.Proxy = http.ProxyURL(u)
+	}
+	return transport, nil
+}
+
+// proxyEnv returns the proxy variables to give a child process doing
+// feature's downloads explicitly, since sudo does not pass the environment
+// on. It is nil when no proxy is configured at all.
+func proxyEnv(feature string) ([]string, error) {
+	proxy, err := featureProxy(feature)
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	switch proxy {
+	case "":
+		for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+			value := os.Getenv(name)
+			if value == "" {
+				value = os.Getenv(strings.ToLower(name))
+			}
+			if value != "" {
+				env = append(env, name+"="+value, strings.ToLower(name)+"="+value)
+			}
+		}
+	case ProxyDirect:
+		for _, name := range proxyEnvNames {
+			env = append(env, name+"=")
+		}
+	default:
+		for _, name := range proxyEnvNames {
+			env = append(env, name+"="+proxy)
+		}
+	}
+	return env, nil
+}
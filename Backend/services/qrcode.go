@@ -0,0 +1,468 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A minimal QR code encoder: byte mode, error correction level M, versions 1-10
+// (up to 213 bytes), which is plenty for pairing URLs.
+
+type qrBlockLayout struct {
+	ecPerBlock int
+	groups     [][2]int // {block count, data codewords per block}
+}
+
+var qrLayoutsM = []qrBlockLayout{
+	1:  {10, [][2]int{{1, 16}}},
+	2:  {16, [][2]int{{1, 28}}},
+	3:  {26, [][2]int{{1, 44}}},
+	4:  {18, [][2]int{{2, 32}}},
+	5:  {24, [][2]int{{2, 43}}},
+	6:  {16, [][2]int{{4, 27}}},
+	7:  {18, [][2]int{{4, 31}}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+var qrAlignmentPositions = [][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+func (l qrBlockLayout) dataCodewords() int {
+	total := 0
+	for _, g := range l.groups {
+		total += g[0] * g[1]
+	}
+	return total
+}
+
+type qrMatrix struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newQRMatrix(size int) *qrMatrix {
+	m := &qrMatrix{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range m.modules {
+		m.modules[i] = make([]bool, size)
+		m.function[i] = make([]bool, size)
+	}
+	return m
+}
+
+func (m *qrMatrix) setFunction(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.function[y][x] = true
+}
+
+// QRCodeSVG renders text as a QR code SVG with a four-module quiet zone.
+func QRCodeSVG(text string) (string, error) {
+	m, err := encodeQR([]byte(text))
+	if err != nil {
+		return "", err
+	}
+
+	const quiet = 4
+	var path strings.Builder
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.modules[y][x] {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	dim := m.size + 2*quiet
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`, dim, dim, path.String()), nil
+}
+
+func encodeQR(data []byte) (*qrMatrix, error) {
+	version := 0
+	for v := 1; v < len(qrLayoutsM); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*qrLayoutsM[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("data too long for a QR code (%d bytes)", len(data))
+	}
+	layout := qrLayoutsM[version]
+
+	codewords := qrInterleave(qrDataCodewords(data, version, layout.dataCodewords()), layout)
+
+	size := 17 + 4*version
+	m := newQRMatrix(size)
+	m.drawFunctionPatterns(version)
+	m.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		if penalty := m.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		m.applyMask(mask)
+	}
+	m.applyMask(best)
+	m.drawFormatBits(best)
+	return m, nil
+}
+
+// qrDataCodewords builds the byte-mode bit stream padded to capacity codewords.
+func qrDataCodewords(data []byte, version, capacity int) []byte {
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	appendBits(0x4, 4)
+	if version >= 10 {
+		appendBits(len(data), 16)
+	} else {
+		appendBits(len(data), 8)
+	}
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	capacityBits := capacity * 8
+	for i := 0; i < 4 && len(bits) < capacityBits; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	out := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		out = append(out, b)
+	}
+	for pad := byte(0xEC); len(out) < capacity; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// qrInterleave splits data into blocks, appends Reed-Solomon error correction
+// and interleaves the result in transmission order.
+func qrInterleave(data []byte, layout qrBlockLayout) []byte {
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, g := range layout.groups {
+		for i := 0; i < g[0]; i++ {
+			block := data[offset : offset+g[1]]
+			offset += g[1]
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, qrReedSolomon(block, layout.ecPerBlock))
+		}
+	}
+
+	var out []byte
+	for i := 0; ; i++ {
+		wrote := false
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+				wrote = true
+			}
+		}
+		if !wrote {
+			break
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// qrGFMul multiplies in GF(256) with the QR primitive polynomial 0x11D.
+func qrGFMul(a, b byte) byte {
+	var result byte
+	for i := 7; i >= 0; i-- {
+		carry := result&0x80 != 0
+		result <<= 1
+		if carry {
+			result ^= 0x1D
+		}
+		if (b>>i)&1 == 1 {
+			result ^= a
+		}
+	}
+	return result
+}
+
+func qrReedSolomon(data []byte, degree int) []byte {
+	// Generator polynomial (x - a^0)(x - a^1)...(x - a^(degree-1)), leading term omitted.
+	generator := make([]byte, degree)
+	generator[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			generator[j] = qrGFMul(generator[j], root)
+			if j+1 < degree {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = qrGFMul(root, 0x02)
+	}
+
+	remainder := make([]byte, degree)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[degree-1] = 0
+		for i := range remainder {
+			remainder[i] ^= qrGFMul(generator[i], factor)
+		}
+	}
+	return remainder
+}
+
+func (m *qrMatrix) drawFunctionPatterns(version int) {
+	for i := 0; i < m.size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	m.drawFinder(3, 3)
+	m.drawFinder(m.size-4, 3)
+	m.drawFinder(3, m.size-4)
+
+	if version >= 2 {
+		positions := qrAlignmentPositions[version]
+		last := len(positions) - 1
+		for i, y := range positions {
+			for j, x := range positions {
+				if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+					continue
+				}
+				for dy := -2; dy <= 2; dy++ {
+					for dx := -2; dx <= 2; dx++ {
+						m.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+					}
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; drawFormatBits fills them in per mask.
+	m.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a := m.size - 11 + i%3
+			b := i / 3
+			m.setFunction(a, b, dark)
+			m.setFunction(b, a, dark)
+		}
+	}
+}
+
+func (m *qrMatrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= m.size || y < 0 || y >= m.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			m.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (m *qrMatrix) drawFormatBits(mask int) {
+	// Level M has format bits 00.
+	data := mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(i))
+	}
+	m.setFunction(8, 7, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.size-15+i, bit(i))
+	}
+	m.setFunction(8, m.size-8, true)
+}
+
+func (m *qrMatrix) drawCodewords(codewords []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if !m.function[y][x] && i < len(codewords)*8 {
+					m.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (m *qrMatrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four mask evaluation rules of ISO 18004.
+func (m *qrMatrix) penalty() int {
+	n := m.size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return m.modules[x][y]
+		}
+		return m.modules[y][x]
+	}
+
+	score := 0
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			for x := 0; x+7 <= n; x++ {
+				match := true
+				for k, dark := range finder {
+					if at(x+k, y, transpose) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (qrLightRun(m, x-4, x, y, transpose) || qrLightRun(m, x+7, x+11, y, transpose)) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if m.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := m.modules[y][x]
+				if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := n * n
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	score += k * 10
+	return score
+}
+
+// qrLightRun reports whether modules [from, to) on the line are light, treating
+// positions outside the symbol as light (the quiet zone).
+func qrLightRun(m *qrMatrix, from, to, line int, transpose bool) bool {
+	for i := from; i < to; i++ {
+		if i < 0 || i >= m.size {
+			continue
+		}
+		dark := m.modules[line][i]
+		if transpose {
+			dark = m.modules[i][line]
+		}
+		if dark {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
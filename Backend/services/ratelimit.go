@@ -0,0 +1,164 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitIdleTTL         = 5 * time.Minute
+	rateLimitCleanupInterval = time.Minute
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a set of token buckets keyed by an arbitrary string such as a
+// client IP or a tab ID. Each key refills at rate tokens per second up to burst.
+// A limiter with a non-positive rate allows everything.
+type RateLimiter struct {
+	rate     float64
+	burst    float64
+	env      rateLimitEnv
+	buckets  map[string]*tokenBucket
+	mu       sync.Mutex
+	stopChan chan struct{}
+}
+
+// rateLimitEnv remembers where a limiter created by NewRateLimiterFromEnv
+// reads its settings, so ReloadFromEnv can read them again.
+type rateLimitEnv struct {
+	prefix       string
+	defaultRate  float64
+	defaultBurst float64
+}
+
+// NewRateLimiter creates a limiter and starts evicting idle buckets in the background.
+func NewRateLimiter(rate, burst float64) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	rl := &RateLimiter{
+		rate:     rate,
+		burst:    burst,
+		buckets:  make(map[string]*tokenBucket),
+		stopChan: make(chan struct{}),
+	}
+	rl.startCleanup()
+	return rl
+}
+
+// NewRateLimiterFromEnv creates a limiter from <prefix>_RPS and <prefix>_BURST,
+// falling back to the given defaults. Setting <prefix>_RPS=0 disables the limit.
+func NewRateLimiterFromEnv(prefix string, rate, burst float64) *RateLimiter {
+	env := rateLimitEnv{prefix: prefix, defaultRate: rate, defaultBurst: burst}
+	rl := NewRateLimiter(env.read())
+	rl.env = env
+	return rl
+}
+
+func (e rateLimitEnv) read() (float64, float64) {
+	rate, burst := e.defaultRate, e.defaultBurst
+	if v, err := strconv.ParseFloat(os.Getenv(e.prefix+"_RPS"), 64); err == nil {
+		rate = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv(e.prefix+"_BURST"), 64); err == nil {
+		burst = v
+	}
+	if rate > 0 {
+		LogInfo("[RATELIMIT] %s: %.1f req/s, burst %.0f", e.prefix, rate, burst)
+	}
+	return rate, burst
+}
+
+// ReloadFromEnv re-reads the settings of a limiter created by
+// NewRateLimiterFromEnv. Existing buckets keep their tokens.
+func (rl *RateLimiter) ReloadFromEnv() {
+	if rl == nil || rl.env.prefix == "" {
+		return
+	}
+	rl.SetLimits(rl.env.read())
+}
+
+// Limits returns the current rate (requests per second) and burst.
+func (rl *RateLimiter) Limits() (float64, float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.rate, rl.burst
+}
+
+// SetLimits changes the rate and burst; a rate of 0 disables limiting.
+// Existing buckets keep their tokens.
+func (rl *RateLimiter) SetLimits(rate, burst float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = rate
+	rl.burst = max(burst, 1)
+}
+
+// Allow takes one token from the bucket for key and reports whether one was available.
+func (rl *RateLimiter) Allow(key string) bool {
+	if rl == nil {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * rl.rate
+	if bucket.tokens > rl.burst {
+		bucket.tokens = rl.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (rl *RateLimiter) startCleanup() {
+	go func() {
+		defer CapturePanic()
+		ticker := time.NewTicker(rateLimitCleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				rl.evictIdle()
+			case <-rl.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (rl *RateLimiter) evictIdle() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for key, bucket := range rl.buckets {
+		if time.Since(bucket.last) > rateLimitIdleTTL {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func (rl *RateLimiter) Stop() {
+	close(rl.stopChan)
+}
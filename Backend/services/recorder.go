@@ -1,17 +1,84 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// ErrRecordingStopped is returned for chunks of a recording that was stopped
+// from the server; the extension stops capturing the tab when it sees it.
+var ErrRecordingStopped = errors.New("recording was stopped from the server")
+
+// ErrNotRecording is returned by Stop, Split and AddMarker for a tab that is
+// not being recorded.
+var ErrNotRecording = errors.New("tab is not being recorded")
+
+// ErrNoExtension is returned by Split when no extension listens for commands.
+var ErrNoExtension = errors.New("no extension is connected to the server")
+
+// SessionLimitError is returned for the first chunk of a recording while the
+// most simultaneous recordings the server allows are in progress.
+type SessionLimitError struct {
+	Limit int
+}
+
+func (e *SessionLimitError) Error() string {
+	return fmt.Sprintf("the server is already recording %d sessions, the most it allows at a time", e.Limit)
+}
+
+// commandBuffer is how many commands a slow subscriber may fall behind by
+// before further ones are dropped for it.
+const commandBuffer = 16
+
+// idleCheckInterval is how often sessions are checked for the idle timeout.
+const idleCheckInterval = 15 * time.Second
+
+// defaultIdleMinutes is how long a session may go without a chunk before it is
+// finished, unless SESSION_IDLE_MINUTES says otherwise.
+const defaultIdleMinutes = 10
+
+// RecorderCommand is an instruction for the extension, pushed over the events
+// channel.
+type RecorderCommand struct {
+	Type  string `json:"type"` // "start", "stop", "split" or "screenshot"
+	TabID int    `json:"tabId,omitempty"`
+	// ScheduleID, Name and URL say what a "start" command records: the
+	// extension opens URL in a new tab and reports the tab to the schedule.
+	ScheduleID string `json:"scheduleId,omitempty"`
+	Name       string `json:"name,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
 // SessionInfo holds information about an active recording session
 type SessionInfo struct {
 	TabID       int
 	Name        string
 	StartTime   time.Time
+	Timestamp   int64
 	BytesWritten int64
+	// LastChunk is when the most recent chunk arrived.
+	LastChunk time.Time
+	// Format is what the recording is saved as.
+	Format RecordingFormat
+	// Priority is PriorityNormal or PriorityHigh.
+	Priority string
+	// Source is what the recording is made of.
+	Source RecordingSource
+	// Segment is the number of the file the recording is written to; it
+	// grows with each split.
+	Segment int
+	// Markers is how many markers were added to the recording.
+	Markers int
+	// Group is the group of the recording, if any (see groups.go).
+	Group string
+
+	// writeFailed is set once a write failure has been sent as a webhook.
+	writeFailed bool
 }
 
 // RecorderService manages recording sessions and coordinates file writing and stats tracking
@@ -20,25 +87,95 @@ type RecorderService struct {
 	activeRecordings  sync.Map
 	stoppedRecordings sync.Map
 	stats             *Stats
+	timeSeries        *TimeSeriesStore
 	sessionInfo       sync.Map
+	notifier          *DesktopNotifier
+	webhooks          *WebhookDispatcher
+	hooks             *HookRunner
+	// remoteStops maps the tabs stopped by Stop to the timestamp of the
+	// recording that was stopped, until the extension confirms the stop.
+	remoteStops   sync.Map
+	subscribers   map[chan RecorderCommand]struct{}
+	subscribersMu sync.Mutex
+	idleTimeout   time.Duration
+	maxSessions   int
+	// recoveryPolicy is what Recover does (see recovery.go).
+	recoveryPolicy string
+	// groups holds the groups asked to be combined (see groups.go).
+	groups   map[string]*groupCombine
+	groupsMu sync.Mutex
+	// captures takes the screenshots of pages captured on the server (see
+	// screenshots.go).
+	captures *CaptureAgent
+	mu       sync.Mutex
+	stopChan chan struct{}
 }
 
 // NewRecorderService creates a new recorder service instance
-func NewRecorderService(fileWriter *FileWriterService, stats *Stats) *RecorderService {
+func NewRecorderService(fileWriter *FileWriterService, stats *Stats, timeSeries *TimeSeriesStore) *RecorderService {
 	return &RecorderService{
 		fileWriter:        fileWriter,
 		activeRecordings:  sync.Map{},
 		stoppedRecordings: sync.Map{},
 		stats:             stats,
+		timeSeries:        timeSeries,
 		sessionInfo:       sync.Map{},
+		subscribers:       make(map[chan RecorderCommand]struct{}),
+		groups:            make(map[string]*groupCombine),
+		stopChan:          make(chan struct{}),
+	}
+}
+
+// LoadMaxSessionsFromEnv returns how many recordings may run at a time,
+// MAX_SESSIONS (default 0, no limit).
+func LoadMaxSessionsFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_SESSIONS")); err == nil && v >= 0 {
+		return v
+	}
+	return 0
+}
+
+// LoadIdleTimeoutFromEnv returns how long a session may go without a chunk,
+// SESSION_IDLE_MINUTES (default 10); 0 disables the timeout.
+func LoadIdleTimeoutFromEnv() time.Duration {
+	minutes := float64(defaultIdleMinutes)
+	if v, err := strconv.ParseFloat(os.Getenv("SESSION_IDLE_MINUTES"), 64); err == nil && v >= 0 {
+		minutes = v
 	}
+	return time.Duration(minutes * float64(time.Minute))
+}
+
+// SetNotifier sets where recording started and stopped notifications go. It
+// must be called before recordings are received.
+func (rs *RecorderService) SetNotifier(notifier *DesktopNotifier) {
+	rs.notifier = notifier
+}
+
+// SetWebhooks sets where recording started, stopped and failed webhooks go. It
+// must be called before recordings are received.
+func (rs *RecorderService) SetWebhooks(webhooks *WebhookDispatcher) {
+	rs.webhooks = webhooks
+}
+
+// SetHooks sets the commands run when a recording starts and when a chunk
+// cannot be written. It must be called before recordings are received.
+func (rs *RecorderService) SetHooks(hooks *HookRunner) {
+	rs.hooks = hooks
 }
 
 // HandleRecording processes incoming recording data based on status.
 // For "stream" status, writes chunks to disk and tracks session info.
 // For "stopped" status, closes the file and cleans up session data.
-func (rs *RecorderService) HandleRecording(tabID int, name string, timestamp int64, data []byte, status string) error {
-	LogInfo("[RECORDER] HandleRecording called - TabID: %d, Name: %s, Status: %s, DataSize: %d",
+// format is what a new recording is saved as, priority its PriorityNormal
+// or PriorityHigh, source what it is made of, group the group it belongs
+// to, if any, and profile the profile whose directory and naming it is saved
+// with instead of the one the profile rules or the active profile give, if
+// any (see ProfileStore.Route).
+// sequence numbers data among the chunks of its file, or is 0 (see
+// WriteChunk). data is not kept once HandleRecording returns.
+// ctx carries the request ID used to correlate log lines with the caller.
+func (rs *RecorderService) HandleRecording(ctx context.Context, tabID int, name string, timestamp, sequence int64, data []byte, status string, format RecordingFormat, priority string, source RecordingSource, group, profile string) error {
+	LogInfoCtx(ctx, "[RECORDER] HandleRecording called - TabID: %d, Name: %s, Status: %s, DataSize: %d",
 		tabID, name, status, len(data))
 	
 	switch status {
@@ -46,57 +183,378 @@ func (rs *RecorderService) HandleRecording(tabID int, name string, timestamp int
 		if _, stopped := rs.stoppedRecordings.Load(tabID); stopped {
 			return fmt.Errorf("recording already stopped for tab %d", tabID)
 		}
+		if stoppedAt, ok := rs.remoteStops.Load(tabID); ok {
+			if stoppedAt.(int64) == timestamp {
+				return ErrRecordingStopped
+			}
+			// A new recording in the same tab
+			rs.remoteStops.Delete(tabID)
+		}
 		
 		if _, exists := rs.activeRecordings.Load(tabID); !exists {
-			rs.stats.IncrementSession()
-			rs.sessionInfo.Store(tabID, &SessionInfo{
+			// A recording interrupted by a restart of the server continues
+			// in the file it was being written to.
+			resumed, isResumed := rs.fileWriter.Resumable(tabID, timestamp)
+			startTime := time.Now()
+			if isResumed {
+				startTime = resumed.StartedAt
+			}
+			isNew, err := rs.admit(&SessionInfo{
 				TabID:        tabID,
 				Name:         name,
-				StartTime:    time.Now(),
-				BytesWritten: 0,
+				StartTime:    startTime,
+				Timestamp:    timestamp,
+				BytesWritten: resumed.Size,
+				LastChunk:    time.Now(),
+				Format:       format,
+				Priority:     priority,
+				Source:       source,
+				Segment:      1,
+				Group:        group,
 			})
-			LogInfo("[RECORDER] New recording session started for tab %d", tabID)
+			if err != nil {
+				LogErrorCtx(ctx, "[RECORDER] Rejected new recording for tab %d: %v", tabID, err)
+				return err
+			}
+			switch {
+			case !isNew:
+				// A parallel chunk started the recording
+			case isResumed:
+				LogInfoCtx(ctx, "[RECORDER] Resumed recording session for tab %d into %s", tabID, resumed.Path)
+			default:
+				rs.stats.IncrementSession()
+				LogInfoCtx(ctx, "[RECORDER] New recording session started for tab %d", tabID)
+				rs.notifier.Send(NotifyRecordingStarted, "Recording started", fmt.Sprintf("Recording %s (tab %d)", name, tabID))
+				started := WebhookRecording{TabID: tabID, Name: name, StartedAt: &startTime}
+				rs.webhooks.Send(WebhookRecordingStarted, started)
+				rs.hooks.Run(HookOnStart, started)
+			}
 		}
 		
 		rs.activeRecordings.Store(tabID, true)
 		
-		if err := rs.fileWriter.WriteChunk(tabID, name, timestamp, data); err != nil {
-			LogError("[RECORDER] Failed to write chunk for tab %d: %v", tabID, err)
+		if err := rs.fileWriter.WriteChunk(tabID, name, timestamp, sequence, data, format, priority == PriorityHigh, source, group, profile); err != nil {
+			LogErrorCtx(ctx, "[RECORDER] Failed to write chunk for tab %d: %v", tabID, err)
+			failed := WebhookRecording{TabID: tabID, Name: name, Error: err.Error()}
+			if info := rs.GetSessionInfo(tabID); info != nil {
+				failed.StartedAt, failed.Bytes = &info.StartTime, info.BytesWritten
+				if !info.writeFailed {
+					info.writeFailed = true
+					rs.webhooks.Send(WebhookRecordingFailed, failed)
+				}
+			}
+			rs.hooks.Run(HookOnChunkError, failed)
 			return fmt.Errorf("failed to write recording chunk: %w", err)
 		}
 		
 		if info, ok := rs.sessionInfo.Load(tabID); ok {
 			sessionInfo, ok := info.(*SessionInfo)
 			if !ok {
-				LogError("[RECORDER] Invalid session type for tab %d", tabID)
+				LogErrorCtx(ctx, "[RECORDER] Invalid session type for tab %d", tabID)
 				return fmt.Errorf("invalid session type")
 			}
+			rs.mu.Lock()
 			sessionInfo.BytesWritten += int64(len(data))
+			sessionInfo.LastChunk = time.Now()
+			// A new segment starts with a new timestamp
+			sessionInfo.Timestamp = timestamp
+			rs.mu.Unlock()
 		}
+		rs.timeSeries.Record(tabID, int64(len(data)))
 		
 		return nil
 
+	case "split":
+		return rs.endSegment(ctx, tabID)
+
 	case "stopped":
-		rs.stoppedRecordings.Store(tabID, true)
-		rs.activeRecordings.Delete(tabID)
-		rs.sessionInfo.Delete(tabID)
-		LogInfo("[RECORDER] Removed tab %d from active recordings", tabID)
-		
-		if err := rs.fileWriter.CloseFile(tabID); err != nil {
-			LogError("[RECORDER] Failed to close file for tab %d: %v", tabID, err)
-			return fmt.Errorf("failed to stop recording: %w", err)
-		}
-		LogInfo("[RECORDER] ✅ Recording stopped successfully for tab %d", tabID)
-		
-		rs.stoppedRecordings.Delete(tabID)
-		return nil
+		rs.remoteStops.Delete(tabID)
+		return rs.finish(ctx, tabID, "")
 
 	default:
-		LogError("[RECORDER] Unknown status received: %s", status)
+		LogErrorCtx(ctx, "[RECORDER] Unknown status received: %s", status)
 		return fmt.Errorf("unknown status: %s", status)
 	}
 }
 
+// finish ends the recording of tabID and closes its file. status is recorded
+// with the file in the history; it is empty for a recording that ended
+// normally.
+func (rs *RecorderService) finish(ctx context.Context, tabID int, status string) error {
+	rs.stoppedRecordings.Store(tabID, true)
+	rs.activeRecordings.Delete(tabID)
+	group := ""
+	if info, ok := rs.sessionInfo.LoadAndDelete(tabID); ok {
+		if sessionInfo, ok := info.(*SessionInfo); ok {
+			group = sessionInfo.Group
+			title := "Recording stopped"
+			if status == RecordingTimedOut {
+				title = "Recording timed out"
+			}
+			rs.notifier.Send(NotifyRecordingStopped, title, fmt.Sprintf("%s (tab %d) recorded for %s",
+				sessionInfo.Name, tabID, time.Since(sessionInfo.StartTime).Round(time.Second)))
+			rs.webhooks.Send(WebhookRecordingStopped, WebhookRecording{
+				TabID:           tabID,
+				Name:            sessionInfo.Name,
+				StartedAt:       &sessionInfo.StartTime,
+				DurationSeconds: time.Since(sessionInfo.StartTime).Seconds(),
+				Bytes:           sessionInfo.BytesWritten,
+				Status:          status,
+			})
+		}
+	}
+	rs.timeSeries.EndSession(tabID)
+	LogInfoCtx(ctx, "[RECORDER] Removed tab %d from active recordings", tabID)
+
+	err := rs.fileWriter.CloseFile(tabID, status)
+	rs.fileWriter.EndLive(tabID)
+	rs.groupFinished(group)
+	if err != nil {
+		LogErrorCtx(ctx, "[RECORDER] Failed to close file for tab %d: %v", tabID, err)
+		return fmt.Errorf("failed to stop recording: %w", err)
+	}
+	LogInfoCtx(ctx, "[RECORDER] ✅ Recording stopped successfully for tab %d", tabID)
+
+	rs.stoppedRecordings.Delete(tabID)
+	return nil
+}
+
+// StopAll stops every active recording with Stop, so that the files are
+// finished and post-processed and the extension stops capturing the tabs. It
+// returns how many recordings it stopped.
+func (rs *RecorderService) StopAll(ctx context.Context) int {
+	stopped := 0
+	for _, tabID := range rs.GetActiveRecordings() {
+		if err := rs.Stop(ctx, tabID); errors.Is(err, ErrNotRecording) {
+			continue
+		} else if err != nil {
+			LogErrorCtx(ctx, "[RECORDER] Failed to stop recording for tab %d: %v", tabID, err)
+			continue
+		}
+		stopped++
+	}
+	return stopped
+}
+
+// Stop stops the recording of tabID from the server, e.g. from the UI, and
+// finishes its file. A "stop" command tells subscribed extensions to stop
+// capturing the tab; others learn of it from the ErrRecordingStopped their
+// next chunk gets.
+func (rs *RecorderService) Stop(ctx context.Context, tabID int) error {
+	info := rs.GetSessionInfo(tabID)
+	if info == nil || !rs.IsRecording(tabID) {
+		return ErrNotRecording
+	}
+	rs.remoteStops.Store(tabID, info.Timestamp)
+	rs.publish(RecorderCommand{Type: "stop", TabID: tabID})
+	if err := rs.finish(ctx, tabID, ""); err != nil {
+		return err
+	}
+	LogInfoCtx(ctx, "[RECORDER] Recording for tab %d stopped from the server", tabID)
+	return nil
+}
+
+// Split asks the extension to finish the current segment of the recording of
+// tabID and go on recording the tab into a new file, e.g. between the items
+// of a meeting. The extension ends the segment with a "split" chunk once its
+// last data is sent.
+func (rs *RecorderService) Split(ctx context.Context, tabID int) error {
+	if !rs.IsRecording(tabID) {
+		return ErrNotRecording
+	}
+	if rs.publish(RecorderCommand{Type: "split", TabID: tabID}) == 0 {
+		return ErrNoExtension
+	}
+	LogInfoCtx(ctx, "[RECORDER] Asked the extension to split the recording of tab %d", tabID)
+	return nil
+}
+
+// AddMarker marks the moment at of the recording of tabID with label, e.g. a
+// highlight, and returns the marker. Markers are saved in the sidecar of the
+// file the recording is being written to.
+func (rs *RecorderService) AddMarker(ctx context.Context, tabID int, label string, at time.Time) (Marker, error) {
+	info := rs.GetSessionInfo(tabID)
+	if info == nil || !rs.IsRecording(tabID) {
+		return Marker{}, ErrNotRecording
+	}
+	marker, err := rs.fileWriter.AddMarker(tabID, label, at)
+	if err != nil {
+		return Marker{}, err
+	}
+	rs.mu.Lock()
+	info.Markers++
+	rs.mu.Unlock()
+	LogInfoCtx(ctx, "[RECORDER] Marked %q in the recording of tab %d", marker.Label, tabID)
+	return marker, nil
+}
+
+// Preview returns the live preview of the recording of tabID, or nil when it
+// is not being recorded or has no preview, e.g. until a recording resumed
+// after a restart of the server is split.
+func (rs *RecorderService) Preview(tabID int) *LivePreview {
+	if !rs.IsRecording(tabID) {
+		return nil
+	}
+	return rs.fileWriter.Preview(tabID)
+}
+
+// IsLive reports whether the recording of tabID is being streamed live over
+// HLS.
+func (rs *RecorderService) IsLive(tabID int) bool {
+	return rs.IsRecording(tabID) && rs.fileWriter.live.Active(tabID)
+}
+
+// endSegment finishes the file of the current segment of the recording of
+// tabID. The recording goes on in a new file with the next chunk, which
+// carries the timestamp of the new segment.
+func (rs *RecorderService) endSegment(ctx context.Context, tabID int) error {
+	info := rs.GetSessionInfo(tabID)
+	if info == nil {
+		LogInfoCtx(ctx, "[RECORDER] Ignoring split of tab %d, which is not being recorded", tabID)
+		return nil
+	}
+	if err := rs.fileWriter.CloseFile(tabID, ""); err != nil {
+		LogErrorCtx(ctx, "[RECORDER] Failed to close segment of tab %d: %v", tabID, err)
+		return fmt.Errorf("failed to split recording: %w", err)
+	}
+	rs.mu.Lock()
+	info.Segment++
+	segment := info.Segment
+	rs.mu.Unlock()
+	LogInfoCtx(ctx, "[RECORDER] Split the recording of tab %d, segment %d follows", tabID, segment)
+	return nil
+}
+
+// admit starts the recording session, unless the limit of simultaneous
+// recordings is reached, and reports whether it is new. Parallel first chunks
+// of a recording start it once.
+func (rs *RecorderService) admit(session *SessionInfo) (bool, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, exists := rs.activeRecordings.Load(session.TabID); exists {
+		return false, nil
+	}
+	if rs.maxSessions > 0 && len(rs.GetActiveRecordings()) >= rs.maxSessions {
+		return false, &SessionLimitError{Limit: rs.maxSessions}
+	}
+	rs.sessionInfo.Store(session.TabID, session)
+	rs.activeRecordings.Store(session.TabID, true)
+	return true, nil
+}
+
+// SetMaxSessions sets how many recordings may run at a time; 0 removes the
+// limit. Recordings in progress are not stopped when it is lowered.
+func (rs *RecorderService) SetMaxSessions(limit int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.maxSessions = limit
+}
+
+// MaxSessions returns the limit set by SetMaxSessions.
+func (rs *RecorderService) MaxSessions() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.maxSessions
+}
+
+// SetIdleTimeout sets how long a session may go without a chunk before it is
+// finished as timed out; 0 disables the timeout.
+func (rs *RecorderService) SetIdleTimeout(timeout time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.idleTimeout = timeout
+}
+
+// IdleTimeout returns the timeout set by SetIdleTimeout.
+func (rs *RecorderService) IdleTimeout() time.Duration {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.idleTimeout
+}
+
+// StartIdleCheck begins finishing idle sessions in the background, so that a
+// file is not left open forever when the browser crashes mid-recording.
+func (rs *RecorderService) StartIdleCheck() {
+	go func() {
+		defer CapturePanic()
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				rs.expireIdle(context.Background())
+			case <-rs.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// StopIdleCheck stops the background check started by StartIdleCheck.
+func (rs *RecorderService) StopIdleCheck() {
+	close(rs.stopChan)
+}
+
+// expireIdle finishes the sessions that have gone without a chunk for longer
+// than the idle timeout. Like Stop, it tells the extension to stop the tab in
+// case it is still alive, and rejects its further chunks.
+func (rs *RecorderService) expireIdle(ctx context.Context) {
+	timeout := rs.IdleTimeout()
+	if timeout <= 0 {
+		return
+	}
+	for _, info := range rs.GetAllSessionInfo() {
+		idle := time.Since(info.LastChunk)
+		if idle <= timeout || !rs.IsRecording(info.TabID) {
+			continue
+		}
+		LogInfoCtx(ctx, "[RECORDER] No data for tab %d (%s) for %s, finishing the recording",
+			info.TabID, info.Name, idle.Round(time.Second))
+		rs.remoteStops.Store(info.TabID, info.Timestamp)
+		rs.publish(RecorderCommand{Type: "stop", TabID: info.TabID})
+		if err := rs.finish(ctx, info.TabID, RecordingTimedOut); err != nil {
+			LogErrorCtx(ctx, "[RECORDER] Failed to finish idle recording for tab %d: %v", info.TabID, err)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the commands for the extension,
+// and a function that ends the subscription.
+func (rs *RecorderService) Subscribe() (<-chan RecorderCommand, func()) {
+	ch := make(chan RecorderCommand, commandBuffer)
+	rs.subscribersMu.Lock()
+	rs.subscribers[ch] = struct{}{}
+	rs.subscribersMu.Unlock()
+	return ch, func() {
+		rs.subscribersMu.Lock()
+		delete(rs.subscribers, ch)
+		rs.subscribersMu.Unlock()
+	}
+}
+
+// RequestStart asks the extension to open url in a new tab and record it as
+// name for a schedule. It returns how many subscribers the command reached.
+func (rs *RecorderService) RequestStart(scheduleID, name, url string) int {
+	return rs.publish(RecorderCommand{Type: "start", ScheduleID: scheduleID, Name: name, URL: url})
+}
+
+// publish sends cmd to every subscriber and returns how many it reached.
+func (rs *RecorderService) publish(cmd RecorderCommand) int {
+	rs.subscribersMu.Lock()
+	defer rs.subscribersMu.Unlock()
+	sent := 0
+	for ch := range rs.subscribers {
+		select {
+		case ch <- cmd:
+			sent++
+		default:
+			LogError("[RECORDER] Dropped %s command for tab %d: subscriber is not reading", cmd.Type, cmd.TabID)
+		}
+	}
+	return sent
+}
+
 // GetActiveRecordings returns a list of all currently active recording tab IDs
 func (rs *RecorderService) GetActiveRecordings() []int {
 	var recordings []int
@@ -107,6 +565,16 @@ func (rs *RecorderService) GetActiveRecordings() []int {
 	return recordings
 }
 
+// GetStats returns the persistent stats shared with the file writer
+func (rs *RecorderService) GetStats() *Stats {
+	return rs.stats
+}
+
+// GetTimeSeries returns the ingest throughput store
+func (rs *RecorderService) GetTimeSeries() *TimeSeriesStore {
+	return rs.timeSeries
+}
+
 // IsRecording checks if a given tab ID has an active recording
 func (rs *RecorderService) IsRecording(tabID int) bool {
 	_, exists := rs.activeRecordings.Load(tabID)
@@ -122,6 +590,20 @@ func (rs *RecorderService) GetSessionInfo(tabID int) *SessionInfo {
 	return nil
 }
 
+// SessionInfoCopies returns copies of the session information of all active
+// recordings, taken under the lock HandleRecording updates it with.
+func (rs *RecorderService) SessionInfoCopies() []SessionInfo {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var sessions []SessionInfo
+	for _, info := range rs.GetAllSessionInfo() {
+		if info != nil {
+			sessions = append(sessions, *info)
+		}
+	}
+	return sessions
+}
+
 // GetAllSessionInfo retrieves session information for all active recordings
 func (rs *RecorderService) GetAllSessionInfo() []*SessionInfo {
 	var sessions []*SessionInfo
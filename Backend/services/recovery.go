@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Recovery policies say what the server does with a recording when the
+// extension reports that it recovered from a crash while recording the tab.
+const (
+	// RecoveryResume goes on with the session of the recording: its file is
+	// finished as at a split, and the session continues in a new file linked
+	// to it.
+	RecoveryResume = "resume"
+	// RecoveryContinue finishes the recording as interrupted, and the
+	// extension starts a new one in a file linked to it.
+	RecoveryContinue = "continue"
+	// RecoveryStop finishes the recording as interrupted, and the extension
+	// does not record the tab again.
+	RecoveryStop = "stop"
+)
+
+// RecoveryNew is the action for a tab the server knows no recording of; the
+// extension records it again as a new recording.
+const RecoveryNew = "new"
+
+// RecoveryPolicies are the values of RECOVERY_POLICY.
+var RecoveryPolicies = []string{RecoveryResume, RecoveryContinue, RecoveryStop}
+
+// RecoveryDecision tells the extension what to do with a tab it was recording
+// when it crashed.
+type RecoveryDecision struct {
+	// Action is the recovery policy applied, or RecoveryNew.
+	Action string `json:"action"`
+	// Name is what the extension records the tab as again.
+	Name string `json:"name,omitempty"`
+	// ContinuesFrom is the file of the interrupted recording, which the new
+	// file is linked to.
+	ContinuesFrom string `json:"continuesFrom,omitempty"`
+}
+
+// IsRecoveryPolicy reports whether policy is one of RecoveryPolicies.
+func IsRecoveryPolicy(policy string) bool {
+	for _, p := range RecoveryPolicies {
+		if policy == p {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRecoveryPolicyFromEnv returns what to do with recordings interrupted by
+// a crash of the extension, RECOVERY_POLICY (default resume).
+func LoadRecoveryPolicyFromEnv() string {
+	if policy := strings.ToLower(os.Getenv("RECOVERY_POLICY")); IsRecoveryPolicy(policy) {
+		return policy
+	}
+	return RecoveryResume
+}
+
+// SetRecoveryPolicy sets what Recover does with interrupted recordings.
+func (rs *RecorderService) SetRecoveryPolicy(policy string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.recoveryPolicy = policy
+}
+
+// RecoveryPolicy returns the policy set by SetRecoveryPolicy.
+func (rs *RecorderService) RecoveryPolicy() string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.recoveryPolicy == "" {
+		return RecoveryResume
+	}
+	return rs.recoveryPolicy
+}
+
+// Recover decides, by the recovery policy, what happens to the recording of
+// tabID after the extension reported that it recovered from a crash while
+// recording the tab, and gets the server ready for it. A recording that is no
+// longer in progress on the server, e.g. one that timed out or was resumed
+// after a restart of the server, cannot be resumed and is continued instead.
+func (rs *RecorderService) Recover(ctx context.Context, tabID int) (RecoveryDecision, error) {
+	info := rs.GetSessionInfo(tabID)
+	recording := info != nil && rs.IsRecording(tabID)
+	previous, name, open := rs.fileWriter.openFile(tabID)
+	if recording {
+		name = info.Name
+	}
+	if !recording && !open {
+		LogInfoCtx(ctx, "[RECORDER] The extension recovered tab %d, which has no recording to go on with", tabID)
+		return RecoveryDecision{Action: RecoveryNew}, nil
+	}
+
+	decision := RecoveryDecision{Action: rs.RecoveryPolicy(), Name: name}
+	if previous != "" {
+		decision.ContinuesFrom = filepath.Base(previous)
+	}
+	if decision.Action == RecoveryResume && !recording {
+		decision.Action = RecoveryContinue
+	}
+	switch {
+	case decision.Action == RecoveryResume:
+		if err := rs.endSegment(ctx, tabID); err != nil {
+			return RecoveryDecision{}, err
+		}
+		rs.mu.Lock()
+		// The extension needs a moment to capture the tab again
+		info.LastChunk = time.Now()
+		rs.mu.Unlock()
+	case recording:
+		if err := rs.finish(ctx, tabID, RecordingInterrupted); err != nil {
+			return RecoveryDecision{}, err
+		}
+	default:
+		// The file of a recording resumed after a restart of the server is
+		// left as it is.
+		rs.fileWriter.forgetOpen(tabID)
+	}
+	if decision.Action == RecoveryStop {
+		decision.Name = ""
+	} else if previous != "" {
+		rs.fileWriter.continuations.Store(tabID, previous)
+	}
+	LogInfoCtx(ctx, "[RECORDER] The extension recovered tab %d from a crash, recording policy %s after %s", tabID, decision.Action, previous)
+	return decision, nil
+}
+
+// openFile returns the path of the file the recording of tabID is being
+// written to, or that an interrupted recording of it was, and the name of the
+// recording.
+func (fws *FileWriterService) openFile(tabID int) (path, name string, ok bool) {
+	if val, ok := fws.activeFiles.Load(tabID); ok {
+		handle := val.(*fileHandle)
+		if filename, ok := fws.filenameMap.Load(tabID); ok {
+			path, _ = filepath.Abs(filename.(string))
+			return path, handle.name, true
+		}
+	}
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	recording, ok := fws.journal[tabID]
+	return recording.Path, recording.Name, ok
+}
+
+// continuationName is the base name of a file that carries on the recording
+// saved as previous, e.g. meeting-continued for meeting.webm.
+func continuationName(previous string) string {
+	base := strings.TrimSuffix(previous, filepath.Ext(previous))
+	return strings.TrimSuffix(base, "-continued") + "-continued"
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ffmpegLocations are the folders FFmpeg is commonly installed to that may
+// not be on the PATH of the server, e.g. the one of Homebrew when the server
+// was started from the Dock.
+func ffmpegLocations() []string {
+	var dirs []string
+	if dir, err := ManagedFFmpegDir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	switch runtime.GOOS {
+	case "windows":
+		dirs = append(dirs, windowsFFmpegDirs()...)
+		dirs = append(dirs, `C:\ffmpeg\bin`)
+		if programFiles := os.Getenv("ProgramFiles"); programFiles != "" {
+			dirs = append(dirs, filepath.Join(programFiles, "ffmpeg", "bin"))
+		}
+	case "darwin":
+		dirs = append(dirs, "/opt/homebrew/bin", "/usr/local/bin", "/opt/local/bin")
+	default:
+		dirs = append(dirs, "/usr/local/bin", "/usr/bin", "/snap/bin")
+		if home, err := os.UserHomeDir(); err == nil {
+			dirs = append(dirs, filepath.Join(home, ".local", "bin"), filepath.Join(home, "bin"))
+		}
+	}
+	return dirs
+}
+
+// RescanPath brings the PATH of the server up to date after programs were
+// installed while it runs: it adds the folders of the PATH a new login would
+// get and the folders of ffmpegLocations that exist, after those already on
+// it, and returns the folders it added.
+func RescanPath() []string {
+	current := filepath.SplitList(os.Getenv("PATH"))
+	seen := make(map[string]bool)
+	key := func(dir string) string {
+		dir = filepath.Clean(dir)
+		if runtime.GOOS == "windows" {
+			return strings.ToLower(dir)
+		}
+		return dir
+	}
+	for _, dir := range current {
+		seen[key(dir)] = true
+	}
+
+	var added []string
+	for _, dir := range append(loginPath(), ffmpegLocations()...) {
+		if dir == "" || seen[key(dir)] {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		seen[key(dir)] = true
+		added = append(added, dir)
+	}
+	if len(added) > 0 {
+		os.Setenv("PATH", strings.Join(append(current, added...), string(os.PathListSeparator)))
+		LogInfo("[DEPENDENCIES] Added to the PATH: %s", strings.Join(added, ", "))
+	}
+	return added
+}
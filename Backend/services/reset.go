@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FactoryResetConfirmation must accompany a factory reset request, so that
+// one is never triggered by accident.
+const FactoryResetConfirmation = "RESET"
+
+// resetConfigFiles are what a factory reset removes from the config
+// directory: settings, profiles, schedules, the session journal and history,
+// scoped tokens, the UI password, the last port and the generated TLS
+// certificates and client CA. A config file written by the administrator is left alone.
+var resetConfigFiles = []string{"settings.json", "profiles.json", "schedules.json", "sessions.json", "history.json", "tokens.json", "ui_password", lastPortFile, "tls"}
+
+// FactoryResetReport lists what FactoryReset removed.
+type FactoryResetReport struct {
+	Removed           []string `json:"removed"`
+	RecordingsDeleted int      `json:"recordingsDeleted"`
+	KeptRecordings    bool     `json:"keptRecordings"`
+}
+
+// FactoryReset removes the settings, tokens, stats and profiles kept in
+// configDir and the secret store, and with keepRecordings false also the
+// recordings in every profile's directory. Only recording files are deleted,
+// never the directories, which may hold other files. The running server
+// still has the old state in memory and must be restarted afterwards.
+func FactoryReset(configDir string, secrets SecretStore, stats *Stats, profiles *ProfileStore, keepRecordings bool) (FactoryResetReport, error) {
+	report := FactoryResetReport{Removed: []string{}, KeptRecordings: keepRecordings}
+
+	if !keepRecordings {
+		list, _ := profiles.List()
+		seen := make(map[string]bool)
+		for _, profile := range list {
+			if seen[profile.RecordingsDir] {
+				continue
+			}
+			seen[profile.RecordingsDir] = true
+			recordings, err := ListRecordings(profile.RecordingsDir)
+			if err != nil {
+				continue
+			}
+			for _, rec := range recordings {
+				if err := RemoveRecording(rec.Path); err != nil {
+					return report, fmt.Errorf("failed to delete recording %s: %w", rec.Path, err)
+				}
+				report.RecordingsDeleted++
+			}
+		}
+	}
+
+	for _, name := range resetConfigFiles {
+		path := filepath.Join(configDir, name)
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return report, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		report.Removed = append(report.Removed, path)
+	}
+	if err := secrets.Delete(apiTokenSecret); err != nil {
+		return report, fmt.Errorf("failed to remove API token: %w", err)
+	}
+	report.Removed = append(report.Removed, apiTokenSecret)
+	for key := range secretConfigKeys {
+		if err := secrets.Delete(settingSecretName(key)); err != nil {
+			return report, fmt.Errorf("failed to remove setting %s: %w", key, err)
+		}
+	}
+	if err := stats.Reset(); err != nil {
+		return report, err
+	}
+	report.Removed = append(report.Removed, stats.filePath)
+
+	LogInfo("[RESET] Factory reset removed %d items and %d recordings", len(report.Removed), report.RecordingsDeleted)
+	return report, nil
+}
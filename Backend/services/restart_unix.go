@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// restartExecutable replaces the current process, keeping its PID so service
+// managers do not notice the restart.
+func restartExecutable(executable string) error {
+	if err := syscall.Exec(executable, os.Args, os.Environ()); err != nil {
+		return fmt.Errorf("failed to restart: %w", err)
+	}
+	return nil
+}
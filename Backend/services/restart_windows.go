@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// restartExecutable starts a new process; the caller must exit so that it
+// does not hold the port the new process is about to bind.
+func restartExecutable(executable string) error {
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to restart: %w", err)
+	}
+	return nil
+}
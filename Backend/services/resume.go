@@ -0,0 +1,254 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// resumeWindow is how long after its last write an interrupted recording can
+// still be resumed when the server starts again.
+const resumeWindow = time.Hour
+
+// ResumableRecording is a recording whose file is still open, kept in the
+// session journal so that it can be resumed into the same file when the
+// extension sends more of it after the server restarted.
+type ResumableRecording struct {
+	TabID     int       `json:"tabId"`
+	Timestamp int64     `json:"timestamp"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	StartedAt time.Time `json:"startedAt"`
+	// Markers are those added to the file so far.
+	Markers []Marker `json:"markers,omitempty"`
+	// Screenshots are those taken for the file so far.
+	Screenshots []Screenshot `json:"screenshots,omitempty"`
+	// Source is what the recording is made of.
+	Source RecordingSource `json:"source,omitzero"`
+	// Parts are the files before Path of a recording continued in new files
+	// at the size limit.
+	Parts []string `json:"parts,omitempty"`
+	// ContinuesFrom is the file name of the recording this one carries on
+	// after a crash of the extension.
+	ContinuesFrom string `json:"continuesFrom,omitempty"`
+	// Group is the group of the recording, if any.
+	Group string `json:"group,omitempty"`
+	// Profile is the profile the file was created with.
+	Profile string `json:"profile,omitempty"`
+	// Size is how much of the recording the file holds; it is not saved.
+	Size int64 `json:"-"`
+}
+
+// LoadSessionJournal reads the recordings that were still being written when
+// the server stopped from path, and keeps the journal there from now on.
+// Recordings whose file is gone or was last written more than an hour ago
+// are left as they are and no longer resumed.
+func (fws *FileWriterService) LoadSessionJournal(path string) error {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.journalPath = path
+	fws.journal = make(map[int]ResumableRecording)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read session journal: %w", err)
+	}
+	var recordings []ResumableRecording
+	if err := json.Unmarshal(data, &recordings); err != nil {
+		return fmt.Errorf("failed to parse session journal: %w", err)
+	}
+	for _, recording := range recordings {
+		info, err := os.Stat(recording.Path)
+		if err != nil || time.Since(info.ModTime()) > resumeWindow {
+			LogInfo("[FILEWRITER] Interrupted recording %s can no longer be resumed", recording.Path)
+			continue
+		}
+		fws.journal[recording.TabID] = recording
+		LogInfo("[FILEWRITER] Interrupted recording %s can be resumed", recording.Path)
+	}
+	return fws.saveJournalLocked()
+}
+
+// Resumable returns the interrupted recording that a chunk of tabID with
+// timestamp continues, if there is one.
+func (fws *FileWriterService) Resumable(tabID int, timestamp int64) (ResumableRecording, bool) {
+	fws.mu.Lock()
+	recording, ok := fws.journal[tabID]
+	fws.mu.Unlock()
+	if !ok || recording.Timestamp != timestamp {
+		return ResumableRecording{}, false
+	}
+	if _, active := fws.activeFiles.Load(tabID); active {
+		return ResumableRecording{}, false
+	}
+	info, err := os.Stat(recording.Path)
+	if err != nil {
+		return ResumableRecording{}, false
+	}
+	recording.Size = info.Size()
+	return recording, true
+}
+
+// resumeFile reopens the file of an interrupted recording of tabID for
+// appending, with the priority high. ok is false when there is none to resume for timestamp; an
+// interrupted recording of another timestamp is forgotten, since the tab has
+// started a new one.
+func (fws *FileWriterService) resumeFile(tabID int, timestamp int64, high bool) (handle *fileHandle, ok bool) {
+	fws.mu.Lock()
+	recording, found := fws.journal[tabID]
+	fws.mu.Unlock()
+	if !found {
+		return nil, false
+	}
+	if recording.Timestamp != timestamp {
+		fws.forgetOpen(tabID)
+		return nil, false
+	}
+
+	file, err := os.OpenFile(recording.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		LogError("[FILEWRITER] Failed to resume %s, starting a new file: %v", recording.Path, err)
+		fws.forgetOpen(tabID)
+		return nil, false
+	}
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	fws.mu.Lock()
+	maxFileSize := fws.maxFileSize
+	fws.mu.Unlock()
+	fws.filenameMap.Store(tabID, recording.Path)
+	LogInfo("[FILEWRITER] Resumed recording: %s", recording.Path)
+	handle = fws.newFileHandle(tabID, file, recording.Name, timestamp, high)
+	handle.markers = recording.Markers
+	handle.screenshots = recording.Screenshots
+	if len(recording.Screenshots) > 0 {
+		handle.poster = recording.Screenshots[0].File
+	}
+	handle.source = recording.Source
+	handle.continuesFrom = recording.ContinuesFrom
+	handle.group = recording.Group
+	handle.profile = recording.Profile
+	handle.rollover = resumeFileRollover(maxFileSize, recording, size)
+	// What was written before the restart is on disk
+	handle.received = size + filesSize(recording.Parts)
+	handle.resumed = true
+	// The extension numbers on from wherever it was
+	handle.order.next = 0
+	if len(recording.Parts) > 0 {
+		handle.partStart = recording.StartedAt.UnixMilli()
+	}
+	return handle, true
+}
+
+// rememberOpen adds the file a recording was started in to the journal.
+func (fws *FileWriterService) rememberOpen(tabID int, name string, timestamp int64, filename string, source RecordingSource, continuesFrom, group, profile string) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	if fws.journal == nil {
+		return
+	}
+	path, _ := filepath.Abs(filename)
+	fws.journal[tabID] = ResumableRecording{TabID: tabID, Timestamp: timestamp, Name: name, Path: path, StartedAt: time.Now(), Source: source, ContinuesFrom: continuesFrom, Group: group, Profile: profile}
+	if err := fws.saveJournalLocked(); err != nil {
+		LogError("[FILEWRITER] Failed to save session journal: %v", err)
+	}
+}
+
+// rememberPart changes the file of tabID in the journal to filename, the new
+// part of the recording after parts.
+func (fws *FileWriterService) rememberPart(tabID int, filename string, parts []string) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	recording, ok := fws.journal[tabID]
+	if !ok {
+		return
+	}
+	recording.Path, _ = filepath.Abs(filename)
+	recording.Parts = append([]string(nil), parts...)
+	recording.StartedAt = time.Now()
+	recording.Markers = nil
+	recording.Screenshots = nil
+	fws.journal[tabID] = recording
+	if err := fws.saveJournalLocked(); err != nil {
+		LogError("[FILEWRITER] Failed to save session journal: %v", err)
+	}
+}
+
+// rememberMarkers saves the markers of the file of tabID in the journal, so
+// that they are kept when the recording is resumed.
+func (fws *FileWriterService) rememberMarkers(tabID int, markers []Marker) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	recording, ok := fws.journal[tabID]
+	if !ok {
+		return
+	}
+	recording.Markers = markers
+	fws.journal[tabID] = recording
+	if err := fws.saveJournalLocked(); err != nil {
+		LogError("[FILEWRITER] Failed to save session journal: %v", err)
+	}
+}
+
+// rememberScreenshots saves the screenshots of the file of tabID in the
+// journal, like rememberMarkers.
+func (fws *FileWriterService) rememberScreenshots(tabID int, screenshots []Screenshot) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	recording, ok := fws.journal[tabID]
+	if !ok {
+		return
+	}
+	recording.Screenshots = screenshots
+	fws.journal[tabID] = recording
+	if err := fws.saveJournalLocked(); err != nil {
+		LogError("[FILEWRITER] Failed to save session journal: %v", err)
+	}
+}
+
+// forgetOpen removes the recording of tabID from the journal once its file is
+// finished.
+func (fws *FileWriterService) forgetOpen(tabID int) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	if _, ok := fws.journal[tabID]; !ok {
+		return
+	}
+	delete(fws.journal, tabID)
+	if err := fws.saveJournalLocked(); err != nil {
+		LogError("[FILEWRITER] Failed to save session journal: %v", err)
+	}
+}
+
+func (fws *FileWriterService) saveJournalLocked() error {
+	recordings := make([]ResumableRecording, 0, len(fws.journal))
+	for _, recording := range fws.journal {
+		recordings = append(recordings, recording)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].StartedAt.Before(recordings[j].StartedAt) })
+
+	data, err := json.MarshalIndent(recordings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fws.journalPath), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := fws.journalPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session journal: %w", err)
+	}
+	if err := os.Rename(tmp, fws.journalPath); err != nil {
+		return fmt.Errorf("failed to save session journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoFileManager is returned by OpenFolder and RevealFile when this system
+// has no file manager to show them in, e.g. in a container.
+var ErrNoFileManager = errors.New("no file manager available on this system")
+
+// ErrNoBrowser is returned by OpenBrowser when this system has no desktop to
+// open a browser on.
+var ErrNoBrowser = errors.New("no web browser available on this system")
+
+// ErrRecordingNotFound is returned by LocateRecording for a name that is not
+// a recording.
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// OpenFolder shows dir in Explorer, Finder or the desktop's file manager.
+func OpenFolder(dir string) error {
+	if !fileManagerAvailable() {
+		return ErrNoFileManager
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open folder: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return openFolder(dir)
+}
+
+// RevealFile shows the folder containing path with the file selected, where
+// the file manager supports it.
+func RevealFile(path string) error {
+	if !fileManagerAvailable() {
+		return ErrNoFileManager
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to reveal file: %w", err)
+	}
+	return revealFile(path)
+}
+
+// OpenBrowser opens rawURL in the default web browser.
+func OpenBrowser(rawURL string) error {
+	if !fileManagerAvailable() {
+		return ErrNoBrowser
+	}
+	return openURL(rawURL)
+}
+
+// LocateRecording returns the path of the recording called name: one that
+// finished since startup, or a file in the recordings directory of a profile.
+// name must be a plain file name, so nothing outside those directories can
+// be reached.
+func LocateRecording(name string, fileWriter *FileWriterService, profiles *ProfileStore) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid recording name %q", name)
+	}
+
+	for _, recording := range fileWriter.Finished() {
+		if recording.Name == name {
+			if _, err := os.Stat(recording.Path); err == nil {
+				return recording.Path, nil
+			}
+		}
+	}
+	dirs := []string{fileWriter.GetDownloadDir()}
+	list, _ := profiles.List()
+	for _, profile := range list {
+		dirs = append(dirs, profile.RecordingsDir)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return filepath.Abs(path)
+		}
+	}
+	return "", ErrRecordingNotFound
+}
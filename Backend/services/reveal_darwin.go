@@ -0,0 +1,22 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import "os/exec"
+
+func fileManagerAvailable() bool {
+	return true
+}
+
+func openFolder(dir string) error {
+	return exec.Command("open", dir).Run()
+}
+
+func openURL(rawURL string) error {
+	return exec.Command("open", rawURL).Run()
+}
+
+func revealFile(path string) error {
+	return exec.Command("open", "-R", path).Run()
+}
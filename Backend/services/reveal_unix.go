@@ -0,0 +1,51 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"net/url"
+	"os/exec"
+	"path/filepath"
+)
+
+func fileManagerAvailable() bool {
+	if !hasDesktopSession() {
+		return false
+	}
+	_, err := exec.LookPath("xdg-open")
+	return err == nil
+}
+
+func openFolder(dir string) error {
+	return exec.Command("xdg-open", dir).Run()
+}
+
+// openURL does not wait for xdg-open, which some browsers keep running until
+// they exit.
+func openURL(rawURL string) error {
+	cmd := exec.Command("xdg-open", rawURL)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// revealFile asks the file manager to select path through the FileManager1
+// D-Bus interface (Nautilus, Dolphin, Nemo, ...) and falls back to opening the
+// folder it is in.
+func revealFile(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	uri := (&url.URL{Scheme: "file", Path: abs}).String()
+	err = exec.Command("dbus-send", "--session", "--dest=org.freedesktop.FileManager1", "--type=method_call",
+		"/org/freedesktop/FileManager1", "org.freedesktop.FileManager1.ShowItems",
+		"array:string:"+uri, "string:").Run()
+	if err == nil {
+		return nil
+	}
+	return openFolder(filepath.Dir(abs))
+}
@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+func fileManagerAvailable() bool {
+	return true
+}
+
+// Explorer exits with status 1 even when it succeeds, so it is started
+// without waiting for it.
+func openFolder(dir string) error {
+	cmd := exec.Command("explorer.exe", filepath.Clean(dir))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// openURL hands the URL to the default browser through the URL protocol
+// handler, which unlike "start" needs no shell quoting.
+func openURL(rawURL string) error {
+	cmd := exec.Command("rundll32.exe", "url.dll,FileProtocolHandler", rawURL)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// revealFile builds the command line itself: Explorer only understands
+// /select,"path" and not the whole argument quoted, which paths with spaces
+// would otherwise get.
+func revealFile(path string) error {
+	cmd := exec.Command("explorer.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `explorer.exe /select,"` + filepath.Clean(path) + `"`}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
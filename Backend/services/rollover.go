@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinMaxFileMB is the smallest size limit of recording files, which leaves
+// room for the largest cluster or fragment below the limit.
+const MinMaxFileMB = 64
+
+// LoadMaxFileSizeFromEnv returns the size in bytes at which a recording is
+// continued in a new file, MAX_FILE_MB (default 0, no limit), e.g. 4095 for
+// drives formatted with FAT32.
+func LoadMaxFileSizeFromEnv() int64 {
+	if v, err := strconv.ParseFloat(os.Getenv("MAX_FILE_MB"), 64); err == nil && v > 0 {
+		return int64(max(v, MinMaxFileMB) * (1 << 20))
+	}
+	return 0
+}
+
+// SetMaxFileSize sets the size in bytes at which recordings started from now
+// on are continued in a new file; 0 removes the limit.
+func (fws *FileWriterService) SetMaxFileSize(size int64) {
+	fws.mu.Lock()
+	defer fws.mu.Unlock()
+	fws.maxFileSize = size
+}
+
+// fileRollover continues a recording in a new file, a part, before its file
+// grows past limit. Parts end where a cluster or fragment begins, once the
+// file is within the largest one of the limit, and each starts with the start
+// of the recording, so that every part can be played on its own. Its fields
+// belong to the goroutine that writes the recording.
+type fileRollover struct {
+	limit int64
+	// size is how much the current part holds.
+	size int64
+	// splitter finds the clusters or fragments of the recording. It is nil
+	// when they cannot be found, e.g. in a recording resumed in the middle
+	// of one, whose parts are cut at the limit instead.
+	splitter *mediaSplitter
+	// scanned is how much of the recording the splitter was given.
+	scanned int64
+	// init is the start of the recording every part begins with.
+	init []byte
+	// base and ext make the names of the parts.
+	base, ext string
+	// part is the number of the current part, and parts the files of the
+	// ones before it.
+	part  int
+	parts []string
+
+	// finishing counts the earlier parts being post-processed, and err is
+	// why post-processing one failed.
+	finishing sync.WaitGroup
+	err       error
+	mu        sync.Mutex
+}
+
+// newFileRollover returns the rollover of the recording of container written
+// to filename, or nil when there is no limit.
+func newFileRollover(limit int64, filename, container string) *fileRollover {
+	if limit <= 0 {
+		return nil
+	}
+	next := nextEBMLElement
+	if container == ContainerMP4 {
+		next = nextMP4Box
+	}
+	ext := filepath.Ext(filename)
+	return &fileRollover{
+		limit:    limit,
+		splitter: &mediaSplitter{next: next},
+		base:     strings.TrimSuffix(filepath.Base(filename), ext),
+		ext:      ext,
+		part:     1,
+	}
+}
+
+// resumeFileRollover returns the rollover of an interrupted recording resumed
+// in part of filename, which holds size bytes, or nil when there is no limit.
+func resumeFileRollover(limit int64, recording ResumableRecording, size int64) *fileRollover {
+	if limit <= 0 {
+		return nil
+	}
+	format, _ := fileFormatOf(recording.Path)
+	r := newFileRollover(limit, recording.Path, format.container)
+	if len(recording.Parts) > 0 {
+		r.base = strings.TrimSuffix(filepath.Base(recording.Parts[0]), r.ext)
+		r.part, r.parts = len(recording.Parts)+1, recording.Parts
+	}
+	init, err := readMediaInit(recording.Path, r.splitter.next)
+	if err != nil {
+		LogError("[FILEWRITER] Failed to read the start of %s, its next part will have none: %v", recording.Path, err)
+	}
+	r.init = init
+	r.splitter = nil
+	r.size = size
+	return r
+}
+
+// readMediaInit reads the start of the recording file path, up to its first
+// cluster or fragment.
+func readMediaInit(path string, next elementScanner) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	splitter := mediaSplitter{next: next}
+	reader := bufio.NewReader(io.LimitReader(file, maxPreviewSegment))
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := reader.Read(buf)
+		init, _, splitErr := splitter.write(buf[:n])
+		if splitErr != nil {
+			return nil, splitErr
+		}
+		if init != nil {
+			return append([]byte(nil), init...), nil
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the file has no cluster or fragment")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// scan gives data, the next chunk of the recording, to the splitter and
+// returns where in data clusters or fragments begin.
+func (r *fileRollover) scan(data []byte) []int {
+	start := r.scanned
+	r.scanned += int64(len(data))
+	if r.splitter == nil {
+		return nil
+	}
+	init, segments, err := r.splitter.write(data)
+	if err != nil {
+		LogError("[FILEWRITER] Parts of the recording will be cut at the size limit: %v", err)
+		r.splitter = nil
+		return nil
+	}
+	if init != nil {
+		r.init = append([]byte(nil), init...)
+	}
+	if !r.splitter.started {
+		return nil
+	}
+	// The segments data completes end where the current one begins.
+	var boundaries []int
+	boundary := r.scanned - int64(len(r.splitter.buf))
+	for i := len(segments); boundary >= start; i-- {
+		if boundary > int64(len(r.init)) {
+			boundaries = append(boundaries, int(boundary-start))
+		}
+		if i == 0 {
+			break
+		}
+		boundary -= int64(len(segments[i-1]))
+	}
+	slices.Reverse(boundaries)
+	return boundaries
+}
+
+// cut returns where the current part ends in data, written from from on,
+// and whether a new part begins there.
+func (r *fileRollover) cut(data []byte, from int, boundaries []int) (int, bool) {
+	for _, boundary := range boundaries {
+		if boundary >= from && r.size+int64(boundary-from) >= r.limit-maxPreviewSegment {
+			return boundary, true
+		}
+	}
+	if r.size+int64(len(data)-from) > r.limit {
+		if r.splitter != nil {
+			LogError("[FILEWRITER] No cluster or fragment began before the size limit, the part is cut in one")
+		}
+		return from + int(max(r.limit-r.size, 0)), true
+	}
+	return len(data), false
+}
+
+// writeChunk writes data, a chunk of the recording of tabID, to the file of
+// handle, and continues the recording in new parts where the size limit
+// says.
+func (fws *FileWriterService) writeChunk(tabID int, handle *fileHandle, data []byte) (int, error) {
+	r := handle.rollover
+	if r == nil {
+		return handle.writer.Write(data)
+	}
+	boundaries := r.scan(data)
+	written := 0
+	for {
+		end, roll := r.cut(data, written, boundaries)
+		n, err := handle.writer.Write(data[written:end])
+		written += n
+		r.size += int64(n)
+		if err != nil || !roll {
+			return written, err
+		}
+		if err := fws.nextPart(tabID, handle); err != nil {
+			return written, err
+		}
+	}
+}
+
+// nextPart closes the current file of handle and continues the recording of
+// tabID in a new part next to it. The closed part is post-processed in the
+// background.
+func (fws *FileWriterService) nextPart(tabID int, handle *fileHandle) error {
+	r := handle.rollover
+	previous, _ := filepath.Abs(handle.file.Name())
+	if err := handle.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to finish part %d: %w", r.part, err)
+	}
+	if err := handle.file.Close(); err != nil {
+		return fmt.Errorf("failed to finish part %d: %w", r.part, err)
+	}
+
+	r.parts = append(r.parts, previous)
+	r.part++
+	file, err := createRecordingFile(filepath.Dir(previous), r.base+"-part"+strconv.Itoa(r.part), r.ext)
+	if err != nil {
+		return err
+	}
+	handle.file = file
+	handle.writer.Reset(file)
+	r.size = 0
+	if r.init == nil {
+		LogError("[FILEWRITER] Part %d of %s begins without the start of the recording", r.part, r.base)
+	}
+	n, err := handle.writer.Write(r.init)
+	r.size = int64(n)
+	if err != nil {
+		return err
+	}
+	fws.filenameMap.Store(tabID, file.Name())
+	fws.rememberPart(tabID, file.Name(), r.parts)
+	LogInfo("[FILEWRITER] %s reached the size limit, continuing in %s", previous, file.Name())
+
+	handle.mu.Lock()
+	sidecar := RecordingSidecar{
+		Name:            handle.name,
+		StartedAt:       time.UnixMilli(handle.partStart),
+		DurationSeconds: time.Since(time.UnixMilli(handle.partStart)).Seconds(),
+		Markers:         handle.markers,
+		Screenshots:     handle.screenshots,
+		Source:          handle.source,
+		ContinuesFrom:   handle.continuesFrom,
+		Group:           handle.group,
+		Recording:       filepath.Base(r.parts[0]),
+		Part:            len(r.parts),
+	}
+	handle.markers = nil
+	handle.screenshots = nil
+	handle.partStart = time.Now().UnixMilli()
+	handle.mu.Unlock()
+
+	r.finishing.Add(1)
+	go func() {
+		defer CapturePanic()
+		defer r.finishing.Done()
+		fws.saveMarkers(previous, sidecar)
+		if err := fws.postProcess(previous, handle.high); err != nil {
+			r.mu.Lock()
+			if r.err == nil {
+				r.err = fmt.Errorf("%s: %w", filepath.Base(previous), err)
+			}
+			r.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// finished waits until the earlier parts are post-processed, once the
+// recording has ended, and returns their files and why post-processing one
+// failed.
+func (r *fileRollover) finished() ([]string, error) {
+	if r == nil {
+		return nil, nil
+	}
+	r.finishing.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.parts, r.err
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ScheduleWaiting schedules have not reached their start time.
+	ScheduleWaiting = "scheduled"
+	// ScheduleStarting schedules have sent the extension a start command and
+	// wait for it to report the tab it records.
+	ScheduleStarting = "starting"
+	// ScheduleRecording schedules have a session being recorded.
+	ScheduleRecording = "recording"
+	// ScheduleDone schedules have recorded until their stop time, or until the
+	// session ended early (see Schedule.Error).
+	ScheduleDone = "done"
+	// ScheduleFailed schedules never got a session: the extension was not
+	// connected, or could not capture the tab.
+	ScheduleFailed = "failed"
+
+	scheduleCheckInterval = 5 * time.Second
+	// scheduleRetryInterval is how long a start command waits for the
+	// extension's answer before it is sent again.
+	scheduleRetryInterval = time.Minute
+	// scheduleSessionGrace is how long after the extension reports a tab its
+	// first chunk may take to arrive.
+	scheduleSessionGrace = 30 * time.Second
+)
+
+// ErrScheduleNotFound is returned for a schedule ID that does not exist.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Schedule is a recording the server starts and stops by itself: at StartAt
+// it tells the extension to open URL and record it, and at StopAt it stops
+// the session, so that live streams can be captured unattended.
+type Schedule struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	StartAt time.Time `json:"startAt"`
+	StopAt  time.Time `json:"stopAt"`
+	Status  string    `json:"status"`
+	// Headless schedules are recorded by the capture agent in a headless
+	// browser on the server (see capture.go); others by the extension, or by
+	// the agent when no extension is connected.
+	Headless bool `json:"headless,omitempty"`
+	// TabID is the tab the extension records, once it has reported it, or
+	// the session of the capture.
+	TabID int `json:"tabId,omitempty"`
+	// Error says why a schedule failed or ended early.
+	Error string `json:"error,omitempty"`
+
+	commandSent time.Time
+	reportedAt  time.Time
+}
+
+// ScheduleStore keeps the schedules in a JSON file and sends the start and
+// stop commands for them at their times.
+type ScheduleStore struct {
+	path      string
+	recorder  *RecorderService
+	capture   *CaptureAgent
+	schedules map[string]*Schedule
+	mu        sync.Mutex
+	stopChan  chan struct{}
+}
+
+// LoadScheduleStore reads the schedules from path, if it exists. Schedules
+// that were starting when the server stopped are started again.
+func LoadScheduleStore(path string, recorder *RecorderService) (*ScheduleStore, error) {
+	ss := &ScheduleStore{
+		path:      path,
+		recorder:  recorder,
+		schedules: make(map[string]*Schedule),
+		stopChan:  make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+	if err == nil {
+		var schedules []*Schedule
+		if err := json.Unmarshal(data, &schedules); err != nil {
+			return nil, fmt.Errorf("failed to parse schedules: %w", err)
+		}
+		for _, s := range schedules {
+			if s == nil || s.ID == "" {
+				continue
+			}
+			if s.Status == ScheduleStarting {
+				s.Status = ScheduleWaiting
+			}
+			ss.schedules[s.ID] = s
+		}
+	}
+	return ss, nil
+}
+
+// SetCaptureAgent lets the store record schedules in a headless browser
+// with capture.
+func (ss *ScheduleStore) SetCaptureAgent(capture *CaptureAgent) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.capture = capture
+}
+
+// List returns the schedules ordered by start time.
+func (ss *ScheduleStore) List() []Schedule {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	schedules := make([]Schedule, 0, len(ss.schedules))
+	for _, s := range ss.schedules {
+		schedules = append(schedules, *s)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].StartAt.Before(schedules[j].StartAt) })
+	return schedules
+}
+
+// Add validates and saves a new schedule, and returns it with its ID.
+func (ss *ScheduleStore) Add(schedule Schedule) (Schedule, error) {
+	if err := validateSchedule(schedule); err != nil {
+		return Schedule{}, err
+	}
+	ss.mu.Lock()
+	capture := ss.capture
+	ss.mu.Unlock()
+	if schedule.Headless && !capture.Available() {
+		return Schedule{}, fmt.Errorf("headless schedules need capture.browser and FFmpeg")
+	}
+	id, err := generateToken()
+	if err != nil {
+		return Schedule{}, err
+	}
+	schedule.ID = id[:12]
+	schedule.Status = ScheduleWaiting
+	schedule.TabID, schedule.Error = 0, ""
+	if schedule.Name == "" {
+		schedule.Name = "scheduled"
+	}
+
+	ss.mu.Lock()
+	ss.schedules[schedule.ID] = &schedule
+	if err := ss.saveLocked(); err != nil {
+		delete(ss.schedules, schedule.ID)
+		ss.mu.Unlock()
+		return Schedule{}, err
+	}
+	ss.mu.Unlock()
+	LogInfo("[SCHEDULE] Scheduled %q (%s) from %s to %s", schedule.Name, schedule.URL,
+		schedule.StartAt.Format(time.RFC3339), schedule.StopAt.Format(time.RFC3339))
+
+	ss.check(context.Background(), time.Now())
+	return schedule, nil
+}
+
+// Delete removes a schedule, stopping its session if it is recording.
+func (ss *ScheduleStore) Delete(ctx context.Context, id string) error {
+	ss.mu.Lock()
+	schedule, ok := ss.schedules[id]
+	if !ok {
+		ss.mu.Unlock()
+		return ErrScheduleNotFound
+	}
+	delete(ss.schedules, id)
+	if err := ss.saveLocked(); err != nil {
+		ss.schedules[id] = schedule
+		ss.mu.Unlock()
+		return err
+	}
+	ss.mu.Unlock()
+
+	if schedule.Status == ScheduleRecording {
+		if err := ss.stopRecording(ctx, schedule); err != nil {
+			LogErrorCtx(ctx, "[SCHEDULE] Failed to stop the recording of %q: %v", schedule.Name, err)
+		}
+	}
+	LogInfoCtx(ctx, "[SCHEDULE] Deleted schedule %q", schedule.Name)
+	return nil
+}
+
+// Report records the extension's answer to a start command: the tab it
+// records for schedule id, or why it could not record it.
+func (ss *ScheduleStore) Report(ctx context.Context, id string, tabID int, reason string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	schedule, ok := ss.schedules[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	if schedule.Status != ScheduleStarting {
+		return fmt.Errorf("schedule %q is %s, not starting", schedule.Name, schedule.Status)
+	}
+	if reason != "" {
+		schedule.Status, schedule.Error = ScheduleFailed, reason
+		LogErrorCtx(ctx, "[SCHEDULE] The extension could not record %q: %s", schedule.Name, reason)
+	} else {
+		schedule.Status, schedule.TabID = ScheduleRecording, tabID
+		schedule.reportedAt = time.Now()
+		LogInfoCtx(ctx, "[SCHEDULE] Recording %q in tab %d", schedule.Name, tabID)
+	}
+	if err := ss.saveLocked(); err != nil {
+		LogErrorCtx(ctx, "[SCHEDULE] Failed to save schedules: %v", err)
+	}
+	return nil
+}
+
+// Start checks the schedules now and then every few seconds.
+func (ss *ScheduleStore) Start() {
+	go func() {
+		defer CapturePanic()
+		ss.check(context.Background(), time.Now())
+
+		ticker := time.NewTicker(scheduleCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				ss.check(context.Background(), now)
+			case <-ss.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule checks. Sessions being recorded are left alone.
+func (ss *ScheduleStore) Stop() {
+	close(ss.stopChan)
+}
+
+// check sends the commands that are due at now and follows the sessions of
+// the schedules being recorded.
+func (ss *ScheduleStore) check(ctx context.Context, now time.Time) {
+	ss.mu.Lock()
+	var stops, captures []Schedule
+	changed := false
+	for _, s := range ss.schedules {
+		switch s.Status {
+		case ScheduleWaiting, ScheduleStarting:
+			if now.Before(s.StartAt) {
+				continue
+			}
+			if !now.Before(s.StopAt) {
+				s.Status = ScheduleFailed
+				if s.commandSent.IsZero() {
+					s.Error = "The server was not running at the start time"
+				} else if s.Error == "" {
+					s.Error = "The extension did not start the recording before the stop time"
+				}
+				LogError("[SCHEDULE] %q was not recorded: %s", s.Name, s.Error)
+				changed = true
+				continue
+			}
+			if s.Status == ScheduleStarting && now.Sub(s.commandSent) < scheduleRetryInterval {
+				continue
+			}
+			if s.Headless {
+				captures = append(captures, *s)
+			} else if n := ss.recorder.RequestStart(s.ID, s.Name, s.URL); n == 0 && ss.capture.Available() {
+				s.Error = ""
+				LogInfo("[SCHEDULE] No extension is connected, capturing %q in a headless browser", s.Name)
+				captures = append(captures, *s)
+			} else if n == 0 {
+				if s.Error == "" {
+					LogError("[SCHEDULE] Cannot start %q: no extension is connected", s.Name)
+				}
+				s.Error = "No extension is connected"
+			} else {
+				s.Error = ""
+				LogInfo("[SCHEDULE] Asked the extension to record %q (%s)", s.Name, s.URL)
+			}
+			s.Status, s.commandSent = ScheduleStarting, now
+			changed = true
+		case ScheduleRecording:
+			if !now.Before(s.StopAt) {
+				stops = append(stops, *s)
+				s.Status = ScheduleDone
+				changed = true
+			} else if !ss.recorder.IsRecording(s.TabID) && now.Sub(s.reportedAt) > scheduleSessionGrace {
+				s.Status, s.Error = ScheduleDone, "The recording ended before the stop time"
+				LogInfo("[SCHEDULE] The recording of %q ended before its stop time", s.Name)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		if err := ss.saveLocked(); err != nil {
+			LogError("[SCHEDULE] Failed to save schedules: %v", err)
+		}
+	}
+	ss.mu.Unlock()
+
+	for _, s := range stops {
+		if err := ss.stopRecording(ctx, &s); err != nil {
+			LogErrorCtx(ctx, "[SCHEDULE] Failed to stop the recording of %q: %v", s.Name, err)
+			continue
+		}
+		LogInfoCtx(ctx, "[SCHEDULE] Stopped the recording of %q at its stop time", s.Name)
+	}
+	for _, s := range captures {
+		ss.startCapture(ctx, s)
+	}
+}
+
+// startCapture records schedule s with the capture agent and reports the
+// capture, or why it could not start, like the extension does.
+func (ss *ScheduleStore) startCapture(ctx context.Context, s Schedule) {
+	reason := ""
+	capture, err := ss.capture.Start(ctx, s.Name, s.URL, 0)
+	if err != nil {
+		reason = fmt.Sprintf("The headless browser could not record the page: %v", err)
+	}
+	if err := ss.Report(ctx, s.ID, capture.TabID, reason); err != nil {
+		// The schedule was deleted while the browser started
+		LogErrorCtx(ctx, "[SCHEDULE] Dropping the capture of %q: %v", s.Name, err)
+		if reason == "" {
+			ss.capture.Stop(capture.TabID)
+		}
+	}
+}
+
+// stopRecording stops the session of schedule s: a capture is stopped in the
+// browser, so that it finishes its file, and others from the server.
+func (ss *ScheduleStore) stopRecording(ctx context.Context, s *Schedule) error {
+	if s.TabID < 0 {
+		if err := ss.capture.Stop(s.TabID); err != nil && !errors.Is(err, ErrCaptureNotFound) {
+			return err
+		}
+		return nil
+	}
+	if err := ss.recorder.Stop(ctx, s.TabID); err != nil && !errors.Is(err, ErrNotRecording) {
+		return err
+	}
+	return nil
+}
+
+func (ss *ScheduleStore) saveLocked() error {
+	schedules := make([]*Schedule, 0, len(ss.schedules))
+	for _, s := range ss.schedules {
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].StartAt.Before(schedules[j].StartAt) })
+
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ss.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := ss.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write schedules: %w", err)
+	}
+	if err := os.Rename(tmp, ss.path); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return nil
+}
+
+// IsPageURL reports whether raw is an http or https address that the
+// extension or the capture agent can open.
+func IsPageURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validateSchedule(s Schedule) error {
+	if !IsPageURL(s.URL) {
+		return fmt.Errorf("url must be an http or https address")
+	}
+	if s.StartAt.IsZero() || s.StopAt.IsZero() {
+		return fmt.Errorf("startAt and stopAt are required")
+	}
+	if !s.StopAt.After(s.StartAt) {
+		return fmt.Errorf("stopAt must be after startAt")
+	}
+	if !s.StopAt.After(time.Now()) {
+		return fmt.Errorf("stopAt must be in the future")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxScreenshotSize is the largest screenshot the extension may send, in
+// bytes: a PNG of a 4K tab is a few megabytes.
+const MaxScreenshotSize = 32 << 20
+
+// ErrInvalidScreenshot is returned for screenshots that are not a PNG or JPEG
+// image.
+var ErrInvalidScreenshot = errors.New("screenshot must be a PNG or JPEG image")
+
+// Screenshot is a full-resolution image of the tab taken while recording it,
+// saved next to the recording file. The first screenshot of a file is its
+// poster.
+type Screenshot struct {
+	// File is the name of the image, in the folder of the recording.
+	File string    `json:"file"`
+	At   time.Time `json:"at"`
+	// OffsetSeconds is how far into the recording file the screenshot is.
+	OffsetSeconds float64 `json:"offsetSeconds"`
+}
+
+// SetCaptureAgent lets RequestScreenshot take screenshots of the pages
+// captured by agent.
+func (rs *RecorderService) SetCaptureAgent(agent *CaptureAgent) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.captures = agent
+}
+
+// RequestScreenshot takes a screenshot of the tab recorded as tabID. The
+// screenshot of a page captured on the server is taken and saved right away
+// and returned; for a tab the extension records, it is asked to send one and
+// nil is returned, or ErrNoExtension when none is connected.
+func (rs *RecorderService) RequestScreenshot(ctx context.Context, tabID int) (*Screenshot, error) {
+	if !rs.IsRecording(tabID) {
+		return nil, ErrNotRecording
+	}
+	rs.mu.Lock()
+	captures := rs.captures
+	rs.mu.Unlock()
+	if tabID < 0 && captures != nil {
+		at := time.Now()
+		data, err := captures.Screenshot(ctx, tabID)
+		if err != nil {
+			return nil, err
+		}
+		screenshot, err := rs.AddScreenshot(ctx, tabID, data, at)
+		if err != nil {
+			return nil, err
+		}
+		return &screenshot, nil
+	}
+	if rs.publish(RecorderCommand{Type: "screenshot", TabID: tabID}) == 0 {
+		return nil, ErrNoExtension
+	}
+	LogInfoCtx(ctx, "[RECORDER] Asked the extension for a screenshot of tab %d", tabID)
+	return nil, nil
+}
+
+// AddScreenshot saves image, a PNG or JPEG screenshot of the tab recorded as
+// tabID taken at at, next to the file the recording is being written to and
+// returns it.
+func (rs *RecorderService) AddScreenshot(ctx context.Context, tabID int, image []byte, at time.Time) (Screenshot, error) {
+	if !rs.IsRecording(tabID) {
+		return Screenshot{}, ErrNotRecording
+	}
+	screenshot, err := rs.fileWriter.AddScreenshot(tabID, image, at)
+	if err != nil {
+		return Screenshot{}, err
+	}
+	LogInfoCtx(ctx, "[RECORDER] Saved screenshot %s of tab %d", screenshot.File, tabID)
+	return screenshot, nil
+}
+
+// AddScreenshot writes image next to the file of tabID, named after it, e.g.
+// meeting-screenshot-2.png for meeting.webm, and keeps it for the sidecar of
+// the file.
+func (fws *FileWriterService) AddScreenshot(tabID int, image []byte, at time.Time) (Screenshot, error) {
+	var ext string
+	switch http.DetectContentType(image) {
+	case "image/png":
+		ext = ".png"
+	case "image/jpeg":
+		ext = ".jpg"
+	default:
+		return Screenshot{}, ErrInvalidScreenshot
+	}
+	val, ok := fws.activeFiles.Load(tabID)
+	if !ok {
+		return Screenshot{}, ErrNotRecording
+	}
+	filenameVal, ok := fws.filenameMap.Load(tabID)
+	if !ok {
+		return Screenshot{}, ErrNotRecording
+	}
+	filename := filenameVal.(string)
+	handle := val.(*fileHandle)
+
+	handle.mu.Lock()
+	if handle.stopped {
+		handle.mu.Unlock()
+		return Screenshot{}, ErrNotRecording
+	}
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	path := fmt.Sprintf("%s-screenshot-%d%s", base, len(handle.screenshots)+1, ext)
+	if err := os.WriteFile(path, image, 0644); err != nil {
+		handle.mu.Unlock()
+		return Screenshot{}, fmt.Errorf("failed to write screenshot: %w", err)
+	}
+	offset := at.Sub(time.UnixMilli(handle.partStart))
+	if offset < 0 {
+		offset = 0
+	}
+	screenshot := Screenshot{File: filepath.Base(path), At: at, OffsetSeconds: offset.Seconds()}
+	handle.screenshots = append(handle.screenshots, screenshot)
+	if handle.poster == "" {
+		handle.poster = screenshot.File
+	}
+	screenshots := append([]Screenshot(nil), handle.screenshots...)
+	handle.mu.Unlock()
+
+	fws.rememberScreenshots(tabID, screenshots)
+	return screenshot, nil
+}
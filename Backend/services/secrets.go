@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const secretServiceName = "recorder"
+
+// ErrSecretNotFound is returned by SecretStore.Get when no secret is stored under name.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore persists small secrets such as API tokens.
+type SecretStore interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+// NewSecretStore returns a store backed by the OS credential store (DPAPI on
+// Windows, the login Keychain on macOS, libsecret elsewhere) that falls back to
+// plaintext files in dir when the OS store is unavailable. Secrets found in the
+// fallback files are moved into the OS store on first read.
+func NewSecretStore(dir string) SecretStore {
+	files := &fileSecretStore{dir: dir}
+	primary := osSecretStore(dir)
+	if primary == nil {
+		LogInfo("[SECRETS] OS credential store unavailable, storing secrets in %s", dir)
+		return files
+	}
+	return &fallbackSecretStore{primary: primary, fallback: files}
+}
+
+// NewFileSecretStore returns a store that keeps secrets only in files in dir,
+// for portable installs whose secrets must travel with them.
+func NewFileSecretStore(dir string) SecretStore {
+	return &fileSecretStore{dir: dir}
+}
+
+// fileSecretStore keeps each secret in a 0600 file named after it.
+type fileSecretStore struct {
+	dir string
+}
+
+func (s *fileSecretStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *fileSecretStore) Get(name string) (string, error) {
+	data, err := os.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (s *fileSecretStore) Set(name, value string) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(s.path(name), []byte(value+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write secret %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *fileSecretStore) Delete(name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// fallbackSecretStore prefers the OS store and uses plaintext files only when
+// the OS store fails, e.g. when no keyring daemon is running.
+type fallbackSecretStore struct {
+	primary  SecretStore
+	fallback SecretStore
+}
+
+func (s *fallbackSecretStore) Get(name string) (string, error) {
+	value, err := s.primary.Get(name)
+	if err == nil {
+		return value, nil
+	}
+	if !errors.Is(err, ErrSecretNotFound) {
+		LogError("[SECRETS] OS credential store read failed for %s: %v", name, err)
+	}
+
+	value, err = s.fallback.Get(name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.primary.Set(name, value); err == nil {
+		s.fallback.Delete(name)
+		LogInfo("[SECRETS] Moved %s into the OS credential store", name)
+	}
+	return value, nil
+}
+
+func (s *fallbackSecretStore) Set(name, value string) error {
+	if err := s.primary.Set(name, value); err != nil {
+		LogError("[SECRETS] OS credential store write failed for %s, using file: %v", name, err)
+		return s.fallback.Set(name, value)
+	}
+	s.fallback.Delete(name)
+	return nil
+}
+
+func (s *fallbackSecretStore) Delete(name string) error {
+	primaryErr := s.primary.Delete(name)
+	if err := s.fallback.Delete(name); err != nil {
+		return err
+	}
+	return primaryErr
+}
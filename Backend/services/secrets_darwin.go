@@ -0,0 +1,56 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errSecItemNotFound is the exit status of security(1) when no item matches.
+const errSecItemNotFound = 44
+
+// keychainSecretStore stores secrets as generic passwords in the login Keychain.
+type keychainSecretStore struct{}
+
+func osSecretStore(dir string) SecretStore {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil
+	}
+	return keychainSecretStore{}
+}
+
+func (keychainSecretStore) Get(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", secretServiceName, "-a", name, "-w").Output()
+	if err != nil {
+		if isExitCode(err, errSecItemNotFound) {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("security find-generic-password: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (keychainSecretStore) Set(name, value string) error {
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", secretServiceName, "-a", name, "-w", value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("security add-generic-password: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (keychainSecretStore) Delete(name string) error {
+	err := exec.Command("security", "delete-generic-password", "-s", secretServiceName, "-a", name).Run()
+	if err != nil && !isExitCode(err, errSecItemNotFound) {
+		return fmt.Errorf("security delete-generic-password: %w", err)
+	}
+	return nil
+}
+
+func isExitCode(err error, code int) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == code
+}
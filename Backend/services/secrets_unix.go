@@ -0,0 +1,60 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// libsecretSecretStore stores secrets in the desktop keyring through secret-tool(1).
+type libsecretSecretStore struct{}
+
+func osSecretStore(dir string) SecretStore {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil
+	}
+	return libsecretSecretStore{}
+}
+
+func (libsecretSecretStore) Get(name string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", secretServiceName, "account", name)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// secret-tool exits 1 with no output when nothing matches.
+		if stderr.Len() == 0 {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("secret-tool lookup: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (libsecretSecretStore) Set(name, value string) error {
+	cmd := exec.Command("secret-tool", "store", "--label=Recording Server "+name, "service", secretServiceName, "account", name)
+	cmd.Stdin = strings.NewReader(value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (libsecretSecretStore) Delete(name string) error {
+	if out, err := exec.Command("secret-tool", "clear", "service", secretServiceName, "account", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool clear: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	cryptProtectData   = syscall.NewLazyDLL("crypt32.dll").NewProc("CryptProtectData")
+	cryptUnprotectData = syscall.NewLazyDLL("crypt32.dll").NewProc("CryptUnprotectData")
+	localFree          = syscall.NewLazyDLL("kernel32.dll").NewProc("LocalFree")
+)
+
+const cryptProtectUIForbidden = 0x1
+
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newDataBlob(b []byte) *dataBlob {
+	if len(b) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(b)), data: &b[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	out := make([]byte, b.size)
+	copy(out, unsafe.Slice(b.data, b.size))
+	return out
+}
+
+// dpapiSecretStore keeps each secret in dir/<name>.dpapi, encrypted with DPAPI
+// so only the current Windows user can decrypt it.
+type dpapiSecretStore struct {
+	dir string
+}
+
+func osSecretStore(dir string) SecretStore {
+	if err := cryptProtectData.Find(); err != nil {
+		return nil
+	}
+	return &dpapiSecretStore{dir: dir}
+}
+
+func (s *dpapiSecretStore) path(name string) string {
+	return filepath.Join(s.dir, name+".dpapi")
+}
+
+func (s *dpapiSecretStore) Get(name string) (string, error) {
+	encrypted, err := os.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrSecretNotFound
+		}
+		return "", err
+	}
+
+	var out dataBlob
+	ret, _, callErr := cryptUnprotectData.Call(
+		uintptr(unsafe.Pointer(newDataBlob(encrypted))),
+		0, 0, 0, 0,
+		cryptProtectUIForbidden,
+		uintptr(unsafe.Pointer(&out)),
+	)
+	if ret == 0 {
+		return "", fmt.Errorf("CryptUnprotectData failed: %w", callErr)
+	}
+	defer localFree.Call(uintptr(unsafe.Pointer(out.data)))
+	return string(out.bytes()), nil
+}
+
+func (s *dpapiSecretStore) Set(name, value string) error {
+	var out dataBlob
+	ret, _, callErr := cryptProtectData.Call(
+		uintptr(unsafe.Pointer(newDataBlob([]byte(value)))),
+		0, 0, 0, 0,
+		cryptProtectUIForbidden,
+		uintptr(unsafe.Pointer(&out)),
+	)
+	if ret == 0 {
+		return fmt.Errorf("CryptProtectData failed: %w", callErr)
+	}
+	defer localFree.Call(uintptr(unsafe.Pointer(out.data)))
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return os.WriteFile(s.path(name), out.bytes(), 0600)
+}
+
+func (s *dpapiSecretStore) Delete(name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// selfTestTimeout bounds each step of SelfTestFFmpeg; encoding one second of
+// video takes well under a second on any machine FFmpeg runs on.
+const selfTestTimeout = 30 * time.Second
+
+// SelfTestFFmpeg checks that the ffmpeg at path can do what post-processing
+// needs, which ffmpeg -version does not tell: it encodes a clip of one
+// second, with video and audio, and remuxes it the way recordings are.
+// Installs that are broken or partial, such as a binary without its
+// libraries or a build without the muxers, fail here instead of on the first
+// recording. Each step is passed to output, if set.
+func SelfTestFFmpeg(path string, output func(line string)) error {
+	dir, err := os.MkdirTemp("", "ffmpeg-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create the test folder: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	clip := filepath.Join(dir, "clip.mkv")
+	remuxed := filepath.Join(dir, "remuxed.mkv")
+
+	steps := []struct {
+		name   string
+		failed string
+		args   []string
+		out    string
+	}{
+		{"Encoding a 1 second test clip", "encode the test clip", []string{
+			"-f", "lavfi", "-i", "testsrc=duration=1:size=320x240:rate=30",
+			"-f", "lavfi", "-i", "sine=frequency=440:duration=1",
+			"-shortest", clip,
+		}, clip},
+		{"Remuxing the test clip", "remux the test clip", []string{"-i", clip, "-c", "copy", remuxed}, remuxed},
+	}
+	for _, step := range steps {
+		if output != nil {
+			output(step.name)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+		args := append([]string{"-hide_banner", "-loglevel", "error", "-y"}, step.args...)
+		out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+		cancel()
+		if err != nil {
+			if message := strings.TrimSpace(string(out)); message != "" {
+				return fmt.Errorf("FFmpeg self-test failed to %s: %v: %s", step.failed, err, message)
+			}
+			return fmt.Errorf("FFmpeg self-test failed to %s: %w", step.failed, err)
+		}
+		if info, err := os.Stat(step.out); err != nil || info.Size() == 0 {
+			return fmt.Errorf("FFmpeg self-test failed to %s: no output was written", step.failed)
+		}
+	}
+	LogInfo("[INSTALLER] FFmpeg self-test passed: %s encodes and remuxes", path)
+	if output != nil {
+		output("Self-test passed")
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Settings are the preferences changed from the UI or the API. Values uses the
+// config file keys (e.g. "paths.recordings", "limits.ip_rps").
+type Settings struct {
+	Theme       string            `json:"theme,omitempty"`
+	DefaultView string            `json:"defaultView,omitempty"`
+	Units       string            `json:"units,omitempty"`
+	Zoom        int               `json:"zoom,omitempty"`
+	Language    string            `json:"language,omitempty"`
+	Values      map[string]string `json:"values,omitempty"`
+	// Secrets are the keys of the saved settings that hold credentials,
+	// whose values are in the SecretStore rather than in Values.
+	Secrets []string `json:"secrets,omitempty"`
+}
+
+// UIPreferences are how the UI looks, kept on the server so that every
+// browser shows it the same way. Empty fields mean the UI's default.
+type UIPreferences struct {
+	// Theme is "light", "dark", or empty to follow the system.
+	Theme string `json:"theme"`
+	// DefaultView is the section the UI opens at: "overview", "recordings",
+	// "statistics" or "configuration".
+	DefaultView string `json:"defaultView"`
+	// Units shows sizes in "binary" (1 KB = 1024 bytes) or "decimal" units.
+	Units string `json:"units"`
+	// Zoom scales the UI, in percent from MinZoom to MaxZoom; 0 means 100.
+	Zoom int `json:"zoom"`
+	// Language is the code of the language of the UI and of the messages the
+	// server returns, or empty to follow the browser's language.
+	Language string `json:"language"`
+}
+
+// MinZoom and MaxZoom bound UIPreferences.Zoom.
+const (
+	MinZoom = 50
+	MaxZoom = 200
+)
+
+// Validate checks that every field has a value the UI knows.
+func (p UIPreferences) Validate() error {
+	switch p.Theme {
+	case "", "light", "dark":
+	default:
+		return fmt.Errorf("theme must be light, dark or empty")
+	}
+	switch p.DefaultView {
+	case "", "overview", "recordings", "statistics", "configuration":
+	default:
+		return fmt.Errorf("defaultView must be overview, recordings, statistics or configuration")
+	}
+	switch p.Units {
+	case "", "binary", "decimal":
+	default:
+		return fmt.Errorf("units must be binary or decimal")
+	}
+	if p.Zoom != 0 && (p.Zoom < MinZoom || p.Zoom > MaxZoom) {
+		return fmt.Errorf("zoom must be between %d and %d", MinZoom, MaxZoom)
+	}
+	if p.Language != "" && !SupportedLanguage(p.Language) {
+		return fmt.Errorf("language %q is not available", p.Language)
+	}
+	return nil
+}
+
+// SettingsStore persists Settings as JSON so changes survive a restart.
+// Once it has a SecretStore, settings that hold credentials are kept there
+// instead of in the file.
+type SettingsStore struct {
+	path     string
+	settings Settings
+	secrets  SecretStore
+	// secretValues are the values of settings.Secrets.
+	secretValues map[string]string
+	// applied are the keys whose environment variable Apply set, which later
+	// calls may change again.
+	applied map[string]bool
+	mu      sync.Mutex
+}
+
+// LoadSettingsStore reads the settings at path; a missing file is empty.
+func LoadSettingsStore(path string) (*SettingsStore, error) {
+	ss := &SettingsStore{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ss, nil
+		}
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &ss.settings); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	for key := range ss.settings.Values {
+		if _, ok := configKeys[key]; !ok {
+			return nil, fmt.Errorf("unknown setting %q in %s", key, path)
+		}
+		if fileOnlyConfigKeys[key] {
+			return nil, fmt.Errorf("setting %q in %s can only be set in the config file or the environment", key, path)
+		}
+	}
+	return ss, nil
+}
+
+// Apply sets the environment variable of every saved setting. Saved settings
+// replace values from the config file, which then no longer manages them, but
+// not variables set in the environment. It returns the keys it applied.
+func (ss *SettingsStore) Apply(file *ConfigFile) []string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var applied []string
+	for key, value := range ss.settings.Values {
+		if ss.applyLocked(file, key, value) {
+			applied = append(applied, key)
+		}
+	}
+	for key, value := range ss.secretValues {
+		if ss.applyLocked(file, key, value) {
+			applied = append(applied, key)
+		}
+	}
+	sort.Strings(applied)
+	return applied
+}
+
+// applyLocked sets the environment variable of key to value, unless it is set
+// outside the config file and the saved settings, and reports whether it did.
+func (ss *SettingsStore) applyLocked(file *ConfigFile, key, value string) bool {
+	env := configKeys[key]
+	if _, set := os.LookupEnv(env); set && !ss.applied[key] && (file == nil || !file.owned[env]) {
+		return false
+	}
+	os.Setenv(env, value)
+	if ss.applied == nil {
+		ss.applied = make(map[string]bool)
+	}
+	ss.applied[key] = true
+	if file != nil {
+		delete(file.owned, env)
+	}
+	return true
+}
+
+// UseSecretStore keeps the saved settings that hold credentials in secrets
+// from now on. Those saved in the file before are moved there, and those
+// already there are applied as Apply does. It returns the keys it applied.
+func (ss *SettingsStore) UseSecretStore(secrets SecretStore, file *ConfigFile) ([]string, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.secrets = secrets
+	if ss.secretValues == nil {
+		ss.secretValues = make(map[string]string)
+	}
+
+	moved := false
+	for key, value := range ss.settings.Values {
+		if !secretConfigKeys[key] {
+			continue
+		}
+		if err := ss.setSecretLocked(key, value); err != nil {
+			return nil, err
+		}
+		delete(ss.settings.Values, key)
+		moved = true
+	}
+	if moved {
+		if err := ss.saveLocked(); err != nil {
+			return nil, err
+		}
+		LogInfo("[SECRETS] Moved the saved credentials out of %s", ss.path)
+	}
+
+	var applied []string
+	for _, key := range ss.settings.Secrets {
+		value, ok := ss.secretValues[key]
+		if !ok {
+			var err error
+			value, err = secrets.Get(settingSecretName(key))
+			if errors.Is(err, ErrSecretNotFound) {
+				LogError("[SECRETS] Saved setting %s is missing from the secret store", key)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read setting %s: %w", key, err)
+			}
+			ss.secretValues[key] = value
+		}
+		if ss.applied[key] {
+			// Applied from the file before it was moved
+			continue
+		}
+		if ss.applyLocked(file, key, value) {
+			applied = append(applied, key)
+		}
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
+
+// setSecretLocked stores value of the credential setting key in the
+// SecretStore and records that it is there.
+func (ss *SettingsStore) setSecretLocked(key, value string) error {
+	if err := ss.secrets.Set(settingSecretName(key), value); err != nil {
+		return fmt.Errorf("failed to store setting %s: %w", key, err)
+	}
+	if ss.secretValues == nil {
+		ss.secretValues = make(map[string]string)
+	}
+	ss.secretValues[key] = value
+	for _, saved := range ss.settings.Secrets {
+		if saved == key {
+			return nil
+		}
+	}
+	ss.settings.Secrets = append(ss.settings.Secrets, key)
+	sort.Strings(ss.settings.Secrets)
+	return nil
+}
+
+// settingSecretName is the SecretStore name of the credential setting key.
+func settingSecretName(key string) string {
+	return "setting_" + strings.ReplaceAll(key, ".", "_")
+}
+
+// Theme returns the saved UI theme, or "" to follow the system.
+func (ss *SettingsStore) Theme() string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.settings.Theme
+}
+
+// SetTheme saves the UI theme.
+func (ss *SettingsStore) SetTheme(theme string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.settings.Theme = theme
+	return ss.saveLocked()
+}
+
+// Preferences returns the saved UI preferences.
+func (ss *SettingsStore) Preferences() UIPreferences {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return UIPreferences{Theme: ss.settings.Theme, DefaultView: ss.settings.DefaultView, Units: ss.settings.Units, Zoom: ss.settings.Zoom, Language: ss.settings.Language}
+}
+
+// SetPreferences validates and saves the UI preferences.
+func (ss *SettingsStore) SetPreferences(prefs UIPreferences) error {
+	if err := prefs.Validate(); err != nil {
+		return err
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	previous := ss.settings
+	ss.settings.Theme, ss.settings.DefaultView, ss.settings.Units = prefs.Theme, prefs.DefaultView, prefs.Units
+	ss.settings.Zoom, ss.settings.Language = prefs.Zoom, prefs.Language
+	if err := ss.saveLocked(); err != nil {
+		ss.settings = previous
+		return err
+	}
+	return nil
+}
+
+// Save records values (config keys to values) and writes the file.
+func (ss *SettingsStore) Save(values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for key := range values {
+		if _, ok := configKeys[key]; !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if fileOnlyConfigKeys[key] {
+			return fmt.Errorf("setting %q can only be set in the config file or the environment", key)
+		}
+	}
+	if ss.settings.Values == nil {
+		ss.settings.Values = make(map[string]string)
+	}
+	for key, value := range values {
+		if secretConfigKeys[key] && ss.secrets != nil {
+			if err := ss.setSecretLocked(key, value); err != nil {
+				return err
+			}
+			delete(ss.settings.Values, key)
+			continue
+		}
+		ss.settings.Values[key] = value
+	}
+	return ss.saveLocked()
+}
+
+func (ss *SettingsStore) saveLocked() error {
+	data, err := json.MarshalIndent(ss.settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ss.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := ss.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return os.Rename(tmp, ss.path)
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RecordingSignatureHeader carries the hex HMAC-SHA256 of a recording request.
+const RecordingSignatureHeader = "X-Recording-Signature"
+
+// LoadRecordingSigningSecret returns the shared secret from RECORDING_SIGNING_SECRET,
+// or nil when recording requests are not signed.
+func LoadRecordingSigningSecret() []byte {
+	secret := strings.TrimSpace(os.Getenv("RECORDING_SIGNING_SECRET"))
+	if secret == "" {
+		return nil
+	}
+	LogInfo("[AUTH] Recording requests must be signed with RECORDING_SIGNING_SECRET")
+	return []byte(secret)
+}
+
+// SignRecording returns the hex HMAC-SHA256 over "<tabID>\n<timestamp>\n<body>".
+func SignRecording(secret []byte, tabID int, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%d\n", tabID, timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRecordingSignature reports whether signature matches the expected HMAC
+// for the request, comparing in constant time.
+func VerifyRecordingSignature(secret []byte, tabID int, timestamp int64, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	want, _ := hex.DecodeString(SignRecording(secret, tabID, timestamp, body))
+	return hmac.Equal(got, want)
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Longest values of a RecordingSource that are kept.
+const (
+	maxSourceURL      = 2048
+	maxSourceTitle    = 300
+	maxSourceMIMEType = 100
+	maxSourceSize     = 16384
+)
+
+// RecordingSource describes what a recording was made of, as the extension
+// saw it when the recording started: the page of the tab, the size of its
+// video and what MediaRecorder records it as. Any of it may be missing.
+type RecordingSource struct {
+	URL        string `json:"url,omitempty"`
+	Title      string `json:"title,omitempty"`
+	FavIconURL string `json:"favIconUrl,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	MIMEType   string `json:"mimeType,omitempty"`
+}
+
+// Clean returns s without what the extension should not have sent: links
+// that are not http or https, such as favicons inlined as data: URLs, and
+// values too long or out of range to be kept.
+func (s RecordingSource) Clean() RecordingSource {
+	s.URL = cleanSourceURL(s.URL)
+	s.FavIconURL = cleanSourceURL(s.FavIconURL)
+	s.Title = truncateRunes(strings.TrimSpace(s.Title), maxSourceTitle)
+	s.MIMEType = truncateRunes(strings.TrimSpace(s.MIMEType), maxSourceMIMEType)
+	if s.Width <= 0 || s.Height <= 0 || s.Width > maxSourceSize || s.Height > maxSourceSize {
+		s.Width, s.Height = 0, 0
+	}
+	return s
+}
+
+// Host returns the host name of the page the recording was made of.
+func (s RecordingSource) Host() string {
+	if u, err := url.Parse(s.URL); err == nil {
+		return strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	return ""
+}
+
+// Resolution returns the size of the video, such as 1920x1080, or "" when
+// it is not known.
+func (s RecordingSource) Resolution() string {
+	if s.Width == 0 {
+		return ""
+	}
+	return strconv.Itoa(s.Width) + "x" + strconv.Itoa(s.Height)
+}
+
+// Matches reports whether the page title or URL contains query, ignoring
+// case.
+func (s RecordingSource) Matches(query string) bool {
+	query = strings.ToLower(query)
+	return strings.Contains(strings.ToLower(s.Title), query) || strings.Contains(strings.ToLower(s.URL), query)
+}
+
+func cleanSourceURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > maxSourceURL {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return raw
+}
+
+// truncateRunes returns the first max characters of s.
+func truncateRunes(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// staticFFmpegURL is where static Linux builds of FFmpeg, which include
+	// ffprobe, are downloaded from, by architecture. FFMPEG_DOWNLOAD_URL
+	// overrides it.
+	staticFFmpegURL = "https://johnvansickle.com/ffmpeg/releases/ffmpeg-release-%s-static.tar.xz"
+	// maxStaticFFmpegSize is the largest archive downloaded; builds are
+	// about 40 MB.
+	maxStaticFFmpegSize = 256 << 20
+	staticFFmpegTimeout = 15 * time.Minute
+)
+
+// staticFFmpegSHA256 pins the SHA-256 digest of each static build the server
+// downloads, by URL. A digest fetched from the host of the build would only
+// show that the download was not cut short, since whoever could replace the
+// build could replace its checksum too, so a build is only installed when its
+// digest is pinned here or given by FFMPEG_DOWNLOAD_SHA256. The URLs of the
+// latest releases serve a new build with each release, and their digests are
+// pinned again when it has been checked.
+var staticFFmpegSHA256 = map[string]string{}
+
+// staticFFmpegArch names the static builds by GOARCH.
+var staticFFmpegArch = map[string]string{
+	"amd64": "amd64",
+	"arm64": "arm64",
+	"386":   "i686",
+	"arm":   "armhf",
+}
+
+// ManagedFFmpegDir returns the folder the static build of FFmpeg is installed
+// to, e.g. ~/.config/tab-recorder/ffmpeg.
+func ManagedFFmpegDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "tab-recorder", "ffmpeg"), nil
+}
+
+// UseManagedFFmpeg puts the static build of FFmpeg on the PATH of the server,
+// after the folders already on it, when it was installed, so that it is found
+// as "ffmpeg" like one installed by a package manager.
+func UseManagedFFmpeg() {
+	dir, err := ManagedFFmpegDir()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, executableName("ffmpeg"))); err == nil {
+		os.Setenv("PATH", os.Getenv("PATH")+string(os.PathListSeparator)+dir)
+	}
+}
+
+// linuxSandbox names the sandbox or read-only system the server runs in,
+// where the package manager cannot install FFmpeg for it, or returns "".
+func linuxSandbox() string {
+	switch {
+	case os.Getenv("SNAP") != "":
+		return "a snap"
+	case os.Getenv("FLATPAK_ID") != "" || fileExists("/.flatpak-info"):
+		return "a Flatpak"
+	case fileExists("/run/ostree-booted"):
+		return "an immutable OSTree system"
+	case fileExists("/usr/sbin/transactional-update"):
+		return "an immutable transactional-update system"
+	case osReleaseID() == "steamos":
+		return "SteamOS"
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// osReleaseID returns the ID of /etc/os-release, e.g. "ubuntu".
+func osReleaseID() string {
+	file, err := os.Open("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "ID="); ok {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// installStatic downloads the static build of FFmpeg and ffprobe for Linux
+// into ManagedFFmpegDir and puts it on the PATH, for systems where no package
+// manager can install them.
+func (fi *FFmpegInstaller) installStatic() error {
+	if fi.os != "linux" {
+		return fmt.Errorf("static FFmpeg builds are only downloaded on Linux")
+	}
+	url := os.Getenv("FFMPEG_DOWNLOAD_URL")
+	want := strings.TrimSpace(os.Getenv("FFMPEG_DOWNLOAD_SHA256"))
+	if url == "" {
+		arch, ok := staticFFmpegArch[runtime.GOARCH]
+		if !ok {
+			return fmt.Errorf("no static FFmpeg build for %s - please install FFmpeg manually from https://ffmpeg.org/download.html", runtime.GOARCH)
+		}
+		url = fmt.Sprintf(staticFFmpegURL, arch)
+	}
+	if want == "" {
+		want = staticFFmpegSHA256[url]
+	}
+	if want == "" {
+		return fmt.Errorf("no SHA-256 digest is pinned for %s - set FFMPEG_DOWNLOAD_SHA256 to that of the build, or install FFmpeg manually from https://ffmpeg.org/download.html", url)
+	}
+	dir, err := ManagedFFmpegDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	transport, err := NewProxyTransport("ffmpeg")
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport, Timeout: staticFFmpegTimeout}
+
+	format := archiveFormat(url)
+	if format == "" {
+		return fmt.Errorf("%s is not a .tar.xz, .tar.gz or .zip archive", url)
+	}
+
+	LogInfo("[INSTALLER] Downloading a static build of FFmpeg from %s...", url)
+	archive := filepath.Join(dir, "download"+format)
+	defer os.Remove(archive)
+	digest, err := fi.download(client, url, archive)
+	if err != nil {
+		return fmt.Errorf("failed to download FFmpeg: %w", err)
+	}
+	if !strings.EqualFold(want, digest) {
+		return fmt.Errorf("FFmpeg download checksum does not match")
+	}
+
+	return fi.installArchive(archive)
+}
+
+// download saves url to path and returns its SHA-256 digest, passing each whole
+// percent downloaded to fi.output, if set, as a line like "Downloaded 45%".
+func (fi *FFmpegInstaller) download(client *http.Client, url, path string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	var body io.Reader = io.LimitReader(resp.Body, maxStaticFFmpegSize+1)
+	if fi.output != nil && resp.ContentLength > 0 {
+		body = &downloadProgress{reader: body, total: resp.ContentLength, output: fi.output, percent: -1}
+	}
+	n, err := io.Copy(io.MultiWriter(file, hash), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > maxStaticFFmpegSize {
+		return "", fmt.Errorf("archive is larger than %d MB", maxStaticFFmpegSize>>20)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// downloadProgress reports how much of a download of total bytes was read.
+type downloadProgress struct {
+	reader  io.Reader
+	total   int64
+	read    int64
+	percent int64
+	output  func(line string)
+}
+
+func (dp *downloadProgress) Read(p []byte) (int, error) {
+	n, err := dp.reader.Read(p)
+	dp.read += int64(n)
+	if percent := min(dp.read*100/dp.total, 100); percent != dp.percent {
+		dp.percent = percent
+		dp.output(fmt.Sprintf("Downloaded %d%%", percent))
+	}
+	return n, err
+}
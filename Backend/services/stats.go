@@ -2,19 +2,59 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
 	statsSaveInterval = 5 * time.Second
+	statsDayFormat    = "2006-01-02"
+	// statsDailyRetention is how many days of per-day history are kept.
+	statsDailyRetention = 90
 )
 
+// ErrorKind identifies a class of failure tracked in Stats.
+type ErrorKind string
+
+const (
+	ErrorKindWrite  ErrorKind = "write"
+	ErrorKindDecode ErrorKind = "decode"
+	ErrorKindFFmpeg ErrorKind = "ffmpeg"
+
+	// ErrorKindRateLimit counts requests rejected by a rate limiter.
+	ErrorKindRateLimit ErrorKind = "rate_limit"
+
+	// ErrorKindSessionLimit counts recordings rejected because the limit of
+	// simultaneous recordings was reached.
+	ErrorKindSessionLimit ErrorKind = "session_limit"
+)
+
+// ErrorCounter counts failures of one kind and remembers the most recent one.
+type ErrorCounter struct {
+	Count     int64      `json:"count"`
+	LastError string     `json:"lastError,omitempty"`
+	LastAt    *time.Time `json:"lastAt,omitempty"`
+}
+
+// DailyStats holds the session count and bytes written on a single local day.
+// The last statsDailyRetention days are kept.
+type DailyStats struct {
+	Date      string `json:"date"`
+	Sessions  int    `json:"sessions"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
 type Stats struct {
-	TotalSizeBytes int64 `json:"totalSizeBytes"`
-	TotalSessions  int   `json:"totalSessions"`
+	TotalSizeBytes int64                       `json:"totalSizeBytes"`
+	TotalSessions  int                         `json:"totalSessions"`
+	Errors         map[ErrorKind]*ErrorCounter `json:"errors,omitempty"`
+	Daily          map[string]*DailyStats      `json:"daily,omitempty"`
 	mu             sync.Mutex
 	filePath       string
 	dirty          bool
@@ -85,6 +125,7 @@ func (s *Stats) Save() error {
 
 func (s *Stats) startPeriodicSave() {
 	go func() {
+		defer CapturePanic()
 		ticker := time.NewTicker(statsSaveInterval)
 		defer ticker.Stop()
 
@@ -108,10 +149,24 @@ func (s *Stats) Stop() {
 	close(s.stopChan)
 }
 
+// Reset clears every counter and removes the stats file.
+func (s *Stats) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.TotalSizeBytes, s.TotalSessions = 0, 0
+	s.Errors, s.Daily = nil, nil
+	s.dirty = false
+	if err := os.Remove(s.filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stats file: %w", err)
+	}
+	return nil
+}
+
 func (s *Stats) AddSize(bytes int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.TotalSizeBytes += bytes
+	s.today().SizeBytes += bytes
 	s.dirty = true
 }
 
@@ -119,9 +174,97 @@ func (s *Stats) IncrementSession() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.TotalSessions++
+	s.today().Sessions++
 	s.dirty = true
 }
 
+// today returns the bucket for the current local day, creating it if needed.
+// Callers must hold s.mu.
+func (s *Stats) today() *DailyStats {
+	date := time.Now().Format(statsDayFormat)
+	if s.Daily == nil {
+		s.Daily = make(map[string]*DailyStats)
+	}
+	day, ok := s.Daily[date]
+	if !ok {
+		day = &DailyStats{Date: date}
+		s.Daily[date] = day
+		pruneDaily(s.Daily, date)
+	}
+	return day
+}
+
+// pruneDaily removes the days of daily that are more than statsDailyRetention
+// days before the day today.
+func pruneDaily(daily map[string]*DailyStats, today string) {
+	day, err := time.Parse(statsDayFormat, today)
+	if err != nil {
+		return
+	}
+	oldest := day.AddDate(0, 0, 1-statsDailyRetention).Format(statsDayFormat)
+	for date := range daily {
+		if date < oldest {
+			delete(daily, date)
+		}
+	}
+}
+
+// GetDailyHistory returns a copy of the per-day history ordered from oldest to newest.
+func (s *Stats) GetDailyHistory() []DailyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make([]DailyStats, 0, len(s.Daily))
+	for _, day := range s.Daily {
+		history = append(history, *day)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Date < history[j].Date
+	})
+	return history
+}
+
+// RecordError increments the counter for kind and stores err as its last error.
+func (s *Stats) RecordError(kind ErrorKind, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Errors == nil {
+		s.Errors = make(map[ErrorKind]*ErrorCounter)
+	}
+	counter, ok := s.Errors[kind]
+	if !ok {
+		counter = &ErrorCounter{}
+		s.Errors[kind] = counter
+	}
+
+	now := time.Now()
+	counter.Count++
+	counter.LastAt = &now
+	if err != nil {
+		counter.LastError = err.Error()
+	}
+	s.dirty = true
+}
+
+// GetErrors returns a copy of the error counters for every tracked kind.
+// Kinds that have never failed are reported with a zero count.
+func (s *Stats) GetErrors() map[ErrorKind]ErrorCounter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := map[ErrorKind]ErrorCounter{
+		ErrorKindWrite:     {},
+		ErrorKindDecode:    {},
+		ErrorKindFFmpeg:    {},
+		ErrorKindRateLimit: {},
+	}
+	for kind, counter := range s.Errors {
+		counters[kind] = *counter
+	}
+	return counters
+}
+
 func (s *Stats) GetTotalSize() int64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -132,4 +275,136 @@ func (s *Stats) GetTotalSessions() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.TotalSessions
+}
+
+// StatsRepairResult reports the totals before and after a repair.
+type StatsRepairResult struct {
+	Directory      string `json:"directory"`
+	FilesScanned   int    `json:"filesScanned"`
+	BeforeSessions int    `json:"beforeSessions"`
+	BeforeBytes    int64  `json:"beforeBytes"`
+	AfterSessions  int    `json:"afterSessions"`
+	AfterBytes     int64  `json:"afterBytes"`
+	DryRun         bool   `json:"dryRun"`
+}
+
+// RecordingFile describes a finished recording on disk.
+type RecordingFile struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	SizeBytes int64     `json:"sizeBytes"`
+	Recorded  time.Time `json:"recorded"`
+}
+
+// ListRecordings returns the recordings in dir, newest first. Recordings are
+// dated like Repair dates them.
+func ListRecordings(dir string) ([]RecordingFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recordings directory: %w", err)
+	}
+
+	var recordings []RecordingFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !isRecordingFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, RecordingFile{
+			Name:      name,
+			Path:      filepath.Join(dir, name),
+			SizeBytes: info.Size(),
+			Recorded:  recordingTime(name, info.ModTime()),
+		})
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].Recorded.After(recordings[j].Recorded)
+	})
+	return recordings, nil
+}
+
+// Repair recomputes TotalSizeBytes, TotalSessions and the per-day history from the
+// recordings found in dir. Each recording file counts as one session, dated by the
+// timestamp embedded in its name (falling back to its modification time).
+// Error counters are kept. With dryRun the result is computed but not applied.
+func (s *Stats) Repair(dir string, dryRun bool) (StatsRepairResult, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return StatsRepairResult{}, fmt.Errorf("failed to read recordings directory: %w", err)
+	}
+
+	result := StatsRepairResult{Directory: dir, DryRun: dryRun}
+	daily := make(map[string]*DailyStats)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !isRecordingFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			LogError("[STATS] Repair skipped %s: %v", name, err)
+			continue
+		}
+
+		result.FilesScanned++
+		result.AfterSessions++
+		result.AfterBytes += info.Size()
+
+		date := recordingTime(name, info.ModTime()).Format(statsDayFormat)
+		day, ok := daily[date]
+		if !ok {
+			day = &DailyStats{Date: date}
+			daily[date] = day
+		}
+		day.Sessions++
+		day.SizeBytes += info.Size()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result.BeforeSessions = s.TotalSessions
+	result.BeforeBytes = s.TotalSizeBytes
+	if dryRun {
+		return result, nil
+	}
+
+	s.TotalSessions = result.AfterSessions
+	s.TotalSizeBytes = result.AfterBytes
+	pruneDaily(daily, time.Now().Format(statsDayFormat))
+	s.Daily = daily
+	s.dirty = true
+	if err := s.save(); err != nil {
+		return result, fmt.Errorf("failed to save repaired stats: %w", err)
+	}
+
+	LogInfo("[STATS] Repaired stats from %d files - Sessions: %d -> %d, Size: %d -> %d bytes",
+		result.FilesScanned, result.BeforeSessions, result.AfterSessions, result.BeforeBytes, result.AfterBytes)
+	return result, nil
+}
+
+// recordingTime extracts the millisecond timestamp from a "{name}_{tabID}_{timestamp}.ext"
+// file name, returning fallback when the name does not follow that pattern.
+// Naming templates can end a name with other numbers (a tab ID, a "_2"
+// suffix), so the suffix only counts when it is a plausible start time: after
+// 2001 and not later than fallback, the file's modification time.
+func recordingTime(name string, fallback time.Time) time.Time {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	idx := strings.LastIndex(base, "_")
+	if idx < 0 {
+		return fallback
+	}
+	ms, err := strconv.ParseInt(base[idx+1:], 10, 64)
+	if err != nil || ms < 1e12 {
+		return fallback
+	}
+	if started := time.UnixMilli(ms); !started.After(fallback) {
+		return started
+	}
+	return fallback
 }
\ No newline at end of file
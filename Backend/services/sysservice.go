@@ -0,0 +1,54 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// systemServiceName is the name the recorder is registered under with the OS
+// service manager.
+const systemServiceName = "tab-recorder"
+
+// SystemService registers the recorder with the OS service manager (systemd,
+// launchd or the Windows Task Scheduler) so it runs headless without anyone
+// opening the desktop app.
+type SystemService struct {
+	Name       string
+	Executable string
+	Args       []string
+	WorkDir    string
+}
+
+// NewSystemService describes a service that runs this executable with args,
+// in the current working directory so relative paths resolve as they do now.
+func NewSystemService(args []string) (*SystemService, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return &SystemService{Name: systemServiceName, Executable: exe, Args: args, WorkDir: wd}, nil
+}
+
+// runServiceCommand runs a service manager command, folding its output into
+// the error when it fails.
+func runServiceCommand(name string, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,127 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const launchdLabel = "com.tabrecorder.server"
+
+// As root the job is a LaunchDaemon, which starts at boot. Otherwise it is a
+// LaunchAgent, which starts when the user logs in.
+func (s *SystemService) launchd() (plistPath, domain string, err error) {
+	if os.Geteuid() == 0 {
+		return filepath.Join("/Library/LaunchDaemons", launchdLabel+".plist"), "system", nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), fmt.Sprintf("gui/%d", os.Getuid()), nil
+}
+
+func (s *SystemService) plist() string {
+	var args strings.Builder
+	for _, arg := range append([]string{s.Executable}, s.Args...) {
+		args.WriteString("\t\t<string>")
+		xml.EscapeText(&args, []byte(arg))
+		args.WriteString("</string>\n")
+	}
+	var workDir strings.Builder
+	xml.EscapeText(&workDir, []byte(s.WorkDir))
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+</dict>
+</plist>
+`, launchdLabel, args.String(), workDir.String())
+}
+
+// Install writes the launchd property list and loads it.
+func (s *SystemService) Install() error {
+	path, domain, err := s.launchd()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create launchd directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(s.plist()), 0644); err != nil {
+		return fmt.Errorf("failed to write launchd plist: %w", err)
+	}
+	if _, err := runServiceCommand("launchctl", "bootstrap", domain, path); err != nil {
+		return err
+	}
+	LogInfo("[SERVICE] Installed launchd job %s", path)
+	return nil
+}
+
+// Uninstall unloads the job and removes its property list.
+func (s *SystemService) Uninstall() error {
+	path, domain, err := s.launchd()
+	if err != nil {
+		return err
+	}
+	runServiceCommand("launchctl", "bootout", domain+"/"+launchdLabel)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove launchd plist: %w", err)
+	}
+	LogInfo("[SERVICE] Removed launchd job %s", path)
+	return nil
+}
+
+func (s *SystemService) Start() error {
+	_, domain, err := s.launchd()
+	if err != nil {
+		return err
+	}
+	_, err = runServiceCommand("launchctl", "kickstart", domain+"/"+launchdLabel)
+	return err
+}
+
+func (s *SystemService) Stop() error {
+	_, domain, err := s.launchd()
+	if err != nil {
+		return err
+	}
+	_, err = runServiceCommand("launchctl", "kill", "SIGTERM", domain+"/"+launchdLabel)
+	return err
+}
+
+// Status returns "running", "stopped" or "not installed".
+func (s *SystemService) Status() (string, error) {
+	_, domain, err := s.launchd()
+	if err != nil {
+		return "", err
+	}
+	out, err := runServiceCommand("launchctl", "print", domain+"/"+launchdLabel)
+	if err != nil {
+		return "not installed", nil
+	}
+	if strings.Contains(out, "state = running") {
+		return "running", nil
+	}
+	return "stopped", nil
+}
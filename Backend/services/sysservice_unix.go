@@ -0,0 +1,118 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// As root the unit is installed system-wide and starts at boot. Otherwise it
+// is a user unit, which starts at boot only with lingering enabled
+// (loginctl enable-linger).
+func (s *SystemService) systemd() (unitPath string, ctl []string, err error) {
+	unit := s.Name + ".service"
+	if os.Geteuid() == 0 {
+		return filepath.Join("/etc/systemd/system", unit), nil, nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(config, "systemd", "user", unit), []string{"--user"}, nil
+}
+
+func (s *SystemService) unitFile() string {
+	exec := []string{strconv.Quote(s.Executable)}
+	for _, arg := range s.Args {
+		exec = append(exec, strconv.Quote(arg))
+	}
+	wantedBy := "multi-user.target"
+	if os.Geteuid() != 0 {
+		wantedBy = "default.target"
+	}
+	return fmt.Sprintf(`[Unit]
+Description=Tab recording server
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s
+WorkingDirectory=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=%s
+`, strings.Join(exec, " "), s.WorkDir, wantedBy)
+}
+
+// Install writes the systemd unit and enables it.
+func (s *SystemService) Install() error {
+	path, ctl, err := s.systemd()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create unit directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(s.unitFile()), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+	if _, err := runServiceCommand("systemctl", append(ctl, "daemon-reload")...); err != nil {
+		return err
+	}
+	if _, err := runServiceCommand("systemctl", append(ctl, "enable", s.Name)...); err != nil {
+		return err
+	}
+	LogInfo("[SERVICE] Installed systemd unit %s", path)
+	return nil
+}
+
+// Uninstall stops and disables the unit and removes it.
+func (s *SystemService) Uninstall() error {
+	path, ctl, err := s.systemd()
+	if err != nil {
+		return err
+	}
+	runServiceCommand("systemctl", append(ctl, "disable", "--now", s.Name)...)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	runServiceCommand("systemctl", append(ctl, "daemon-reload")...)
+	LogInfo("[SERVICE] Removed systemd unit %s", path)
+	return nil
+}
+
+func (s *SystemService) Start() error {
+	_, ctl, err := s.systemd()
+	if err != nil {
+		return err
+	}
+	_, err = runServiceCommand("systemctl", append(ctl, "start", s.Name)...)
+	return err
+}
+
+func (s *SystemService) Stop() error {
+	_, ctl, err := s.systemd()
+	if err != nil {
+		return err
+	}
+	_, err = runServiceCommand("systemctl", append(ctl, "stop", s.Name)...)
+	return err
+}
+
+// Status returns systemd's state for the unit, such as "active" or "inactive".
+func (s *SystemService) Status() (string, error) {
+	_, ctl, err := s.systemd()
+	if err != nil {
+		return "", err
+	}
+	// is-active exits non-zero for anything but "active", so only its output matters.
+	out, _ := runServiceCommand("systemctl", append(ctl, "is-active", s.Name)...)
+	return strings.TrimSpace(out), nil
+}
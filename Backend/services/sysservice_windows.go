@@ -0,0 +1,68 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// On Windows the recorder is registered as a scheduled task that runs at
+// startup under the SYSTEM account. A real Windows service would need the
+// binary to speak the service control protocol, which it does not; a startup
+// task gives the same result of running headless before anyone logs in.
+func (s *SystemService) taskCommand() string {
+	parts := []string{syscall.EscapeArg(s.Executable)}
+	for _, arg := range s.Args {
+		parts = append(parts, syscall.EscapeArg(arg))
+	}
+	// The task's working directory is System32, so a wrapper cd is needed for
+	// relative paths to resolve as they do when run by hand.
+	return fmt.Sprintf(`cmd /c cd /d %s && %s`, syscall.EscapeArg(s.WorkDir), strings.Join(parts, " "))
+}
+
+// Install creates the startup task. It needs an elevated prompt.
+func (s *SystemService) Install() error {
+	if _, err := runServiceCommand("schtasks", "/Create", "/F", "/TN", s.Name,
+		"/TR", s.taskCommand(), "/SC", "ONSTART", "/RU", "SYSTEM", "/RL", "HIGHEST"); err != nil {
+		return err
+	}
+	LogInfo("[SERVICE] Installed startup task %s", s.Name)
+	return nil
+}
+
+// Uninstall stops and deletes the startup task.
+func (s *SystemService) Uninstall() error {
+	runServiceCommand("schtasks", "/End", "/TN", s.Name)
+	if _, err := runServiceCommand("schtasks", "/Delete", "/F", "/TN", s.Name); err != nil {
+		return err
+	}
+	LogInfo("[SERVICE] Removed startup task %s", s.Name)
+	return nil
+}
+
+func (s *SystemService) Start() error {
+	_, err := runServiceCommand("schtasks", "/Run", "/TN", s.Name)
+	return err
+}
+
+func (s *SystemService) Stop() error {
+	_, err := runServiceCommand("schtasks", "/End", "/TN", s.Name)
+	return err
+}
+
+// Status returns the task's status as reported by schtasks, e.g. "Running" or "Ready".
+func (s *SystemService) Status() (string, error) {
+	out, err := runServiceCommand("schtasks", "/Query", "/TN", s.Name, "/FO", "LIST")
+	if err != nil {
+		return "not installed", nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "Status" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "unknown", nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	timeSeriesSecondSamples  = 3600
+	timeSeriesMinuteSamples  = 1440
+	timeSeriesSessionSamples = 600
+)
+
+// ThroughputSample is the number of bytes ingested during one interval
+// starting at Time (unix seconds).
+type ThroughputSample struct {
+	Time  int64 `json:"t"`
+	Bytes int64 `json:"bytes"`
+}
+
+type sampleRing struct {
+	samples []ThroughputSample
+	next    int
+	full    bool
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{samples: make([]ThroughputSample, size)}
+}
+
+func (r *sampleRing) push(sample ThroughputSample) {
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns samples at or after the given unix time, oldest first.
+func (r *sampleRing) since(since int64) []ThroughputSample {
+	var ordered []ThroughputSample
+	if r.full {
+		ordered = append(ordered, r.samples[r.next:]...)
+	}
+	ordered = append(ordered, r.samples[:r.next]...)
+
+	result := make([]ThroughputSample, 0, len(ordered))
+	for _, sample := range ordered {
+		if sample.Time >= since {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// TimeSeriesStore keeps recent ingest throughput in fixed-size rings:
+// one-second samples for the last hour and one-minute samples for the last day
+// globally, plus one-second samples for the last ten minutes of each active session.
+type TimeSeriesStore struct {
+	mu           sync.Mutex
+	second       *sampleRing
+	minute       *sampleRing
+	sessions     map[int]*sampleRing
+	pending      map[int]int64
+	pendingTotal int64
+	minuteStart  int64
+	minuteTotal  int64
+	stopChan     chan struct{}
+}
+
+// NewTimeSeriesStore creates a store and starts sampling once per second.
+func NewTimeSeriesStore() *TimeSeriesStore {
+	ts := &TimeSeriesStore{
+		second:      newSampleRing(timeSeriesSecondSamples),
+		minute:      newSampleRing(timeSeriesMinuteSamples),
+		sessions:    make(map[int]*sampleRing),
+		pending:     make(map[int]int64),
+		minuteStart: time.Now().Truncate(time.Minute).Unix(),
+		stopChan:    make(chan struct{}),
+	}
+	ts.startSampling()
+	return ts
+}
+
+func (ts *TimeSeriesStore) startSampling() {
+	go func() {
+		defer CapturePanic()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				ts.sample(now)
+			case <-ts.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (ts *TimeSeriesStore) Stop() {
+	close(ts.stopChan)
+}
+
+// Record adds bytes ingested for tabID to the current one-second interval.
+func (ts *TimeSeriesStore) Record(tabID int, bytes int64) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.pending[tabID] += bytes
+	ts.pendingTotal += bytes
+	if _, ok := ts.sessions[tabID]; !ok {
+		ts.sessions[tabID] = newSampleRing(timeSeriesSessionSamples)
+	}
+}
+
+// EndSession drops the per-session series for tabID.
+func (ts *TimeSeriesStore) EndSession(tabID int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.sessions, tabID)
+	delete(ts.pending, tabID)
+}
+
+func (ts *TimeSeriesStore) sample(now time.Time) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	t := now.Add(-time.Second).Unix()
+	ts.second.push(ThroughputSample{Time: t, Bytes: ts.pendingTotal})
+	for tabID, ring := range ts.sessions {
+		ring.push(ThroughputSample{Time: t, Bytes: ts.pending[tabID]})
+	}
+
+	minute := time.Unix(t, 0).Truncate(time.Minute).Unix()
+	if minute != ts.minuteStart {
+		ts.minute.push(ThroughputSample{Time: ts.minuteStart, Bytes: ts.minuteTotal})
+		ts.minuteStart = minute
+		ts.minuteTotal = 0
+	}
+	ts.minuteTotal += ts.pendingTotal
+
+	ts.pendingTotal = 0
+	for tabID := range ts.pending {
+		delete(ts.pending, tabID)
+	}
+}
+
+// Global returns global samples since the given unix time at "second" or
+// "minute" resolution.
+func (ts *TimeSeriesStore) Global(resolution string, since int64) []ThroughputSample {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if resolution == "minute" {
+		return ts.minute.since(since)
+	}
+	return ts.second.since(since)
+}
+
+// Sessions returns per-second samples since the given unix time for every
+// active session, keyed by tab ID.
+func (ts *TimeSeriesStore) Sessions(since int64) map[int][]ThroughputSample {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	result := make(map[int][]ThroughputSample, len(ts.sessions))
+	for tabID, ring := range ts.sessions {
+		result[tabID] = ring.since(since)
+	}
+	return result
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenewal  = 30 * 24 * time.Hour
+)
+
+// LoadTLSConfig returns the server TLS configuration, or nil when TLS is disabled.
+// TLS is enabled by TLS_ENABLED=true or by providing TLS_CERT_FILE and TLS_KEY_FILE.
+// Without user-provided files a self-signed certificate is generated under
+// dir/tls and reused until it is close to expiry.
+//
+// Client certificates are required when TLS_CLIENT_CA_FILE names a PEM bundle of
+// trusted CAs, or when TLS_CLIENT_AUTH=true, which trusts the local client CA
+// used by IssueClientCertificate. Either implies TLS_ENABLED.
+func LoadTLSConfig(dir string) (*tls.Config, error) {
+	certFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	clientCAFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if clientCAFile == "" && isTruthy(os.Getenv("TLS_CLIENT_AUTH")) {
+		clientCAFile = filepath.Join(dir, "tls", "client-ca.pem")
+		if _, _, err := loadOrCreateClientCA(clientCAFile, filepath.Join(dir, "tls", "client-ca-key.pem")); err != nil {
+			return nil, err
+		}
+	}
+	enabled := isTruthy(os.Getenv("TLS_ENABLED")) || clientCAFile != ""
+
+	if certFile == "" && keyFile == "" && !enabled {
+		return nil, nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if certFile == "" {
+		certFile = filepath.Join(dir, "tls", "cert.pem")
+		keyFile = filepath.Join(dir, "tls", "key.pem")
+		if err := ensureSelfSignedCert(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	LogInfo("[TLS] Using certificate %s (SHA-256 %s)", certFile, CertificateFingerprint(cert))
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		caPEM, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		LogInfo("[TLS] Client certificates required (trusted CAs from %s)", clientCAFile)
+	}
+
+	return config, nil
+}
+
+// IssueClientCertificate issues a client certificate for name signed by the local
+// client CA under dir/tls, creating the CA on first use. It returns the PEM-encoded
+// certificate and private key; the CA certificate lives at dir/tls/client-ca.pem.
+func IssueClientCertificate(dir, name string, validity time.Duration) ([]byte, []byte, error) {
+	caCertFile := filepath.Join(dir, "tls", "client-ca.pem")
+	caKeyFile := filepath.Join(dir, "tls", "client-ca-key.pem")
+
+	caCert, caKey, err := loadOrCreateClientCA(caCertFile, caKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate client key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Tab Recorder"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create client certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode client key: %w", err)
+	}
+
+	LogInfo("[TLS] Issued client certificate for %q (valid until %s)", name, template.NotAfter.Format("2006-01-02"))
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
+
+func loadOrCreateClientCA(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse client CA: %w", err)
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported client CA key type")
+		}
+		return cert, key, nil
+	}
+
+	LogInfo("[TLS] Generating client CA at %s", certFile)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate client CA key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Recording Server Client CA", Organization: []string{"Tab Recorder"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(10 * selfSignedValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create client CA: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode client CA key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write client CA: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write client CA key: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse client CA: %w", err)
+	}
+	return cert, key, nil
+}
+
+// CertificateFingerprint returns the colon-separated SHA-256 fingerprint of the leaf certificate.
+func CertificateFingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	hexSum := strings.ToUpper(hex.EncodeToString(sum[:]))
+	parts := make([]string, 0, len(sum))
+	for i := 0; i < len(hexSum); i += 2 {
+		parts = append(parts, hexSum[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+func ensureSelfSignedCert(certFile, keyFile string) error {
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > selfSignedRenewal {
+			return nil
+		}
+		LogInfo("[TLS] Self-signed certificate expires soon, regenerating")
+	}
+
+	LogInfo("[TLS] Generating self-signed certificate at %s", certFile)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate TLS key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Recording Server", Organization: []string{"Tab Recorder"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode TLS key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write TLS key: %w", err)
+	}
+	return nil
+}
+
+// TLSEnabled reports whether LoadTLSConfig would serve HTTPS with the current
+// settings, without loading or creating any certificate.
+func TLSEnabled() bool {
+	return isTruthy(os.Getenv("TLS_ENABLED")) || isTruthy(os.Getenv("TLS_CLIENT_AUTH")) ||
+		os.Getenv("TLS_CLIENT_CA_FILE") != "" || os.Getenv("TLS_CERT_FILE") != "" || os.Getenv("TLS_KEY_FILE") != ""
+}
+
+func isTruthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
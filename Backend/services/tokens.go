@@ -0,0 +1,251 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTokenNotFound is returned by TokenStore.Revoke for an unknown token ID.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenScope is a permission granted to an API token.
+type TokenScope string
+
+const (
+	// ScopeRead allows GET requests for stats, alerts, crash reports and downloads.
+	ScopeRead TokenScope = "read"
+	// ScopeIngest allows uploading recordings.
+	ScopeIngest TokenScope = "ingest"
+	// ScopeAdmin allows everything, including changing configuration.
+	ScopeAdmin TokenScope = "admin"
+)
+
+// HasScope reports whether granted satisfies required. Admin satisfies every
+// scope and an empty required scope is satisfied by any token.
+func HasScope(granted []TokenScope, required TokenScope) bool {
+	for _, scope := range granted {
+		if scope == ScopeAdmin || scope == required || required == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes parses a comma-separated scope list such as "read,ingest".
+func ParseScopes(value string) ([]TokenScope, error) {
+	var scopes []TokenScope
+	for _, part := range strings.Split(value, ",") {
+		scope := TokenScope(strings.ToLower(strings.TrimSpace(part)))
+		switch scope {
+		case "":
+			continue
+		case ScopeRead, ScopeIngest, ScopeAdmin:
+			scopes = append(scopes, scope)
+		default:
+			return nil, fmt.Errorf("unknown scope %q", part)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// APIToken describes an issued scoped token. Only a hash of the token is kept.
+type APIToken struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Scopes    []TokenScope `json:"scopes"`
+	Hash      string       `json:"hash,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// TokenStore keeps the scoped API tokens issued in addition to the primary
+// admin token, persisted as JSON with hashed token values.
+type TokenStore struct {
+	path   string
+	tokens []*APIToken
+	mu     sync.Mutex
+}
+
+// LoadTokenStore reads the token list at path; a missing file is an empty store.
+func LoadTokenStore(path string) (*TokenStore, error) {
+	ts := &TokenStore{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ts, nil
+		}
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	if err := json.Unmarshal(data, &ts.tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	return ts, nil
+}
+
+// Issue creates a token with the given scopes and returns its value, which is
+// not stored and cannot be retrieved again.
+func (ts *TokenStore) Issue(name string, scopes []TokenScope) (string, APIToken, error) {
+	value, err := generateToken()
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	id, err := generateToken()
+	if err != nil {
+		return "", APIToken{}, err
+	}
+
+	token := &APIToken{
+		ID:        id[:12],
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      hashToken(value),
+		CreatedAt: time.Now(),
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens = append(ts.tokens, token)
+	if err := ts.saveLocked(); err != nil {
+		ts.tokens = ts.tokens[:len(ts.tokens)-1]
+		return "", APIToken{}, err
+	}
+	LogInfo("[AUTH] Issued token %s (%s) with scopes %v", token.ID, name, scopes)
+	return value, token.public(), nil
+}
+
+// List returns the issued tokens without their hashes.
+func (ts *TokenStore) List() []APIToken {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tokens := make([]APIToken, 0, len(ts.tokens))
+	for _, token := range ts.tokens {
+		tokens = append(tokens, token.public())
+	}
+	return tokens
+}
+
+// Revoke deletes the token with the given ID; it stops working immediately.
+func (ts *TokenStore) Revoke(id string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for i, token := range ts.tokens {
+		if token.ID != id {
+			continue
+		}
+		remaining := append(append([]*APIToken(nil), ts.tokens[:i]...), ts.tokens[i+1:]...)
+		previous := ts.tokens
+		ts.tokens = remaining
+		if err := ts.saveLocked(); err != nil {
+			ts.tokens = previous
+			return err
+		}
+		LogInfo("[AUTH] Revoked token %s (%s)", token.ID, token.Name)
+		return nil
+	}
+	return ErrTokenNotFound
+}
+
+// Export returns the issued tokens with their hashes, for a backup.
+func (ts *TokenStore) Export() []APIToken {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tokens := make([]APIToken, 0, len(ts.tokens))
+	for _, token := range ts.tokens {
+		copied := *token
+		copied.Scopes = append([]TokenScope(nil), token.Scopes...)
+		tokens = append(tokens, copied)
+	}
+	return tokens
+}
+
+// Import adds tokens taken from a backup, skipping any whose ID or hash is
+// already known, and returns how many it added.
+func (ts *TokenStore) Import(tokens []APIToken) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	known := make(map[string]bool, 2*len(ts.tokens))
+	for _, token := range ts.tokens {
+		known[token.ID] = true
+		known[token.Hash] = true
+	}
+	previous := ts.tokens
+	added := 0
+	for _, token := range tokens {
+		if token.ID == "" || token.Hash == "" || known[token.ID] || known[token.Hash] {
+			continue
+		}
+		if len(token.Scopes) == 0 {
+			return 0, fmt.Errorf("token %s has no scopes", token.ID)
+		}
+		copied := token
+		ts.tokens = append(ts.tokens, &copied)
+		known[token.ID] = true
+		known[token.Hash] = true
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	if err := ts.saveLocked(); err != nil {
+		ts.tokens = previous
+		return 0, err
+	}
+	LogInfo("[AUTH] Imported %d token(s)", added)
+	return added, nil
+}
+
+// Lookup returns the scopes granted to value, if it is an issued token.
+func (ts *TokenStore) Lookup(value string) ([]TokenScope, bool) {
+	if ts == nil || value == "" {
+		return nil, false
+	}
+	hash := hashToken(value)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, token := range ts.tokens {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(token.Hash)) == 1 {
+			return token.Scopes, true
+		}
+	}
+	return nil, false
+}
+
+func (t *APIToken) public() APIToken {
+	copied := *t
+	copied.Hash = ""
+	copied.Scopes = append([]TokenScope(nil), t.Scopes...)
+	return copied
+}
+
+func (ts *TokenStore) saveLocked() error {
+	data, err := json.MarshalIndent(ts.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := ts.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write tokens: %w", err)
+	}
+	return os.Rename(tmp, ts.path)
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
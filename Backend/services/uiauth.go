@@ -0,0 +1,237 @@
+package services
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	uiSessionTTL       = 12 * time.Hour
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+	passwordKeyLength  = 32
+)
+
+// UIAuth guards the UI with a password and issues server-side login sessions.
+// A nil *UIAuth means no password is configured and the UI is open.
+type UIAuth struct {
+	hash     string
+	sessions map[string]*uiSession
+	mu       sync.Mutex
+}
+
+// uiSession is a login session and the CSRF token bound to it.
+type uiSession struct {
+	expires time.Time
+	csrf    string
+}
+
+// LoadUIAuth returns the UI password guard, or nil when no password is set.
+// UI_PASSWORD_HASH takes precedence over the hash stored at path, which is
+// written by the "set-password" command.
+func LoadUIAuth(path string) (*UIAuth, error) {
+	hash, err := ReadUIPasswordHash(path)
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		return nil, nil
+	}
+	if err := checkPasswordHash(hash); err != nil {
+		return nil, err
+	}
+
+	LogInfo("[AUTH] UI login required")
+	return &UIAuth{hash: hash, sessions: make(map[string]*uiSession)}, nil
+}
+
+// SetUIPassword hashes password and stores it at path, replacing any previous one.
+func SetUIPassword(path, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return SetUIPasswordHash(path, hash)
+}
+
+// SetUIPasswordHash stores a hash produced by HashPassword or a bcrypt hash at
+// path, replacing any previous one. It takes effect the next time the server
+// starts.
+func SetUIPasswordHash(path, hash string) error {
+	if err := checkPasswordHash(hash); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hash+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write UI password: %w", err)
+	}
+	return nil
+}
+
+// ReadUIPasswordHash returns the UI password hash in effect, as LoadUIAuth
+// finds it, or "" when the UI is open.
+func ReadUIPasswordHash(path string) (string, error) {
+	if hash := strings.TrimSpace(os.Getenv("UI_PASSWORD_HASH")); hash != "" {
+		return hash, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read UI password: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// HashPassword returns a salted PBKDF2-SHA256 hash in the form
+// "pbkdf2-sha256$<iterations>$<salt>$<key>". PBKDF2 is the default because it
+// comes with the standard library and is FIPS 140 approved, and it has no
+// 72-byte limit on the password as bcrypt does. Hashes from standard tools,
+// e.g. "htpasswd -nbB", are accepted too; see VerifyPassword.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches a hash produced by
+// HashPassword or a bcrypt hash ("$2a$", "$2b$" or "$2y$").
+func VerifyPassword(hash, password string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	iterations, salt, want, err := parsePasswordHash(hash)
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// checkPasswordHash returns an error unless hash is one VerifyPassword accepts.
+func checkPasswordHash(hash string) error {
+	if isBcryptHash(hash) {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid UI password bcrypt hash: %w", err)
+		}
+		return nil
+	}
+	_, _, _, err := parsePasswordHash(hash)
+	return err
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func parsePasswordHash(hash string) (int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return 0, nil, nil, fmt.Errorf("unsupported UI password hash format")
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, nil, nil, fmt.Errorf("invalid UI password hash iterations")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("invalid UI password hash salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid UI password hash key")
+	}
+	return iterations, salt, key, nil
+}
+
+// Login checks password and, if it matches, returns a new session ID and the
+// CSRF token that state-changing requests in that session must echo back.
+func (a *UIAuth) Login(password string) (string, string, bool) {
+	if !VerifyPassword(a.hash, password) {
+		return "", "", false
+	}
+	id, err := generateToken()
+	if err != nil {
+		LogError("[AUTH] Failed to create session: %v", err)
+		return "", "", false
+	}
+	csrf, err := generateToken()
+	if err != nil {
+		LogError("[AUTH] Failed to create session: %v", err)
+		return "", "", false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneLocked()
+	a.sessions[id] = &uiSession{expires: time.Now().Add(uiSessionTTL), csrf: csrf}
+	return id, csrf, true
+}
+
+// ValidSession reports whether id is a live session, extending it on use.
+func (a *UIAuth) ValidSession(id string) bool {
+	return a.session(id) != nil
+}
+
+// ValidCSRF reports whether token is the CSRF token of the live session id.
+func (a *UIAuth) ValidCSRF(id, token string) bool {
+	session := a.session(id)
+	return session != nil && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.csrf)) == 1
+}
+
+func (a *UIAuth) session(id string) *uiSession {
+	if a == nil || id == "" {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session, ok := a.sessions[id]
+	if !ok || time.Now().After(session.expires) {
+		delete(a.sessions, id)
+		return nil
+	}
+	session.expires = time.Now().Add(uiSessionTTL)
+	return session
+}
+
+// Logout ends the session id.
+func (a *UIAuth) Logout(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+func (a *UIAuth) pruneLocked() {
+	now := time.Now()
+	for id, session := range a.sessions {
+		if now.After(session.expires) {
+			delete(a.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpdatePublicKey is the base64 Ed25519 key release binaries are signed with,
+// set at build time with -ldflags "-X recorder/services.UpdatePublicKey=...".
+// It cannot be changed at run time, so that whoever can set the environment or
+// the config file cannot have their own binaries installed. Without a key no
+// update is installed.
+var UpdatePublicKey = ""
+
+const (
+	defaultUpdateFeedURL = "https://github.com/avijitbhuin21/TAB-RECORDER/releases/latest/download/update.json"
+	updateCheckInterval  = 24 * time.Hour
+	updatePollInterval   = time.Hour
+	maxUpdateSize        = 256 << 20
+	// stagedUpdateSuffix marks a verified update next to the executable,
+	// waiting to replace it on the next start.
+	stagedUpdateSuffix = ".update"
+)
+
+// UpdateFeed is the release feed: the latest version and a binary per platform.
+type UpdateFeed struct {
+	Version string                 `json:"version"`
+	Notes   string                 `json:"notes,omitempty"`
+	Assets  map[string]UpdateAsset `json:"assets"` // keyed by GOOS-GOARCH
+}
+
+// UpdateAsset is a release binary. Signature is the base64 Ed25519 signature
+// of the message updateSignedMessage makes of the release's version, the
+// asset's platform and the binary's SHA-256 digest, so that a signed binary
+// cannot be served as another version, e.g. an old one with known flaws as the
+// latest, or for another platform.
+type UpdateAsset struct {
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// UpdateStatus reports what the updater knows about available releases.
+type UpdateStatus struct {
+	Current   string    `json:"current"`
+	Latest    string    `json:"latest,omitempty"`
+	Available bool      `json:"available"`
+	Notes     string    `json:"notes,omitempty"`
+	Staged    string    `json:"staged,omitempty"` // installed on next restart
+	Auto      bool      `json:"auto"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Updater checks the release feed and stages verified updates, which
+// ApplyStagedUpdate swaps in on the next start. It checks daily so that the UI
+// can offer new releases; with auto-update enabled it also stages them by
+// itself.
+type Updater struct {
+	feedURL    string
+	publicKey  ed25519.PublicKey
+	executable string
+	client     *http.Client
+	latest     *UpdateFeed
+	status     UpdateStatus
+	mu         sync.Mutex
+	stopChan   chan struct{}
+}
+
+// NewUpdater creates an updater for the running executable from
+// UPDATE_FEED_URL, UPDATE_AUTO and UPDATE_PROXY.
+func NewUpdater() (*Updater, error) {
+	executable, err := currentExecutable()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := NewProxyTransport("update")
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Updater{
+		feedURL:    defaultUpdateFeedURL,
+		executable: executable,
+		client:     &http.Client{Transport: transport, Timeout: 10 * time.Minute},
+		status:     UpdateStatus{Current: Version},
+		stopChan:   make(chan struct{}),
+	}
+	if url := os.Getenv("UPDATE_FEED_URL"); url != "" {
+		u.feedURL = url
+	}
+	if UpdatePublicKey != "" {
+		raw, err := base64.StdEncoding.DecodeString(UpdatePublicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid update public key")
+		}
+		u.publicKey = raw
+	}
+	u.status.Auto, _ = strconv.ParseBool(os.Getenv("UPDATE_AUTO"))
+	return u, nil
+}
+
+// Status returns the result of the last check.
+func (u *Updater) Status() UpdateStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.status
+}
+
+// SetAuto turns automatic updates on or off.
+func (u *Updater) SetAuto(auto bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status.Auto = auto
+}
+
+// Check fetches the release feed and reports whether a newer version exists.
+func (u *Updater) Check(ctx context.Context) (UpdateStatus, error) {
+	feed, err := u.fetchFeed(ctx)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status.CheckedAt = time.Now()
+	if err != nil {
+		u.status.Error = err.Error()
+		return u.status, err
+	}
+	u.latest = feed
+	u.status.Latest = feed.Version
+	u.status.Notes = feed.Notes
+	u.status.Available = compareVersions(feed.Version, Version) > 0
+	u.status.Error = ""
+	return u.status, nil
+}
+
+// Install downloads the latest release for this platform, verifies its
+// checksum and signature, and stages it to replace the executable on the next
+// start.
+func (u *Updater) Install(ctx context.Context) (UpdateStatus, error) {
+	status, err := u.Check(ctx)
+	if err != nil {
+		return status, err
+	}
+	if !status.Available {
+		return status, nil
+	}
+	if status.Staged == status.Latest {
+		return status, nil
+	}
+
+	u.mu.Lock()
+	feed := u.latest
+	u.mu.Unlock()
+
+	err = u.stage(ctx, feed)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err != nil {
+		u.status.Error = err.Error()
+		return u.status, err
+	}
+	u.status.Staged = feed.Version
+	LogInfo("[UPDATE] Version %s downloaded and verified; it will be installed on the next restart", feed.Version)
+	return u.status, nil
+}
+
+func (u *Updater) Start() {
+	go func() {
+		defer CapturePanic()
+		u.autoUpdate()
+
+		ticker := time.NewTicker(updatePollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				u.autoUpdate()
+			case <-u.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (u *Updater) Stop() {
+	close(u.stopChan)
+}
+
+func (u *Updater) autoUpdate() {
+	status := u.Status()
+	if time.Since(status.CheckedAt) < updateCheckInterval {
+		return
+	}
+	if !status.Auto {
+		if status, err := u.Check(context.Background()); err != nil {
+			LogError("[UPDATE] Update check failed: %v", err)
+		} else if status.Available {
+			LogInfo("[UPDATE] Version %s is available", status.Latest)
+		}
+		return
+	}
+	if _, err := u.Install(context.Background()); err != nil {
+		LogError("[UPDATE] Automatic update failed: %v", err)
+	}
+}
+
+func (u *Updater) fetchFeed(ctx context.Context) (*UpdateFeed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update feed URL: %w", err)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch update feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch update feed: %s", resp.Status)
+	}
+
+	var feed UpdateFeed
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to parse update feed: %w", err)
+	}
+	if feed.Version == "" {
+		return nil, fmt.Errorf("update feed has no version")
+	}
+	return &feed, nil
+}
+
+func (u *Updater) stage(ctx context.Context, feed *UpdateFeed) error {
+	if u.publicKey == nil {
+		return fmt.Errorf("no update signing key is configured")
+	}
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	asset, ok := feed.Assets[platform]
+	if !ok {
+		return fmt.Errorf("version %s has no build for %s", feed.Version, platform)
+	}
+	signature, err := base64.StdEncoding.DecodeString(asset.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid update signature: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid update URL: %w", err)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download update: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download update: %s", resp.Status)
+	}
+
+	download := u.executable + ".download"
+	file, err := os.OpenFile(download, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to stage update: %w", err)
+	}
+	defer os.Remove(download)
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, maxUpdateSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download update: %w", err)
+	}
+	if n > maxUpdateSize {
+		return fmt.Errorf("update is larger than %d MB", maxUpdateSize>>20)
+	}
+
+	digest := hash.Sum(nil)
+	if !strings.EqualFold(hex.EncodeToString(digest), asset.SHA256) {
+		return fmt.Errorf("update checksum does not match")
+	}
+	if !ed25519.Verify(u.publicKey, updateSignedMessage(feed.Version, platform, digest), signature) {
+		return fmt.Errorf("update signature is not valid")
+	}
+	if err := os.Rename(download, u.executable+stagedUpdateSuffix); err != nil {
+		return fmt.Errorf("failed to stage update: %w", err)
+	}
+	return nil
+}
+
+// updateSignedMessage returns what the signature of a release binary signs:
+// the version, the platform and the hex SHA-256 digest, a line each.
+func updateSignedMessage(version, platform string, digest []byte) []byte {
+	return []byte(version + "\n" + platform + "\n" + hex.EncodeToString(digest))
+}
+
+// ApplyStagedUpdate replaces the executable with a staged update, if there is
+// one, and reports whether it did; the caller should then restart.
+func ApplyStagedUpdate() (bool, error) {
+	executable, err := currentExecutable()
+	if err != nil {
+		return false, err
+	}
+	old := executable + ".old"
+	os.Remove(old)
+
+	staged := executable + stagedUpdateSuffix
+	if _, err := os.Stat(staged); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	// A running executable cannot be replaced on Windows, but it can be moved.
+	if runtime.GOOS == "windows" {
+		if err := os.Rename(executable, old); err != nil {
+			return false, fmt.Errorf("failed to move old executable: %w", err)
+		}
+	}
+	if err := os.Rename(staged, executable); err != nil {
+		if runtime.GOOS == "windows" {
+			os.Rename(old, executable)
+		}
+		return false, fmt.Errorf("failed to install update: %w", err)
+	}
+	return true, nil
+}
+
+// RestartExecutable starts the (updated) executable with the same arguments.
+// On Unix it replaces the current process; on Windows it starts a new one and
+// the caller must exit.
+func RestartExecutable() error {
+	executable, err := currentExecutable()
+	if err != nil {
+		return err
+	}
+	return restartExecutable(executable)
+}
+
+func currentExecutable() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	return executable, nil
+}
+
+// compareVersions compares dotted versions such as "1.2.3" or "v1.3.0-beta",
+// returning -1, 0 or 1. A pre-release sorts before its release.
+func compareVersions(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
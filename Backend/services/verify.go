@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verdicts of the verification of a finished recording.
+const (
+	VerificationPassed = "passed"
+	// VerificationTruncated is a recording of which something the extension
+	// sent did not make it into the file.
+	VerificationTruncated = "truncated"
+)
+
+// A file plays short when its duration falls more than durationShortfall or
+// durationShortfallRatio of the expected duration short, whichever is more:
+// MediaRecorder holds back up to a second of media and starts late.
+const (
+	durationShortfall      = 5 * time.Second
+	durationShortfallRatio = 0.1
+)
+
+// ClientTotals is what the extension reports having sent of a recording file
+// when it ends: the chunks and bytes the server accepted and how long it
+// recorded.
+type ClientTotals struct {
+	Chunks          int     `json:"chunks"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+}
+
+// RecordingVerification compares what the extension sent of a finished
+// recording with what the server wrote, what is on disk and how long the file
+// plays, so that a silently truncated recording is flagged as soon as it is
+// finished.
+type RecordingVerification struct {
+	// Verdict is VerificationPassed or VerificationTruncated.
+	Verdict string `json:"verdict"`
+	// Client is nil when the extension reported no totals.
+	Client *ClientTotals `json:"client,omitempty"`
+	// ServerChunks and ServerBytes are what the server wrote; ServerChunks is
+	// 0 for a recording resumed after a restart.
+	ServerChunks int   `json:"serverChunks,omitempty"`
+	ServerBytes  int64 `json:"serverBytes"`
+	// DiskBytes is the size of the files before post-processing.
+	DiskBytes int64 `json:"diskBytes"`
+	// ExpectedDurationSeconds is how long the extension recorded, or the time
+	// from the start to the last chunk when it did not say.
+	ExpectedDurationSeconds float64 `json:"expectedDurationSeconds"`
+	// ProbedDurationSeconds is how long ffprobe reads the files to play, 0
+	// when ffprobe is not available or cannot tell.
+	ProbedDurationSeconds float64 `json:"probedDurationSeconds,omitempty"`
+	// Problems say what does not add up.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// check compares the totals of v and sets its Verdict and Problems.
+func (v *RecordingVerification) check() {
+	if v.Client != nil {
+		if v.ServerChunks > 0 && v.ServerChunks < v.Client.Chunks {
+			v.Problems = append(v.Problems, fmt.Sprintf("the server wrote %d of the %d chunks the extension sent", v.ServerChunks, v.Client.Chunks))
+		}
+		if v.ServerBytes < v.Client.Bytes {
+			v.Problems = append(v.Problems, fmt.Sprintf("the server wrote %d of the %d bytes the extension sent", v.ServerBytes, v.Client.Bytes))
+		}
+	}
+	if v.DiskBytes < v.ServerBytes {
+		v.Problems = append(v.Problems, fmt.Sprintf("the file holds %d of the %d bytes the server wrote", v.DiskBytes, v.ServerBytes))
+	}
+	if v.ProbedDurationSeconds > 0 {
+		shortfall := max(durationShortfall.Seconds(), durationShortfallRatio*v.ExpectedDurationSeconds)
+		if v.ProbedDurationSeconds < v.ExpectedDurationSeconds-shortfall {
+			v.Problems = append(v.Problems, fmt.Sprintf("the file plays %.1fs of the %.1fs recorded", v.ProbedDurationSeconds, v.ExpectedDurationSeconds))
+		}
+	}
+	v.Verdict = VerificationPassed
+	if len(v.Problems) > 0 {
+		v.Verdict = VerificationTruncated
+	}
+}
+
+// ReportClientTotals keeps the totals the extension reports for the file of
+// the recording of tabID started at timestamp, which it is about to end, to
+// check the file against them when it is finished.
+func (rs *RecorderService) ReportClientTotals(tabID int, timestamp int64, totals ClientTotals) {
+	rs.fileWriter.setClientTotals(tabID, timestamp, totals)
+}
+
+func (fws *FileWriterService) setClientTotals(tabID int, timestamp int64, totals ClientTotals) {
+	val, ok := fws.activeFiles.Load(tabID)
+	if !ok {
+		return
+	}
+	handle := val.(*fileHandle)
+	handle.mu.Lock()
+	defer handle.mu.Unlock()
+	if handle.timestamp == timestamp {
+		handle.client = &totals
+	}
+}
+
+// filesSize is the size of files together, counting those that are missing
+// as empty.
+func filesSize(files []string) int64 {
+	var size int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// verify checks files, the finished files of a recording, against what was
+// sent and written of it (see RecordingVerification). diskBytes is their
+// size before post-processing.
+func (fws *FileWriterService) verify(files []string, diskBytes int64, verification RecordingVerification) *RecordingVerification {
+	verification.DiskBytes = diskBytes
+	if ffprobe := fws.GetPostProcessor().FFprobePath(); ffprobe != "" {
+		// The duration is only known when every file tells its own
+		var probed float64
+		for _, file := range files {
+			duration, err := probeDuration(ffprobe, file)
+			if err != nil {
+				LogError("[FILEWRITER] Failed to read the duration of %s: %v", file, err)
+			}
+			if duration == 0 {
+				probed = 0
+				break
+			}
+			probed += duration
+		}
+		verification.ProbedDurationSeconds = probed
+	}
+	verification.check()
+	if verification.Verdict == VerificationTruncated {
+		name := filepath.Base(files[0])
+		problems := strings.Join(verification.Problems, "; ")
+		LogError("[FILEWRITER] %s may be truncated: %s", name, problems)
+		fws.notifier.Send(NotifyWriteFailures, "Recording may be truncated", fmt.Sprintf("%s: %s", name, problems))
+	}
+	return &verification
+}
+
+// probeDuration returns how long file plays as ffprobe reads it, or 0 when
+// its format does not say, e.g. a WebM recording that was not post-processed.
+func probeDuration(ffprobe, file string) (float64, error) {
+	output, err := exec.Command(ffprobe, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", file).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	value := strings.TrimSpace(string(output))
+	if value == "" || value == "N/A" {
+		return 0, nil
+	}
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe output %q", value)
+	}
+	return duration, nil
+}
+
+// FFprobePath returns the ffprobe binary set by SetFFprobePath, or else the
+// one next to the ffmpeg one, or on the PATH when ffmpeg is found there, or
+// "" when there is none. A nil *PostProcessor has none.
+func (pp *PostProcessor) FFprobePath() string {
+	if pp == nil {
+		return ""
+	}
+	pp.mu.Lock()
+	ffprobePath := pp.ffprobePath
+	pp.mu.Unlock()
+	if ffprobePath != "" {
+		return ffprobePath
+	}
+	name := "ffprobe" + strings.TrimPrefix(filepath.Base(pp.ffmpegPath), "ffmpeg")
+	candidate := name
+	if filepath.Base(pp.ffmpegPath) != pp.ffmpegPath {
+		candidate = filepath.Join(filepath.Dir(pp.ffmpegPath), name)
+	}
+	path, err := exec.LookPath(candidate)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// SetFFprobePath sets the ffprobe binary to use, e.g. as detected in the
+// DependencyRegistry.
+func (pp *PostProcessor) SetFFprobePath(path string) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.ffprobePath = path
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Build metadata, overridden at build time with
+// -ldflags "-X recorder/services.Version=... -X recorder/services.Commit=... -X recorder/services.BuildTime=..."
+var (
+	Version   = "1.0.0-dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+var startTime = time.Now()
+
+// StartTime returns when the process started.
+func StartTime() time.Time {
+	return startTime
+}
+
+// Uptime returns how long the process has been running.
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
+
+// BuildCommit returns the injected commit, falling back to the VCS revision
+// the Go toolchain embeds when building from a checkout.
+func BuildCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
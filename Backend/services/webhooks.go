@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook events, sent as the "event" of the payload and in the
+// WebhookEventHeader.
+const (
+	WebhookRecordingStarted = "recording.started"
+	WebhookRecordingStopped = "recording.stopped"
+	// WebhookRecordingFailed is sent when a chunk of a recording cannot be
+	// written, or when fixing the finished file with FFmpeg fails.
+	WebhookRecordingFailed = "recording.failed"
+	// WebhookRecordingProcessed is sent when the file of a recording is
+	// finished and post-processed, so that it can be picked up.
+	WebhookRecordingProcessed = "recording.processed"
+)
+
+const (
+	// WebhookEventHeader names the event a webhook request is for.
+	WebhookEventHeader = "X-Recorder-Event"
+	// WebhookDeliveryHeader carries the ID of the event, which stays the same
+	// when a delivery is retried.
+	WebhookDeliveryHeader = "X-Recorder-Delivery"
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// request body, keyed with WEBHOOK_SECRET.
+	WebhookSignatureHeader = "X-Recorder-Signature"
+
+	webhookTimeout    = 10 * time.Second
+	webhookAttempts   = 3
+	webhookRetryDelay = 5 * time.Second
+)
+
+// WebhookEvents lists every webhook event.
+var WebhookEvents = []string{WebhookRecordingStarted, WebhookRecordingStopped, WebhookRecordingFailed, WebhookRecordingProcessed}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookConfig says where webhooks go and which events are sent.
+type WebhookConfig struct {
+	URLs   []string
+	Secret []byte
+	// Events are the events sent; all of them when empty.
+	Events []string
+}
+
+// LoadWebhookConfigFromEnv returns the webhooks set by WEBHOOK_URLS,
+// WEBHOOK_SECRET and WEBHOOK_EVENTS. The URLs and events are comma-separated.
+func LoadWebhookConfigFromEnv() WebhookConfig {
+	return WebhookConfig{
+		URLs:   splitList(os.Getenv("WEBHOOK_URLS")),
+		Secret: []byte(strings.TrimSpace(os.Getenv("WEBHOOK_SECRET"))),
+		Events: splitList(os.Getenv("WEBHOOK_EVENTS")),
+	}
+}
+
+// Enabled reports whether event is sent.
+func (c WebhookConfig) Enabled(event string) bool {
+	if len(c.URLs) == 0 {
+		return false
+	}
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRecording describes the recording an event is about. Fields that do
+// not apply to an event are left out.
+type WebhookRecording struct {
+	TabID           int        `json:"tabId,omitempty"`
+	Name            string     `json:"name"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds,omitempty"`
+	Bytes           int64      `json:"bytes,omitempty"`
+	// Path is the absolute path of the file, once it is finished.
+	Path string `json:"path,omitempty"`
+	// Status is RecordingTimedOut or RecordingInterrupted, or empty for a
+	// recording that ended normally.
+	Status string `json:"status,omitempty"`
+	// PostProcessed says whether FFmpeg fixed the file; it is false when FFmpeg
+	// is not available.
+	PostProcessed bool   `json:"postProcessed,omitempty"`
+	Error         string `json:"error,omitempty"`
+	// Verification is the verdict of the check of the finished file:
+	// VerificationPassed or VerificationTruncated (see verify.go).
+	Verification string `json:"verification,omitempty"`
+}
+
+// WebhookPayload is the JSON body of a webhook request.
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Event     string           `json:"event"`
+	Time      time.Time        `json:"time"`
+	Recording WebhookRecording `json:"recording"`
+}
+
+// WebhookDispatcher posts recording events to the configured URLs, so that
+// other tools can act on them, e.g. start editing a finished recording. A nil
+// *WebhookDispatcher sends nothing.
+type WebhookDispatcher struct {
+	config WebhookConfig
+	client *http.Client
+	mu     sync.Mutex
+}
+
+// NewWebhookDispatcher returns a dispatcher for config.
+func NewWebhookDispatcher(config WebhookConfig) *WebhookDispatcher {
+	if len(config.URLs) > 0 {
+		LogInfo("[WEBHOOK] Sending recording events to %d URL(s)", len(config.URLs))
+	}
+	return &WebhookDispatcher{
+		config: config,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Config returns the webhooks being sent.
+func (wd *WebhookDispatcher) Config() WebhookConfig {
+	if wd == nil {
+		return WebhookConfig{}
+	}
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	return wd.config
+}
+
+// SetConfig changes where webhooks go and which events are sent.
+func (wd *WebhookDispatcher) SetConfig(config WebhookConfig) {
+	if wd == nil {
+		return
+	}
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.config = config
+	LogInfo("[WEBHOOK] Sending recording events to %d URL(s)", len(config.URLs))
+}
+
+// Send posts event for recording to every URL, if the event is turned on. It
+// does not wait for the deliveries, which are retried a few times when the
+// receiver is unreachable or answers with a server error.
+func (wd *WebhookDispatcher) Send(event string, recording WebhookRecording) {
+	config := wd.Config()
+	if !config.Enabled(event) {
+		return
+	}
+	id, err := generateToken()
+	if err != nil {
+		LogError("[WEBHOOK] Failed to send %s: %v", event, err)
+		return
+	}
+	payload := WebhookPayload{ID: id[:16], Event: event, Time: time.Now().UTC(), Recording: recording}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		LogError("[WEBHOOK] Failed to encode %s: %v", event, err)
+		return
+	}
+	var signature string
+	if len(config.Secret) > 0 {
+		signature = SignWebhook(config.Secret, body)
+	}
+	for _, url := range config.URLs {
+		go func(url string) {
+			defer CapturePanic()
+			wd.deliver(url, payload, body, signature)
+		}(url)
+	}
+}
+
+// deliver posts body to url, retrying failed attempts.
+func (wd *WebhookDispatcher) deliver(url string, payload WebhookPayload, body []byte, signature string) {
+	for attempt := 1; ; attempt++ {
+		retry, err := wd.post(url, payload, body, signature)
+		if err == nil {
+			LogInfo("[WEBHOOK] Delivered %s %s to %s", payload.Event, payload.ID, url)
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			LogError("[WEBHOOK] Failed to deliver %s %s to %s: %v", payload.Event, payload.ID, url, err)
+			return
+		}
+		LogError("[WEBHOOK] Delivery of %s %s to %s failed, retrying: %v", payload.Event, payload.ID, url, err)
+		time.Sleep(time.Duration(attempt) * webhookRetryDelay)
+	}
+}
+
+// post makes one delivery attempt. retry says whether a failed attempt may
+// succeed later.
+func (wd *WebhookDispatcher) post(url string, payload WebhookPayload, body []byte, signature string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TabRecorder/"+Version)
+	req.Header.Set(WebhookEventHeader, payload.Event)
+	req.Header.Set(WebhookDeliveryHeader, payload.ID)
+	if signature != "" {
+		req.Header.Set(WebhookSignatureHeader, signature)
+	}
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("receiver responded with %s", resp.Status)
+}
+
+// SignWebhook returns the value of the WebhookSignatureHeader for body:
+// "sha256=" and the hex HMAC-SHA256 of body keyed with secret.
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// splitList returns the trimmed, non-empty items of a comma-separated list.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+// +build darwin
+
+package services
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// detectWebview reports WKWebView, which is part of macOS, with the version
+// of macOS it comes with.
+func detectWebview() WebviewRuntime {
+	runtime := WebviewRuntime{Name: "WKWebView", Installed: true}
+	if output, err := exec.Command("sw_vers", "-productVersion").Output(); err == nil {
+		runtime.Version = "macOS " + strings.TrimSpace(string(output))
+	}
+	return runtime
+}
@@ -0,0 +1,29 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package services
+
+import (
+	"os/exec"
+	"regexp"
+)
+
+// webkitLibrary finds WebKitGTK in the ldconfig cache, e.g.
+// "libwebkit2gtk-4.1.so.0 (libc6,x86-64) => /lib/x86_64-linux-gnu/...".
+var webkitLibrary = regexp.MustCompile(`libwebkit2gtk-([0-9.]+)\.so`)
+
+// detectWebview looks for the WebKitGTK library the window is drawn with.
+func detectWebview() WebviewRuntime {
+	runtime := WebviewRuntime{Name: "WebKitGTK"}
+	output, err := exec.Command("ldconfig", "-p").Output()
+	if err != nil {
+		runtime.Error = "cannot list the shared libraries: " + err.Error()
+		return runtime
+	}
+	if match := webkitLibrary.FindSubmatch(output); match != nil {
+		runtime.Installed, runtime.Version = true, "webkit2gtk-"+string(match[1])
+		return runtime
+	}
+	runtime.Error = "WebKitGTK not found - install libwebkit2gtk-4.1 (or 4.0) from the package manager"
+	return runtime
+}
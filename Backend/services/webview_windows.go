@@ -0,0 +1,42 @@
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"os/exec"
+	"regexp"
+	"syscall"
+)
+
+// webView2Keys are where the WebView2 runtime records its version, for a
+// machine-wide install on 64-bit and 32-bit Windows and a per-user one.
+var webView2Keys = []string{
+	`HKLM\SOFTWARE\WOW6432Node\Microsoft\EdgeUpdate\Clients\{F3017226-FE2A-4295-8BDF-00C3A9A7E4C5}`,
+	`HKLM\SOFTWARE\Microsoft\EdgeUpdate\Clients\{F3017226-FE2A-4295-8BDF-00C3A9A7E4C5}`,
+	`HKCU\Software\Microsoft\EdgeUpdate\Clients\{F3017226-FE2A-4295-8BDF-00C3A9A7E4C5}`,
+}
+
+// regVersionValue is the line of reg query output with the version, e.g.
+// "    pv    REG_SZ    120.0.2210.91".
+var regVersionValue = regexp.MustCompile(`(?im)^\s*pv\s+REG_SZ\s+(\S+)`)
+
+// detectWebview looks up the version of the WebView2 runtime.
+func detectWebview() WebviewRuntime {
+	runtime := WebviewRuntime{Name: "WebView2"}
+	for _, key := range webView2Keys {
+		cmd := exec.Command("reg", "query", key, "/v", "pv")
+		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+		output, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		// An uninstalled runtime leaves its key with an empty or 0.0.0.0 version
+		if match := regVersionValue.FindStringSubmatch(string(output)); match != nil && match[1] != "0.0.0.0" {
+			runtime.Installed, runtime.Version = true, match[1]
+			return runtime
+		}
+	}
+	runtime.Error = "WebView2 runtime not found - install it with: winget install Microsoft.EdgeWebView2Runtime"
+	return runtime
+}
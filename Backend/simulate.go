@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"recorder/models"
+	"recorder/services"
+)
+
+// SimulationReport is what the "simulate" command measured, in total and for
+// each session.
+type SimulationReport struct {
+	Sessions        int     `json:"sessions"`
+	TargetKbps      int     `json:"targetKbps"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	SimulatedSession
+	Results []SimulatedSession `json:"results"`
+}
+
+// SimulatedSession is what one simulated recording sent and how the server
+// answered. Latencies are of the chunks the server accepted.
+type SimulatedSession struct {
+	TabID    int   `json:"tabId,omitempty"`
+	Chunks   int   `json:"chunks"`
+	Accepted int   `json:"accepted"`
+	Rejected int   `json:"rejected"`
+	Failed   int   `json:"failed"`
+	Bytes    int64 `json:"bytes"`
+	// AchievedKbps is the rate the server accepted chunks at.
+	AchievedKbps float64 `json:"achievedKbps"`
+	LatencyP50Ms float64 `json:"latencyP50Ms"`
+	LatencyP95Ms float64 `json:"latencyP95Ms"`
+	LatencyP99Ms float64 `json:"latencyP99Ms"`
+	LatencyMaxMs float64 `json:"latencyMaxMs"`
+	// Errors counts the reasons chunks were rejected or failed, e.g.
+	// "429 Too Many Requests".
+	Errors    map[string]int `json:"errors,omitempty"`
+	latencies []time.Duration
+}
+
+// runSimulate implements the "simulate" command, which sends synthetic
+// recordings to a running server, as the extension would from several tabs,
+// and reports the throughput the server kept up with and how long it took to
+// accept each chunk, for performance regression testing. The chunks are
+// WebM clusters of random bytes, so the recordings it makes, named
+// "simulate-<n>", cannot be played.
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	serverURL := fs.String("url", "", "base URL of the server (default the local one)")
+	token := fs.String("token", "", "API token with the ingest scope (default the local server's)")
+	sessions := fs.Int("sessions", 4, "recordings to send at the same time")
+	kbps := fs.Int("bitrate", 2500, "kbit/s each recording sends")
+	interval := fs.Duration("interval", time.Second, "how often each recording sends a chunk, like the extension's timeslice")
+	duration := fs.Duration("duration", 30*time.Second, "how long to send for")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *sessions < 1 || *kbps < 1 || *interval <= 0 || *duration < *interval {
+		fmt.Fprintln(os.Stderr, "-sessions and -bitrate must be positive and -duration at least -interval")
+		return 2
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	baseURL := strings.TrimRight(*serverURL, "/")
+	if baseURL == "" {
+		var transport *http.Transport
+		transport, baseURL = localServer()
+		client.Transport = transport
+		if *token == "" {
+			value, err := services.LoadOrCreateAPIToken(secrets)
+			if err != nil {
+				services.LogError("Failed to load the API token: %v", err)
+				return 1
+			}
+			*token = value
+		}
+	}
+	sim := &simulation{
+		client:    client,
+		url:       baseURL + "/api/recordings",
+		token:     *token,
+		secret:    services.LoadRecordingSigningSecret(),
+		chunkSize: int(int64(*kbps) * 1000 / 8 * int64(*interval) / int64(time.Second)),
+		interval:  *interval,
+		duration:  *duration,
+	}
+
+	fmt.Fprintf(os.Stderr, "Sending %d recording(s) at %d kbit/s to %s for %s...\n", *sessions, *kbps, baseURL, *duration)
+	// Tab IDs far above those of a browser, so as not to mix with real
+	// recordings
+	tabBase := 1_000_000 * (1 + int(time.Now().UnixMilli()%1000))
+	results := make([]SimulatedSession, *sessions)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Spread over one interval, as tabs started at different times
+			time.Sleep(*interval * time.Duration(i) / time.Duration(*sessions))
+			results[i] = sim.run(tabBase+i, fmt.Sprintf("simulate-%d", i+1))
+		}(i)
+	}
+	wg.Wait()
+
+	report := SimulationReport{Sessions: *sessions, TargetKbps: *kbps, DurationSeconds: duration.Seconds(), Results: results}
+	var all []time.Duration
+	for _, result := range results {
+		report.Chunks += result.Chunks
+		report.Accepted += result.Accepted
+		report.Rejected += result.Rejected
+		report.Failed += result.Failed
+		report.Bytes += result.Bytes
+		for reason, n := range result.Errors {
+			if report.Errors == nil {
+				report.Errors = make(map[string]int)
+			}
+			report.Errors[reason] += n
+		}
+		all = append(all, result.latencies...)
+	}
+	report.SimulatedSession.summarize(all, *duration)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return 1
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSION\tCHUNKS\tACCEPTED\tREJECTED\tFAILED\tKBIT/S\tP50 MS\tP95 MS\tP99 MS\tMAX MS")
+		row := func(name string, s SimulatedSession) {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.0f\t%.1f\t%.1f\t%.1f\t%.1f\n", name, s.Chunks, s.Accepted, s.Rejected, s.Failed,
+				s.AchievedKbps, s.LatencyP50Ms, s.LatencyP95Ms, s.LatencyP99Ms, s.LatencyMaxMs)
+		}
+		for i, result := range results {
+			row(fmt.Sprintf("simulate-%d", i+1), result)
+		}
+		row("total", report.SimulatedSession)
+		w.Flush()
+		target := *kbps * *sessions
+		fmt.Printf("\nTarget %d kbit/s, achieved %.0f kbit/s (%.1f%%)\n", target, report.AchievedKbps, report.AchievedKbps*100/float64(target))
+		for reason, n := range report.Errors {
+			fmt.Printf("%d x %s\n", n, reason)
+		}
+	}
+	if report.Rejected > 0 || report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// simulation is how the simulated recordings are sent.
+type simulation struct {
+	client    *http.Client
+	url       string
+	token     string
+	secret    []byte
+	chunkSize int
+	interval  time.Duration
+	duration  time.Duration
+}
+
+// run sends the recording tabID, named name, for sim.duration and finishes
+// it, and returns what it measured.
+func (sim *simulation) run(tabID int, name string) SimulatedSession {
+	result := SimulatedSession{TabID: tabID}
+	started := time.Now()
+	timestamp := started.UnixMilli()
+	payload := make([]byte, sim.chunkSize)
+	ticker := time.NewTicker(sim.interval)
+	defer ticker.Stop()
+
+	for cluster := 0; time.Since(started) < sim.duration; cluster++ {
+		var chunk []byte
+		if cluster == 0 {
+			chunk = simulatedHeader()
+		}
+		rand.Read(payload)
+		chunk = append(chunk, simulatedCluster(cluster*int(sim.interval/time.Millisecond), payload)...)
+
+		result.Chunks++
+		sent := time.Now()
+		status, err := sim.send(models.RecordingData{
+			Name:      name,
+			TabID:     tabID,
+			Timestamp: timestamp,
+			Data:      base64.StdEncoding.EncodeToString(chunk),
+			Status:    "stream",
+			Sequence:  int64(cluster + 1),
+			Container: services.ContainerWebM,
+		})
+		switch {
+		case err != nil:
+			result.fail(&result.Failed, err.Error())
+		case status != http.StatusAccepted:
+			result.fail(&result.Rejected, fmt.Sprintf("%d %s", status, http.StatusText(status)))
+		default:
+			result.Accepted++
+			result.Bytes += int64(len(chunk))
+			result.latencies = append(result.latencies, time.Since(sent))
+		}
+		<-ticker.C
+	}
+
+	elapsed := time.Since(started)
+	if status, err := sim.send(models.RecordingData{
+		Name:       name,
+		TabID:      tabID,
+		Timestamp:  timestamp,
+		Status:     "stopped",
+		ChunksSent: result.Accepted,
+		BytesSent:  result.Bytes,
+		DurationMs: elapsed.Milliseconds(),
+	}); err != nil {
+		result.fail(&result.Failed, err.Error())
+	} else if status != http.StatusAccepted {
+		result.fail(&result.Rejected, fmt.Sprintf("%d %s", status, http.StatusText(status)))
+	}
+	result.summarize(result.latencies, elapsed)
+	return result
+}
+
+// send posts data as the extension does and returns the status the server
+// answered with.
+func (sim *simulation) send(data models.RecordingData) (int, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, sim.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sim.token != "" {
+		req.Header.Set("Authorization", "Bearer "+sim.token)
+	}
+	if sim.secret != nil {
+		req.Header.Set(services.RecordingSignatureHeader, services.SignRecording(sim.secret, data.TabID, data.Timestamp, body))
+	}
+	resp, err := sim.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (s *SimulatedSession) fail(count *int, reason string) {
+	*count++
+	if s.Errors == nil {
+		s.Errors = make(map[string]int)
+	}
+	s.Errors[reason]++
+}
+
+// summarize sets the throughput of s over elapsed and its latencies from
+// latencies.
+func (s *SimulatedSession) summarize(latencies []time.Duration, elapsed time.Duration) {
+	if elapsed > 0 {
+		s.AchievedKbps = float64(s.Bytes) * 8 / 1000 / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		return float64(sorted[int(p*float64(len(sorted)-1))].Microseconds()) / 1000
+	}
+	s.LatencyP50Ms, s.LatencyP95Ms, s.LatencyP99Ms = percentile(0.50), percentile(0.95), percentile(0.99)
+	s.LatencyMaxMs = float64(sorted[len(sorted)-1].Microseconds()) / 1000
+}
+
+// simulatedHeader returns the start of a simulated WebM recording: the EBML
+// header and a segment of unknown size, as MediaRecorder writes it.
+func simulatedHeader() []byte {
+	header := ebmlElement([]byte{0x1A, 0x45, 0xDF, 0xA3}, ebmlElement([]byte{0x42, 0x82}, []byte("webm")))
+	return append(header, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+}
+
+// simulatedCluster returns a WebM cluster starting at timecode milliseconds
+// that holds payload as padding.
+func simulatedCluster(timecode int, payload []byte) []byte {
+	var tc [4]byte
+	binary.BigEndian.PutUint32(tc[:], uint32(timecode))
+	content := append(ebmlElement([]byte{0xE7}, tc[:]), ebmlElement([]byte{0xEC}, payload)...)
+	return ebmlElement([]byte{0x1F, 0x43, 0xB6, 0x75}, content)
+}
+
+// ebmlElement encodes the EBML element id with content, its size written in
+// 8 bytes.
+func ebmlElement(id, content []byte) []byte {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(content)))
+	size[0] = 0x01
+	return append(append(append([]byte(nil), id...), size[:]...), content...)
+}
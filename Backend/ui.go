@@ -0,0 +1,245 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"recorder/services"
+
+	"github.com/sqweek/dialog"
+	webview "github.com/webview/webview_go"
+)
+
+// desktopUI reports whether this build includes the desktop window. Build
+// with -tags headless to leave out webview and its cgo dependencies, e.g. for
+// a container image.
+const desktopUI = true
+
+// quitChoice is what happens to active recordings when the window closes.
+type quitChoice int
+
+const (
+	quitUnasked quitChoice = iota
+	quitStopRecordings
+	quitKeepRecording
+	quitCancel
+)
+
+// The window's size, and its size in mini mode, which only shows the active
+// recordings.
+const (
+	windowWidth      = 1200
+	windowHeight     = 800
+	miniWindowWidth  = 360
+	miniWindowHeight = 280
+)
+
+// shareLinkTTL is how long a copied share link works.
+const shareLinkTTL = services.MaxSignedURLTTL
+
+const quitPrompt = "%d recording(s) are still in progress.\n\n" +
+	"Stop and save them before quitting? Otherwise they keep recording in the background and the app quits when they stop."
+
+// launchUI shows the window until it is closed. It reports whether active
+// recordings should continue in the background rather than be stopped, or an
+// error when the window cannot be shown at all.
+func launchUI(addr string, uiURL string, apiToken *services.MasterToken, updater *services.Updater, instance *services.InstanceLock, recorder *services.RecorderService, tlsEnabled bool) (keepRecording bool, err error) {
+	<-serverStarted
+	time.Sleep(100 * time.Millisecond)
+
+	if err := webviewAvailable(); err != nil {
+		return false, err
+	}
+	w := webview.New(false)
+	if !webviewCreated(w) {
+		return false, errors.New("failed to create the webview window")
+	}
+	defer w.Destroy()
+
+	w.SetTitle("Recording Server")
+	w.SetSize(windowWidth, windowHeight, webview.HintNone)
+
+	setWindowIcon(w)
+	if *minimizedFlag {
+		minimizeWindow(w)
+	}
+	instance.OnFocus(func() bool {
+		w.Dispatch(func() { focusWindow(w) })
+		return true
+	})
+	defer instance.OnFocus(nil)
+
+	// Closing the window while recordings are active asks what to do with
+	// them, so that captures are not cut off by accident.
+	choice := quitUnasked
+	confirmClose(w, func() int { return len(recorder.GetActiveRecordings()) }, &choice)
+
+	// selectDirectory only picks the directory; the page validates it and
+	// applies it through PATCH /api/config.
+	w.Bind("selectDirectory", func() string {
+		dir, err := dialog.Directory().Title("Select Download Directory").Browse()
+		if err != nil {
+			log.Printf("Directory selection error: %v", err)
+			return ""
+		}
+		return dir
+	})
+
+	// saveFileAs asks where to save a download and writes it there, instead
+	// of leaving it to the webview's own download handling. data is the file
+	// encoded as base64; the result is the chosen path, or "" when cancelled.
+	w.Bind("saveFileAs", func(name string, data string) (string, error) {
+		content, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", fmt.Errorf("invalid file data: %w", err)
+		}
+		save := dialog.File().Title("Save As").SetStartDir(fileWriter.GetDownloadDir()).SetStartFile(filepath.Base(name))
+		if ext := strings.TrimPrefix(filepath.Ext(name), "."); ext != "" {
+			save = save.Filter(strings.ToUpper(ext)+" files", ext)
+		}
+		path, err := save.Save()
+		if errors.Is(err, dialog.ErrCancelled) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to show save dialog: %w", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return "", fmt.Errorf("failed to save %s: %w", path, err)
+		}
+		services.LogInfo("[UI] Saved %s", path)
+		return path, nil
+	})
+
+	w.Bind("openRecordingsFolder", func() error {
+		return services.OpenFolder(fileWriter.GetDownloadDir())
+	})
+
+	w.Bind("revealRecording", func(name string) error {
+		path, err := services.LocateRecording(name, fileWriter, profiles)
+		if err != nil {
+			return err
+		}
+		return services.RevealFile(path)
+	})
+
+	// copyRecordingPath and copyShareLink put a recording's absolute path, or
+	// a signed link to it that works without a token until it expires, on the
+	// clipboard. Both return what they copied.
+	w.Bind("copyRecordingPath", func(name string) (string, error) {
+		path, err := services.LocateRecording(name, fileWriter, profiles)
+		if err != nil {
+			return "", err
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			return "", err
+		}
+		return path, services.CopyToClipboard(path)
+	})
+
+	w.Bind("copyShareLink", func(name string) (string, error) {
+		if _, err := services.LocateRecording(name, fileWriter, profiles); err != nil {
+			return "", err
+		}
+		signed, _, err := urlSigner.Sign("/api/recordings/media?file="+url.QueryEscape(name), shareLinkTTL)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign the link: %w", err)
+		}
+		link := shareBaseURL + signed
+		return link, services.CopyToClipboard(link)
+	})
+
+	// copyLiveLink puts a signed link to the HLS playlist of the live stream
+	// of a recording in progress, for players on other devices, on the
+	// clipboard and returns it.
+	w.Bind("copyLiveLink", func(tabID int) (string, error) {
+		signed, _, err := urlSigner.Sign(fmt.Sprintf("/api/recordings/%d/live/%s", tabID, services.LivePlaylist), shareLinkTTL)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign the link: %w", err)
+		}
+		link := shareBaseURL + signed
+		return link, services.CopyToClipboard(link)
+	})
+
+	// openPlayer plays a recording in a window of its own; mediaURL is a
+	// signed /api/recordings/media URL.
+	w.Bind("openPlayer", func(title string, mediaURL string, onTop bool) error {
+		return startPlayer(title, mediaURL, onTop)
+	})
+
+	// setMiniMode shrinks the window to a widget that stays above other
+	// windows, for recording while working in other apps, or restores it.
+	w.Bind("setMiniMode", func(on bool) {
+		w.Dispatch(func() {
+			if on {
+				w.SetSize(miniWindowWidth, miniWindowHeight, webview.HintNone)
+			} else {
+				w.SetSize(windowWidth, windowHeight, webview.HintNone)
+			}
+			setAlwaysOnTop(w, on)
+		})
+	})
+
+	w.Bind("getApiToken", func() string {
+		return apiToken.Value()
+	})
+
+	if updater != nil {
+		w.Bind("checkForUpdates", func() (services.UpdateStatus, error) {
+			return updater.Check(context.Background())
+		})
+	}
+
+	w.Bind("getServerStatus", func() map[string]interface{} {
+		status := map[string]interface{}{
+			"downloadDir": fileWriter.GetDownloadDir(),
+			"running":     true,
+			"tls":         tlsEnabled,
+		}
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			status["port"] = port
+			status["bind"] = host
+		} else {
+			status["socket"] = addr
+		}
+		return status
+	})
+
+	w.Navigate(uiURL)
+	w.Run()
+
+	// Where the close could not be intercepted, ask now that the window is
+	// gone; the recordings have not been touched yet.
+	if active := len(recorder.GetActiveRecordings()); active > 0 && choice == quitUnasked {
+		choice = quitKeepRecording
+		if dialog.Message(quitPrompt, active).Title("Recordings in progress").YesNo() {
+			choice = quitStopRecordings
+		}
+	}
+	return choice == quitKeepRecording, nil
+}
+
+// webviewCreated reports whether webview.New created a window. New wraps
+// whatever the C library returns, and that is NULL when the window could not
+// be created; any call on it would crash.
+func webviewCreated(w webview.WebView) bool {
+	v := reflect.ValueOf(w)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+	handle := v.Elem().FieldByName("w")
+	return !handle.IsValid() || handle.Kind() != reflect.UnsafePointer || !handle.IsNil()
+}
\ No newline at end of file
@@ -9,22 +9,148 @@ function getApiBase() {
 
 const API_BASE = getApiBase();
 
+// API token: provided by the native host and required on every /api request.
+// Browsers on paired devices use the token stored by pair.html instead.
+async function loadApiToken() {
+    if (!window.getApiToken) return localStorage.getItem('apiToken') || '';
+    try {
+        return (await window.getApiToken()) || '';
+    } catch (e) {
+        console.debug('Failed to load API token:', e?.message || e);
+        return '';
+    }
+}
+
+function apiFetch(url, options = {}) {
+    const headers = { ...(options.headers || {}) };
+    if (state.apiToken) headers['Authorization'] = `Bearer ${state.apiToken}`;
+    const method = (options.method || 'GET').toUpperCase();
+    if (method !== 'GET' && method !== 'HEAD') {
+        const csrf = readCookie('recorder_csrf');
+        if (csrf) headers['X-CSRF-Token'] = csrf;
+    }
+    return fetch(url, { ...options, headers });
+}
+
+function readCookie(name) {
+    const match = document.cookie.split('; ').find(c => c.startsWith(`${name}=`));
+    return match ? decodeURIComponent(match.slice(name.length + 1)) : '';
+}
+
+// For EventSource, which cannot carry an Authorization header.
+function withToken(url) {
+    if (!state.apiToken) return url;
+    const sep = url.includes('?') ? '&' : '?';
+    return `${url}${sep}token=${encodeURIComponent(state.apiToken)}`;
+}
+
+// Download links carry a short-lived signed URL instead of the API token.
+// Links marked data-signed are signed on click, so they never go stale on the page.
+async function signedUrl(url, ttlSeconds) {
+    const { pathname, search } = new URL(url, window.location.href);
+    const res = await apiFetch(`${API_BASE}/sign`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ path: pathname + search, ttlSeconds })
+    });
+    if (!res.ok) throw new Error(`HTTP ${res.status}`);
+    const data = await res.json();
+    return new URL(data.url, url).toString();
+}
+
+// Downloads are saved through the native "Save as…" dialog when the desktop
+// window provides one, and by the browser otherwise.
+async function saveDownload(blob, name) {
+    if (!window.saveFileAs) {
+        const url = URL.createObjectURL(blob);
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = name;
+        a.click();
+        URL.revokeObjectURL(url);
+        return;
+    }
+    const data = await new Promise((resolve, reject) => {
+        const reader = new FileReader();
+        reader.onload = () => resolve(String(reader.result).split(',')[1] || '');
+        reader.onerror = () => reject(reader.error);
+        reader.readAsDataURL(blob);
+    });
+    await window.saveFileAs(name, data);
+}
+
+function attachmentName(res, fallback) {
+    const match = /filename="?([^";]+)"?/.exec(res.headers.get('Content-Disposition') || '');
+    return match ? match[1] : fallback;
+}
+
+async function openSignedLink(e) {
+    const link = e.target.closest('a[data-signed]');
+    if (!link) return;
+    e.preventDefault();
+    if (window.saveFileAs && link.hasAttribute('download')) {
+        try {
+            const res = await apiFetch(link.href, { cache: 'no-store' });
+            if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+            await saveDownload(await res.blob(), attachmentName(res, link.getAttribute('download') || 'download'));
+        } catch (err) {
+            alert(`Failed to save download: ${err?.message || err}`);
+        }
+        return;
+    }
+    try {
+        const a = document.createElement('a');
+        a.href = await signedUrl(link.href);
+        if (link.hasAttribute('download')) a.download = link.getAttribute('download');
+        if (link.target) {
+            a.target = link.target;
+            a.rel = 'noopener';
+        }
+        a.click();
+    } catch (err) {
+        console.error('Failed to sign link:', err?.message || err);
+    }
+}
+
 const INTERVALS = {
     HEALTH_CHECK: 5000,
     RECORDING_UPDATE: 1000,
     STATS_UPDATE: 2000,
-    UPTIME_UPDATE: 1000
+    BANDWIDTH_UPDATE: 2000,
+    UPTIME_UPDATE: 1000,
+    UPDATE_STATUS: 10 * 60 * 1000,
+    RESTART_POLL: 2000
 };
 
 // State
 const state = {
     activeRecordings: new Map(),
+    // Segment of each active recording by tab, to notice finished splits
+    segments: new Map(),
     totalRecordings: 0,
     totalSizeBytes: 0,
     serverStartTime: Date.now(),
     healthOK: false,
+    stats: null,
+    apiToken: '',
+    clock: { zone: 'local', hour12: false },
+    units: 'binary',
+    zoom: 100,
+    messages: {},
 };
 
+// Times are shown in the time zone and clock configured on the server
+// ("local" is this browser's zone).
+function timeOptions(withClock = true) {
+    const options = withClock ? { hour12: !!state.clock.hour12 } : {};
+    if (state.clock.zone && state.clock.zone !== 'local') options.timeZone = state.clock.zone;
+    return options;
+}
+
+const formatTime = value => new Date(value).toLocaleTimeString(undefined, timeOptions());
+const formatDateTime = value => new Date(value).toLocaleString(undefined, timeOptions());
+const formatDate = value => new Date(value).toLocaleDateString(undefined, timeOptions(false));
+
 // Theme
 function initTheme() {
     const saved = localStorage.getItem('theme');
@@ -45,11 +171,15 @@ function initTheme() {
     document.getElementById('theme-toggle').addEventListener('click', () => {
         const current = document.documentElement.getAttribute('data-theme') || 'light';
         const next = current === 'dark' ? 'light' : 'dark';
-        document.documentElement.setAttribute('data-theme', next);
-        localStorage.setItem('theme', next);
-        renderThemeIcon(next);
+        applyTheme(next);
+        savePreferences({ theme: next }).catch(e => console.debug('Failed to save theme:', e?.message || e));
     });
 }
+function applyTheme(theme) {
+    document.documentElement.setAttribute('data-theme', theme);
+    localStorage.setItem('theme', theme);
+    renderThemeIcon(theme);
+}
 function renderThemeIcon(theme) {
     const el = document.getElementById('theme-icon');
     const iconName = theme === 'dark' ? 'sun' : 'moon';
@@ -62,13 +192,19 @@ async function checkHealth() {
     const statusText = document.getElementById('status-text');
     const dot = document.getElementById('status-dot');
     try {
-        const res = await fetch(`${API_BASE}/health`, { cache: 'no-store' });
-        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const res = await apiFetch(`${API_BASE}/health`, { cache: 'no-store' });
+        if (!res.ok && res.status !== 503) throw new Error('HTTP ' + res.status);
         const data = await res.json();
         const t = new Date(data.time || Date.now());
-        statusText.textContent = `Server Running (${t.toLocaleTimeString()})`;
-        state.healthOK = true;
-        dot.style.opacity = '1';
+        const label = data.status === 'ok' ? 'Server Running' : `Server ${data.status}`;
+        statusText.textContent = `${label} (${formatTime(t)})`;
+        statusText.title = Object.entries(data.checks || {})
+            .filter(([, check]) => check.status !== 'ok')
+            .map(([name, check]) => `${name}: ${check.message || check.status}`)
+            .join('\n');
+        state.healthOK = data.status !== 'unhealthy';
+        dot.style.opacity = state.healthOK ? '1' : '0.4';
+        showFFmpegCheck(data.checks?.ffmpeg);
     } catch (err) {
         state.healthOK = false;
         dot.style.opacity = '0.4';
@@ -77,6 +213,216 @@ async function checkHealth() {
     }
 }
 
+// FFmpeg install: the server installs FFmpeg in the background when it is
+// missing, or when asked here, as a job whose progress is shown while it runs
+let followedInstall = null;
+
+async function showFFmpegCheck(check) {
+    if (!check || followedInstall) return;
+    const button = document.getElementById('install-ffmpeg-btn');
+    document.getElementById('ffmpeg-field').hidden = check.status === 'ok';
+    document.getElementById('ffmpeg-status').textContent = check.message || check.status;
+    document.getElementById('ffmpeg-progress').hidden = true;
+    button.disabled = false;
+    if (check.status === 'ok') return;
+    // An outdated FFmpeg is upgraded when the server installed it, and left
+    // to the package manager of the system otherwise
+    let ffmpeg = null;
+    try {
+        const res = await apiFetch(`${API_BASE}/dependencies/ffmpeg`, { cache: 'no-store' });
+        if (res.ok) ffmpeg = await res.json();
+    } catch (e) {
+        console.debug('Failed to load the FFmpeg version:', e?.message || e);
+    }
+    const upgrade = Boolean(ffmpeg?.outdated);
+    button.dataset.action = upgrade ? 'upgrade' : 'install';
+    button.textContent = upgrade ? 'Upgrade FFmpeg' : 'Install FFmpeg';
+    button.hidden = upgrade && !ffmpeg.managed;
+}
+
+function showInstallJob(job) {
+    const status = document.getElementById('ffmpeg-status');
+    const progress = document.getElementById('ffmpeg-progress');
+    const button = document.getElementById('install-ffmpeg-btn');
+    document.getElementById('ffmpeg-field').hidden = false;
+    status.title = (job.log || []).slice(-5).join('\n');
+    progress.hidden = job.status !== 'running';
+    button.disabled = job.status === 'running';
+    if (job.status === 'running') {
+        status.textContent = job.progress >= 0 ? `${job.message}… ${Math.round(job.progress)}%` : `${job.message}…`;
+        if (job.progress >= 0) progress.value = job.progress;
+        else progress.removeAttribute('value');
+    } else if (job.status === 'failed') {
+        status.textContent = `Install failed: ${job.error}`;
+    } else {
+        status.textContent = job.message?.startsWith('Upgrading') ? 'FFmpeg upgraded' : 'FFmpeg installed';
+    }
+}
+
+// followInstall shows the progress of the install job id until it finishes.
+function followInstall(id) {
+    if (followedInstall === id || !window.EventSource) return;
+    followedInstall = id;
+    const source = new EventSource(withToken(`${API_BASE}/jobs/${encodeURIComponent(id)}/events`));
+    source.addEventListener('job', (event) => {
+        const job = JSON.parse(event.data);
+        showInstallJob(job);
+        if (job.status !== 'running') {
+            source.close();
+            followedInstall = null;
+            if (job.status === 'succeeded') {
+                setTimeout(checkHealth, 2000);
+                loadFFmpegPath();
+            }
+        }
+    });
+    source.onerror = () => {
+        source.close();
+        followedInstall = null;
+    };
+}
+
+async function loadInstallJob() {
+    try {
+        const res = await apiFetch(`${API_BASE}/jobs`, { cache: 'no-store' });
+        if (!res.ok) return;
+        const job = (await res.json()).find(j => j.kind === 'install' && j.status === 'running');
+        if (job) followInstall(job.id);
+    } catch (e) {
+        console.debug('Failed to load jobs:', e?.message || e);
+    }
+}
+
+async function handleInstallFFmpeg() {
+    const button = document.getElementById('install-ffmpeg-btn');
+    const action = button.dataset.action === 'upgrade' ? 'upgrade' : 'install';
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/dependencies/ffmpeg/${action}`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        const job = await res.json();
+        showInstallJob(job);
+        followInstall(job.id);
+    } catch (e) {
+        button.disabled = false;
+        alert(`Failed to install FFmpeg: ${e?.message || e}`);
+    }
+}
+
+// FFmpeg path: a custom ffmpeg binary, or the one on the PATH when empty,
+// and a re-detect for FFmpeg installed while the server runs
+async function loadFFmpegPath() {
+    try {
+        const res = await apiFetch(`${API_BASE}/dependencies/ffmpeg`, { cache: 'no-store' });
+        if (!res.ok) return;
+        const ffmpeg = await res.json();
+        const input = document.getElementById('ffmpeg-path');
+        input.value = ffmpeg.path || '';
+        input.title = ffmpeg.installed ? `FFmpeg ${ffmpeg.version}` : (ffmpeg.error || '');
+    } catch (e) {
+        console.debug('Failed to load the FFmpeg path:', e?.message || e);
+    }
+}
+
+async function handleSaveFFmpegPath() {
+    const button = document.getElementById('save-ffmpeg-path-btn');
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/dependencies/ffmpeg`, {
+            method: 'PATCH',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ path: document.getElementById('ffmpeg-path').value.trim() })
+        });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        await loadFFmpegPath();
+        checkHealth();
+    } catch (e) {
+        alert(`Failed to change the FFmpeg path: ${e?.message || e}`);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+async function handleRedetectFFmpeg() {
+    const button = document.getElementById('redetect-ffmpeg-btn');
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/dependencies/redetect`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        const ffmpeg = (await res.json()).find(d => d.name === 'ffmpeg');
+        await loadFFmpegPath();
+        checkHealth();
+        if (!ffmpeg?.installed) alert(`FFmpeg not found: ${ffmpeg?.error || 'not installed'}`);
+    } catch (e) {
+        alert(`Failed to re-detect FFmpeg: ${e?.message || e}`);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+// Alerts
+async function fetchAlerts() {
+    try {
+        const res = await apiFetch(`${API_BASE}/alerts`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const data = await res.json();
+        renderAlerts(data.active || []);
+    } catch (err) {
+        console.debug('Failed to fetch alerts:', err?.message || err);
+    }
+}
+
+function renderAlerts(alerts) {
+    const section = document.getElementById('alerts');
+    const list = document.getElementById('alerts-list');
+    section.hidden = alerts.length === 0;
+    list.innerHTML = alerts
+        .map(a => `<li>${escapeHtml(a.message)} <span class="muted">since ${formatTime(a.since)}</span></li>`)
+        .join('');
+}
+
+// Crash reports left by previous runs
+async function loadCrashReports() {
+    try {
+        const res = await apiFetch(`${API_BASE}/crashes`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const data = await res.json();
+        renderCrashReports((data.reports || []).filter(r => !r.reviewed));
+    } catch (err) {
+        console.debug('Failed to load crash reports:', err?.message || err);
+    }
+}
+
+function renderCrashReports(reports) {
+    const section = document.getElementById('crashes');
+    const list = document.getElementById('crashes-list');
+    section.hidden = reports.length === 0;
+    list.innerHTML = reports.map(r => `
+        <li>
+          ${escapeHtml(formatDateTime(r.time))} ·
+          <a href="${API_BASE}/crashes?name=${encodeURIComponent(r.name)}" data-signed target="_blank" rel="noopener"><u>View report</u></a> ·
+          <button class="btn-ghost" type="button" data-dismiss-crash="${escapeHtml(r.name)}">Dismiss</button>
+        </li>
+    `).join('');
+    list.querySelectorAll('[data-dismiss-crash]').forEach(btn => {
+        btn.addEventListener('click', () => dismissCrashReport(btn.dataset.dismissCrash));
+    });
+}
+
+async function dismissCrashReport(name) {
+    try {
+        const res = await apiFetch(`${API_BASE}/crashes`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name })
+        });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        loadCrashReports();
+    } catch (err) {
+        console.error('Failed to dismiss crash report:', err?.message || err);
+    }
+}
+
 // Port display
 function getPortFromApiBase() {
     try {
@@ -86,48 +432,726 @@ function getPortFromApiBase() {
         return '8080';
     }
 }
-function setPortDisplay(port) {
-    const el = document.getElementById('port-text');
-    if (el) el.textContent = `Port ${port}`;
+function setPortDisplay(port, bind) {
+    const el = document.getElementById('port-text');
+    if (!el) return;
+    el.textContent = `Port ${port}`;
+    if (bind) el.title = `Listening on ${bind}`;
+}
+
+function setSocketDisplay(path) {
+    const el = document.getElementById('port-text');
+    if (!el) return;
+    el.textContent = 'Unix socket';
+    el.title = `Listening on ${path}`;
+}
+
+// Server info: the effective configuration, falling back to the native hook
+async function loadServerInfo() {
+    // Show a best-effort default immediately
+    setPortDisplay(getPortFromApiBase());
+
+    try {
+        const res = await apiFetch(`${API_BASE}/config`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderConfig(await res.json());
+        return;
+    } catch (e) {
+        console.debug('Failed to load server config:', e?.message || e);
+    }
+
+    if (window.getServerStatus) {
+        try {
+            const info = await window.getServerStatus();
+            if (info?.downloadDir) document.getElementById('downloadDir').textContent = info.downloadDir;
+            if (info?.port) setPortDisplay(info.tls ? `${info.port} (HTTPS)` : info.port, info.bind);
+            if (info?.socket) setSocketDisplay(info.socket);
+        } catch (e) {
+            console.debug('Failed to load server info:', e?.message || e);
+        }
+    }
+}
+
+function renderConfig(config) {
+    const server = config.server || {};
+    if (server.socket) setSocketDisplay(server.socket);
+    else if (server.port) setPortDisplay(server.tls ? `${server.port} (HTTPS)` : server.port, server.bind);
+    document.getElementById('downloadDir').textContent = config.downloadDir;
+    if (config.time) state.clock = config.time;
+    document.getElementById('autostart-toggle').checked = !!config.autoStart;
+    document.getElementById('autostart-field').hidden = !config.autoStartAvailable;
+    document.getElementById('notifications-field').hidden = !config.notificationsAvailable;
+    document.querySelectorAll('[data-notification]').forEach(toggle => {
+        toggle.checked = !!config.notifications?.[toggle.dataset.notification];
+    });
+    if (config.theme && config.theme !== document.documentElement.getAttribute('data-theme')) applyTheme(config.theme);
+}
+
+async function patchConfig(settings) {
+    const res = await apiFetch(`${API_BASE}/config`, {
+        method: 'PATCH',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(settings)
+    });
+    if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    const config = await res.json();
+    renderConfig(config);
+    return config;
+}
+
+// Recording profiles (each has its own directory, retention and file naming)
+function renderProfiles(data) {
+    const select = document.getElementById('profile-select');
+    select.replaceChildren(...(data.profiles || []).map(profile => {
+        const option = document.createElement('option');
+        option.value = profile.name;
+        option.textContent = profile.name;
+        return option;
+    }));
+    select.value = data.active;
+    document.getElementById('profile-field').hidden = false;
+}
+
+async function loadProfiles() {
+    try {
+        const res = await apiFetch(`${API_BASE}/profiles`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderProfiles(await res.json());
+    } catch (e) {
+        console.debug('Failed to load profiles:', e?.message || e);
+    }
+}
+
+async function handleProfileChange(event) {
+    try {
+        const res = await apiFetch(`${API_BASE}/profiles/activate`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name: event.target.value })
+        });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        renderProfiles(await res.json());
+    } catch (e) {
+        console.error('Failed to switch profile:', e?.message || e);
+    }
+    loadServerInfo();
+}
+
+// Checks proposed settings (config file keys) on the server without applying
+// them, and returns the error messages. Validation is best effort: when it is
+// unavailable the change is left to the server to reject.
+async function validateConfig(settings) {
+    try {
+        const res = await apiFetch(`${API_BASE}/config/validate`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(settings)
+        });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const result = await res.json();
+        return (result.errors || []).map(problem => problem.message);
+    } catch (e) {
+        console.debug('Failed to validate config:', e?.message || e);
+        return [];
+    }
+}
+
+// Version and real server uptime
+async function loadVersion() {
+    try {
+        const res = await apiFetch(`${API_BASE}/version`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const data = await res.json();
+        if (data.startTime) state.serverStartTime = new Date(data.startTime).getTime();
+        const pill = document.getElementById('port-pill');
+        if (pill) pill.title = `Server v${data.version} (${data.commit}) · ${data.os}/${data.arch} · ${data.goVersion}`;
+        renderUptime();
+    } catch (e) {
+        console.debug('Failed to load version:', e?.message || e);
+    }
+}
+
+// Directory selection (optional native hooks)
+async function handleDirectorySelection() {
+    if (!window.selectDirectory) {
+        console.warn('Directory selection is not available in this environment.');
+        return;
+    }
+    try {
+        const dir = await window.selectDirectory();
+        if (!dir) return;
+        const problems = await validateConfig({ 'paths.recordings': dir });
+        if (problems.length) {
+            alert(`Cannot use this directory: ${problems.join('; ')}`);
+            return;
+        }
+        await patchConfig({ downloadDir: dir });
+    } catch (e) {
+        console.error('Error selecting directory:', e?.message || e);
+    }
+}
+
+// File manager: the desktop window uses its bindings, a browser asks the
+// server, which opens the file manager on its own machine.
+async function openRecordingsFolder() {
+    try {
+        if (window.openRecordingsFolder) {
+            await window.openRecordingsFolder();
+            return;
+        }
+        const res = await apiFetch(`${API_BASE}/recordings/open-folder`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    } catch (e) {
+        console.error('Failed to open recordings folder:', e?.message || e);
+        alert(`Failed to open the recordings folder: ${e?.message || e}`);
+    }
+}
+
+async function revealRecording(name) {
+    try {
+        if (window.revealRecording) {
+            await window.revealRecording(name);
+            return;
+        }
+        const res = await apiFetch(`${API_BASE}/recordings/reveal`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ file: name })
+        });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    } catch (e) {
+        console.error('Failed to reveal recording:', e?.message || e);
+        alert(`Failed to show the recording: ${e?.message || e}`);
+    }
+}
+
+async function loadRecentRecordings() {
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/recent`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderRecentRecordings(await res.json());
+    } catch (e) {
+        console.debug('Failed to load recent recordings:', e?.message || e);
+    }
+}
+
+function renderRecentRecordings(recordings) {
+    const list = document.getElementById('recent-recordings');
+    if (!recordings.length) {
+        list.innerHTML = '<div class="empty">No recordings finished yet. Drop WebM, MKV or MP4 files here to import them.</div>';
+        return;
+    }
+    list.innerHTML = recordings.map(r => `
+        <div class="item tokens__item">
+          <span>${escapeHtml(r.name)} <span class="muted">${formatFileSize(r.size)} · ${formatDateTime(r.finishedAt)}${r.source?.title ? ` · ${escapeHtml(r.source.title)}` : ''}</span>${r.status === 'timed out' ? ' <span class="pill" title="No data arrived for this recording, so it was finished automatically">Timed out</span>' : ''}${r.status === 'interrupted' ? ' <span class="pill" title="The extension crashed while recording, so this recording was finished">Interrupted</span>' : ''}${r.continuesFrom ? ` <span class="pill" title="${escapeHtml(r.continuesFrom)}">Continued</span>` : ''}${r.verification?.verdict === 'truncated' ? ` <span class="pill" title="${escapeHtml(r.verification.problems.join('\n'))}">Truncated</span>` : ''}${r.group ? ` <span class="pill" title="Group">${escapeHtml(r.group)}</span>` : ''}${r.profile && r.profile !== 'default' ? ` <span class="pill" title="Profile">${escapeHtml(r.profile)}</span>` : ''}${r.parts ? ` <span class="pill" title="${escapeHtml(r.parts.join('\n'))}">${r.parts.length} parts</span>` : ''}</span>
+          <span class="tokens__actions">
+            <button class="btn btn-ghost" type="button" data-play="${escapeHtml(r.name)}">Play</button>
+            <button class="btn btn-ghost" type="button" data-copy-path="${escapeHtml(r.name)}" data-path="${escapeHtml(r.path)}">Copy Path</button>
+            <button class="btn btn-ghost" type="button" data-copy-link="${escapeHtml(r.name)}">Copy Link</button>
+            <button class="btn btn-ghost" type="button" data-cast-file="${escapeHtml(r.name)}" title="Play the recording on a TV or Chromecast on the network">Cast</button>
+            <button class="btn btn-ghost" type="button" data-reveal="${escapeHtml(r.name)}">Show in Folder</button>
+          </span>
+        </div>
+    `).join('');
+    list.querySelectorAll('[data-play]').forEach(btn => {
+        btn.addEventListener('click', () => playRecording(btn.dataset.play));
+    });
+    list.querySelectorAll('[data-copy-path]').forEach(btn => {
+        btn.addEventListener('click', () => copyRecordingPath(btn));
+    });
+    list.querySelectorAll('[data-copy-link]').forEach(btn => {
+        btn.addEventListener('click', () => copyShareLink(btn));
+    });
+    list.querySelectorAll('[data-reveal]').forEach(btn => {
+        btn.addEventListener('click', () => revealRecording(btn.dataset.reveal));
+    });
+    list.querySelectorAll('[data-cast-file]').forEach(btn => {
+        btn.addEventListener('click', () => castRecording(btn, { file: btn.dataset.castFile }));
+    });
+}
+
+// Casting plays a finished recording, or the live stream of one in progress,
+// on a Chromecast or DLNA TV on the network. The server converts recordings
+// the device cannot play first, which can take a while, so the cast is
+// followed until it plays or fails.
+const CAST_POLL_MS = 2000;
+
+async function castRecording(btn, target) {
+    const label = btn.textContent;
+    btn.disabled = true;
+    try {
+        btn.textContent = t('Searching…');
+        const res = await apiFetch(`${API_BASE}/cast/devices`, { cache: 'no-store' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        const devices = await res.json();
+        if (!devices.length) {
+            alert('No Chromecast or DLNA device was found on the network.');
+            return;
+        }
+        let device = devices[0];
+        if (devices.length > 1) {
+            const choice = prompt(`${t('Cast to which device?')}\n${devices.map((d, i) => `${i + 1}. ${d.name}`).join('\n')}`, '1');
+            if (choice === null) return;
+            device = devices[Number(choice) - 1];
+            if (!device) return;
+        }
+
+        const castRes = await apiFetch(`${API_BASE}/cast`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ device: device.id, ...target })
+        });
+        if (!castRes.ok) throw new Error((await castRes.text()).trim() || `HTTP ${castRes.status}`);
+        let job = await castRes.json();
+        while (job.state === 'converting' || job.state === 'loading') {
+            btn.textContent = job.state === 'converting' ? t('Converting…') : t('Casting…');
+            await new Promise(resolve => setTimeout(resolve, CAST_POLL_MS));
+            const jobsRes = await apiFetch(`${API_BASE}/cast`, { cache: 'no-store' });
+            if (!jobsRes.ok) throw new Error(`HTTP ${jobsRes.status}`);
+            job = (await jobsRes.json()).find(j => j.id === job.id) || { state: 'failed', error: 'The cast is no longer listed' };
+        }
+        if (job.state === 'failed') throw new Error(job.error);
+    } catch (e) {
+        alert(`Failed to cast the recording: ${e?.message || e}`);
+    } finally {
+        btn.textContent = label;
+        btn.disabled = false;
+    }
+}
+
+// Copy a recording's path or a signed link to it. The desktop window copies
+// through the server, which links to its network address; browsers use the
+// clipboard API and this page's address.
+async function copyRecordingPath(btn) {
+    try {
+        if (window.copyRecordingPath) {
+            await window.copyRecordingPath(btn.dataset.copyPath);
+        } else {
+            await copyText(btn.dataset.path);
+        }
+        showCopied(btn);
+    } catch (e) {
+        alert(`Failed to copy the path: ${e?.message || e}`);
+    }
+}
+
+async function copyShareLink(btn) {
+    try {
+        if (window.copyShareLink) {
+            await window.copyShareLink(btn.dataset.copyLink);
+        } else {
+            await copyText(await signedUrl(`${API_BASE}/recordings/media?file=${encodeURIComponent(btn.dataset.copyLink)}`, PLAYER_LINK_TTL_SECONDS));
+        }
+        showCopied(btn);
+    } catch (e) {
+        alert(`Failed to copy the link: ${e?.message || e}`);
+    }
+}
+
+// Clipboard may be blocked; show the text so it can be copied by hand.
+async function copyText(text) {
+    try {
+        await navigator.clipboard.writeText(text);
+    } catch (e) {
+        prompt('Copy this:', text);
+    }
+}
+
+function showCopied(btn) {
+    const label = btn.textContent;
+    btn.textContent = 'Copied';
+    setTimeout(() => { btn.textContent = label; }, 1500);
+}
+
+// Recordings play in a player window of their own in the desktop app, and in
+// a new tab in browsers. The signed link lasts long enough to seek through a
+// long recording.
+const PLAYER_LINK_TTL_SECONDS = 24 * 60 * 60;
+
+async function playRecording(name) {
+    try {
+        const url = await signedUrl(`${API_BASE}/recordings/media?file=${encodeURIComponent(name)}`, PLAYER_LINK_TTL_SECONDS);
+        if (window.openPlayer) {
+            await window.openPlayer(name, url, document.getElementById('player-on-top').checked);
+            return;
+        }
+        window.open(url, '_blank', 'noopener');
+    } catch (e) {
+        console.error('Failed to play recording:', e?.message || e);
+        alert(`Failed to play the recording: ${e?.message || e}`);
+    }
+}
+
+// UI preferences, saved on the server so every browser looks the same
+const VIEW_TITLES = {
+    recordings: 'active-title',
+    statistics: 'stats-title',
+    configuration: 'config-title',
+};
+
+async function loadPreferences() {
+    try {
+        const res = await apiFetch(`${API_BASE}/preferences`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const prefs = await res.json();
+        renderPreferences(prefs);
+        const title = document.getElementById(VIEW_TITLES[prefs.defaultView]);
+        if (title) title.closest('section').scrollIntoView();
+    } catch (e) {
+        console.debug('Failed to load preferences:', e?.message || e);
+    }
+}
+
+function renderPreferences(prefs) {
+    if (prefs.theme && prefs.theme !== document.documentElement.getAttribute('data-theme')) applyTheme(prefs.theme);
+    prefs = { ...prefs, zoom: prefs.zoom || 100 };
+    if (!zoomSaveTimer) applyZoom(prefs.zoom);
+    document.querySelectorAll('[data-preference]').forEach(select => {
+        select.value = prefs[select.dataset.preference] || select.options[0].value;
+    });
+    const units = prefs.units || 'binary';
+    if (units !== state.units) {
+        state.units = units;
+        renderStats();
+        renderActiveRecordings();
+        if (state.stats) renderStatsData(state.stats);
+        loadRecentRecordings();
+    }
+}
+
+async function savePreferences(prefs) {
+    const res = await apiFetch(`${API_BASE}/preferences`, {
+        method: 'PATCH',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(prefs)
+    });
+    if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    const saved = await res.json();
+    renderPreferences(saved);
+    return saved;
+}
+
+async function handlePreferenceChange(event) {
+    const select = event.target;
+    const value = select.dataset.type === 'number' ? Number(select.value) : select.value;
+    try {
+        await savePreferences({ [select.dataset.preference]: value });
+        // Labels are translated once, when the page loads
+        if (select.dataset.preference === 'language') location.reload();
+    } catch (e) {
+        alert('Failed to save preference: ' + (e?.message || e));
+        loadPreferences();
+    }
+}
+
+// Translations of the UI, keyed by English text. Text and labels that match
+// a key are translated when the page loads and whenever they are rendered.
+const TRANSLATED_ATTRIBUTES = ['title', 'aria-label', 'placeholder'];
+
+async function loadTranslations() {
+    try {
+        const res = await apiFetch(`${API_BASE}/i18n`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const bundle = await res.json();
+        const select = document.getElementById('language-select');
+        (bundle.languages || []).forEach(language => {
+            select.add(new Option(language.name, language.code));
+        });
+        document.documentElement.lang = bundle.language;
+        state.messages = bundle.messages || {};
+    } catch (e) {
+        console.debug('Failed to load translations:', e?.message || e);
+        return;
+    }
+    if (Object.keys(state.messages).length === 0) return;
+    translateNode(document.body);
+    new MutationObserver(mutations => mutations.forEach(mutation => {
+        if (mutation.type === 'childList') mutation.addedNodes.forEach(translateNode);
+        else translateNode(mutation.target);
+    })).observe(document.body, {
+        subtree: true,
+        childList: true,
+        characterData: true,
+        attributes: true,
+        attributeFilter: TRANSLATED_ATTRIBUTES
+    });
+}
+
+function t(text) {
+    return state.messages[text] || text;
+}
+
+function translateNode(node) {
+    if (node.nodeType === Node.TEXT_NODE) {
+        const text = node.nodeValue.trim();
+        const translated = t(text);
+        // Only write changes, or the observer would see its own writes forever
+        if (translated !== text) node.nodeValue = node.nodeValue.replace(text, translated);
+        return;
+    }
+    if (node.nodeType !== Node.ELEMENT_NODE || node.matches('script, style')) return;
+    TRANSLATED_ATTRIBUTES.forEach(attribute => {
+        const value = node.getAttribute(attribute);
+        if (value && t(value) !== value) node.setAttribute(attribute, t(value));
+    });
+    node.childNodes.forEach(translateNode);
+}
+
+// Zoom scales the whole UI, for high-DPI screens and accessibility. It is
+// cached like the theme so that the page opens at the right size.
+const ZOOM_LEVELS = [50, 67, 75, 80, 90, 100, 110, 125, 150, 175, 200];
+const ZOOM_SAVE_DELAY = 500;
+let zoomSaveTimer = null;
+
+function initZoom() {
+    applyZoom(Number(localStorage.getItem('zoom')) || 100);
+    document.addEventListener('keydown', handleZoomKey);
+}
+
+function applyZoom(zoom) {
+    state.zoom = zoom;
+    document.documentElement.style.zoom = zoom === 100 ? '' : String(zoom / 100);
+    localStorage.setItem('zoom', String(zoom));
+}
+
+// Ctrl (Cmd on macOS) with +, - or 0 steps the zoom like a browser does,
+// instead of the webview's own zoom, which is not remembered.
+function handleZoomKey(event) {
+    if (!(event.ctrlKey || event.metaKey) || event.altKey) return;
+    let zoom;
+    if (event.key === '+' || event.key === '=') {
+        zoom = ZOOM_LEVELS.find(level => level > state.zoom) ?? state.zoom;
+    } else if (event.key === '-' || event.key === '_') {
+        zoom = [...ZOOM_LEVELS].reverse().find(level => level < state.zoom) ?? state.zoom;
+    } else if (event.key === '0') {
+        zoom = 100;
+    } else {
+        return;
+    }
+    event.preventDefault();
+    if (zoom === state.zoom) return;
+    applyZoom(zoom);
+    document.querySelector('[data-preference="zoom"]').value = String(zoom);
+    // Save once the keys are released rather than on every step
+    clearTimeout(zoomSaveTimer);
+    zoomSaveTimer = setTimeout(() => {
+        savePreferences({ zoom })
+            .catch(e => console.debug('Failed to save zoom:', e?.message || e))
+            .finally(() => { zoomSaveTimer = null; });
+    }, ZOOM_SAVE_DELAY);
+}
+
+// Recordings dropped onto the window are imported into the recordings
+function hasDroppedFiles(e) {
+    return [...(e.dataTransfer?.types || [])].includes('Files');
+}
+
+async function importDroppedFiles(files) {
+    for (const file of files) {
+        try {
+            const res = await apiFetch(`${API_BASE}/recordings/import?name=${encodeURIComponent(file.name)}`, {
+                method: 'POST',
+                headers: { 'Content-Type': file.type || 'application/octet-stream' },
+                body: file
+            });
+            if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        } catch (e) {
+            alert(`Failed to import ${file.name}: ${e?.message || e}`);
+        }
+    }
+    loadRecentRecordings();
+}
+
+function initDropImport() {
+    let depth = 0;
+    document.addEventListener('dragenter', e => {
+        if (!hasDroppedFiles(e)) return;
+        depth++;
+        document.body.classList.add('is-dropping');
+    });
+    document.addEventListener('dragleave', e => {
+        if (!hasDroppedFiles(e)) return;
+        depth = Math.max(0, depth - 1);
+        if (!depth) document.body.classList.remove('is-dropping');
+    });
+    document.addEventListener('dragover', e => {
+        if (hasDroppedFiles(e)) e.preventDefault();
+    });
+    document.addEventListener('drop', e => {
+        if (!hasDroppedFiles(e)) return;
+        e.preventDefault();
+        depth = 0;
+        document.body.classList.remove('is-dropping');
+        importDroppedFiles([...e.dataTransfer.files]);
+    });
+}
+
+// Start at login (shown when the server can configure it)
+async function handleAutoStartToggle(event) {
+    const toggle = event.target;
+    try {
+        await patchConfig({ autoStart: toggle.checked });
+    } catch (e) {
+        console.error('Failed to update auto-start:', e?.message || e);
+        toggle.checked = !toggle.checked;
+    }
+}
+
+// Desktop notifications, one toggle per event
+async function handleNotificationToggle(event) {
+    const toggle = event.target;
+    try {
+        await patchConfig({ notifications: { [toggle.dataset.notification]: toggle.checked } });
+    } catch (e) {
+        console.error('Failed to update notifications:', e?.message || e);
+        toggle.checked = !toggle.checked;
+    }
+}
+
+// Updates
+async function loadUpdateStatus() {
+    try {
+        const res = await apiFetch(`${API_BASE}/update`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderUpdateStatus(await res.json());
+    } catch (e) {
+        console.debug('Updates unavailable:', e?.message || e);
+    }
+}
+
+function renderUpdateStatus(status) {
+    let text = `Version ${status.current}`;
+    if (status.staged) text += ` · ${status.staged} will be installed on restart`;
+    else if (status.available) text += ` · ${status.latest} available`;
+    else if (status.latest) text += ' · up to date';
+    if (status.error) text += ` · ${status.error}`;
+    document.getElementById('update-status').textContent = text;
+    document.getElementById('autoupdate-toggle').checked = !!status.auto;
+    document.getElementById('update-field').hidden = false;
+    document.getElementById('autoupdate-field').hidden = false;
+    document.getElementById('check-updates-btn').hidden = false;
+    document.getElementById('install-update-btn').hidden = !status.available || status.staged === status.latest;
+    renderUpdateBanner(status);
+}
+
+// The banner offers a new version until it is dismissed; a staged update
+// brings it back to offer the restart that installs it.
+function updateBannerKey(status) {
+    return status.staged ? `staged:${status.staged}` : status.latest;
+}
+
+function renderUpdateBanner(status) {
+    const banner = document.getElementById('update-banner');
+    if (!status.available || localStorage.getItem('dismissedUpdate') === updateBannerKey(status)) {
+        banner.hidden = true;
+        return;
+    }
+    const staged = status.staged === status.latest;
+    document.getElementById('update-banner-title').textContent = staged
+        ? `Version ${status.staged} is ready to install`
+        : `Version ${status.latest} is available`;
+    let versions = `Installed: ${status.current} · Latest: ${status.latest}`;
+    if (staged) versions += ' · installs when the app restarts';
+    if (status.error) versions += ` · ${status.error}`;
+    document.getElementById('update-banner-versions').textContent = versions;
+    const notes = document.getElementById('update-notes');
+    notes.textContent = status.notes || '';
+    notes.hidden = !status.notes;
+    document.getElementById('banner-install-btn').hidden = staged;
+    document.getElementById('banner-restart-btn').hidden = !staged;
+    banner.dataset.key = updateBannerKey(status);
+    banner.hidden = false;
+}
+
+function dismissUpdateBanner() {
+    const banner = document.getElementById('update-banner');
+    localStorage.setItem('dismissedUpdate', banner.dataset.key || '');
+    banner.hidden = true;
+}
+
+// handleRestartUpdate restarts the server to install the staged update, then
+// reloads the page once the new version answers.
+async function handleRestartUpdate() {
+    if (!confirm('Restart the server now to install the update?')) return;
+    try {
+        const res = await apiFetch(`${API_BASE}/update/restart`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    } catch (e) {
+        alert(`Restart failed: ${e?.message || e}`);
+        return;
+    }
+    document.getElementById('update-banner-title').textContent = 'Restarting…';
+    document.getElementById('banner-restart-btn').hidden = true;
+    document.getElementById('banner-dismiss-btn').hidden = true;
+    const poll = setInterval(async () => {
+        try {
+            const res = await apiFetch(`${API_BASE}/update`, { cache: 'no-store' });
+            if (res.ok) {
+                clearInterval(poll);
+                location.reload();
+            }
+        } catch (e) {
+            // Still restarting
+        }
+    }, INTERVALS.RESTART_POLL);
+}
+
+// Router port mapping
+async function loadPortMapping() {
+    try {
+        const res = await apiFetch(`${API_BASE}/portmap`, { cache: 'no-store' });
+        if (!res.ok) return;
+        const mapping = await res.json();
+        let text = mapping.url || 'Waiting for the router…';
+        if (mapping.active) text += ` (${mapping.method === 'upnp' ? 'UPnP' : 'NAT-PMP'})`;
+        else if (mapping.error) text = `Port mapping failed · ${mapping.error}`;
+        document.getElementById('portmap-status').textContent = text;
+        document.getElementById('portmap-field').hidden = false;
+        if (!mapping.active && !mapping.error) setTimeout(loadPortMapping, 5000);
+    } catch (e) {
+        console.debug('Port mapping unavailable:', e?.message || e);
+    }
 }
 
-// Server info (optional native hooks)
-async function loadServerInfo() {
-    // Show a best-effort default immediately
-    setPortDisplay(getPortFromApiBase());
+async function postUpdate(action) {
+    const res = await apiFetch(`${API_BASE}/update/${action}`, { method: 'POST' });
+    const status = await res.json();
+    renderUpdateStatus(status);
+    if (!res.ok) throw new Error(status.error || `HTTP ${res.status}`);
+    return status;
+}
 
-    if (window.getServerStatus) {
-        try {
-            const info = await window.getServerStatus();
-            if (info?.downloadDir) document.getElementById('downloadDir').textContent = info.downloadDir;
-            if (info?.port) setPortDisplay(info.port);
-        } catch (e) {
-            console.debug('Failed to load server info:', e?.message || e);
-        }
+async function handleCheckUpdates() {
+    try {
+        // The desktop app checks through its native binding
+        if (window.checkForUpdates) renderUpdateStatus(await window.checkForUpdates());
+        else await postUpdate('check');
+    } catch (e) {
+        console.error('Update check failed:', e?.message || e);
     }
 }
 
-// Directory selection (optional native hooks)
-async function handleDirectorySelection() {
-    if (!window.selectDirectory) {
-        console.warn('Directory selection is not available in this environment.');
-        return;
+async function handleInstallUpdate() {
+    try {
+        await postUpdate('install');
+    } catch (e) {
+        console.error('Update failed:', e?.message || e);
     }
+}
+
+async function handleAutoUpdateToggle(event) {
+    const toggle = event.target;
     try {
-        const dir = await window.selectDirectory();
-        if (!dir) return;
-        const resp = await fetch(`${API_BASE}/config`, {
+        const res = await apiFetch(`${API_BASE}/update`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ path: dir })
+            body: JSON.stringify({ auto: toggle.checked })
         });
-        if (resp.ok) {
-            document.getElementById('downloadDir').textContent = dir;
-        } else {
-            console.error('Failed to update directory');
-        }
+        if (!res.ok) throw new Error(`HTTP ${res.status}`);
+        renderUpdateStatus(await res.json());
     } catch (e) {
-        console.error('Error selecting directory:', e?.message || e);
+        console.error('Failed to update automatic updates:', e?.message || e);
+        toggle.checked = !toggle.checked;
     }
 }
 
@@ -141,23 +1165,56 @@ function formatDuration(ms) {
 }
 function formatFileSize(bytes) {
     if (!bytes) return '0 B';
+    const base = state.units === 'decimal' ? 1000 : 1024;
     const units = ['B', 'KB', 'MB', 'GB', 'TB'];
-    const i = Math.floor(Math.log(bytes) / Math.log(1024));
-    const val = (bytes / Math.pow(1024, i)).toFixed(2);
+    const i = Math.min(Math.floor(Math.log(bytes) / Math.log(base)), units.length - 1);
+    const val = (bytes / Math.pow(base, i)).toFixed(2);
     return `${val} ${units[i]}`;
 }
 
-function renderRecordingItem(name, tabId, duration, size, startTime) {
+function renderRecordingItem(name, tabId, duration, size, startTime, audioOnly, priority, markers, live, group) {
     return `
         <div class="item" role="listitem">
           <div class="item__head">
             <div class="item__title">
-              <i data-lucide="video" class="icon"></i>
+              <i data-lucide="${audioOnly ? 'music' : 'video'}" class="icon"${audioOnly ? ' title="Audio only"' : ''}></i>
               <span>${escapeHtml(name)}</span>
+              ${priority === 'high' ? '<span class="pill" title="Written and post-processed before other recordings when the server is busy">High priority</span>' : ''}
+              ${group ? `<span class="pill" title="Recorded together with the other recordings of this group">${escapeHtml(group)}</span>` : ''}
             </div>
-            <span class="pill">
-              <i data-lucide="monitor" class="icon"></i>
-              Tab ${String(tabId)}
+            <span class="item__actions">
+              <span class="pill">
+                <i data-lucide="monitor" class="icon"></i>
+                Tab ${String(tabId)}
+              </span>
+              <button class="btn btn-ghost" type="button" data-preview-tab="${String(tabId)}" data-preview-name="${escapeHtml(name)}" title="Watch the recording a few seconds behind the tab">
+                <i data-lucide="eye" class="icon"></i>
+                Preview
+              </button>
+              ${live ? `<button class="btn btn-ghost" type="button" data-live-tab="${String(tabId)}" title="Copy a link to watch the recording live on another device">
+                <i data-lucide="radio" class="icon"></i>
+                Copy Live Link
+              </button>
+              <button class="btn btn-ghost" type="button" data-cast-tab="${String(tabId)}" title="Play the live stream on a TV or Chromecast on the network">
+                <i data-lucide="cast" class="icon"></i>
+                Cast
+              </button>` : ''}
+              <button class="btn btn-ghost" type="button" data-mark-tab="${String(tabId)}" title="Mark this moment of the recording">
+                <i data-lucide="bookmark" class="icon"></i>
+                Mark
+              </button>
+              <button class="btn btn-ghost" type="button" data-screenshot-tab="${String(tabId)}" title="Save a full-resolution screenshot of the tab next to the recording">
+                <i data-lucide="camera" class="icon"></i>
+                Screenshot
+              </button>
+              <button class="btn btn-ghost" type="button" data-split-tab="${String(tabId)}" title="Split recording into a new file">
+                <i data-lucide="scissors" class="icon"></i>
+                Split
+              </button>
+              <button class="btn btn-ghost" type="button" data-stop-tab="${String(tabId)}" title="Stop recording">
+                <i data-lucide="square" class="icon"></i>
+                Stop
+              </button>
             </span>
           </div>
           <div class="details">
@@ -173,6 +1230,10 @@ function renderRecordingItem(name, tabId, duration, size, startTime) {
               <div class="k">Started</div>
               <div class="v">${startTime}</div>
             </div>
+            ${markers ? `<div class="kv">
+              <div class="k">Markers</div>
+              <div class="v">${String(markers)}</div>
+            </div>` : ''}
           </div>
         </div>
     `;
@@ -180,49 +1241,130 @@ function renderRecordingItem(name, tabId, duration, size, startTime) {
 
 async function fetchStats() {
     try {
-        const res = await fetch(`${API_BASE}/stats`, { cache: 'no-store' });
+        const res = await apiFetch(`${API_BASE}/stats`, { cache: 'no-store' });
         if (!res.ok) throw new Error('HTTP ' + res.status);
-        const data = await res.json();
-        
-        const activeCount = data.activeRecordings || 0;
-        const totalSizeMB = data.totalSizeMB || 0;
-        const totalSessions = data.totalSessions || 0;
-        const sessions = data.sessions || [];
-        
-        document.getElementById('active-count').textContent = activeCount;
-        document.getElementById('active-sessions').textContent = activeCount;
-        document.getElementById('total-recordings').textContent = totalSessions;
-        
-        state.totalSizeBytes = totalSizeMB * 1024 * 1024;
-        document.getElementById('total-size').textContent = formatFileSize(state.totalSizeBytes);
-        
-        const container = document.getElementById('recordings-list');
-        
-        if (activeCount === 0) {
-            container.innerHTML = '<div class="empty">No active recordings</div>';
-            return;
-        }
-        
-        const items = sessions.map(session => renderRecordingItem(
-            session.name,
-            session.tabId,
-            session.durationSec * 1000,
-            session.bytesWritten,
-            escapeHtml(session.startTime)
-        ));
-        
-        container.innerHTML = items.join('');
-        lucide.createIcons();
+        state.stats = await res.json();
+        renderStatsData(state.stats);
     } catch (err) {
         console.debug('Failed to fetch stats:', err?.message || err);
     }
 }
 
+// Live stats: the server sends a full snapshot first, then only changed keys.
+// Falls back to polling if EventSource is unavailable or the stream drops.
+let statsPollTimer = null;
+
+function startStatsPolling() {
+    if (statsPollTimer) return;
+    fetchStats();
+    statsPollTimer = setInterval(fetchStats, INTERVALS.STATS_UPDATE);
+}
+
+function stopStatsPolling() {
+    if (!statsPollTimer) return;
+    clearInterval(statsPollTimer);
+    statsPollTimer = null;
+}
+
+function subscribeStats() {
+    if (!window.EventSource) {
+        startStatsPolling();
+        return;
+    }
+
+    const source = new EventSource(withToken(`${API_BASE}/stats/stream`));
+    source.addEventListener('snapshot', (e) => {
+        stopStatsPolling();
+        state.stats = JSON.parse(e.data);
+        renderStatsData(state.stats);
+    });
+    source.addEventListener('delta', (e) => {
+        state.stats = { ...(state.stats || {}), ...JSON.parse(e.data) };
+        renderStatsData(state.stats);
+    });
+    source.onerror = () => {
+        // EventSource reconnects on its own; poll in the meantime.
+        startStatsPolling();
+    };
+}
+
+function renderStatsData(data) {
+    const activeCount = data.activeRecordings || 0;
+    const totalSizeMB = data.totalSizeMB || 0;
+    const totalSessions = data.totalSessions || 0;
+    const sessions = data.sessions || [];
+
+    document.getElementById('active-count').textContent = activeCount;
+    document.getElementById('stop-all-btn').hidden = activeCount === 0;
+    document.getElementById('active-sessions').textContent = activeCount;
+    document.getElementById('total-recordings').textContent = totalSessions;
+    renderSessionLimit(activeCount, data.maxSessions || 0);
+
+    state.totalSizeBytes = totalSizeMB * 1024 * 1024;
+    document.getElementById('total-size').textContent = formatFileSize(state.totalSizeBytes);
+    renderErrors(data.errors || {});
+
+    // A split finished the file of a segment
+    if (sessions.some(s => s.segment > (state.segments.get(s.tabId) ?? s.segment))) {
+        loadRecentRecordings();
+    }
+    state.segments = new Map(sessions.map(s => [s.tabId, s.segment]));
+
+    const container = document.getElementById('recordings-list');
+
+    if (activeCount === 0) {
+        container.innerHTML = '<div class="empty">No active recordings</div>';
+        return;
+    }
+
+    const items = sessions.map(session => renderRecordingItem(
+        session.name,
+        session.tabId,
+        session.durationSec * 1000,
+        session.bytesWritten,
+        escapeHtml(session.startTime),
+        session.audioOnly,
+        session.priority,
+        session.markers,
+        session.live,
+        session.group
+    ));
+
+    container.innerHTML = items.join('');
+    lucide.createIcons();
+}
+
+// Warns that new recordings are rejected while the limit of simultaneous
+// recordings (limits.max_sessions) is reached
+function renderSessionLimit(activeCount, maxSessions) {
+    const reached = maxSessions > 0 && activeCount >= maxSessions;
+    document.getElementById('session-limit-warning').hidden = !reached;
+    if (reached) {
+        document.getElementById('session-limit-text').textContent =
+            t('Recording limit reached (%d at a time). New recordings are rejected until one stops.').replace('%d', maxSessions);
+    }
+}
+
+function renderErrors(errors) {
+    const el = document.getElementById('error-count');
+    let total = 0;
+    const lines = [];
+    Object.entries(errors).forEach(([kind, counter]) => {
+        if (!counter?.count) return;
+        total += counter.count;
+        const when = counter.lastAt ? formatDateTime(counter.lastAt) : '';
+        lines.push(`${kind}: ${counter.count} (last ${when}: ${counter.lastError || 'unknown'})`);
+    });
+    el.textContent = String(total);
+    el.title = lines.join('\n');
+}
+
 function renderActiveRecordings() {
     const container = document.getElementById('recordings-list');
     const activeCount = state.activeRecordings.size;
 
     document.getElementById('active-count').textContent = activeCount;
+    document.getElementById('stop-all-btn').hidden = activeCount === 0;
     document.getElementById('active-sessions').textContent = activeCount;
 
     if (activeCount === 0) {
@@ -239,7 +1381,7 @@ function renderActiveRecordings() {
             tabId,
             duration,
             rec.size,
-            new Date(rec.startTime).toLocaleTimeString()
+            formatTime(rec.startTime)
         ));
     });
 
@@ -247,6 +1389,272 @@ function renderActiveRecordings() {
     lucide.createIcons();
 }
 
+// handleStopClick stops a recording from the server, which tells the
+// extension to stop capturing the tab.
+async function handleStopClick(event) {
+    const button = event.target.closest('[data-stop-tab]');
+    if (!button) return;
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/${encodeURIComponent(button.dataset.stopTab)}/stop`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        fetchStats();
+        loadRecentRecordings();
+    } catch (e) {
+        button.disabled = false;
+        alert(`Failed to stop the recording: ${e?.message || e}`);
+    }
+}
+
+// handleSplitClick asks the extension, through the server, to go on recording
+// the tab into a new file.
+async function handleSplitClick(event) {
+    const button = event.target.closest('[data-split-tab]');
+    if (!button) return;
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/${encodeURIComponent(button.dataset.splitTab)}/split`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    } catch (e) {
+        alert(`Failed to split the recording: ${e?.message || e}`);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+// handleScreenshotClick has a full-resolution screenshot of the tab saved next
+// to its recording, by the extension or the capture on the server.
+async function handleScreenshotClick(event) {
+    const button = event.target.closest('[data-screenshot-tab]');
+    if (!button) return;
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/${encodeURIComponent(button.dataset.screenshotTab)}/screenshot`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    } catch (e) {
+        alert(`Failed to take the screenshot: ${e?.message || e}`);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+// handleMarkClick marks the current moment of a recording, e.g. a highlight,
+// with an optional label. The moment is taken before asking for the label.
+async function handleMarkClick(event) {
+    const button = event.target.closest('[data-mark-tab]');
+    if (!button) return;
+    const at = new Date().toISOString();
+    const label = prompt(t('Label for the marker (optional)'), '');
+    if (label === null) return;
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/${encodeURIComponent(button.dataset.markTab)}/markers`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ label, at })
+        });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        fetchStats();
+    } catch (e) {
+        alert(`Failed to mark the recording: ${e?.message || e}`);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+// handleLiveLinkClick copies a signed link to the HLS playlist of a recording
+// streamed live, which players such as VLC or Safari on other devices open.
+// The desktop window links to the server's network address, like share links.
+function handleCastLiveClick(event) {
+    const button = event.target.closest('[data-cast-tab]');
+    if (!button) return;
+    castRecording(button, { tabId: Number(button.dataset.castTab) });
+}
+
+async function handleLiveLinkClick(event) {
+    const button = event.target.closest('[data-live-tab]');
+    if (!button) return;
+    try {
+        const tabId = button.dataset.liveTab;
+        if (window.copyLiveLink) {
+            await window.copyLiveLink(Number(tabId));
+        } else {
+            await copyText(await signedUrl(`${API_BASE}/recordings/${encodeURIComponent(tabId)}/live/index.m3u8`, PLAYER_LINK_TTL_SECONDS));
+        }
+        showCopied(button);
+    } catch (e) {
+        alert(`Failed to copy the link: ${e?.message || e}`);
+    }
+}
+
+// Live preview of a recording in progress. The server streams the start of
+// the recording file and its latest clusters, then each chunk as it arrives;
+// they play through Media Source Extensions a few seconds behind the tab.
+const PREVIEW_DELAY_SECONDS = 3;
+// How much of the preview is kept for seeking back, so that long previews
+// do not fill the browser's media buffer.
+const PREVIEW_KEEP_SECONDS = 60;
+let previewAbort = null;
+
+function handlePreviewClick(event) {
+    const button = event.target.closest('[data-preview-tab]');
+    if (!button) return;
+    openPreview(button.dataset.previewTab, button.dataset.previewName);
+}
+
+async function openPreview(tabId, name) {
+    closePreview();
+    const abort = new AbortController();
+    previewAbort = abort;
+    const video = document.getElementById('preview-video');
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/${encodeURIComponent(tabId)}/preview`, { cache: 'no-store', signal: abort.signal });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        const type = res.headers.get('Content-Type');
+        if (!window.MediaSource || !MediaSource.isTypeSupported(type)) {
+            abort.abort();
+            throw new Error(t('This browser cannot play a live preview of this recording'));
+        }
+
+        const source = new MediaSource();
+        video.src = URL.createObjectURL(source);
+        await new Promise(resolve => source.addEventListener('sourceopen', resolve, { once: true }));
+        URL.revokeObjectURL(video.src);
+        const buffer = source.addSourceBuffer(type);
+        document.getElementById('preview-title').textContent = name;
+        document.getElementById('preview-panel').hidden = false;
+
+        const reader = res.body.getReader();
+        for (;;) {
+            const { done, value } = await reader.read();
+            if (done) break;
+            await updatePreview(buffer, () => buffer.appendBuffer(value));
+            if (!buffer.buffered.length) continue;
+            const start = buffer.buffered.start(0);
+            const end = buffer.buffered.end(buffer.buffered.length - 1);
+            // Stay a few seconds behind the tab
+            if (video.currentTime < end - 2 * PREVIEW_DELAY_SECONDS) {
+                video.currentTime = Math.max(start, end - PREVIEW_DELAY_SECONDS);
+            }
+            if (start < end - 2 * PREVIEW_KEEP_SECONDS) {
+                await updatePreview(buffer, () => buffer.remove(start, end - PREVIEW_KEEP_SECONDS));
+            }
+        }
+        // The recording was stopped or split
+        if (source.readyState === 'open') source.endOfStream();
+    } catch (e) {
+        if (abort.signal.aborted && previewAbort !== abort) return;
+        closePreview();
+        alert(`Failed to preview the recording: ${e?.message || e}`);
+    }
+}
+
+// updatePreview runs update on buffer, an append or a removal, and waits
+// until it is done.
+function updatePreview(buffer, update) {
+    return new Promise((resolve, reject) => {
+        buffer.addEventListener('updateend', resolve, { once: true });
+        buffer.addEventListener('error', () => reject(new Error(t('The preview could not be played'))), { once: true });
+        update();
+    });
+}
+
+function closePreview() {
+    if (previewAbort) {
+        const abort = previewAbort;
+        previewAbort = null;
+        abort.abort();
+    }
+    const video = document.getElementById('preview-video');
+    video.removeAttribute('src');
+    video.load();
+    document.getElementById('preview-panel').hidden = true;
+}
+
+async function stopAllRecordings() {
+    const button = document.getElementById('stop-all-btn');
+    button.disabled = true;
+    try {
+        const res = await apiFetch(`${API_BASE}/recordings/stop`, { method: 'POST' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        fetchStats();
+        loadRecentRecordings();
+    } catch (e) {
+        alert(`Failed to stop the recordings: ${e?.message || e}`);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+// Mini mode shrinks the desktop window to a widget above other windows that
+// only shows the active recordings; in a browser it only changes the layout.
+function initMiniMode() {
+    document.getElementById('mini-mode-btn').addEventListener('click', () => {
+        setMiniMode(!document.body.classList.contains('is-mini'));
+    });
+    if (localStorage.getItem('miniMode') === 'true') setMiniMode(true);
+}
+
+function setMiniMode(on) {
+    document.body.classList.toggle('is-mini', on);
+    localStorage.setItem('miniMode', String(on));
+    const button = document.getElementById('mini-mode-btn');
+    button.title = on ? 'Exit mini mode' : 'Mini mode';
+    button.setAttribute('aria-label', button.title);
+    document.getElementById('mini-mode-icon').setAttribute('data-lucide', on ? 'maximize-2' : 'picture-in-picture-2');
+    lucide.createIcons();
+    if (window.setMiniMode) {
+        window.setMiniMode(on).catch(e => console.debug('Failed to resize the window:', e?.message || e));
+    }
+}
+
+// Bandwidth graph
+const BANDWIDTH_WINDOW_SEC = 300;
+
+async function fetchBandwidth() {
+    try {
+        const since = Math.floor(Date.now() / 1000) - BANDWIDTH_WINDOW_SEC;
+        const res = await apiFetch(`${API_BASE}/stats/timeseries?resolution=second&since=${since}`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        const data = await res.json();
+        renderBandwidth(data.global || []);
+    } catch (err) {
+        console.debug('Failed to fetch bandwidth:', err?.message || err);
+    }
+}
+
+function renderBandwidth(samples) {
+    const latest = samples.length ? samples[samples.length - 1].bytes : 0;
+    document.getElementById('bandwidth-current').textContent = `${formatFileSize(latest)}/s`;
+
+    const canvas = document.getElementById('bandwidth-chart');
+    const ratio = window.devicePixelRatio || 1;
+    const width = canvas.clientWidth;
+    const height = canvas.clientHeight;
+    canvas.width = width * ratio;
+    canvas.height = height * ratio;
+
+    const ctx = canvas.getContext('2d');
+    ctx.scale(ratio, ratio);
+    ctx.clearRect(0, 0, width, height);
+    if (samples.length < 2) return;
+
+    const max = Math.max(...samples.map(s => s.bytes), 1);
+    const step = width / (BANDWIDTH_WINDOW_SEC - 1);
+    const offset = BANDWIDTH_WINDOW_SEC - samples.length;
+
+    ctx.strokeStyle = getComputedStyle(document.documentElement).getPropertyValue('--fg').trim();
+    ctx.lineWidth = 1.5;
+    ctx.beginPath();
+    samples.forEach((s, i) => {
+        const x = (offset + i) * step;
+        const y = height - (s.bytes / max) * (height - 4) - 2;
+        if (i === 0) ctx.moveTo(x, y);
+        else ctx.lineTo(x, y);
+    });
+    ctx.stroke();
+}
+
 function renderUptime() {
     const uptime = Date.now() - state.serverStartTime;
     document.getElementById('server-uptime').textContent = formatDuration(uptime);
@@ -265,23 +1673,350 @@ function escapeHtml(str) {
         .replace(/>/g, '&gt;');
 }
 
+function renderApiToken() {
+    const el = document.getElementById('api-token');
+    el.textContent = state.apiToken ? '•'.repeat(16) : 'Unavailable';
+}
+
+async function copyApiToken() {
+    if (!state.apiToken) return;
+    try {
+        await navigator.clipboard.writeText(state.apiToken);
+        document.getElementById('api-token').textContent = 'Copied to clipboard';
+        setTimeout(renderApiToken, 1500);
+    } catch (e) {
+        // Clipboard may be blocked; reveal the token so it can be copied by hand.
+        document.getElementById('api-token').textContent = state.apiToken;
+    }
+}
+
+async function rotateApiToken() {
+    if (!confirm('Rotate the API token? The extension and any shared links stop working until updated.')) return;
+    try {
+        const res = await apiFetch(`${API_BASE}/tokens/rotate`, { method: 'POST' });
+        if (!res.ok) throw new Error(await res.text() || `HTTP ${res.status}`);
+        const { token } = await res.json();
+        if (!window.getApiToken) localStorage.setItem('apiToken', token);
+        state.apiToken = token;
+        renderApiToken();
+    } catch (e) {
+        console.error('Failed to rotate API token:', e?.message || e);
+        alert(`Failed to rotate API token: ${e?.message || e}`);
+    }
+}
+
+// Config backup: settings and profiles, plus the credentials when a
+// passphrase is given, to restore here or on another machine
+async function exportConfig() {
+    const passphrase = prompt('Passphrase to encrypt the API tokens and UI password with (at least 8 characters). Leave empty to export without them.');
+    if (passphrase === null) return;
+    try {
+        const res = await apiFetch(`${API_BASE}/config/export`, passphrase ? {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ passphrase })
+        } : { cache: 'no-store' });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        const fallback = `recorder-config-${new Date().toISOString().slice(0, 10).replace(/-/g, '')}.json`;
+        await saveDownload(await res.blob(), attachmentName(res, fallback));
+    } catch (e) {
+        console.error('Failed to export config:', e?.message || e);
+        alert(`Failed to export config: ${e?.message || e}`);
+    }
+}
+
+async function importConfig(file) {
+    try {
+        const backup = JSON.parse(await file.text());
+        let passphrase = '';
+        if (backup.secrets) {
+            passphrase = prompt('This backup contains encrypted credentials. Enter its passphrase, or leave empty to import without them.');
+            if (passphrase === null) return;
+        }
+        const res = await apiFetch(`${API_BASE}/config/import`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ backup, passphrase })
+        });
+        if (res.status === 422) {
+            const result = await res.json();
+            throw new Error((result.errors || []).map(problem => `${problem.key}: ${problem.message}`).join('\n'));
+        }
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        const report = await res.json();
+        const lines = [`Imported ${report.settings.length} settings and ${report.profiles.length} profiles.`];
+        if (report.tokens) lines.push(`Added ${report.tokens} API tokens.`);
+        if (report.restartRequired.length) lines.push(`Restart to apply: ${report.restartRequired.join(', ')}`);
+        if (report.skipped?.length) lines.push(`Skipped: ${report.skipped.join('; ')}`);
+        if (report.apiToken) {
+            lines.push('The API token was replaced by the one from the backup; enter it again after the page reloads.');
+            localStorage.removeItem('apiToken');
+        }
+        alert(lines.join('\n'));
+        window.location.reload();
+    } catch (e) {
+        console.error('Failed to import config:', e?.message || e);
+        alert(`Failed to import config: ${e?.message || e}`);
+    }
+}
+
+// Factory reset: erases settings, tokens and stats, then the server restarts
+async function factoryReset() {
+    const answer = prompt('This erases all settings, API tokens, profiles and stats, and the extension must be set up again. Type RESET to continue.');
+    if (answer !== 'RESET') return;
+    const keepRecordings = confirm('Keep the recordings on disk? Choose Cancel to delete them as well.');
+    try {
+        const res = await apiFetch(`${API_BASE}/reset`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ confirm: answer, keepRecordings })
+        });
+        if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+        localStorage.removeItem('apiToken');
+        alert('Reset complete. The server is restarting.');
+        setTimeout(() => window.location.reload(), 3000);
+    } catch (e) {
+        console.error('Factory reset failed:', e?.message || e);
+        alert(`Factory reset failed: ${e?.message || e}`);
+    }
+}
+
+// Scoped tokens issued via /api/tokens or device pairing
+async function loadTokens() {
+    try {
+        const res = await apiFetch(`${API_BASE}/tokens`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderTokens(await res.json());
+    } catch (e) {
+        console.debug('Failed to load tokens:', e?.message || e);
+    }
+}
+
+function renderTokens(tokens) {
+    const list = document.getElementById('tokens-list');
+    if (!tokens.length) {
+        list.innerHTML = '<div class="empty">No issued tokens</div>';
+        return;
+    }
+    list.innerHTML = tokens.map(t => `
+        <div class="item tokens__item">
+          <span>${escapeHtml(t.name)} <span class="muted">${escapeHtml(t.scopes.join(', '))} · ${formatDate(t.createdAt)}</span></span>
+          <button class="btn btn-ghost" type="button" data-revoke-token="${escapeHtml(t.id)}">Revoke</button>
+        </div>
+    `).join('');
+    list.querySelectorAll('[data-revoke-token]').forEach(btn => {
+        btn.addEventListener('click', () => revokeToken(btn.dataset.revokeToken));
+    });
+}
+
+async function revokeToken(id) {
+    try {
+        const res = await apiFetch(`${API_BASE}/tokens?id=${encodeURIComponent(id)}`, { method: 'DELETE' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        loadTokens();
+    } catch (e) {
+        console.error('Failed to revoke token:', e?.message || e);
+    }
+}
+
+// Scheduled recordings: the server asks the extension to open and record a
+// page between two times
+async function loadSchedules() {
+    try {
+        const res = await apiFetch(`${API_BASE}/schedules`, { cache: 'no-store' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderSchedules(await res.json());
+    } catch (e) {
+        console.debug('Failed to load schedules:', e?.message || e);
+    }
+}
+
+function renderSchedules(schedules) {
+    const list = document.getElementById('schedules-list');
+    if (!schedules.length) {
+        list.innerHTML = '<div class="empty">No scheduled recordings</div>';
+        return;
+    }
+    const labels = { scheduled: 'Scheduled', starting: 'Starting', recording: 'Recording', done: 'Done', failed: 'Failed' };
+    list.innerHTML = schedules.map(s => `
+        <div class="item tokens__item">
+          <span>${escapeHtml(s.name)} <span class="muted">${escapeHtml(s.url)} · ${formatDateTime(s.startAt)} – ${formatDateTime(s.stopAt)}</span>
+            ${s.error ? `<span class="muted">· ${escapeHtml(s.error)}</span>` : ''}</span>
+          <span class="tokens__actions">
+            ${s.headless ? '<span class="pill" title="Recorded in a headless browser on the server">Headless</span>' : ''}
+            <span class="pill">${labels[s.status] || escapeHtml(s.status)}</span>
+            <button class="btn btn-ghost" type="button" data-delete-schedule="${escapeHtml(s.id)}">${s.status === 'recording' ? 'Stop' : 'Delete'}</button>
+          </span>
+        </div>
+    `).join('');
+    list.querySelectorAll('[data-delete-schedule]').forEach(btn => {
+        btn.addEventListener('click', () => deleteSchedule(btn.dataset.deleteSchedule));
+    });
+}
+
+async function handleScheduleSubmit(event) {
+    event.preventDefault();
+    const value = id => document.getElementById(id).value;
+    try {
+        const res = await apiFetch(`${API_BASE}/schedules`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                name: value('schedule-name').trim(),
+                url: value('schedule-url').trim(),
+                startAt: new Date(value('schedule-start')).toISOString(),
+                stopAt: new Date(value('schedule-stop')).toISOString(),
+                headless: document.getElementById('schedule-headless').checked
+            })
+        });
+        if (!res.ok) throw new Error(await res.text() || `HTTP ${res.status}`);
+        renderSchedules(await res.json());
+        event.target.reset();
+    } catch (e) {
+        console.error('Failed to schedule recording:', e?.message || e);
+        alert(`Failed to schedule recording: ${e?.message || e}`);
+    }
+}
+
+async function deleteSchedule(id) {
+    try {
+        const res = await apiFetch(`${API_BASE}/schedules?id=${encodeURIComponent(id)}`, { method: 'DELETE' });
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        renderSchedules(await res.json());
+        fetchStats();
+    } catch (e) {
+        console.error('Failed to delete schedule:', e?.message || e);
+    }
+}
+
+// Device pairing: shows a one-time code and a QR code of the pairing URL
+async function startPairing() {
+    const panel = document.getElementById('pairing-panel');
+    try {
+        const res = await apiFetch(`${API_BASE}/pairing`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ scopes: ['read'] })
+        });
+        if (!res.ok) throw new Error(`HTTP ${res.status}`);
+        const pairing = await res.json();
+
+        document.getElementById('pairing-qr').innerHTML = pairing.qrSvg || '';
+        document.getElementById('pairing-code').textContent = pairing.code;
+        document.getElementById('pairing-url').textContent = pairing.url
+            || 'Not reachable from other devices; start the server with -bind 0.0.0.0';
+        document.getElementById('pairing-expires').textContent = formatTime(pairing.expires);
+        panel.hidden = false;
+    } catch (e) {
+        console.error('Failed to start pairing:', e?.message || e);
+        document.getElementById('pairing-code').textContent = 'Unavailable';
+        panel.hidden = false;
+    }
+}
+
+// UI login session (only when a UI password is configured)
+async function loadSession() {
+    try {
+        const res = await fetch(`${API_BASE}/login`, { cache: 'no-store' });
+        if (!res.ok) return;
+        const session = await res.json();
+        document.getElementById('logout-btn').hidden = !session.enabled;
+    } catch (e) {
+        console.debug('Failed to load session:', e?.message || e);
+    }
+}
+
+async function logout() {
+    try {
+        await apiFetch(`${API_BASE}/logout`, { method: 'POST' });
+    } finally {
+        window.location.replace('/ui/login.html');
+    }
+}
+
 function initEvents() {
     document.getElementById('change-dir-btn').addEventListener('click', handleDirectorySelection);
+    document.getElementById('open-folder-btn').addEventListener('click', openRecordingsFolder);
+    document.getElementById('autostart-toggle').addEventListener('change', handleAutoStartToggle);
+    document.querySelectorAll('[data-notification]').forEach(toggle => {
+        toggle.addEventListener('change', handleNotificationToggle);
+    });
+    document.querySelectorAll('[data-preference]').forEach(select => {
+        select.addEventListener('change', handlePreferenceChange);
+    });
+    document.getElementById('profile-select').addEventListener('change', handleProfileChange);
+    document.getElementById('copy-token-btn').addEventListener('click', copyApiToken);
+    document.getElementById('rotate-token-btn').addEventListener('click', rotateApiToken);
+    document.getElementById('export-config-btn').addEventListener('click', exportConfig);
+    const importFile = document.getElementById('import-config-file');
+    document.getElementById('import-config-btn').addEventListener('click', () => importFile.click());
+    importFile.addEventListener('change', () => {
+        if (importFile.files[0]) importConfig(importFile.files[0]);
+        importFile.value = '';
+    });
+    document.getElementById('factory-reset-btn').addEventListener('click', factoryReset);
+    document.getElementById('pair-device-btn').addEventListener('click', startPairing);
+    document.getElementById('check-updates-btn').addEventListener('click', handleCheckUpdates);
+    document.getElementById('install-ffmpeg-btn').addEventListener('click', handleInstallFFmpeg);
+    document.getElementById('save-ffmpeg-path-btn').addEventListener('click', handleSaveFFmpegPath);
+    document.getElementById('redetect-ffmpeg-btn').addEventListener('click', handleRedetectFFmpeg);
+    document.getElementById('install-update-btn').addEventListener('click', handleInstallUpdate);
+    document.getElementById('autoupdate-toggle').addEventListener('change', handleAutoUpdateToggle);
+    document.getElementById('banner-install-btn').addEventListener('click', handleInstallUpdate);
+    document.getElementById('banner-restart-btn').addEventListener('click', handleRestartUpdate);
+    document.getElementById('banner-dismiss-btn').addEventListener('click', dismissUpdateBanner);
+    document.getElementById('logout-btn').addEventListener('click', logout);
+    document.getElementById('recordings-list').addEventListener('click', handleStopClick);
+    document.getElementById('recordings-list').addEventListener('click', handleSplitClick);
+    document.getElementById('recordings-list').addEventListener('click', handleScreenshotClick);
+    document.getElementById('recordings-list').addEventListener('click', handleMarkClick);
+    document.getElementById('recordings-list').addEventListener('click', handlePreviewClick);
+    document.getElementById('recordings-list').addEventListener('click', handleLiveLinkClick);
+    document.getElementById('recordings-list').addEventListener('click', handleCastLiveClick);
+    document.getElementById('preview-close-btn').addEventListener('click', closePreview);
+    document.getElementById('stop-all-btn').addEventListener('click', stopAllRecordings);
+    document.getElementById('schedule-form').addEventListener('submit', handleScheduleSubmit);
+    document.addEventListener('click', openSignedLink);
 }
 
-function init() {
+async function init() {
+    state.apiToken = await loadApiToken();
+    await loadTranslations();
+    renderApiToken();
     lucide.createIcons();
     initTheme();
+    initZoom();
     initEvents();
+    initMiniMode();
+    initDropImport();
+    document.getElementById('player-on-top-field').hidden = !window.openPlayer;
+    loadPreferences();
+    loadSession();
     checkHealth();
     loadServerInfo();
+    loadProfiles();
+    loadVersion();
+    loadUpdateStatus();
+    loadInstallJob();
+    loadFFmpegPath();
+    loadPortMapping();
+    loadCrashReports();
+    loadTokens();
+    loadSchedules();
+    loadRecentRecordings();
     renderStats();
     renderUptime();
-    fetchStats();
+    subscribeStats();
+    fetchAlerts();
+    fetchBandwidth();
 
     setInterval(checkHealth, INTERVALS.HEALTH_CHECK);
-    setInterval(fetchStats, INTERVALS.STATS_UPDATE);
+    setInterval(fetchBandwidth, INTERVALS.BANDWIDTH_UPDATE);
+    setInterval(fetchAlerts, INTERVALS.HEALTH_CHECK);
+    setInterval(loadRecentRecordings, INTERVALS.HEALTH_CHECK);
+    setInterval(loadSchedules, INTERVALS.HEALTH_CHECK);
     setInterval(renderUptime, INTERVALS.UPTIME_UPDATE);
+    setInterval(loadUpdateStatus, INTERVALS.UPDATE_STATUS);
 }
 
 document.addEventListener('DOMContentLoaded', init);
\ No newline at end of file
@@ -0,0 +1,42 @@
+function applyTheme() {
+    const saved = localStorage.getItem('theme');
+    const sysDark = window.matchMedia('(prefers-color-scheme: dark)').matches;
+    document.documentElement.setAttribute('data-theme', saved || (sysDark ? 'dark' : 'light'));
+}
+
+async function login(event) {
+    event.preventDefault();
+    const error = document.getElementById('login-error');
+    error.hidden = true;
+
+    try {
+        const res = await fetch('/api/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ password: document.getElementById('password').value })
+        });
+        if (!res.ok) {
+            error.textContent = failureMessage(res, 'Incorrect password', 'Sign in failed');
+            error.hidden = false;
+            return;
+        }
+        window.location.replace('/ui/index.html');
+    } catch (e) {
+        error.textContent = 'Server unreachable';
+        error.hidden = false;
+    }
+}
+
+// 429 means this address is locked out after too many failed attempts.
+function failureMessage(res, unauthorized, fallback) {
+    if (res.status === 401) return unauthorized;
+    if (res.status === 429) {
+        const seconds = Number(res.headers.get('Retry-After')) || 60;
+        return `Too many failed attempts, try again in ${Math.ceil(seconds / 60)} min`;
+    }
+    return `${fallback} (${res.status})`;
+}
+
+applyTheme();
+lucide.createIcons();
+document.getElementById('login-form').addEventListener('submit', login);
@@ -0,0 +1,55 @@
+function applyTheme() {
+    const saved = localStorage.getItem('theme');
+    const sysDark = window.matchMedia('(prefers-color-scheme: dark)').matches;
+    document.documentElement.setAttribute('data-theme', saved || (sysDark ? 'dark' : 'light'));
+}
+
+// The code arrives in the URL fragment so it never reaches server logs.
+function codeFromHash() {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    return params.get('code') || '';
+}
+
+async function pair(event) {
+    event.preventDefault();
+    const error = document.getElementById('pair-error');
+    error.hidden = true;
+
+    try {
+        const res = await fetch('/api/pairing/redeem', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                code: document.getElementById('pair-code').value,
+                name: document.getElementById('pair-name').value
+            })
+        });
+        if (!res.ok) {
+            error.textContent = failureMessage(res, 'Invalid or expired code', 'Pairing failed');
+            error.hidden = false;
+            return;
+        }
+        const { token } = await res.json();
+        localStorage.setItem('apiToken', token);
+        window.location.replace('/ui/index.html');
+    } catch (e) {
+        error.textContent = 'Server unreachable';
+        error.hidden = false;
+    }
+}
+
+// 429 means this address is locked out after too many failed attempts.
+function failureMessage(res, unauthorized, fallback) {
+    if (res.status === 401) return unauthorized;
+    if (res.status === 429) {
+        const seconds = Number(res.headers.get('Retry-After')) || 60;
+        return `Too many failed attempts, try again in ${Math.ceil(seconds / 60)} min`;
+    }
+    return `${fallback} (${res.status})`;
+}
+
+applyTheme();
+lucide.createIcons();
+document.getElementById('pair-code').value = codeFromHash();
+document.getElementById('pair-name').value = navigator.platform || '';
+document.getElementById('pair-form').addEventListener('submit', pair);
@@ -0,0 +1,26 @@
+//go:build headless
+// +build headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"recorder/services"
+)
+
+// desktopUI is false in headless builds, which always serve without a window.
+const desktopUI = false
+
+// launchUI is never called in headless builds; it exists so that runServe
+// compiles either way.
+func launchUI(addr string, uiURL string, apiToken *services.MasterToken, updater *services.Updater, instance *services.InstanceLock, recorder *services.RecorderService, tlsEnabled bool) (bool, error) {
+	return false, nil
+}
+
+// runPlayer needs a window, which headless builds do not have.
+func runPlayer(args []string) int {
+	fmt.Fprintln(os.Stderr, "the player is not available in headless builds")
+	return 1
+}
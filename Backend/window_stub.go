@@ -0,0 +1,40 @@
+//go:build !windows && !headless
+// +build !windows,!headless
+
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+
+	webview "github.com/webview/webview_go"
+)
+
+// minimizeWindow is a no-op here: webview exposes no portable way to minimize,
+// and the native GTK/Cocoa calls would need cgo, so the window opens normally.
+func minimizeWindow(w webview.WebView) {
+}
+
+// focusWindow is a no-op for the same reason; the window stays where it is.
+func focusWindow(w webview.WebView) {
+}
+
+// setAlwaysOnTop is a no-op for the same reason as minimizeWindow.
+func setAlwaysOnTop(w webview.WebView, onTop bool) {
+}
+
+// confirmClose cannot intercept closing the window here without cgo either;
+// launchUI asks about active recordings once the window is gone instead.
+func confirmClose(w webview.WebView, active func() int, choice *quitChoice) {
+}
+
+// webviewAvailable reports an error when there is no graphical session for
+// GTK to open a window in. A missing WebKitGTK already stops the executable
+// from loading, so it needs no check here.
+func webviewAvailable() error {
+	if runtime.GOOS == "darwin" || os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" {
+		return nil
+	}
+	return errors.New("no graphical session (DISPLAY and WAYLAND_DISPLAY are not set)")
+}
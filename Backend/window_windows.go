@@ -0,0 +1,155 @@
+//go:build windows && !headless
+// +build windows,!headless
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	webview "github.com/webview/webview_go"
+)
+
+var (
+	showWindow          = user32.NewProc("ShowWindow")
+	setForegroundWindow = user32.NewProc("SetForegroundWindow")
+	setWindowLongPtr    = user32.NewProc("SetWindowLongPtrW")
+	callWindowProc      = user32.NewProc("CallWindowProcW")
+	messageBox          = user32.NewProc("MessageBoxW")
+	setWindowPos        = user32.NewProc("SetWindowPos")
+	regGetValue         = syscall.NewLazyDLL("advapi32.dll").NewProc("RegGetValueW")
+)
+
+const (
+	SW_MINIMIZE = 6
+	SW_RESTORE  = 9
+
+	WM_CLOSE       = 0x0010
+	MB_YESNOCANCEL = 0x00000003
+	MB_ICONWARNING = 0x00000030
+	IDYES          = 6
+	IDNO           = 7
+
+	SWP_NOSIZE = 0x0001
+	SWP_NOMOVE = 0x0002
+
+	HKEY_CURRENT_USER  = 0x80000001
+	HKEY_LOCAL_MACHINE = 0x80000002
+	RRF_RT_REG_SZ      = 0x00000002
+)
+
+// webView2ClientKey is where the WebView2 runtime installer records its
+// version, per machine (for 64-bit and 32-bit Windows) or per user.
+const webView2ClientKey = `Microsoft\EdgeUpdate\Clients\{F3017226-FE2A-4295-8BDF-00C3A9A7E4C5}`
+
+// gwlpWndProc is GWLP_WNDPROC, hwndTopmost HWND_TOPMOST and hwndNoTopmost
+// HWND_NOTOPMOST; variables, as negative constants do not convert to uintptr.
+var (
+	gwlpWndProc   = -4
+	hwndTopmost   = -1
+	hwndNoTopmost = -2
+)
+
+func windowHandle(w webview.WebView) uintptr {
+	hwnd := uintptr(w.Window())
+	if hwnd == 0 {
+		hwnd = findWebViewWindowByTitle("Recording Server")
+	}
+	return hwnd
+}
+
+func minimizeWindow(w webview.WebView) {
+	if hwnd := windowHandle(w); hwnd != 0 {
+		showWindow.Call(hwnd, SW_MINIMIZE)
+	}
+}
+
+// focusWindow restores the window if it is minimized and brings it to the front.
+func focusWindow(w webview.WebView) {
+	if hwnd := windowHandle(w); hwnd != 0 {
+		showWindow.Call(hwnd, SW_RESTORE)
+		setForegroundWindow.Call(hwnd)
+	}
+}
+
+// setAlwaysOnTop keeps the window above windows that are not topmost, or
+// lets other windows cover it again.
+func setAlwaysOnTop(w webview.WebView, onTop bool) {
+	after := hwndNoTopmost
+	if onTop {
+		after = hwndTopmost
+	}
+	if hwnd := windowHandle(w); hwnd != 0 {
+		setWindowPos.Call(hwnd, uintptr(after), 0, 0, 0, 0, SWP_NOMOVE|SWP_NOSIZE)
+	}
+}
+
+// confirmClose replaces the window procedure so that closing the window while
+// recordings are active asks first: Yes stops and saves them, No keeps them
+// recording in the background and Cancel leaves the window open.
+func confirmClose(w webview.WebView, active func() int, choice *quitChoice) {
+	hwnd := windowHandle(w)
+	if hwnd == 0 || setWindowLongPtr.Find() != nil {
+		return
+	}
+
+	var previous uintptr
+	wndProc := syscall.NewCallback(func(hwnd, msg, wParam, lParam uintptr) uintptr {
+		if msg == WM_CLOSE {
+			if n := active(); n > 0 {
+				text, _ := syscall.UTF16PtrFromString(fmt.Sprintf(quitPrompt, n) + "\n\nCancel keeps the window open.")
+				title, _ := syscall.UTF16PtrFromString("Recordings in progress")
+				answer, _, _ := messageBox.Call(hwnd, uintptr(unsafe.Pointer(text)), uintptr(unsafe.Pointer(title)), MB_YESNOCANCEL|MB_ICONWARNING)
+				switch answer {
+				case IDYES:
+					*choice = quitStopRecordings
+				case IDNO:
+					*choice = quitKeepRecording
+				default:
+					return 0
+				}
+			}
+		}
+		result, _, _ := callWindowProc.Call(previous, hwnd, msg, wParam, lParam)
+		return result
+	})
+	previous, _, _ = setWindowLongPtr.Call(hwnd, uintptr(gwlpWndProc), wndProc)
+}
+
+// webviewAvailable reports an error when the WebView2 runtime is not
+// installed. webview then still opens its window, but leaves it blank.
+func webviewAvailable() error {
+	if os.Getenv("WEBVIEW2_BROWSER_EXECUTABLE_FOLDER") != "" {
+		return nil
+	}
+	keys := []struct {
+		root uintptr
+		path string
+	}{
+		{HKEY_LOCAL_MACHINE, `SOFTWARE\WOW6432Node\` + webView2ClientKey},
+		{HKEY_LOCAL_MACHINE, `SOFTWARE\` + webView2ClientKey},
+		{HKEY_CURRENT_USER, `Software\` + webView2ClientKey},
+	}
+	for _, key := range keys {
+		if version := readRegistryString(key.root, key.path, "pv"); version != "" && version != "0.0.0.0" {
+			return nil
+		}
+	}
+	return errors.New("the WebView2 runtime is not installed")
+}
+
+func readRegistryString(root uintptr, path, name string) string {
+	pathPtr, _ := syscall.UTF16PtrFromString(path)
+	namePtr, _ := syscall.UTF16PtrFromString(name)
+	buf := make([]uint16, 64)
+	size := uint32(len(buf) * 2)
+	status, _, _ := regGetValue.Call(root, uintptr(unsafe.Pointer(pathPtr)), uintptr(unsafe.Pointer(namePtr)),
+		RRF_RT_REG_SZ, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if status != 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
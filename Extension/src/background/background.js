@@ -2,6 +2,10 @@ const activeRecordings = new Map();
 const activeCountdowns = new Map();
 const COUNTDOWN_UPDATE_INTERVAL_MS = 250;
 const RECORDING_BUFFER_SECONDS = 2;
+const TAB_LOAD_TIMEOUT_MS = 30000;
+// Backend recordings in progress, kept in chrome.storage.local so that they
+// can be recovered when the extension restarts after a crash.
+const RECOVERABLE_RECORDINGS_KEY = 'recoverableRecordings';
 
 /**
  * Sends a message to the Chrome runtime with error handling.
@@ -17,7 +21,7 @@ function sendMessageSafely(message, errorContext) {
 
 chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
   if (message.type === 'start-recording') {
-    handleStartRecording(message.tabId, message.customFilename, message.countdownSeconds, message.useBackend || false, sendResponse);
+    handleStartRecording(message.tabId, message.customFilename, message.countdownSeconds, message.useBackend || false, sendResponse, message.audioOnly || false, message.container || 'webm', message.priority || 'normal', message.group || '', message.profile || '');
     return true;
   } else if (message.type === 'stop-recording') {
     handleStopRecording(message.tabId, sendResponse);
@@ -41,6 +45,9 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
       tabId: message.tabId
     }, 'Failed to send recording-stopped notification');
     return true;
+  } else if (message.type === 'scheduled-start') {
+    handleScheduledStart(message.scheduleId, message.name, message.url);
+    return true;
   } else if (message.type === 'recording-error') {
     if (message.tabId) {
       cleanupRecording(message.tabId);
@@ -118,6 +125,34 @@ function sendRecordingError(tabId, message) {
 function cleanupRecording(tabId) {
   activeRecordings.delete(tabId);
   stopCountdown(tabId);
+  forgetRecoverableRecording(tabId).catch((error) => {
+    console.error(`[BACKGROUND] Failed to forget recording of tab ${tabId}:`, error);
+  });
+}
+
+/**
+ * Keeps what a backend recording is made of, to record the tab again if the
+ * extension crashes while recording it.
+ * @param {number} tabId - The tab ID being recorded
+ * @param {Object} recording - name, audioOnly, container, priority, group and profile
+ * @returns {Promise<void>}
+ */
+async function rememberRecoverableRecording(tabId, recording) {
+  const { [RECOVERABLE_RECORDINGS_KEY]: recordings = {} } = await chrome.storage.local.get(RECOVERABLE_RECORDINGS_KEY);
+  recordings[tabId] = recording;
+  await chrome.storage.local.set({ [RECOVERABLE_RECORDINGS_KEY]: recordings });
+}
+
+/**
+ * Forgets the recording of a tab kept by rememberRecoverableRecording.
+ * @param {number} tabId - The tab ID that is no longer recorded
+ * @returns {Promise<void>}
+ */
+async function forgetRecoverableRecording(tabId) {
+  const { [RECOVERABLE_RECORDINGS_KEY]: recordings = {} } = await chrome.storage.local.get(RECOVERABLE_RECORDINGS_KEY);
+  if (!(tabId in recordings)) return;
+  delete recordings[tabId];
+  await chrome.storage.local.set({ [RECOVERABLE_RECORDINGS_KEY]: recordings });
 }
 
 /**
@@ -158,9 +193,14 @@ async function acquireMediaStream(tabId) {
  * @param {number} countdownSeconds - Optional countdown duration
  * @param {boolean} useBackend - Whether to use backend server for storage
  * @param {Function} sendResponse - Callback to send response to caller
+ * @param {boolean} audioOnly - Whether to record only the tab's sound
+ * @param {string} container - Requested container: 'webm', 'mkv' or 'mp4'
+ * @param {string} priority - 'high' to have the backend save this recording first when it is busy
+ * @param {string} group - Optional group ID shared by recordings of several tabs made together
+ * @param {string} profile - Optional backend profile to save the recording with, e.g. to record work tabs to the NAS
  * @returns {Promise<void>}
  */
-async function handleStartRecording(tabId, customFilename, countdownSeconds, useBackend, sendResponse) {
+async function handleStartRecording(tabId, customFilename, countdownSeconds, useBackend, sendResponse, audioOnly = false, container = 'webm', priority = 'normal', group = '', profile = '') {
   try {
     if (activeRecordings.has(tabId)) {
       sendResponse({ error: 'Already recording this tab' });
@@ -177,10 +217,17 @@ async function handleStartRecording(tabId, customFilename, countdownSeconds, use
       useBackend: useBackend
     });
 
+    const { apiToken, backendUrl, signingSecret } = await chrome.storage.local.get(['apiToken', 'backendUrl', 'signingSecret']);
+    // The page being recorded, for the backend to name and find the recording by
+    const tab = await chrome.tabs.get(tabId).catch(() => null);
+
     await chrome.runtime.sendMessage({
       type: 'set-backend-mode',
       target: 'offscreen',
-      useBackend: useBackend
+      useBackend: useBackend,
+      apiToken: apiToken || '',
+      signingSecret: signingSecret || '',
+      backendUrl: backendUrl || ''
     });
 
     await chrome.runtime.sendMessage({
@@ -188,13 +235,35 @@ async function handleStartRecording(tabId, customFilename, countdownSeconds, use
       target: 'offscreen',
       tabId: tabId,
       streamId: streamId,
-      name: customFilename || `recording-${tabId}`
+      name: customFilename || `recording-${tabId}`,
+      audioOnly: audioOnly,
+      container: container,
+      priority: priority,
+      group: group,
+      profile: profile,
+      source: {
+        url: tab?.url || '',
+        title: tab?.title || '',
+        favIconUrl: tab?.favIconUrl || ''
+      }
     });
 
     if (countdownSeconds && countdownSeconds > 0) {
       startCountdown(tabId, countdownSeconds);
     }
 
+    if (useBackend) {
+      await rememberRecoverableRecording(tabId, {
+        name: customFilename || `recording-${tabId}`,
+        audioOnly,
+        container,
+        priority,
+        group,
+        profile,
+        startTime: activeRecordings.get(tabId).startTime
+      });
+    }
+
     sendMessageSafely({
       type: 'recording-started',
       tabId: tabId
@@ -278,4 +347,225 @@ chrome.tabs.onUpdated.addListener((tabId, changeInfo) => {
     stopCountdown(tabId);
     handleStopRecording(tabId, () => {});
   }
-});
\ No newline at end of file
+});
+
+// The split-recording shortcut goes on recording the active tab into a new
+// file, e.g. between the items of a meeting.
+chrome.commands.onCommand.addListener(async (command) => {
+  if (command !== 'split-recording' && command !== 'add-marker') return;
+  // Taken before anything is awaited, so the marker is where the key was pressed
+  const at = new Date().toISOString();
+  const [tab] = await chrome.tabs.query({ active: true, currentWindow: true });
+  if (!tab || !activeRecordings.has(tab.id)) return;
+  if (command === 'add-marker') {
+    sendMessageSafely({
+      type: 'add-marker',
+      target: 'offscreen',
+      tabId: tab.id,
+      at
+    }, 'Failed to add marker');
+    return;
+  }
+  sendMessageSafely({
+    type: 'split-recording',
+    target: 'offscreen',
+    tabId: tab.id
+  }, 'Failed to split recording');
+});
+
+/**
+ * Keeps the backend's command channel open in the offscreen document while a
+ * backend is configured, so that the server can start scheduled recordings.
+ * @returns {Promise<void>}
+ */
+async function listenForBackendCommands() {
+  try {
+    const { apiToken, backendUrl } = await chrome.storage.local.get(['apiToken', 'backendUrl']);
+    if (!apiToken && !backendUrl) return;
+
+    await ensureOffscreenDocument();
+    await chrome.runtime.sendMessage({
+      type: 'listen-commands',
+      apiToken: apiToken || '',
+      backendUrl: backendUrl || ''
+    });
+  } catch (error) {
+    console.error('[BACKGROUND] Failed to listen for backend commands:', error);
+  }
+}
+
+/**
+ * Waits until a tab has finished loading, or for TAB_LOAD_TIMEOUT_MS.
+ * @param {number} tabId - The tab ID to wait for
+ * @returns {Promise<void>}
+ */
+function waitForTabLoad(tabId) {
+  return new Promise((resolve) => {
+    const done = () => {
+      clearTimeout(timeoutId);
+      chrome.tabs.onUpdated.removeListener(listener);
+      resolve();
+    };
+    const listener = (id, changeInfo) => {
+      if (id === tabId && changeInfo.status === 'complete') done();
+    };
+    const timeoutId = setTimeout(done, TAB_LOAD_TIMEOUT_MS);
+    chrome.tabs.onUpdated.addListener(listener);
+  });
+}
+
+/**
+ * Tells the backend which tab records a schedule, or why none does.
+ * @param {string} scheduleId - The schedule the backend asked to record
+ * @param {Object} report - {tabId} or {error}
+ * @returns {Promise<Response>} The backend's response
+ */
+async function reportScheduledSession(scheduleId, report) {
+  const { apiToken, backendUrl } = await chrome.storage.local.get(['apiToken', 'backendUrl']);
+  const headers = { 'Content-Type': 'application/json' };
+  if (apiToken) headers['Authorization'] = `Bearer ${apiToken}`;
+  return fetch(`${backendUrl || 'http://localhost:8080'}/api/schedules/${encodeURIComponent(scheduleId)}/session`, {
+    method: 'POST',
+    headers,
+    body: JSON.stringify(report)
+  });
+}
+
+/**
+ * Handles a scheduled recording pushed by the backend: opens its URL in a new
+ * tab and records it in backend mode. The backend stops it at the scheduled
+ * time.
+ * @param {string} scheduleId - The schedule to record
+ * @param {string} name - The recording name
+ * @param {string} url - The page to record
+ * @returns {Promise<void>}
+ */
+async function handleScheduledStart(scheduleId, name, url) {
+  let tabId = null;
+  try {
+    const tab = await chrome.tabs.create({ url, active: true });
+    tabId = tab.id;
+    await waitForTabLoad(tabId);
+
+    const response = await new Promise((resolve) => {
+      handleStartRecording(tabId, name, 0, true, resolve);
+    });
+    if (response.error) {
+      throw new Error(response.error);
+    }
+
+    const result = await reportScheduledSession(scheduleId, { tabId });
+    if (!result.ok) {
+      // The schedule was deleted or has given up on this start
+      console.warn(`[BACKGROUND] Backend rejected scheduled session: ${result.status}`);
+      handleStopRecording(tabId, () => {});
+    }
+  } catch (error) {
+    console.error(`[BACKGROUND] Failed to start scheduled recording of ${url}:`, error);
+    reportScheduledSession(scheduleId, { error: error.message }).catch((err) => {
+      console.error('[BACKGROUND] Failed to report scheduled recording error:', err);
+    });
+  }
+}
+
+/**
+ * Asks the offscreen document which tabs it is still recording, e.g. after
+ * the service worker was stopped for being idle.
+ * @returns {Promise<number[]>} The tab IDs, none when there is no document
+ */
+async function getOffscreenRecordings() {
+  const existingContexts = await chrome.runtime.getContexts({});
+  if (!existingContexts.some((c) => c.contextType === 'OFFSCREEN_DOCUMENT')) {
+    return [];
+  }
+  const response = await chrome.runtime.sendMessage({
+    type: 'get-active-recordings',
+    target: 'offscreen'
+  }).catch(() => null);
+  return response?.tabIds || [];
+}
+
+/**
+ * Asks the backend what to do with a recording the extension lost when it
+ * crashed, and records the tab again unless the backend says to stop.
+ * @param {number} tabId - The tab ID that was being recorded
+ * @param {Object} recording - What was kept by rememberRecoverableRecording
+ * @returns {Promise<void>}
+ */
+async function recoverRecording(tabId, recording) {
+  const tab = await chrome.tabs.get(tabId).catch(() => null);
+  if (!tab) {
+    // The backend finishes the recording when its idle timeout passes
+    await forgetRecoverableRecording(tabId);
+    return;
+  }
+
+  const { apiToken, backendUrl } = await chrome.storage.local.get(['apiToken', 'backendUrl']);
+  const headers = { 'Content-Type': 'application/json' };
+  if (apiToken) headers['Authorization'] = `Bearer ${apiToken}`;
+  const response = await fetch(`${backendUrl || 'http://localhost:8080'}/api/recordings/${tabId}/recover`, {
+    method: 'POST',
+    headers
+  });
+  if (!response.ok) {
+    throw new Error(`${response.status} ${(await response.text()).trim()}`);
+  }
+  const decision = await response.json();
+  await forgetRecoverableRecording(tabId);
+  if (decision.action === 'stop') {
+    console.log(`[BACKGROUND] Backend finished the interrupted recording of tab ${tabId}`);
+    return;
+  }
+
+  console.log(`[BACKGROUND] Recording tab ${tabId} again (${decision.action}) after a crash`);
+  const result = await new Promise((resolve) => {
+    handleStartRecording(tabId, decision.name || recording.name, 0, true, resolve, recording.audioOnly, recording.container, recording.priority, recording.group || '', recording.profile || '');
+  });
+  if (result.error) {
+    throw new Error(result.error);
+  }
+}
+
+/**
+ * Recovers the backend recordings that were in progress when the extension
+ * crashed or was restarted. Recordings the offscreen document still holds
+ * only lost their state in the service worker, which is restored.
+ * @returns {Promise<void>}
+ */
+async function recoverRecordings() {
+  try {
+    const { [RECOVERABLE_RECORDINGS_KEY]: recordings = {} } = await chrome.storage.local.get(RECOVERABLE_RECORDINGS_KEY);
+    if (Object.keys(recordings).length === 0) return;
+
+    const stillRecording = await getOffscreenRecordings();
+    for (const [key, recording] of Object.entries(recordings)) {
+      const tabId = Number(key);
+      if (activeRecordings.has(tabId)) continue;
+      if (stillRecording.includes(tabId)) {
+        activeRecordings.set(tabId, {
+          startTime: recording.startTime,
+          customFilename: recording.name,
+          useBackend: true
+        });
+        continue;
+      }
+      recoverRecording(tabId, recording).catch((error) => {
+        console.error(`[BACKGROUND] Failed to recover the recording of tab ${tabId}:`, error);
+        sendRecordingError(tabId, `Failed to recover the recording: ${error.message}`);
+      });
+    }
+  } catch (error) {
+    console.error('[BACKGROUND] Failed to recover recordings:', error);
+  }
+}
+
+recoverRecordings();
+
+chrome.runtime.onStartup.addListener(listenForBackendCommands);
+chrome.runtime.onInstalled.addListener(listenForBackendCommands);
+
+chrome.storage.onChanged.addListener((changes, area) => {
+  if (area === 'local' && (changes.apiToken || changes.backendUrl)) {
+    listenForBackendCommands();
+  }
+});
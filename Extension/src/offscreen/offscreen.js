@@ -1,16 +1,93 @@
 let useBackendMode = false;
-const backendPort = '8080';
-const backendBaseUrl = `http://localhost:${backendPort}/api`;
+let backendApiToken = '';
+let backendSigningSecret = '';
+const defaultBackendUrl = 'http://localhost:8080';
+let backendBaseUrl = `${defaultBackendUrl}/api`;
 
 const activeRecorders = new Map();
 const activeStreams = new Map();
 const recordingMetadata = new Map();
 const recordedChunksMap = new Map();
+// The upload of each tab's latest chunk, so that chunks are sent one after
+// another and stay in order while one is being retried.
+const chunkUploads = new Map();
+// The chunks and bytes the backend accepted of each file, keyed by tab and
+// the file's timestamp, reported when the file ends so that the backend can
+// tell whether any of it went missing.
+const sentTotals = new Map();
+// The sequence number of the last chunk of each file, keyed like sentTotals.
+// Chunks are numbered from 1 in the order they were recorded, so that the
+// backend writes them in that order however they arrive.
+const chunkSequences = new Map();
+
+/**
+ * Returns the sequence number of the next chunk of the file of tabId started
+ * at timestamp.
+ */
+function nextChunkSequence(tabId, timestamp) {
+  const key = `${tabId}:${timestamp}`;
+  const sequence = (chunkSequences.get(key) || 0) + 1;
+  chunkSequences.set(key, sequence);
+  return sequence;
+}
+
+/**
+ * Returns what was sent of the file of tabId started at timestamp, and how
+ * long it was recorded until endedAt, for a 'split' or 'stopped' status.
+ */
+function takeSentTotals(tabId, timestamp, endedAt) {
+  const key = `${tabId}:${timestamp}`;
+  const totals = sentTotals.get(key) || { chunks: 0, bytes: 0 };
+  sentTotals.delete(key);
+  chunkSequences.delete(key);
+  return {
+    chunksSent: totals.chunks,
+    bytesSent: totals.bytes,
+    durationMs: Math.max(0, endedAt - timestamp)
+  };
+}
+
+// How long to wait before sending a chunk again when the backend cannot be
+// reached or is restarting. The backend resumes the recording into the same
+// file when it comes back, so a short outage does not end the recording.
+const CHUNK_RETRY_DELAYS_MS = [1000, 2000, 5000, 10000, 15000];
+const RETRYABLE_STATUSES = [502, 503, 504];
+
+// MediaRecorder types to try for each container the popup offers, best first.
+// When the browser supports none of them the recording falls back to WebM;
+// the container actually recorded is what the backend is told.
+const RECORDER_MIME_TYPES = {
+  webm: {
+    video: ['video/webm; codecs=vp8,opus', 'video/webm'],
+    audio: ['audio/webm; codecs=opus', 'audio/webm']
+  },
+  mkv: {
+    video: ['video/x-matroska; codecs=avc1,opus', 'video/x-matroska'],
+    audio: ['audio/x-matroska; codecs=opus', 'audio/x-matroska']
+  },
+  mp4: {
+    video: ['video/mp4; codecs=avc1,opus', 'video/mp4; codecs=avc1,mp4a.40.2', 'video/mp4'],
+    audio: ['audio/mp4; codecs=opus', 'audio/mp4']
+  }
+};
+
+// File extensions of recordings saved in standalone mode.
+const CONTAINER_EXTENSIONS = {
+  webm: { video: '.webm', audio: '.weba' },
+  mkv: { video: '.mkv', audio: '.mka' },
+  mp4: { video: '.mp4', audio: '.m4a' }
+};
 
 let pendingChunks = 0;
 let stopRequested = false;
 let stopResolve = null;
 
+// Commands pushed by the backend while recording in backend mode, such as a
+// recording being stopped from the server's UI. With a backend configured the
+// channel stays open between recordings too, for scheduled recordings.
+let commandSource = null;
+let listenForCommands = false;
+
 function sendRecordingError(tabId, message) {
   chrome.runtime.sendMessage({
     type: 'recording-error',
@@ -21,13 +98,282 @@ function sendRecordingError(tabId, message) {
   });
 }
 
+async function signRecording(tabId, timestamp, body) {
+  const encoder = new TextEncoder();
+  const key = await crypto.subtle.importKey(
+    'raw',
+    encoder.encode(backendSigningSecret),
+    { name: 'HMAC', hash: 'SHA-256' },
+    false,
+    ['sign']
+  );
+  const signature = await crypto.subtle.sign('HMAC', key, encoder.encode(`${tabId}\n${timestamp}\n${body}`));
+  return Array.from(new Uint8Array(signature), (b) => b.toString(16).padStart(2, '0')).join('');
+}
+
+function connectCommands() {
+  if ((!useBackendMode && !listenForCommands) || commandSource) return;
+  // EventSource cannot set headers, so the token goes in the query
+  const url = new URL(`${backendBaseUrl}/recordings/events`);
+  if (backendApiToken) url.searchParams.set('token', backendApiToken);
+  commandSource = new EventSource(url);
+  commandSource.addEventListener('stop', (event) => {
+    const { tabId } = JSON.parse(event.data);
+    console.log(`[OFFSCREEN] Backend stopped the recording of tab ${tabId}`);
+    stopRecorder(tabId);
+  });
+  commandSource.addEventListener('split', (event) => {
+    const { tabId } = JSON.parse(event.data);
+    console.log(`[OFFSCREEN] Backend split the recording of tab ${tabId}`);
+    splitRecorder(tabId);
+  });
+  commandSource.addEventListener('screenshot', (event) => {
+    const { tabId } = JSON.parse(event.data);
+    console.log(`[OFFSCREEN] Backend asked for a screenshot of tab ${tabId}`);
+    takeScreenshot(tabId);
+  });
+  commandSource.addEventListener('start', (event) => {
+    const { scheduleId, name, url } = JSON.parse(event.data);
+    console.log(`[OFFSCREEN] Backend scheduled a recording of ${url}`);
+    chrome.runtime.sendMessage({
+      type: 'scheduled-start',
+      scheduleId,
+      name,
+      url
+    }).catch((error) => {
+      console.error('[OFFSCREEN] Failed to forward scheduled recording:', error);
+    });
+  });
+}
+
+function disconnectCommands() {
+  if (commandSource && activeRecorders.size === 0 && !listenForCommands) {
+    commandSource.close();
+    commandSource = null;
+  }
+}
+
+function stopRecorder(tabId) {
+  stopRequested = true;
+  const mediaRecorder = activeRecorders.get(tabId);
+
+  if (mediaRecorder && mediaRecorder.state !== 'inactive') {
+    console.log(`[OFFSCREEN] Requesting final data chunk before stopping for tab ${tabId}`);
+    mediaRecorder.requestData();
+
+    console.log(`[OFFSCREEN] Stopping MediaRecorder for tab ${tabId}`);
+    mediaRecorder.stop();
+  }
+}
+
+async function backendHeaders(payload, body, requestId) {
+  const headers = { 'Content-Type': 'application/json', 'X-Request-ID': requestId };
+  if (backendApiToken) headers['Authorization'] = `Bearer ${backendApiToken}`;
+  if (backendSigningSecret) {
+    headers['X-Recording-Signature'] = await signRecording(payload.tabId, payload.timestamp, body);
+  }
+  return headers;
+}
+
+/**
+ * Saves the chunks recorded for tabId in standalone mode as a file.
+ * @param {number|null} part - Number of the segment of a split recording,
+ *   added to the file name
+ */
+function saveStandaloneRecording(tabId, part) {
+  const chunks = recordedChunksMap.get(tabId) || [];
+  console.log(`[OFFSCREEN] Total chunks collected: ${chunks.length}`);
+
+  if (chunks.length === 0) {
+    throw new Error('No recorded data available');
+  }
+
+  const metadata = recordingMetadata.get(tabId);
+  const audioOnly = metadata?.audioOnly || false;
+  const container = metadata?.container || 'webm';
+  const blob = new Blob(chunks, { type: chunks[0].type || (audioOnly ? 'audio/webm' : 'video/webm') });
+  const url = URL.createObjectURL(blob);
+  let filename = metadata?.name || `recording-${tabId}-${Date.now()}`;
+  const extension = CONTAINER_EXTENSIONS[container][audioOnly ? 'audio' : 'video'];
+
+  if (filename.endsWith(extension)) {
+    filename = filename.slice(0, -extension.length);
+  }
+  if (part) {
+    filename += `-part${part}`;
+  }
+  filename += extension;
+
+  console.log(`[OFFSCREEN] Sending save-recording message. Filename: ${filename}`);
+  chrome.runtime.sendMessage({
+    type: 'save-recording',
+    tabId: tabId,
+    data: url,
+    filename: filename
+  }).catch(err => console.error('[OFFSCREEN] Failed to save recording:', err));
+
+  recordedChunksMap.delete(tabId);
+}
+
+/**
+ * Finishes the current segment of the recording of tabId and goes on
+ * recording the tab into a new one, without stopping the capture. The
+ * MediaRecorder is restarted on the same stream so that each segment starts
+ * with its own header and plays on its own. In backend mode the segment is
+ * ended with a "split" request once its last chunk is sent; in standalone
+ * mode it is saved as a file of its own.
+ */
+function splitRecorder(tabId) {
+  const previous = activeRecorders.get(tabId);
+  const metadata = recordingMetadata.get(tabId);
+  const stream = activeStreams.get(tabId);
+  if (!previous || previous.state === 'inactive' || !metadata || !stream || stopRequested) {
+    console.log(`[OFFSCREEN] Tab ${tabId} is not being recorded, nothing to split`);
+    return;
+  }
+
+  const next = new MediaRecorder(stream, previous.mimeType ? { mimeType: previous.mimeType } : {});
+  next.ondataavailable = previous.ondataavailable;
+  next.onerror = previous.onerror;
+  next.onstop = previous.onstop;
+
+  const segment = metadata.segment || 1;
+  const segmentTimestamp = metadata.timestamp;
+  previous.onstop = () => {
+    const segmentEndedAt = Date.now();
+    try {
+      if (useBackendMode) {
+        const upload = (chunkUploads.get(tabId) || Promise.resolve())
+          .then(() => sendSegmentEnd(tabId, metadata.name, segmentTimestamp, segmentEndedAt));
+        chunkUploads.set(tabId, upload.catch((error) => {
+          console.error('[OFFSCREEN] Failed to split the recording:', error);
+          sendRecordingError(tabId, `Failed to split the recording: ${error.message}`);
+        }));
+      } else {
+        saveStandaloneRecording(tabId, segment);
+      }
+    } catch (error) {
+      console.error('[OFFSCREEN] Failed to save the segment:', error);
+      sendRecordingError(tabId, `Failed to split the recording: ${error.message}`);
+    }
+
+    metadata.timestamp = Date.now();
+    metadata.segment = segment + 1;
+    activeRecorders.set(tabId, next);
+    next.start(1000);
+    console.log(`[OFFSCREEN] ✂️ Split the recording of tab ${tabId}, segment ${metadata.segment} started`);
+  };
+  previous.stop();
+}
+
+/**
+ * Tells the backend that the segment of tabId recorded with timestamp is
+ * complete, ended at endedAt, so that it finishes its file.
+ */
+async function sendSegmentEnd(tabId, name, timestamp, endedAt) {
+  const payload = { name, tabId, timestamp, data: '', status: 'split', ...takeSentTotals(tabId, timestamp, endedAt) };
+  const body = JSON.stringify(payload);
+  const requestId = crypto.randomUUID();
+  const response = await fetch(`${backendBaseUrl}/recordings`, {
+    method: 'POST',
+    headers: await backendHeaders(payload, body, requestId),
+    body
+  });
+  if (!response.ok) {
+    throw new Error(`${response.status} ${(await response.text()).trim()} (request ${requestId})`);
+  }
+}
+
+/**
+ * Marks the moment at of the recording of tabId on the backend, which saves
+ * the marker with the file and makes it a chapter where the format has them.
+ * Standalone recordings have nowhere to keep markers.
+ */
+async function addMarker(tabId, at) {
+  if (!activeRecorders.has(tabId)) {
+    console.log(`[OFFSCREEN] Tab ${tabId} is not being recorded, nothing to mark`);
+    return;
+  }
+  if (!useBackendMode) {
+    console.log(`[OFFSCREEN] Markers need the backend, ignoring marker for tab ${tabId}`);
+    return;
+  }
+  try {
+    const headers = { 'Content-Type': 'application/json', 'X-Request-ID': crypto.randomUUID() };
+    if (backendApiToken) headers['Authorization'] = `Bearer ${backendApiToken}`;
+    const response = await fetch(`${backendBaseUrl}/recordings/${tabId}/markers`, {
+      method: 'POST',
+      headers,
+      body: JSON.stringify({ at })
+    });
+    if (!response.ok) {
+      throw new Error(`${response.status} ${(await response.text()).trim()}`);
+    }
+    const marker = await response.json();
+    console.log(`[OFFSCREEN] Marked "${marker.label}" at ${marker.offsetSeconds.toFixed(1)}s for tab ${tabId}`);
+  } catch (error) {
+    // Not a recording error: the recording goes on without the marker
+    console.error('[OFFSCREEN] Failed to add marker:', error);
+  }
+}
+
+/**
+ * Grabs a frame of the video of the recording of tabId at the resolution it
+ * is captured at and sends it to the backend as a PNG, which saves it next to
+ * the file.
+ */
+async function takeScreenshot(tabId) {
+  const track = activeStreams.get(tabId)?.getVideoTracks()[0];
+  if (!track) {
+    console.log(`[OFFSCREEN] Tab ${tabId} is not recording video, no screenshot to take`);
+    return;
+  }
+  try {
+    const at = new Date().toISOString();
+    const frame = await new ImageCapture(track).grabFrame();
+    const canvas = new OffscreenCanvas(frame.width, frame.height);
+    canvas.getContext('2d').drawImage(frame, 0, 0);
+    frame.close();
+    const image = await canvas.convertToBlob({ type: 'image/png' });
+
+    const headers = { 'Content-Type': 'image/png', 'X-Request-ID': crypto.randomUUID() };
+    if (backendApiToken) headers['Authorization'] = `Bearer ${backendApiToken}`;
+    const url = new URL(`${backendBaseUrl}/recordings/${tabId}/screenshots`);
+    url.searchParams.set('at', at);
+    const response = await fetch(url, { method: 'POST', headers, body: image });
+    if (!response.ok) {
+      throw new Error(`${response.status} ${(await response.text()).trim()}`);
+    }
+    const screenshot = await response.json();
+    console.log(`[OFFSCREEN] Saved screenshot ${screenshot.file} of tab ${tabId}`);
+  } catch (error) {
+    // Not a recording error: the recording goes on without the screenshot
+    console.error('[OFFSCREEN] Failed to take screenshot:', error);
+  }
+}
+
+/**
+ * Picks the MediaRecorder type for the requested container.
+ * @returns {{container: string, mimeType: string}} The container that will
+ *   be recorded and its type; an empty type leaves it to the browser.
+ */
+function chooseRecorderFormat(container, audioOnly) {
+  const kind = audioOnly ? 'audio' : 'video';
+  for (const candidate of [container, 'webm']) {
+    const types = RECORDER_MIME_TYPES[candidate]?.[kind] || [];
+    const mimeType = types.find((type) => MediaRecorder.isTypeSupported(type));
+    if (mimeType) return { container: candidate, mimeType };
+  }
+  return { container: 'webm', mimeType: '' };
+}
+
 function cleanupStream(stream) {
   if (stream) {
     stream.getTracks().forEach(track => track.stop());
   }
 }
 
-async function sendChunkToBackend(tabId, name, timestamp, chunk) {
+async function sendChunkToBackend(tabId, name, timestamp, sequence, chunk, audioOnly, container, priority, group, profile, source) {
     if (stopRequested) {
         console.log(`[OFFSCREEN] ⚠️ Stop requested, ignoring chunk for tab ${tabId}`);
         return;
@@ -56,29 +402,68 @@ async function sendChunkToBackend(tabId, name, timestamp, chunk) {
           tabId: tabId,
           timestamp: timestamp,
           data: base64data,
-          status: 'stream'
+          status: 'stream',
+          sequence: sequence,
+          audioOnly: audioOnly,
+          container: container,
+          priority: priority,
+          group: group,
+          profile: profile,
+          ...source
         };
         
         console.log(`[OFFSCREEN] Sending POST to ${backendBaseUrl}/recordings`);
         console.log(`[OFFSCREEN] Payload: name=${name}, tabId=${tabId}, timestamp=${timestamp}, status=stream, dataLength=${base64data.length}`);
         
-        const response = await fetch(`${backendBaseUrl}/recordings`, {
-          method: 'POST',
-          headers: {
-            'Content-Type': 'application/json'
-          },
-          body: JSON.stringify(payload)
-        });
-
-        console.log(`[OFFSCREEN] Backend response: ${response.status} ${response.statusText}`);
+        const body = JSON.stringify(payload);
+        const requestId = crypto.randomUUID();
+        const headers = await backendHeaders(payload, body, requestId);
+        let response;
+        for (let attempt = 0; ; attempt++) {
+          let networkError = null;
+          try {
+            response = await fetch(`${backendBaseUrl}/recordings`, {
+              method: 'POST',
+              headers: headers,
+              body: body
+            });
+          } catch (error) {
+            networkError = error;
+          }
+          if (!networkError && !RETRYABLE_STATUSES.includes(response.status)) break;
+          if (attempt >= CHUNK_RETRY_DELAYS_MS.length || stopRequested) {
+            if (networkError) throw networkError;
+            break;
+          }
+          const delay = CHUNK_RETRY_DELAYS_MS[attempt];
+          console.warn(`[OFFSCREEN] Backend unavailable (${networkError ? networkError.message : response.status}), retrying chunk in ${delay} ms`);
+          await new Promise((resolve) => setTimeout(resolve, delay));
+        }
+
+        console.log(`[OFFSCREEN] Backend response: ${response.status} ${response.statusText} (request ${requestId})`);
         
         if (!response.ok) {
           const errorText = await response.text();
-          console.error(`[OFFSCREEN] Backend error:`, errorText);
-          throw new Error(`Backend responded with ${response.status}: ${errorText}`);
+          console.error(`[OFFSCREEN] Backend error (request ${requestId}):`, errorText);
+          const error = new Error(`Backend responded with ${response.status}: ${errorText}`);
+          // Refusals such as the session limit come as JSON with a message
+          // meant for the user.
+          try {
+            const details = JSON.parse(errorText);
+            error.code = details.error;
+            error.userMessage = details.message;
+          } catch (parseError) {
+            // Plain text error
+          }
+          throw error;
         }
         
         console.log(`[OFFSCREEN] ✅ Chunk sent successfully to backend`);
+        const totalsKey = `${tabId}:${timestamp}`;
+        const totals = sentTotals.get(totalsKey) || { chunks: 0, bytes: 0 };
+        totals.chunks++;
+        totals.bytes += chunk.size;
+        sentTotals.set(totalsKey, totals);
         
     } catch (error) {
         console.error(`[OFFSCREEN] ❌ Error sending chunk to backend:`, error);
@@ -106,13 +491,37 @@ async function waitForPendingChunks() {
     });
 }
 
+// Answered synchronously, as the listener below is async and cannot respond
+chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
+  if (message.target === 'offscreen' && message.type === 'get-active-recordings') {
+    sendResponse({ tabIds: [...activeRecorders.keys()] });
+  }
+});
+
 chrome.runtime.onMessage.addListener(async (message) => {
   if (message.type === 'set-backend-mode') {
     useBackendMode = message.useBackend;
+    backendApiToken = message.apiToken || '';
+    backendSigningSecret = message.signingSecret || '';
+    backendBaseUrl = `${message.backendUrl || defaultBackendUrl}/api`;
     console.log(`[OFFSCREEN] Recording mode set to: ${useBackendMode ? 'Backend' : 'Standalone'}`);
     console.log(`[OFFSCREEN] Backend URL: ${backendBaseUrl}`);
     return;
   }
+
+  if (message.type === 'listen-commands') {
+    // Reconnect in case the backend URL or token changed
+    if (commandSource) {
+      commandSource.close();
+      commandSource = null;
+    }
+    listenForCommands = true;
+    backendApiToken = message.apiToken || '';
+    backendBaseUrl = `${message.backendUrl || defaultBackendUrl}/api`;
+    connectCommands();
+    console.log(`[OFFSCREEN] Listening for backend commands at ${backendBaseUrl}`);
+    return;
+  }
   
   if (message.target !== 'offscreen') return;
 
@@ -120,47 +529,70 @@ chrome.runtime.onMessage.addListener(async (message) => {
     const tabId = message.tabId;
     const name = message.name || `recording-${tabId}`;
     const timestamp = Date.now();
+    const audioOnly = message.audioOnly || false;
     
     stopRequested = false;
     pendingChunks = 0;
     stopResolve = null;
     
     try {
-      const stream = await navigator.mediaDevices.getUserMedia({
+      const constraints = {
         audio: {
           mandatory: {
             chromeMediaSource: 'tab',
             chromeMediaSourceId: message.streamId
           }
-        },
-        video: {
+        }
+      };
+      if (!audioOnly) {
+        constraints.video = {
           mandatory: {
             chromeMediaSource: 'tab',
             chromeMediaSourceId: message.streamId
           }
-        }
-      });
+        };
+      }
+      const stream = await navigator.mediaDevices.getUserMedia(constraints);
 
       activeStreams.set(tabId, stream);
       
+      const requestedContainer = message.container || 'webm';
+      const format = chooseRecorderFormat(requestedContainer, audioOnly);
+      if (format.container !== requestedContainer) {
+        console.log(`[OFFSCREEN] ${requestedContainer} is not supported for this recording, recording ${format.container}`);
+      }
+
       recordingMetadata.set(tabId, {
         name: name,
-        timestamp: timestamp
+        timestamp: timestamp,
+        audioOnly: audioOnly,
+        container: format.container,
+        priority: message.priority || 'normal',
+        group: message.group || '',
+        profile: message.profile || ''
       });
 
       const audioContext = new AudioContext();
       const source = audioContext.createMediaStreamSource(stream);
       source.connect(audioContext.destination);
 
-      const options = { mimeType: 'video/webm; codecs=vp8,opus' };
-      
-      if (!MediaRecorder.isTypeSupported(options.mimeType)) {
-        options.mimeType = 'video/webm';
-      }
+      const options = format.mimeType ? { mimeType: format.mimeType } : {};
+      console.log(`[OFFSCREEN] Recording as ${format.mimeType || 'the browser default'}`);
 
       const mediaRecorder = new MediaRecorder(stream, options);
       activeRecorders.set(tabId, mediaRecorder);
 
+      // What the recording is made of, sent with its chunks
+      const videoSettings = stream.getVideoTracks()[0]?.getSettings() || {};
+      recordingMetadata.get(tabId).source = {
+        url: message.source?.url || '',
+        title: message.source?.title || '',
+        favIconUrl: message.source?.favIconUrl || '',
+        width: videoSettings.width || 0,
+        height: videoSettings.height || 0,
+        mimeType: mediaRecorder.mimeType || ''
+      };
+
       mediaRecorder.ondataavailable = async (event) => {
         if (event.data.size > 0) {
           const metadata = recordingMetadata.get(tabId);
@@ -179,16 +611,34 @@ chrome.runtime.onMessage.addListener(async (message) => {
           if (useBackendMode) {
             try {
               console.log(`[OFFSCREEN] Sending chunk to backend for tab ${tabId}`);
-              await sendChunkToBackend(
+              // The chunk belongs to the segment being recorded now, even if
+              // the recording is split before it is sent
+              const { name: chunkName, timestamp: chunkTimestamp } = metadata;
+              const sequence = nextChunkSequence(tabId, chunkTimestamp);
+              const previous = chunkUploads.get(tabId) || Promise.resolve();
+              const upload = previous.then(() => sendChunkToBackend(
                 tabId,
-                metadata.name,
-                metadata.timestamp,
-                event.data
-              );
+                chunkName,
+                chunkTimestamp,
+                sequence,
+                event.data,
+                metadata.audioOnly,
+                metadata.container,
+                metadata.priority,
+                metadata.group,
+                metadata.profile,
+                metadata.source
+              ));
+              chunkUploads.set(tabId, upload.catch(() => {}));
+              await upload;
               console.log(`[OFFSCREEN] ✅ Chunk sent successfully`);
             } catch (error) {
               console.error('[OFFSCREEN] ❌ Backend streaming failed, stopping recording:', error);
-              mediaRecorder.stop();
+              if (error.code === 'session_limit') {
+                sendRecordingError(tabId, error.userMessage);
+              }
+              const current = activeRecorders.get(tabId);
+              if (current && current.state !== 'inactive') current.stop();
             }
           } else {
             if (!recordedChunksMap.has(tabId)) {
@@ -202,35 +652,40 @@ chrome.runtime.onMessage.addListener(async (message) => {
 
       mediaRecorder.onstop = async () => {
         console.log(`[OFFSCREEN] Recording stopped for tab ${tabId}. Mode: ${useBackendMode ? 'Backend' : 'Standalone'}`);
+        const endedAt = Date.now();
         
         try {
           if (useBackendMode) {
             console.log(`[OFFSCREEN] Waiting for pending chunks before sending stop signal...`);
+            // Queued chunks and splits go out before the recording is stopped
+            await chunkUploads.get(tabId);
             await waitForPendingChunks();
             
             console.log(`[OFFSCREEN] Sending stop signal to backend`);
+            const stopTimestamp = recordingMetadata.get(tabId)?.timestamp || Date.now();
             const stopData = {
               name: recordingMetadata.get(tabId)?.name || '',
               tabId: tabId,
-              timestamp: recordingMetadata.get(tabId)?.timestamp || Date.now(),
+              timestamp: stopTimestamp,
               data: '',
-              status: 'stopped'
+              status: 'stopped',
+              ...takeSentTotals(tabId, stopTimestamp, endedAt)
             };
             console.log(`[OFFSCREEN] Stop data:`, stopData);
             
+            const stopBody = JSON.stringify(stopData);
+            const requestId = crypto.randomUUID();
             const response = await fetch(`${backendBaseUrl}/recordings`, {
               method: 'POST',
-              headers: {
-                'Content-Type': 'application/json'
-              },
-              body: JSON.stringify(stopData)
+              headers: await backendHeaders(stopData, stopBody, requestId),
+              body: stopBody
             });
 
-            console.log(`[OFFSCREEN] Backend response status: ${response.status}`);
+            console.log(`[OFFSCREEN] Backend response status: ${response.status} (request ${requestId})`);
             
             if (!response.ok) {
               const errorText = await response.text();
-              console.error(`[OFFSCREEN] Backend error response:`, errorText);
+              console.error(`[OFFSCREEN] Backend error response (request ${requestId}):`, errorText);
               throw new Error(`Failed to stop recording: ${response.status}`);
             }
 
@@ -242,30 +697,8 @@ chrome.runtime.onMessage.addListener(async (message) => {
             
           } else {
             console.log(`[OFFSCREEN] Processing standalone mode recording`);
-            const chunks = recordedChunksMap.get(tabId) || [];
-            console.log(`[OFFSCREEN] Total chunks collected: ${chunks.length}`);
-            
-            if (chunks.length === 0) {
-              throw new Error('No recorded data available');
-            }
-
-            const blob = new Blob(chunks, { type: 'video/webm' });
-            const url = URL.createObjectURL(blob);
-            let filename = recordingMetadata.get(tabId)?.name || `recording-${tabId}-${Date.now()}`;
-            
-            if (!filename.endsWith('.webm')) {
-              filename += '.webm';
-            }
-
-            console.log(`[OFFSCREEN] Sending save-recording message. Filename: ${filename}`);
-            chrome.runtime.sendMessage({
-              type: 'save-recording',
-              tabId: tabId,
-              data: url,
-              filename: filename
-            }).catch(err => console.error('[OFFSCREEN] Failed to save recording:', err));
-
-            recordedChunksMap.delete(tabId);
+            const segment = recordingMetadata.get(tabId)?.segment || 1;
+            saveStandaloneRecording(tabId, segment > 1 ? segment : null);
           }
 
           const stream = activeStreams.get(tabId);
@@ -273,6 +706,11 @@ chrome.runtime.onMessage.addListener(async (message) => {
           activeStreams.delete(tabId);
           recordingMetadata.delete(tabId);
           activeRecorders.delete(tabId);
+          chunkUploads.delete(tabId);
+          for (const key of sentTotals.keys()) {
+            if (key.startsWith(`${tabId}:`)) sentTotals.delete(key);
+          }
+          disconnectCommands();
           
           stopRequested = false;
           pendingChunks = 0;
@@ -289,6 +727,7 @@ chrome.runtime.onMessage.addListener(async (message) => {
       };
 
       mediaRecorder.start(1000);
+      connectCommands();
 
       console.log(`[OFFSCREEN] ✅ Recording started successfully`);
       console.log(`[OFFSCREEN] Mode: ${useBackendMode ? 'Backend' : 'Standalone'}`);
@@ -303,7 +742,6 @@ chrome.runtime.onMessage.addListener(async (message) => {
     const tabId = message.tabId;
     
     console.log(`[OFFSCREEN] Stop recording requested for tab ${tabId}`);
-    stopRequested = true;
     
     if (message.customFilename) {
       const metadata = recordingMetadata.get(tabId);
@@ -312,14 +750,10 @@ chrome.runtime.onMessage.addListener(async (message) => {
       }
     }
     
-    const mediaRecorder = activeRecorders.get(tabId);
-    
-    if (mediaRecorder && mediaRecorder.state !== 'inactive') {
-      console.log(`[OFFSCREEN] Requesting final data chunk before stopping for tab ${tabId}`);
-      mediaRecorder.requestData();
-      
-      console.log(`[OFFSCREEN] Stopping MediaRecorder for tab ${tabId}`);
-      mediaRecorder.stop();
-    }
+    stopRecorder(tabId);
+  } else if (message.type === 'split-recording') {
+    splitRecorder(message.tabId);
+  } else if (message.type === 'add-marker') {
+    addMarker(message.tabId, message.at);
   }
 });
\ No newline at end of file
@@ -6,6 +6,8 @@ Popup logic for two-color UI, health check with abort, countdown control, qualit
 const TOAST_DISPLAY_DURATION_MS = 2400;
 const HEALTH_CHECK_TIMEOUT_MS = 4500;
 const DEBOUNCE_DELAY_MS = 300;
+// Quality choice that records the tab's sound without video
+const AUDIO_ONLY_QUALITY = 'Audio only';
 const startBtn = document.getElementById('startBtn');
 const stopBtn = document.getElementById('stopBtn');
 const filenameInput = document.getElementById('filenameInput');
@@ -16,6 +18,13 @@ const toast = document.getElementById('toast');
 const checkStatusBtn = document.getElementById('checkStatusBtn');
 const downloadExeBtn = document.getElementById('downloadExeBtn');
 const qualitySelect = document.getElementById('qualitySelect');
+const formatSelect = document.getElementById('formatSelect');
+const prioritySelect = document.getElementById('prioritySelect');
+const groupInput = document.getElementById('groupInput');
+const profileInput = document.getElementById('profileInput');
+const apiTokenInput = document.getElementById('apiTokenInput');
+const signingSecretInput = document.getElementById('signingSecretInput');
+const serverUrlInput = document.getElementById('serverUrlInput');
 const countHours = document.getElementById('countHours');
 const countMinutes = document.getElementById('countMinutes');
 const countSeconds = document.getElementById('countSeconds');
@@ -32,9 +41,7 @@ let elapsedInterval = null;
 let healthController = null;
 let healthTimeoutId = null;
 let isConnected = false;
-const BACKEND_PORT = '8080';
-const BACKEND_BASE_URL = `http://localhost:${BACKEND_PORT}/api`;
-const BACKEND_HEALTH_URL = `http://localhost:${BACKEND_PORT}/api/health`;
+const DEFAULT_BACKEND_URL = 'http://localhost:8080';
 const EXECUTABLE_DOWNLOAD_URL = 'https://github.com/avijitbhuin21/TAB-RECORDER/raw/refs/heads/main/Extension/src/popup/recorder-windows-amd64.exe';
 
 function announce(msg) {
@@ -80,6 +87,10 @@ function updateRecordingUI(recording) {
   stopBtn.disabled = !recording;
   filenameInput.disabled = recording;
   qualitySelect.disabled = recording;
+  formatSelect.disabled = recording;
+  prioritySelect.disabled = recording;
+  groupInput.disabled = recording;
+  profileInput.disabled = recording;
   if (recording) {
     recordingIndicator.classList.add('active');
   } else {
@@ -147,6 +158,40 @@ async function setToStorage(key, value) {
 }
 
 
+// Normalizes the configured server URL (e.g. "https://192.168.1.5:8080/") to "scheme://host:port".
+function normalizeBackendUrl(value) {
+  const trimmed = (value || '').trim().replace(/\/+$/, '');
+  return trimmed || DEFAULT_BACKEND_URL;
+}
+
+function backendHealthUrl() {
+  return `${normalizeBackendUrl(serverUrlInput.value)}/api/health`;
+}
+
+async function loadBackendUrl() {
+  return await getFromStorage('backendUrl', DEFAULT_BACKEND_URL);
+}
+
+async function saveBackendUrl(url) {
+  return await setToStorage('backendUrl', url);
+}
+
+async function loadApiToken() {
+  return await getFromStorage('apiToken', '');
+}
+
+async function saveApiToken(token) {
+  return await setToStorage('apiToken', token);
+}
+
+async function loadSigningSecret() {
+  return await getFromStorage('signingSecret', '');
+}
+
+async function saveSigningSecret(secret) {
+  return await setToStorage('signingSecret', secret);
+}
+
 async function loadSavedFilename(tabId) {
   return await getFromStorage(`recordingFilename_${tabId}`, '');
 }
@@ -181,7 +226,7 @@ async function loadQualities() {
       return result.recordingQualities.map(String);
     }
   } catch {}
-  return ['480p', '720p', '1080p', '4K'];
+  return ['480p', '720p', '1080p', '4K', AUDIO_ONLY_QUALITY];
 }
 
 async function saveSelectedQuality(value) {
@@ -192,6 +237,30 @@ async function loadSelectedQuality() {
   return new Promise((resolve) => chrome.storage.local.get(['selectedRecordingQuality'], (r) => resolve(r.selectedRecordingQuality || '')));
 }
 
+async function saveSelectedFormat(value) {
+  return new Promise((resolve) => chrome.storage.local.set({ selectedRecordingFormat: value }, () => resolve()));
+}
+
+async function loadSelectedFormat() {
+  return new Promise((resolve) => chrome.storage.local.get(['selectedRecordingFormat'], (r) => resolve(r.selectedRecordingFormat || 'webm')));
+}
+
+async function saveSelectedGroup(value) {
+  return new Promise((resolve) => chrome.storage.local.set({ selectedRecordingGroup: value }, () => resolve()));
+}
+
+async function loadSelectedGroup() {
+  return new Promise((resolve) => chrome.storage.local.get(['selectedRecordingGroup'], (r) => resolve(r.selectedRecordingGroup || '')));
+}
+
+async function saveSelectedProfile(value) {
+  return new Promise((resolve) => chrome.storage.local.set({ selectedRecordingProfile: value }, () => resolve()));
+}
+
+async function loadSelectedProfile() {
+  return new Promise((resolve) => chrome.storage.local.get(['selectedRecordingProfile'], (r) => resolve(r.selectedRecordingProfile || '')));
+}
+
 async function populateQualities() {
   const qualities = await loadQualities();
   qualitySelect.innerHTML = '';
@@ -223,6 +292,13 @@ async function initializePopup() {
   updateCountdownPreview();
 
   await populateQualities();
+  formatSelect.value = await loadSelectedFormat();
+  groupInput.value = await loadSelectedGroup();
+  profileInput.value = await loadSelectedProfile();
+
+  serverUrlInput.value = await loadBackendUrl();
+  apiTokenInput.value = await loadApiToken();
+  signingSecretInput.value = await loadSigningSecret();
   
   await checkHealth();
 
@@ -250,11 +326,19 @@ async function startRecording() {
     const [tab] = await chrome.tabs.query({ active: true, currentWindow: true });
     const customFilename = filenameInput.value.trim();
     const quality = qualitySelect.value;
+    const container = formatSelect.value;
+    const priority = prioritySelect.value;
+    const group = groupInput.value.trim();
+    const profile = profileInput.value.trim();
     const countdownSeconds = countdownTotalSecondsFromInputs();
     
     console.log(`[POPUP] Tab ID: ${tab.id}`);
     console.log(`[POPUP] Filename: ${customFilename || 'default'}`);
     console.log(`[POPUP] Quality: ${quality}`);
+    console.log(`[POPUP] Format: ${container}`);
+    console.log(`[POPUP] Priority: ${priority}`);
+    console.log(`[POPUP] Group: ${group || 'none'}`);
+    console.log(`[POPUP] Profile: ${profile || 'default'}`);
     console.log(`[POPUP] Countdown: ${countdownSeconds} seconds`);
     console.log(`[POPUP] Mode: ${isConnected ? 'Backend' : 'Standalone'}`);
     
@@ -263,6 +347,11 @@ async function startRecording() {
       tabId: tab.id,
       customFilename,
       quality,
+      audioOnly: quality === AUDIO_ONLY_QUALITY,
+      container,
+      priority,
+      group,
+      profile,
       countdownSeconds,
       useBackend: isConnected
     });
@@ -320,24 +409,38 @@ function updateCountdownPreview() {
 }
 
 
-async function checkHealth(showMessages = false) {
-  console.log(`[POPUP] Checking backend health at ${BACKEND_HEALTH_URL}`);
+async function checkHealth(showMessages = false, rediscovered = false) {
+  const healthUrl = backendHealthUrl();
+  console.log(`[POPUP] Checking backend health at ${healthUrl}`);
   
   try {
     updateConnectionUI(false, true);
     
-    const response = await fetch(BACKEND_HEALTH_URL, {
+    const token = apiTokenInput.value.trim();
+    const headers = { 'Content-Type': 'application/json' };
+    if (token) headers['Authorization'] = `Bearer ${token}`;
+
+    const response = await fetch(healthUrl, {
       method: 'GET',
-      headers: { 'Content-Type': 'application/json' }
+      headers
     });
     
     console.log(`[POPUP] Health check response: ${response.status} ${response.statusText}`);
+
+    if (response.status === 401) {
+      isConnected = false;
+      updateConnectionUI(false);
+      console.log(`[POPUP] ❌ Backend rejected the API token`);
+      if (showMessages) showToast(token ? 'Invalid API token' : 'API token required', 'error');
+      return false;
+    }
     
     if (response.ok && response.status === 200) {
       const data = await response.json();
       console.log(`[POPUP] Health check data:`, data);
       
-      if (data.status && data.status === 'ok') {
+      // "degraded" means post-processing is impaired but recording still works.
+      if (data.status === 'ok' || data.status === 'degraded') {
         isConnected = true;
         updateConnectionUI(true);
         console.log(`[POPUP] ✅ Backend connected successfully`);
@@ -354,12 +457,48 @@ async function checkHealth(showMessages = false) {
     
   } catch (error) {
     console.error('[POPUP] Health check failed:', error);
+    if (!rediscovered && await discoverBackend()) {
+      return checkHealth(showMessages, true);
+    }
     isConnected = false;
     updateConnectionUI(false);
     return false;
   }
 }
 
+// The server falls back to the next free port when its port is busy. When a
+// local server is unreachable, probe that range for it and adopt its URL.
+const DISCOVERY_PORTS = Array.from({ length: 11 }, (_, i) => 8080 + i);
+
+async function discoverBackend() {
+  let current;
+  try {
+    current = new URL(normalizeBackendUrl(serverUrlInput.value));
+  } catch {
+    return false;
+  }
+  if (!['localhost', '127.0.0.1', '[::1]'].includes(current.hostname)) return false;
+
+  const currentPort = Number(current.port) || (current.protocol === 'https:' ? 443 : 80);
+  for (const port of DISCOVERY_PORTS) {
+    if (port === currentPort) continue;
+    const url = `${current.protocol}//${current.hostname}:${port}`;
+    try {
+      const response = await fetch(`${url}/api/discovery`, { signal: AbortSignal.timeout(500) });
+      if (!response.ok) continue;
+      const info = await response.json();
+      if (info.service !== 'tab-recorder') continue;
+      console.log(`[POPUP] Found backend on port ${port}`);
+      serverUrlInput.value = url;
+      await saveBackendUrl(url);
+      return true;
+    } catch {
+      // Nothing listening on this port.
+    }
+  }
+  return false;
+}
+
 chrome.runtime.onMessage.addListener((message) => {
   if (!message.tabId || message.tabId === currentTabId) {
     if (message.type === 'recording-started') {
@@ -399,10 +538,37 @@ filenameInput.addEventListener('input', async () => {
   await saveFilename(currentTabId, name);
 });
 
+serverUrlInput.addEventListener('change', async () => {
+  serverUrlInput.value = normalizeBackendUrl(serverUrlInput.value);
+  await saveBackendUrl(serverUrlInput.value);
+  await checkHealth(true);
+});
+
+apiTokenInput.addEventListener('change', async () => {
+  await saveApiToken(apiTokenInput.value.trim());
+  await checkHealth(true);
+});
+
+signingSecretInput.addEventListener('change', async () => {
+  await saveSigningSecret(signingSecretInput.value.trim());
+});
+
 qualitySelect.addEventListener('change', async () => {
   await saveSelectedQuality(qualitySelect.value);
 });
 
+formatSelect.addEventListener('change', async () => {
+  await saveSelectedFormat(formatSelect.value);
+});
+
+groupInput.addEventListener('input', async () => {
+  await saveSelectedGroup(groupInput.value.trim());
+});
+
+profileInput.addEventListener('input', async () => {
+  await saveSelectedProfile(profileInput.value.trim());
+});
+
 startBtn.addEventListener('click', startRecording);
 stopBtn.addEventListener('click', stopRecording);
 